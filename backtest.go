@@ -0,0 +1,123 @@
+package ninjabot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/storage"
+	"github.com/rodrigo-brito/ninjabot/strategy"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Backtest is a candidate of a backtest comparison, e.g. a strategy with a set of parameters.
+// Each backtest must have its own strategy instance, since strategies may keep state between candles
+type Backtest struct {
+	Name     string
+	Strategy strategy.Strategy
+	// Options are additional bot options of the backtest, e.g. WithFees
+	Options []Option
+}
+
+// BacktestResult is the performance of a backtest, calculated from the paper wallet equity
+type BacktestResult struct {
+	Name string
+	// Return is the change of the wallet value, e.g. 0.1 for 10%
+	Return float64
+	// MaxDrawdown is the largest decline of the equity, as a negative percentage (e.g. -0.2 for 20%)
+	MaxDrawdown float64
+	Sharpe      float64
+	Trades      int
+	// WinRate is the fraction of profitable trades, e.g. 0.6 for 60%
+	WinRate float64
+	Equity  model.EquityCurve
+}
+
+// BacktestComparison is the result of backtests executed with the same settings and data
+type BacktestComparison []BacktestResult
+
+// CompareBacktests runs the backtests sequentially with the same settings, each one with a new paper wallet
+// created by the given function, e.g. with the initial assets and a shared CSV feed. The equity curves of the
+// results can be plotted together with plot.RenderEquityPNG
+func CompareBacktests(ctx context.Context, settings Settings, wallet func() *exchange.PaperWallet,
+	backtests ...Backtest) (BacktestComparison, error) {
+
+	results := make(BacktestComparison, 0, len(backtests))
+	for _, backtest := range backtests {
+		result, err := runBacktest(ctx, settings, wallet(), backtest)
+		if err != nil {
+			return nil, fmt.Errorf("backtest %s: %w", backtest.Name, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runBacktest(ctx context.Context, settings Settings, wallet *exchange.PaperWallet,
+	backtest Backtest) (BacktestResult, error) {
+
+	db, err := storage.FromMemory()
+	if err != nil {
+		return BacktestResult{}, err
+	}
+
+	options := append([]Option{WithBacktest(wallet), WithStorage(db)}, backtest.Options...)
+	bot, err := NewBot(ctx, settings, wallet, backtest.Strategy, options...)
+	if err != nil {
+		return BacktestResult{}, err
+	}
+
+	if err := bot.Run(ctx); err != nil {
+		return BacktestResult{}, err
+	}
+
+	result := BacktestResult{Name: backtest.Name}
+	for _, value := range wallet.EquityValues() {
+		result.Equity = append(result.Equity, model.EquitySnapshot{Time: value.Time, Equity: value.Value})
+	}
+
+	if initial := wallet.InitialValue(); initial > 0 {
+		result.Return = (wallet.Equity() - initial) / initial
+	}
+	result.MaxDrawdown, _, _ = result.Equity.MaxDrawdown()
+	result.Sharpe = result.Equity.SharpeRatio(result.Equity.PeriodsPerYear())
+
+	var wins int
+	for _, summary := range bot.Controller().Results {
+		wins += len(summary.Win())
+		result.Trades += len(summary.Win()) + len(summary.Lose())
+	}
+
+	if result.Trades > 0 {
+		result.WinRate = float64(wins) / float64(result.Trades)
+	}
+
+	return result, nil
+}
+
+// String returns a table with the metrics of each backtest
+func (c BacktestComparison) String() string {
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	table.SetHeader([]string{"Backtest", "Return", "Max Drawdown", "Sharpe", "Trades", "% Win"})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT,
+		tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+
+	for _, result := range c {
+		table.Append([]string{
+			result.Name,
+			fmt.Sprintf("%.2f %%", result.Return*100),
+			fmt.Sprintf("%.2f %%", result.MaxDrawdown*100),
+			fmt.Sprintf("%.2f", result.Sharpe),
+			strconv.Itoa(result.Trades),
+			fmt.Sprintf("%.1f %%", result.WinRate*100),
+		})
+	}
+
+	table.Render()
+	return buffer.String()
+}
@@ -0,0 +1,141 @@
+package ninjabot
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+// candleExport writes the candles processed by the strategy to a CSV file per pair
+type candleExport struct {
+	mtx       sync.Mutex
+	dir       string
+	timeframe string
+	files     map[string]*candleFile
+}
+
+type candleFile struct {
+	file     *os.File
+	writer   *csv.Writer
+	metadata []string
+	err      error
+}
+
+// WithCandleExport writes the closed candles received by the strategy to a CSV file per pair in the given
+// directory, named as <pair>-<timeframe>.csv. The candles are written in their final form, after the
+// resampling and Heikin Ashi conversion of the feed, with the columns of the CSV feed and the candle metadata,
+// so the files can be loaded with exchange.NewCSVFeed to reproduce a backtest
+func WithCandleExport(dir string) Option {
+	return func(bot *NinjaBot) {
+		bot.candleExport = &candleExport{
+			dir:       dir,
+			timeframe: bot.strategy.Timeframe(),
+			files:     make(map[string]*candleFile),
+		}
+	}
+}
+
+// exportCandle writes a closed candle to the export files, see WithCandleExport
+func (n *NinjaBot) exportCandle(candle model.Candle) {
+	if n.candleExport != nil {
+		n.candleExport.write(candle)
+	}
+}
+
+func (e *candleExport) write(candle model.Candle) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	file, ok := e.files[candle.Pair]
+	if !ok {
+		file = e.open(candle)
+		e.files[candle.Pair] = file
+	}
+
+	if file.err != nil {
+		return
+	}
+
+	record := candle.ToSlice(-1)
+	for _, key := range file.metadata {
+		record = append(record, strconv.FormatFloat(candle.Metadata[key], 'f', -1, 64))
+	}
+
+	if err := file.writer.Write(record); err != nil {
+		file.fail(candle.Pair, err)
+		return
+	}
+
+	// keep the file updated in live trading
+	file.writer.Flush()
+	if err := file.writer.Error(); err != nil {
+		file.fail(candle.Pair, err)
+	}
+}
+
+// open creates the file of the candle pair with the header, the metadata columns are the keys of the first candle
+func (e *candleExport) open(candle model.Candle) *candleFile {
+	result := &candleFile{}
+	for key := range candle.Metadata {
+		result.metadata = append(result.metadata, key)
+	}
+	sort.Strings(result.metadata)
+
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		result.fail(candle.Pair, err)
+		return result
+	}
+
+	path := filepath.Join(e.dir, fmt.Sprintf("%s-%s.csv", candle.Pair, e.timeframe))
+	file, err := os.Create(path)
+	if err != nil {
+		result.fail(candle.Pair, err)
+		return result
+	}
+
+	result.file = file
+	result.writer = csv.NewWriter(file)
+	header := append([]string{"time", "open", "close", "low", "high", "volume"}, result.metadata...)
+	if err := result.writer.Write(header); err != nil {
+		result.fail(candle.Pair, err)
+	}
+
+	return result
+}
+
+// fail stops the export of the pair, the bot keeps running
+func (f *candleFile) fail(pair string, err error) {
+	f.err = err
+	log.Errorf("[EXPORT] %s candles: %v", pair, err)
+}
+
+// close flushes and closes the files of all pairs
+func (e *candleExport) close() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for pair, file := range e.files {
+		if file.file == nil {
+			continue
+		}
+
+		if file.err == nil {
+			file.writer.Flush()
+			if err := file.writer.Error(); err != nil {
+				file.fail(pair, err)
+			}
+		}
+
+		if err := file.file.Close(); err != nil {
+			log.Errorf("[EXPORT] %s candles: %v", pair, err)
+		}
+	}
+	e.files = make(map[string]*candleFile)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/rodrigo-brito/ninjabot/download"
 	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/service"
 
 	"github.com/urfave/cli/v2"
@@ -60,6 +62,12 @@ func main() {
 						Usage:    "eg. ./btc.csv",
 						Required: true,
 					},
+					&cli.StringFlag{
+						Name:     "time-mode",
+						Usage:    "candle timestamp: open or close time (default open)",
+						Value:    string(model.CandleTimeOpen),
+						Required: false,
+					},
 					&cli.BoolFlag{
 						Name:     "futures",
 						Aliases:  []string{"f"},
@@ -88,7 +96,12 @@ func main() {
 						}
 					}
 
-					var options []download.Option
+					mode := model.CandleTimeMode(c.String("time-mode"))
+					if mode != model.CandleTimeOpen && mode != model.CandleTimeClose {
+						return fmt.Errorf("invalid time mode: %s", mode)
+					}
+
+					options := []download.Option{download.WithCandleTimeMode(mode)}
 					if days := c.Int("days"); days > 0 {
 						options = append(options, download.WithDays(days))
 					}
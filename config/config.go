@@ -0,0 +1,209 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// Environment variables used to override values from config file
+const (
+	EnvPairs         = "NINJABOT_PAIRS"
+	EnvAPIKey        = "NINJABOT_API_KEY"
+	EnvAPISecret     = "NINJABOT_API_SECRET"
+	EnvTelegramToken = "NINJABOT_TELEGRAM_TOKEN"
+	EnvTelegramUsers = "NINJABOT_TELEGRAM_USERS"
+	EnvSlackWebhook  = "NINJABOT_SLACK_WEBHOOK"
+	EnvSlackToken    = "NINJABOT_SLACK_TOKEN"
+	EnvTestnet       = "NINJABOT_TESTNET"
+)
+
+type Telegram struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Token   string `json:"token" yaml:"token"`
+	Users   []int  `json:"users" yaml:"users"`
+	// Roles maps the users to their roles (viewer, trader or admin), the users without a role are admins
+	Roles map[int]model.TelegramRole `json:"roles" yaml:"roles"`
+}
+
+type Slack struct {
+	Enabled    bool   `json:"enabled" yaml:"enabled"`
+	WebhookURL string `json:"webhook_url" yaml:"webhook_url"`
+	Token      string `json:"token" yaml:"token"`
+	Channel    string `json:"channel" yaml:"channel"`
+}
+
+type Exchange struct {
+	APIKey     string `json:"api_key" yaml:"api_key"`
+	APISecret  string `json:"api_secret" yaml:"api_secret"`
+	Testnet    bool   `json:"testnet" yaml:"testnet"`
+	HeikinAshi bool   `json:"heikin_ashi" yaml:"heikin_ashi"`
+}
+
+type Config struct {
+	Pairs    []string `json:"pairs" yaml:"pairs"`
+	Telegram Telegram `json:"telegram" yaml:"telegram"`
+	Slack    Slack    `json:"slack" yaml:"slack"`
+	Exchange Exchange `json:"exchange" yaml:"exchange"`
+	// Parameters are the strategy parameters, see strategy.ConfigurableStrategy
+	Parameters model.Parameters `json:"parameters" yaml:"parameters"`
+}
+
+// Load reads the bot settings and exchange credentials from a YAML or JSON file.
+// Values defined in environment variables (eg: NINJABOT_API_KEY) take precedence over the file. Example:
+//
+//	cfg, err := config.Load("config.yml")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	binance, err := exchange.NewBinance(ctx, cfg.BinanceOptions()...)
+//	bot, err := ninjabot.NewBot(ctx, cfg.Settings(), binance, strategy)
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(Config)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, cfg)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, cfg)
+	default:
+		return nil, fmt.Errorf("config: unsupported file format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid file %s: %w", path, err)
+	}
+
+	err = cfg.loadEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadEnv() error {
+	if value, ok := os.LookupEnv(EnvPairs); ok {
+		c.Pairs = splitList(value)
+	}
+
+	if value, ok := os.LookupEnv(EnvAPIKey); ok {
+		c.Exchange.APIKey = value
+	}
+
+	if value, ok := os.LookupEnv(EnvAPISecret); ok {
+		c.Exchange.APISecret = value
+	}
+
+	if value, ok := os.LookupEnv(EnvTestnet); ok {
+		testnet, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("config: invalid %s: %w", EnvTestnet, err)
+		}
+		c.Exchange.Testnet = testnet
+	}
+
+	if value, ok := os.LookupEnv(EnvTelegramToken); ok {
+		c.Telegram.Token = value
+		c.Telegram.Enabled = value != ""
+	}
+
+	if value, ok := os.LookupEnv(EnvTelegramUsers); ok {
+		c.Telegram.Users = nil
+		for _, item := range splitList(value) {
+			user, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("config: invalid %s: %w", EnvTelegramUsers, err)
+			}
+			c.Telegram.Users = append(c.Telegram.Users, user)
+		}
+	}
+
+	if value, ok := os.LookupEnv(EnvSlackWebhook); ok {
+		c.Slack.WebhookURL = value
+		c.Slack.Enabled = value != "" || c.Slack.Token != ""
+	}
+
+	if value, ok := os.LookupEnv(EnvSlackToken); ok {
+		c.Slack.Token = value
+		c.Slack.Enabled = value != "" || c.Slack.WebhookURL != ""
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Settings returns the bot settings
+func (c Config) Settings() model.Settings {
+	pairs := make([]string, 0, len(c.Pairs))
+	for _, pair := range c.Pairs {
+		pairs = append(pairs, strings.ToUpper(pair))
+	}
+
+	return model.Settings{
+		Pairs: pairs,
+		Telegram: model.TelegramSettings{
+			Enabled: c.Telegram.Enabled,
+			Token:   c.Telegram.Token,
+			Users:   c.Telegram.Users,
+			Roles:   c.Telegram.Roles,
+		},
+		Slack: model.SlackSettings{
+			Enabled:    c.Slack.Enabled,
+			WebhookURL: c.Slack.WebhookURL,
+			Token:      c.Slack.Token,
+			Channel:    c.Slack.Channel,
+		},
+		Parameters: c.Parameters,
+	}
+}
+
+// BinanceOptions returns the options to initialize a Binance spot exchange
+func (c Config) BinanceOptions() []exchange.BinanceOption {
+	options := []exchange.BinanceOption{
+		exchange.WithBinanceCredentials(c.Exchange.APIKey, c.Exchange.APISecret),
+	}
+
+	if c.Exchange.Testnet {
+		options = append(options, exchange.WithTestNet())
+	}
+
+	if c.Exchange.HeikinAshi {
+		options = append(options, exchange.WithBinanceHeikinAshiCandle())
+	}
+
+	return options
+}
+
+// BinanceFutureOptions returns the options to initialize a Binance futures exchange
+func (c Config) BinanceFutureOptions() []exchange.BinanceFutureOption {
+	options := []exchange.BinanceFutureOption{
+		exchange.WithBinanceFutureCredentials(c.Exchange.APIKey, c.Exchange.APISecret),
+	}
+
+	if c.Exchange.HeikinAshi {
+		options = append(options, exchange.WithBinanceFuturesHeikinAshiCandle())
+	}
+
+	return options
+}
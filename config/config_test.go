@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	expected := model.Settings{
+		Pairs: []string{"BTCUSDT", "ETHUSDT"},
+		Telegram: model.TelegramSettings{
+			Enabled: true,
+			Token:   "token",
+			Users:   []int{1, 2},
+		},
+	}
+
+	t.Run("yaml", func(t *testing.T) {
+		path := writeFile(t, "config.yml", `
+pairs:
+  - btcusdt
+  - ETHUSDT
+telegram:
+  enabled: true
+  token: token
+  users: [1, 2]
+exchange:
+  api_key: key
+  api_secret: secret
+  testnet: true
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, expected, cfg.Settings())
+		require.Equal(t, Exchange{APIKey: "key", APISecret: "secret", Testnet: true}, cfg.Exchange)
+		require.Len(t, cfg.BinanceOptions(), 2)
+		require.Len(t, cfg.BinanceFutureOptions(), 1)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		path := writeFile(t, "config.json", `{
+			"pairs": ["BTCUSDT", "ETHUSDT"],
+			"telegram": {"enabled": true, "token": "token", "users": [1, 2]},
+			"exchange": {"api_key": "key", "api_secret": "secret"}
+		}`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, expected, cfg.Settings())
+		require.Equal(t, Exchange{APIKey: "key", APISecret: "secret"}, cfg.Exchange)
+	})
+
+	t.Run("env override", func(t *testing.T) {
+		t.Setenv(EnvPairs, "BNBUSDT, ADAUSDT")
+		t.Setenv(EnvAPIKey, "env-key")
+		t.Setenv(EnvAPISecret, "env-secret")
+		t.Setenv(EnvTelegramToken, "env-token")
+		t.Setenv(EnvTelegramUsers, "3")
+
+		path := writeFile(t, "config.yml", `
+pairs: [BTCUSDT]
+exchange:
+  api_key: key
+  api_secret: secret
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, model.Settings{
+			Pairs: []string{"BNBUSDT", "ADAUSDT"},
+			Telegram: model.TelegramSettings{
+				Enabled: true,
+				Token:   "env-token",
+				Users:   []int{3},
+			},
+		}, cfg.Settings())
+		require.Equal(t, "env-key", cfg.Exchange.APIKey)
+		require.Equal(t, "env-secret", cfg.Exchange.APISecret)
+	})
+
+	t.Run("telegram roles", func(t *testing.T) {
+		path := writeFile(t, "config.yml", `
+pairs: [BTCUSDT]
+telegram:
+  enabled: true
+  token: token
+  users: [1, 2, 3]
+  roles:
+    1: viewer
+    2: trader
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		settings := cfg.Settings().Telegram
+		require.Equal(t, map[int]model.TelegramRole{
+			1: model.TelegramRoleViewer,
+			2: model.TelegramRoleTrader,
+		}, settings.Roles)
+		require.Equal(t, model.TelegramRoleAdmin, settings.Role(3))
+
+		path = writeFile(t, "config.json", `{
+			"pairs": ["BTCUSDT"],
+			"telegram": {"users": [1], "roles": {"1": "trader"}}
+		}`)
+		cfg, err = Load(path)
+		require.NoError(t, err)
+		require.Equal(t, model.TelegramRoleTrader, cfg.Settings().Telegram.Role(1))
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		path := writeFile(t, "config.yml", `
+pairs: [BTCUSDT]
+slack:
+  enabled: true
+  token: xoxb-token
+  channel: "#trading"
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, model.SlackSettings{
+			Enabled: true,
+			Token:   "xoxb-token",
+			Channel: "#trading",
+		}, cfg.Settings().Slack)
+
+		t.Setenv(EnvSlackWebhook, "https://hooks.slack.com/services/T/B/X")
+		path = writeFile(t, "config.yml", `pairs: [BTCUSDT]`)
+		cfg, err = Load(path)
+		require.NoError(t, err)
+		require.True(t, cfg.Settings().Slack.Enabled)
+		require.Equal(t, "https://hooks.slack.com/services/T/B/X", cfg.Settings().Slack.WebhookURL)
+	})
+
+	t.Run("parameters", func(t *testing.T) {
+		path := writeFile(t, "config.yml", `
+pairs: [BTCUSDT]
+parameters:
+  period: 21
+  threshold: 0.5
+  interval: 4h
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+
+		params := cfg.Settings().Parameters
+		period, err := params.Int("period", 0)
+		require.NoError(t, err)
+		require.Equal(t, 21, period)
+		threshold, err := params.Float("threshold", 0)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, threshold)
+		require.Equal(t, "4h", params.String("interval", ""))
+
+		path = writeFile(t, "config.json", `{"pairs": ["BTCUSDT"], "parameters": {"period": 21}}`)
+		cfg, err = Load(path)
+		require.NoError(t, err)
+		period, err = cfg.Settings().Parameters.Int("period", 0)
+		require.NoError(t, err)
+		require.Equal(t, 21, period)
+	})
+
+	t.Run("invalid env", func(t *testing.T) {
+		t.Setenv(EnvTelegramUsers, "abc")
+		path := writeFile(t, "config.yml", `pairs: [BTCUSDT]`)
+		_, err := Load(path)
+		require.Error(t, err)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		path := writeFile(t, "config.toml", `pairs = ["BTCUSDT"]`)
+		_, err := Load(path)
+		require.Error(t, err)
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		_, err := Load("not-found.yml")
+		require.Error(t, err)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/schollz/progressbar/v3"
 	"github.com/xhit/go-str2duration/v2"
 
+	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/service"
 	"github.com/rodrigo-brito/ninjabot/tools/log"
 )
@@ -26,8 +27,9 @@ func NewDownloader(exchange service.Feeder) Downloader {
 }
 
 type Parameters struct {
-	Start time.Time
-	End   time.Time
+	Start    time.Time
+	End      time.Time
+	TimeMode model.CandleTimeMode
 }
 
 type Option func(*Parameters)
@@ -46,6 +48,14 @@ func WithDays(days int) Option {
 	}
 }
 
+// WithCandleTimeMode sets the timestamp convention of the output file, the open time (default)
+// or the close time of the candles
+func WithCandleTimeMode(mode model.CandleTimeMode) Option {
+	return func(parameters *Parameters) {
+		parameters.TimeMode = mode
+	}
+}
+
 func candlesCount(start, end time.Time, timeframe string) (int, time.Duration, error) {
 	totalDuration := end.Sub(start)
 	interval, err := str2duration.ParseDuration(timeframe)
@@ -118,6 +128,7 @@ func (d Downloader) Download(ctx context.Context, pair, timeframe string, output
 		}
 
 		for _, candle := range candles {
+			candle.Time = parameters.TimeMode.Timestamp(candle.Time, interval)
 			err := writer.Write(candle.ToSlice(info.QuotePrecision))
 			if err != nil {
 				return err
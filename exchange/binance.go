@@ -2,24 +2,91 @@ package exchange
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/common"
+	"github.com/gorilla/websocket"
 	"github.com/jpillora/backoff"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/tools/log"
 )
 
+const (
+	ErrTooManyRequests        int64 = -1003
+	ErrFilterFailure          int64 = -1013
+	ErrTooManyOrders          int64 = -1015
+	ErrNewOrderRejected       int64 = -2010
+	ErrMarginInsufficient     int64 = -2019
+	ErrCancelReplaceFailed    int64 = -2022
+	ErrCancelReplacePartial   int64 = -2021
+	ErrClientOrderIDDuplicate int64 = -4116
+	ErrFutureMinNotional      int64 = -4164
+	insufficientBalanceMsg          = "insufficient balance"
+	binanceStreamURL                = "wss://stream.binance.com:9443/ws"
+	binanceTestnetStreamURL         = "wss://testnet.binance.vision/ws"
+	notionalMsg                     = "notional"
+	marketClosedMsg                 = "market is closed"
+	duplicateOrderMsg               = "duplicate order"
+)
+
 type MetadataFetchers func(pair string, t time.Time) (string, float64)
 
+// isBinanceInsufficientFunds checks the error codes of orders rejected due to insufficient balance or margin
+func isBinanceInsufficientFunds(apiError *common.APIError) bool {
+	return apiError.Code == ErrMarginInsufficient || (apiError.Code == ErrNewOrderRejected &&
+		strings.Contains(strings.ToLower(apiError.Message), insufficientBalanceMsg))
+}
+
+// binanceError classifies the API errors of orders with the exchange sentinel errors, other errors are
+// returned unchanged
+func binanceError(err error) error {
+	var apiError *common.APIError
+	if !errors.As(err, &apiError) {
+		return err
+	}
+
+	message := strings.ToLower(apiError.Message)
+	var kind error
+	switch {
+	case isBinanceInsufficientFunds(apiError):
+		kind = ErrInsufficientFunds
+	case apiError.Code == ErrTooManyRequests || apiError.Code == ErrTooManyOrders:
+		kind = ErrRateLimited
+	case apiError.Code == ErrFutureMinNotional ||
+		(apiError.Code == ErrFilterFailure && strings.Contains(message, notionalMsg)):
+		kind = ErrMinNotional
+	case apiError.Code == ErrClientOrderIDDuplicate || strings.Contains(message, duplicateOrderMsg):
+		kind = ErrDuplicateOrder
+	case strings.Contains(message, marketClosedMsg):
+		kind = ErrMarketClosed
+	default:
+		return err
+	}
+
+	return &ExchangeError{Kind: kind, Err: err}
+}
+
 type Binance struct {
 	ctx        context.Context
 	client     *binance.Client
 	assetsInfo map[string]model.AssetInfo
+	assetsMtx  sync.RWMutex
 	HeikinAshi bool
 	Testnet    bool
 
@@ -27,6 +94,29 @@ type Binance struct {
 	APISecret string
 
 	MetadataFetchers []MetadataFetchers
+
+	marginTypes map[string]MarginType
+	clock       *clockSync
+	recvWindow  time.Duration
+	httpClient  *http.Client
+	proxy       *url.URL
+	debug       bool
+	precision   precisionOverrides
+
+	// guards the orders created in the margin account
+	marginMtx    sync.RWMutex
+	marginOrders map[int64]bool
+
+	// timestamp convention of the candles, see SetCandleTimeMode
+	timeMode model.CandleTimeMode
+
+	// websocket streams, see WithBinanceDialer
+	dialer    *websocket.Dialer
+	streamURL string
+
+	pingInterval time.Duration
+	readTimeout  time.Duration
+	infoRefresh  time.Duration
 }
 
 type BinanceOption func(*Binance)
@@ -61,27 +151,161 @@ func WithTestNet() BinanceOption {
 	}
 }
 
+// WithBinanceRecvWindow sets the receive window of signed requests, the maximum delay accepted by the
+// server between the request timestamp and its arrival. Default: 5 seconds
+func WithBinanceRecvWindow(window time.Duration) BinanceOption {
+	return func(b *Binance) {
+		b.recvWindow = window
+	}
+}
+
+// WithBinanceClockSync sets the interval to synchronize the offset with the server time, applied to signed
+// requests, and the clock difference that logs a warning. A zero interval synchronizes only at startup.
+// Default: DefaultClockSyncInterval and DefaultMaxClockSkew
+func WithBinanceClockSync(interval, maxSkew time.Duration) BinanceOption {
+	return func(b *Binance) {
+		b.clock.interval = interval
+		b.clock.maxSkew = maxSkew
+	}
+}
+
+// WithBinanceHTTPClient sets the HTTP client of the REST requests, e.g. with a custom transport or TLS config
+func WithBinanceHTTPClient(client *http.Client) BinanceOption {
+	return func(b *Binance) {
+		b.httpClient = client
+	}
+}
+
+// WithBinanceDialer sets the dialer of the websocket subscriptions, e.g. with a proxy, TLS config or
+// handshake timeout. Default: the proxy of the environment (HTTPS_PROXY) and a 45s handshake timeout
+func WithBinanceDialer(dialer *websocket.Dialer) BinanceOption {
+	return func(b *Binance) {
+		b.dialer = dialer
+	}
+}
+
+// WithBinanceProxy routes the REST requests and the websocket subscriptions through the proxy, applied on top
+// of the HTTP client and dialer options
+func WithBinanceProxy(proxy *url.URL) BinanceOption {
+	return func(b *Binance) {
+		b.proxy = proxy
+	}
+}
+
+// WithBinanceDebug logs the REST requests (e.g. the order parameters) and the raw responses of the exchange at debug
+// level, to diagnose unexpected orders. The API key and the signatures are redacted. The log level must be
+// log.DebugLevel, see ninjabot.WithLogLevel
+func WithBinanceDebug() BinanceOption {
+	return func(b *Binance) {
+		b.debug = true
+	}
+}
+
+// WithBinanceQuantityPrecision overrides the decimal places of the pair quantities reported by the exchange, e.g.
+// to avoid dust. The orders and AssetsInfo use the given precision, and the step size is raised to it when finer
+func WithBinanceQuantityPrecision(pair string, decimals int) BinanceOption {
+	return func(b *Binance) {
+		b.precision.setQuantity(pair, decimals)
+	}
+}
+
+// WithBinancePricePrecision overrides the decimal places of the pair prices reported by the exchange. The orders and
+// AssetsInfo use the given precision, and the tick size is raised to it when finer
+func WithBinancePricePrecision(pair string, decimals int) BinanceOption {
+	return func(b *Binance) {
+		b.precision.setPrice(pair, decimals)
+	}
+}
+
+// WithBinanceKeepalive sets the interval between the pings of the kline websocket, the connection is closed and
+// reconnected when a pong is not received until the next ping, and the read timeout that reconnects the
+// websocket when no message is received, e.g. a connection that died silently. The ping interval applies to
+// the websockets of this exchange instance only. A zero read timeout disables it.
+// Default: DefaultWebsocketPingInterval, without read timeout
+func WithBinanceKeepalive(pingInterval, readTimeout time.Duration) BinanceOption {
+	return func(b *Binance) {
+		b.pingInterval = pingInterval
+		b.readTimeout = readTimeout
+	}
+}
+
+// WithExchangeInfoRefresh reloads the exchange info of the pairs (precision, quantity, price and notional
+// limits) at the given interval, so long-running bots pick up new listings and changed filters. The changes are
+// logged. Default: loaded only at startup
+func WithExchangeInfoRefresh(interval time.Duration) BinanceOption {
+	return func(b *Binance) {
+		b.infoRefresh = interval
+	}
+}
+
 // NewBinance create a new Binance exchange instance
 func NewBinance(ctx context.Context, options ...BinanceOption) (*Binance, error) {
 	binance.WebsocketKeepalive = true
-	exchange := &Binance{ctx: ctx}
+	exchange := &Binance{ctx: ctx, marginTypes: make(map[string]MarginType), clock: newClockSync(),
+		dialer: binanceDialer(), streamURL: binanceStreamURL}
 	for _, option := range options {
 		option(exchange)
 	}
 
+	if binance.UseTestnet {
+		exchange.streamURL = binanceTestnetStreamURL
+	}
+
+	if exchange.pingInterval <= 0 {
+		exchange.pingInterval = DefaultWebsocketPingInterval
+	}
+
 	exchange.client = binance.NewClient(exchange.APIKey, exchange.APISecret)
+	if exchange.httpClient != nil {
+		exchange.client.HTTPClient = exchange.httpClient
+	}
+	if exchange.proxy != nil {
+		exchange.client.HTTPClient = proxyClient(exchange.client.HTTPClient, exchange.proxy)
+		exchange.dialer = proxyDialer(exchange.dialer, exchange.proxy)
+	}
+	if exchange.debug {
+		exchange.client.HTTPClient = debugClient(exchange.client.HTTPClient)
+	}
+
 	err := exchange.client.NewPingService().Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("binance ping fail: %w", err)
 	}
 
-	results, err := exchange.client.NewExchangeInfoService().Do(ctx)
+	exchange.clock.serverTime = func(ctx context.Context) (int64, error) {
+		return exchange.client.NewServerTimeService().Do(ctx)
+	}
+	exchange.clock.setOffset = func(offset time.Duration) {
+		atomic.StoreInt64(&exchange.client.TimeOffset, offset.Milliseconds())
+	}
+	err = exchange.clock.start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("binance clock sync fail: %w", err)
+	}
+
+	exchange.assetsInfo, err = exchange.loadAssetsInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if exchange.infoRefresh > 0 {
+		go exchange.refreshAssetsInfo(ctx)
+	}
+
+	log.Info("[SETUP] Using Binance exchange")
+
+	return exchange, nil
+}
+
+// loadAssetsInfo loads the precision and the limits of the pairs from the exchange info
+func (b *Binance) loadAssetsInfo(ctx context.Context) (map[string]model.AssetInfo, error) {
+	results, err := b.client.NewExchangeInfoService().Do(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize with orders precision and assets limits
-	exchange.assetsInfo = make(map[string]model.AssetInfo)
+	assetsInfo := make(map[string]model.AssetInfo)
 	for _, info := range results.Symbols {
 		tradeLimits := model.AssetInfo{
 			BaseAsset:          info.BaseAsset,
@@ -102,14 +326,77 @@ func NewBinance(ctx context.Context, options ...BinanceOption) (*Binance, error)
 					tradeLimits.MaxPrice, _ = strconv.ParseFloat(filter["maxPrice"].(string), 64)
 					tradeLimits.TickSize, _ = strconv.ParseFloat(filter["tickSize"].(string), 64)
 				}
+
+				if typ == string(binance.SymbolFilterTypeMinNotional) || typ == string(binance.SymbolFilterTypeNotional) {
+					if value, ok := filter["minNotional"].(string); ok {
+						tradeLimits.MinNotional, _ = strconv.ParseFloat(value, 64)
+					}
+				}
 			}
 		}
-		exchange.assetsInfo[info.Symbol] = tradeLimits
+		assetsInfo[info.Symbol] = b.precision.apply(info.Symbol, tradeLimits)
 	}
 
-	log.Info("[SETUP] Using Binance exchange")
+	return assetsInfo, nil
+}
 
-	return exchange, nil
+// refreshAssetsInfo reloads the exchange info at the refresh interval, see WithExchangeInfoRefresh
+func (b *Binance) refreshAssetsInfo(ctx context.Context) {
+	ticker := time.NewTicker(b.infoRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			assetsInfo, err := b.loadAssetsInfo(ctx)
+			if err != nil {
+				log.Warnf("[EXCHANGE INFO] refresh fail: %v", err)
+				continue
+			}
+
+			b.assetsMtx.Lock()
+			changes := assetsInfoChanges(b.assetsInfo, assetsInfo)
+			b.assetsInfo = assetsInfo
+			b.assetsMtx.Unlock()
+
+			for _, change := range changes {
+				log.Infof("[EXCHANGE INFO] %s", change)
+			}
+		}
+	}
+}
+
+// assetsInfoChanges describes the pairs listed, delisted and with changed filters between two exchange infos
+func assetsInfoChanges(previous, current map[string]model.AssetInfo) []string {
+	changes := make([]string, 0)
+	for pair, info := range current {
+		old, ok := previous[pair]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s listed", pair))
+		case old != info:
+			changes = append(changes, fmt.Sprintf("%s filters changed: %+v -> %+v", pair, old, info))
+		}
+	}
+
+	for pair := range previous {
+		if _, ok := current[pair]; !ok {
+			changes = append(changes, fmt.Sprintf("%s delisted", pair))
+		}
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+// assetInfo returns the exchange info of the pair
+func (b *Binance) assetInfo(pair string) (model.AssetInfo, bool) {
+	b.assetsMtx.RLock()
+	defer b.assetsMtx.RUnlock()
+	info, ok := b.assetsInfo[pair]
+	return info, ok
 }
 
 func (b *Binance) LastQuote(ctx context.Context, pair string) (float64, error) {
@@ -120,12 +407,73 @@ func (b *Binance) LastQuote(ctx context.Context, pair string) (float64, error) {
 	return candles[0].Close, nil
 }
 
+// LastPrice returns the last traded price of the pair from the ticker price endpoint
+func (b *Binance) LastPrice(pair string) (float64, error) {
+	prices, err := b.client.NewListPricesService().Symbol(pair).Do(b.ctx)
+	if err != nil {
+		return 0, binanceError(err)
+	}
+
+	for _, price := range prices {
+		if price.Symbol == pair {
+			return strconv.ParseFloat(price.Price, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+}
+
+// Depth returns the order book of the pair with up to limit levels on each side, e.g. 5, 10, 20, 50 or 100
+func (b *Binance) Depth(pair string, limit int) (model.Depth, error) {
+	depth, err := b.client.NewDepthService().Symbol(pair).Limit(limit).Do(b.ctx)
+	if err != nil {
+		return model.Depth{}, binanceError(err)
+	}
+	return newDepth(pair, time.Now(), depth.Bids, depth.Asks)
+}
+
+// newDepth converts the price levels of a Binance order book
+func newDepth(pair string, t time.Time, bids, asks []common.PriceLevel) (model.Depth, error) {
+	depth := model.Depth{Pair: pair, Time: t}
+	for _, side := range []struct {
+		levels []common.PriceLevel
+		result *[]model.PriceLevel
+	}{{bids, &depth.Bids}, {asks, &depth.Asks}} {
+		for _, level := range side.levels {
+			price, quantity, err := level.Parse()
+			if err != nil {
+				return model.Depth{}, err
+			}
+			*side.result = append(*side.result, model.PriceLevel{Price: price, Quantity: quantity})
+		}
+	}
+	return depth, nil
+}
+
+// Ping checks the connection with the exchange server
+func (b *Binance) Ping(ctx context.Context) error {
+	return b.client.NewPingService().Do(ctx)
+}
+
+// signedOptions returns the request options of signed requests
+func (b *Binance) signedOptions() []binance.RequestOption {
+	if b.recvWindow <= 0 {
+		return nil
+	}
+	return []binance.RequestOption{binance.WithRecvWindow(b.recvWindow.Milliseconds())}
+}
+
+func (b *Binance) Timeframes() []string {
+	return BinanceTimeframes
+}
+
 func (b *Binance) AssetsInfo(pair string) model.AssetInfo {
-	return b.assetsInfo[pair]
+	info, _ := b.assetInfo(pair)
+	return info
 }
 
 func (b *Binance) validate(pair string, quantity float64) error {
-	info, ok := b.assetsInfo[pair]
+	info, ok := b.assetInfo(pair)
 	if !ok {
 		return ErrInvalidAsset
 	}
@@ -151,6 +499,8 @@ func (b *Binance) CreateOrderOCO(side model.SideType, pair string,
 	}
 
 	ocoOrder, err := b.client.NewCreateOCOService().
+		LimitClientOrderID(NewClientOrderID()).
+		StopClientOrderID(NewClientOrderID()).
 		Side(binance.SideType(side)).
 		Quantity(b.formatQuantity(pair, quantity)).
 		Price(b.formatPrice(pair, price)).
@@ -158,9 +508,9 @@ func (b *Binance) CreateOrderOCO(side model.SideType, pair string,
 		StopLimitPrice(b.formatPrice(pair, stopLimit)).
 		StopLimitTimeInForce(binance.TimeInForceTypeGTC).
 		Symbol(pair).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return nil, err
+		return nil, binanceError(err)
 	}
 
 	orders := make([]model.Order, 0, len(ocoOrder.Orders))
@@ -190,6 +540,86 @@ func (b *Binance) CreateOrderOCO(side model.SideType, pair string,
 	return orders, nil
 }
 
+// CreateOrderOTOCO creates a limit entry order with an OCO bracket of take profit (limit maker) and stop loss
+// (stop loss limit), placed by Binance when the entry is filled. The brackets are returned in the pending new status
+func (b *Binance) CreateOrderOTOCO(side model.SideType, pair string, quantity, entry, takeProfit, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	bracketSide := model.SideTypeSell
+	if side == model.SideTypeSell {
+		bracketSide = model.SideTypeBuy
+	}
+
+	// the take profit is the upper leg of long positions and the lower leg of short positions
+	profitLeg, stopLeg := "pendingAbove", "pendingBelow"
+	if side == model.SideTypeSell {
+		profitLeg, stopLeg = stopLeg, profitLeg
+	}
+
+	params := url.Values{}
+	params.Set("symbol", pair)
+	params.Set("workingType", string(binance.OrderTypeLimit))
+	params.Set("workingSide", string(side))
+	params.Set("workingPrice", b.formatPrice(pair, entry))
+	params.Set("workingQuantity", b.formatQuantity(pair, quantity))
+	params.Set("workingTimeInForce", string(binance.TimeInForceTypeGTC))
+	params.Set("workingClientOrderId", NewClientOrderID())
+	params.Set("pendingSide", string(bracketSide))
+	params.Set("pendingQuantity", b.formatQuantity(pair, quantity))
+	params.Set(profitLeg+"Type", string(binance.OrderTypeLimitMaker))
+	params.Set(profitLeg+"Price", b.formatPrice(pair, takeProfit))
+	params.Set(stopLeg+"Type", string(binance.OrderTypeStopLossLimit))
+	params.Set(stopLeg+"StopPrice", b.formatPrice(pair, stop))
+	params.Set(stopLeg+"Price", b.formatPrice(pair, stopLimit))
+	params.Set(stopLeg+"TimeInForce", string(binance.TimeInForceTypeGTC))
+	params.Set("pendingAboveClientOrderId", NewClientOrderID())
+	params.Set("pendingBelowClientOrderId", NewClientOrderID())
+	if b.recvWindow > 0 {
+		params.Set("recvWindow", strconv.FormatInt(b.recvWindow.Milliseconds(), 10))
+	}
+
+	response := new(binance.CreateOCOResponse)
+	if err := b.signedPost("otoco", "/api/v3/orderList/otoco", params, response); err != nil {
+		return nil, binanceError(err)
+	}
+
+	orders := make([]model.Order, 0, len(response.OrderReports))
+	for _, report := range response.OrderReports {
+		price, _ := strconv.ParseFloat(report.Price, 64)
+		quantity, _ := strconv.ParseFloat(report.OrigQuantity, 64)
+		order := model.Order{
+			ExchangeID: report.OrderID,
+			CreatedAt:  time.Unix(0, response.TransactionTime*int64(time.Millisecond)),
+			UpdatedAt:  time.Unix(0, response.TransactionTime*int64(time.Millisecond)),
+			Pair:       pair,
+			Side:       model.SideType(report.Side),
+			Type:       model.OrderType(report.Type),
+			Status:     model.OrderStatusType(report.Status),
+			Price:      price,
+			Quantity:   quantity,
+		}
+
+		// the brackets are the OCO group, the entry is the working order
+		if order.Side == bracketSide {
+			groupID := report.OrderListID
+			order.GroupID = &groupID
+		}
+
+		if order.Type == model.OrderTypeStopLossLimit {
+			order.Stop = &stop
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
 func (b *Binance) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
 	err := b.validate(pair, quantity)
 	if err != nil {
@@ -197,14 +627,15 @@ func (b *Binance) CreateOrderStop(pair string, quantity float64, limit float64)
 	}
 
 	order, err := b.client.NewCreateOrderService().Symbol(pair).
+		NewClientOrderID(NewClientOrderID()).
 		Type(binance.OrderTypeStopLoss).
 		TimeInForce(binance.TimeInForceTypeGTC).
 		Side(binance.SideTypeSell).
 		Quantity(b.formatQuantity(pair, quantity)).
 		Price(b.formatPrice(pair, limit)).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	price, _ := strconv.ParseFloat(order.Price, 64)
@@ -224,15 +655,22 @@ func (b *Binance) CreateOrderStop(pair string, quantity float64, limit float64)
 }
 
 func (b *Binance) formatPrice(pair string, value float64) string {
-	if info, ok := b.assetsInfo[pair]; ok {
-		value = common.AmountToLotSize(info.TickSize, info.QuotePrecision, value)
+	if info, ok := b.assetInfo(pair); ok {
+		return formatDecimal(value, info.TickSize, info.QuotePrecision)
 	}
 	return strconv.FormatFloat(value, 'f', -1, 64)
 }
 
 func (b *Binance) formatQuantity(pair string, value float64) string {
-	if info, ok := b.assetsInfo[pair]; ok {
-		value = common.AmountToLotSize(info.StepSize, info.BaseAssetPrecision, value)
+	if info, ok := b.assetInfo(pair); ok {
+		return formatDecimal(value, info.StepSize, info.BaseAssetPrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (b *Binance) formatQuoteQuantity(pair string, value float64) string {
+	if info, ok := b.assetInfo(pair); ok {
+		return formatDecimal(value, 0, info.QuotePrecision)
 	}
 	return strconv.FormatFloat(value, 'f', -1, 64)
 }
@@ -240,21 +678,28 @@ func (b *Binance) formatQuantity(pair string, value float64) string {
 func (b *Binance) CreateOrderLimit(side model.SideType, pair string,
 	quantity float64, limit float64) (model.Order, error) {
 
+	return b.CreateOrderLimitTIF(side, pair, quantity, limit, model.TimeInForceGTC)
+}
+
+func (b *Binance) CreateOrderLimitTIF(side model.SideType, pair string,
+	quantity float64, limit float64, timeInForce model.TimeInForce) (model.Order, error) {
+
 	err := b.validate(pair, quantity)
 	if err != nil {
 		return model.Order{}, err
 	}
 
 	order, err := b.client.NewCreateOrderService().
+		NewClientOrderID(NewClientOrderID()).
 		Symbol(pair).
 		Type(binance.OrderTypeLimit).
-		TimeInForce(binance.TimeInForceTypeGTC).
+		TimeInForce(binance.TimeInForceType(timeInForce)).
 		Side(binance.SideType(side)).
 		Quantity(b.formatQuantity(pair, quantity)).
 		Price(b.formatPrice(pair, limit)).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	price, err := strconv.ParseFloat(order.Price, 64)
@@ -267,6 +712,17 @@ func (b *Binance) CreateOrderLimit(side model.SideType, pair string,
 		return model.Order{}, err
 	}
 
+	// IOC and FOK orders are resolved immediately, partial fills are expired with the remaining
+	// quantity canceled, so we keep only the executed quantity and the average price
+	status := model.OrderStatusType(order.Status)
+	executed, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if timeInForce != model.TimeInForceGTC && executed > 0 {
+		cost, _ := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
+		status = model.OrderStatusTypeFilled
+		price = cost / executed
+		quantity = executed
+	}
+
 	return model.Order{
 		ExchangeID: order.OrderID,
 		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
@@ -274,9 +730,10 @@ func (b *Binance) CreateOrderLimit(side model.SideType, pair string,
 		Pair:       pair,
 		Side:       model.SideType(order.Side),
 		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
+		Status:     status,
 		Price:      price,
 		Quantity:   quantity,
+		Fee:        b.fillsFee(pair, order.Fills),
 	}, nil
 }
 
@@ -287,14 +744,15 @@ func (b *Binance) CreateOrderMarket(side model.SideType, pair string, quantity f
 	}
 
 	order, err := b.client.NewCreateOrderService().
+		NewClientOrderID(NewClientOrderID()).
 		Symbol(pair).
 		Type(binance.OrderTypeMarket).
 		Side(binance.SideType(side)).
 		Quantity(b.formatQuantity(pair, quantity)).
 		NewOrderRespType(binance.NewOrderRespTypeFULL).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	cost, err := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
@@ -317,24 +775,35 @@ func (b *Binance) CreateOrderMarket(side model.SideType, pair string, quantity f
 		Status:     model.OrderStatusType(order.Status),
 		Price:      cost / quantity,
 		Quantity:   quantity,
+		Fee:        b.fillsFee(order.Symbol, order.Fills),
 	}, nil
 }
 
-func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quantity float64) (model.Order, error) {
-	err := b.validate(pair, quantity)
-	if err != nil {
-		return model.Order{}, err
+// CreateOrderMarketQuote creates a market order using the amount in quote asset (quoteOrderQty),
+// eg: buy 100 USDT of BTC in BTCUSDT pair
+func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	if _, ok := b.assetInfo(pair); !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	if quote <= 0 {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidQuantity,
+			Pair:     pair,
+			Quantity: quote,
+		}
 	}
 
 	order, err := b.client.NewCreateOrderService().
+		NewClientOrderID(NewClientOrderID()).
 		Symbol(pair).
 		Type(binance.OrderTypeMarket).
 		Side(binance.SideType(side)).
-		QuoteOrderQty(b.formatQuantity(pair, quantity)).
+		QuoteOrderQty(b.formatQuoteQuantity(pair, quote)).
 		NewOrderRespType(binance.NewOrderRespTypeFULL).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	cost, err := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
@@ -342,7 +811,7 @@ func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quant
 		return model.Order{}, err
 	}
 
-	quantity, err = strconv.ParseFloat(order.ExecutedQuantity, 64)
+	quantity, err := strconv.ParseFloat(order.ExecutedQuantity, 64)
 	if err != nil {
 		return model.Order{}, err
 	}
@@ -357,25 +826,194 @@ func (b *Binance) CreateOrderMarketQuote(side model.SideType, pair string, quant
 		Status:     model.OrderStatusType(order.Status),
 		Price:      cost / quantity,
 		Quantity:   quantity,
+		Fee:        b.fillsFee(order.Symbol, order.Fills),
 	}, nil
 }
 
 func (b *Binance) Cancel(order model.Order) error {
+	if b.isMarginOrder(order.ExchangeID) {
+		return b.CancelMargin(order)
+	}
+
 	_, err := b.client.NewCancelOrderService().
 		Symbol(order.Pair).
 		OrderID(order.ExchangeID).
-		Do(b.ctx)
-	return err
+		Do(b.ctx, b.signedOptions()...)
+	return binanceError(err)
+}
+
+// cancelReplaceResponse is the response of the cancel-replace endpoint, also sent in the data of its errors
+type cancelReplaceResponse struct {
+	CancelResult     string                       `json:"cancelResult"`
+	NewOrderResult   string                       `json:"newOrderResult"`
+	NewOrderResponse *binance.CreateOrderResponse `json:"newOrderResponse"`
+}
+
+// OrderReplace cancels a resting limit order and creates a new one with the given price and quantity in a single
+// request, with the cancel-replace endpoint of Binance. The new order is not created if the cancel fails, e.g.
+// when the order was already filled. If the new order is rejected after the cancel, the error has the code
+// ErrCancelReplacePartial and the original order is canceled
+func (b *Binance) OrderReplace(order model.Order, price, quantity float64) (model.Order, error) {
+	if order.Type != model.OrderTypeLimit && order.Type != model.OrderTypeLimitMaker {
+		return model.Order{}, fmt.Errorf("replace order: unsupported order type %s", order.Type)
+	}
+
+	err := b.validate(order.Pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	params := url.Values{}
+	params.Set("symbol", order.Pair)
+	params.Set("side", string(order.Side))
+	params.Set("type", string(order.Type))
+	params.Set("cancelReplaceMode", "STOP_ON_FAILURE")
+	params.Set("cancelOrderId", strconv.FormatInt(order.ExchangeID, 10))
+	params.Set("quantity", b.formatQuantity(order.Pair, quantity))
+	params.Set("price", b.formatPrice(order.Pair, price))
+	params.Set("newOrderRespType", string(binance.NewOrderRespTypeRESULT))
+	params.Set("newClientOrderId", NewClientOrderID())
+	if order.Type == model.OrderTypeLimit {
+		params.Set("timeInForce", string(binance.TimeInForceTypeGTC))
+	}
+	if b.recvWindow > 0 {
+		params.Set("recvWindow", strconv.FormatInt(b.recvWindow.Milliseconds(), 10))
+	}
+
+	response, err := b.cancelReplace(params)
+	if err != nil {
+		return model.Order{}, binanceError(err)
+	}
+
+	return newReplacedOrder(response.NewOrderResponse)
+}
+
+// cancelReplace sends a signed request to the cancel-replace endpoint, which is not supported by the client
+func (b *Binance) cancelReplace(params url.Values) (*cancelReplaceResponse, error) {
+	response := new(cancelReplaceResponse)
+	if err := b.signedPost("cancel-replace", "/api/v3/order/cancelReplace", params, response); err != nil {
+		return nil, err
+	}
+
+	if response.NewOrderResponse == nil {
+		return nil, fmt.Errorf("cancel-replace: new order %s", strings.ToLower(response.NewOrderResult))
+	}
+	return response, nil
+}
+
+// signedPost sends a signed POST request to an endpoint not supported by the client and decodes the response in
+// result. The API errors are returned as *common.APIError
+func (b *Binance) signedPost(name, path string, params url.Values, result interface{}) error {
+	params.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli()-atomic.LoadInt64(&b.client.TimeOffset), 10))
+	mac := hmac.New(sha256.New, []byte(b.client.SecretKey))
+	mac.Write([]byte(params.Encode()))
+	query := params.Encode() + "&signature=" + hex.EncodeToString(mac.Sum(nil))
+
+	request, err := http.NewRequestWithContext(b.ctx, http.MethodPost, b.client.BaseURL+path+"?"+query, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-MBX-APIKEY", b.client.APIKey)
+
+	client := b.client.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiError := new(common.APIError)
+		if err := json.Unmarshal(body, apiError); err != nil || apiError.Code == 0 {
+			return fmt.Errorf("%s: status %d: %s", name, resp.StatusCode, body)
+		}
+		return apiError
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+func newReplacedOrder(order *binance.CreateOrderResponse) (model.Order, error) {
+	price, err := strconv.ParseFloat(order.Price, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	quantity, err := strconv.ParseFloat(order.OrigQuantity, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return model.Order{
+		ExchangeID: order.OrderID,
+		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:       order.Symbol,
+		Side:       model.SideType(order.Side),
+		Type:       model.OrderType(order.Type),
+		Status:     model.OrderStatusType(order.Status),
+		Price:      price,
+		Quantity:   quantity,
+	}, nil
+}
+
+// CancelAll cancels all open orders of the given pair, including OCO orders, and returns the canceled orders
+func (b *Binance) CancelAll(pair string) ([]model.Order, error) {
+	result, err := b.client.NewCancelOpenOrdersService().
+		Symbol(pair).
+		Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	orders := make([]model.Order, 0, len(result.Orders))
+	for _, order := range result.Orders {
+		orders = append(orders, newCanceledOrder(order.Symbol, order.OrderID, order.TransactTime, order.Side,
+			order.Type, order.Price, order.OrigQuantity))
+	}
+
+	for _, oco := range result.OCOOrders {
+		for _, order := range oco.OrderReports {
+			orders = append(orders, newCanceledOrder(order.Symbol, order.OrderID, order.TransactionTime, order.Side,
+				order.Type, order.Price, order.OrigQuantity))
+		}
+	}
+
+	return orders, nil
+}
+
+func newCanceledOrder(pair string, id, transactTime int64, side binance.SideType, orderType binance.OrderType,
+	price, quantity string) model.Order {
+	order := model.Order{
+		ExchangeID: id,
+		Pair:       pair,
+		UpdatedAt:  time.Unix(0, transactTime*int64(time.Millisecond)),
+		Side:       model.SideType(side),
+		Type:       model.OrderType(orderType),
+		Status:     model.OrderStatusTypeCanceled,
+	}
+	order.Price, _ = strconv.ParseFloat(price, 64)
+	order.Quantity, _ = strconv.ParseFloat(quantity, 64)
+	return order
 }
 
 func (b *Binance) Orders(pair string, limit int) ([]model.Order, error) {
 	result, err := b.client.NewListOrdersService().
 		Symbol(pair).
 		Limit(limit).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 
 	if err != nil {
-		return nil, err
+		return nil, binanceError(err)
 	}
 
 	orders := make([]model.Order, 0)
@@ -385,23 +1023,154 @@ func (b *Binance) Orders(pair string, limit int) ([]model.Order, error) {
 	return orders, nil
 }
 
+// OpenOrders returns the orders of the given pair that are still open in the exchange
+func (b *Binance) OpenOrders(pair string) ([]model.Order, error) {
+	result, err := b.client.NewListOpenOrdersService().
+		Symbol(pair).
+		Do(b.ctx, b.signedOptions()...)
+
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	orders := make([]model.Order, 0, len(result))
+	for _, order := range result {
+		orders = append(orders, newOrder(order))
+	}
+	return orders, nil
+}
+
 func (b *Binance) Order(pair string, id int64) (model.Order, error) {
+	if b.isMarginOrder(id) {
+		return b.OrderMargin(pair, id)
+	}
+
 	order, err := b.client.NewGetOrderService().
 		Symbol(pair).
 		OrderID(id).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
+	}
+
+	result := newOrder(order)
+	if result.Status == model.OrderStatusTypeFilled || result.Status == model.OrderStatusTypePartiallyFilled {
+		// the order query has no commission, it is paid in the trades of the order
+		result.Fee, err = b.orderFee(pair, id)
+		if err != nil {
+			log.Warnf("binance: fee of order %d: %v", id, err)
+		}
+	}
+	return result, nil
+}
+
+// commission returns the commission in the quote asset of the pair. Commissions paid in other assets
+// (e.g. BNB) are not converted and return false, the fee of the order is then estimated by the controller
+func (b *Binance) commission(pair string, amount float64, asset string, price float64) (float64, bool) {
+	base, quote := SplitAssetQuote(pair)
+	if info, ok := b.assetInfo(pair); ok {
+		base, quote = info.BaseAsset, info.QuoteAsset
+	}
+
+	switch asset {
+	case quote:
+		return amount, true
+	case base:
+		return amount * price, true
+	}
+	return 0, false
+}
+
+// fillsFee returns the commission of the fills of a new order in the quote asset, zero when a commission is
+// paid in another asset
+func (b *Binance) fillsFee(pair string, fills []*binance.Fill) float64 {
+	var fee float64
+	for _, fill := range fills {
+		amount, _ := strconv.ParseFloat(fill.Commission, 64)
+		price, _ := strconv.ParseFloat(fill.Price, 64)
+		value, ok := b.commission(pair, amount, fill.CommissionAsset, price)
+		if !ok {
+			return 0
+		}
+		fee += value
+	}
+	return fee
+}
+
+// orderFee returns the commission of the trades of an order in the quote asset, see fillsFee
+func (b *Binance) orderFee(pair string, id int64) (float64, error) {
+	trades, err := b.client.NewListTradesService().
+		Symbol(pair).
+		OrderId(id).
+		Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return 0, binanceError(err)
+	}
+
+	var fee float64
+	for _, trade := range trades {
+		amount, _ := strconv.ParseFloat(trade.Commission, 64)
+		price, _ := strconv.ParseFloat(trade.Price, 64)
+		value, ok := b.commission(pair, amount, trade.CommissionAsset, price)
+		if !ok {
+			return 0, nil
+		}
+		fee += value
+	}
+	return fee, nil
+}
+
+// Trades returns the last trades of the account in the pair, up to the limit, with the commission paid in each
+// fill. It is the authoritative source of the fees, since they may be paid in other assets (e.g. BNB)
+func (b *Binance) Trades(pair string, limit int) ([]model.Trade, error) {
+	service := b.client.NewListTradesService().Symbol(pair)
+	if limit > 0 {
+		service = service.Limit(limit)
+	}
+
+	trades, err := service.Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	result := make([]model.Trade, 0, len(trades))
+	for _, trade := range trades {
+		result = append(result, newAccountTrade(trade))
+	}
+	return result, nil
+}
+
+func newAccountTrade(trade *binance.TradeV3) model.Trade {
+	price, _ := strconv.ParseFloat(trade.Price, 64)
+	quantity, _ := strconv.ParseFloat(trade.Quantity, 64)
+	commission, _ := strconv.ParseFloat(trade.Commission, 64)
+
+	side := model.SideTypeSell
+	if trade.IsBuyer {
+		side = model.SideTypeBuy
 	}
 
-	return newOrder(order), nil
+	return model.Trade{
+		Pair:            trade.Symbol,
+		ID:              trade.ID,
+		Price:           price,
+		Quantity:        quantity,
+		Time:            time.Unix(0, trade.Time*int64(time.Millisecond)),
+		IsBuyerMaker:    trade.IsBuyer == trade.IsMaker,
+		OrderID:         trade.OrderID,
+		Side:            side,
+		IsMaker:         trade.IsMaker,
+		Commission:      commission,
+		CommissionAsset: trade.CommissionAsset,
+	}
 }
 
 func newOrder(order *binance.Order) model.Order {
 	var price float64
 	cost, _ := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
 	quantity, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	executed := quantity
 	if cost > 0 && quantity > 0 {
 		price = cost / quantity
 	} else {
@@ -419,11 +1188,14 @@ func newOrder(order *binance.Order) model.Order {
 		Status:     model.OrderStatusType(order.Status),
 		Price:      price,
 		Quantity:   quantity,
+
+		ExecutedQuantity: executed,
+		ClientOrderID:    order.ClientOrderID,
 	}
 }
 
 func (b *Binance) Account() (model.Account, error) {
-	acc, err := b.client.NewGetAccountService().Do(b.ctx)
+	acc, err := b.client.NewGetAccountService().Do(b.ctx, b.signedOptions()...)
 	if err != nil {
 		return model.Account{}, err
 	}
@@ -474,8 +1246,17 @@ func (b *Binance) CandlesSubscription(ctx context.Context, pair, period string)
 		}
 
 		for {
-			done, _, err := binance.WsKlineServe(pair, period, func(event *binance.WsKlineEvent) {
+			alive := make(chan struct{}, 1)
+			endpoint := fmt.Sprintf("%s/%s@kline_%s", b.streamURL, strings.ToLower(pair), period)
+			done, stop, err := serveStream(b.dialer, endpoint, b.pingInterval, func(message []byte) {
+				event := new(binance.WsKlineEvent)
+				if err := json.Unmarshal(message, event); err != nil {
+					cerr <- err
+					return
+				}
+
 				ba.Reset()
+				signalAlive(alive)
 				candle := CandleFromWsKline(pair, event.Kline)
 
 				if candle.Complete && b.HeikinAshi {
@@ -490,7 +1271,7 @@ func (b *Binance) CandlesSubscription(ctx context.Context, pair, period string)
 					}
 				}
 
-				ccandle <- candle
+				ccandle <- candleTimestamp(b.timeMode, period, candle)
 
 			}, func(err error) {
 				cerr <- err
@@ -502,10 +1283,67 @@ func (b *Binance) CandlesSubscription(ctx context.Context, pair, period string)
 				return
 			}
 
+			canceled, err := watchStream(ctx, done, stop, alive, b.readTimeout)
+			if canceled {
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			if err != nil {
+				cerr <- fmt.Errorf("%s %s: %w", pair, period, err)
+			}
+			time.Sleep(ba.Duration())
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// TradesSubscription streams the aggregated trades of the given pair
+func (b *Binance) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ctrade := make(chan model.Trade)
+	cerr := make(chan error)
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		for {
+			endpoint := fmt.Sprintf("%s/%s@aggTrade", b.streamURL, strings.ToLower(pair))
+			done, _, err := serveStream(b.dialer, endpoint, b.pingInterval, func(message []byte) {
+				event := new(binance.WsAggTradeEvent)
+				if err := json.Unmarshal(message, event); err != nil {
+					cerr <- err
+					return
+				}
+
+				ba.Reset()
+				trade := model.Trade{
+					Pair:         pair,
+					ID:           event.AggTradeID,
+					Time:         time.Unix(0, event.TradeTime*int64(time.Millisecond)),
+					IsBuyerMaker: event.IsBuyerMaker,
+				}
+				trade.Price, _ = strconv.ParseFloat(event.Price, 64)
+				trade.Quantity, _ = strconv.ParseFloat(event.Quantity, 64)
+				ctrade <- trade
+			}, func(err error) {
+				cerr <- err
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ctrade)
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				close(cerr)
-				close(ccandle)
+				close(ctrade)
 				return
 			case <-done:
 				time.Sleep(ba.Duration())
@@ -513,7 +1351,7 @@ func (b *Binance) CandlesSubscription(ctx context.Context, pair, period string)
 		}
 	}()
 
-	return ccandle, cerr
+	return ctrade, cerr
 }
 
 func (b *Binance) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
@@ -541,7 +1379,7 @@ func (b *Binance) CandlesByLimit(ctx context.Context, pair, period string, limit
 	}
 
 	// discard last candle, because it is incomplete
-	return candles[:len(candles)-1], nil
+	return candleTimestamps(b.timeMode, period, candles[:len(candles)-1]), nil
 }
 
 func (b *Binance) CandlesByPeriod(ctx context.Context, pair, period string,
@@ -553,8 +1391,8 @@ func (b *Binance) CandlesByPeriod(ctx context.Context, pair, period string,
 
 	data, err := klineService.Symbol(pair).
 		Interval(period).
-		StartTime(start.UnixNano() / int64(time.Millisecond)).
-		EndTime(end.UnixNano() / int64(time.Millisecond)).
+		StartTime(candleOpenTime(b.timeMode, period, start).UnixNano() / int64(time.Millisecond)).
+		EndTime(candleOpenTime(b.timeMode, period, end).UnixNano() / int64(time.Millisecond)).
 		Do(ctx)
 
 	if err != nil {
@@ -571,9 +1409,17 @@ func (b *Binance) CandlesByPeriod(ctx context.Context, pair, period string,
 		candles = append(candles, candle)
 	}
 
-	return candles, nil
+	return candleTimestamps(b.timeMode, period, candles), nil
+}
+
+// SetCandleTimeMode sets the timestamp convention of the candles, the open time of the kline by default.
+// The requested periods are in the same convention
+func (b *Binance) SetCandleTimeMode(mode model.CandleTimeMode) error {
+	b.timeMode = mode
+	return nil
 }
 
+// CandleFromKline converts a kline of the REST API, the candle time is the open time of the kline
 func CandleFromKline(pair string, k binance.Kline) model.Candle {
 	t := time.Unix(0, k.OpenTime*int64(time.Millisecond))
 	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t}
@@ -587,6 +1433,8 @@ func CandleFromKline(pair string, k binance.Kline) model.Candle {
 	return candle
 }
 
+// CandleFromWsKline converts a kline of the websocket stream, the candle time is the start (open) time of
+// the kline, the same convention of CandleFromKline
 func CandleFromWsKline(pair string, k binance.WsKline) model.Candle {
 	t := time.Unix(0, k.StartTime*int64(time.Millisecond))
 	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t}
@@ -2,15 +2,23 @@ package exchange
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/common"
 	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
 	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/tools/log"
@@ -18,6 +26,11 @@ import (
 
 type MarginType = futures.MarginType
 
+const (
+	binanceFutureStreamURL        = "wss://fstream.binance.com/ws"
+	binanceFutureTestnetStreamURL = "wss://stream.binancefuture.com/ws"
+)
+
 var (
 	MarginTypeIsolated MarginType = "ISOLATED"
 	MarginTypeCrossed  MarginType = "CROSSED"
@@ -43,6 +56,24 @@ type BinanceFuture struct {
 
 	MetadataFetchers []MetadataFetchers
 	PairOptions      []PairOption
+	derivatives      bool
+
+	clock      *clockSync
+	recvWindow time.Duration
+	httpClient *http.Client
+	proxy      *url.URL
+	debug      bool
+	precision  precisionOverrides
+
+	// timestamp convention of the candles, see SetCandleTimeMode
+	timeMode model.CandleTimeMode
+
+	// websocket streams, see WithBinanceFutureDialer
+	dialer    *websocket.Dialer
+	streamURL string
+
+	pingInterval time.Duration
+	readTimeout  time.Duration
 }
 
 type BinanceFutureOption func(*BinanceFuture)
@@ -73,20 +104,152 @@ func WithBinanceFutureLeverage(pair string, leverage int, marginType MarginType)
 	}
 }
 
+// WithBinanceFutureRecvWindow sets the receive window of signed requests, the maximum delay accepted by the
+// server between the request timestamp and its arrival. Default: 5 seconds
+func WithBinanceFutureRecvWindow(window time.Duration) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.recvWindow = window
+	}
+}
+
+// WithBinanceFutureClockSync sets the interval to synchronize the offset with the server time, applied to
+// signed requests, and the clock difference that logs a warning. A zero interval synchronizes only at startup.
+// Default: DefaultClockSyncInterval and DefaultMaxClockSkew
+func WithBinanceFutureClockSync(interval, maxSkew time.Duration) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.clock.interval = interval
+		b.clock.maxSkew = maxSkew
+	}
+}
+
+// WithBinanceFutureHTTPClient sets the HTTP client of the REST requests, e.g. with a custom transport or TLS config
+func WithBinanceFutureHTTPClient(client *http.Client) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.httpClient = client
+	}
+}
+
+// WithBinanceFutureDialer sets the dialer of the websocket subscriptions, e.g. with a proxy, TLS config or
+// handshake timeout. Default: the proxy of the environment (HTTPS_PROXY) and a 45s handshake timeout
+func WithBinanceFutureDialer(dialer *websocket.Dialer) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.dialer = dialer
+	}
+}
+
+// WithBinanceFutureProxy routes the REST requests and the websocket subscriptions through the proxy, applied on
+// top of the HTTP client and dialer options
+func WithBinanceFutureProxy(proxy *url.URL) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.proxy = proxy
+	}
+}
+
+// WithBinanceFutureDebug logs the REST requests (e.g. the order parameters) and the raw responses of the exchange
+// at debug level, to diagnose unexpected orders. The API key and the signatures are redacted. The log level must
+// be log.DebugLevel, see ninjabot.WithLogLevel
+func WithBinanceFutureDebug() BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.debug = true
+	}
+}
+
+// WithBinanceFutureMetadataFetcher executes a function after receiving a closed candle and includes the result in
+// the candle metadata
+func WithBinanceFutureMetadataFetcher(fetcher MetadataFetchers) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.MetadataFetchers = append(b.MetadataFetchers, fetcher)
+	}
+}
+
+// WithBinanceFutureDerivativesData includes the open interest (model.MetadataOpenInterest) and the last funding
+// rate (model.MetadataFundingRate) of the pair in the candle metadata, available to the strategies in the
+// dataframe metadata. The closed candles of the subscriptions have the current values, and the historical candles
+// (e.g. the warmup) the history of the exchange, which keeps the open interest of the last 30 days. The values
+// not available are NaN
+func WithBinanceFutureDerivativesData() BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.derivatives = true
+	}
+}
+
+// WithBinanceFutureQuantityPrecision overrides the decimal places of the pair quantities reported by the exchange, e.g.
+// to avoid dust. The orders and AssetsInfo use the given precision, and the step size is raised to it when finer
+func WithBinanceFutureQuantityPrecision(pair string, decimals int) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.precision.setQuantity(pair, decimals)
+	}
+}
+
+// WithBinanceFuturePricePrecision overrides the decimal places of the pair prices reported by the exchange. The
+// orders and AssetsInfo use the given precision, and the tick size is raised to it when finer
+func WithBinanceFuturePricePrecision(pair string, decimals int) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.precision.setPrice(pair, decimals)
+	}
+}
+
+// WithBinanceFutureKeepalive sets the interval between the pings of the kline websocket, the connection is
+// closed and reconnected when a pong is not received until the next ping, and the read timeout that reconnects
+// the websocket when no message is received, e.g. a connection that died silently. The ping interval applies to
+// the websockets of this exchange instance only. A zero read timeout disables it.
+// Default: DefaultWebsocketPingInterval, without read timeout
+func WithBinanceFutureKeepalive(pingInterval, readTimeout time.Duration) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.pingInterval = pingInterval
+		b.readTimeout = readTimeout
+	}
+}
+
 // NewBinanceFuture will create a new BinanceFuture instance
 func NewBinanceFuture(ctx context.Context, options ...BinanceFutureOption) (*BinanceFuture, error) {
-	binance.WebsocketKeepalive = true
-	exchange := &BinanceFuture{ctx: ctx}
+	futures.WebsocketKeepalive = true
+	exchange := &BinanceFuture{ctx: ctx, clock: newClockSync(), dialer: binanceDialer(),
+		streamURL: binanceFutureStreamURL}
 	for _, option := range options {
 		option(exchange)
 	}
 
+	if futures.UseTestnet {
+		exchange.streamURL = binanceFutureTestnetStreamURL
+	}
+
+	if exchange.pingInterval <= 0 {
+		exchange.pingInterval = DefaultWebsocketPingInterval
+	}
+
 	exchange.client = futures.NewClient(exchange.APIKey, exchange.APISecret)
+	if exchange.httpClient != nil {
+		exchange.client.HTTPClient = exchange.httpClient
+	}
+	if exchange.proxy != nil {
+		exchange.client.HTTPClient = proxyClient(exchange.client.HTTPClient, exchange.proxy)
+		exchange.dialer = proxyDialer(exchange.dialer, exchange.proxy)
+	}
+	if exchange.debug {
+		exchange.client.HTTPClient = debugClient(exchange.client.HTTPClient)
+	}
+
+	if exchange.derivatives {
+		exchange.MetadataFetchers = append(exchange.MetadataFetchers, exchange.openInterest, exchange.fundingRate)
+	}
+
 	err := exchange.client.NewPingService().Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("binance ping fail: %w", err)
 	}
 
+	exchange.clock.serverTime = func(ctx context.Context) (int64, error) {
+		return exchange.client.NewServerTimeService().Do(ctx)
+	}
+	exchange.clock.setOffset = func(offset time.Duration) {
+		atomic.StoreInt64(&exchange.client.TimeOffset, offset.Milliseconds())
+	}
+	err = exchange.clock.start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("binance clock sync fail: %w", err)
+	}
+
 	results, err := exchange.client.NewExchangeInfoService().Do(ctx)
 	if err != nil {
 		return nil, err
@@ -94,12 +257,14 @@ func NewBinanceFuture(ctx context.Context, options ...BinanceFutureOption) (*Bin
 
 	// Set leverage and margin type
 	for _, option := range exchange.PairOptions {
-		_, err = exchange.client.NewChangeLeverageService().Symbol(option.Pair).Leverage(option.Leverage).Do(ctx)
+		_, err = exchange.client.NewChangeLeverageService().Symbol(option.Pair).Leverage(option.Leverage).
+			Do(ctx, exchange.signedOptions()...)
 		if err != nil {
 			return nil, err
 		}
 
-		err = exchange.client.NewChangeMarginTypeService().Symbol(option.Pair).MarginType(option.MarginType).Do(ctx)
+		err = exchange.client.NewChangeMarginTypeService().Symbol(option.Pair).MarginType(option.MarginType).
+			Do(ctx, exchange.signedOptions()...)
 		if err != nil {
 			if apiError, ok := err.(*common.APIError); !ok || apiError.Code != ErrNoNeedChangeMarginType {
 				return nil, err
@@ -129,9 +294,15 @@ func NewBinanceFuture(ctx context.Context, options ...BinanceFutureOption) (*Bin
 					tradeLimits.MaxPrice, _ = strconv.ParseFloat(filter["maxPrice"].(string), 64)
 					tradeLimits.TickSize, _ = strconv.ParseFloat(filter["tickSize"].(string), 64)
 				}
+
+				if typ == string(futures.SymbolFilterTypeMinNotional) {
+					if value, ok := filter["notional"].(string); ok {
+						tradeLimits.MinNotional, _ = strconv.ParseFloat(value, 64)
+					}
+				}
 			}
 		}
-		exchange.assetsInfo[info.Symbol] = tradeLimits
+		exchange.assetsInfo[info.Symbol] = exchange.precision.apply(info.Symbol, tradeLimits)
 	}
 
 	log.Info("[SETUP] Using Binance Futures exchange")
@@ -147,6 +318,165 @@ func (b *BinanceFuture) LastQuote(ctx context.Context, pair string) (float64, er
 	return candles[0].Close, nil
 }
 
+// LastPrice returns the last traded price of the pair from the ticker price endpoint
+func (b *BinanceFuture) LastPrice(pair string) (float64, error) {
+	prices, err := b.client.NewListPricesService().Symbol(pair).Do(b.ctx)
+	if err != nil {
+		return 0, binanceError(err)
+	}
+
+	for _, price := range prices {
+		if price.Symbol == pair {
+			return strconv.ParseFloat(price.Price, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+}
+
+// Depth returns the order book of the pair with up to limit levels on each side, e.g. 5, 10, 20, 50 or 100
+func (b *BinanceFuture) Depth(pair string, limit int) (model.Depth, error) {
+	depth, err := b.client.NewDepthService().Symbol(pair).Limit(limit).Do(b.ctx)
+	if err != nil {
+		return model.Depth{}, binanceError(err)
+	}
+	return newDepth(pair, time.UnixMilli(depth.Time), depth.Bids, depth.Asks)
+}
+
+// Ping checks the connection with the exchange server
+func (b *BinanceFuture) Ping(ctx context.Context) error {
+	return b.client.NewPingService().Do(ctx)
+}
+
+// FundingRate returns the last funding rate of a perpetual contract and the time of the next funding, from
+// the premium index
+func (b *BinanceFuture) FundingRate(pair string) (float64, time.Time, error) {
+	indexes, err := b.client.NewPremiumIndexService().Symbol(pair).Do(b.ctx)
+	if err != nil {
+		return 0, time.Time{}, binanceError(err)
+	}
+
+	for _, index := range indexes {
+		if index.Symbol != pair {
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(index.LastFundingRate, 64)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return rate, time.Unix(0, index.NextFundingTime*int64(time.Millisecond)), nil
+	}
+
+	return 0, time.Time{}, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+}
+
+// openInterest is the metadata fetcher of the current open interest, see WithBinanceFutureDerivativesData
+func (b *BinanceFuture) openInterest(pair string, _ time.Time) (string, float64) {
+	result, err := b.client.NewGetOpenInterestService().Symbol(pair).Do(b.ctx)
+	if err != nil {
+		log.Warnf("[EXCHANGE] %s open interest: %v", pair, err)
+		return model.MetadataOpenInterest, math.NaN()
+	}
+
+	value, err := strconv.ParseFloat(result.OpenInterest, 64)
+	if err != nil {
+		log.Warnf("[EXCHANGE] %s open interest: %v", pair, err)
+		return model.MetadataOpenInterest, math.NaN()
+	}
+	return model.MetadataOpenInterest, value
+}
+
+// fundingRate is the metadata fetcher of the last funding rate, see WithBinanceFutureDerivativesData
+func (b *BinanceFuture) fundingRate(pair string, _ time.Time) (string, float64) {
+	rate, _, err := b.FundingRate(pair)
+	if err != nil {
+		log.Warnf("[EXCHANGE] %s funding rate: %v", pair, err)
+		return model.MetadataFundingRate, math.NaN()
+	}
+	return model.MetadataFundingRate, rate
+}
+
+// derivativesHistory includes the historical open interest and funding rates in the metadata of the candles, see
+// WithBinanceFutureDerivativesData. The open interest of a candle is the snapshot at its close, and the funding
+// rate the last one settled until its open
+func (b *BinanceFuture) derivativesHistory(ctx context.Context, pair, period string, candles []model.Candle) {
+	if !b.derivatives || len(candles) == 0 {
+		return
+	}
+
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		log.Warnf("[EXCHANGE] %s derivatives history: %v", pair, err)
+		return
+	}
+
+	start := candles[0].Time
+	end := candles[len(candles)-1].Time.Add(duration)
+
+	// the exchange returns up to 500 snapshots of open interest
+	interestStart := start.Add(duration)
+	if first := end.Add(-499 * duration); first.After(interestStart) {
+		interestStart = first
+	}
+
+	interest := make(map[int64]float64)
+	stats, err := b.client.NewOpenInterestStatisticsService().Symbol(pair).Period(period).
+		StartTime(interestStart.UnixMilli()).EndTime(end.UnixMilli()).Limit(500).Do(ctx)
+	if err != nil {
+		log.Warnf("[EXCHANGE] %s open interest history: %v", pair, err)
+	}
+	for _, stat := range stats {
+		if value, err := strconv.ParseFloat(stat.SumOpenInterest, 64); err == nil {
+			interest[stat.Timestamp] = value
+		}
+	}
+
+	// the funding is settled every 8 hours, the first candles use the previous settlement
+	rates, err := b.client.NewFundingRateService().Symbol(pair).StartTime(start.Add(-8 * time.Hour).UnixMilli()).
+		EndTime(end.UnixMilli()).Limit(1000).Do(ctx)
+	if err != nil {
+		log.Warnf("[EXCHANGE] %s funding rate history: %v", pair, err)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].FundingTime < rates[j].FundingTime
+	})
+
+	rate := math.NaN()
+	next := 0
+	for i := range candles {
+		open := candles[i].Time.UnixMilli()
+		for ; next < len(rates) && rates[next].FundingTime <= open; next++ {
+			if value, err := strconv.ParseFloat(rates[next].FundingRate, 64); err == nil {
+				rate = value
+			}
+		}
+
+		if candles[i].Metadata == nil {
+			candles[i].Metadata = make(map[string]float64)
+		}
+		candles[i].Metadata[model.MetadataFundingRate] = rate
+
+		value, ok := interest[candles[i].Time.Add(duration).UnixMilli()]
+		if !ok {
+			value = math.NaN()
+		}
+		candles[i].Metadata[model.MetadataOpenInterest] = value
+	}
+}
+
+// signedOptions returns the request options of signed requests
+func (b *BinanceFuture) signedOptions() []futures.RequestOption {
+	if b.recvWindow <= 0 {
+		return nil
+	}
+	return []futures.RequestOption{futures.WithRecvWindow(b.recvWindow.Milliseconds())}
+}
+
+func (b *BinanceFuture) Timeframes() []string {
+	return BinanceTimeframes
+}
+
 func (b *BinanceFuture) AssetsInfo(pair string) model.AssetInfo {
 	return b.assetsInfo[pair]
 }
@@ -180,14 +510,15 @@ func (b *BinanceFuture) CreateOrderStop(pair string, quantity float64, limit flo
 	}
 
 	order, err := b.client.NewCreateOrderService().Symbol(pair).
+		NewClientOrderID(NewClientOrderID()).
 		Type(futures.OrderTypeStopMarket).
 		TimeInForce(futures.TimeInForceTypeGTC).
 		Side(futures.SideTypeSell).
 		Quantity(b.formatQuantity(pair, quantity)).
 		Price(b.formatPrice(pair, limit)).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	price, _ := strconv.ParseFloat(order.Price, 64)
@@ -206,16 +537,77 @@ func (b *BinanceFuture) CreateOrderStop(pair string, quantity float64, limit flo
 	}, nil
 }
 
+// CreateOrderTrailingStop creates a native trailing stop market order, which trails the price in the exchange
+// servers, so it keeps protecting the position while the bot is offline. The order is activated at the activation
+// price, or at the last price when it is zero, and triggered when the price retraces by the callback rate
+// (e.g. 0.01 for 1%, Binance accepts 0.1% to 10% in steps of 0.1%). The order is reduce only, closing the position
+func (b *BinanceFuture) CreateOrderTrailingStop(side model.SideType, pair string, size, activation,
+	callbackRate float64) (model.Order, error) {
+
+	err := b.validate(pair, size)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	service := b.client.NewCreateOrderService().
+		NewClientOrderID(NewClientOrderID()).
+		Symbol(pair).
+		Type(futures.OrderTypeTrailingStopMarket).
+		Side(futures.SideType(side)).
+		Quantity(b.formatQuantity(pair, size)).
+		CallbackRate(strconv.FormatFloat(math.Round(callbackRate*1000)/10, 'f', -1, 64)).
+		ReduceOnly(true)
+
+	if activation > 0 {
+		service = service.ActivationPrice(b.formatPrice(pair, activation))
+	}
+
+	order, err := service.Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return model.Order{}, binanceError(err)
+	}
+
+	return newFutureTrailingStopOrder(order)
+}
+
+// newFutureTrailingStopOrder converts a trailing stop order, where the price of the order is the activation price
+func newFutureTrailingStopOrder(order *futures.CreateOrderResponse) (model.Order, error) {
+	quantity, err := strconv.ParseFloat(order.OrigQuantity, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var price float64
+	if order.ActivatePrice != "" {
+		price, err = strconv.ParseFloat(order.ActivatePrice, 64)
+		if err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return model.Order{
+		ExchangeID: order.OrderID,
+		CreatedAt:  time.Unix(0, order.UpdateTime*int64(time.Millisecond)),
+		UpdatedAt:  time.Unix(0, order.UpdateTime*int64(time.Millisecond)),
+		Pair:       order.Symbol,
+		Side:       model.SideType(order.Side),
+		Type:       model.OrderType(order.Type),
+		Status:     model.OrderStatusType(order.Status),
+		Price:      price,
+		Quantity:   quantity,
+	}, nil
+}
+
 func (b *BinanceFuture) formatPrice(pair string, value float64) string {
 	if info, ok := b.assetsInfo[pair]; ok {
-		value = common.AmountToLotSize(info.TickSize, info.QuotePrecision, value)
+		return formatDecimal(value, info.TickSize, info.QuotePrecision)
 	}
 	return strconv.FormatFloat(value, 'f', -1, 64)
 }
 
 func (b *BinanceFuture) formatQuantity(pair string, value float64) string {
 	if info, ok := b.assetsInfo[pair]; ok {
-		value = common.AmountToLotSize(info.StepSize, info.BaseAssetPrecision, value)
+		return formatDecimal(value, info.StepSize, info.BaseAssetPrecision)
 	}
 	return strconv.FormatFloat(value, 'f', -1, 64)
 }
@@ -223,21 +615,46 @@ func (b *BinanceFuture) formatQuantity(pair string, value float64) string {
 func (b *BinanceFuture) CreateOrderLimit(side model.SideType, pair string,
 	quantity float64, limit float64) (model.Order, error) {
 
+	return b.CreateOrderLimitTIF(side, pair, quantity, limit, model.TimeInForceGTC)
+}
+
+func (b *BinanceFuture) CreateOrderLimitTIF(side model.SideType, pair string,
+	quantity float64, limit float64, timeInForce model.TimeInForce) (model.Order, error) {
+
+	return b.createOrderLimit(side, pair, quantity, limit, timeInForce, false)
+}
+
+// CreateOrderLimitReduceOnly creates a GTC limit order that only reduces the position, see
+// exchange.ReduceOnlyCreator
+func (b *BinanceFuture) CreateOrderLimitReduceOnly(side model.SideType, pair string, quantity,
+	limit float64) (model.Order, error) {
+
+	return b.createOrderLimit(side, pair, quantity, limit, model.TimeInForceGTC, true)
+}
+
+func (b *BinanceFuture) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	timeInForce model.TimeInForce, reduceOnly bool) (model.Order, error) {
+
 	err := b.validate(pair, quantity)
 	if err != nil {
 		return model.Order{}, err
 	}
 
-	order, err := b.client.NewCreateOrderService().
+	service := b.client.NewCreateOrderService().
+		NewClientOrderID(NewClientOrderID()).
 		Symbol(pair).
 		Type(futures.OrderTypeLimit).
-		TimeInForce(futures.TimeInForceTypeGTC).
+		TimeInForce(futures.TimeInForceType(timeInForce)).
 		Side(futures.SideType(side)).
 		Quantity(b.formatQuantity(pair, quantity)).
-		Price(b.formatPrice(pair, limit)).
-		Do(b.ctx)
+		Price(b.formatPrice(pair, limit))
+	if reduceOnly {
+		service = service.ReduceOnly(true)
+	}
+
+	order, err := service.Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	price, err := strconv.ParseFloat(order.Price, 64)
@@ -250,6 +667,17 @@ func (b *BinanceFuture) CreateOrderLimit(side model.SideType, pair string,
 		return model.Order{}, err
 	}
 
+	// IOC and FOK orders are resolved immediately, partial fills are expired with the remaining
+	// quantity canceled, so we keep only the executed quantity and the average price
+	status := model.OrderStatusType(order.Status)
+	executed, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if timeInForce != model.TimeInForceGTC && executed > 0 {
+		cost, _ := strconv.ParseFloat(order.CumQuote, 64)
+		status = model.OrderStatusTypeFilled
+		price = cost / executed
+		quantity = executed
+	}
+
 	return model.Order{
 		ExchangeID: order.OrderID,
 		CreatedAt:  time.Unix(0, order.UpdateTime*int64(time.Millisecond)),
@@ -257,27 +685,46 @@ func (b *BinanceFuture) CreateOrderLimit(side model.SideType, pair string,
 		Pair:       pair,
 		Side:       model.SideType(order.Side),
 		Type:       model.OrderType(order.Type),
-		Status:     model.OrderStatusType(order.Status),
+		Status:     status,
 		Price:      price,
 		Quantity:   quantity,
 	}, nil
 }
 
 func (b *BinanceFuture) CreateOrderMarket(side model.SideType, pair string, quantity float64) (model.Order, error) {
+	return b.createOrderMarket(side, pair, quantity, false)
+}
+
+// CreateOrderMarketReduceOnly creates a market order that only reduces the position, see
+// exchange.ReduceOnlyCreator
+func (b *BinanceFuture) CreateOrderMarketReduceOnly(side model.SideType, pair string,
+	quantity float64) (model.Order, error) {
+
+	return b.createOrderMarket(side, pair, quantity, true)
+}
+
+func (b *BinanceFuture) createOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+
 	err := b.validate(pair, quantity)
 	if err != nil {
 		return model.Order{}, err
 	}
 
-	order, err := b.client.NewCreateOrderService().
+	service := b.client.NewCreateOrderService().
+		NewClientOrderID(NewClientOrderID()).
 		Symbol(pair).
 		Type(futures.OrderTypeMarket).
 		Side(futures.SideType(side)).
 		Quantity(b.formatQuantity(pair, quantity)).
-		NewOrderResponseType(futures.NewOrderRespTypeRESULT).
-		Do(b.ctx)
+		NewOrderResponseType(futures.NewOrderRespTypeRESULT)
+	if reduceOnly {
+		service = service.ReduceOnly(true)
+	}
+
+	order, err := service.Do(b.ctx, b.signedOptions()...)
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	cost, err := strconv.ParseFloat(order.CumQuote, 64)
@@ -303,26 +750,58 @@ func (b *BinanceFuture) CreateOrderMarket(side model.SideType, pair string, quan
 	}, nil
 }
 
-func (b *BinanceFuture) CreateOrderMarketQuote(_ model.SideType, _ string, _ float64) (model.Order, error) {
-	panic("not implemented")
+// CreateOrderMarketQuote creates a market order using the amount in quote asset.
+// Binance Futures does not support quoteOrderQty, so the amount is converted to base asset using the last quote
+func (b *BinanceFuture) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	price, err := b.LastQuote(b.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if price <= 0 {
+		return model.Order{}, fmt.Errorf("invalid last quote for %s: %f", pair, price)
+	}
+
+	return b.CreateOrderMarket(side, pair, quote/price)
 }
 
 func (b *BinanceFuture) Cancel(order model.Order) error {
 	_, err := b.client.NewCancelOrderService().
 		Symbol(order.Pair).
 		OrderID(order.ExchangeID).
-		Do(b.ctx)
-	return err
+		Do(b.ctx, b.signedOptions()...)
+	return binanceError(err)
+}
+
+// CancelAll cancels all open orders of the given pair and returns the canceled orders
+func (b *BinanceFuture) CancelAll(pair string) ([]model.Order, error) {
+	// the futures API does not return the canceled orders
+	orders, err := b.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.client.NewCancelAllOpenOrdersService().
+		Symbol(pair).
+		Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	for i := range orders {
+		orders[i].Status = model.OrderStatusTypeCanceled
+	}
+	return orders, nil
 }
 
 func (b *BinanceFuture) Orders(pair string, limit int) ([]model.Order, error) {
 	result, err := b.client.NewListOrdersService().
 		Symbol(pair).
 		Limit(limit).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 
 	if err != nil {
-		return nil, err
+		return nil, binanceError(err)
 	}
 
 	orders := make([]model.Order, 0)
@@ -332,14 +811,31 @@ func (b *BinanceFuture) Orders(pair string, limit int) ([]model.Order, error) {
 	return orders, nil
 }
 
+// OpenOrders returns the orders of the given pair that are still open in the exchange
+func (b *BinanceFuture) OpenOrders(pair string) ([]model.Order, error) {
+	result, err := b.client.NewListOpenOrdersService().
+		Symbol(pair).
+		Do(b.ctx, b.signedOptions()...)
+
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	orders := make([]model.Order, 0, len(result))
+	for _, order := range result {
+		orders = append(orders, newFutureOrder(order))
+	}
+	return orders, nil
+}
+
 func (b *BinanceFuture) Order(pair string, id int64) (model.Order, error) {
 	order, err := b.client.NewGetOrderService().
 		Symbol(pair).
 		OrderID(id).
-		Do(b.ctx)
+		Do(b.ctx, b.signedOptions()...)
 
 	if err != nil {
-		return model.Order{}, err
+		return model.Order{}, binanceError(err)
 	}
 
 	return newFutureOrder(order), nil
@@ -352,6 +848,7 @@ func newFutureOrder(order *futures.Order) model.Order {
 	)
 	cost, _ := strconv.ParseFloat(order.CumQuote, 64)
 	quantity, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	executed := quantity
 	if cost > 0 && quantity > 0 {
 		price = cost / quantity
 	} else {
@@ -361,6 +858,12 @@ func newFutureOrder(order *futures.Order) model.Order {
 		log.CheckErr(log.WarnLevel, err)
 	}
 
+	// open trailing stop orders have no price, the activation price is used instead
+	if price == 0 && order.Type == futures.OrderTypeTrailingStopMarket && order.ActivatePrice != "" {
+		price, err = strconv.ParseFloat(order.ActivatePrice, 64)
+		log.CheckErr(log.WarnLevel, err)
+	}
+
 	return model.Order{
 		ExchangeID: order.OrderID,
 		Pair:       order.Symbol,
@@ -371,11 +874,14 @@ func newFutureOrder(order *futures.Order) model.Order {
 		Status:     model.OrderStatusType(order.Status),
 		Price:      price,
 		Quantity:   quantity,
+
+		ExecutedQuantity: executed,
+		ClientOrderID:    order.ClientOrderID,
 	}
 }
 
 func (b *BinanceFuture) Account() (model.Account, error) {
-	acc, err := b.client.NewGetAccountService().Do(b.ctx)
+	acc, err := b.client.NewGetAccountService().Do(b.ctx, b.signedOptions()...)
 	if err != nil {
 		return model.Account{}, err
 	}
@@ -454,8 +960,17 @@ func (b *BinanceFuture) CandlesSubscription(ctx context.Context, pair, period st
 		}
 
 		for {
-			done, _, err := futures.WsKlineServe(pair, period, func(event *futures.WsKlineEvent) {
+			alive := make(chan struct{}, 1)
+			endpoint := fmt.Sprintf("%s/%s@kline_%s", b.streamURL, strings.ToLower(pair), period)
+			done, stop, err := serveStream(b.dialer, endpoint, b.pingInterval, func(message []byte) {
+				event := new(futures.WsKlineEvent)
+				if err := json.Unmarshal(message, event); err != nil {
+					cerr <- err
+					return
+				}
+
 				ba.Reset()
+				signalAlive(alive)
 				candle := FutureCandleFromWsKline(pair, event.Kline)
 
 				if candle.Complete && b.HeikinAshi {
@@ -470,7 +985,7 @@ func (b *BinanceFuture) CandlesSubscription(ctx context.Context, pair, period st
 					}
 				}
 
-				ccandle <- candle
+				ccandle <- candleTimestamp(b.timeMode, period, candle)
 
 			}, func(err error) {
 				cerr <- err
@@ -482,10 +997,67 @@ func (b *BinanceFuture) CandlesSubscription(ctx context.Context, pair, period st
 				return
 			}
 
+			canceled, err := watchStream(ctx, done, stop, alive, b.readTimeout)
+			if canceled {
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			if err != nil {
+				cerr <- fmt.Errorf("%s %s: %w", pair, period, err)
+			}
+			time.Sleep(ba.Duration())
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// TradesSubscription streams the aggregated trades of the given pair
+func (b *BinanceFuture) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ctrade := make(chan model.Trade)
+	cerr := make(chan error)
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		for {
+			endpoint := fmt.Sprintf("%s/%s@aggTrade", b.streamURL, strings.ToLower(pair))
+			done, _, err := serveStream(b.dialer, endpoint, b.pingInterval, func(message []byte) {
+				event := new(futures.WsAggTradeEvent)
+				if err := json.Unmarshal(message, event); err != nil {
+					cerr <- err
+					return
+				}
+
+				ba.Reset()
+				trade := model.Trade{
+					Pair:         pair,
+					ID:           event.AggregateTradeID,
+					Time:         time.Unix(0, event.TradeTime*int64(time.Millisecond)),
+					IsBuyerMaker: event.Maker,
+				}
+				trade.Price, _ = strconv.ParseFloat(event.Price, 64)
+				trade.Quantity, _ = strconv.ParseFloat(event.Quantity, 64)
+				ctrade <- trade
+			}, func(err error) {
+				cerr <- err
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ctrade)
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				close(cerr)
-				close(ccandle)
+				close(ctrade)
 				return
 			case <-done:
 				time.Sleep(ba.Duration())
@@ -493,7 +1065,7 @@ func (b *BinanceFuture) CandlesSubscription(ctx context.Context, pair, period st
 		}
 	}()
 
-	return ccandle, cerr
+	return ctrade, cerr
 }
 
 func (b *BinanceFuture) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
@@ -521,7 +1093,9 @@ func (b *BinanceFuture) CandlesByLimit(ctx context.Context, pair, period string,
 	}
 
 	// discard last candle, because it is incomplete
-	return candles[:len(candles)-1], nil
+	candles = candles[:len(candles)-1]
+	b.derivativesHistory(ctx, pair, period, candles)
+	return candleTimestamps(b.timeMode, period, candles), nil
 }
 
 func (b *BinanceFuture) CandlesByPeriod(ctx context.Context, pair, period string,
@@ -533,8 +1107,8 @@ func (b *BinanceFuture) CandlesByPeriod(ctx context.Context, pair, period string
 
 	data, err := klineService.Symbol(pair).
 		Interval(period).
-		StartTime(start.UnixNano() / int64(time.Millisecond)).
-		EndTime(end.UnixNano() / int64(time.Millisecond)).
+		StartTime(candleOpenTime(b.timeMode, period, start).UnixNano() / int64(time.Millisecond)).
+		EndTime(candleOpenTime(b.timeMode, period, end).UnixNano() / int64(time.Millisecond)).
 		Do(ctx)
 
 	if err != nil {
@@ -551,7 +1125,15 @@ func (b *BinanceFuture) CandlesByPeriod(ctx context.Context, pair, period string
 		candles = append(candles, candle)
 	}
 
-	return candles, nil
+	b.derivativesHistory(ctx, pair, period, candles)
+	return candleTimestamps(b.timeMode, period, candles), nil
+}
+
+// SetCandleTimeMode sets the timestamp convention of the candles, the open time of the kline by default.
+// The requested periods are in the same convention
+func (b *BinanceFuture) SetCandleTimeMode(mode model.CandleTimeMode) error {
+	b.timeMode = mode
+	return nil
 }
 
 func FutureCandleFromKline(pair string, k futures.Kline) model.Candle {
@@ -0,0 +1,259 @@
+package exchange
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// WithBinanceMarginPair sets the margin mode of a pair for margin orders, pairs without
+// a defined mode use the cross margin account
+func WithBinanceMarginPair(pair string, marginType MarginType) BinanceOption {
+	return func(b *Binance) {
+		b.marginTypes[pair] = marginType
+	}
+}
+
+func (b *Binance) isIsolated(pair string) bool {
+	return b.marginTypes[pair] == MarginTypeIsolated
+}
+
+// addMarginOrder registers an order of the margin account, so Order and Cancel use the margin endpoints. The
+// orders are registered in memory, the margin orders of previous runs are queried with OrderMargin
+func (b *Binance) addMarginOrder(id int64) {
+	b.marginMtx.Lock()
+	defer b.marginMtx.Unlock()
+
+	if b.marginOrders == nil {
+		b.marginOrders = make(map[int64]bool)
+	}
+	b.marginOrders[id] = true
+}
+
+func (b *Binance) isMarginOrder(id int64) bool {
+	b.marginMtx.RLock()
+	defer b.marginMtx.RUnlock()
+	return b.marginOrders[id]
+}
+
+// MarginAccount returns the margin balances available for the pair, including the borrowed amount and
+// the accrued interest. Isolated pairs return only the base and quote assets of the pair
+func (b *Binance) MarginAccount(pair string) (model.Account, error) {
+	if b.isIsolated(pair) {
+		acc, err := b.client.NewGetIsolatedMarginAccountService().Symbols(pair).Do(b.ctx, b.signedOptions()...)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		balances := make([]model.Balance, 0)
+		for _, asset := range acc.Assets {
+			for _, balance := range []binance.IsolatedUserAsset{asset.BaseAsset, asset.QuoteAsset} {
+				marginBalance, err := newMarginBalance(balance.Asset, balance.Free, balance.Locked,
+					balance.Borrowed, balance.Interest)
+				if err != nil {
+					return model.Account{}, err
+				}
+				balances = append(balances, marginBalance)
+			}
+		}
+
+		return model.Account{Balances: balances}, nil
+	}
+
+	acc, err := b.client.NewGetMarginAccountService().Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0)
+	for _, balance := range acc.UserAssets {
+		marginBalance, err := newMarginBalance(balance.Asset, balance.Free, balance.Locked,
+			balance.Borrowed, balance.Interest)
+		if err != nil {
+			return model.Account{}, err
+		}
+		balances = append(balances, marginBalance)
+	}
+
+	return model.Account{Balances: balances}, nil
+}
+
+func newMarginBalance(asset, free, locked, borrowed, interest string) (model.Balance, error) {
+	balance := model.Balance{Asset: asset}
+	for _, field := range []struct {
+		value  string
+		target *float64
+	}{
+		{free, &balance.Free},
+		{locked, &balance.Lock},
+		{borrowed, &balance.Borrowed},
+		{interest, &balance.Interest},
+	} {
+		value, err := strconv.ParseFloat(field.value, 64)
+		if err != nil {
+			return model.Balance{}, err
+		}
+		*field.target = value
+	}
+	return balance, nil
+}
+
+// CreateOrderMarketMargin creates a market order in the margin account of the pair. The side effect
+// defines if the order borrows the missing amount (MARGIN_BUY) or repays the debt (AUTO_REPAY)
+func (b *Binance) CreateOrderMarketMargin(side model.SideType, pair string, quantity float64,
+	sideEffect model.SideEffectType) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := b.client.NewCreateMarginOrderService().
+		NewClientOrderID(NewClientOrderID()).
+		Symbol(pair).
+		IsIsolated(b.isIsolated(pair)).
+		Type(binance.OrderTypeMarket).
+		Side(binance.SideType(side)).
+		Quantity(b.formatQuantity(pair, quantity)).
+		SideEffectType(binance.SideEffectType(sideEffect)).
+		NewOrderRespType(binance.NewOrderRespTypeFULL).
+		Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return model.Order{}, binanceError(err)
+	}
+
+	b.addMarginOrder(order.OrderID)
+
+	cost, err := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	executed, err := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	// orders without fills, e.g. expired, keep the order price and quantity
+	price, _ := strconv.ParseFloat(order.Price, 64)
+	if executed > 0 {
+		price = cost / executed
+		quantity = executed
+	}
+
+	return model.Order{
+		ExchangeID: order.OrderID,
+		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:       order.Symbol,
+		Side:       model.SideType(order.Side),
+		Type:       model.OrderType(order.Type),
+		Status:     model.OrderStatusType(order.Status),
+		Price:      price,
+		Quantity:   quantity,
+
+		ExecutedQuantity: executed,
+	}, nil
+}
+
+// CreateOrderLimitMargin creates a GTC limit order in the margin account of the pair
+func (b *Binance) CreateOrderLimitMargin(side model.SideType, pair string, quantity float64, limit float64,
+	sideEffect model.SideEffectType) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := b.client.NewCreateMarginOrderService().
+		NewClientOrderID(NewClientOrderID()).
+		Symbol(pair).
+		IsIsolated(b.isIsolated(pair)).
+		Type(binance.OrderTypeLimit).
+		TimeInForce(binance.TimeInForceTypeGTC).
+		Side(binance.SideType(side)).
+		Quantity(b.formatQuantity(pair, quantity)).
+		Price(b.formatPrice(pair, limit)).
+		SideEffectType(binance.SideEffectType(sideEffect)).
+		Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return model.Order{}, binanceError(err)
+	}
+
+	b.addMarginOrder(order.OrderID)
+
+	price, err := strconv.ParseFloat(order.Price, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	quantity, err = strconv.ParseFloat(order.OrigQuantity, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return model.Order{
+		ExchangeID: order.OrderID,
+		CreatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		UpdatedAt:  time.Unix(0, order.TransactTime*int64(time.Millisecond)),
+		Pair:       pair,
+		Side:       model.SideType(order.Side),
+		Type:       model.OrderType(order.Type),
+		Status:     model.OrderStatusType(order.Status),
+		Price:      price,
+		Quantity:   quantity,
+	}, nil
+}
+
+// CancelMargin cancels an open order of the margin account
+func (b *Binance) CancelMargin(order model.Order) error {
+	_, err := b.client.NewCancelMarginOrderService().
+		Symbol(order.Pair).
+		IsIsolated(b.isIsolated(order.Pair)).
+		OrderID(order.ExchangeID).
+		Do(b.ctx, b.signedOptions()...)
+	return binanceError(err)
+}
+
+// OrderMargin returns an order of the margin account
+func (b *Binance) OrderMargin(pair string, id int64) (model.Order, error) {
+	order, err := b.client.NewGetMarginOrderService().
+		Symbol(pair).
+		IsIsolated(b.isIsolated(pair)).
+		OrderID(id).
+		Do(b.ctx, b.signedOptions()...)
+	if err != nil {
+		return model.Order{}, binanceError(err)
+	}
+
+	return newOrder(order), nil
+}
+
+// Borrow borrows the amount of asset in the margin account of the pair
+func (b *Binance) Borrow(pair, asset string, amount float64) error {
+	service := b.client.NewMarginLoanService().
+		Asset(asset).
+		Amount(strconv.FormatFloat(amount, 'f', -1, 64))
+	if b.isIsolated(pair) {
+		service = service.IsIsolated(true).Symbol(pair)
+	}
+
+	_, err := service.Do(b.ctx, b.signedOptions()...)
+	return err
+}
+
+// Repay repays the amount of asset borrowed in the margin account of the pair
+func (b *Binance) Repay(pair, asset string, amount float64) error {
+	service := b.client.NewMarginRepayService().
+		Asset(asset).
+		Amount(strconv.FormatFloat(amount, 'f', -1, 64))
+	if b.isIsolated(pair) {
+		service = service.IsIsolated(true).Symbol(pair)
+	}
+
+	_, err := service.Do(b.ctx, b.signedOptions()...)
+	return err
+}
@@ -1,9 +1,18 @@
 package exchange
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/futures"
 	"github.com/stretchr/testify/require"
 
 	"github.com/rodrigo-brito/ninjabot/model"
@@ -51,3 +60,622 @@ func TestFormatQuantity(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatPrecisionOverride(t *testing.T) {
+	info := model.AssetInfo{
+		StepSize:           0.00001,
+		TickSize:           0.01,
+		BaseAssetPrecision: 5,
+		QuotePrecision:     2,
+	}
+
+	exchange := &Binance{}
+	WithBinanceQuantityPrecision("BTCUSDT", 3)(exchange)
+	WithBinancePricePrecision("ETHUSDT", 4)(exchange)
+	exchange.assetsInfo = map[string]model.AssetInfo{
+		"BTCUSDT": exchange.precision.apply("BTCUSDT", info),
+		"ETHUSDT": exchange.precision.apply("ETHUSDT", info),
+		"BNBUSDT": exchange.precision.apply("BNBUSDT", info),
+	}
+
+	// the quantity is truncated to the overridden precision, the price keeps the exchange values
+	require.Equal(t, "1.234", exchange.formatQuantity("BTCUSDT", 1.23499))
+	require.Equal(t, "1.23", exchange.formatPrice("BTCUSDT", 1.23499))
+	require.Equal(t, 0.001, exchange.AssetsInfo("BTCUSDT").StepSize)
+	require.Equal(t, 1.234, RoundQuantity(exchange.AssetsInfo("BTCUSDT"), 1.23499))
+
+	// a finer precision keeps the tick size of the exchange
+	require.Equal(t, "1.23", exchange.formatPrice("ETHUSDT", 1.23456))
+	require.Equal(t, 4, exchange.AssetsInfo("ETHUSDT").QuotePrecision)
+
+	// pairs without override use the exchange values
+	require.Equal(t, info, exchange.AssetsInfo("BNBUSDT"))
+}
+
+func TestFormatQuoteQuantity(t *testing.T) {
+	binance := Binance{assetsInfo: map[string]model.AssetInfo{
+		"BTCUSDT": {QuotePrecision: 8},
+		"BATBTC":  {QuotePrecision: 2},
+	}}
+
+	tt := []struct {
+		pair     string
+		quantity float64
+		expected string
+	}{
+		{"BTCUSDT", 100, "100"},
+		{"BTCUSDT", 10.123456789, "10.12345678"},
+		{"BATBTC", 10.119, "10.11"},
+		{"ETHUSDT", 1.23456789, "1.23456789"},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("given %f %s", tc.quantity, tc.pair), func(t *testing.T) {
+			require.Equal(t, tc.expected, binance.formatQuoteQuantity(tc.pair, tc.quantity))
+		})
+	}
+}
+
+func TestFormatTinyTickSize(t *testing.T) {
+	binance := Binance{assetsInfo: map[string]model.AssetInfo{
+		"SHIBUSDT": {
+			StepSize:           1,
+			TickSize:           0.00000001,
+			BaseAssetPrecision: 2,
+			QuotePrecision:     8,
+		},
+		"PEPEUSDT": {
+			StepSize:           1,
+			TickSize:           0.00000001,
+			BaseAssetPrecision: 2,
+			QuotePrecision:     8,
+		},
+		"SATSUSDT": {
+			StepSize:           1,
+			TickSize:           0.0000000001,
+			BaseAssetPrecision: 2,
+			QuotePrecision:     10,
+		},
+	}}
+
+	prices := []struct {
+		pair     string
+		price    float64
+		expected string
+	}{
+		{"SHIBUSDT", 0.00001234, "0.00001234"},
+		{"SHIBUSDT", 0.000012345678, "0.00001234"},
+		{"SHIBUSDT", 0.00002357, "0.00002357"},
+		{"PEPEUSDT", 0.00000029, "0.00000029"},
+		{"PEPEUSDT", 0.0000007, "0.0000007"},
+		{"PEPEUSDT", 0.00000001, "0.00000001"},
+		{"PEPEUSDT", 0.000000009, "0"},
+		{"SATSUSDT", 0.0000000029, "0.0000000029"},
+		{"SATSUSDT", 0.00000031234, "0.0000003123"},
+	}
+
+	for _, tc := range prices {
+		t.Run(fmt.Sprintf("price %s %s", tc.pair, tc.expected), func(t *testing.T) {
+			require.Equal(t, tc.expected, binance.formatPrice(tc.pair, tc.price))
+			require.Equal(t, tc.expected, binance.formatQuoteQuantity(tc.pair, tc.price))
+		})
+	}
+
+	quantities := []struct {
+		pair     string
+		quantity float64
+		expected string
+	}{
+		{"SHIBUSDT", 123456789.99, "123456789"},
+		{"SHIBUSDT", 1e7, "10000000"},
+		{"PEPEUSDT", 1e15, "1000000000000000"},
+		{"PEPEUSDT", 0.5, "0"},
+	}
+
+	for _, tc := range quantities {
+		t.Run(fmt.Sprintf("quantity %s %s", tc.pair, tc.expected), func(t *testing.T) {
+			require.Equal(t, tc.expected, binance.formatQuantity(tc.pair, tc.quantity))
+		})
+	}
+}
+
+func TestBinanceError(t *testing.T) {
+	tt := []struct {
+		code     int64
+		message  string
+		expected error
+	}{
+		{-1003, "Too many requests; current limit is 1200 requests per minute.", ErrRateLimited},
+		{-1015, "Too many new orders.", ErrRateLimited},
+		{-1013, "Filter failure: NOTIONAL", ErrMinNotional},
+		{-4164, "Order's notional must be no smaller than 5.0", ErrMinNotional},
+		{-2010, "Market is closed.", ErrMarketClosed},
+		{-2010, "Duplicate order sent.", ErrDuplicateOrder},
+		{-4116, "ClientOrderId is duplicated.", ErrDuplicateOrder},
+		{-2010, "Account has insufficient balance for requested action.", ErrInsufficientFunds},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.message, func(t *testing.T) {
+			err := binanceError(fmt.Errorf("request: %w", &common.APIError{Code: tc.code, Message: tc.message}))
+			require.ErrorIs(t, err, tc.expected)
+
+			var apiError *common.APIError
+			require.True(t, errors.As(err, &apiError))
+			require.Equal(t, tc.code, apiError.Code)
+		})
+	}
+
+	t.Run("unknown error", func(t *testing.T) {
+		err := &common.APIError{Code: -1021, Message: "Timestamp for this request is outside of the recvWindow."}
+		require.Equal(t, err, binanceError(err))
+		require.NoError(t, binanceError(nil))
+	})
+}
+
+func TestNewAccountTrade(t *testing.T) {
+	trade := newAccountTrade(&binance.TradeV3{
+		ID:              1,
+		Symbol:          "BTCUSDT",
+		OrderID:         2,
+		Price:           "100.5",
+		Quantity:        "0.2",
+		Commission:      "0.0001",
+		CommissionAsset: "BNB",
+		Time:            1600000000000,
+		IsBuyer:         true,
+		IsMaker:         false,
+	})
+
+	require.Equal(t, model.Trade{
+		Pair:            "BTCUSDT",
+		ID:              1,
+		Price:           100.5,
+		Quantity:        0.2,
+		Time:            time.Unix(1600000000, 0),
+		OrderID:         2,
+		Side:            model.SideTypeBuy,
+		Commission:      0.0001,
+		CommissionAsset: "BNB",
+	}, trade)
+}
+
+func TestNewFutureTrailingStopOrder(t *testing.T) {
+	order, err := newFutureTrailingStopOrder(&futures.CreateOrderResponse{
+		Symbol:        "BTCUSDT",
+		OrderID:       1,
+		Price:         "0",
+		OrigQuantity:  "0.5",
+		Status:        futures.OrderStatusTypeNew,
+		Type:          futures.OrderTypeTrailingStopMarket,
+		Side:          futures.SideTypeSell,
+		UpdateTime:    1600000000000,
+		ActivatePrice: "31000.5",
+		PriceRate:     "1.5",
+	})
+	require.NoError(t, err)
+	require.Equal(t, model.Order{
+		ExchangeID: 1,
+		Pair:       "BTCUSDT",
+		Side:       model.SideTypeSell,
+		Type:       model.OrderTypeTrailingStopMarket,
+		Status:     model.OrderStatusTypeNew,
+		Price:      31000.5,
+		Quantity:   0.5,
+		CreatedAt:  time.Unix(1600000000, 0),
+		UpdatedAt:  time.Unix(1600000000, 0),
+	}, order)
+}
+
+func TestBinance_OrderReplace(t *testing.T) {
+	var response string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/api/v3/order/cancelReplace", r.URL.Path)
+		require.Equal(t, "key", r.Header.Get("X-MBX-APIKEY"))
+
+		query := r.URL.Query()
+		require.Equal(t, "BTCUSDT", query.Get("symbol"))
+		require.Equal(t, "STOP_ON_FAILURE", query.Get("cancelReplaceMode"))
+		require.Equal(t, "42", query.Get("cancelOrderId"))
+		require.Equal(t, "0.5", query.Get("quantity"))
+		require.Equal(t, "30000.12", query.Get("price"))
+		require.Equal(t, "GTC", query.Get("timeInForce"))
+		require.NotEmpty(t, query.Get("signature"))
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	client := binance.NewClient("key", "secret")
+	client.BaseURL = server.URL
+	exchange := &Binance{
+		ctx:    context.Background(),
+		client: client,
+		assetsInfo: map[string]model.AssetInfo{
+			"BTCUSDT": {MinQuantity: 0.0001, MaxQuantity: 100, StepSize: 0.0001, TickSize: 0.01,
+				BaseAssetPrecision: 8, QuotePrecision: 8},
+		},
+	}
+	order := model.Order{ExchangeID: 42, Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit,
+		Price: 29000, Quantity: 0.4}
+
+	t.Run("replaced", func(t *testing.T) {
+		response = `{"cancelResult":"SUCCESS","newOrderResult":"SUCCESS","cancelResponse":{"orderId":42},
+			"newOrderResponse":{"symbol":"BTCUSDT","orderId":43,"transactTime":1600000000000,"price":"30000.12",
+			"origQty":"0.5","executedQty":"0","status":"NEW","type":"LIMIT","side":"BUY"}}`
+
+		replaced, err := exchange.OrderReplace(order, 30000.123, 0.5)
+		require.NoError(t, err)
+		require.Equal(t, model.Order{
+			ExchangeID: 43,
+			Pair:       "BTCUSDT",
+			Side:       model.SideTypeBuy,
+			Type:       model.OrderTypeLimit,
+			Status:     model.OrderStatusTypeNew,
+			Price:      30000.12,
+			Quantity:   0.5,
+			CreatedAt:  time.Unix(1600000000, 0),
+			UpdatedAt:  time.Unix(1600000000, 0),
+		}, replaced)
+	})
+
+	t.Run("cancel failed", func(t *testing.T) {
+		status = http.StatusBadRequest
+		response = `{"code":-2022,"msg":"Order cancel-replace failed.","data":{"cancelResult":"FAILURE",
+			"newOrderResult":"NOT_ATTEMPTED","cancelResponse":{"code":-2011,"msg":"Unknown order sent."},
+			"newOrderResponse":null}}`
+
+		_, err := exchange.OrderReplace(order, 30000.12, 0.5)
+		var apiError *common.APIError
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, ErrCancelReplaceFailed, apiError.Code)
+	})
+
+	t.Run("unsupported order", func(t *testing.T) {
+		_, err := exchange.OrderReplace(model.Order{Pair: "BTCUSDT", Type: model.OrderTypeMarket}, 1, 1)
+		require.Error(t, err)
+	})
+}
+
+func TestBinance_OrderFee(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/order":
+			if r.Method == http.MethodPost {
+				_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","orderId":1,"transactTime":1600000000000,
+					"executedQty":"0.2","cummulativeQuoteQty":"2000","status":"FILLED","type":"MARKET","side":"BUY",
+					"fills":[{"price":"10000","qty":"0.1","commission":"0.0001","commissionAsset":"BTC"},
+					{"price":"10000","qty":"0.1","commission":"1","commissionAsset":"USDT"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"symbol":"BTCUSDT","orderId":%s,"executedQty":"0.2",
+				"cummulativeQuoteQty":"2000","status":"FILLED","type":"LIMIT","side":"SELL"}`,
+				r.URL.Query().Get("orderId"))))
+		case "/api/v3/myTrades":
+			if r.URL.Query().Get("orderId") == "3" {
+				_, _ = w.Write([]byte(`[{"symbol":"BTCUSDT","orderId":3,"price":"10000","qty":"0.2",
+					"commission":"0.001","commissionAsset":"BNB"}]`))
+				return
+			}
+			require.Equal(t, "2", r.URL.Query().Get("orderId"))
+			_, _ = w.Write([]byte(`[{"symbol":"BTCUSDT","orderId":2,"price":"10000","qty":"0.2",
+				"commission":"2","commissionAsset":"USDT"}]`))
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := binance.NewClient("key", "secret")
+	client.BaseURL = server.URL
+	exchange := &Binance{
+		ctx:    context.Background(),
+		client: client,
+		assetsInfo: map[string]model.AssetInfo{
+			"BTCUSDT": {BaseAsset: "BTC", QuoteAsset: "USDT", MinQuantity: 0.0001, MaxQuantity: 100,
+				StepSize: 0.0001, TickSize: 0.01, BaseAssetPrecision: 8, QuotePrecision: 8},
+		},
+	}
+
+	// the base commission is converted with the fill price
+	order, err := exchange.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.2)
+	require.NoError(t, err)
+	require.InDelta(t, 2.0, order.Fee, 1e-9)
+
+	order, err = exchange.Order("BTCUSDT", 2)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, order.Fee)
+
+	// commissions in other assets are estimated by the controller
+	order, err = exchange.Order("BTCUSDT", 3)
+	require.NoError(t, err)
+	require.Zero(t, order.Fee)
+}
+
+func TestBinance_CreateOrderOTOCO(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/api/v3/orderList/otoco", r.URL.Path)
+
+		query := r.URL.Query()
+		require.Equal(t, "BTCUSDT", query.Get("symbol"))
+		require.Equal(t, "LIMIT", query.Get("workingType"))
+		require.Equal(t, "BUY", query.Get("workingSide"))
+		require.Equal(t, "29000", query.Get("workingPrice"))
+		require.Equal(t, "0.5", query.Get("workingQuantity"))
+		require.Equal(t, "SELL", query.Get("pendingSide"))
+		require.Equal(t, "LIMIT_MAKER", query.Get("pendingAboveType"))
+		require.Equal(t, "31000", query.Get("pendingAbovePrice"))
+		require.Equal(t, "STOP_LOSS_LIMIT", query.Get("pendingBelowType"))
+		require.Equal(t, "28000", query.Get("pendingBelowStopPrice"))
+		require.Equal(t, "27900", query.Get("pendingBelowPrice"))
+		require.NotEmpty(t, query.Get("signature"))
+
+		_, _ = w.Write([]byte(`{"orderListId":7,"contingencyType":"OTO","transactionTime":1600000000000,
+			"symbol":"BTCUSDT","orderReports":[
+			{"symbol":"BTCUSDT","orderId":10,"orderListId":7,"price":"29000.00","origQty":"0.5","status":"NEW",
+				"type":"LIMIT","side":"BUY"},
+			{"symbol":"BTCUSDT","orderId":11,"orderListId":7,"price":"27900.00","origQty":"0.5",
+				"status":"PENDING_NEW","type":"STOP_LOSS_LIMIT","side":"SELL","stopPrice":"28000.00"},
+			{"symbol":"BTCUSDT","orderId":12,"orderListId":7,"price":"31000.00","origQty":"0.5",
+				"status":"PENDING_NEW","type":"LIMIT_MAKER","side":"SELL"}]}`))
+	}))
+	defer server.Close()
+
+	client := binance.NewClient("key", "secret")
+	client.BaseURL = server.URL
+	exchange := &Binance{
+		ctx:    context.Background(),
+		client: client,
+		assetsInfo: map[string]model.AssetInfo{
+			"BTCUSDT": {MinQuantity: 0.0001, MaxQuantity: 100, StepSize: 0.0001, TickSize: 0.01,
+				BaseAssetPrecision: 8, QuotePrecision: 8},
+		},
+	}
+
+	orders, err := exchange.CreateOrderOTOCO(model.SideTypeBuy, "BTCUSDT", 0.5, 29000, 31000, 28000, 27900)
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+
+	require.Equal(t, int64(10), orders[0].ExchangeID)
+	require.Equal(t, model.OrderStatusTypeNew, orders[0].Status)
+	require.Nil(t, orders[0].GroupID)
+
+	require.Equal(t, model.OrderTypeStopLossLimit, orders[1].Type)
+	require.Equal(t, model.OrderStatusTypePendingNew, orders[1].Status)
+	require.Equal(t, 28000.0, *orders[1].Stop)
+	require.Equal(t, int64(7), *orders[1].GroupID)
+
+	require.Equal(t, model.OrderTypeLimitMaker, orders[2].Type)
+	require.Equal(t, 31000.0, orders[2].Price)
+	require.Equal(t, time.Unix(1600000000, 0), orders[2].CreatedAt)
+}
+
+func TestBinanceFuture_DerivativesHistory(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := int64(time.Hour / time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		switch r.URL.Path {
+		case "/futures/data/openInterestHist":
+			require.Equal(t, "1h", r.URL.Query().Get("period"))
+			_, _ = w.Write([]byte(fmt.Sprintf(`[
+				{"symbol":"BTCUSDT","sumOpenInterest":"100.5","timestamp":%d},
+				{"symbol":"BTCUSDT","sumOpenInterest":"110","timestamp":%d}
+			]`, start.UnixMilli()+hour, start.UnixMilli()+3*hour)))
+		case "/fapi/v1/fundingRate":
+			_, _ = w.Write([]byte(fmt.Sprintf(`[
+				{"symbol":"BTCUSDT","fundingRate":"0.0002","fundingTime":%d},
+				{"symbol":"BTCUSDT","fundingRate":"0.0001","fundingTime":%d}
+			]`, start.UnixMilli()+hour, start.UnixMilli()-7*hour)))
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := futures.NewClient("", "")
+	client.BaseURL = server.URL
+	exchange := &BinanceFuture{ctx: context.Background(), client: client, derivatives: true}
+
+	candles := []model.Candle{
+		{Pair: "BTCUSDT", Time: start},
+		{Pair: "BTCUSDT", Time: start.Add(time.Hour)},
+		{Pair: "BTCUSDT", Time: start.Add(2 * time.Hour)},
+	}
+	exchange.derivativesHistory(context.Background(), "BTCUSDT", "1h", candles)
+
+	// the open interest of the candle close
+	require.Equal(t, 100.5, candles[0].Metadata[model.MetadataOpenInterest])
+	require.True(t, math.IsNaN(candles[1].Metadata[model.MetadataOpenInterest]))
+	require.Equal(t, 110.0, candles[2].Metadata[model.MetadataOpenInterest])
+
+	// the last funding rate settled until the candle open
+	require.Equal(t, 0.0001, candles[0].Metadata[model.MetadataFundingRate])
+	require.Equal(t, 0.0002, candles[1].Metadata[model.MetadataFundingRate])
+	require.Equal(t, 0.0002, candles[2].Metadata[model.MetadataFundingRate])
+}
+
+func TestBinance_CandleTimeMode(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := int64(time.Hour / time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v3/klines", r.URL.Path)
+		if r.URL.Query().Get("startTime") != "" {
+			// the period is requested with the open time of the klines
+			require.Equal(t, fmt.Sprint(start.UnixMilli()), r.URL.Query().Get("startTime"))
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(`[
+			[%d,"1","2","0.5","1.5","10",%d,"0",1,"0","0","0"],
+			[%d,"1.5","2","1","1.8","10",%d,"0",1,"0","0","0"]
+		]`, start.UnixMilli(), start.UnixMilli()+hour-1, start.UnixMilli()+hour, start.UnixMilli()+2*hour-1)))
+	}))
+	defer server.Close()
+
+	client := binance.NewClient("", "")
+	client.BaseURL = server.URL
+	exchange := &Binance{ctx: context.Background(), client: client}
+
+	candles, err := exchange.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 1)
+	require.NoError(t, err)
+	require.Equal(t, start, candles[0].Time.UTC())
+
+	require.NoError(t, exchange.SetCandleTimeMode(model.CandleTimeClose))
+	candles, err = exchange.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 1)
+	require.NoError(t, err)
+	require.Len(t, candles, 1)
+	require.Equal(t, start.Add(time.Hour), candles[0].Time.UTC())
+
+	candles, err = exchange.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", start.Add(time.Hour),
+		start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, candles, 2)
+	require.Equal(t, start.Add(2*time.Hour), candles[1].Time.UTC())
+}
+
+func TestBinanceFuture_ReduceOnly(t *testing.T) {
+	var reduceOnly []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/fapi/v1/order", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		reduceOnly = append(reduceOnly, r.Form.Get("reduceOnly"))
+		_, _ = w.Write([]byte(`{"orderId":1,"symbol":"BTCUSDT","side":"SELL","type":"MARKET","status":"FILLED",
+			"price":"100","origQty":"1","executedQty":"1","cumQuote":"100","updateTime":1}`))
+	}))
+	defer server.Close()
+
+	client := futures.NewClient("key", "secret")
+	client.BaseURL = server.URL
+	exchange := &BinanceFuture{ctx: context.Background(), client: client, assetsInfo: map[string]model.AssetInfo{
+		"BTCUSDT": {MinQuantity: 0.001, MaxQuantity: 1000, StepSize: 0.001, TickSize: 0.1},
+	}}
+
+	_, err := exchange.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+	_, err = exchange.CreateOrderMarketReduceOnly(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+	_, err = exchange.CreateOrderLimitReduceOnly(model.SideTypeSell, "BTCUSDT", 1, 100)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"", "true", "true"}, reduceOnly)
+}
+
+func TestBinance_Margin(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/sapi/v1/margin/order":
+			if r.Method == http.MethodDelete { // the form of delete requests is not parsed
+				_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","orderId":"2","status":"CANCELED"}`))
+				return
+			}
+
+			require.Equal(t, "TRUE", r.Form.Get("isIsolated"))
+			if r.Method == http.MethodPost && r.Form.Get("type") == "MARKET" {
+				require.Equal(t, "MARGIN_BUY", r.Form.Get("sideEffectType"))
+				// an expired market order without fills
+				_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","orderId":1,"transactTime":1,"price":"0",
+					"origQty":"0.5","executedQty":"0","cummulativeQuoteQty":"0","status":"EXPIRED",
+					"type":"MARKET","side":"BUY"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","orderId":2,"transactTime":1,"price":"100",
+				"origQty":"0.5","executedQty":"0.5","cummulativeQuoteQty":"50","status":"FILLED",
+				"type":"LIMIT","side":"SELL"}`))
+		case "/sapi/v1/margin/isolated/account":
+			_, _ = w.Write([]byte(`{"assets":[{"symbol":"BTCUSDT",
+				"baseAsset":{"asset":"BTC","free":"1","locked":"0","borrowed":"0.5","interest":"0.001"},
+				"quoteAsset":{"asset":"USDT","free":"100","locked":"10","borrowed":"0","interest":"0"}}]}`))
+		default:
+			t.Fatalf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := binance.NewClient("key", "secret")
+	client.BaseURL = server.URL
+	exchange := &Binance{
+		ctx:         context.Background(),
+		client:      client,
+		marginTypes: map[string]MarginType{"BTCUSDT": MarginTypeIsolated},
+		assetsInfo: map[string]model.AssetInfo{
+			"BTCUSDT": {MinQuantity: 0.0001, MaxQuantity: 100, StepSize: 0.0001, TickSize: 0.01,
+				BaseAssetPrecision: 8, QuotePrecision: 8},
+		},
+	}
+
+	order, err := exchange.CreateOrderMarketMargin(model.SideTypeBuy, "BTCUSDT", 0.5, model.SideEffectTypeMarginBuy)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeExpired, order.Status)
+	require.False(t, math.IsNaN(order.Price))
+	require.Equal(t, 0.5, order.Quantity)
+	require.Zero(t, order.ExecutedQuantity)
+
+	order, err = exchange.CreateOrderLimitMargin(model.SideTypeSell, "BTCUSDT", 0.5, 100,
+		model.SideEffectTypeAutoRepay)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), order.ExchangeID)
+	require.Equal(t, 100.0, order.Price)
+
+	// the orders of the margin account are queried and canceled with the margin endpoints
+	order, err = exchange.Order("BTCUSDT", 2)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 0.5, order.ExecutedQuantity)
+	require.NoError(t, exchange.Cancel(order))
+
+	account, err := exchange.MarginAccount("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, []model.Balance{
+		{Asset: "BTC", Free: 1, Borrowed: 0.5, Interest: 0.001},
+		{Asset: "USDT", Free: 100, Lock: 10},
+	}, account.Balances)
+
+	require.Equal(t, []string{
+		"POST /sapi/v1/margin/order",
+		"POST /sapi/v1/margin/order",
+		"GET /sapi/v1/margin/order",
+		"DELETE /sapi/v1/margin/order",
+		"GET /sapi/v1/margin/isolated/account",
+	}, requests)
+}
+
+func TestNewDepth(t *testing.T) {
+	depth, err := newDepth("BTCUSDT", time.Unix(0, 0),
+		[]common.PriceLevel{{Price: "99.5", Quantity: "2"}},
+		[]common.PriceLevel{{Price: "100", Quantity: "1.5"}, {Price: "100.5", Quantity: "3"}})
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", depth.Pair)
+	require.Equal(t, []model.PriceLevel{{Price: 99.5, Quantity: 2}}, depth.Bids)
+	require.Equal(t, []model.PriceLevel{{Price: 100, Quantity: 1.5}, {Price: 100.5, Quantity: 3}}, depth.Asks)
+
+	_, err = newDepth("BTCUSDT", time.Unix(0, 0), []common.PriceLevel{{Price: "x", Quantity: "1"}}, nil)
+	require.Error(t, err)
+}
+
+func TestAssetsInfoChanges(t *testing.T) {
+	previous := map[string]model.AssetInfo{
+		"BTCUSDT":  {BaseAsset: "BTC", QuoteAsset: "USDT", StepSize: 0.0001},
+		"ETHUSDT":  {BaseAsset: "ETH", QuoteAsset: "USDT", StepSize: 0.001},
+		"LUNAUSDT": {BaseAsset: "LUNA", QuoteAsset: "USDT", StepSize: 1},
+	}
+	current := map[string]model.AssetInfo{
+		"BTCUSDT": {BaseAsset: "BTC", QuoteAsset: "USDT", StepSize: 0.0001},
+		"ETHUSDT": {BaseAsset: "ETH", QuoteAsset: "USDT", StepSize: 0.0001},
+		"SOLUSDT": {BaseAsset: "SOL", QuoteAsset: "USDT", StepSize: 0.01},
+	}
+
+	changes := assetsInfoChanges(previous, current)
+	require.Len(t, changes, 3)
+	require.Contains(t, changes[0], "ETHUSDT filters changed")
+	require.Equal(t, "LUNAUSDT delisted", changes[1])
+	require.Equal(t, "SOLUSDT listed", changes[2])
+
+	require.Empty(t, assetsInfoChanges(current, current))
+}
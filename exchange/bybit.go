@@ -0,0 +1,1224 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jpillora/backoff"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+const (
+	bybitBaseURL          = "https://api.bybit.com"
+	bybitStreamURL        = "wss://stream.bybit.com/v5/public/"
+	bybitTestnetBaseURL   = "https://api-testnet.bybit.com"
+	bybitTestnetStreamURL = "wss://stream-testnet.bybit.com/v5/public/"
+	bybitRecvWindow       = 5 * time.Second
+	bybitPageLimit        = 1000
+	bybitPingInterval     = 20 * time.Second
+)
+
+// Bybit error codes of orders rejected due to insufficient balance
+const (
+	ErrBybitSpotInsufficientBalance     = 170131
+	ErrBybitWalletInsufficientBalance   = 110004
+	ErrBybitOrderInsufficientBalance    = 110007
+	ErrBybitPositionInsufficientBalance = 110012
+)
+
+type BybitCategory string
+
+const (
+	BybitCategorySpot   BybitCategory = "spot"
+	BybitCategoryLinear BybitCategory = "linear"
+)
+
+var bybitIntervals = map[string]string{
+	"1m": "1", "3m": "3", "5m": "5", "15m": "15", "30m": "30", "1h": "60", "2h": "120", "4h": "240",
+	"6h": "360", "12h": "720", "1d": "D", "1w": "W", "1M": "M",
+}
+
+var bybitOrderStatus = map[string]model.OrderStatusType{
+	"Created":                 model.OrderStatusTypeNew,
+	"New":                     model.OrderStatusTypeNew,
+	"Untriggered":             model.OrderStatusTypeNew,
+	"Triggered":               model.OrderStatusTypeNew,
+	"PartiallyFilled":         model.OrderStatusTypePartiallyFilled,
+	"Filled":                  model.OrderStatusTypeFilled,
+	"Cancelled":               model.OrderStatusTypeCanceled,
+	"PartiallyFilledCanceled": model.OrderStatusTypeCanceled,
+	"Deactivated":             model.OrderStatusTypeCanceled,
+	"Rejected":                model.OrderStatusTypeRejected,
+}
+
+// BybitError is an error returned by the Bybit API
+type BybitError struct {
+	Code    int
+	Message string
+}
+
+func (e *BybitError) Error() string {
+	return fmt.Sprintf("bybit: %s (code %d)", e.Message, e.Code)
+}
+
+// Is classifies the error codes of orders rejected due to insufficient balance as ErrInsufficientFunds
+func (e *BybitError) Is(target error) bool {
+	if target != ErrInsufficientFunds {
+		return false
+	}
+
+	switch e.Code {
+	case ErrBybitSpotInsufficientBalance, ErrBybitWalletInsufficientBalance, ErrBybitOrderInsufficientBalance,
+		ErrBybitPositionInsufficientBalance:
+		return true
+	}
+	return false
+}
+
+// Bybit implements the exchange with the Bybit v5 unified API. Each instance trades a single
+// category, spot or linear perpetuals (USDT and USDC contracts)
+type Bybit struct {
+	ctx        context.Context
+	client     *http.Client
+	dialer     *websocket.Dialer
+	proxy      *url.URL
+	category   BybitCategory
+	baseURL    string
+	streamURL  string
+	assetsInfo map[string]model.AssetInfo
+	counter    int64
+	recvWindow time.Duration
+	HeikinAshi bool
+
+	APIKey    string
+	APISecret string
+
+	MetadataFetchers []MetadataFetchers
+
+	mtx      sync.Mutex
+	orderIDs map[int64]string
+}
+
+type BybitOption func(*Bybit)
+
+// WithBybitCredentials will set Bybit credentials
+func WithBybitCredentials(key, secret string) BybitOption {
+	return func(b *Bybit) {
+		b.APIKey = key
+		b.APISecret = secret
+	}
+}
+
+// WithBybitCategory sets the product category of the instance. Default: BybitCategorySpot
+func WithBybitCategory(category BybitCategory) BybitOption {
+	return func(b *Bybit) {
+		b.category = category
+	}
+}
+
+// WithBybitTestnet uses the Bybit testnet environment
+func WithBybitTestnet() BybitOption {
+	return func(b *Bybit) {
+		b.baseURL = bybitTestnetBaseURL
+		b.streamURL = bybitTestnetStreamURL
+	}
+}
+
+// WithBybitBaseURL sets the REST and the public websocket URLs, eg: https://api.bybit.com and
+// wss://stream.bybit.com/v5/public/, the category is appended to the stream URL
+func WithBybitBaseURL(baseURL, streamURL string) BybitOption {
+	return func(b *Bybit) {
+		b.baseURL = strings.TrimRight(baseURL, "/")
+		b.streamURL = streamURL
+	}
+}
+
+// WithBybitRecvWindow sets the receive window of signed requests, the maximum delay accepted by the
+// server between the request timestamp and its arrival. Default: 5 seconds
+func WithBybitRecvWindow(window time.Duration) BybitOption {
+	return func(b *Bybit) {
+		if window > 0 {
+			b.recvWindow = window
+		}
+	}
+}
+
+// WithBybitHeikinAshiCandle will convert candle to Heikin Ashi
+func WithBybitHeikinAshiCandle() BybitOption {
+	return func(b *Bybit) {
+		b.HeikinAshi = true
+	}
+}
+
+// WithBybitMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithBybitMetadataFetcher(fetcher MetadataFetchers) BybitOption {
+	return func(b *Bybit) {
+		b.MetadataFetchers = append(b.MetadataFetchers, fetcher)
+	}
+}
+
+// WithBybitHTTPClient sets the HTTP client of the REST requests, e.g. with a custom transport or TLS config
+func WithBybitHTTPClient(client *http.Client) BybitOption {
+	return func(b *Bybit) {
+		b.client = client
+	}
+}
+
+// WithBybitDialer sets the dialer of the websocket subscriptions, e.g. with a proxy, TLS config or
+// handshake timeout. Default: websocket.DefaultDialer
+func WithBybitDialer(dialer *websocket.Dialer) BybitOption {
+	return func(b *Bybit) {
+		b.dialer = dialer
+	}
+}
+
+// WithBybitProxy routes the REST requests and the websocket subscriptions through the proxy,
+// applied on top of the HTTP client and dialer options
+func WithBybitProxy(proxy *url.URL) BybitOption {
+	return func(b *Bybit) {
+		b.proxy = proxy
+	}
+}
+
+// NewBybit creates a new Bybit exchange instance and loads the instrument filters of the category
+func NewBybit(ctx context.Context, options ...BybitOption) (*Bybit, error) {
+	exchange := &Bybit{
+		ctx:        ctx,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		dialer:     websocket.DefaultDialer,
+		category:   BybitCategorySpot,
+		baseURL:    bybitBaseURL,
+		streamURL:  bybitStreamURL,
+		assetsInfo: make(map[string]model.AssetInfo),
+		counter:    time.Now().UnixMilli() * 1000,
+		recvWindow: bybitRecvWindow,
+		orderIDs:   make(map[int64]string),
+	}
+
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.proxy != nil {
+		exchange.client = proxyClient(exchange.client, exchange.proxy)
+		exchange.dialer = proxyDialer(exchange.dialer, exchange.proxy)
+	}
+
+	if exchange.category != BybitCategorySpot && exchange.category != BybitCategoryLinear {
+		return nil, fmt.Errorf("bybit: invalid category: %s", exchange.category)
+	}
+
+	err := exchange.Ping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("bybit ping fail: %w", err)
+	}
+
+	err = exchange.loadInstruments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("[SETUP] Using Bybit exchange (%s)", exchange.category)
+
+	return exchange, nil
+}
+
+type bybitResponse struct {
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// request calls the API and decodes the result field of the response. GET parameters are sent in the query
+// and POST parameters in a JSON body, signed requests include the HMAC-SHA256 signature of
+// timestamp + key + recv window + payload
+func (b *Bybit) request(ctx context.Context, method, path string, params map[string]interface{}, signed bool,
+	result interface{}) error {
+
+	var payload string
+	requestURL := b.baseURL + path
+	if method == http.MethodGet {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, fmt.Sprint(value))
+		}
+		payload = query.Encode()
+		if payload != "" {
+			requestURL += "?" + payload
+		}
+	} else {
+		body, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		payload = string(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Body = http.NoBody
+	}
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		recvWindow := strconv.FormatInt(b.recvWindow.Milliseconds(), 10)
+		mac := hmac.New(sha256.New, []byte(b.APISecret))
+		mac.Write([]byte(timestamp + b.APIKey + recvWindow + payload))
+
+		req.Header.Set("X-BAPI-API-KEY", b.APIKey)
+		req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+		req.Header.Set("X-BAPI-RECV-WINDOW", recvWindow)
+		req.Header.Set("X-BAPI-SIGN", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response bybitResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("bybit: %s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if response.RetCode != 0 {
+		return &BybitError{Code: response.RetCode, Message: response.RetMsg}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// Ping checks the connection with the exchange server
+func (b *Bybit) Ping(ctx context.Context) error {
+	return b.request(ctx, http.MethodGet, "/v5/market/time", nil, false, nil)
+}
+
+type bybitInstrument struct {
+	Symbol        string `json:"symbol"`
+	BaseCoin      string `json:"baseCoin"`
+	QuoteCoin     string `json:"quoteCoin"`
+	LotSizeFilter struct {
+		BasePrecision    string `json:"basePrecision"`
+		QuotePrecision   string `json:"quotePrecision"`
+		QtyStep          string `json:"qtyStep"`
+		MinOrderQty      string `json:"minOrderQty"`
+		MaxOrderQty      string `json:"maxOrderQty"`
+		MinOrderAmt      string `json:"minOrderAmt"`
+		MinNotionalValue string `json:"minNotionalValue"`
+	} `json:"lotSizeFilter"`
+	PriceFilter struct {
+		TickSize string `json:"tickSize"`
+		MinPrice string `json:"minPrice"`
+		MaxPrice string `json:"maxPrice"`
+	} `json:"priceFilter"`
+}
+
+func (b *Bybit) loadInstruments(ctx context.Context) error {
+	cursor := ""
+	for {
+		params := map[string]interface{}{"category": b.category, "limit": bybitPageLimit}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var result struct {
+			List           []bybitInstrument `json:"list"`
+			NextPageCursor string            `json:"nextPageCursor"`
+		}
+		err := b.request(ctx, http.MethodGet, "/v5/market/instruments-info", params, false, &result)
+		if err != nil {
+			return err
+		}
+
+		for _, instrument := range result.List {
+			b.assetsInfo[instrument.Symbol] = newBybitAssetInfo(instrument)
+		}
+
+		if result.NextPageCursor == "" || len(result.List) == 0 {
+			return nil
+		}
+		cursor = result.NextPageCursor
+	}
+}
+
+func newBybitAssetInfo(instrument bybitInstrument) model.AssetInfo {
+	filter := instrument.LotSizeFilter
+	info := model.AssetInfo{
+		BaseAsset:  instrument.BaseCoin,
+		QuoteAsset: instrument.QuoteCoin,
+	}
+
+	// spot instruments define the quantity step as base precision and contracts as qty step
+	step := filter.QtyStep
+	if step == "" {
+		step = filter.BasePrecision
+	}
+	info.StepSize, _ = strconv.ParseFloat(step, 64)
+	info.BaseAssetPrecision = bybitDecimals(step)
+
+	info.MinQuantity, _ = strconv.ParseFloat(filter.MinOrderQty, 64)
+	info.MaxQuantity, _ = strconv.ParseFloat(filter.MaxOrderQty, 64)
+	info.TickSize, _ = strconv.ParseFloat(instrument.PriceFilter.TickSize, 64)
+	info.MinPrice, _ = strconv.ParseFloat(instrument.PriceFilter.MinPrice, 64)
+	info.MaxPrice, _ = strconv.ParseFloat(instrument.PriceFilter.MaxPrice, 64)
+
+	info.QuotePrecision = bybitDecimals(instrument.PriceFilter.TickSize)
+	if filter.QuotePrecision != "" {
+		info.QuotePrecision = bybitDecimals(filter.QuotePrecision)
+	}
+
+	notional := filter.MinNotionalValue
+	if notional == "" {
+		notional = filter.MinOrderAmt
+	}
+	info.MinNotional, _ = strconv.ParseFloat(notional, 64)
+
+	return info
+}
+
+// bybitDecimals returns the number of decimal places of a step, eg: 0.001 -> 3
+func bybitDecimals(value string) int {
+	index := strings.Index(value, ".")
+	if index < 0 {
+		return 0
+	}
+	return len(strings.TrimRight(value[index+1:], "0"))
+}
+
+func (b *Bybit) Timeframes() []string {
+	return BybitTimeframes
+}
+
+func (b *Bybit) AssetsInfo(pair string) model.AssetInfo {
+	return b.assetsInfo[pair]
+}
+
+func (b *Bybit) validate(pair string, quantity float64) error {
+	info, ok := b.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (b *Bybit) formatPrice(pair string, value float64) string {
+	if info, ok := b.assetsInfo[pair]; ok {
+		return formatDecimal(value, info.TickSize, info.QuotePrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (b *Bybit) formatQuantity(pair string, value float64) string {
+	if info, ok := b.assetsInfo[pair]; ok {
+		return formatDecimal(value, info.StepSize, info.BaseAssetPrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (b *Bybit) formatQuoteQuantity(pair string, value float64) string {
+	if info, ok := b.assetsInfo[pair]; ok {
+		return formatDecimal(value, 0, info.QuotePrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (b *Bybit) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var result struct {
+		List []struct {
+			LastPrice string `json:"lastPrice"`
+		} `json:"list"`
+	}
+	err := b.request(ctx, http.MethodGet, "/v5/market/tickers",
+		map[string]interface{}{"category": b.category, "symbol": pair}, false, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(result.List) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+	}
+
+	return strconv.ParseFloat(result.List[0].LastPrice, 64)
+}
+
+// LastPrice returns the last traded price of the pair from the ticker endpoint
+func (b *Bybit) LastPrice(pair string) (float64, error) {
+	return b.LastQuote(b.ctx, pair)
+}
+
+func (b *Bybit) candles(ctx context.Context, pair, period string, params map[string]interface{}) ([]model.Candle,
+	error) {
+
+	interval, ok := bybitIntervals[period]
+	if !ok {
+		return nil, ValidateTimeframe(period, BybitTimeframes)
+	}
+
+	params["category"] = b.category
+	params["symbol"] = pair
+	params["interval"] = interval
+
+	var result struct {
+		List [][]string `json:"list"`
+	}
+	err := b.request(ctx, http.MethodGet, "/v5/market/kline", params, false, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	// klines are sorted in reverse order, the newest first
+	candles := make([]model.Candle, 0, len(result.List))
+	ha := model.NewHeikinAshi()
+	for i := len(result.List) - 1; i >= 0; i-- {
+		candle, err := CandleFromBybitKline(pair, result.List[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if b.HeikinAshi {
+			candle = candle.ToHeikinAshi(ha)
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+func (b *Bybit) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	candles, err := b.candles(ctx, pair, period, map[string]interface{}{"limit": limit + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) == 0 {
+		return candles, nil
+	}
+
+	// discard last candle, because it is incomplete
+	return candles[:len(candles)-1], nil
+}
+
+func (b *Bybit) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	return b.candles(ctx, pair, period, map[string]interface{}{
+		"start": start.UnixMilli(),
+		"end":   end.UnixMilli(),
+		"limit": bybitPageLimit,
+	})
+}
+
+// CandleFromBybitKline converts a kline of the REST API: start time, open, high, low, close, volume
+// and turnover. The candle time is the open time of the kline
+func CandleFromBybitKline(pair string, kline []string) (model.Candle, error) {
+	if len(kline) < 6 {
+		return model.Candle{}, fmt.Errorf("bybit: invalid kline: %v", kline)
+	}
+
+	start, err := strconv.ParseInt(kline[0], 10, 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	t := time.UnixMilli(start)
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Complete: true}
+	candle.Open, _ = strconv.ParseFloat(kline[1], 64)
+	candle.High, _ = strconv.ParseFloat(kline[2], 64)
+	candle.Low, _ = strconv.ParseFloat(kline[3], 64)
+	candle.Close, _ = strconv.ParseFloat(kline[4], 64)
+	candle.Volume, _ = strconv.ParseFloat(kline[5], 64)
+	candle.Metadata = make(map[string]float64)
+	return candle, nil
+}
+
+type bybitWsKline struct {
+	Start     int64  `json:"start"`
+	Open      string `json:"open"`
+	Close     string `json:"close"`
+	High      string `json:"high"`
+	Low       string `json:"low"`
+	Volume    string `json:"volume"`
+	Confirm   bool   `json:"confirm"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// CandleFromBybitWsKline converts a kline of the websocket stream, the candle time is the start (open) time
+func CandleFromBybitWsKline(pair string, kline bybitWsKline) model.Candle {
+	candle := model.Candle{
+		Pair:      pair,
+		Time:      time.UnixMilli(kline.Start),
+		UpdatedAt: time.UnixMilli(kline.Timestamp),
+		Complete:  kline.Confirm,
+		Metadata:  make(map[string]float64),
+	}
+	candle.Open, _ = strconv.ParseFloat(kline.Open, 64)
+	candle.Close, _ = strconv.ParseFloat(kline.Close, 64)
+	candle.High, _ = strconv.ParseFloat(kline.High, 64)
+	candle.Low, _ = strconv.ParseFloat(kline.Low, 64)
+	candle.Volume, _ = strconv.ParseFloat(kline.Volume, 64)
+	return candle
+}
+
+type bybitWsMessage struct {
+	Op      string          `json:"op"`
+	Success *bool           `json:"success"`
+	RetMsg  string          `json:"ret_msg"`
+	Topic   string          `json:"topic"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// serve subscribes to a public topic and calls the handler with the data of each message,
+// until the connection is closed or the context is canceled
+func (b *Bybit) serve(ctx context.Context, topic string, handler func(data json.RawMessage) error) error {
+	conn, _, err := b.dialer.DialContext(ctx, b.streamURL+string(b.category), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.WriteJSON(map[string]interface{}{"op": "subscribe", "args": []string{topic}})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	var writeMtx sync.Mutex
+	go func() {
+		ticker := time.NewTicker(bybitPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				writeMtx.Lock()
+				err := conn.WriteJSON(map[string]string{"op": "ping"})
+				writeMtx.Unlock()
+				if err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var message bybitWsMessage
+		err := conn.ReadJSON(&message)
+		if err != nil {
+			return err
+		}
+
+		if message.Op == "subscribe" && message.Success != nil && !*message.Success {
+			return fmt.Errorf("bybit: subscribe %s: %s", topic, message.RetMsg)
+		}
+
+		if message.Topic != topic {
+			continue
+		}
+
+		err = handler(message.Data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// stream keeps the subscription of a topic, reconnecting when the connection is lost
+func (b *Bybit) stream(ctx context.Context, topic string, cerr chan error,
+	handler func(data json.RawMessage) error) {
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 1 * time.Second,
+	}
+
+	for {
+		err := b.serve(ctx, topic, func(data json.RawMessage) error {
+			ba.Reset()
+			return handler(data)
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if err != nil {
+			cerr <- err
+		}
+		time.Sleep(ba.Duration())
+	}
+}
+
+func (b *Bybit) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+
+	interval, ok := bybitIntervals[period]
+	if !ok {
+		go func() {
+			cerr <- ValidateTimeframe(period, BybitTimeframes)
+			close(cerr)
+			close(ccandle)
+		}()
+		return ccandle, cerr
+	}
+
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+
+		ha := model.NewHeikinAshi()
+		b.stream(ctx, fmt.Sprintf("kline.%s.%s", interval, pair), cerr, func(data json.RawMessage) error {
+			var klines []bybitWsKline
+			err := json.Unmarshal(data, &klines)
+			if err != nil {
+				return err
+			}
+
+			for _, kline := range klines {
+				candle := CandleFromBybitWsKline(pair, kline)
+
+				if candle.Complete && b.HeikinAshi {
+					candle = candle.ToHeikinAshi(ha)
+				}
+
+				if candle.Complete {
+					// fetch aditional data if needed
+					for _, fetcher := range b.MetadataFetchers {
+						key, value := fetcher(pair, candle.Time)
+						candle.Metadata[key] = value
+					}
+				}
+
+				ccandle <- candle
+			}
+			return nil
+		})
+	}()
+
+	return ccandle, cerr
+}
+
+// TradesSubscription streams the public trades of the given pair
+func (b *Bybit) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ctrade := make(chan model.Trade)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(ctrade)
+
+		b.stream(ctx, "publicTrade."+pair, cerr, func(data json.RawMessage) error {
+			var trades []struct {
+				Time     int64  `json:"T"`
+				Side     string `json:"S"`
+				Quantity string `json:"v"`
+				Price    string `json:"p"`
+				ID       string `json:"i"`
+			}
+			err := json.Unmarshal(data, &trades)
+			if err != nil {
+				return err
+			}
+
+			for _, event := range trades {
+				trade := model.Trade{
+					Pair: pair,
+					Time: time.UnixMilli(event.Time),
+					// the side is the taker side, the buyer is the maker of a sell
+					IsBuyerMaker: event.Side == "Sell",
+				}
+				trade.ID, _ = strconv.ParseInt(event.ID, 10, 64)
+				trade.Price, _ = strconv.ParseFloat(event.Price, 64)
+				trade.Quantity, _ = strconv.ParseFloat(event.Quantity, 64)
+				ctrade <- trade
+			}
+			return nil
+		})
+	}()
+
+	return ctrade, cerr
+}
+
+type bybitOrder struct {
+	OrderID      string `json:"orderId"`
+	OrderLinkID  string `json:"orderLinkId"`
+	Symbol       string `json:"symbol"`
+	Side         string `json:"side"`
+	OrderType    string `json:"orderType"`
+	OrderStatus  string `json:"orderStatus"`
+	Price        string `json:"price"`
+	Qty          string `json:"qty"`
+	AvgPrice     string `json:"avgPrice"`
+	CumExecQty   string `json:"cumExecQty"`
+	TriggerPrice string `json:"triggerPrice"`
+	CreatedTime  string `json:"createdTime"`
+	UpdatedTime  string `json:"updatedTime"`
+}
+
+// newOrderID returns a numeric client order ID, Bybit order IDs of contracts are UUIDs and
+// the client ID (orderLinkId) is used as exchange ID of orders created by the bot
+func (b *Bybit) newOrderID() int64 {
+	return atomic.AddInt64(&b.counter, 1)
+}
+
+// newOrder converts an order of the API and keeps its Bybit order ID to be used in cancellations
+func (b *Bybit) newOrder(order bybitOrder) model.Order {
+	id, err := strconv.ParseInt(order.OrderLinkID, 10, 64)
+	if err != nil {
+		// orders created outside the bot
+		id, _ = strconv.ParseInt(order.OrderID, 10, 64)
+	}
+
+	b.mtx.Lock()
+	b.orderIDs[id] = order.OrderID
+	b.mtx.Unlock()
+
+	price, _ := strconv.ParseFloat(order.AvgPrice, 64)
+	quantity, _ := strconv.ParseFloat(order.CumExecQty, 64)
+	if price <= 0 || quantity <= 0 {
+		price, _ = strconv.ParseFloat(order.Price, 64)
+		quantity, _ = strconv.ParseFloat(order.Qty, 64)
+	}
+
+	orderType := model.OrderTypeLimit
+	if order.OrderType == "Market" {
+		orderType = model.OrderTypeMarket
+	}
+
+	var stop *float64
+	if trigger, _ := strconv.ParseFloat(order.TriggerPrice, 64); trigger > 0 {
+		orderType = model.OrderTypeStopLossLimit
+		stop = &trigger
+	}
+
+	status, ok := bybitOrderStatus[order.OrderStatus]
+	if !ok {
+		status = model.OrderStatusType(strings.ToUpper(order.OrderStatus))
+	}
+
+	created, _ := strconv.ParseInt(order.CreatedTime, 10, 64)
+	updated, _ := strconv.ParseInt(order.UpdatedTime, 10, 64)
+
+	return model.Order{
+		ExchangeID: id,
+		Pair:       order.Symbol,
+		CreatedAt:  time.UnixMilli(created),
+		UpdatedAt:  time.UnixMilli(updated),
+		Side:       model.SideType(strings.ToUpper(order.Side)),
+		Type:       orderType,
+		Status:     status,
+		Price:      price,
+		Quantity:   quantity,
+		Stop:       stop,
+	}
+}
+
+func (b *Bybit) orders(path string, params map[string]interface{}) ([]model.Order, error) {
+	params["category"] = b.category
+
+	var result struct {
+		List []bybitOrder `json:"list"`
+	}
+	err := b.request(b.ctx, http.MethodGet, path, params, true, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(result.List))
+	for _, order := range result.List {
+		orders = append(orders, b.newOrder(order))
+	}
+	return orders, nil
+}
+
+// orderParams returns the identification of an order, the Bybit order ID when it is known
+func (b *Bybit) orderParams(pair string, id int64) map[string]interface{} {
+	params := map[string]interface{}{"category": b.category, "symbol": pair}
+
+	b.mtx.Lock()
+	orderID, ok := b.orderIDs[id]
+	b.mtx.Unlock()
+
+	if ok && orderID != "" {
+		params["orderId"] = orderID
+	} else {
+		params["orderLinkId"] = strconv.FormatInt(id, 10)
+	}
+	return params
+}
+
+func (b *Bybit) Order(pair string, id int64) (model.Order, error) {
+	// open and recent orders, closed orders are moved to the history after a while
+	for _, path := range []string{"/v5/order/realtime", "/v5/order/history"} {
+		orders, err := b.orders(path, b.orderParams(pair, id))
+		if err != nil {
+			return model.Order{}, err
+		}
+
+		if len(orders) > 0 {
+			return orders[0], nil
+		}
+	}
+
+	return model.Order{}, fmt.Errorf("bybit: order %d not found", id)
+}
+
+// OpenOrders returns the orders of the given pair that are still open in the exchange
+func (b *Bybit) OpenOrders(pair string) ([]model.Order, error) {
+	return b.orders("/v5/order/realtime", map[string]interface{}{"symbol": pair, "openOnly": 0})
+}
+
+func (b *Bybit) createOrder(side model.SideType, pair string, params map[string]interface{}) (model.Order, error) {
+	id := b.newOrderID()
+	params["category"] = b.category
+	params["symbol"] = pair
+	params["side"] = "Buy"
+	if side == model.SideTypeSell {
+		params["side"] = "Sell"
+	}
+	params["orderLinkId"] = strconv.FormatInt(id, 10)
+
+	var result struct {
+		OrderID string `json:"orderId"`
+	}
+	err := b.request(b.ctx, http.MethodPost, "/v5/order/create", params, true, &result)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	b.mtx.Lock()
+	b.orderIDs[id] = result.OrderID
+	b.mtx.Unlock()
+
+	// the create endpoint returns only the order ID, the execution is fetched from the order
+	order, err := b.Order(pair, id)
+	if err != nil {
+		log.Warnf("bybit: fetch order %d: %v", id, err)
+		price, _ := strconv.ParseFloat(fmt.Sprint(params["price"]), 64)
+		quantity, _ := strconv.ParseFloat(fmt.Sprint(params["qty"]), 64)
+		return model.Order{
+			ExchangeID: id,
+			Pair:       pair,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Side:       side,
+			Type:       model.OrderType(strings.ToUpper(fmt.Sprint(params["orderType"]))),
+			Status:     model.OrderStatusTypeNew,
+			Price:      price,
+			Quantity:   quantity,
+		}, nil
+	}
+
+	return order, nil
+}
+
+func (b *Bybit) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, errors.New("bybit: OCO orders are not supported")
+}
+
+func (b *Bybit) CreateOrderLimit(side model.SideType, pair string, quantity float64, limit float64) (model.Order,
+	error) {
+
+	return b.CreateOrderLimitTIF(side, pair, quantity, limit, model.TimeInForceGTC)
+}
+
+func (b *Bybit) CreateOrderLimitTIF(side model.SideType, pair string, quantity float64, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	return b.createOrderLimit(side, pair, quantity, limit, timeInForce, false)
+}
+
+// CreateOrderLimitReduceOnly creates a GTC limit order that only reduces the position, see
+// exchange.ReduceOnlyCreator. Spot orders have no position and are placed as regular orders
+func (b *Bybit) CreateOrderLimitReduceOnly(side model.SideType, pair string, quantity, limit float64) (model.Order,
+	error) {
+
+	return b.createOrderLimit(side, pair, quantity, limit, model.TimeInForceGTC, true)
+}
+
+func (b *Bybit) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	timeInForce model.TimeInForce, reduceOnly bool) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	params := map[string]interface{}{
+		"orderType":   "Limit",
+		"qty":         b.formatQuantity(pair, quantity),
+		"price":       b.formatPrice(pair, limit),
+		"timeInForce": string(timeInForce),
+	}
+
+	if reduceOnly && b.category != BybitCategorySpot {
+		params["reduceOnly"] = true
+	}
+
+	return b.createOrder(side, pair, params)
+}
+
+func (b *Bybit) CreateOrderMarket(side model.SideType, pair string, quantity float64) (model.Order, error) {
+	return b.createOrderMarket(side, pair, quantity, false)
+}
+
+// CreateOrderMarketReduceOnly creates a market order that only reduces the position, see
+// exchange.ReduceOnlyCreator. Spot orders have no position and are placed as regular orders
+func (b *Bybit) CreateOrderMarketReduceOnly(side model.SideType, pair string, quantity float64) (model.Order, error) {
+	return b.createOrderMarket(side, pair, quantity, true)
+}
+
+func (b *Bybit) createOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	params := map[string]interface{}{
+		"orderType": "Market",
+		"qty":       b.formatQuantity(pair, quantity),
+	}
+
+	if b.category == BybitCategorySpot {
+		params["marketUnit"] = "baseCoin"
+	} else if reduceOnly {
+		params["reduceOnly"] = true
+	}
+
+	return b.createOrder(side, pair, params)
+}
+
+// CreateOrderMarketQuote creates a market order using the amount in quote asset, eg: buy 100 USDT of BTC.
+// Spot orders use the quote amount of the exchange and contracts are converted with the last price
+func (b *Bybit) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	if _, ok := b.assetsInfo[pair]; !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	if quote <= 0 {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidQuantity,
+			Pair:     pair,
+			Quantity: quote,
+		}
+	}
+
+	if b.category == BybitCategorySpot {
+		return b.createOrder(side, pair, map[string]interface{}{
+			"orderType":  "Market",
+			"qty":        b.formatQuoteQuantity(pair, quote),
+			"marketUnit": "quoteCoin",
+		})
+	}
+
+	price, err := b.LastQuote(b.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return b.CreateOrderMarket(side, pair, quote/price)
+}
+
+// CreateOrderStop creates a conditional sell limit order, triggered when the price falls to the limit
+func (b *Bybit) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	params := map[string]interface{}{
+		"orderType":    "Limit",
+		"qty":          b.formatQuantity(pair, quantity),
+		"price":        b.formatPrice(pair, limit),
+		"triggerPrice": b.formatPrice(pair, limit),
+		"timeInForce":  string(model.TimeInForceGTC),
+	}
+
+	if b.category == BybitCategorySpot {
+		params["orderFilter"] = "StopOrder"
+	} else {
+		params["triggerDirection"] = 2 // triggered when the price falls
+	}
+
+	return b.createOrder(model.SideTypeSell, pair, params)
+}
+
+func (b *Bybit) Cancel(order model.Order) error {
+	return b.request(b.ctx, http.MethodPost, "/v5/order/cancel", b.orderParams(order.Pair, order.ExchangeID),
+		true, nil)
+}
+
+// CancelAll cancels all open orders of the given pair and returns the canceled orders
+func (b *Bybit) CancelAll(pair string) ([]model.Order, error) {
+	orders, err := b.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.request(b.ctx, http.MethodPost, "/v5/order/cancel-all",
+		map[string]interface{}{"category": b.category, "symbol": pair}, true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		orders[i].Status = model.OrderStatusTypeCanceled
+		orders[i].UpdatedAt = time.Now()
+	}
+	return orders, nil
+}
+
+// Account returns the balances of the unified account, for linear contracts the open positions are
+// included as balances of the base asset, negative for short positions
+func (b *Bybit) Account() (model.Account, error) {
+	balances := make([]model.Balance, 0)
+	positions := make(map[string]bool)
+
+	if b.category == BybitCategoryLinear {
+		var result struct {
+			List []struct {
+				Symbol   string `json:"symbol"`
+				Side     string `json:"side"`
+				Size     string `json:"size"`
+				Leverage string `json:"leverage"`
+			} `json:"list"`
+		}
+		err := b.request(b.ctx, http.MethodGet, "/v5/position/list",
+			map[string]interface{}{"category": b.category, "settleCoin": "USDT"}, true, &result)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		for _, position := range result.List {
+			size, err := strconv.ParseFloat(position.Size, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+
+			if size == 0 {
+				continue
+			}
+
+			if position.Side == "Sell" {
+				size = -size
+			}
+
+			leverage, _ := strconv.ParseFloat(position.Leverage, 64)
+			asset := b.assetsInfo[position.Symbol].BaseAsset
+			if asset == "" {
+				asset, _ = SplitAssetQuote(position.Symbol)
+			}
+
+			positions[asset] = true
+			balances = append(balances, model.Balance{
+				Asset:    asset,
+				Free:     size,
+				Leverage: leverage,
+			})
+		}
+	}
+
+	var result struct {
+		List []struct {
+			Coin []struct {
+				Coin            string `json:"coin"`
+				WalletBalance   string `json:"walletBalance"`
+				Locked          string `json:"locked"`
+				BorrowAmount    string `json:"borrowAmount"`
+				AccruedInterest string `json:"accruedInterest"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+	err := b.request(b.ctx, http.MethodGet, "/v5/account/wallet-balance",
+		map[string]interface{}{"accountType": "UNIFIED"}, true, &result)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	for _, account := range result.List {
+		for _, coin := range account.Coin {
+			if positions[coin.Coin] {
+				continue
+			}
+
+			wallet, err := strconv.ParseFloat(coin.WalletBalance, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+
+			balance := model.Balance{Asset: coin.Coin}
+			balance.Lock, _ = strconv.ParseFloat(coin.Locked, 64)
+			balance.Borrowed, _ = strconv.ParseFloat(coin.BorrowAmount, 64)
+			balance.Interest, _ = strconv.ParseFloat(coin.AccruedInterest, 64)
+			balance.Free = wallet - balance.Lock
+			balances = append(balances, balance)
+		}
+	}
+
+	return model.Account{Balances: balances}, nil
+}
+
+func (b *Bybit) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	if info, ok := b.assetsInfo[pair]; ok {
+		assetTick, quoteTick = info.BaseAsset, info.QuoteAsset
+	}
+
+	acc, err := b.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
@@ -0,0 +1,191 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func bybitResult(w http.ResponseWriter, result string) {
+	fmt.Fprintf(w, `{"retCode":0,"retMsg":"OK","result":%s}`, result)
+}
+
+func TestBybit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now().Truncate(time.Hour)
+	closedTime := now.Add(-2 * time.Hour).UnixMilli()
+	lastTime := now.Add(-time.Hour).UnixMilli()
+	openTime := now.UnixMilli()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-BAPI-API-KEY") != "" {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			payload := r.URL.RawQuery + string(body)
+			mac := hmac.New(sha256.New, []byte("secret"))
+			require.Equal(t, "10000", r.Header.Get("X-BAPI-RECV-WINDOW"))
+			mac.Write([]byte(r.Header.Get("X-BAPI-TIMESTAMP") + "key" + "10000" + payload))
+			require.Equal(t, hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-BAPI-SIGN"))
+			r.Body = io.NopCloser(strings.NewReader(string(body)))
+		}
+
+		switch r.URL.Path {
+		case "/v5/market/time":
+			bybitResult(w, `{}`)
+		case "/v5/market/instruments-info":
+			require.Equal(t, "spot", r.URL.Query().Get("category"))
+			bybitResult(w, `{"list":[{"symbol":"BTCUSDT","baseCoin":"BTC","quoteCoin":"USDT",
+				"lotSizeFilter":{"basePrecision":"0.000001","quotePrecision":"0.00000001","minOrderQty":"0.000048",
+				"maxOrderQty":"71.73956243","minOrderAmt":"1"},"priceFilter":{"tickSize":"0.01"}}]}`)
+		case "/v5/market/kline":
+			require.Equal(t, "60", r.URL.Query().Get("interval"))
+			bybitResult(w, fmt.Sprintf(`{"list":[["%d","3","6","2","4","30","0"],["%d","2","5","1","3","20","0"],
+				["%d","1","4","0.5","2","10","0"]]}`, openTime, lastTime, closedTime))
+		case "/v5/market/tickers":
+			bybitResult(w, `{"list":[{"symbol":"BTCUSDT","lastPrice":"30000.5"}]}`)
+		case "/v5/order/create":
+			var params map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			if params["qty"] == "1" {
+				fmt.Fprint(w, `{"retCode":170131,"retMsg":"Insufficient balance.","result":{}}`)
+				return
+			}
+			require.Equal(t, "Buy", params["side"])
+			require.Equal(t, "Limit", params["orderType"])
+			require.Equal(t, "0.123", params["qty"])
+			require.Equal(t, "100.5", params["price"])
+			require.NotEmpty(t, params["orderLinkId"])
+			bybitResult(w, `{"orderId":"1510","orderLinkId":"`+params["orderLinkId"].(string)+`"}`)
+		case "/v5/order/realtime":
+			require.Equal(t, "1510", r.URL.Query().Get("orderId"))
+			bybitResult(w, `{"list":[{"orderId":"1510","orderLinkId":"42","symbol":"BTCUSDT","side":"Buy",
+				"orderType":"Limit","orderStatus":"PartiallyFilled","price":"100.5","qty":"0.123",
+				"avgPrice":"100.4","cumExecQty":"0.1","createdTime":"1690000000000","updatedTime":"1690000001000"}]}`)
+		case "/v5/account/wallet-balance":
+			bybitResult(w, `{"list":[{"coin":[{"coin":"BTC","walletBalance":"2","locked":"0.5"},
+				{"coin":"USDT","walletBalance":"100","locked":"0","borrowAmount":"10","accruedInterest":"0.1"}]}]}`)
+		case "/v5/public/spot":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			var subscribe map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&subscribe))
+			require.Equal(t, []interface{}{"kline.60.BTCUSDT"}, subscribe["args"])
+			require.NoError(t, conn.WriteJSON(map[string]interface{}{"op": "subscribe", "success": true}))
+
+			message := fmt.Sprintf(`{"topic":"kline.60.BTCUSDT","data":[{"start":%d,"open":"1","close":"2",
+				"high":"4","low":"0.5","volume":"10","confirm":true,"timestamp":%d}]}`, lastTime, openTime)
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+			_, _, _ = conn.ReadMessage()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	bybit, err := NewBybit(ctx, WithBybitCredentials("key", "secret"), WithBybitRecvWindow(10*time.Second),
+		WithBybitBaseURL(server.URL, "ws"+strings.TrimPrefix(server.URL, "http")+"/v5/public/"))
+	require.NoError(t, err)
+
+	t.Run("assets info", func(t *testing.T) {
+		info := bybit.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.000001, info.StepSize)
+		require.Equal(t, 6, info.BaseAssetPrecision)
+		require.Equal(t, 8, info.QuotePrecision)
+		require.Equal(t, 0.01, info.TickSize)
+		require.Equal(t, 0.000048, info.MinQuantity)
+		require.Equal(t, 1.0, info.MinNotional)
+	})
+
+	t.Run("candles by limit", func(t *testing.T) {
+		candles, err := bybit.CandlesByLimit(ctx, "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, time.UnixMilli(closedTime), candles[0].Time)
+		require.Equal(t, 2.0, candles[0].Close)
+		require.Equal(t, time.UnixMilli(lastTime), candles[1].Time)
+		require.Equal(t, 20.0, candles[1].Volume)
+
+		_, err = bybit.CandlesByLimit(ctx, "BTCUSDT", "8h", 2)
+		require.ErrorIs(t, err, ErrInvalidTimeframe)
+	})
+
+	t.Run("last quote", func(t *testing.T) {
+		price, err := bybit.LastQuote(ctx, "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 30000.5, price)
+	})
+
+	t.Run("create order", func(t *testing.T) {
+		order, err := bybit.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.123, 100.5)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), order.ExchangeID)
+		require.Equal(t, model.SideTypeBuy, order.Side)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.Equal(t, 100.4, order.Price)
+		require.Equal(t, 0.1, order.Quantity)
+
+		_, err = bybit.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 100.5)
+		require.Error(t, err)
+		require.True(t, IsInsufficientFunds(err))
+
+		_, err = bybit.CreateOrderLimit(model.SideTypeBuy, "ETHUSDT", 1, 100.5)
+		require.ErrorIs(t, err, ErrInvalidAsset)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		account, err := bybit.Account()
+		require.NoError(t, err)
+
+		btc, usdt := account.Balance("BTC", "USDT")
+		require.Equal(t, 1.5, btc.Free)
+		require.Equal(t, 0.5, btc.Lock)
+		require.Equal(t, 100.0, usdt.Free)
+		require.Equal(t, 10.0, usdt.Borrowed)
+		require.Equal(t, 0.1, usdt.Interest)
+
+		asset, quote, err := bybit.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 2.0, asset)
+		require.Equal(t, 100.0, quote)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		ccandle, _ := bybit.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		select {
+		case candle := <-ccandle:
+			require.Equal(t, "BTCUSDT", candle.Pair)
+			require.Equal(t, time.UnixMilli(lastTime), candle.Time)
+			require.Equal(t, time.UnixMilli(openTime), candle.UpdatedAt)
+			require.Equal(t, 2.0, candle.Close)
+			require.True(t, candle.Complete)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "candle not received")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package exchange
+
+import (
+	"context"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+const (
+	// DefaultMaxClockSkew is the difference between the local clock and the server time that logs a warning.
+	// Binance rejects signed requests with timestamps outside the receive window (error -1021)
+	DefaultMaxClockSkew = time.Second
+	// DefaultClockSyncInterval is the interval between the synchronizations of the server time offset
+	DefaultClockSyncInterval = time.Hour
+)
+
+// clockSync keeps the offset between the local clock and the server time of an exchange,
+// applied to the timestamp of signed requests
+type clockSync struct {
+	interval   time.Duration
+	maxSkew    time.Duration
+	serverTime func(ctx context.Context) (int64, error)
+	setOffset  func(offset time.Duration)
+}
+
+func newClockSync() *clockSync {
+	return &clockSync{
+		interval: DefaultClockSyncInterval,
+		maxSkew:  DefaultMaxClockSkew,
+	}
+}
+
+// measureClockSkew returns the difference between the local clock and the server time, positive when the
+// local clock is ahead, and the request latency. The server time is compared with the middle of the request
+func measureClockSkew(ctx context.Context, serverTime func(ctx context.Context) (int64, error)) (skew,
+	latency time.Duration, err error) {
+
+	start := time.Now()
+	server, err := serverTime(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	latency = time.Since(start)
+	local := start.Add(latency / 2)
+	return local.Sub(time.UnixMilli(server)), latency, nil
+}
+
+// sync measures the clock skew and updates the time offset of the requests
+func (c *clockSync) sync(ctx context.Context) error {
+	skew, latency, err := measureClockSkew(ctx, c.serverTime)
+	if err != nil {
+		return err
+	}
+
+	c.setOffset(skew)
+
+	if skew > c.maxSkew || skew < -c.maxSkew {
+		log.Warnf("[CLOCK] local clock differs %s from the exchange server (latency %s), "+
+			"signed requests are adjusted to the server time. Check the system time synchronization (NTP)",
+			skew.Round(time.Millisecond), latency.Round(time.Millisecond))
+		return nil
+	}
+
+	log.Debugf("[CLOCK] server time offset %s (latency %s)", skew.Round(time.Millisecond),
+		latency.Round(time.Millisecond))
+	return nil
+}
+
+// start synchronizes the clock and keeps it synchronized in background until the context is done
+func (c *clockSync) start(ctx context.Context) error {
+	err := c.sync(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c.interval <= 0 {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.sync(ctx); err != nil {
+					log.Warnf("[CLOCK] server time sync fail: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
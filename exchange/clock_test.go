@@ -0,0 +1,49 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockSync(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("local clock ahead", func(t *testing.T) {
+		var offset time.Duration
+		clock := newClockSync()
+		clock.serverTime = func(ctx context.Context) (int64, error) {
+			return time.Now().Add(-3 * time.Second).UnixMilli(), nil
+		}
+		clock.setOffset = func(value time.Duration) {
+			offset = value
+		}
+
+		require.NoError(t, clock.sync(ctx))
+		require.InDelta(t, 3*time.Second, offset, float64(50*time.Millisecond))
+	})
+
+	t.Run("local clock behind", func(t *testing.T) {
+		skew, latency, err := measureClockSkew(ctx, func(ctx context.Context) (int64, error) {
+			time.Sleep(10 * time.Millisecond)
+			return time.Now().Add(2 * time.Second).UnixMilli(), nil
+		})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, latency, 10*time.Millisecond)
+		require.InDelta(t, -2*time.Second, skew, float64(50*time.Millisecond))
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		clock := newClockSync()
+		clock.serverTime = func(ctx context.Context) (int64, error) {
+			return 0, errors.New("timeout")
+		}
+		clock.setOffset = func(time.Duration) {
+			require.Fail(t, "offset must not be updated")
+		}
+		require.Error(t, clock.start(ctx))
+	})
+}
@@ -0,0 +1,123 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+type rate struct {
+	value     float64
+	updatedAt time.Time
+}
+
+// Converter converts balances of different assets to a single base currency, using the last
+// closed candle of the pair between the asset and the base currency (e.g. BTCUSDT or USDTBRL)
+type Converter struct {
+	mtx       sync.Mutex
+	feeder    service.Feeder
+	base      string
+	timeframe string
+	ttl       time.Duration
+	rates     map[string]rate
+}
+
+type ConverterOption func(*Converter)
+
+// WithConverterCacheTTL sets the duration that a conversion rate is cached. Default: 1 minute
+func WithConverterCacheTTL(ttl time.Duration) ConverterOption {
+	return func(c *Converter) {
+		c.ttl = ttl
+	}
+}
+
+func NewConverter(feeder service.Feeder, base string, options ...ConverterOption) *Converter {
+	converter := &Converter{
+		feeder:    feeder,
+		base:      strings.ToUpper(base),
+		timeframe: "1m",
+		ttl:       time.Minute,
+		rates:     make(map[string]rate),
+	}
+
+	for _, option := range options {
+		option(converter)
+	}
+
+	return converter
+}
+
+// Base returns the base currency of the conversions
+func (c *Converter) Base() string {
+	return c.base
+}
+
+func (c *Converter) lastClose(ctx context.Context, pair string) (float64, error) {
+	candles, err := c.feeder.CandlesByLimit(ctx, pair, c.timeframe, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(candles) == 0 || candles[len(candles)-1].Close <= 0 {
+		return 0, fmt.Errorf("converter: no price for %s", pair)
+	}
+	return candles[len(candles)-1].Close, nil
+}
+
+// Rate returns the price of one unit of the asset in the base currency
+func (c *Converter) Rate(ctx context.Context, asset string) (float64, error) {
+	asset = strings.ToUpper(asset)
+	if asset == c.base {
+		return 1, nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if cached, ok := c.rates[asset]; ok && time.Since(cached.updatedAt) < c.ttl {
+		return cached.value, nil
+	}
+
+	value, err := c.lastClose(ctx, asset+c.base)
+	if err != nil {
+		// try the inverse pair, e.g. USDTBRL for BRL with USDT base
+		inverse, inverseErr := c.lastClose(ctx, c.base+asset)
+		if inverseErr != nil {
+			return 0, fmt.Errorf("converter: rate not available for %s/%s: %w", asset, c.base, err)
+		}
+		value = 1 / inverse
+	}
+
+	c.rates[asset] = rate{value: value, updatedAt: time.Now()}
+	return value, nil
+}
+
+// Convert returns the value of the amount of asset in the base currency
+func (c *Converter) Convert(ctx context.Context, asset string, amount float64) (float64, error) {
+	if amount == 0 {
+		return 0, nil
+	}
+
+	value, err := c.Rate(ctx, asset)
+	if err != nil {
+		return 0, err
+	}
+	return amount * value, nil
+}
+
+// Equity returns the total value of the account balances in the base currency
+func (c *Converter) Equity(ctx context.Context, account model.Account) (float64, error) {
+	total := 0.0
+	for _, balance := range account.Balances {
+		value, err := c.Convert(ctx, balance.Asset, balance.Free+balance.Lock)
+		if err != nil {
+			return 0, err
+		}
+		total += value
+	}
+	return total, nil
+}
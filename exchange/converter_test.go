@@ -0,0 +1,51 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/testdata/mocks"
+)
+
+func TestConverter(t *testing.T) {
+	ctx := context.Background()
+	feeder := mocks.NewFeeder(t)
+	feeder.EXPECT().CandlesByLimit(ctx, "BTCUSDT", "1m", 1).
+		Return([]model.Candle{{Pair: "BTCUSDT", Close: 20000}}, nil).Once()
+	feeder.EXPECT().CandlesByLimit(ctx, "BRLUSDT", "1m", 1).Return(nil, errors.New("invalid symbol")).Once()
+	feeder.EXPECT().CandlesByLimit(ctx, "USDTBRL", "1m", 1).
+		Return([]model.Candle{{Pair: "USDTBRL", Close: 5}}, nil).Once()
+
+	converter := NewConverter(feeder, "usdt", WithConverterCacheTTL(time.Hour))
+
+	t.Run("rates", func(t *testing.T) {
+		rate, err := converter.Rate(ctx, "USDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, rate)
+
+		rate, err = converter.Rate(ctx, "BTC")
+		require.NoError(t, err)
+		require.Equal(t, 20000.0, rate)
+
+		// inverse pair
+		rate, err = converter.Rate(ctx, "BRL")
+		require.NoError(t, err)
+		require.Equal(t, 0.2, rate)
+	})
+
+	t.Run("equity from cache", func(t *testing.T) {
+		equity, err := converter.Equity(ctx, model.Account{Balances: []model.Balance{
+			{Asset: "USDT", Free: 100},
+			{Asset: "BTC", Free: 0.5, Lock: 0.5},
+			{Asset: "BRL", Free: 50},
+			{Asset: "ETH"},
+		}})
+		require.NoError(t, err)
+		require.Equal(t, 20110.0, equity)
+	})
+}
@@ -5,15 +5,18 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/samber/lo"
 	"github.com/xhit/go-str2duration/v2"
 
 	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
 )
 
 var ErrInsufficientData = errors.New("insufficient data")
@@ -23,11 +26,30 @@ type PairFeed struct {
 	File       string
 	Timeframe  string
 	HeikinAshi bool
+	// Reader is the source of the CSV data, used instead of File when defined, e.g. data loaded from an
+	// object storage or an embedded file
+	Reader io.Reader
+	// TimeMode is the timestamp convention of the file, candles with the close time are converted
+	// to the open time used by ninjabot. Default: model.CandleTimeOpen
+	TimeMode model.CandleTimeMode
+	// SkipInvalidRows skips the rows that cannot be parsed, listing them in the load report,
+	// instead of failing
+	SkipInvalidRows bool
+	// LogReport logs the load report of the file, with the date range, gaps and invalid rows
+	LogReport bool
+	// WeekStart is the open day of the resampled weekly candles, at 00:00 UTC. Default: time.Sunday,
+	// use time.Monday to match the weekly candles of Binance and Bybit
+	WeekStart time.Weekday
 }
 
 type CSVFeed struct {
 	Feeds               map[string]PairFeed
 	CandlePairTimeFrame map[string][]model.Candle
+	// Reports are the load reports of the CSV files by pair and timeframe, see Report
+	Reports map[string]CSVReport
+
+	timeframes []string
+	timeMode   model.CandleTimeMode
 }
 
 func (c CSVFeed) AssetsInfo(pair string) model.AssetInfo {
@@ -64,81 +86,161 @@ func parseHeaders(headers []string) (index map[string]int, additional []string,
 	return headerMap, additional, true
 }
 
-// NewCSVFeed creates a new data feed from CSV files and resample
-func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
-	csvFeed := &CSVFeed{
-		Feeds:               make(map[string]PairFeed),
-		CandlePairTimeFrame: make(map[string][]model.Candle),
+// source returns the name of the feed source used in the errors
+func (f PairFeed) source() string {
+	if f.Reader != nil {
+		return fmt.Sprintf("%s reader", f.Pair)
 	}
+	return f.File
+}
 
-	for _, feed := range feeds {
-		csvFeed.Feeds[feed.Pair] = feed
-
-		csvFile, err := os.Open(feed.File)
+// readLines reads the rows of the feed source, the reader has priority over the file
+func (f PairFeed) readLines() ([][]string, error) {
+	source := f.Reader
+	if source == nil {
+		file, err := os.Open(f.File)
 		if err != nil {
 			return nil, err
 		}
+		defer file.Close()
+		source = file
+	}
 
-		csvLines, err := csv.NewReader(csvFile).ReadAll()
-		if err != nil {
-			return nil, err
-		}
+	reader := csv.NewReader(source)
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
 
-		var candles []model.Candle
-		ha := model.NewHeikinAshi()
+// parseCSVCandle parses a row of the CSV file, the additional columns are loaded in the candle metadata
+func parseCSVCandle(line []string, headerMap map[string]int, additionalHeaders []string, feed PairFeed,
+	interval time.Duration) (model.Candle, error) {
 
-		// map each header label with its index
-		headerMap, additionalHeaders, hasCustomHeaders := parseHeaders(csvLines[0])
-		if hasCustomHeaders {
-			csvLines = csvLines[1:]
+	for _, index := range headerMap {
+		if index >= len(line) {
+			return model.Candle{}, fmt.Errorf("expected %d fields, found %d", len(headerMap), len(line))
 		}
+	}
 
-		for _, line := range csvLines {
-			timestamp, err := strconv.Atoi(line[headerMap["time"]])
-			if err != nil {
-				return nil, err
-			}
+	timestamp, err := strconv.Atoi(line[headerMap["time"]])
+	if err != nil {
+		return model.Candle{}, err
+	}
 
-			candle := model.Candle{
-				Time:      time.Unix(int64(timestamp), 0).UTC(),
-				UpdatedAt: time.Unix(int64(timestamp), 0).UTC(),
-				Pair:      feed.Pair,
-				Complete:  true,
-			}
+	openTime := feed.TimeMode.OpenTime(time.Unix(int64(timestamp), 0).UTC(), interval)
+	candle := model.Candle{
+		Time:      openTime,
+		UpdatedAt: openTime,
+		Pair:      feed.Pair,
+		Complete:  true,
+	}
 
-			candle.Open, err = strconv.ParseFloat(line[headerMap["open"]], 64)
-			if err != nil {
-				return nil, err
-			}
+	candle.Open, err = strconv.ParseFloat(line[headerMap["open"]], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
 
-			candle.Close, err = strconv.ParseFloat(line[headerMap["close"]], 64)
-			if err != nil {
-				return nil, err
-			}
+	candle.Close, err = strconv.ParseFloat(line[headerMap["close"]], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
 
-			candle.Low, err = strconv.ParseFloat(line[headerMap["low"]], 64)
-			if err != nil {
-				return nil, err
+	candle.Low, err = strconv.ParseFloat(line[headerMap["low"]], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	candle.High, err = strconv.ParseFloat(line[headerMap["high"]], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	candle.Volume, err = strconv.ParseFloat(line[headerMap["volume"]], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	if len(additionalHeaders) > 0 {
+		candle.Metadata = make(map[string]float64)
+		for _, header := range additionalHeaders {
+			// sparse columns, e.g. the funding rate settled every 8 hours, are NaN in the rows without value
+			value := strings.TrimSpace(line[headerMap[header]])
+			if value == "" {
+				candle.Metadata[header] = math.NaN()
+				continue
 			}
 
-			candle.High, err = strconv.ParseFloat(line[headerMap["high"]], 64)
+			candle.Metadata[header], err = strconv.ParseFloat(value, 64)
 			if err != nil {
-				return nil, err
+				return model.Candle{}, err
 			}
+		}
+	}
 
-			candle.Volume, err = strconv.ParseFloat(line[headerMap["volume"]], 64)
-			if err != nil {
+	return candle, nil
+}
+
+// NewCSVFeed creates a new data feed from CSV files and resample. The load report of each file, with the
+// date range, gaps and invalid rows, is available in CSVFeed.Report. Empty files, or files with only the
+// header, are loaded without candles
+func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
+	csvFeed := &CSVFeed{
+		Feeds:               make(map[string]PairFeed),
+		CandlePairTimeFrame: make(map[string][]model.Candle),
+		Reports:             make(map[string]CSVReport),
+		timeframes:          []string{targetTimeframe},
+	}
+
+	for _, feed := range feeds {
+		if _, err := str2duration.ParseDuration(feed.Timeframe); err != nil {
+			return nil, fmt.Errorf("%w: %q in %s feed", ErrInvalidTimeframe, feed.Timeframe, feed.Pair)
+		}
+
+		if feed.TimeMode != "" && feed.TimeMode != model.CandleTimeOpen && feed.TimeMode != model.CandleTimeClose {
+			return nil, fmt.Errorf("invalid time mode %q in %s feed", feed.TimeMode, feed.Pair)
+		}
+
+		if feed.Timeframe != targetTimeframe {
+			if err := ValidateTimeframe(targetTimeframe, ResampleTimeframes); err != nil {
 				return nil, err
 			}
+			csvFeed.timeframes = append(csvFeed.timeframes, feed.Timeframe)
+		}
+	}
+
+	for _, feed := range feeds {
+		csvFeed.Feeds[feed.Pair] = feed
+
+		csvLines, err := feed.readLines()
+		if err != nil {
+			return nil, err
+		}
+
+		var candles []model.Candle
+		var invalidRows []CSVInvalidRow
+		ha := model.NewHeikinAshi()
+		interval, _ := str2duration.ParseDuration(feed.Timeframe)
 
+		// map each header label with its index
+		var headerMap map[string]int
+		var additionalHeaders []string
+		firstLine := 1
+		if len(csvLines) > 0 {
+			var hasCustomHeaders bool
+			headerMap, additionalHeaders, hasCustomHeaders = parseHeaders(csvLines[0])
 			if hasCustomHeaders {
-				candle.Metadata = make(map[string]float64)
-				for _, header := range additionalHeaders {
-					candle.Metadata[header], err = strconv.ParseFloat(line[headerMap[header]], 64)
-					if err != nil {
-						return nil, err
-					}
+				csvLines = csvLines[1:]
+				firstLine = 2
+			}
+		}
+
+		for i, line := range csvLines {
+			candle, err := parseCSVCandle(line, headerMap, additionalHeaders, feed, interval)
+			if err != nil {
+				if !feed.SkipInvalidRows {
+					return nil, fmt.Errorf("%s line %d: %w", feed.source(), firstLine+i, err)
 				}
+				invalidRows = append(invalidRows, CSVInvalidRow{Line: firstLine + i, Err: err})
+				continue
 			}
 
 			if feed.HeikinAshi {
@@ -148,6 +250,12 @@ func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
 			candles = append(candles, candle)
 		}
 
+		report := newCSVReport(feed, interval, candles, invalidRows)
+		csvFeed.Reports[csvFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)] = report
+		if feed.LogReport {
+			log.Info("[CSV] ", report)
+		}
+
 		csvFeed.CandlePairTimeFrame[csvFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)] = candles
 
 		err = csvFeed.resample(feed.Pair, feed.Timeframe, targetTimeframe)
@@ -159,6 +267,49 @@ func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
 	return csvFeed, nil
 }
 
+// NewCSVFeedFromReader creates a data feed of a pair from CSV data in the given timeframe, read from any source
+// (e.g. HTTP or S3 downloads, embedded test fixtures). Multiple pairs or resampling are supported by NewCSVFeed
+// with PairFeed.Reader
+func NewCSVFeedFromReader(reader io.Reader, pair, timeframe string) (*CSVFeed, error) {
+	return NewCSVFeed(timeframe, PairFeed{Pair: pair, Timeframe: timeframe, Reader: reader})
+}
+
+// Timeframes returns the timeframes loaded from the CSV files, the source and the resampled timeframe
+func (c CSVFeed) Timeframes() []string {
+	return lo.Uniq(c.timeframes)
+}
+
+// Resample creates the candles of additional timeframes from the source CSV files, e.g. the
+// timeframes of a multi timeframe strategy
+func (c *CSVFeed) Resample(timeframes ...string) error {
+	for _, timeframe := range timeframes {
+		if err := ValidateTimeframe(timeframe, ResampleTimeframes); err != nil {
+			return err
+		}
+
+		for _, feed := range c.Feeds {
+			if err := c.resample(feed.Pair, feed.Timeframe, timeframe); err != nil {
+				return err
+			}
+		}
+		c.timeframes = append(c.timeframes, timeframe)
+	}
+	return nil
+}
+
+// SetCandleTimeMode sets the timestamp convention of the candles delivered by the feed, the open time by default.
+// The candles are loaded and resampled with the open time, see PairFeed.TimeMode for the convention of the files
+func (c *CSVFeed) SetCandleTimeMode(mode model.CandleTimeMode) error {
+	c.timeMode = mode
+	return nil
+}
+
+// Report returns the load report of the CSV file of a pair and timeframe
+func (c CSVFeed) Report(pair, timeframe string) (CSVReport, bool) {
+	report, ok := c.Reports[c.feedTimeframeKey(pair, timeframe)]
+	return report, ok
+}
+
 func (c CSVFeed) feedTimeframeKey(pair, timeframe string) string {
 	return fmt.Sprintf("%s--%s", pair, timeframe)
 }
@@ -167,6 +318,10 @@ func (c CSVFeed) LastQuote(_ context.Context, _ string) (float64, error) {
 	return 0, errors.New("invalid operation")
 }
 
+func (c CSVFeed) LastPrice(_ string) (float64, error) {
+	return 0, errors.New("invalid operation")
+}
+
 func (c *CSVFeed) Limit(duration time.Duration) *CSVFeed {
 	for pair, candles := range c.CandlePairTimeFrame {
 		start := candles[len(candles)-1].Time.Add(-duration)
@@ -177,18 +332,44 @@ func (c *CSVFeed) Limit(duration time.Duration) *CSVFeed {
 	return c
 }
 
-func isFistCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string) (bool, error) {
+// candlePeriodStart returns the open time of the target timeframe candle that contains t, aligned in UTC as
+// the exchanges do: intraday and daily timeframes are multiples of the timeframe since the Unix epoch (e.g. top
+// of the hour, 00:00 UTC), weekly candles open at 00:00 UTC of the week start day and monthly candles on the
+// first day of the month
+func candlePeriodStart(t time.Time, timeframe string, weekStart time.Weekday) (time.Time, error) {
+	t = t.UTC()
+	switch timeframe {
+	case "1M":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	case "1w":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) - int(weekStart) + 7) % 7
+		return day.AddDate(0, 0, -offset), nil
+	}
+
+	duration, err := str2duration.ParseDuration(timeframe)
+	if err != nil || !lo.Contains(ResampleTimeframes, timeframe) {
+		return time.Time{}, fmt.Errorf("invalid timeframe: %s", timeframe)
+	}
+
+	seconds := int64(duration / time.Second)
+	return time.Unix(t.Unix()-t.Unix()%seconds, 0).UTC(), nil
+}
+
+func isFistCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string, weekStart time.Weekday) (bool, error) {
+	if fromTimeframe == targetTimeframe {
+		return true, nil
+	}
+
 	fromDuration, err := str2duration.ParseDuration(fromTimeframe)
 	if err != nil {
 		return false, err
 	}
 
-	prev := t.Add(-fromDuration).UTC()
-
-	return isLastCandlePeriod(prev, fromTimeframe, targetTimeframe)
+	return isNewCandlePeriod(t.Add(-fromDuration), t, targetTimeframe, weekStart)
 }
 
-func isLastCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string) (bool, error) {
+func isLastCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string, weekStart time.Weekday) (bool, error) {
 	if fromTimeframe == targetTimeframe {
 		return true, nil
 	}
@@ -198,44 +379,46 @@ func isLastCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string) (boo
 		return false, err
 	}
 
-	next := t.Add(fromDuration).UTC()
-
-	switch targetTimeframe {
-	case "1m":
-		return next.Second()%60 == 0, nil
-	case "5m":
-		return next.Minute()%5 == 0, nil
-	case "10m":
-		return next.Minute()%10 == 0, nil
-	case "15m":
-		return next.Minute()%15 == 0, nil
-	case "30m":
-		return next.Minute()%30 == 0, nil
-	case "1h":
-		return next.Minute()%60 == 0, nil
-	case "2h":
-		return next.Minute() == 0 && next.Hour()%2 == 0, nil
-	case "4h":
-		return next.Minute() == 0 && next.Hour()%4 == 0, nil
-	case "12h":
-		return next.Minute() == 0 && next.Hour()%12 == 0, nil
-	case "1d":
-		return next.Minute() == 0 && next.Hour()%24 == 0, nil
-	case "1w":
-		return next.Minute() == 0 && next.Hour()%24 == 0 && next.Weekday() == time.Sunday, nil
+	return isNewCandlePeriod(t, t.Add(fromDuration), targetTimeframe, weekStart)
+}
+
+// isNewCandlePeriod returns true if the times are in different candles of the target timeframe
+func isNewCandlePeriod(prev, next time.Time, timeframe string, weekStart time.Weekday) (bool, error) {
+	prevStart, err := candlePeriodStart(prev, timeframe, weekStart)
+	if err != nil {
+		return false, err
+	}
+
+	nextStart, err := candlePeriodStart(next, timeframe, weekStart)
+	if err != nil {
+		return false, err
 	}
 
-	return false, fmt.Errorf("invalid timeframe: %s", targetTimeframe)
+	return !prevStart.Equal(nextStart), nil
 }
 
+// resample aggregates the source candles in the target timeframe windows, aligned in UTC. The candles of a
+// window are partial (Complete=false) until its last source candle, a leading partial window is skipped and a
+// gap in the source data closes the window before it, instead of merging it with the next window
 func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error {
 	sourceKey := c.feedTimeframeKey(pair, sourceTimeframe)
 	targetKey := c.feedTimeframeKey(pair, targetTimeframe)
+	weekStart := c.Feeds[pair].WeekStart
+	source := c.CandlePairTimeFrame[sourceKey]
+
+	if sourceTimeframe == targetTimeframe {
+		candles := make([]model.Candle, len(source))
+		for i, candle := range source {
+			candle.Complete = true
+			candles[i] = candle
+		}
+		c.CandlePairTimeFrame[targetKey] = candles
+		return nil
+	}
 
 	var i int
-	for ; i < len(c.CandlePairTimeFrame[sourceKey]); i++ {
-		if ok, err := isFistCandlePeriod(c.CandlePairTimeFrame[sourceKey][i].Time, sourceTimeframe,
-			targetTimeframe); err != nil {
+	for ; i < len(source); i++ {
+		if ok, err := isFistCandlePeriod(source[i].Time, sourceTimeframe, targetTimeframe, weekStart); err != nil {
 			return err
 		} else if ok {
 			break
@@ -243,16 +426,26 @@ func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error
 	}
 
 	candles := make([]model.Candle, 0)
-	for ; i < len(c.CandlePairTimeFrame[sourceKey]); i++ {
-		candle := c.CandlePairTimeFrame[sourceKey][i]
-		if last, err := isLastCandlePeriod(candle.Time, sourceTimeframe, targetTimeframe); err != nil {
+	for ; i < len(source); i++ {
+		candle := source[i]
+		start, err := candlePeriodStart(candle.Time, targetTimeframe, weekStart)
+		if err != nil {
 			return err
-		} else if last {
-			candle.Complete = true
-		} else {
-			candle.Complete = false
 		}
 
+		last, err := isLastCandlePeriod(candle.Time, sourceTimeframe, targetTimeframe, weekStart)
+		if err != nil {
+			return err
+		}
+
+		// the next source candle opens a later window after a gap
+		if !last && i+1 < len(source) {
+			if last, err = isNewCandlePeriod(candle.Time, source[i+1].Time, targetTimeframe, weekStart); err != nil {
+				return err
+			}
+		}
+		candle.Complete = last
+
 		lastIndex := len(candles) - 1
 		if lastIndex >= 0 && !candles[lastIndex].Complete {
 			candle.Time = candles[lastIndex].Time
@@ -260,12 +453,14 @@ func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error
 			candle.High = math.Max(candles[lastIndex].High, candle.High)
 			candle.Low = math.Min(candles[lastIndex].Low, candle.Low)
 			candle.Volume += candles[lastIndex].Volume
+		} else {
+			candle.Time = start
 		}
 		candles = append(candles, candle)
 	}
 
 	// remove last candle if not complete
-	if !candles[len(candles)-1].Complete {
+	if len(candles) > 0 && !candles[len(candles)-1].Complete {
 		candles = candles[:len(candles)-1]
 	}
 
@@ -280,6 +475,7 @@ func (c CSVFeed) CandlesByPeriod(_ context.Context, pair, timeframe string,
 	key := c.feedTimeframeKey(pair, timeframe)
 	candles := make([]model.Candle, 0)
 	for _, candle := range c.CandlePairTimeFrame[key] {
+		candle = candleTimestamp(c.timeMode, timeframe, candle)
 		if candle.Time.Before(start) || candle.Time.After(end) {
 			continue
 		}
@@ -294,8 +490,9 @@ func (c *CSVFeed) CandlesByLimit(_ context.Context, pair, timeframe string, limi
 	if len(c.CandlePairTimeFrame[key]) < limit {
 		return nil, fmt.Errorf("%w: %s", ErrInsufficientData, pair)
 	}
-	result, c.CandlePairTimeFrame[key] = c.CandlePairTimeFrame[key][:limit], c.CandlePairTimeFrame[key][limit:]
-	return result, nil
+	result = append(result, c.CandlePairTimeFrame[key][:limit]...)
+	c.CandlePairTimeFrame[key] = c.CandlePairTimeFrame[key][limit:]
+	return candleTimestamps(c.timeMode, timeframe, result), nil
 }
 
 func (c CSVFeed) CandlesSubscription(_ context.Context, pair, timeframe string) (chan model.Candle, chan error) {
@@ -304,10 +501,121 @@ func (c CSVFeed) CandlesSubscription(_ context.Context, pair, timeframe string)
 	key := c.feedTimeframeKey(pair, timeframe)
 	go func() {
 		for _, candle := range c.CandlePairTimeFrame[key] {
-			ccandle <- candle
+			ccandle <- candleTimestamp(c.timeMode, timeframe, candle)
 		}
 		close(ccandle)
 		close(cerr)
 	}()
 	return ccandle, cerr
 }
+
+// CandlesFanOut streams the candles of a pair in multiple timeframes from a single pass over the source candles,
+// e.g. 5m and 15m streams of a 1m file for different subscribers. The timeframes not loaded yet are resampled from
+// the source candles, and each timeframe is delivered on its own channel, with the partial candles of the
+// resampled timeframes as in CandlesSubscription. The channels are synchronized by the source candles, the candles
+// updated by a source candle are sent in the order of the timeframes, so all channels must be consumed
+func (c *CSVFeed) CandlesFanOut(ctx context.Context, pair string,
+	timeframes ...string) (map[string]chan model.Candle, chan error) {
+
+	channels := make(map[string]chan model.Candle, len(timeframes))
+	for _, timeframe := range timeframes {
+		channels[timeframe] = make(chan model.Candle)
+	}
+	cerr := make(chan error)
+
+	// resample before streaming, the candles of the feed are not changed by the stream
+	feed, ok := c.Feeds[pair]
+	var err error
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrInsufficientData, pair)
+	}
+	for _, timeframe := range timeframes {
+		if err != nil {
+			break
+		}
+		if _, ok := c.CandlePairTimeFrame[c.feedTimeframeKey(pair, timeframe)]; ok {
+			continue
+		}
+		if err = ValidateTimeframe(timeframe, ResampleTimeframes); err == nil {
+			err = c.resample(pair, feed.Timeframe, timeframe)
+			c.timeframes = append(c.timeframes, timeframe)
+		}
+	}
+
+	streams := make(map[string][]model.Candle, len(timeframes))
+	for _, timeframe := range timeframes {
+		streams[timeframe] = c.CandlePairTimeFrame[c.feedTimeframeKey(pair, timeframe)]
+	}
+	source := c.CandlePairTimeFrame[c.feedTimeframeKey(pair, feed.Timeframe)]
+
+	go func() {
+		defer func() {
+			for _, channel := range channels {
+				close(channel)
+			}
+			close(cerr)
+		}()
+
+		if err != nil {
+			cerr <- err
+			return
+		}
+
+		send := func(channel chan model.Candle, candle model.Candle) bool {
+			select {
+			case channel <- candle:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// the candles are updated by the source candle with the same update time
+		next := make(map[string]int, len(timeframes))
+		for _, candle := range source {
+			for _, timeframe := range timeframes {
+				candles := streams[timeframe]
+				for ; next[timeframe] < len(candles); next[timeframe]++ {
+					if candles[next[timeframe]].UpdatedAt.After(candle.UpdatedAt) {
+						break
+					}
+					if !send(channels[timeframe], candleTimestamp(c.timeMode, timeframe, candles[next[timeframe]])) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return channels, cerr
+}
+
+// TradesSubscription synthesizes the trades of the pair from the source candles,
+// see model.Candle.ToTrades for the price path
+func (c CSVFeed) TradesSubscription(_ context.Context, pair string) (chan model.Trade, chan error) {
+	ctrade := make(chan model.Trade)
+	cerr := make(chan error)
+	go func() {
+		defer close(cerr)
+		defer close(ctrade)
+
+		feed, ok := c.Feeds[pair]
+		if !ok {
+			cerr <- fmt.Errorf("%w: %s", ErrInsufficientData, pair)
+			return
+		}
+
+		duration, err := str2duration.ParseDuration(feed.Timeframe)
+		if err != nil {
+			cerr <- err
+			return
+		}
+
+		for _, candle := range c.CandlePairTimeFrame[c.feedTimeframeKey(pair, feed.Timeframe)] {
+			for _, trade := range candle.ToTrades(duration) {
+				ctrade <- trade
+			}
+		}
+	}()
+	return ctrade, cerr
+}
@@ -3,11 +3,19 @@ package exchange
 import (
 	"context"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
 )
 
 func TestNewCSVFeed(t *testing.T) {
@@ -47,6 +55,175 @@ func TestNewCSVFeed(t *testing.T) {
 		require.Equal(t, 86310.8, candle.Volume)
 		require.Equal(t, 1.1, candle.Metadata["lsr"])
 	})
+
+	t.Run("close time mode", func(t *testing.T) {
+		feed, err := NewCSVFeed("1d", PairFeed{
+			Timeframe: "1d",
+			Pair:      "BTCUSDT",
+			File:      "../testdata/btc-1d.csv",
+			TimeMode:  model.CandleTimeClose,
+		})
+		require.NoError(t, err)
+
+		candle := feed.CandlePairTimeFrame["BTCUSDT--1d"][0]
+		require.Equal(t, "2021-04-25 00:00:00", candle.Time.UTC().Format("2006-01-02 15:04:05"))
+		require.Equal(t, 49066.76, candle.Open)
+	})
+
+	t.Run("close time output", func(t *testing.T) {
+		feed, err := NewCSVFeed("1d", PairFeed{
+			Timeframe: "1d",
+			Pair:      "BTCUSDT",
+			File:      "../testdata/btc-1d.csv",
+		})
+		require.NoError(t, err)
+		require.NoError(t, feed.SetCandleTimeMode(model.CandleTimeClose))
+
+		// the candles are kept with the open time and delivered with the close time
+		open := feed.CandlePairTimeFrame["BTCUSDT--1d"][0].Time
+		candles, err := feed.CandlesByPeriod(context.Background(), "BTCUSDT", "1d", open, open.Add(24*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, open.Add(24*time.Hour), candles[0].Time)
+
+		candles, err = feed.CandlesByLimit(context.Background(), "BTCUSDT", "1d", 1)
+		require.NoError(t, err)
+		require.Equal(t, open.Add(24*time.Hour), candles[0].Time)
+
+		ccandle, _ := feed.CandlesSubscription(context.Background(), "BTCUSDT", "1d")
+		var streamed []model.Candle
+		for candle := range ccandle {
+			streamed = append(streamed, candle)
+		}
+		require.Equal(t, open.Add(48*time.Hour), streamed[0].Time)
+	})
+
+	t.Run("invalid time mode", func(t *testing.T) {
+		_, err := NewCSVFeed("1d", PairFeed{
+			Timeframe: "1d",
+			Pair:      "BTCUSDT",
+			File:      "../testdata/btc-1d.csv",
+			TimeMode:  "middle",
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestNewCSVFeed_Report(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "btc-1h.csv")
+	content := strings.Join([]string{
+		"time,open,close,low,high,volume",
+		"1620000000,1,2,0.5,3,10",
+		"1620003600,2,3,1,4,10",
+		"1620007200,3,x,2,5,10",
+		"1620014400,3,4,2,5,10",
+		"1620018000,4,5",
+		"1620021600,5,6,4,7,10",
+	}, "\n")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+	t.Run("invalid rows", func(t *testing.T) {
+		_, err := NewCSVFeed("1h", PairFeed{Pair: "BTCUSDT", File: file, Timeframe: "1h"})
+		require.ErrorContains(t, err, "line 4")
+	})
+
+	t.Run("skip invalid rows", func(t *testing.T) {
+		feed, err := NewCSVFeed("1h", PairFeed{Pair: "BTCUSDT", File: file, Timeframe: "1h", SkipInvalidRows: true})
+		require.NoError(t, err)
+
+		report, ok := feed.Report("BTCUSDT", "1h")
+		require.True(t, ok)
+		require.Equal(t, 4, report.Candles)
+		require.Equal(t, time.Unix(1620000000, 0).UTC(), report.Start)
+		require.Equal(t, time.Unix(1620021600, 0).UTC(), report.End)
+		require.Equal(t, "1h", report.DetectedTimeframe)
+
+		require.Equal(t, []CSVGap{
+			{Start: time.Unix(1620003600, 0).UTC(), End: time.Unix(1620014400, 0).UTC(), Missing: 2},
+			{Start: time.Unix(1620014400, 0).UTC(), End: time.Unix(1620021600, 0).UTC(), Missing: 1},
+		}, report.Gaps)
+
+		require.Len(t, report.InvalidRows, 2)
+		require.Equal(t, 4, report.InvalidRows[0].Line)
+		require.Equal(t, 6, report.InvalidRows[1].Line)
+		require.Contains(t, report.String(), "2 gaps, 2 invalid rows")
+	})
+
+	t.Run("daily file", func(t *testing.T) {
+		feed, err := NewCSVFeed("1d", PairFeed{Pair: "BTCUSDT", File: "../testdata/btc-1d.csv", Timeframe: "1d"})
+		require.NoError(t, err)
+		report, ok := feed.Report("BTCUSDT", "1d")
+		require.True(t, ok)
+		require.Equal(t, "1d", report.DetectedTimeframe)
+		require.Empty(t, report.Gaps)
+		require.Empty(t, report.InvalidRows)
+
+		_, ok = feed.Report("BTCUSDT", "1h")
+		require.False(t, ok)
+	})
+
+	t.Run("empty files", func(t *testing.T) {
+		for _, content := range []string{"", "time,open,close,low,high,volume\n"} {
+			feed, err := NewCSVFeedFromReader(strings.NewReader(content), "BTCUSDT", "1h")
+			require.NoError(t, err)
+
+			report, ok := feed.Report("BTCUSDT", "1h")
+			require.True(t, ok)
+			require.Zero(t, report.Candles)
+			require.Contains(t, report.String(), "0 candles")
+
+			_, err = feed.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 1)
+			require.ErrorIs(t, err, ErrInsufficientData)
+		}
+	})
+}
+
+func TestNewCSVFeedFromReader(t *testing.T) {
+	content := strings.Join([]string{
+		"time,open,close,low,high,volume",
+		"1620000000,1,2,0.5,3,10",
+		"1620003600,2,3,1,4,10",
+	}, "\n")
+
+	t.Run("reader", func(t *testing.T) {
+		feed, err := NewCSVFeedFromReader(strings.NewReader(content), "BTCUSDT", "1h")
+		require.NoError(t, err)
+
+		candles, err := feed.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Unix(1620003600, 0).UTC(), candles[1].Time)
+		require.Equal(t, 3.0, candles[1].Close)
+	})
+
+	t.Run("resample", func(t *testing.T) {
+		feed, err := NewCSVFeed("2h", PairFeed{Pair: "BTCUSDT", Timeframe: "1h", Reader: strings.NewReader(content)})
+		require.NoError(t, err)
+		require.Len(t, feed.CandlePairTimeFrame["BTCUSDT--2h"], 2)
+	})
+
+	t.Run("derivatives columns", func(t *testing.T) {
+		content := strings.Join([]string{
+			"time,open,close,low,high,volume,open_interest,funding_rate",
+			"1620000000,1,2,0.5,3,10,1500,0.0001",
+			"1620003600,2,3,1,4,10,1600,",
+		}, "\n")
+
+		feed, err := NewCSVFeedFromReader(strings.NewReader(content), "BTCUSDT", "1h")
+		require.NoError(t, err)
+
+		candles, err := feed.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Equal(t, 1500.0, candles[0].Metadata[model.MetadataOpenInterest])
+		require.Equal(t, 0.0001, candles[0].Metadata[model.MetadataFundingRate])
+		require.Equal(t, 1600.0, candles[1].Metadata[model.MetadataOpenInterest])
+		require.True(t, math.IsNaN(candles[1].Metadata[model.MetadataFundingRate]))
+	})
+
+	t.Run("invalid row", func(t *testing.T) {
+		_, err := NewCSVFeedFromReader(strings.NewReader(content+"\n1620007200,x"), "BTCUSDT", "1h")
+		require.ErrorContains(t, err, "BTCUSDT reader line 4")
+	})
 }
 
 func TestCSVFeed_CandlesByLimit(t *testing.T) {
@@ -67,6 +244,77 @@ func TestCSVFeed_CandlesByLimit(t *testing.T) {
 	require.Equal(t, "2021-04-27 00:00:00", candle.Time.UTC().Format("2006-01-02 15:04:05"))
 }
 
+func TestCSVFeed_TradesSubscription(t *testing.T) {
+	feed, err := NewCSVFeed("1d", PairFeed{
+		Timeframe: "1d",
+		Pair:      "BTCUSDT",
+		File:      "../testdata/btc-1d.csv",
+	})
+	require.NoError(t, err)
+
+	ctrade, cerr := feed.TradesSubscription(context.Background(), "BTCUSDT")
+	trades := make([]model.Trade, 0)
+	for trade := range ctrade {
+		trades = append(trades, trade)
+	}
+	require.NoError(t, <-cerr)
+	require.Len(t, trades, 14*4)
+
+	// first candle is bullish: open -> low -> high -> close
+	require.Equal(t, []float64{49066.76, 48753.44, 54356.62, 54001.39}, []float64{
+		trades[0].Price, trades[1].Price, trades[2].Price, trades[3].Price,
+	})
+	require.Equal(t, "2021-04-26 18:00:00", trades[3].Time.UTC().Format("2006-01-02 15:04:05"))
+
+	_, cerr = feed.TradesSubscription(context.Background(), "ETHUSDT")
+	require.ErrorIs(t, <-cerr, ErrInsufficientData)
+}
+
+func TestCSVFeed_CandlesFanOut(t *testing.T) {
+	feed, err := NewCSVFeed("1h", PairFeed{
+		Timeframe: "1h",
+		Pair:      "BTCUSDT",
+		File:      "../testdata/btc-1h.csv",
+	})
+	require.NoError(t, err)
+
+	timeframes := []string{"1h", "4h", "1d"}
+	channels, cerr := feed.CandlesFanOut(context.Background(), "BTCUSDT", timeframes...)
+	require.Len(t, channels, 3)
+
+	var wg sync.WaitGroup
+	received := make([][]model.Candle, len(timeframes))
+	for i, timeframe := range timeframes {
+		wg.Add(1)
+		go func(i int, channel chan model.Candle) {
+			defer wg.Done()
+			for candle := range channel {
+				received[i] = append(received[i], candle)
+			}
+		}(i, channels[timeframe])
+	}
+	wg.Wait()
+	require.NoError(t, <-cerr)
+
+	for i, timeframe := range timeframes {
+		require.NotEmpty(t, received[i])
+		require.Equal(t, feed.CandlePairTimeFrame["BTCUSDT--"+timeframe], received[i], timeframe)
+	}
+	require.ElementsMatch(t, []string{"1h", "4h", "1d"}, feed.Timeframes())
+
+	t.Run("invalid timeframe", func(t *testing.T) {
+		channels, cerr := feed.CandlesFanOut(context.Background(), "BTCUSDT", "1h", "7m")
+		require.ErrorIs(t, <-cerr, ErrInvalidTimeframe)
+		_, ok := <-channels["1h"]
+		require.False(t, ok)
+	})
+
+	t.Run("unknown pair", func(t *testing.T) {
+		_, cerr := feed.CandlesFanOut(context.Background(), "ETHUSDT", "1h")
+		require.ErrorIs(t, <-cerr, ErrInsufficientData)
+	})
+}
+
 func TestCSVFeed_resample(t *testing.T) {
 	t.Run("1h to 1d", func(t *testing.T) {
 		feed, err := NewCSVFeed(
@@ -124,9 +372,146 @@ func TestCSVFeed_resample(t *testing.T) {
 				Pair:      "BTCUSDT",
 				File:      "../testdata/btc-1h-2021-05-13.csv",
 			})
-		require.Error(t, err)
+		require.ErrorIs(t, err, ErrInvalidTimeframe)
+		require.Nil(t, feed)
+
+		feed, err = NewCSVFeed(
+			"3mins",
+			PairFeed{
+				Timeframe: "1h",
+				Pair:      "BTCUSDT",
+				File:      "../testdata/btc-1h-2021-05-13.csv",
+			})
+		require.ErrorIs(t, err, ErrInvalidTimeframe)
+		require.ErrorContains(t, err, "valid values: 1m, 5m")
 		require.Nil(t, feed)
 	})
+
+	t.Run("timeframes", func(t *testing.T) {
+		feed, err := NewCSVFeed(
+			"1d",
+			PairFeed{
+				Timeframe: "1h",
+				Pair:      "BTCUSDT",
+				File:      "../testdata/btc-1h-2021-05-13.csv",
+			})
+		require.NoError(t, err)
+		require.Equal(t, []string{"1d", "1h"}, feed.Timeframes())
+		require.NoError(t, ValidateTimeframe("1h", feed.Timeframes()))
+		require.ErrorIs(t, ValidateTimeframe("4h", feed.Timeframes()), ErrInvalidTimeframe)
+	})
+}
+
+func TestCSVFeed_resampleAlignment(t *testing.T) {
+	csvContent := func(times ...time.Time) string {
+		var lines []string
+		for i, tm := range times {
+			price := float64(100 + i)
+			lines = append(lines, fmt.Sprintf("%d,%f,%f,%f,%f,1", tm.Unix(), price, price+0.5, price-1, price+1))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	series := func(start time.Time, interval time.Duration, size int) []time.Time {
+		times := make([]time.Time, size)
+		for i := range times {
+			times[i] = start.Add(time.Duration(i) * interval)
+		}
+		return times
+	}
+
+	t.Run("gap closes the window", func(t *testing.T) {
+		start := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+		times := append(series(start, time.Hour, 2), series(start.Add(3*time.Hour), time.Hour, 3)...)
+		feed, err := NewCSVFeed("2h", PairFeed{
+			Pair:      "BTCUSDT",
+			Timeframe: "1h",
+			Reader:    strings.NewReader(csvContent(times...)),
+		})
+		require.NoError(t, err)
+
+		// 01:00 is skipped, 02:00 is closed by the gap at 03:00
+		candles := lo.Filter(feed.CandlePairTimeFrame["BTCUSDT--2h"], func(c model.Candle, _ int) bool {
+			return c.Complete
+		})
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC), candles[0].Time)
+		require.Equal(t, 101.0, candles[0].Open)
+		require.Equal(t, 101.5, candles[0].Close)
+		require.Equal(t, time.Date(2021, 1, 1, 4, 0, 0, 0, time.UTC), candles[1].Time)
+		require.Equal(t, 102.0, candles[1].Open)
+		require.Equal(t, 103.5, candles[1].Close)
+		require.Equal(t, 2.0, candles[1].Volume)
+	})
+
+	t.Run("weekly from monday", func(t *testing.T) {
+		// from sunday 2021-11-07 to sunday 2021-11-21
+		times := series(time.Date(2021, 11, 7, 0, 0, 0, 0, time.UTC), 24*time.Hour, 15)
+		feed, err := NewCSVFeed("1w", PairFeed{
+			Pair:      "BTCUSDT",
+			Timeframe: "1d",
+			Reader:    strings.NewReader(csvContent(times...)),
+			WeekStart: time.Monday,
+		})
+		require.NoError(t, err)
+
+		candles := lo.Filter(feed.CandlePairTimeFrame["BTCUSDT--1w"], func(c model.Candle, _ int) bool {
+			return c.Complete
+		})
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Date(2021, 11, 8, 0, 0, 0, 0, time.UTC), candles[0].Time)
+		require.Equal(t, time.Date(2021, 11, 15, 0, 0, 0, 0, time.UTC), candles[1].Time)
+		require.Equal(t, 7.0, candles[1].Volume)
+	})
+
+	t.Run("monthly", func(t *testing.T) {
+		times := series(time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), 24*time.Hour, 60)
+		feed, err := NewCSVFeed("1M", PairFeed{
+			Pair:      "BTCUSDT",
+			Timeframe: "1d",
+			Reader:    strings.NewReader(csvContent(times...)),
+		})
+		require.NoError(t, err)
+
+		candles := lo.Filter(feed.CandlePairTimeFrame["BTCUSDT--1M"], func(c model.Candle, _ int) bool {
+			return c.Complete
+		})
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), candles[0].Time)
+		require.Equal(t, 28.0, candles[0].Volume)
+		require.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), candles[1].Time)
+		require.Equal(t, 31.0, candles[1].Volume)
+	})
+}
+
+func TestCandlePeriodStart(t *testing.T) {
+	tm := time.Date(2021, 11, 10, 13, 47, 0, 0, time.FixedZone("BRT", -3*60*60)) // 16:47 UTC, wednesday
+	tt := []struct {
+		timeframe string
+		weekStart time.Weekday
+		start     time.Time
+	}{
+		{"15m", time.Sunday, time.Date(2021, 11, 10, 16, 45, 0, 0, time.UTC)},
+		{"1h", time.Sunday, time.Date(2021, 11, 10, 16, 0, 0, 0, time.UTC)},
+		{"4h", time.Sunday, time.Date(2021, 11, 10, 16, 0, 0, 0, time.UTC)},
+		{"6h", time.Sunday, time.Date(2021, 11, 10, 12, 0, 0, 0, time.UTC)},
+		{"1d", time.Sunday, time.Date(2021, 11, 10, 0, 0, 0, 0, time.UTC)},
+		{"3d", time.Sunday, time.Date(2021, 11, 8, 0, 0, 0, 0, time.UTC)},
+		{"1w", time.Sunday, time.Date(2021, 11, 7, 0, 0, 0, 0, time.UTC)},
+		{"1w", time.Monday, time.Date(2021, 11, 8, 0, 0, 0, 0, time.UTC)},
+		{"1M", time.Sunday, time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("%s from %s", tc.timeframe, tc.weekStart), func(t *testing.T) {
+			start, err := candlePeriodStart(tm, tc.timeframe, tc.weekStart)
+			require.NoError(t, err)
+			require.Equal(t, tc.start, start)
+		})
+	}
+
+	_, err := candlePeriodStart(tm, "1y", time.Sunday)
+	require.EqualError(t, err, "invalid timeframe: 1y")
 }
 
 func TestIsLastCandlePeriod(t *testing.T) {
@@ -159,7 +544,7 @@ func TestIsLastCandlePeriod(t *testing.T) {
 
 		for _, tc := range tt {
 			t.Run(fmt.Sprintf("%s to %s", tc.sourceTimeFrame, tc.targetTimeFrame), func(t *testing.T) {
-				last, err := isLastCandlePeriod(tc.time, tc.sourceTimeFrame, tc.targetTimeFrame)
+				last, err := isLastCandlePeriod(tc.time, tc.sourceTimeFrame, tc.targetTimeFrame, time.Sunday)
 				require.NoError(t, err)
 				require.Equal(t, tc.last, last)
 			})
@@ -167,13 +552,13 @@ func TestIsLastCandlePeriod(t *testing.T) {
 	})
 
 	t.Run("invalid source", func(t *testing.T) {
-		last, err := isLastCandlePeriod(time.Now(), "invalid", "1h")
+		last, err := isLastCandlePeriod(time.Now(), "invalid", "1h", time.Sunday)
 		require.Error(t, err)
 		require.False(t, last)
 	})
 
 	t.Run("not supported interval", func(t *testing.T) {
-		last, err := isLastCandlePeriod(time.Now(), "1d", "1y")
+		last, err := isLastCandlePeriod(time.Now(), "1d", "1y", time.Sunday)
 		require.EqualError(t, err, "invalid timeframe: 1y")
 		require.False(t, last)
 	})
@@ -196,7 +581,7 @@ func TestIsFistCandlePeriod(t *testing.T) {
 
 		for _, tc := range tt {
 			t.Run(fmt.Sprintf("%s to %s", tc.sourceTimeFrame, tc.targetTimeFrame), func(t *testing.T) {
-				first, err := isFistCandlePeriod(tc.time, tc.sourceTimeFrame, tc.targetTimeFrame)
+				first, err := isFistCandlePeriod(tc.time, tc.sourceTimeFrame, tc.targetTimeFrame, time.Sunday)
 				require.NoError(t, err)
 				require.Equal(t, tc.last, first)
 			})
@@ -204,13 +589,13 @@ func TestIsFistCandlePeriod(t *testing.T) {
 	})
 
 	t.Run("invalid source", func(t *testing.T) {
-		last, err := isFistCandlePeriod(time.Now(), "invalid", "1h")
+		last, err := isFistCandlePeriod(time.Now(), "invalid", "1h", time.Sunday)
 		require.Error(t, err)
 		require.False(t, last)
 	})
 
 	t.Run("not supported interval", func(t *testing.T) {
-		last, err := isFistCandlePeriod(time.Now(), "1d", "1y")
+		last, err := isFistCandlePeriod(time.Now(), "1d", "1y", time.Sunday)
 		require.EqualError(t, err, "invalid timeframe: 1y")
 		require.False(t, last)
 	})
@@ -0,0 +1,127 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// CSVReport is a summary of the candles loaded from a CSV file, to detect data issues before a backtest
+type CSVReport struct {
+	Pair      string
+	File      string
+	Candles   int
+	Start     time.Time
+	End       time.Time
+	Timeframe string
+	// DetectedTimeframe is the most frequent interval between the candles
+	DetectedTimeframe string
+	Gaps              []CSVGap
+	InvalidRows       []CSVInvalidRow
+}
+
+// CSVGap is a sequence of missing candles between two loaded candles
+type CSVGap struct {
+	Start   time.Time
+	End     time.Time
+	Missing int
+}
+
+// CSVInvalidRow is a row of the file that could not be parsed, the line number starts at 1
+type CSVInvalidRow struct {
+	Line int
+	Err  error
+}
+
+func newCSVReport(feed PairFeed, interval time.Duration, candles []model.Candle,
+	invalidRows []CSVInvalidRow) CSVReport {
+
+	report := CSVReport{
+		Pair:        feed.Pair,
+		File:        feed.File,
+		Candles:     len(candles),
+		Timeframe:   feed.Timeframe,
+		InvalidRows: invalidRows,
+	}
+
+	if len(candles) == 0 {
+		return report
+	}
+
+	report.Start = candles[0].Time
+	report.End = candles[len(candles)-1].Time
+
+	frequency := make(map[time.Duration]int)
+	var detected time.Duration
+	for i := 1; i < len(candles); i++ {
+		diff := candles[i].Time.Sub(candles[i-1].Time)
+		frequency[diff]++
+		if frequency[diff] > frequency[detected] || (frequency[diff] == frequency[detected] && diff < detected) {
+			detected = diff
+		}
+
+		if interval > 0 && diff > interval {
+			report.Gaps = append(report.Gaps, CSVGap{
+				Start:   candles[i-1].Time,
+				End:     candles[i].Time,
+				Missing: int(diff/interval) - 1,
+			})
+		}
+	}
+
+	if detected > 0 {
+		report.DetectedTimeframe = durationTimeframe(detected)
+	}
+
+	return report
+}
+
+// durationTimeframe formats a duration in the timeframe notation, e.g. 4h or 15m
+func durationTimeframe(duration time.Duration) string {
+	units := []struct {
+		duration time.Duration
+		suffix   string
+	}{
+		{7 * 24 * time.Hour, "w"},
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+		{time.Minute, "m"},
+		{time.Second, "s"},
+	}
+
+	for _, unit := range units {
+		if duration%unit.duration == 0 {
+			return fmt.Sprintf("%d%s", duration/unit.duration, unit.suffix)
+		}
+	}
+	return duration.String()
+}
+
+func (r CSVReport) String() string {
+	const layout = "2006-01-02 15:04"
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s (%s): %d candles", r.Pair, r.File, r.Candles)
+	if r.Candles > 0 {
+		fmt.Fprintf(&builder, " from %s to %s", r.Start.Format(layout), r.End.Format(layout))
+	}
+
+	fmt.Fprintf(&builder, ", timeframe %s", r.Timeframe)
+	if r.DetectedTimeframe != "" {
+		fmt.Fprintf(&builder, " (detected %s)", r.DetectedTimeframe)
+	}
+	fmt.Fprintf(&builder, ", %d gaps, %d invalid rows", len(r.Gaps), len(r.InvalidRows))
+
+	for _, gap := range r.Gaps {
+		fmt.Fprintf(&builder, "\n  gap from %s to %s: %d missing candles", gap.Start.Format(layout),
+			gap.End.Format(layout), gap.Missing)
+	}
+
+	for _, row := range r.InvalidRows {
+		fmt.Fprintf(&builder, "\n  invalid row %d: %v", row.Line, row.Err)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,106 @@
+package exchange
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+// maxDebugBody is the size of the logged bodies, larger bodies (e.g. the exchange info) are truncated
+const maxDebugBody = 4096
+
+var (
+	// secretParam matches the credentials and listen keys of the query strings and form bodies
+	secretParam = regexp.MustCompile(`(?i)(^|[?&])(signature|sign|apikey|api_key|secret|secretkey|listenkey)=[^&]*`)
+	// secretField matches the credentials and listen keys of the JSON bodies
+	secretField = regexp.MustCompile(`(?i)"(signature|apikey|api_key|secret|secretkey|listenkey)"\s*:\s*"[^"]*"`)
+)
+
+// debugTransport logs the requests and the raw responses of the exchange at debug level, with the credentials
+// redacted. The headers are not logged, they carry the API key
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+// debugClient returns a copy of the HTTP client that logs the requests and the responses, see debugTransport
+func debugClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	result := *client
+	result.Transport = &debugTransport{next: next}
+	return &result
+}
+
+// WithProxy returns a copy of the transport with the requests of the wrapped transport routed through the proxy
+func (d *debugTransport) WithProxy(proxy *url.URL) http.RoundTripper {
+	return &debugTransport{next: proxyTransport(d.next, proxy)}
+}
+
+func (d *debugTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		return d.next.RoundTrip(request)
+	}
+
+	var body []byte
+	if request.Body != nil && request.GetBody != nil {
+		reader, err := request.GetBody()
+		if err == nil {
+			body, _ = io.ReadAll(reader)
+			reader.Close()
+		}
+	}
+
+	start := time.Now()
+	log.Debugf("[EXCHANGE DEBUG] --> %s %s%s %s", request.Method, request.URL.Host, request.URL.Path,
+		redact([]byte(request.URL.RawQuery))+formatBody(body))
+
+	response, err := d.next.RoundTrip(request)
+	if err != nil {
+		log.Debugf("[EXCHANGE DEBUG] <-- %s %s: %v (%s)", request.Method, request.URL.Path, err,
+			time.Since(start).Round(time.Millisecond))
+		return nil, err
+	}
+
+	body, err = io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("[EXCHANGE DEBUG] <-- %s %s: %d (%s) %s", request.Method, request.URL.Path, response.StatusCode,
+		time.Since(start).Round(time.Millisecond), redact(body))
+
+	return response, nil
+}
+
+// formatBody returns the request body as an additional part of the query
+func formatBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	return " body: " + redact(body)
+}
+
+// redact replaces the credentials of a query, form or JSON body, truncated to maxDebugBody
+func redact(body []byte) string {
+	value := secretParam.ReplaceAllString(string(body), "$1$2=REDACTED")
+	value = secretField.ReplaceAllString(value, `"$1":"REDACTED"`)
+	if len(value) <= maxDebugBody {
+		return value
+	}
+	return fmt.Sprintf("%s... (%d bytes)", value[:maxDebugBody], len(body))
+}
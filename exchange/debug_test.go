@@ -0,0 +1,69 @@
+package exchange
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"orderId":1,"status":"NEW","listenKey":"abc123"}`))
+	}))
+	defer server.Close()
+
+	output := new(bytes.Buffer)
+	level := logrus.GetLevel()
+	logrus.SetOutput(output)
+	logrus.SetLevel(logrus.DebugLevel)
+	defer func() {
+		logrus.SetOutput(os.Stderr)
+		logrus.SetLevel(level)
+	}()
+
+	client := debugClient(nil)
+	request, err := http.NewRequest(http.MethodPost,
+		server.URL+"/api/v3/order?symbol=BTCUSDT&quantity=0.1&signature=deadbeef",
+		strings.NewReader("apiKey=my-key&side=BUY"))
+	require.NoError(t, err)
+	request.Header.Set("X-MBX-APIKEY", "my-key")
+
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	// the response body is still available to the caller
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "abc123")
+
+	logs := output.String()
+	require.Contains(t, logs, "symbol=BTCUSDT&quantity=0.1&signature=REDACTED")
+	require.Contains(t, logs, "apiKey=REDACTED&side=BUY")
+	require.Contains(t, logs, `\"orderId\":1`)
+	require.Contains(t, logs, `\"listenKey\":\"REDACTED\"`)
+	require.NotContains(t, logs, "deadbeef")
+	require.NotContains(t, logs, "my-key")
+	require.NotContains(t, logs, "abc123")
+
+	t.Run("listen key", func(t *testing.T) {
+		// the user stream keepalive and close requests send the listen key in the form body
+		value := redact([]byte("listenKey=xyz789"))
+		require.Equal(t, "listenKey=REDACTED", value)
+
+		value = redact([]byte("/api/v3/userDataStream?listenKey=xyz789&timestamp=1"))
+		require.Equal(t, "/api/v3/userDataStream?listenKey=REDACTED&timestamp=1", value)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		value := redact([]byte(strings.Repeat("a", maxDebugBody+10)))
+		require.True(t, strings.HasSuffix(value, "... (4106 bytes)"))
+	})
+}
@@ -4,32 +4,166 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/StudioSol/set"
+	"github.com/xhit/go-str2duration/v2"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/service"
 	"github.com/rodrigo-brito/ninjabot/tools/log"
 )
 
+// ClientOrderIDPrefix is the prefix of the client order IDs of the orders created by the bot, to recognize them
+// among the orders of the account, e.g. in order.Controller.Reconcile. Set by Binance spot, margin and futures
+const ClientOrderIDPrefix = "ninjabot-"
+
+var clientOrderCounter int64
+
+// NewClientOrderID returns a unique client order ID with ClientOrderIDPrefix
+func NewClientOrderID() string {
+	return ClientOrderIDPrefix + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" +
+		strconv.FormatInt(atomic.AddInt64(&clientOrderCounter, 1), 36)
+}
+
 var (
 	ErrInvalidQuantity   = errors.New("invalid quantity")
 	ErrInsufficientFunds = errors.New("insufficient funds or locked")
 	ErrInvalidAsset      = errors.New("invalid asset")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrMinNotional       = errors.New("order value below the minimum notional")
+	ErrMarketClosed      = errors.New("market closed")
+	ErrDuplicateOrder    = errors.New("duplicate order")
 )
 
+// ExchangeError is an error of the exchange API classified with one of the sentinel errors above, which
+// can be checked with errors.Is (e.g. errors.Is(err, ErrRateLimited)). The original error is kept in Err
+type ExchangeError struct {
+	Kind error
+	Err  error
+}
+
+func (e *ExchangeError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *ExchangeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExchangeError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// IsInsufficientFunds checks if the order was rejected due to insufficient balance or margin. Each exchange
+// classifies its own error codes as ErrInsufficientFunds, so any exchange error can be checked here
+func IsInsufficientFunds(err error) bool {
+	return errors.Is(err, ErrInsufficientFunds)
+}
+
+// Pinger is implemented by exchanges that can check if the connection with the server is alive
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// TrailingOCOCreator is implemented by exchanges that support OCO orders with a trailing profit leg
+type TrailingOCOCreator interface {
+	CreateOrderOCOTrailing(pair string, size, activation, trail, stop, stopLimit float64) ([]model.Order, error)
+}
+
+// OTOCOCreator is implemented by exchanges that support OTOCO (one-triggers-OCO) orders: an entry limit order
+// that, when filled, places an OCO order with the take profit and the stop loss of the position. The bracket orders
+// are returned with the entry, in the pending new status until the entry is filled
+type OTOCOCreator interface {
+	CreateOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop, stopLimit float64) ([]model.Order,
+		error)
+}
+
+// TrailingStopCreator is implemented by exchanges that support trailing stop market orders, triggered when the
+// price retraces from its best price after the activation by the callback rate (e.g. 0.01 for 1%)
+type TrailingStopCreator interface {
+	CreateOrderTrailingStop(side model.SideType, pair string, size, activation, callbackRate float64) (model.Order,
+		error)
+}
+
+// ReduceOnlyCreator is implemented by futures exchanges with reduce only orders, which only reduce or close the
+// position and never open the opposite side, e.g. to close the position on an opposite signal
+type ReduceOnlyCreator interface {
+	CreateOrderMarketReduceOnly(side model.SideType, pair string, size float64) (model.Order, error)
+	CreateOrderLimitReduceOnly(side model.SideType, pair string, size, limit float64) (model.Order, error)
+}
+
+// ForcedOrdersFetcher is implemented by exchanges that fill orders on their own, out of the orders placed by the
+// bot, e.g. the liquidations and trailing stops of the paper wallet. It returns each fill only once
+type ForcedOrdersFetcher interface {
+	ForcedOrders() []model.Order
+}
+
+// MarginTrader is implemented by exchanges with a margin account. The side effect of an order defines if it borrows
+// the missing amount (model.SideEffectTypeMarginBuy) or repays the debt (model.SideEffectTypeAutoRepay)
+type MarginTrader interface {
+	CreateOrderMarketMargin(side model.SideType, pair string, quantity float64,
+		sideEffect model.SideEffectType) (model.Order, error)
+	CreateOrderLimitMargin(side model.SideType, pair string, quantity, limit float64,
+		sideEffect model.SideEffectType) (model.Order, error)
+	MarginAccount(pair string) (model.Account, error)
+}
+
+// OrderReplacer is implemented by exchanges that replace a resting limit order with a new price and quantity
+// in a single request, without a window with no order in the book
+type OrderReplacer interface {
+	OrderReplace(order model.Order, price, quantity float64) (model.Order, error)
+}
+
+// FundingRateFetcher is implemented by futures exchanges with the funding rate of perpetual contracts, it returns
+// the rate (e.g. 0.0001 for 0.01%) and the time of the next funding payment
+type FundingRateFetcher interface {
+	FundingRate(pair string) (float64, time.Time, error)
+}
+
+// TradeHistoryFetcher is implemented by exchanges with the trade history of the account, the fills of the orders
+// with the commission paid in each one. It returns the last trades of the pair, up to the limit, in chronological
+// order
+type TradeHistoryFetcher interface {
+	Trades(pair string, limit int) ([]model.Trade, error)
+}
+
+// DepthFetcher is implemented by exchanges with the order book of the pairs, it returns a snapshot with up to
+// limit levels on each side
+type DepthFetcher interface {
+	Depth(pair string, limit int) (model.Depth, error)
+}
+
+// VenueAccountsFetcher is implemented by exchanges that combine multiple accounts, e.g. MultiVenue. It returns
+// the account of each venue
+type VenueAccountsFetcher interface {
+	VenueAccounts() ([]VenueAccount, error)
+}
+
 type DataFeed struct {
 	Data chan model.Candle
 	Err  chan error
 }
 
 type DataFeedSubscription struct {
-	exchange                service.Exchange
+	exchange                service.Feeder
 	Feeds                   *set.LinkedHashSetString
 	DataFeeds               map[string]*DataFeed
 	SubscriptionsByDataFeed map[string][]Subscription
+
+	validatorOptions []CandleValidatorOption
+	validators       map[string]*CandleValidator
+
+	reconcileGaps bool
+	lastCandles   map[string]time.Time
+
+	mtx     sync.Mutex
+	started bool
+	cancels map[string]context.CancelFunc
 }
 
 type Subscription struct {
@@ -47,15 +181,118 @@ func (o *OrderError) Error() string {
 	return fmt.Sprintf("order error: %v", o.Err)
 }
 
+func (o *OrderError) Unwrap() error {
+	return o.Err
+}
+
 type DataFeedConsumer func(model.Candle)
 
-func NewDataFeed(exchange service.Exchange) *DataFeedSubscription {
+func NewDataFeed(exchange service.Feeder) *DataFeedSubscription {
 	return &DataFeedSubscription{
 		exchange:                exchange,
 		Feeds:                   set.NewLinkedHashSetString(),
 		DataFeeds:               make(map[string]*DataFeed),
 		SubscriptionsByDataFeed: make(map[string][]Subscription),
+		cancels:                 make(map[string]context.CancelFunc),
+		lastCandles:             make(map[string]time.Time),
+	}
+}
+
+// WithValidation enables the candle validation for all feeds, anomalous candles
+// are dropped (or repaired) before reaching the subscribers
+func (d *DataFeedSubscription) WithValidation(options ...CandleValidatorOption) {
+	d.validatorOptions = options
+	d.validators = make(map[string]*CandleValidator)
+}
+
+// WithFeeder sets the feeder of the candle subscriptions and the gap reconciliation, e.g. a FailoverFeed.
+// It must be set before the feeds are connected
+func (d *DataFeedSubscription) WithFeeder(feeder service.Feeder) {
+	d.exchange = feeder
+}
+
+// WithGapReconciliation fetches the candles missed between two closed candles of a feed, e.g. during a
+// reconnection, and delivers them in order before the received candle. Closed candles already delivered
+// (including the preloaded ones) are dropped
+func (d *DataFeedSubscription) WithGapReconciliation() {
+	d.reconcileGaps = true
+}
+
+// reconcile returns the candles to be delivered for a closed candle: the candles missed since the last closed
+// candle of the feed, fetched from the exchange, followed by the candle. Repeated candles return nothing
+func (d *DataFeedSubscription) reconcile(key string, candle model.Candle) []model.Candle {
+	d.mtx.Lock()
+	last, ok := d.lastCandles[key]
+	if ok && !candle.Time.After(last) {
+		d.mtx.Unlock()
+		return nil
+	}
+	d.lastCandles[key] = candle.Time
+	d.mtx.Unlock()
+
+	pair, timeframe := d.pairTimeframeFromKey(key)
+	interval, err := str2duration.ParseDuration(timeframe)
+	if !ok || err != nil || candle.Time.Sub(last) <= interval {
+		return []model.Candle{candle}
+	}
+
+	missed, err := d.exchange.CandlesByPeriod(context.Background(), pair, timeframe, last.Add(interval), candle.Time)
+	if err != nil {
+		log.Errorf("dataFeedSubscription/reconcile %s: %v", key, err)
+		return []model.Candle{candle}
+	}
+
+	candles := make([]model.Candle, 0, len(missed)+1)
+	for _, c := range missed {
+		if c.Complete && c.Time.After(last) && c.Time.Before(candle.Time) {
+			candles = append(candles, c)
+		}
+	}
+
+	log.Infof("[FEED] %s %s: %d missed candles recovered", pair, timeframe, len(candles))
+	return append(candles, candle)
+}
+
+// delivered registers the last closed candle of a feed, see WithGapReconciliation
+func (d *DataFeedSubscription) delivered(key string, candle model.Candle) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.reconcileGaps && candle.Time.After(d.lastCandles[key]) {
+		d.lastCandles[key] = candle.Time
+	}
+}
+
+func (d *DataFeedSubscription) validate(key string, candle model.Candle) (model.Candle, bool) {
+	d.mtx.Lock()
+	if d.validators == nil {
+		d.mtx.Unlock()
+		return candle, true
+	}
+
+	validator, ok := d.validators[key]
+	if !ok {
+		validator = NewCandleValidator(d.validatorOptions...)
+		d.validators[key] = validator
 	}
+	d.mtx.Unlock()
+
+	return validator.Validate(candle)
+}
+
+// subscriptions returns a copy of the subscriptions of a feed, safe to be used while pairs are added or removed.
+// Candles of a closed connection (e.g. still draining after Unsubscribe) have no subscriptions
+func (d *DataFeedSubscription) subscriptions(key string, feed *DataFeed) []Subscription {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if feed != nil && d.DataFeeds[key] != feed {
+		return nil
+	}
+
+	subscriptions := make([]Subscription, len(d.SubscriptionsByDataFeed[key]))
+	copy(subscriptions, d.SubscriptionsByDataFeed[key])
+	return subscriptions
 }
 
 func (d *DataFeedSubscription) feedKey(pair, timeframe string) string {
@@ -67,13 +304,45 @@ func (d *DataFeedSubscription) pairTimeframeFromKey(key string) (pair, timeframe
 	return parts[0], parts[1]
 }
 
+// Subscribe registers a consumer of the candles of a pair and timeframe. After the data feed is started,
+// new feeds are connected immediately
 func (d *DataFeedSubscription) Subscribe(pair, timeframe string, consumer DataFeedConsumer, onCandleClose bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
 	key := d.feedKey(pair, timeframe)
 	d.Feeds.Add(key)
 	d.SubscriptionsByDataFeed[key] = append(d.SubscriptionsByDataFeed[key], Subscription{
 		onCandleClose: onCandleClose,
 		consumer:      consumer,
 	})
+
+	if _, ok := d.DataFeeds[key]; d.started && !ok {
+		d.run(key, d.connect(key), nil)
+	}
+}
+
+// Unsubscribe closes the feeds of a pair and removes its consumers
+func (d *DataFeedSubscription) Unsubscribe(pair string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, key := range d.Feeds.AsSlice() {
+		if feedPair, _ := d.pairTimeframeFromKey(key); feedPair != pair {
+			continue
+		}
+
+		if cancel, ok := d.cancels[key]; ok {
+			cancel()
+		}
+
+		d.Feeds.Remove(key)
+		delete(d.cancels, key)
+		delete(d.DataFeeds, key)
+		delete(d.SubscriptionsByDataFeed, key)
+		delete(d.validators, key)
+		delete(d.lastCandles, key)
+	}
 }
 
 func (d *DataFeedSubscription) Preload(pair, timeframe string, candles []model.Candle) {
@@ -84,51 +353,110 @@ func (d *DataFeedSubscription) Preload(pair, timeframe string, candles []model.C
 			continue
 		}
 
-		for _, subscription := range d.SubscriptionsByDataFeed[key] {
+		d.delivered(key, candle)
+		candle, ok := d.validate(key, candle)
+		if !ok {
+			continue
+		}
+
+		for _, subscription := range d.subscriptions(key, nil) {
 			subscription.consumer(candle)
 		}
 	}
 }
 
 func (d *DataFeedSubscription) Connect() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
 	log.Infof("Connecting to the exchange.")
 	for feed := range d.Feeds.Iter() {
-		pair, timeframe := d.pairTimeframeFromKey(feed)
-		ccandle, cerr := d.exchange.CandlesSubscription(context.Background(), pair, timeframe)
-		d.DataFeeds[feed] = &DataFeed{
-			Data: ccandle,
-			Err:  cerr,
+		if _, ok := d.DataFeeds[feed]; !ok {
+			d.connect(feed)
 		}
 	}
 }
 
+// connect subscribes to the candles of a feed in the exchange, the subscription is closed with Unsubscribe
+func (d *DataFeedSubscription) connect(key string) *DataFeed {
+	ctx, cancel := context.WithCancel(context.Background())
+	pair, timeframe := d.pairTimeframeFromKey(key)
+	ccandle, cerr := d.exchange.CandlesSubscription(ctx, pair, timeframe)
+
+	feed := &DataFeed{
+		Data: ccandle,
+		Err:  cerr,
+	}
+	d.DataFeeds[key] = feed
+	d.cancels[key] = cancel
+	return feed
+}
+
+// run sends the candles of a feed to the consumers until the feed is closed
+func (d *DataFeedSubscription) run(key string, feed *DataFeed, wg *sync.WaitGroup) {
+	if wg != nil {
+		wg.Add(1)
+	}
+
+	go func() {
+		if wg != nil {
+			defer wg.Done()
+		}
+
+		errs := feed.Err
+		for {
+			select {
+			case candle, ok := <-feed.Data:
+				if !ok {
+					return
+				}
+
+				candles := []model.Candle{candle}
+				if d.reconcileGaps && candle.Complete {
+					candles = d.reconcile(key, candle)
+				}
+
+				for _, candle := range candles {
+					d.deliver(key, feed, candle)
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				if err != nil {
+					log.Error("dataFeedSubscription/start: ", err)
+				}
+			}
+		}
+	}()
+}
+
+// deliver sends a candle of the feed to the consumers, after the validation
+func (d *DataFeedSubscription) deliver(key string, feed *DataFeed, candle model.Candle) {
+	candle, ok := d.validate(key, candle)
+	if !ok {
+		return
+	}
+
+	for _, subscription := range d.subscriptions(key, feed) {
+		if subscription.onCandleClose && !candle.Complete {
+			continue
+		}
+		subscription.consumer(candle)
+	}
+}
+
 func (d *DataFeedSubscription) Start(loadSync bool) {
 	d.Connect()
+
+	d.mtx.Lock()
+	d.started = true
 	wg := new(sync.WaitGroup)
 	for key, feed := range d.DataFeeds {
-		wg.Add(1)
-		go func(key string, feed *DataFeed) {
-			for {
-				select {
-				case candle, ok := <-feed.Data:
-					if !ok {
-						wg.Done()
-						return
-					}
-					for _, subscription := range d.SubscriptionsByDataFeed[key] {
-						if subscription.onCandleClose && !candle.Complete {
-							continue
-						}
-						subscription.consumer(candle)
-					}
-				case err := <-feed.Err:
-					if err != nil {
-						log.Error("dataFeedSubscription/start: ", err)
-					}
-				}
-			}
-		}(key, feed)
+		d.run(key, feed, wg)
 	}
+	d.mtx.Unlock()
 
 	log.Infof("Data feed connected.")
 	if loadSync {
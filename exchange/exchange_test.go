@@ -0,0 +1,55 @@
+package exchange
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/testdata/mocks"
+)
+
+func TestDataFeedSubscription_GapReconciliation(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int, complete bool) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hour) * time.Hour), Close: float64(hour),
+			Complete: complete}
+	}
+
+	ccandle, cerr := make(chan model.Candle), make(chan error)
+	exc := mocks.NewExchange(t)
+	exc.EXPECT().CandlesSubscription(mock.Anything, "BTCUSDT", "1h").Return(ccandle, cerr)
+	exc.EXPECT().CandlesByPeriod(mock.Anything, "BTCUSDT", "1h", start.Add(2*time.Hour), start.Add(5*time.Hour)).
+		Return([]model.Candle{candle(2, true), candle(3, true), candle(4, true), candle(5, false)}, nil)
+
+	var mtx sync.Mutex
+	var received []model.Candle
+	feed := NewDataFeed(exc)
+	feed.WithGapReconciliation()
+	feed.Subscribe("BTCUSDT", "1h", func(c model.Candle) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		received = append(received, c)
+	}, false)
+
+	feed.Preload("BTCUSDT", "1h", []model.Candle{candle(0, true), candle(1, true)})
+	feed.Start(false)
+
+	// repeated candle after a reconnection, a partial candle and a closed candle after a gap
+	ccandle <- candle(1, true)
+	ccandle <- candle(2, false)
+	ccandle <- candle(5, true)
+	close(ccandle)
+
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(received) == 7
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, []model.Candle{candle(0, true), candle(1, true), candle(2, false), candle(2, true),
+		candle(3, true), candle(4, true), candle(5, true)}, received)
+}
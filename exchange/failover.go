@@ -0,0 +1,200 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+// CandleSource is a source of candles of a FailoverFeed
+type CandleSource struct {
+	// Name identifies the source in the logs and errors, e.g. "binance"
+	Name   string
+	Feeder service.Feeder
+	// Symbol maps the pair of the bot to the symbol of the source, e.g. BTCUSDT to BTC-USDT.
+	// Nil uses the same pair
+	Symbol func(pair string) string
+}
+
+func (s CandleSource) symbol(pair string) string {
+	if s.Symbol == nil {
+		return pair
+	}
+	return s.Symbol(pair)
+}
+
+// FailoverFeed is a feeder that subscribes to the candles of multiple sources in priority order, and delivers
+// the candles of the first source that is not stalled. A source is stalled when it sends no candle during the
+// stall interval, or when its subscription is closed. The candles of the lower priority sources are delivered
+// while the higher priority sources are stalled, and the feed returns to a source as soon as it sends candles
+// again. Candles older than the last delivered candle are dropped, so a failover doesn't repeat candles.
+// The other methods of the feeder use the first source, without symbol mapping
+type FailoverFeed struct {
+	service.Feeder
+	sources []CandleSource
+	stall   time.Duration
+}
+
+type sourceCandle struct {
+	source int
+	candle model.Candle
+}
+
+// NewFailoverFeed creates a feeder with the sources in priority order, the first one is the primary source.
+// The stall interval should be greater than the update interval of the sources, e.g. the timeframe for
+// sources that send only closed candles
+func NewFailoverFeed(stall time.Duration, sources ...CandleSource) (*FailoverFeed, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("failover feed: no candle sources")
+	}
+
+	if stall <= 0 {
+		return nil, fmt.Errorf("failover feed: invalid stall interval %s", stall)
+	}
+
+	return &FailoverFeed{
+		Feeder:  sources[0].Feeder,
+		sources: sources,
+		stall:   stall,
+	}, nil
+}
+
+// CandlesSubscription subscribes to the candles of the pair in all sources, the candles are delivered with the
+// pair of the bot
+func (f *FailoverFeed) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle,
+	chan error) {
+
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	merged := make(chan sourceCandle)
+	closed := make(chan int)
+
+	for i, source := range f.sources {
+		candles, errs := source.Feeder.CandlesSubscription(ctx, source.symbol(pair), timeframe)
+		go f.forward(ctx, i, candles, errs, merged, closed, cerr)
+	}
+
+	go func() {
+		defer close(ccandle)
+
+		now := time.Now()
+		lastSeen := make([]time.Time, len(f.sources))
+		done := make([]bool, len(f.sources))
+		for i := range lastSeen {
+			lastSeen[i] = now
+		}
+
+		var (
+			active       = 0
+			remaining    = len(f.sources)
+			lastTime     time.Time
+			lastComplete bool
+		)
+
+		for remaining > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case i := <-closed:
+				done[i] = true
+				remaining--
+			case received := <-merged:
+				lastSeen[received.source] = time.Now()
+				current := f.activeSource(lastSeen, done)
+				if current != active {
+					log.Warnf("[FEED] %s %s: switching candle source from %s to %s", pair, timeframe,
+						f.sources[active].Name, f.sources[current].Name)
+					active = current
+				}
+
+				candle := received.candle
+				if received.source != active || candle.Time.Before(lastTime) ||
+					(candle.Time.Equal(lastTime) && lastComplete) {
+					continue
+				}
+
+				lastTime = candle.Time
+				lastComplete = candle.Complete
+				candle.Pair = pair
+
+				select {
+				case ccandle <- candle:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// activeSource returns the first source with a candle in the stall interval, or the source with the most recent
+// candle when all sources are stalled
+func (f *FailoverFeed) activeSource(lastSeen []time.Time, done []bool) int {
+	latest := -1
+	for i := range f.sources {
+		if done[i] {
+			continue
+		}
+
+		if time.Since(lastSeen[i]) <= f.stall {
+			return i
+		}
+
+		if latest < 0 || lastSeen[i].After(lastSeen[latest]) {
+			latest = i
+		}
+	}
+
+	if latest < 0 {
+		return 0
+	}
+	return latest
+}
+
+// forward sends the candles and errors of a source subscription until it is closed
+func (f *FailoverFeed) forward(ctx context.Context, source int, candles chan model.Candle, errs chan error,
+	merged chan sourceCandle, closed chan int, cerr chan error) {
+
+	defer func() {
+		select {
+		case closed <- source:
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case candle, ok := <-candles:
+			if !ok {
+				log.Warnf("[FEED] candle source %s closed", f.sources[source].Name)
+				return
+			}
+
+			select {
+			case merged <- sourceCandle{source: source, candle: candle}:
+			case <-ctx.Done():
+				return
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			select {
+			case cerr <- fmt.Errorf("candle source %s: %w", f.sources[source].Name, err):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/testdata/mocks"
+)
+
+func TestFailoverFeed(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(minutes int) model.Candle {
+		return model.Candle{Pair: "BTC-USDT", Time: start.Add(time.Duration(minutes) * time.Minute), Complete: true}
+	}
+
+	primaryCandles, secondaryCandles := make(chan model.Candle), make(chan model.Candle)
+	primary, secondary := mocks.NewFeeder(t), mocks.NewFeeder(t)
+	primary.EXPECT().CandlesSubscription(mock.Anything, "BTCUSDT", "1m").Return(primaryCandles, make(chan error))
+	secondary.EXPECT().CandlesSubscription(mock.Anything, "BTC-USDT", "1m").
+		Return(secondaryCandles, make(chan error))
+
+	_, err := NewFailoverFeed(time.Second)
+	require.Error(t, err)
+
+	feed, err := NewFailoverFeed(50*time.Millisecond,
+		CandleSource{Name: "primary", Feeder: primary},
+		CandleSource{Name: "secondary", Feeder: secondary, Symbol: func(pair string) string {
+			return "BTC-USDT"
+		}},
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	candles, _ := feed.CandlesSubscription(ctx, "BTCUSDT", "1m")
+
+	// the secondary source is ignored while the primary is not stalled
+	secondaryCandles <- candle(0)
+	primaryCandles <- candle(1)
+	require.Equal(t, start.Add(time.Minute), (<-candles).Time)
+
+	// failover to the secondary source, with the pair of the bot
+	time.Sleep(100 * time.Millisecond)
+	secondaryCandles <- candle(2)
+	received := <-candles
+	require.Equal(t, start.Add(2*time.Minute), received.Time)
+	require.Equal(t, "BTCUSDT", received.Pair)
+
+	// back to the primary source, without repeated candles
+	primaryCandles <- candle(2)
+	primaryCandles <- candle(3)
+	require.Equal(t, start.Add(3*time.Minute), (<-candles).Time)
+
+	// a closed source is skipped, before the stall interval
+	close(primaryCandles)
+	time.Sleep(10 * time.Millisecond)
+	secondaryCandles <- candle(4)
+	require.Equal(t, start.Add(4*time.Minute), (<-candles).Time)
+
+	close(secondaryCandles)
+	_, ok := <-candles
+	require.False(t, ok)
+}
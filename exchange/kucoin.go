@@ -0,0 +1,1180 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jpillora/backoff"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+const (
+	kucoinBaseURL       = "https://api.kucoin.com"
+	kucoinSuccessCode   = "200000"
+	kucoinPageSize      = 500
+	kucoinPingInterval  = 18 * time.Second
+	kucoinPassphraseVer = "2"
+)
+
+// ErrKucoinInsufficientBalance is the KuCoin error code of orders rejected due to insufficient balance
+const ErrKucoinInsufficientBalance = "200004"
+
+var kucoinIntervals = map[string]string{
+	"1m": "1min", "3m": "3min", "5m": "5min", "15m": "15min", "30m": "30min", "1h": "1hour", "2h": "2hour",
+	"4h": "4hour", "6h": "6hour", "8h": "8hour", "12h": "12hour", "1d": "1day", "1w": "1week", "1M": "1month",
+}
+
+// kucoinStopStatus maps the status of the stop orders, waiting to be triggered
+var kucoinStopStatus = map[string]model.OrderStatusType{
+	"NEW":       model.OrderStatusTypeNew,
+	"TRIGGERED": model.OrderStatusTypeNew,
+	"CANCELLED": model.OrderStatusTypeCanceled,
+	"FAILED":    model.OrderStatusTypeRejected,
+}
+
+// KucoinError is an error returned by the KuCoin API
+type KucoinError struct {
+	Code    string
+	Message string
+}
+
+func (e *KucoinError) Error() string {
+	return fmt.Sprintf("kucoin: %s (code %s)", e.Message, e.Code)
+}
+
+// Is classifies the error code of orders rejected due to insufficient balance as ErrInsufficientFunds
+func (e *KucoinError) Is(target error) bool {
+	return target == ErrInsufficientFunds && e.Code == ErrKucoinInsufficientBalance
+}
+
+// kucoinOrderRef is the KuCoin order ID of an order created by the bot, stop orders have their own endpoints
+type kucoinOrderRef struct {
+	id   string
+	stop bool
+}
+
+// Kucoin implements the exchange with the KuCoin spot API. The pairs use the format of the bot, e.g. BTCUSDT,
+// and they are translated to the KuCoin symbols, e.g. BTC-USDT
+type Kucoin struct {
+	ctx        context.Context
+	client     *http.Client
+	dialer     *websocket.Dialer
+	proxy      *url.URL
+	baseURL    string
+	assetsInfo map[string]model.AssetInfo
+	symbols    map[string]string
+	pairs      map[string]string
+	counter    int64
+	HeikinAshi bool
+
+	APIKey        string
+	APISecret     string
+	APIPassphrase string
+
+	MetadataFetchers []MetadataFetchers
+
+	mtx      sync.Mutex
+	orderIDs map[int64]kucoinOrderRef
+}
+
+type KucoinOption func(*Kucoin)
+
+// WithKucoinCredentials will set KuCoin credentials, the passphrase is defined in the creation of the API key
+func WithKucoinCredentials(key, secret, passphrase string) KucoinOption {
+	return func(k *Kucoin) {
+		k.APIKey = key
+		k.APISecret = secret
+		k.APIPassphrase = passphrase
+	}
+}
+
+// WithKucoinBaseURL sets the REST URL, eg: https://api.kucoin.com. The websocket endpoints are
+// requested to the REST API
+func WithKucoinBaseURL(baseURL string) KucoinOption {
+	return func(k *Kucoin) {
+		k.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithKucoinHeikinAshiCandle will convert candle to Heikin Ashi
+func WithKucoinHeikinAshiCandle() KucoinOption {
+	return func(k *Kucoin) {
+		k.HeikinAshi = true
+	}
+}
+
+// WithKucoinMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithKucoinMetadataFetcher(fetcher MetadataFetchers) KucoinOption {
+	return func(k *Kucoin) {
+		k.MetadataFetchers = append(k.MetadataFetchers, fetcher)
+	}
+}
+
+// WithKucoinHTTPClient sets the HTTP client of the REST requests, e.g. with a custom transport or TLS config
+func WithKucoinHTTPClient(client *http.Client) KucoinOption {
+	return func(k *Kucoin) {
+		k.client = client
+	}
+}
+
+// WithKucoinDialer sets the dialer of the websocket subscriptions. Default: websocket.DefaultDialer
+func WithKucoinDialer(dialer *websocket.Dialer) KucoinOption {
+	return func(k *Kucoin) {
+		k.dialer = dialer
+	}
+}
+
+// WithKucoinProxy routes the REST requests and the websocket subscriptions through the proxy,
+// applied on top of the HTTP client and dialer options
+func WithKucoinProxy(proxy *url.URL) KucoinOption {
+	return func(k *Kucoin) {
+		k.proxy = proxy
+	}
+}
+
+// NewKucoin creates a new KuCoin exchange instance and loads the symbol increments
+func NewKucoin(ctx context.Context, options ...KucoinOption) (*Kucoin, error) {
+	exchange := &Kucoin{
+		ctx:        ctx,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		dialer:     websocket.DefaultDialer,
+		baseURL:    kucoinBaseURL,
+		assetsInfo: make(map[string]model.AssetInfo),
+		symbols:    make(map[string]string),
+		pairs:      make(map[string]string),
+		counter:    time.Now().UnixMilli() * 1000,
+		orderIDs:   make(map[int64]kucoinOrderRef),
+	}
+
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.proxy != nil {
+		exchange.client = proxyClient(exchange.client, exchange.proxy)
+		exchange.dialer = proxyDialer(exchange.dialer, exchange.proxy)
+	}
+
+	err := exchange.Ping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kucoin ping fail: %w", err)
+	}
+
+	err = exchange.loadSymbols(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("[SETUP] Using KuCoin exchange")
+
+	return exchange, nil
+}
+
+type kucoinResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// request calls the API and decodes the data field of the response. GET and DELETE parameters are sent in the
+// query and POST parameters in a JSON body, signed requests include the base64 HMAC-SHA256 signature of
+// timestamp + method + path with query + body, and the passphrase signed with the secret (key version 2)
+func (k *Kucoin) request(ctx context.Context, method, path string, params map[string]interface{}, signed bool,
+	result interface{}) error {
+
+	var body string
+	endpoint := path
+	if method == http.MethodPost {
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		payload, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = string(payload)
+	} else if len(params) > 0 {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, fmt.Sprint(value))
+		}
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Body = http.NoBody
+	}
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		req.Header.Set("KC-API-KEY", k.APIKey)
+		req.Header.Set("KC-API-TIMESTAMP", timestamp)
+		req.Header.Set("KC-API-SIGN", k.sign(timestamp+method+endpoint+body))
+		req.Header.Set("KC-API-PASSPHRASE", k.sign(k.APIPassphrase))
+		req.Header.Set("KC-API-KEY-VERSION", kucoinPassphraseVer)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response kucoinResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("kucoin: %s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if response.Code != kucoinSuccessCode {
+		return &KucoinError{Code: response.Code, Message: response.Msg}
+	}
+
+	if result == nil || len(response.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(response.Data, result)
+}
+
+func (k *Kucoin) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(k.APISecret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Ping checks the connection with the exchange server
+func (k *Kucoin) Ping(ctx context.Context) error {
+	return k.request(ctx, http.MethodGet, "/api/v1/timestamp", nil, false, nil)
+}
+
+type kucoinSymbol struct {
+	Symbol         string `json:"symbol"`
+	BaseCurrency   string `json:"baseCurrency"`
+	QuoteCurrency  string `json:"quoteCurrency"`
+	BaseMinSize    string `json:"baseMinSize"`
+	BaseMaxSize    string `json:"baseMaxSize"`
+	QuoteMinSize   string `json:"quoteMinSize"`
+	BaseIncrement  string `json:"baseIncrement"`
+	QuoteIncrement string `json:"quoteIncrement"`
+	PriceIncrement string `json:"priceIncrement"`
+	MinFunds       string `json:"minFunds"`
+	EnableTrading  bool   `json:"enableTrading"`
+}
+
+func (k *Kucoin) loadSymbols(ctx context.Context) error {
+	var symbols []kucoinSymbol
+	err := k.request(ctx, http.MethodGet, "/api/v2/symbols", nil, false, &symbols)
+	if err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		pair := symbol.BaseCurrency + symbol.QuoteCurrency
+		k.symbols[pair] = symbol.Symbol
+		k.pairs[symbol.Symbol] = pair
+		k.assetsInfo[pair] = newKucoinAssetInfo(symbol)
+	}
+
+	return nil
+}
+
+func newKucoinAssetInfo(symbol kucoinSymbol) model.AssetInfo {
+	info := model.AssetInfo{
+		BaseAsset:  symbol.BaseCurrency,
+		QuoteAsset: symbol.QuoteCurrency,
+	}
+
+	info.StepSize, _ = strconv.ParseFloat(symbol.BaseIncrement, 64)
+	info.BaseAssetPrecision = int(model.NumDecPlaces(info.StepSize))
+	info.TickSize, _ = strconv.ParseFloat(symbol.PriceIncrement, 64)
+	info.MinQuantity, _ = strconv.ParseFloat(symbol.BaseMinSize, 64)
+	info.MaxQuantity, _ = strconv.ParseFloat(symbol.BaseMaxSize, 64)
+
+	quoteIncrement, _ := strconv.ParseFloat(symbol.QuoteIncrement, 64)
+	info.QuotePrecision = int(model.NumDecPlaces(quoteIncrement))
+
+	// min funds is the min notional of the orders, the min quote size applies to the market quote orders
+	notional := symbol.MinFunds
+	if notional == "" {
+		notional = symbol.QuoteMinSize
+	}
+	info.MinNotional, _ = strconv.ParseFloat(notional, 64)
+
+	return info
+}
+
+// symbol returns the KuCoin symbol of a pair, eg: BTCUSDT -> BTC-USDT
+func (k *Kucoin) symbol(pair string) string {
+	if symbol, ok := k.symbols[pair]; ok {
+		return symbol
+	}
+
+	if asset, quote := SplitAssetQuote(pair); asset != "" {
+		return asset + "-" + quote
+	}
+	return pair
+}
+
+// pair returns the pair of a KuCoin symbol, eg: BTC-USDT -> BTCUSDT
+func (k *Kucoin) pair(symbol string) string {
+	if pair, ok := k.pairs[symbol]; ok {
+		return pair
+	}
+	return strings.ReplaceAll(symbol, "-", "")
+}
+
+func (k *Kucoin) Timeframes() []string {
+	return KucoinTimeframes
+}
+
+func (k *Kucoin) AssetsInfo(pair string) model.AssetInfo {
+	return k.assetsInfo[pair]
+}
+
+func (k *Kucoin) validate(pair string, quantity float64) error {
+	info, ok := k.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (k *Kucoin) formatPrice(pair string, value float64) string {
+	if info, ok := k.assetsInfo[pair]; ok {
+		return formatDecimal(value, info.TickSize, info.QuotePrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (k *Kucoin) formatQuantity(pair string, value float64) string {
+	if info, ok := k.assetsInfo[pair]; ok {
+		return formatDecimal(value, info.StepSize, info.BaseAssetPrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (k *Kucoin) formatQuoteQuantity(pair string, value float64) string {
+	if info, ok := k.assetsInfo[pair]; ok {
+		return formatDecimal(value, 0, info.QuotePrecision)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (k *Kucoin) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var result struct {
+		Price string `json:"price"`
+	}
+	err := k.request(ctx, http.MethodGet, "/api/v1/market/orderbook/level1",
+		map[string]interface{}{"symbol": k.symbol(pair)}, false, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Price == "" {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+	}
+
+	return strconv.ParseFloat(result.Price, 64)
+}
+
+// LastPrice returns the last traded price of the pair from the level 1 order book
+func (k *Kucoin) LastPrice(pair string) (float64, error) {
+	return k.LastQuote(k.ctx, pair)
+}
+
+func (k *Kucoin) candles(ctx context.Context, pair, period string, params map[string]interface{}) ([]model.Candle,
+	error) {
+
+	interval, ok := kucoinIntervals[period]
+	if !ok {
+		return nil, ValidateTimeframe(period, KucoinTimeframes)
+	}
+
+	params["symbol"] = k.symbol(pair)
+	params["type"] = interval
+
+	var klines [][]string
+	err := k.request(ctx, http.MethodGet, "/api/v1/market/candles", params, false, &klines)
+	if err != nil {
+		return nil, err
+	}
+
+	// klines are sorted in reverse order, the newest first
+	candles := make([]model.Candle, 0, len(klines))
+	ha := model.NewHeikinAshi()
+	for i := len(klines) - 1; i >= 0; i-- {
+		candle, err := CandleFromKucoinKline(pair, klines[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if k.HeikinAshi {
+			candle = candle.ToHeikinAshi(ha)
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+// CandlesByLimit returns the last candles of the pair, KuCoin returns up to 1500 candles without a period
+func (k *Kucoin) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	candles, err := k.candles(ctx, pair, period, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) == 0 {
+		return candles, nil
+	}
+
+	// discard last candle, because it is incomplete
+	candles = candles[:len(candles)-1]
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles, nil
+}
+
+func (k *Kucoin) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	return k.candles(ctx, pair, period, map[string]interface{}{
+		"startAt": start.Unix(),
+		"endAt":   end.Unix(),
+	})
+}
+
+// CandleFromKucoinKline converts a kline of the API: start time in seconds, open, close, high, low, volume
+// and turnover. The candle time is the open time of the kline
+func CandleFromKucoinKline(pair string, kline []string) (model.Candle, error) {
+	if len(kline) < 6 {
+		return model.Candle{}, fmt.Errorf("kucoin: invalid kline: %v", kline)
+	}
+
+	start, err := strconv.ParseInt(kline[0], 10, 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	t := time.Unix(start, 0)
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Complete: true}
+	candle.Open, _ = strconv.ParseFloat(kline[1], 64)
+	candle.Close, _ = strconv.ParseFloat(kline[2], 64)
+	candle.High, _ = strconv.ParseFloat(kline[3], 64)
+	candle.Low, _ = strconv.ParseFloat(kline[4], 64)
+	candle.Volume, _ = strconv.ParseFloat(kline[5], 64)
+	candle.Metadata = make(map[string]float64)
+	return candle, nil
+}
+
+type kucoinWsMessage struct {
+	ID    string          `json:"id"`
+	Type  string          `json:"type"`
+	Topic string          `json:"topic"`
+	Code  json.Number     `json:"code"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// connect requests a token and an instance server of the public websocket, KuCoin does not have a fixed
+// websocket URL. It returns the connection and the ping interval of the server
+func (k *Kucoin) connect(ctx context.Context) (*websocket.Conn, time.Duration, error) {
+	var bullet struct {
+		Token           string `json:"token"`
+		InstanceServers []struct {
+			Endpoint     string `json:"endpoint"`
+			PingInterval int64  `json:"pingInterval"`
+		} `json:"instanceServers"`
+	}
+	err := k.request(ctx, http.MethodPost, "/api/v1/bullet-public", nil, false, &bullet)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(bullet.InstanceServers) == 0 {
+		return nil, 0, errors.New("kucoin: no websocket instance server")
+	}
+
+	server := bullet.InstanceServers[0]
+	endpoint := fmt.Sprintf("%s?token=%s&connectId=%d", server.Endpoint, url.QueryEscape(bullet.Token),
+		atomic.AddInt64(&k.counter, 1))
+	conn, _, err := k.dialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	interval := kucoinPingInterval
+	if server.PingInterval > 0 {
+		interval = time.Duration(server.PingInterval) * time.Millisecond
+	}
+
+	// the server sends a welcome message before accepting subscriptions
+	var welcome kucoinWsMessage
+	err = conn.ReadJSON(&welcome)
+	if err != nil {
+		conn.Close()
+		return nil, 0, err
+	}
+
+	if welcome.Type != "welcome" {
+		conn.Close()
+		return nil, 0, fmt.Errorf("kucoin: unexpected websocket message: %s", welcome.Type)
+	}
+
+	return conn, interval, nil
+}
+
+// serve subscribes to a public topic and calls the handler with the data of each message,
+// until the connection is closed or the context is canceled
+func (k *Kucoin) serve(ctx context.Context, topic string, handler func(data json.RawMessage) error) error {
+	conn, interval, err := k.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.WriteJSON(map[string]interface{}{
+		"id":             strconv.FormatInt(atomic.AddInt64(&k.counter, 1), 10),
+		"type":           "subscribe",
+		"topic":          topic,
+		"privateChannel": false,
+		"response":       true,
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	var writeMtx sync.Mutex
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				writeMtx.Lock()
+				err := conn.WriteJSON(map[string]string{
+					"id":   strconv.FormatInt(atomic.AddInt64(&k.counter, 1), 10),
+					"type": "ping",
+				})
+				writeMtx.Unlock()
+				if err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var message kucoinWsMessage
+		err := conn.ReadJSON(&message)
+		if err != nil {
+			return err
+		}
+
+		if message.Type == "error" {
+			return fmt.Errorf("kucoin: subscribe %s: %s (code %s)", topic, string(message.Data), message.Code)
+		}
+
+		if message.Type != "message" || message.Topic != topic {
+			continue
+		}
+
+		err = handler(message.Data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// stream keeps the subscription of a topic, reconnecting when the connection is lost
+func (k *Kucoin) stream(ctx context.Context, topic string, cerr chan error,
+	handler func(data json.RawMessage) error) {
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 1 * time.Second,
+	}
+
+	for {
+		err := k.serve(ctx, topic, func(data json.RawMessage) error {
+			ba.Reset()
+			return handler(data)
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if err != nil {
+			cerr <- err
+		}
+		time.Sleep(ba.Duration())
+	}
+}
+
+// CandlesSubscription streams the klines of the pair. KuCoin sends only the updates of the current kline,
+// a kline is complete when the update of the next kline is received
+func (k *Kucoin) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+
+	interval, ok := kucoinIntervals[period]
+	if !ok {
+		go func() {
+			cerr <- ValidateTimeframe(period, KucoinTimeframes)
+			close(cerr)
+			close(ccandle)
+		}()
+		return ccandle, cerr
+	}
+
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+
+		ha := model.NewHeikinAshi()
+		var last *model.Candle
+		k.stream(ctx, fmt.Sprintf("/market/candles:%s_%s", k.symbol(pair), interval), cerr,
+			func(data json.RawMessage) error {
+				var update struct {
+					Candles []string `json:"candles"`
+					Time    int64    `json:"time"`
+				}
+				err := json.Unmarshal(data, &update)
+				if err != nil {
+					return err
+				}
+
+				candle, err := CandleFromKucoinKline(pair, update.Candles)
+				if err != nil {
+					return err
+				}
+				candle.UpdatedAt = time.Unix(0, update.Time)
+				candle.Complete = false
+
+				if last != nil && candle.Time.After(last.Time) {
+					complete := *last
+					complete.Complete = true
+					complete.UpdatedAt = candle.Time
+
+					if k.HeikinAshi {
+						complete = complete.ToHeikinAshi(ha)
+					}
+
+					// the metadata map is shared with the partial candle already sent, copy it before filling
+					metadata := make(map[string]float64, len(complete.Metadata)+len(k.MetadataFetchers))
+					for key, value := range complete.Metadata {
+						metadata[key] = value
+					}
+					complete.Metadata = metadata
+
+					// fetch aditional data if needed
+					for _, fetcher := range k.MetadataFetchers {
+						key, value := fetcher(pair, complete.Time)
+						complete.Metadata[key] = value
+					}
+
+					ccandle <- complete
+				}
+
+				last = &candle
+				ccandle <- candle
+				return nil
+			})
+	}()
+
+	return ccandle, cerr
+}
+
+// TradesSubscription streams the public trades of the given pair
+func (k *Kucoin) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ctrade := make(chan model.Trade)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(ctrade)
+
+		k.stream(ctx, "/market/match:"+k.symbol(pair), cerr, func(data json.RawMessage) error {
+			var event struct {
+				Sequence string `json:"sequence"`
+				Side     string `json:"side"`
+				Size     string `json:"size"`
+				Price    string `json:"price"`
+				Time     string `json:"time"`
+			}
+			err := json.Unmarshal(data, &event)
+			if err != nil {
+				return err
+			}
+
+			nanos, _ := strconv.ParseInt(event.Time, 10, 64)
+			trade := model.Trade{
+				Pair: pair,
+				Time: time.Unix(0, nanos),
+				// the side is the taker side, the buyer is the maker of a sell
+				IsBuyerMaker: event.Side == "sell",
+			}
+			trade.ID, _ = strconv.ParseInt(event.Sequence, 10, 64)
+			trade.Price, _ = strconv.ParseFloat(event.Price, 64)
+			trade.Quantity, _ = strconv.ParseFloat(event.Size, 64)
+			ctrade <- trade
+			return nil
+		})
+	}()
+
+	return ctrade, cerr
+}
+
+type kucoinOrder struct {
+	ID          string `json:"id"`
+	ClientOid   string `json:"clientOid"`
+	Symbol      string `json:"symbol"`
+	Type        string `json:"type"`
+	Side        string `json:"side"`
+	Price       string `json:"price"`
+	Size        string `json:"size"`
+	DealSize    string `json:"dealSize"`
+	DealFunds   string `json:"dealFunds"`
+	StopPrice   string `json:"stopPrice"`
+	Status      string `json:"status"`
+	IsActive    bool   `json:"isActive"`
+	CancelExist bool   `json:"cancelExist"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+// kucoinOrderStatus returns the status of an order, KuCoin has no status field: the active orders are
+// open and the inactive orders are canceled or filled
+func kucoinOrderStatus(order kucoinOrder, executed float64) model.OrderStatusType {
+	switch {
+	case order.IsActive && executed > 0:
+		return model.OrderStatusTypePartiallyFilled
+	case order.IsActive:
+		return model.OrderStatusTypeNew
+	case order.CancelExist:
+		return model.OrderStatusTypeCanceled
+	default:
+		return model.OrderStatusTypeFilled
+	}
+}
+
+// kucoinExchangeID returns a numeric ID of an order created outside the bot, KuCoin order IDs are
+// hexadecimal strings and the client ID (clientOid) is used as exchange ID of orders created by the bot
+func kucoinExchangeID(orderID string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(orderID))
+	return int64(hash.Sum64() >> 1)
+}
+
+func (k *Kucoin) newOrderID() int64 {
+	return atomic.AddInt64(&k.counter, 1)
+}
+
+// newOrder converts an order of the API and keeps its KuCoin order ID to be used in queries and cancellations
+func (k *Kucoin) newOrder(order kucoinOrder, stop bool) model.Order {
+	id, err := strconv.ParseInt(order.ClientOid, 10, 64)
+	if err != nil {
+		// orders created outside the bot
+		id = kucoinExchangeID(order.ID)
+	}
+
+	k.mtx.Lock()
+	k.orderIDs[id] = kucoinOrderRef{id: order.ID, stop: stop}
+	k.mtx.Unlock()
+
+	price, _ := strconv.ParseFloat(order.Price, 64)
+	quantity, _ := strconv.ParseFloat(order.Size, 64)
+	executed, _ := strconv.ParseFloat(order.DealSize, 64)
+	if funds, _ := strconv.ParseFloat(order.DealFunds, 64); executed > 0 && funds > 0 {
+		price = funds / executed
+		quantity = executed
+	}
+
+	orderType := model.OrderTypeLimit
+	if order.Type == "market" {
+		orderType = model.OrderTypeMarket
+	}
+
+	var status model.OrderStatusType
+	var stopPrice *float64
+	if stop {
+		if trigger, _ := strconv.ParseFloat(order.StopPrice, 64); trigger > 0 {
+			stopPrice = &trigger
+		}
+		orderType = model.OrderTypeStopLossLimit
+		status = kucoinStopStatus[order.Status]
+		if status == "" {
+			status = model.OrderStatusType(order.Status)
+		}
+	} else {
+		status = kucoinOrderStatus(order, executed)
+	}
+
+	return model.Order{
+		ExchangeID: id,
+		Pair:       k.pair(order.Symbol),
+		CreatedAt:  time.UnixMilli(order.CreatedAt),
+		UpdatedAt:  time.Now(),
+		Side:       model.SideType(strings.ToUpper(order.Side)),
+		Type:       orderType,
+		Status:     status,
+		Price:      price,
+		Quantity:   quantity,
+		Stop:       stopPrice,
+	}
+}
+
+func (k *Kucoin) orderRef(id int64) (kucoinOrderRef, bool) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	ref, ok := k.orderIDs[id]
+	return ref, ok && ref.id != ""
+}
+
+// orderByClientID returns an order by the client ID, used for orders with unknown KuCoin order ID and for
+// the orders placed by triggered stop orders, which keep the client ID of the stop order
+func (k *Kucoin) orderByClientID(id int64) (model.Order, error) {
+	var order kucoinOrder
+	err := k.request(k.ctx, http.MethodGet, "/api/v1/order/client-order/"+strconv.FormatInt(id, 10), nil, true,
+		&order)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if order.ID == "" {
+		return model.Order{}, fmt.Errorf("kucoin: order %d not found", id)
+	}
+
+	return k.newOrder(order, false), nil
+}
+
+func (k *Kucoin) Order(_ string, id int64) (model.Order, error) {
+	ref, ok := k.orderRef(id)
+	if !ok {
+		return k.orderByClientID(id)
+	}
+
+	if !ref.stop {
+		var order kucoinOrder
+		err := k.request(k.ctx, http.MethodGet, "/api/v1/orders/"+ref.id, nil, true, &order)
+		if err != nil {
+			return model.Order{}, err
+		}
+		return k.newOrder(order, false), nil
+	}
+
+	var order kucoinOrder
+	err := k.request(k.ctx, http.MethodGet, "/api/v1/stop-order/"+ref.id, nil, true, &order)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	stopOrder := k.newOrder(order, true)
+	if order.Status != "TRIGGERED" {
+		return stopOrder, nil
+	}
+
+	// the execution of a triggered stop order is the placed limit order
+	placed, err := k.orderByClientID(id)
+	if err != nil {
+		log.Warnf("kucoin: fetch triggered stop order %d: %v", id, err)
+		return stopOrder, nil
+	}
+
+	// keep tracking the stop order, the client ID lookup replaced its reference
+	k.mtx.Lock()
+	k.orderIDs[id] = ref
+	k.mtx.Unlock()
+
+	placed.Type = model.OrderTypeStopLossLimit
+	placed.Stop = stopOrder.Stop
+	return placed, nil
+}
+
+func (k *Kucoin) orders(path string, params map[string]interface{}, stop bool) ([]model.Order, error) {
+	var result struct {
+		Items []kucoinOrder `json:"items"`
+	}
+	err := k.request(k.ctx, http.MethodGet, path, params, true, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(result.Items))
+	for _, order := range result.Items {
+		orders = append(orders, k.newOrder(order, stop))
+	}
+	return orders, nil
+}
+
+// OpenOrders returns the orders and the untriggered stop orders of the given pair that are still open
+// in the exchange
+func (k *Kucoin) OpenOrders(pair string) ([]model.Order, error) {
+	symbol := k.symbol(pair)
+	orders, err := k.orders("/api/v1/orders",
+		map[string]interface{}{"symbol": symbol, "status": "active", "pageSize": kucoinPageSize}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	stopOrders, err := k.orders("/api/v1/stop-order",
+		map[string]interface{}{"symbol": symbol, "pageSize": kucoinPageSize}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(orders, stopOrders...), nil
+}
+
+func (k *Kucoin) createOrder(side model.SideType, pair, path string, params map[string]interface{},
+	stop bool) (model.Order, error) {
+
+	id := k.newOrderID()
+	params["clientOid"] = strconv.FormatInt(id, 10)
+	params["symbol"] = k.symbol(pair)
+	params["side"] = strings.ToLower(string(side))
+
+	var result struct {
+		OrderID string `json:"orderId"`
+	}
+	err := k.request(k.ctx, http.MethodPost, path, params, true, &result)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	k.mtx.Lock()
+	k.orderIDs[id] = kucoinOrderRef{id: result.OrderID, stop: stop}
+	k.mtx.Unlock()
+
+	// the create endpoint returns only the order ID, the execution is fetched from the order
+	order, err := k.Order(pair, id)
+	if err != nil {
+		log.Warnf("kucoin: fetch order %d: %v", id, err)
+		price, _ := strconv.ParseFloat(fmt.Sprint(params["price"]), 64)
+		quantity, _ := strconv.ParseFloat(fmt.Sprint(params["size"]), 64)
+		return model.Order{
+			ExchangeID: id,
+			Pair:       pair,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Side:       side,
+			Type:       model.OrderType(strings.ToUpper(fmt.Sprint(params["type"]))),
+			Status:     model.OrderStatusTypeNew,
+			Price:      price,
+			Quantity:   quantity,
+		}, nil
+	}
+
+	return order, nil
+}
+
+func (k *Kucoin) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, errors.New("kucoin: OCO orders are not supported")
+}
+
+func (k *Kucoin) CreateOrderLimit(side model.SideType, pair string, quantity float64, limit float64) (model.Order,
+	error) {
+
+	return k.CreateOrderLimitTIF(side, pair, quantity, limit, model.TimeInForceGTC)
+}
+
+func (k *Kucoin) CreateOrderLimitTIF(side model.SideType, pair string, quantity float64, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	err := k.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return k.createOrder(side, pair, "/api/v1/orders", map[string]interface{}{
+		"type":        "limit",
+		"size":        k.formatQuantity(pair, quantity),
+		"price":       k.formatPrice(pair, limit),
+		"timeInForce": string(timeInForce),
+	}, false)
+}
+
+func (k *Kucoin) CreateOrderMarket(side model.SideType, pair string, quantity float64) (model.Order, error) {
+	err := k.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return k.createOrder(side, pair, "/api/v1/orders", map[string]interface{}{
+		"type": "market",
+		"size": k.formatQuantity(pair, quantity),
+	}, false)
+}
+
+// CreateOrderMarketQuote creates a market order using the amount in quote asset, eg: buy 100 USDT of BTC
+func (k *Kucoin) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	if _, ok := k.assetsInfo[pair]; !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	if quote <= 0 {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidQuantity,
+			Pair:     pair,
+			Quantity: quote,
+		}
+	}
+
+	return k.createOrder(side, pair, "/api/v1/orders", map[string]interface{}{
+		"type":  "market",
+		"funds": k.formatQuoteQuantity(pair, quote),
+	}, false)
+}
+
+// CreateOrderStop creates a stop loss sell limit order, triggered when the price falls to the limit
+func (k *Kucoin) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	err := k.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return k.createOrder(model.SideTypeSell, pair, "/api/v1/stop-order", map[string]interface{}{
+		"type":        "limit",
+		"size":        k.formatQuantity(pair, quantity),
+		"price":       k.formatPrice(pair, limit),
+		"stop":        "loss",
+		"stopPrice":   k.formatPrice(pair, limit),
+		"timeInForce": string(model.TimeInForceGTC),
+	}, true)
+}
+
+func (k *Kucoin) Cancel(order model.Order) error {
+	ref, ok := k.orderRef(order.ExchangeID)
+	switch {
+	case !ok:
+		return k.request(k.ctx, http.MethodDelete,
+			"/api/v1/order/client-order/"+strconv.FormatInt(order.ExchangeID, 10), nil, true, nil)
+	case ref.stop:
+		return k.request(k.ctx, http.MethodDelete, "/api/v1/stop-order/"+ref.id, nil, true, nil)
+	default:
+		return k.request(k.ctx, http.MethodDelete, "/api/v1/orders/"+ref.id, nil, true, nil)
+	}
+}
+
+// CancelAll cancels all open orders and stop orders of the given pair and returns the canceled orders
+func (k *Kucoin) CancelAll(pair string) ([]model.Order, error) {
+	orders, err := k.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	symbol := k.symbol(pair)
+	err = k.request(k.ctx, http.MethodDelete, "/api/v1/orders", map[string]interface{}{"symbol": symbol}, true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		if order.Type != model.OrderTypeStopLossLimit {
+			continue
+		}
+
+		err = k.request(k.ctx, http.MethodDelete, "/api/v1/stop-order/cancel",
+			map[string]interface{}{"symbol": symbol}, true, nil)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	for i := range orders {
+		orders[i].Status = model.OrderStatusTypeCanceled
+		orders[i].UpdatedAt = time.Now()
+	}
+	return orders, nil
+}
+
+// Account returns the balances of the trading account
+func (k *Kucoin) Account() (model.Account, error) {
+	var accounts []struct {
+		Currency  string `json:"currency"`
+		Available string `json:"available"`
+		Holds     string `json:"holds"`
+	}
+	err := k.request(k.ctx, http.MethodGet, "/api/v1/accounts", map[string]interface{}{"type": "trade"}, true,
+		&accounts)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0, len(accounts))
+	for _, account := range accounts {
+		free, err := strconv.ParseFloat(account.Available, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		balance := model.Balance{Asset: account.Currency, Free: free}
+		balance.Lock, _ = strconv.ParseFloat(account.Holds, 64)
+		balances = append(balances, balance)
+	}
+
+	return model.Account{Balances: balances}, nil
+}
+
+func (k *Kucoin) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	if info, ok := k.assetsInfo[pair]; ok {
+		assetTick, quoteTick = info.BaseAsset, info.QuoteAsset
+	}
+
+	acc, err := k.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
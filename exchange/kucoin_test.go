@@ -0,0 +1,269 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func kucoinData(w http.ResponseWriter, data string) {
+	fmt.Fprintf(w, `{"code":"200000","data":%s}`, data)
+}
+
+func TestKucoin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now().Truncate(time.Hour)
+	closedTime := now.Add(-2 * time.Hour).Unix()
+	lastTime := now.Add(-time.Hour).Unix()
+	openTime := now.Unix()
+
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(payload))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	upgrader := websocket.Upgrader{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("KC-API-KEY") != "" {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			endpoint := r.URL.Path
+			if r.URL.RawQuery != "" {
+				endpoint += "?" + r.URL.RawQuery
+			}
+			require.Equal(t, "key", r.Header.Get("KC-API-KEY"))
+			require.Equal(t, "2", r.Header.Get("KC-API-KEY-VERSION"))
+			require.Equal(t, sign("pass"), r.Header.Get("KC-API-PASSPHRASE"))
+			require.Equal(t, sign(r.Header.Get("KC-API-TIMESTAMP")+r.Method+endpoint+string(body)),
+				r.Header.Get("KC-API-SIGN"))
+			r.Body = io.NopCloser(strings.NewReader(string(body)))
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/timestamp":
+			kucoinData(w, `1690000000000`)
+		case "/api/v2/symbols":
+			kucoinData(w, `[{"symbol":"BTC-USDT","baseCurrency":"BTC","quoteCurrency":"USDT",
+				"baseMinSize":"0.00001","quoteMinSize":"0.1","baseMaxSize":"10000000000","baseIncrement":"0.00000001",
+				"quoteIncrement":"0.000001","priceIncrement":"0.1","minFunds":"0.1","enableTrading":true}]`)
+		case "/api/v1/market/candles":
+			require.Equal(t, "BTC-USDT", r.URL.Query().Get("symbol"))
+			require.Equal(t, "1hour", r.URL.Query().Get("type"))
+			kucoinData(w, fmt.Sprintf(`[["%d","3","4","6","2","30","0"],["%d","2","3","5","1","20","0"],
+				["%d","1","2","4","0.5","10","0"]]`, openTime, lastTime, closedTime))
+		case "/api/v1/market/orderbook/level1":
+			require.Equal(t, "BTC-USDT", r.URL.Query().Get("symbol"))
+			kucoinData(w, `{"price":"30000.5"}`)
+		case "/api/v1/orders":
+			if r.Method == http.MethodGet {
+				require.Equal(t, "active", r.URL.Query().Get("status"))
+				kucoinData(w, `{"items":[{"id":"64c7a1","clientOid":"","symbol":"BTC-USDT","type":"limit",
+					"side":"sell","price":"31000","size":"0.5","dealSize":"0","isActive":true}]}`)
+				return
+			}
+
+			var params map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			if params["size"] == "1" {
+				fmt.Fprint(w, `{"code":"200004","msg":"Balance insufficient!"}`)
+				return
+			}
+			require.Equal(t, "BTC-USDT", params["symbol"])
+			require.Equal(t, "buy", params["side"])
+			require.Equal(t, "limit", params["type"])
+			require.Equal(t, "0.123", params["size"])
+			require.Equal(t, "100.5", params["price"])
+			require.NotEmpty(t, params["clientOid"])
+			kucoinData(w, `{"orderId":"5bd6e9286d99522a52e458de"}`)
+		case "/api/v1/orders/5bd6e9286d99522a52e458de":
+			kucoinData(w, `{"id":"5bd6e9286d99522a52e458de","clientOid":"42","symbol":"BTC-USDT","type":"limit",
+				"side":"buy","price":"100.5","size":"0.123","dealSize":"0.1","dealFunds":"10.04","isActive":true,
+				"cancelExist":false,"createdAt":1690000000000}`)
+		case "/api/v1/stop-order":
+			kucoinData(w, `{"items":[]}`)
+		case "/api/v1/accounts":
+			require.Equal(t, "trade", r.URL.Query().Get("type"))
+			kucoinData(w, `[{"currency":"BTC","balance":"2","available":"1.5","holds":"0.5"},
+				{"currency":"USDT","balance":"100","available":"100","holds":"0"}]`)
+		case "/api/v1/bullet-public":
+			require.Equal(t, http.MethodPost, r.Method)
+			kucoinData(w, fmt.Sprintf(`{"token":"abc","instanceServers":[{"endpoint":"%s",
+				"protocol":"websocket","pingInterval":18000}]}`, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws"))
+		case "/ws":
+			require.Equal(t, "abc", r.URL.Query().Get("token"))
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			require.NoError(t, conn.WriteJSON(map[string]string{"id": "1", "type": "welcome"}))
+
+			var subscribe map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&subscribe))
+			require.Equal(t, "subscribe", subscribe["type"])
+			require.Equal(t, "/market/candles:BTC-USDT_1hour", subscribe["topic"])
+			require.NoError(t, conn.WriteJSON(map[string]string{"id": subscribe["id"].(string), "type": "ack"}))
+
+			for _, kline := range []string{
+				fmt.Sprintf(`["%d","1","2","4","0.5","10","0"]`, lastTime),
+				fmt.Sprintf(`["%d","2","3","5","1","20","0"]`, openTime),
+			} {
+				message := fmt.Sprintf(`{"type":"message","topic":"/market/candles:BTC-USDT_1hour",
+					"subject":"trade.candles.update","data":{"symbol":"BTC-USDT","candles":%s,"time":%d}}`,
+					kline, time.Now().UnixNano())
+				require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+			}
+			_, _, _ = conn.ReadMessage()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	kucoin, err := NewKucoin(ctx, WithKucoinCredentials("key", "secret", "pass"), WithKucoinBaseURL(server.URL),
+		WithKucoinMetadataFetcher(func(pair string, t time.Time) (string, float64) {
+			return "funding", 0.01
+		}))
+	require.NoError(t, err)
+
+	t.Run("assets info", func(t *testing.T) {
+		info := kucoin.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.00000001, info.StepSize)
+		require.Equal(t, 8, info.BaseAssetPrecision)
+		require.Equal(t, 6, info.QuotePrecision)
+		require.Equal(t, 0.1, info.TickSize)
+		require.Equal(t, 0.00001, info.MinQuantity)
+		require.Equal(t, 0.1, info.MinNotional)
+	})
+
+	t.Run("symbols", func(t *testing.T) {
+		require.Equal(t, "BTC-USDT", kucoin.symbol("BTCUSDT"))
+		require.Equal(t, "ETH-BTC", kucoin.symbol("ETHBTC"))
+		require.Equal(t, "BTCUSDT", kucoin.pair("BTC-USDT"))
+		require.Equal(t, "ETHBTC", kucoin.pair("ETH-BTC"))
+	})
+
+	t.Run("candles by limit", func(t *testing.T) {
+		candles, err := kucoin.CandlesByLimit(ctx, "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Unix(closedTime, 0), candles[0].Time)
+		require.Equal(t, 2.0, candles[0].Close)
+		require.Equal(t, 4.0, candles[0].High)
+		require.Equal(t, time.Unix(lastTime, 0), candles[1].Time)
+		require.Equal(t, 20.0, candles[1].Volume)
+
+		candles, err = kucoin.CandlesByLimit(ctx, "BTCUSDT", "1h", 1)
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, time.Unix(lastTime, 0), candles[0].Time)
+
+		_, err = kucoin.CandlesByLimit(ctx, "BTCUSDT", "3d", 2)
+		require.ErrorIs(t, err, ErrInvalidTimeframe)
+	})
+
+	t.Run("last quote", func(t *testing.T) {
+		price, err := kucoin.LastQuote(ctx, "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 30000.5, price)
+	})
+
+	t.Run("create order", func(t *testing.T) {
+		order, err := kucoin.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.123, 100.5)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), order.ExchangeID)
+		require.Equal(t, "BTCUSDT", order.Pair)
+		require.Equal(t, model.SideTypeBuy, order.Side)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.InDelta(t, 100.4, order.Price, 1e-9)
+		require.Equal(t, 0.1, order.Quantity)
+
+		_, err = kucoin.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 100.5)
+		require.Error(t, err)
+		require.True(t, IsInsufficientFunds(err))
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+
+		_, err = kucoin.CreateOrderLimit(model.SideTypeBuy, "ETHUSDT", 1, 100.5)
+		require.ErrorIs(t, err, ErrInvalidAsset)
+	})
+
+	t.Run("open orders", func(t *testing.T) {
+		orders, err := kucoin.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, kucoinExchangeID("64c7a1"), orders[0].ExchangeID)
+		require.Equal(t, model.SideTypeSell, orders[0].Side)
+		require.Equal(t, model.OrderStatusTypeNew, orders[0].Status)
+		require.Equal(t, 31000.0, orders[0].Price)
+	})
+
+	t.Run("order status", func(t *testing.T) {
+		require.Equal(t, model.OrderStatusTypeNew, kucoinOrderStatus(kucoinOrder{IsActive: true}, 0))
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, kucoinOrderStatus(kucoinOrder{IsActive: true}, 1))
+		require.Equal(t, model.OrderStatusTypeCanceled, kucoinOrderStatus(kucoinOrder{CancelExist: true}, 1))
+		require.Equal(t, model.OrderStatusTypeFilled, kucoinOrderStatus(kucoinOrder{}, 1))
+	})
+
+	t.Run("account", func(t *testing.T) {
+		account, err := kucoin.Account()
+		require.NoError(t, err)
+
+		btc, usdt := account.Balance("BTC", "USDT")
+		require.Equal(t, 1.5, btc.Free)
+		require.Equal(t, 0.5, btc.Lock)
+		require.Equal(t, 100.0, usdt.Free)
+
+		asset, quote, err := kucoin.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 2.0, asset)
+		require.Equal(t, 100.0, quote)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		ccandle, _ := kucoin.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		received := make([]model.Candle, 0, 3)
+		for len(received) < 3 {
+			select {
+			case candle := <-ccandle:
+				received = append(received, candle)
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "candle not received")
+			}
+		}
+
+		// the update of the next kline completes the previous kline
+		require.Equal(t, time.Unix(lastTime, 0), received[0].Time)
+		require.False(t, received[0].Complete)
+		require.Equal(t, time.Unix(lastTime, 0), received[1].Time)
+		require.Equal(t, 2.0, received[1].Close)
+		require.True(t, received[1].Complete)
+		require.Equal(t, 0.01, received[1].Metadata["funding"])
+		require.NotContains(t, received[0].Metadata, "funding")
+		require.Equal(t, time.Unix(openTime, 0), received[2].Time)
+		require.False(t, received[2].Complete)
+	})
+}
@@ -30,6 +30,7 @@ func init() {
 }
 
 func SplitAssetQuote(pair string) (asset string, quote string) {
+	pair, _ = SplitVenuePair(pair)
 	data := pairAssetQuoteMap[pair]
 	return data.Asset, data.Quote
 }
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adshao/go-binance/v2/common"
@@ -16,6 +21,9 @@ import (
 	"github.com/rodrigo-brito/ninjabot/tools/log"
 )
 
+// DefaultRandSeed is the seed of the paper wallet random source, fixed to keep backtests reproducible
+const DefaultRandSeed int64 = 1
+
 type assetInfo struct {
 	Free float64
 	Lock float64
@@ -33,6 +41,7 @@ type PaperWallet struct {
 	counter       int64
 	takerFee      float64
 	makerFee      float64
+	feeSchedule   model.FeeSchedule
 	initialValue  float64
 	feeder        service.Feeder
 	orders        []model.Order
@@ -40,10 +49,148 @@ type PaperWallet struct {
 	avgShortPrice map[string]float64
 	avgLongPrice  map[string]float64
 	volume        map[string]float64
+	fees          map[string]float64
 	lastCandle    map[string]model.Candle
 	fistCandle    map[string]model.Candle
 	assetValues   map[string][]AssetValue
 	equityValues  []AssetValue
+	trailing      *trailingStopConfig
+	trailingStops map[string]float64
+	trueRanges    map[string][]float64
+	trailingOCO   map[int64]float64
+	trailingRates map[int64]float64
+	brackets      map[int64]int64
+
+	executionDelay         int
+	executionDelayDuration time.Duration
+	candleCount            map[string]int
+	delayedOrders          map[int64]int
+
+	rand     *rand.Rand
+	slippage float64
+	spread   float64
+
+	fillModel    FillModel
+	intrabarPath IntrabarPath
+	depths       map[string]*model.Depth
+	depthFeed    map[string]bool
+	synthetic    *syntheticDepthConfig
+
+	funding     *fundingConfig
+	lastFunding map[string]time.Time
+	fundingPaid map[string]float64
+
+	yields    map[string]float64
+	yieldDay  time.Time
+	yieldPaid map[string]float64
+
+	idealShadow  bool
+	ideal        *PaperWallet
+	idealOrders  map[int64]int64
+	benchmark    map[string]float64
+	slippageCost map[string]float64
+
+	leverage          float64
+	maintenanceMargin float64
+	liquidations      []Liquidation
+	notified          int
+	onLiquidation     func(Liquidation)
+
+	forced []model.Order
+}
+
+// FillModel defines how the paper wallet fills market orders
+type FillModel string
+
+const (
+	// FillModelClose fills the whole order with the last close price, plus the optional slippage
+	FillModelClose FillModel = "close"
+	// FillModelOrderBook fills the order by walking the levels of the last depth snapshot, with a volume
+	// weighted price and a partial fill when there is not enough liquidity. A partially filled order is reported
+	// as PARTIALLY_FILLED with the executed quantity, and the rest expires with the next candle. Orders are
+	// filled with the close model while there is no snapshot for the pair
+	FillModelOrderBook FillModel = "orderbook"
+)
+
+// IntrabarPath is the assumed price path inside a candle, used to decide which order of an OCO group is
+// filled when the candle reaches the prices of both orders, e.g. the stop and the target of a bracket
+type IntrabarPath string
+
+const (
+	// IntrabarPathNone fills the first order of the group in the creation order
+	IntrabarPathNone IntrabarPath = ""
+	// IntrabarPathOHLC assumes the price moves open, high, low and close
+	IntrabarPathOHLC IntrabarPath = "ohlc"
+	// IntrabarPathOLHC assumes the price moves open, low, high and close
+	IntrabarPathOLHC IntrabarPath = "olhc"
+	// IntrabarPathDirectional assumes open, low, high and close for bullish candles and open, high, low
+	// and close for bearish candles
+	IntrabarPathDirectional IntrabarPath = "directional"
+)
+
+type syntheticDepthConfig struct {
+	levels    int
+	step      float64
+	liquidity float64
+}
+
+// FundingRateFunc returns the funding rate of a pair at a funding time, e.g. 0.0001 for 0.01%
+type FundingRateFunc func(pair string, t time.Time) float64
+
+type fundingConfig struct {
+	interval time.Duration
+	rate     FundingRateFunc
+}
+
+// Liquidation is a position force-closed by the paper wallet at the liquidation price, see WithPaperLeverage
+type Liquidation struct {
+	Time       time.Time
+	Pair       string
+	Side       model.SideType // side of the closing order: sell for long positions and buy for short positions
+	Quantity   float64
+	EntryPrice float64
+	Price      float64
+	Fee        float64
+	Loss       float64
+}
+
+func (l Liquidation) String() string {
+	return fmt.Sprintf("[LIQUIDATION] %s | %s %f at %f (entry %f), loss: %f, fee: %f", l.Time.Format(time.RFC3339),
+		l.Pair, l.Quantity, l.Price, l.EntryPrice, l.Loss, l.Fee)
+}
+
+type trailingStopConfig struct {
+	percent       float64
+	atrPeriod     int
+	atrMultiplier float64
+}
+
+// Timeframes returns the timeframes supported by the data feed, or nil if unknown
+func (p *PaperWallet) Timeframes() []string {
+	if feeder, ok := p.feeder.(TimeframeSupporter); ok {
+		return feeder.Timeframes()
+	}
+	return nil
+}
+
+// Resample creates the candles of additional timeframes in the data feed, when it is a Resampler
+func (p *PaperWallet) Resample(timeframes ...string) error {
+	if feeder, ok := p.feeder.(Resampler); ok {
+		return feeder.Resample(timeframes...)
+	}
+	return nil
+}
+
+// SetCandleTimeMode sets the timestamp convention of the candles of the data feed, when it is a
+// CandleTimeModeSetter. Only the open time is supported by the other feeds
+func (p *PaperWallet) SetCandleTimeMode(mode model.CandleTimeMode) error {
+	if feeder, ok := p.feeder.(CandleTimeModeSetter); ok {
+		return feeder.SetCandleTimeMode(mode)
+	}
+	if mode == model.CandleTimeClose {
+		return fmt.Errorf("candle time mode %q not supported by the data feed", mode)
+	}
+	return nil
 }
 
 func (p *PaperWallet) AssetsInfo(pair string) model.AssetInfo {
@@ -71,6 +218,9 @@ func WithPaperAsset(pair string, amount float64) PaperWalletOption {
 	}
 }
 
+// WithPaperFee sets the maker and taker fee rates, e.g. 0.001 for 0.1%. Fees are charged in the quote asset,
+// resting limit orders pay the maker rate and orders filled immediately pay the taker rate. A negative maker
+// rate (e.g. -0.0001) is a rebate, which credits the account on every maker fill
 func WithPaperFee(maker, taker float64) PaperWalletOption {
 	return func(wallet *PaperWallet) {
 		wallet.makerFee = maker
@@ -78,6 +228,161 @@ func WithPaperFee(maker, taker float64) PaperWalletOption {
 	}
 }
 
+// WithPaperFeeSchedule overrides the fee rates of WithPaperFee for the pairs in the schedule, e.g. to model
+// pairs with zero maker fees. Pairs out of the schedule are charged with the default rates
+func WithPaperFeeSchedule(schedule model.FeeSchedule) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.feeSchedule = schedule
+	}
+}
+
+// WithPaperTrailingStop enables a trailing stop for every open position, where the stop follows the price
+// at a fixed percentage distance (eg: 0.05 = 5%). The stop starts from the entry price and ratchets with the
+// candle highs (lows for short positions). When the price crosses the stop, the position is closed, including
+// the asset locked by resting orders, and the resting orders that would close it again are canceled.
+func WithPaperTrailingStop(percent float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.trailing = &trailingStopConfig{percent: percent}
+	}
+}
+
+// WithPaperTrailingStopATR enables a trailing stop for every open position, where the stop distance is
+// a multiple of the Average True Range (ATR) of the last `period` candles.
+func WithPaperTrailingStopATR(period int, multiplier float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.trailing = &trailingStopConfig{atrPeriod: period, atrMultiplier: multiplier}
+	}
+}
+
+// WithExecutionDelay delays the execution of market orders by a given number of candles, to simulate
+// the latency between the signal and the execution. An order placed on candle N is filled with the open
+// price of candle N+k, if there are enough funds at that moment, otherwise it is rejected.
+func WithExecutionDelay(candles int) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.executionDelay = candles
+	}
+}
+
+// WithExecutionDelayDuration delays the execution of market orders by a given duration. The order is filled
+// with the open price of the first candle started after the delay.
+func WithExecutionDelayDuration(duration time.Duration) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.executionDelayDuration = duration
+	}
+}
+
+// WithSlippage fills market orders with a random adverse slippage of up to the given percent of the
+// price (e.g. 0.001 for 0.1%), drawn from the wallet random source
+func WithSlippage(percent float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.slippage = percent
+	}
+}
+
+// WithSpread fills market orders with a bid/ask spread in basis points (e.g. 10 for 0.1%), where the close price
+// is the mid price: buys are filled half the spread above the close and sells half the spread below it. The spread
+// is applied on top of the fees and slippage, with the close fill model
+func WithSpread(bps float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.spread = bps / 10000
+	}
+}
+
+// WithRandSeed sets the seed of the random source used by the stochastic features of the paper wallet,
+// so a backtest can be reproduced or sampled with a different seed. Default: DefaultRandSeed.
+// Features that use the random source:
+//   - market order slippage (WithSlippage)
+func WithRandSeed(seed int64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithFillModel sets the model used to fill market orders. Default: FillModelClose
+func WithFillModel(fillModel FillModel) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.fillModel = fillModel
+	}
+}
+
+// WithIntrabarPath sets the price path assumed inside a candle, to resolve OCO orders with both prices reached
+// in the same candle. The order whose price is reached first along the path is filled and the other is canceled,
+// a stop wins when both are reached at the same point (e.g. a gap). Default: IntrabarPathNone
+func WithIntrabarPath(path IntrabarPath) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.intrabarPath = path
+	}
+}
+
+// WithSynthesizedDepth builds a depth snapshot from each candle for pairs without a depth feed, used by
+// FillModelOrderBook. The book has the given number of levels on each side, starting at the close price
+// and spaced by step (e.g. 0.001 for 0.1%), sharing a liquidity fraction of the candle volume
+func WithSynthesizedDepth(levels int, step, liquidity float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.synthetic = &syntheticDepthConfig{levels: levels, step: step, liquidity: liquidity}
+	}
+}
+
+// WithPaperFunding emulates the funding payments of perpetual futures at every funding interval, aligned to
+// 00:00 UTC (e.g. 8h). At each funding time, the position pays the rate times its value with the open price of
+// the candle: long positions pay positive rates and short positions receive them. Payments are settled in the
+// quote asset
+func WithPaperFunding(interval time.Duration, rate FundingRateFunc) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.funding = &fundingConfig{interval: interval, rate: rate}
+	}
+}
+
+// WithPaperYield emulates the staking yield of an asset with the given annual percentage yield, e.g. 0.05 for 5%.
+// The held balance of the asset is credited every day at 00:00 UTC with the daily rate of the APY, compounded
+// daily, so buy and hold and accumulation backtests include the staking returns
+func WithPaperYield(asset string, apy float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.yields[strings.ToUpper(asset)] = apy
+	}
+}
+
+// WithIdealComparison runs an ideal shadow of the wallet in the same run: a second paper wallet with the same
+// assets, which receives the same candles and a copy of every order, filled without fees, spread, slippage,
+// execution delay and order book walk, i.e. the market orders are filled at the close price of the order candle.
+// The summary and the stats report the ideal equity and returns side by side with the realistic ones, and the
+// execution drag between them
+func WithIdealComparison() PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.idealShadow = true
+	}
+}
+
+// WithBenchmarkWeights sets the weights of the pairs in the buy and hold benchmark of the stats, e.g. 0.6 BTCUSDT
+// and 0.4 ETHUSDT. The weights are normalized by their sum and the pairs without weight are not included.
+// Default: equal weights of all pairs
+func WithBenchmarkWeights(weights map[string]float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.benchmark = weights
+	}
+}
+
+// WithPaperLeverage emulates leveraged futures positions. Entries require only the notional value divided by the
+// leverage (e.g. 10 for 10x) of free margin, which is the whole equity minus the margin of the open positions, as
+// in cross margin. A position is liquidated when a candle crosses its liquidation price, where the position margin
+// minus the loss reaches the maintenance margin rate (e.g. 0.005 for 0.5%) of its value, as in isolated margin:
+// the open orders of the pair are canceled and the position is closed at the liquidation price, paying the taker
+// fee. The closing order is reported to the order controller, see exchange.ForcedOrdersFetcher
+func WithPaperLeverage(leverage, maintenanceMargin float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.leverage = leverage
+		wallet.maintenanceMargin = maintenanceMargin
+	}
+}
+
+// WithPaperLiquidationHandler calls the handler for each position liquidated by the wallet, e.g. to send a
+// notification. See WithPaperLeverage
+func WithPaperLiquidationHandler(handler func(Liquidation)) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.onLiquidation = handler
+	}
+}
+
 func WithDataFeed(feeder service.Feeder) PaperWalletOption {
 	return func(wallet *PaperWallet) {
 		wallet.feeder = feeder
@@ -85,6 +390,19 @@ func WithDataFeed(feeder service.Feeder) PaperWalletOption {
 }
 
 func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWalletOption) *PaperWallet {
+	wallet := newPaperWallet(ctx, baseCoin, options...)
+	if wallet.idealShadow {
+		wallet.ideal = newIdealWallet(ctx, baseCoin, options...)
+		wallet.idealOrders = make(map[int64]int64)
+	}
+
+	log.Info("[SETUP] Using paper wallet")
+	log.Infof("[SETUP] Initial Portfolio = %f %s", wallet.initialValue, wallet.baseCoin)
+
+	return wallet
+}
+
+func newPaperWallet(ctx context.Context, baseCoin string, options ...PaperWalletOption) *PaperWallet {
 	wallet := PaperWallet{
 		ctx:           ctx,
 		baseCoin:      baseCoin,
@@ -95,8 +413,25 @@ func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWallet
 		avgShortPrice: make(map[string]float64),
 		avgLongPrice:  make(map[string]float64),
 		volume:        make(map[string]float64),
+		fees:          make(map[string]float64),
 		assetValues:   make(map[string][]AssetValue),
 		equityValues:  make([]AssetValue, 0),
+		trailingStops: make(map[string]float64),
+		trueRanges:    make(map[string][]float64),
+		trailingOCO:   make(map[int64]float64),
+		trailingRates: make(map[int64]float64),
+		brackets:      make(map[int64]int64),
+		candleCount:   make(map[string]int),
+		delayedOrders: make(map[int64]int),
+		rand:          rand.New(rand.NewSource(DefaultRandSeed)),
+		fillModel:     FillModelClose,
+		depths:        make(map[string]*model.Depth),
+		depthFeed:     make(map[string]bool),
+		lastFunding:   make(map[string]time.Time),
+		fundingPaid:   make(map[string]float64),
+		yields:        make(map[string]float64),
+		yieldPaid:     make(map[string]float64),
+		slippageCost:  make(map[string]float64),
 	}
 
 	for _, option := range options {
@@ -104,18 +439,77 @@ func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWallet
 	}
 
 	wallet.initialValue = wallet.assets[wallet.baseCoin].Free
-	log.Info("[SETUP] Using paper wallet")
-	log.Infof("[SETUP] Initial Portfolio = %f %s", wallet.initialValue, wallet.baseCoin)
-
 	return &wallet
 }
 
+// newIdealWallet creates the ideal shadow of a wallet with the same options, without the execution costs, see
+// WithIdealComparison
+func newIdealWallet(ctx context.Context, baseCoin string, options ...PaperWalletOption) *PaperWallet {
+	wallet := newPaperWallet(ctx, baseCoin, options...)
+	wallet.idealShadow = false
+	wallet.feeder = nil
+	wallet.makerFee = 0
+	wallet.takerFee = 0
+	wallet.feeSchedule = nil
+	wallet.slippage = 0
+	wallet.spread = 0
+	wallet.fillModel = FillModelClose
+	wallet.synthetic = nil
+	wallet.executionDelay = 0
+	wallet.executionDelayDuration = 0
+	wallet.onLiquidation = nil
+	return wallet
+}
+
+// shadowOrders repeats orders of the wallet in the ideal shadow and links their IDs, see WithIdealComparison
+func (p *PaperWallet) shadowOrders(orders []model.Order, create func(ideal *PaperWallet) ([]model.Order, error)) {
+	if p.ideal == nil {
+		return
+	}
+
+	shadows, err := create(p.ideal)
+	if err != nil {
+		log.Warnf("paper wallet: ideal comparison: %v", err)
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	for i := 0; i < len(orders) && i < len(shadows); i++ {
+		p.idealOrders[orders[i].ExchangeID] = shadows[i].ExchangeID
+	}
+}
+
+// shadowOrder repeats an order of the wallet in the ideal shadow, see shadowOrders
+func (p *PaperWallet) shadowOrder(order model.Order, create func(ideal *PaperWallet) (model.Order, error)) {
+	p.shadowOrders([]model.Order{order}, func(ideal *PaperWallet) ([]model.Order, error) {
+		shadow, err := create(ideal)
+		return []model.Order{shadow}, err
+	})
+}
+
+// idealOrder returns the copy of an order in the ideal shadow, see shadowOrders
+func (p *PaperWallet) idealOrder(order model.Order) (model.Order, bool) {
+	if p.ideal == nil {
+		return model.Order{}, false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	id, ok := p.idealOrders[order.ExchangeID]
+	order.ExchangeID = id
+	return order, ok
+}
+
 func (p *PaperWallet) ID() int64 {
-	p.counter++
-	return p.counter
+	return atomic.AddInt64(&p.counter, 1)
 }
 
 func (p *PaperWallet) Pairs() []string {
+	p.Lock()
+	defer p.Unlock()
+
 	pairs := make([]string, 0)
 	for pair := range p.assets {
 		pairs = append(pairs, pair)
@@ -127,40 +521,102 @@ func (p *PaperWallet) LastQuote(ctx context.Context, pair string) (float64, erro
 	return p.feeder.LastQuote(ctx, pair)
 }
 
+// LastPrice returns the close price of the last candle of the pair received by the wallet
+func (p *PaperWallet) LastPrice(pair string) (float64, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	candle, ok := p.lastCandle[pair]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+	}
+	return candle.Close, nil
+}
+
+// AssetValues returns a copy of the asset value history, safe to be used concurrently with the wallet
 func (p *PaperWallet) AssetValues(pair string) []AssetValue {
-	return p.assetValues[pair]
+	p.Lock()
+	defer p.Unlock()
+
+	values := make([]AssetValue, len(p.assetValues[pair]))
+	copy(values, p.assetValues[pair])
+	return values
 }
 
+// EquityValues returns a copy of the equity history, safe to be used concurrently with the wallet
 func (p *PaperWallet) EquityValues() []AssetValue {
-	return p.equityValues
+	p.Lock()
+	defer p.Unlock()
+
+	values := make([]AssetValue, len(p.equityValues))
+	copy(values, p.equityValues)
+	return values
+}
+
+// IdealEquityValues returns a copy of the equity history of the ideal shadow, see WithIdealComparison
+func (p *PaperWallet) IdealEquityValues() []AssetValue {
+	if p.ideal == nil {
+		return nil
+	}
+	return p.ideal.EquityValues()
+}
+
+// Equity returns the last total value of the wallet in the base coin, updated on every complete candle
+func (p *PaperWallet) Equity() float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.equityValues) == 0 {
+		return p.initialValue
+	}
+	return p.equityValues[len(p.equityValues)-1].Value
+}
+
+// InitialValue returns the initial value of the wallet in the base coin
+func (p *PaperWallet) InitialValue() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.initialValue
 }
 
 func (p *PaperWallet) MaxDrawdown() (float64, time.Time, time.Time) {
-	if len(p.equityValues) < 1 {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.maxDrawdown()
+}
+
+func (p *PaperWallet) maxDrawdown() (float64, time.Time, time.Time) {
+	return maxDrawdown(p.equityValues)
+}
+
+// maxDrawdown returns the largest decline of the equity values, with its start and end time
+func maxDrawdown(values []AssetValue) (float64, time.Time, time.Time) {
+	if len(values) < 1 {
 		return 0, time.Time{}, time.Time{}
 	}
 
 	localMin := math.MaxFloat64
-	localMinBase := p.equityValues[0].Value
-	localMinStart := p.equityValues[0].Time
-	localMinEnd := p.equityValues[0].Time
+	localMinBase := values[0].Value
+	localMinStart := values[0].Time
+	localMinEnd := values[0].Time
 
 	globalMin := localMin
 	globalMinBase := localMinBase
 	globalMinStart := localMinStart
 	globalMinEnd := localMinEnd
 
-	for i := 1; i < len(p.equityValues); i++ {
-		diff := p.equityValues[i].Value - p.equityValues[i-1].Value
+	for i := 1; i < len(values); i++ {
+		diff := values[i].Value - values[i-1].Value
 
 		if localMin > 0 {
 			localMin = diff
-			localMinBase = p.equityValues[i-1].Value
-			localMinStart = p.equityValues[i-1].Time
-			localMinEnd = p.equityValues[i].Time
+			localMinBase = values[i-1].Value
+			localMinStart = values[i-1].Time
+			localMinEnd = values[i].Time
 		} else {
 			localMin += diff
-			localMinEnd = p.equityValues[i].Time
+			localMinEnd = values[i].Time
 		}
 
 		if localMin < globalMin {
@@ -174,16 +630,95 @@ func (p *PaperWallet) MaxDrawdown() (float64, time.Time, time.Time) {
 	return globalMin / globalMinBase, globalMinStart, globalMinEnd
 }
 
-func (p *PaperWallet) Summary() {
-	var (
-		total        float64
-		marketChange float64
-		volume       float64
-	)
+// WalletStats are the final balances and the performance of the paper wallet, in the base coin
+type WalletStats struct {
+	BaseCoin string       `json:"base_coin"`
+	Assets   []AssetStats `json:"assets"`
+	// Balance is the final amount of the base coin
+	Balance    float64 `json:"balance"`
+	StartValue float64 `json:"start_value"`
+	FinalValue float64 `json:"final_value"`
+	Profit     float64 `json:"profit"`
+	// Return is the profit relative to the start value, e.g. 0.1 for 10%
+	Return float64 `json:"return"`
+	// MarketChange is the average change of the pairs prices (buy and hold), e.g. 0.1 for 10%
+	MarketChange float64 `json:"market_change"`
+	// MaxDrawdown is the largest decline of the equity, as a negative percentage (e.g. -0.2 for 20%)
+	MaxDrawdown float64            `json:"max_drawdown"`
+	Volume      map[string]float64 `json:"volume"`
+	// Fees are the net fees by pair, negative for maker rebates
+	Fees map[string]float64 `json:"fees"`
+	// Funding are the net funding payments by pair, only with WithPaperFunding
+	Funding map[string]float64 `json:"funding,omitempty"`
+	// Yield is the staking yield credited by asset, in the asset quantity, only with WithPaperYield
+	Yield           map[string]float64 `json:"yield,omitempty"`
+	Liquidations    int                `json:"liquidations"`
+	LiquidationLoss float64            `json:"liquidation_loss"`
+	// Slippage is the execution cost of the market fills by pair, the price paid above (or received below) the
+	// close price of the order candle, with the spread, the slippage and the order book walk
+	Slippage map[string]float64 `json:"slippage"`
+	// Ideal are the returns of the ideal shadow of the wallet, only with WithIdealComparison
+	Ideal *IdealStats `json:"ideal,omitempty"`
+	// Benchmark is the buy and hold of the pairs in the same period, nil without candles
+	Benchmark *BenchmarkStats `json:"benchmark,omitempty"`
+}
+
+// BenchmarkStats compares the wallet with buying and holding the traded pairs from the first to the last candle,
+// see WithBenchmarkWeights
+type BenchmarkStats struct {
+	// Pairs are the buy and hold returns of each pair, e.g. 0.1 for 10%
+	Pairs map[string]float64 `json:"pairs"`
+	// Weights are the normalized weights of the pairs in the basket
+	Weights map[string]float64 `json:"weights"`
+	// Return is the weighted average of the pairs returns
+	Return float64 `json:"return"`
+	// Alpha is the wallet return minus the benchmark return, positive when the strategy beat the benchmark
+	Alpha float64 `json:"alpha"`
+}
+
+// IdealStats are the returns of the wallet without execution costs, see WithIdealComparison
+type IdealStats struct {
+	FinalValue  float64 `json:"final_value"`
+	Profit      float64 `json:"profit"`
+	Return      float64 `json:"return"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	// ExecutionDrag is the profit lost to the fees and the slippage, the ideal profit minus the realistic profit
+	ExecutionDrag float64 `json:"execution_drag"`
+}
+
+// AssetStats is the final position of an asset, valued in the quote of its pair
+type AssetStats struct {
+	Asset    string  `json:"asset"`
+	Quote    string  `json:"quote"`
+	Quantity float64 `json:"quantity"`
+	Value    float64 `json:"value"`
+}
+
+// Stats returns the final balances and the performance of the wallet, the data of Summary
+func (p *PaperWallet) Stats() WalletStats {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := WalletStats{
+		BaseCoin:   p.baseCoin,
+		StartValue: p.initialValue,
+		Volume:     make(map[string]float64),
+		Fees:       make(map[string]float64),
+		Slippage:   make(map[string]float64),
+	}
 
-	fmt.Println("-- FINAL WALLET --")
+	var total, marketChange float64
+	changes := make(map[string]float64, len(p.lastCandle))
+	pairs := make([]string, 0, len(p.lastCandle))
 	for pair := range p.lastCandle {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	for _, pair := range pairs {
 		asset, quote := SplitAssetQuote(pair)
+		changes[pair] = (p.lastCandle[pair].Close - p.fistCandle[pair].Close) / p.fistCandle[pair].Close
+		marketChange += changes[pair]
 		assetInfo, ok := p.assets[asset]
 		if !ok {
 			continue
@@ -196,32 +731,189 @@ func (p *PaperWallet) Summary() {
 			value = math.Abs(totalShort)
 		}
 		total += value
-		marketChange += (p.lastCandle[pair].Close - p.fistCandle[pair].Close) / p.fistCandle[pair].Close
-		fmt.Printf("%.4f %s = %.4f %s\n", quantity, asset, total, quote)
-	}
-
-	avgMarketChange := marketChange / float64(len(p.lastCandle))
-	baseCoinValue := p.assets[p.baseCoin].Free + p.assets[p.baseCoin].Lock
-	profit := total + baseCoinValue - p.initialValue
-	fmt.Printf("%.4f %s\n", baseCoinValue, p.baseCoin)
-	fmt.Println()
-	maxDrawDown, _, _ := p.MaxDrawdown()
-	fmt.Println("----- RETURNS -----")
-	fmt.Printf("START PORTFOLIO     = %.2f %s\n", p.initialValue, p.baseCoin)
-	fmt.Printf("FINAL PORTFOLIO     = %.2f %s\n", total+baseCoinValue, p.baseCoin)
-	fmt.Printf("GROSS PROFIT        =  %f %s (%.2f%%)\n", profit, p.baseCoin, profit/p.initialValue*100)
-	fmt.Printf("MARKET CHANGE (B&H) =  %.2f%%\n", avgMarketChange*100)
-	fmt.Println()
-	fmt.Println("------ RISK -------")
-	fmt.Printf("MAX DRAWDOWN = %.2f %%\n", maxDrawDown*100)
-	fmt.Println()
-	fmt.Println("------ VOLUME -----")
+		stats.Assets = append(stats.Assets, AssetStats{Asset: asset, Quote: quote, Quantity: quantity, Value: value})
+	}
+
+	if len(p.lastCandle) > 0 {
+		stats.MarketChange = marketChange / float64(len(p.lastCandle))
+	}
+
+	if info, ok := p.assets[p.baseCoin]; ok {
+		stats.Balance = info.Free + info.Lock
+	}
+	stats.FinalValue = total + stats.Balance
+	stats.Profit = stats.FinalValue - p.initialValue
+	if p.initialValue > 0 {
+		stats.Return = stats.Profit / p.initialValue
+	}
+	stats.MaxDrawdown, _, _ = p.maxDrawdown()
+	stats.Benchmark = NewBenchmarkStats(changes, p.benchmark, stats.Return)
+
 	for pair, vol := range p.volume {
-		volume += vol
-		fmt.Printf("%s         = %.2f %s\n", pair, vol, p.baseCoin)
+		stats.Volume[pair] = vol
+	}
+	for pair, fee := range p.fees {
+		stats.Fees[pair] = fee
+	}
+	for pair, cost := range p.slippageCost {
+		stats.Slippage[pair] = cost
 	}
-	fmt.Printf("TOTAL           = %.2f %s\n", volume, p.baseCoin)
-	fmt.Println("-------------------")
+	if p.ideal != nil {
+		idealStats := p.ideal.Stats()
+		stats.Ideal = &IdealStats{
+			FinalValue:    idealStats.FinalValue,
+			Profit:        idealStats.Profit,
+			Return:        idealStats.Return,
+			MaxDrawdown:   idealStats.MaxDrawdown,
+			ExecutionDrag: idealStats.FinalValue - stats.FinalValue,
+		}
+	}
+	if p.funding != nil {
+		stats.Funding = make(map[string]float64)
+		for pair, paid := range p.fundingPaid {
+			stats.Funding[pair] = paid
+		}
+	}
+	if len(p.yields) > 0 {
+		stats.Yield = make(map[string]float64)
+		for asset, credit := range p.yieldPaid {
+			stats.Yield[asset] = credit
+		}
+	}
+
+	stats.Liquidations = len(p.liquidations)
+	for _, liquidation := range p.liquidations {
+		stats.LiquidationLoss += liquidation.Loss + liquidation.Fee
+	}
+	return stats
+}
+
+// NewBenchmarkStats returns the buy and hold of the pairs changes weighted by the given weights, with equal
+// weights when nil, and the alpha of the given return. It returns nil without changes or weights
+func NewBenchmarkStats(changes, pairWeights map[string]float64, walletReturn float64) *BenchmarkStats {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	weights := make(map[string]float64, len(changes))
+	var sum float64
+	for pair := range changes {
+		weight := 1.0
+		if pairWeights != nil {
+			weight = math.Max(pairWeights[pair], 0)
+		}
+		weights[pair] = weight
+		sum += weight
+	}
+
+	if sum == 0 {
+		return nil
+	}
+
+	benchmark := &BenchmarkStats{Pairs: changes, Weights: weights}
+	for pair, change := range changes {
+		weights[pair] /= sum
+		benchmark.Return += weights[pair] * change
+	}
+	benchmark.Alpha = walletReturn - benchmark.Return
+	return benchmark
+}
+
+// Summary prints the final wallet, returns, risk, volume and fees in stdout
+func (p *PaperWallet) Summary() {
+	p.SummaryTo(os.Stdout)
+}
+
+// SummaryTo writes the summary of the wallet, see Summary
+func (p *PaperWallet) SummaryTo(w io.Writer) {
+	stats := p.Stats()
+
+	fmt.Fprintln(w, "-- FINAL WALLET --")
+	for _, asset := range stats.Assets {
+		fmt.Fprintf(w, "%.4f %s = %.4f %s\n", asset.Quantity, asset.Asset, asset.Value, asset.Quote)
+	}
+	fmt.Fprintf(w, "%.4f %s\n", stats.Balance, p.baseCoin)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "----- RETURNS -----")
+	fmt.Fprintf(w, "START PORTFOLIO     = %.2f %s\n", stats.StartValue, p.baseCoin)
+	fmt.Fprintf(w, "FINAL PORTFOLIO     = %.2f %s\n", stats.FinalValue, p.baseCoin)
+	fmt.Fprintf(w, "GROSS PROFIT        =  %f %s (%.2f%%)\n", stats.Profit, p.baseCoin, stats.Return*100)
+	fmt.Fprintf(w, "MARKET CHANGE (B&H) =  %.2f%%\n", stats.MarketChange*100)
+	fmt.Fprintln(w)
+	if stats.Benchmark != nil {
+		fmt.Fprintln(w, "---- BENCHMARK ----")
+		pairs := make([]string, 0, len(stats.Benchmark.Pairs))
+		for pair := range stats.Benchmark.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Strings(pairs)
+		for _, pair := range pairs {
+			fmt.Fprintf(w, "%s (B&H)     = %.2f%% (weight %.2f)\n", pair, stats.Benchmark.Pairs[pair]*100,
+				stats.Benchmark.Weights[pair])
+		}
+		fmt.Fprintf(w, "BENCHMARK RETURN    = %.2f%%\n", stats.Benchmark.Return*100)
+		fmt.Fprintf(w, "STRATEGY RETURN     = %.2f%%\n", stats.Return*100)
+		fmt.Fprintf(w, "ALPHA               = %.2f%%\n", stats.Benchmark.Alpha*100)
+		fmt.Fprintln(w)
+	}
+	if stats.Ideal != nil {
+		fmt.Fprintln(w, "-- IDEAL RETURNS --")
+		fmt.Fprintf(w, "FINAL PORTFOLIO     = %.2f %s\n", stats.Ideal.FinalValue, p.baseCoin)
+		fmt.Fprintf(w, "GROSS PROFIT        =  %f %s (%.2f%%)\n", stats.Ideal.Profit, p.baseCoin,
+			stats.Ideal.Return*100)
+		fmt.Fprintf(w, "MAX DRAWDOWN        = %.2f %%\n", stats.Ideal.MaxDrawdown*100)
+		fmt.Fprintf(w, "EXECUTION DRAG      = %.2f %s (%.2f%%)\n", stats.Ideal.ExecutionDrag, p.baseCoin,
+			(stats.Ideal.Return-stats.Return)*100)
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "------ RISK -------")
+	fmt.Fprintf(w, "MAX DRAWDOWN = %.2f %%\n", stats.MaxDrawdown*100)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "------ VOLUME -----")
+	fprintPairValues(w, stats.Volume, p.baseCoin)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "---- FEES (NET) ---")
+	fprintPairValues(w, stats.Fees, p.baseCoin)
+	if stats.Funding != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "--- FUNDING (NET) -")
+		fprintPairValues(w, stats.Funding, p.baseCoin)
+	}
+	if stats.Yield != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "------ YIELD ------")
+		assets := make([]string, 0, len(stats.Yield))
+		for asset := range stats.Yield {
+			assets = append(assets, asset)
+		}
+		sort.Strings(assets)
+		for _, asset := range assets {
+			fmt.Fprintf(w, "%.8f %s\n", stats.Yield[asset], asset)
+		}
+	}
+	if p.leveraged() {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "-- LIQUIDATIONS ---")
+		fmt.Fprintf(w, "COUNT           = %d\n", stats.Liquidations)
+		fmt.Fprintf(w, "TOTAL LOSS      = %.2f %s\n", stats.LiquidationLoss, p.baseCoin)
+	}
+	fmt.Fprintln(w, "-------------------")
+}
+
+// fprintPairValues writes the values by pair, sorted by pair, and their total
+func fprintPairValues(w io.Writer, values map[string]float64, coin string) {
+	pairs := make([]string, 0, len(values))
+	for pair := range values {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	var total float64
+	for _, pair := range pairs {
+		total += values[pair]
+		fmt.Fprintf(w, "%s         = %.2f %s\n", pair, values[pair], coin)
+	}
+	fmt.Fprintf(w, "TOTAL           = %.2f %s\n", total, coin)
 }
 
 func (p *PaperWallet) validateFunds(side model.SideType, pair string, amount, value float64, fill bool) error {
@@ -234,13 +926,28 @@ func (p *PaperWallet) validateFunds(side model.SideType, pair string, amount, va
 		p.assets[quote] = &assetInfo{}
 	}
 
+	// the fee of the fill is debited from the quote balance, so it must be covered as well when the order
+	// takes quote funds. Resting orders are checked with the maker rate and fills with the taker rate
+	fee := math.Max(amount*value*p.feeRate(pair, !fill), 0)
+
 	funds := p.assets[quote].Free
 	if side == model.SideTypeSell {
 		if p.assets[asset].Free > 0 {
 			funds += p.assets[asset].Free * value
 		}
 
-		if funds < amount*value {
+		// with leverage, only the short part of the order requires margin
+		short := math.Max(amount-math.Max(p.assets[asset].Free, 0), 0)
+		if short == 0 { // the fee of a long liquidation is paid with the proceeds
+			fee = 0
+		}
+
+		insufficient := funds < amount*value+fee
+		if p.leveraged() {
+			insufficient = short > 0 && short*value/p.leverage+fee > p.availableMargin()
+		}
+
+		if insufficient {
 			return &OrderError{
 				Err:      ErrInsufficientFunds,
 				Pair:     pair,
@@ -280,7 +987,16 @@ func (p *PaperWallet) validateFunds(side model.SideType, pair string, amount, va
 			amountToBuy = amount + p.assets[asset].Free
 		}
 
-		if funds < amountToBuy*value {
+		if amountToBuy <= 0 { // the fee of a short liquidation is paid with the released margin
+			fee = 0
+		}
+
+		insufficient := funds < amountToBuy*value+fee
+		if p.leveraged() {
+			insufficient = amountToBuy > 0 && amountToBuy*value/p.leverage+fee > p.availableMargin()
+		}
+
+		if insufficient {
 			return &OrderError{
 				Err:      ErrInsufficientFunds,
 				Pair:     pair,
@@ -307,22 +1023,202 @@ func (p *PaperWallet) validateFunds(side model.SideType, pair string, amount, va
 	return nil
 }
 
-func (p *PaperWallet) updateAveragePrice(side model.SideType, pair string, amount, value float64) {
-	actualQty := 0.0
-	asset, quote := SplitAssetQuote(pair)
+// isMakerOrder returns true for resting orders that add liquidity to the book when filled
+func isMakerOrder(orderType model.OrderType) bool {
+	return orderType == model.OrderTypeLimit || orderType == model.OrderTypeLimitMaker ||
+		orderType == model.OrderTypeTakeProfitLimit
+}
 
-	if p.assets[asset] != nil {
-		actualQty = p.assets[asset].Free
+// feeRate returns the maker or taker fee rate of the pair
+func (p *PaperWallet) feeRate(pair string, maker bool) float64 {
+	makerFee, takerFee := p.feeSchedule.Rates(pair, p.makerFee, p.takerFee)
+	if maker {
+		return makerFee
 	}
+	return takerFee
+}
 
-	// without previous position
-	if actualQty == 0 {
-		if side == model.SideTypeBuy {
-			p.avgLongPrice[pair] = value
-		} else {
-			p.avgShortPrice[pair] = value
-		}
-		return
+// chargeFee debits the fee of a fill from the quote balance and returns it. A negative rate is a rebate,
+// credited to the quote balance and returned as a negative fee
+func (p *PaperWallet) chargeFee(pair string, volume float64, maker bool) float64 {
+	fee := volume * p.feeRate(pair, maker)
+	if fee == 0 {
+		return 0
+	}
+
+	_, quote := SplitAssetQuote(pair)
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+
+	p.assets[quote].Free -= fee
+	p.fees[pair] += fee
+	return fee
+}
+
+// chargeSlippage records the execution cost of a market fill at price, compared to the reference price
+func (p *PaperWallet) chargeSlippage(side model.SideType, pair string, quantity, price, reference float64) {
+	cost := (price - reference) * quantity
+	if side == model.SideTypeSell {
+		cost = -cost
+	}
+	p.slippageCost[pair] += cost
+}
+
+// settleFunding pays the funding of the funding times since the last candle of the pair, with the current
+// position. The first candle of a pair only sets the funding period
+func (p *PaperWallet) settleFunding(candle model.Candle) {
+	period := candle.Time.Truncate(p.funding.interval)
+	last, ok := p.lastFunding[candle.Pair]
+	p.lastFunding[candle.Pair] = period
+	if !ok || !period.After(last) {
+		return
+	}
+
+	asset, quote := SplitAssetQuote(candle.Pair)
+	info, ok := p.assets[asset]
+	if !ok || info.Free+info.Lock == 0 {
+		return
+	}
+
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+
+	position := info.Free + info.Lock
+	for t := last.Add(p.funding.interval); !t.After(period); t = t.Add(p.funding.interval) {
+		payment := position * candle.Open * p.funding.rate(candle.Pair, t)
+		p.assets[quote].Free -= payment
+		p.fundingPaid[candle.Pair] += payment
+	}
+}
+
+// accrueYield credits the staking yield of the days since the last candle, with the current balances. The first
+// candle only sets the day, see WithPaperYield
+func (p *PaperWallet) accrueYield(candle model.Candle) {
+	day := candle.Time.UTC().Truncate(24 * time.Hour)
+	last := p.yieldDay
+	if last.IsZero() || day.After(last) {
+		p.yieldDay = day
+	}
+	if last.IsZero() || !day.After(last) {
+		return
+	}
+
+	days := int(day.Sub(last) / (24 * time.Hour))
+	for asset, apy := range p.yields {
+		info, ok := p.assets[asset]
+		if !ok || info.Free+info.Lock <= 0 {
+			continue
+		}
+
+		rate := math.Pow(1+apy, 1.0/365) - 1
+		credit := (info.Free + info.Lock) * (math.Pow(1+rate, float64(days)) - 1)
+		info.Free += credit
+		p.yieldPaid[asset] += credit
+	}
+}
+
+// Yield returns the staking yield credited to the asset, in the asset quantity, see WithPaperYield
+func (p *PaperWallet) Yield(asset string) float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.yieldPaid[strings.ToUpper(asset)]
+}
+
+// Funding returns the net funding paid in the quote asset of the pair, negative when the position received
+// more funding than it paid
+func (p *PaperWallet) Funding(pair string) float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.fundingPaid[pair]
+}
+
+// FundingRate returns the funding rate of the next funding time of the pair, see WithPaperFunding
+func (p *PaperWallet) FundingRate(pair string) (float64, time.Time, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.funding == nil || p.funding.interval <= 0 {
+		return 0, time.Time{}, errors.New("paper wallet: funding not configured")
+	}
+
+	candle, ok := p.lastCandle[pair]
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+	}
+
+	next := candle.Time.Truncate(p.funding.interval).Add(p.funding.interval)
+	return p.funding.rate(pair, next), next, nil
+}
+
+// Fees returns the net fees paid in the quote asset of the pair, negative when rebates exceed the fees
+func (p *PaperWallet) Fees(pair string) float64 {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.fees[pair]
+}
+
+// Trades returns the fills of the orders of the pair, up to the limit, with the fee charged in the quote asset
+func (p *PaperWallet) Trades(pair string, limit int) ([]model.Trade, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	_, quote := SplitAssetQuote(pair)
+	trades := make([]model.Trade, 0)
+	for _, order := range p.orders {
+		quantity := order.Quantity
+		if order.Status != model.OrderStatusTypeFilled {
+			quantity = order.ExecutedQuantity
+		}
+
+		if order.Pair != pair || quantity <= 0 {
+			continue
+		}
+
+		trades = append(trades, model.Trade{
+			Pair:            order.Pair,
+			ID:              order.ExchangeID,
+			Price:           order.Price,
+			Quantity:        quantity,
+			Time:            order.UpdatedAt,
+			OrderID:         order.ExchangeID,
+			Side:            order.Side,
+			IsMaker:         isMakerOrder(order.Type),
+			Commission:      order.Fee,
+			CommissionAsset: quote,
+		})
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Time.Before(trades[j].Time)
+	})
+
+	if limit > 0 && len(trades) > limit {
+		trades = trades[len(trades)-limit:]
+	}
+	return trades, nil
+}
+
+func (p *PaperWallet) updateAveragePrice(side model.SideType, pair string, amount, value float64) {
+	actualQty := 0.0
+	asset, quote := SplitAssetQuote(pair)
+
+	if p.assets[asset] != nil {
+		actualQty = p.assets[asset].Free
+	}
+
+	// without previous position
+	if actualQty == 0 {
+		if side == model.SideTypeBuy {
+			p.avgLongPrice[pair] = value
+		} else {
+			p.avgShortPrice[pair] = value
+		}
+		return
 	}
 
 	// actual long + order buy
@@ -370,16 +1266,58 @@ func (p *PaperWallet) updateAveragePrice(side model.SideType, pair string, amoun
 }
 
 func (p *PaperWallet) OnCandle(candle model.Candle) {
+	if p.ideal != nil {
+		p.ideal.OnCandle(candle)
+	}
+
+	// the handler is called after the wallet is unlocked, so it can use the wallet
+	defer p.notifyLiquidations()
+
 	p.Lock()
 	defer p.Unlock()
 
+	if p.trailing != nil && candle.Complete {
+		p.updateTrueRange(candle)
+	}
+
+	if last, ok := p.lastCandle[candle.Pair]; !ok || !last.Time.Equal(candle.Time) {
+		p.candleCount[candle.Pair]++
+	}
+
 	p.lastCandle[candle.Pair] = candle
 	if _, ok := p.fistCandle[candle.Pair]; !ok {
 		p.fistCandle[candle.Pair] = candle
 	}
 
+	if p.synthetic != nil && !p.depthFeed[candle.Pair] {
+		if candle.Volume > 0 {
+			p.depths[candle.Pair] = p.synthesizeDepth(candle)
+		} else {
+			delete(p.depths, candle.Pair)
+		}
+	}
+
+	if p.funding != nil && p.funding.interval > 0 {
+		p.settleFunding(candle)
+	}
+
+	if len(p.yields) > 0 {
+		p.accrueYield(candle)
+	}
+
+	p.expirePartialFills(candle)
+	p.fillDelayedOrders(candle)
+
+	// the brackets of the entries filled by the candle are placed after it
+	var filledEntries []model.Order
 	for i, order := range p.orders {
-		if order.Pair != candle.Pair || order.Status != model.OrderStatusTypeNew {
+		if order.Pair != candle.Pair || order.Status != model.OrderStatusTypeNew ||
+			order.Type == model.OrderTypeMarket {
+			continue
+		}
+
+		if order.Type == model.OrderTypeTrailingStopMarket {
+			p.updateTrailingStopOrder(&p.orders[i], candle)
 			continue
 		}
 
@@ -401,11 +1339,21 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 			p.updateAveragePrice(order.Side, order.Pair, order.Quantity, order.Price)
 			p.assets[asset].Free = p.assets[asset].Free + order.Quantity
 			p.assets[quote].Lock = p.assets[quote].Lock - order.Price*order.Quantity
+			p.orders[i].Fee = p.chargeFee(order.Pair, order.Price*order.Quantity, isMakerOrder(order.Type))
+			if _, ok := p.brackets[order.ExchangeID]; ok {
+				filledEntries = append(filledEntries, order)
+			}
 		}
 
 		if order.Side == model.SideTypeSell {
 			var orderPrice float64
-			if (order.Type == model.OrderTypeLimit ||
+			if trail, ok := p.trailingOCO[order.ExchangeID]; ok {
+				price, triggered := p.updateTrailingOCO(&p.orders[i], trail, candle)
+				if !triggered {
+					continue
+				}
+				orderPrice = price
+			} else if (order.Type == model.OrderTypeLimit ||
 				order.Type == model.OrderTypeLimitMaker ||
 				order.Type == model.OrderTypeTakeProfit ||
 				order.Type == model.OrderTypeTakeProfitLimit) &&
@@ -419,6 +1367,16 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 				continue
 			}
 
+			// the triggered trailing leg is checked with its trailing stop, kept until the fill
+			if !p.filledFirst(p.orders[i], candle) {
+				continue
+			}
+
+			if _, ok := p.trailingOCO[order.ExchangeID]; ok {
+				p.orders[i].Price = orderPrice
+				delete(p.trailingOCO, order.ExchangeID)
+			}
+
 			// Cancel other orders from same group
 			if order.GroupID != nil {
 				for j, groupOrder := range p.orders {
@@ -426,6 +1384,7 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 						groupOrder.ExchangeID != order.ExchangeID {
 						p.orders[j].Status = model.OrderStatusTypeCanceled
 						p.orders[j].UpdatedAt = candle.Time
+						delete(p.trailingOCO, groupOrder.ExchangeID)
 						break
 					}
 				}
@@ -445,70 +1404,855 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 			p.updateAveragePrice(order.Side, order.Pair, order.Quantity, orderPrice)
 			p.assets[asset].Lock = p.assets[asset].Lock - order.Quantity
 			p.assets[quote].Free = p.assets[quote].Free + order.Quantity*orderPrice
+			p.orders[i].Fee = p.chargeFee(order.Pair, orderVolume, isMakerOrder(order.Type))
+		}
+	}
+
+	for _, entry := range filledEntries {
+		p.activateBrackets(entry, candle)
+	}
+
+	if p.trailing != nil {
+		p.updateTrailingStop(candle)
+	}
+
+	if p.leveraged() {
+		p.checkLiquidation(candle)
+	}
+
+	if candle.Complete {
+		for asset, info := range p.assets {
+			amount := info.Free + info.Lock
+			pair := strings.ToUpper(asset + p.baseCoin)
+			p.assetValues[asset] = append(p.assetValues[asset], AssetValue{
+				Time:  candle.Time,
+				Value: amount * p.lastCandle[pair].Close,
+			})
+		}
+
+		p.equityValues = append(p.equityValues, AssetValue{
+			Time:  candle.Time,
+			Value: p.equity(),
+		})
+	}
+}
+
+// equity returns the total value of the wallet in the base coin with the last prices, short positions are
+// valued by their liquid value
+func (p *PaperWallet) equity() float64 {
+	var total float64
+	for asset, info := range p.assets {
+		amount := info.Free + info.Lock
+		pair := strings.ToUpper(asset + p.baseCoin)
+		if amount < 0 {
+			v := math.Abs(amount)
+			total += 2*v*p.avgShortPrice[pair] - v*p.lastCandle[pair].Close
+		} else {
+			total += amount * p.lastCandle[pair].Close
+		}
+	}
+
+	if baseCoinInfo, ok := p.assets[p.baseCoin]; ok {
+		total += baseCoinInfo.Lock + baseCoinInfo.Free
+	}
+	return total
+}
+
+func (p *PaperWallet) leveraged() bool {
+	return p.leverage > 1
+}
+
+// availableMargin returns the equity not used as margin of the open positions
+func (p *PaperWallet) availableMargin() float64 {
+	var used float64
+	for asset, info := range p.assets {
+		if asset == p.baseCoin {
+			continue
+		}
+
+		amount := info.Free + info.Lock
+		pair := strings.ToUpper(asset + p.baseCoin)
+		if amount > 0 {
+			used += amount * p.avgLongPrice[pair] / p.leverage
+		} else if amount < 0 {
+			used += -amount * p.avgShortPrice[pair] / p.leverage
+		}
+	}
+	return p.equity() - used
+}
+
+// liquidationPrice returns the price where the margin of the position minus the loss is equal to the
+// maintenance margin, and the position quantity, negative for short positions
+func (p *PaperWallet) liquidationPrice(pair string) (price, quantity float64) {
+	asset, _ := SplitAssetQuote(pair)
+	info, ok := p.assets[asset]
+	if !ok {
+		return 0, 0
+	}
+
+	quantity = info.Free + info.Lock
+	switch {
+	case quantity > 0:
+		price = p.avgLongPrice[pair] * (1 - 1/p.leverage) / (1 - p.maintenanceMargin)
+	case quantity < 0:
+		price = p.avgShortPrice[pair] * (1 + 1/p.leverage) / (1 + p.maintenanceMargin)
+	}
+	return price, quantity
+}
+
+// LiquidationPrice returns the liquidation price of the open position of the pair, or false without a
+// leveraged position, see WithPaperLeverage
+func (p *PaperWallet) LiquidationPrice(pair string) (float64, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.leveraged() {
+		return 0, false
+	}
+
+	price, quantity := p.liquidationPrice(pair)
+	return price, quantity != 0
+}
+
+// Liquidations returns a copy of the liquidated positions, see WithPaperLeverage
+func (p *PaperWallet) Liquidations() []Liquidation {
+	p.Lock()
+	defer p.Unlock()
+
+	liquidations := make([]Liquidation, len(p.liquidations))
+	copy(liquidations, p.liquidations)
+	return liquidations
+}
+
+// checkLiquidation liquidates the position of the pair when the candle crosses the liquidation price, a candle
+// that opens beyond the liquidation price closes the position with the open price
+func (p *PaperWallet) checkLiquidation(candle model.Candle) {
+	price, quantity := p.liquidationPrice(candle.Pair)
+	switch {
+	case quantity > 0 && candle.Low <= price:
+		p.liquidate(candle, model.SideTypeSell, quantity, math.Min(price, candle.Open))
+	case quantity < 0 && candle.High >= price:
+		p.liquidate(candle, model.SideTypeBuy, -quantity, math.Max(price, candle.Open))
+	}
+}
+
+func (p *PaperWallet) liquidate(candle model.Candle, side model.SideType, quantity, price float64) {
+	// cancel the open orders of the pair, releasing the locked funds
+	for i, order := range p.orders {
+		if order.Pair != candle.Pair || order.Status != model.OrderStatusTypeNew {
+			continue
+		}
+
+		p.orders[i].Status = model.OrderStatusTypeCanceled
+		p.orders[i].UpdatedAt = candle.Time
+		delete(p.trailingOCO, order.ExchangeID)
+		delete(p.trailingRates, order.ExchangeID)
+		delete(p.delayedOrders, order.ExchangeID)
+		p.release(order)
+	}
+	delete(p.trailingStops, candle.Pair)
+
+	entry := p.avgLongPrice[candle.Pair]
+	loss := (entry - price) * quantity
+	if side == model.SideTypeBuy {
+		entry = p.avgShortPrice[candle.Pair]
+		loss = (price - entry) * quantity
+	}
+
+	err := p.validateFunds(side, candle.Pair, quantity, price, true)
+	if err != nil {
+		log.Errorf("paperwallet/liquidation: %v", err)
+		return
+	}
+
+	p.volume[candle.Pair] += price * quantity
+	order := model.Order{
+		Fee:        p.chargeFee(candle.Pair, price*quantity, false),
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       candle.Pair,
+		Side:       side,
+		Type:       model.OrderTypeMarket,
+		Status:     model.OrderStatusTypeFilled,
+		Price:      price,
+		Quantity:   quantity,
+		RefPrice:   candle.Close,
+	}
+	p.orders = append(p.orders, order)
+	p.forced = append(p.forced, order)
+
+	liquidation := Liquidation{
+		Time:       candle.Time,
+		Pair:       candle.Pair,
+		Side:       side,
+		Quantity:   quantity,
+		EntryPrice: entry,
+		Price:      price,
+		Fee:        order.Fee,
+		Loss:       loss,
+	}
+	p.liquidations = append(p.liquidations, liquidation)
+	log.Warn(liquidation)
+}
+
+// notifyLiquidations calls the liquidation handler with the liquidations not notified yet
+func (p *PaperWallet) notifyLiquidations() {
+	if p.onLiquidation == nil {
+		return
+	}
+
+	p.Lock()
+	liquidations := append([]Liquidation(nil), p.liquidations[p.notified:]...)
+	p.notified = len(p.liquidations)
+	p.Unlock()
+
+	for _, liquidation := range liquidations {
+		p.onLiquidation(liquidation)
+	}
+}
+
+// filledFirst returns false if another order of the OCO group is reached before the order along the
+// intrabar path, so the order is canceled by it
+func (p *PaperWallet) filledFirst(order model.Order, candle model.Candle) bool {
+	if order.GroupID == nil || p.intrabarPath == IntrabarPathNone {
+		return true
+	}
+
+	path := p.candlePath(candle)
+	hit, ok := p.orderHit(order, path)
+	if !ok {
+		return true
+	}
+
+	for _, other := range p.orders {
+		if other.GroupID == nil || *other.GroupID != *order.GroupID || other.ExchangeID == order.ExchangeID ||
+			other.Status != model.OrderStatusTypeNew {
+			continue
+		}
+
+		otherHit, ok := p.orderHit(other, path)
+		if ok && (otherHit < hit || (otherHit == hit && isStopOrder(other.Type))) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// candlePath returns the prices of the intrabar path of the candle, from the open to the close
+func (p *PaperWallet) candlePath(candle model.Candle) []float64 {
+	switch {
+	case p.intrabarPath == IntrabarPathOLHC,
+		p.intrabarPath == IntrabarPathDirectional && candle.Close >= candle.Open:
+		return []float64{candle.Open, candle.Low, candle.High, candle.Close}
+	default:
+		return []float64{candle.Open, candle.High, candle.Low, candle.Close}
+	}
+}
+
+func isStopOrder(orderType model.OrderType) bool {
+	return orderType == model.OrderTypeStopLoss || orderType == model.OrderTypeStopLossLimit
+}
+
+// orderHit returns the price distance traveled along the path until the sell order is triggered, limit
+// orders are reached by a rising price and stop orders by a falling price. The profit leg of a trailing OCO
+// is a stop at its trailing level after the activation, and it is not reached before
+func (p *PaperWallet) orderHit(order model.Order, path []float64) (float64, bool) {
+	if _, ok := p.trailingOCO[order.ExchangeID]; ok {
+		if order.Stop == nil {
+			return 0, false
+		}
+		return pathHit(path, *order.Stop, false)
+	}
+
+	if isStopOrder(order.Type) {
+		if order.Stop == nil {
+			return 0, false
+		}
+		return pathHit(path, *order.Stop, false)
+	}
+	return pathHit(path, order.Price, true)
+}
+
+// pathHit returns the price distance traveled along the path until the price reaches the level, from below
+// when rising or from above otherwise, or false if the level is not reached
+func pathHit(path []float64, level float64, rising bool) (float64, bool) {
+	reached := func(price float64) bool {
+		if rising {
+			return price >= level
+		}
+		return price <= level
+	}
+
+	if len(path) == 0 {
+		return 0, false
+	}
+
+	if reached(path[0]) {
+		return 0, true
+	}
+
+	traveled := 0.0
+	for i := 1; i < len(path); i++ {
+		if reached(path[i]) {
+			return traveled + math.Abs(level-path[i-1]), true
+		}
+		traveled += math.Abs(path[i] - path[i-1])
+	}
+
+	return 0, false
+}
+
+func (p *PaperWallet) fillDelayedOrders(candle model.Candle) {
+	for i, order := range p.orders {
+		if order.Pair != candle.Pair || order.Type != model.OrderTypeMarket ||
+			order.Status != model.OrderStatusTypeNew {
+			continue
+		}
+
+		if target, ok := p.delayedOrders[order.ExchangeID]; ok && p.candleCount[candle.Pair] < target {
+			continue
+		}
+
+		if p.executionDelayDuration > 0 && candle.Time.Before(order.CreatedAt.Add(p.executionDelayDuration)) {
+			continue
+		}
+
+		delete(p.delayedOrders, order.ExchangeID)
+
+		price := candle.Open
+		if price == 0 {
+			price = candle.Close
+		}
+
+		p.orders[i].UpdatedAt = candle.Time
+		price, quantity, err := p.marketFill(order.Side, order.Pair, order.Quantity, price)
+		if err == nil {
+			err = p.validateFunds(order.Side, order.Pair, quantity, price, true)
+		}
+		if err != nil {
+			log.Errorf("paperwallet/delayed order %d: %v", order.ExchangeID, err)
+			p.orders[i].Status = model.OrderStatusTypeRejected
+			continue
+		}
+
+		p.consumeDepth(order.Side, order.Pair, quantity)
+		p.volume[candle.Pair] += price * quantity
+		p.chargeSlippage(order.Side, order.Pair, quantity, price, order.RefPrice)
+		p.orders[i].Fee = p.chargeFee(order.Pair, price*quantity, false)
+		p.orders[i].Status = fillStatus(order.Quantity, quantity)
+		p.orders[i].Price = price
+		p.orders[i].ExecutedQuantity = quantity
+	}
+}
+
+// expirePartialFills expires the rest of the market orders partially filled before the candle
+func (p *PaperWallet) expirePartialFills(candle model.Candle) {
+	for i, order := range p.orders {
+		if order.Pair == candle.Pair && order.Type == model.OrderTypeMarket &&
+			order.Status == model.OrderStatusTypePartiallyFilled {
+			p.orders[i].Status = model.OrderStatusTypeExpired
+			p.orders[i].UpdatedAt = candle.Time
+		}
+	}
+}
+
+// fillStatus returns the status of a market order with the filled quantity of its size
+func fillStatus(size, filled float64) model.OrderStatusType {
+	if filled < size {
+		return model.OrderStatusTypePartiallyFilled
+	}
+	return model.OrderStatusTypeFilled
+}
+
+func (p *PaperWallet) updateTrueRange(candle model.Candle) {
+	trueRange := candle.High - candle.Low
+	if previous, ok := p.lastCandle[candle.Pair]; ok && previous.Complete {
+		trueRange = math.Max(trueRange, math.Abs(candle.High-previous.Close))
+		trueRange = math.Max(trueRange, math.Abs(candle.Low-previous.Close))
+	}
+
+	ranges := append(p.trueRanges[candle.Pair], trueRange)
+	if len(ranges) > p.trailing.atrPeriod {
+		ranges = ranges[len(ranges)-p.trailing.atrPeriod:]
+	}
+	p.trueRanges[candle.Pair] = ranges
+}
+
+// trailingDistance returns the distance between the stop and the price, zero if it is not possible to calculate yet
+func (p *PaperWallet) trailingDistance(pair string, price float64) float64 {
+	if p.trailing.percent > 0 {
+		return price * p.trailing.percent
+	}
+
+	ranges := p.trueRanges[pair]
+	if p.trailing.atrPeriod <= 0 || len(ranges) < p.trailing.atrPeriod {
+		return 0
+	}
+
+	var total float64
+	for _, value := range ranges {
+		total += value
+	}
+
+	return total / float64(len(ranges)) * p.trailing.atrMultiplier
+}
+
+func (p *PaperWallet) updateTrailingStop(candle model.Candle) {
+	asset, _ := SplitAssetQuote(candle.Pair)
+	info, ok := p.assets[asset]
+	if !ok || info.Free+info.Lock == 0 {
+		delete(p.trailingStops, candle.Pair)
+		return
+	}
+
+	// the position includes the asset locked by the resting sell orders, e.g. a take profit
+	position := info.Free + info.Lock
+	stop, active := p.trailingStops[candle.Pair]
+	if position > 0 { // long position
+		if !active {
+			distance := p.trailingDistance(candle.Pair, p.avgLongPrice[candle.Pair])
+			if distance > 0 {
+				p.trailingStops[candle.Pair] = p.avgLongPrice[candle.Pair] - distance
+			}
+			return
+		}
+
+		if candle.Low <= stop {
+			p.closeTrailingStop(candle, model.SideTypeSell, position, math.Min(stop, candle.Open))
+			return
+		}
+
+		if distance := p.trailingDistance(candle.Pair, candle.High); distance > 0 {
+			p.trailingStops[candle.Pair] = math.Max(stop, candle.High-distance)
+		}
+		return
+	}
+
+	// short position
+	if !active {
+		distance := p.trailingDistance(candle.Pair, p.avgShortPrice[candle.Pair])
+		if distance > 0 {
+			p.trailingStops[candle.Pair] = p.avgShortPrice[candle.Pair] + distance
+		}
+		return
+	}
+
+	if candle.High >= stop {
+		p.closeTrailingStop(candle, model.SideTypeBuy, -position, math.Max(stop, candle.Open))
+		return
+	}
+
+	if distance := p.trailingDistance(candle.Pair, candle.Low); distance > 0 {
+		p.trailingStops[candle.Pair] = math.Min(stop, candle.Low+distance)
+	}
+}
+
+func (p *PaperWallet) closeTrailingStop(candle model.Candle, side model.SideType, quantity, price float64) {
+	delete(p.trailingStops, candle.Pair)
+
+	// the resting exits would close the position again, their funds are released for the stop
+	p.cancelExits(candle, side)
+
+	err := p.validateFunds(side, candle.Pair, quantity, price, true)
+	if err != nil {
+		log.Errorf("paperwallet/trailing stop: %v", err)
+		return
+	}
+
+	p.volume[candle.Pair] += price * quantity
+	order := model.Order{
+		Fee:        p.chargeFee(candle.Pair, price*quantity, false),
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       candle.Pair,
+		Side:       side,
+		Type:       model.OrderTypeStopLoss,
+		Status:     model.OrderStatusTypeFilled,
+		Price:      price,
+		Stop:       &price,
+		Quantity:   quantity,
+		RefPrice:   candle.Close,
+	}
+	p.orders = append(p.orders, order)
+	p.forced = append(p.forced, order)
+	log.Infof("[TRAILING STOP] %s", order)
+}
+
+// cancelExits cancels the open orders of the pair on the side that closes the position, e.g. the take profit
+// of a long position closed by the trailing stop, and releases their funds
+func (p *PaperWallet) cancelExits(candle model.Candle, side model.SideType) {
+	for i, order := range p.orders {
+		if order.Pair != candle.Pair || order.Side != side || (order.Status != model.OrderStatusTypeNew &&
+			order.Status != model.OrderStatusTypePartiallyFilled) {
+			continue
 		}
+
+		p.orders[i].Status = model.OrderStatusTypeCanceled
+		p.orders[i].UpdatedAt = candle.Time
+		delete(p.trailingOCO, order.ExchangeID)
+		delete(p.trailingRates, order.ExchangeID)
+		p.release(order)
+		p.cancelBrackets(order)
+		log.Infof("[TRAILING STOP] canceled %s", p.orders[i])
+	}
+}
+
+// ForcedOrders returns the orders filled by the wallet since the last call, the liquidations and the exits of
+// WithPaperTrailingStop, so the order controller can track the closed positions
+func (p *PaperWallet) ForcedOrders() []model.Order {
+	p.Lock()
+	defer p.Unlock()
+
+	orders := p.forced
+	p.forced = nil
+	return orders
+}
+
+func (p *PaperWallet) Account() (model.Account, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.account()
+}
+
+func (p *PaperWallet) account() (model.Account, error) {
+	balances := make([]model.Balance, 0)
+	for pair, info := range p.assets {
+		balances = append(balances, model.Balance{
+			Asset: pair,
+			Free:  info.Free,
+			Lock:  info.Lock,
+		})
+	}
+
+	return model.Account{
+		Balances: balances,
+	}, nil
+}
+
+func (p *PaperWallet) Position(pair string) (asset, quote float64, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := p.account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
+	size, price, stop, stopLimit float64) ([]model.Order, error) {
+	p.Lock()
+	orders, err := p.createOrderOCO(side, pair, size, price, stop, stopLimit)
+	p.Unlock()
+
+	if err == nil {
+		p.shadowOrders(orders, func(ideal *PaperWallet) ([]model.Order, error) {
+			return ideal.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+		})
+	}
+	return orders, err
+}
+
+// CreateOrderOCOTrailing creates an OCO sell order where the profit leg trails the price. The profit leg is
+// activated when the price reaches the activation price, then its stop follows the highest price at the trail
+// distance (e.g. 0.02 for 2%), only moving up. The loss leg is a fixed stop, as in CreateOrderOCO.
+// The leg reached first is filled and the other one is canceled
+func (p *PaperWallet) CreateOrderOCOTrailing(pair string, size, activation, trail, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	orders, err := p.createOrderOCOTrailing(pair, size, activation, trail, stop, stopLimit)
+	if err == nil {
+		p.shadowOrders(orders, func(ideal *PaperWallet) ([]model.Order, error) {
+			return ideal.CreateOrderOCOTrailing(pair, size, activation, trail, stop, stopLimit)
+		})
+	}
+	return orders, err
+}
+
+// createOrderOCOTrailing is CreateOrderOCOTrailing without the ideal shadow
+func (p *PaperWallet) createOrderOCOTrailing(pair string, size, activation, trail, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if trail <= 0 || trail >= 1 {
+		return nil, fmt.Errorf("invalid trail distance: %f", trail)
+	}
+
+	orders, err := p.createOrderOCO(model.SideTypeSell, pair, size, activation, stop, stopLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// the profit leg is a stop order after the activation, filled as taker. It is reported as a take profit,
+	// and its trailingOCO entry marks it as trailing until it is filled or canceled
+	orders[0].Type = model.OrderTypeTakeProfit
+	p.orders[len(p.orders)-2].Type = model.OrderTypeTakeProfit
+	p.trailingOCO[orders[0].ExchangeID] = trail
+	return orders, nil
+}
+
+// updateTrailingOCO updates the stop of a trailing profit leg, stored in the order stop after the activation.
+// The stop of the previous candles is checked before it is moved with the high of the current candle
+func (p *PaperWallet) updateTrailingOCO(order *model.Order, trail float64, candle model.Candle) (float64, bool) {
+	if order.Stop != nil && candle.Low <= *order.Stop {
+		return math.Min(*order.Stop, candle.Open), true
+	}
+
+	if order.Stop == nil && candle.High < order.Price {
+		return 0, false
+	}
+
+	level := candle.High * (1 - trail)
+	if order.Stop == nil || level > *order.Stop {
+		order.Stop = &level
+	}
+	return 0, false
+}
+
+// CreateOrderTrailingStop creates a trailing stop market order, emulating the native order of Binance Futures.
+// The order is activated when the price reaches the activation price, or immediately without activation price
+// (zero), then it trails the best price (the highest price for sells, the lowest for buys) at the callback rate
+// (e.g. 0.01 for 1%) and it is filled as a market order when the price retraces to the stop. As a conditional
+// order, it reserves no funds until it is triggered
+func (p *PaperWallet) CreateOrderTrailingStop(side model.SideType, pair string, size, activation,
+	callbackRate float64) (model.Order, error) {
+
+	order, err := p.createOrderTrailingStop(side, pair, size, activation, callbackRate)
+	if err == nil {
+		p.shadowOrder(order, func(ideal *PaperWallet) (model.Order, error) {
+			return ideal.CreateOrderTrailingStop(side, pair, size, activation, callbackRate)
+		})
+	}
+	return order, err
+}
+
+// createOrderTrailingStop is CreateOrderTrailingStop without the ideal shadow
+func (p *PaperWallet) createOrderTrailingStop(side model.SideType, pair string, size, activation,
+	callbackRate float64) (model.Order, error) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if size <= 0 {
+		return model.Order{}, ErrInvalidQuantity
+	}
+
+	if callbackRate <= 0 || callbackRate >= 1 {
+		return model.Order{}, fmt.Errorf("invalid callback rate: %f", callbackRate)
+	}
+
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  p.lastCandle[pair].Time,
+		UpdatedAt:  p.lastCandle[pair].Time,
+		Pair:       pair,
+		Side:       side,
+		Type:       model.OrderTypeTrailingStopMarket,
+		Status:     model.OrderStatusTypeNew,
+		Price:      activation,
+		Quantity:   size,
+		RefPrice:   p.lastCandle[pair].Close,
+	}
+
+	// without activation price, the order trails the last price from the creation
+	if activation == 0 {
+		order.Price = p.lastCandle[pair].Close
+		stop := order.Price * (1 - callbackRate)
+		if side == model.SideTypeBuy {
+			stop = order.Price * (1 + callbackRate)
+		}
+		order.Stop = &stop
+	}
+
+	p.orders = append(p.orders, order)
+	p.trailingRates[order.ExchangeID] = callbackRate
+	return order, nil
+}
+
+// updateTrailingStopOrder moves the stop of an active trailing stop order, stored in the order stop, and fills
+// the order when the candle reaches the stop. The stop of the previous candles is checked before it is moved
+// with the current candle
+func (p *PaperWallet) updateTrailingStopOrder(order *model.Order, candle model.Candle) {
+	rate := p.trailingRates[order.ExchangeID]
+
+	var (
+		price     float64
+		triggered bool
+	)
+
+	if order.Side == model.SideTypeSell {
+		switch {
+		case order.Stop != nil && candle.Low <= *order.Stop:
+			price, triggered = math.Min(*order.Stop, candle.Open), true
+		case order.Stop != nil || candle.High >= order.Price:
+			if level := candle.High * (1 - rate); order.Stop == nil || level > *order.Stop {
+				order.Stop = &level
+			}
+		}
+	} else {
+		switch {
+		case order.Stop != nil && candle.High >= *order.Stop:
+			price, triggered = math.Max(*order.Stop, candle.Open), true
+		case order.Stop != nil || candle.Low <= order.Price:
+			if level := candle.Low * (1 + rate); order.Stop == nil || level < *order.Stop {
+				order.Stop = &level
+			}
+		}
+	}
+
+	if !triggered {
+		return
+	}
+
+	delete(p.trailingRates, order.ExchangeID)
+	order.UpdatedAt = candle.Time
+
+	err := p.validateFunds(order.Side, order.Pair, order.Quantity, price, true)
+	if err != nil {
+		log.Errorf("paperwallet/trailing stop order: %v", err)
+		order.Status = model.OrderStatusTypeRejected
+		return
+	}
+
+	p.volume[order.Pair] += price * order.Quantity
+	order.Status = model.OrderStatusTypeFilled
+	order.Price = price
+	order.Fee = p.chargeFee(order.Pair, price*order.Quantity, false)
+}
+
+// CreateOrderOTOCO creates a limit entry order with an OCO bracket of take profit and stop loss, placed only when
+// the entry is filled. The brackets are returned in the pending new status and the funds of the position are
+// locked on activation. Canceling the entry cancels the brackets. Only buy entries are supported
+func (p *PaperWallet) CreateOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	orders, err := p.createOrderOTOCO(side, pair, size, entry, takeProfit, stop, stopLimit)
+	if err == nil {
+		p.shadowOrders(orders, func(ideal *PaperWallet) ([]model.Order, error) {
+			return ideal.CreateOrderOTOCO(side, pair, size, entry, takeProfit, stop, stopLimit)
+		})
+	}
+	return orders, err
+}
+
+// createOrderOTOCO is CreateOrderOTOCO without the ideal shadow
+func (p *PaperWallet) createOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if side != model.SideTypeBuy {
+		return nil, fmt.Errorf("paper wallet: OTOCO orders with %s entry are not supported", side)
+	}
+
+	if size == 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	err := p.validateFunds(side, pair, size, entry, false)
+	if err != nil {
+		return nil, err
+	}
+
+	candle := p.lastCandle[pair]
+	entryOrder := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       pair,
+		Side:       side,
+		Type:       model.OrderTypeLimit,
+		Status:     model.OrderStatusTypeNew,
+		Price:      entry,
+		Quantity:   size,
+	}
+
+	groupID := p.ID()
+	profitOrder := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       pair,
+		Side:       model.SideTypeSell,
+		Type:       model.OrderTypeLimitMaker,
+		Status:     model.OrderStatusTypePendingNew,
+		Price:      takeProfit,
+		Quantity:   size,
+		GroupID:    &groupID,
+		RefPrice:   candle.Close,
 	}
 
-	if candle.Complete {
-		var total float64
-		for asset, info := range p.assets {
-			amount := info.Free + info.Lock
-			pair := strings.ToUpper(asset + p.baseCoin)
-			if amount < 0 {
-				v := math.Abs(amount)
-				liquid := 2*v*p.avgShortPrice[pair] - v*p.lastCandle[pair].Close
-				total += liquid
-			} else {
-				total += amount * p.lastCandle[pair].Close
-			}
+	stopOrder := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       pair,
+		Side:       model.SideTypeSell,
+		Type:       model.OrderTypeStopLoss,
+		Status:     model.OrderStatusTypePendingNew,
+		Price:      stopLimit,
+		Stop:       &stop,
+		Quantity:   size,
+		GroupID:    &groupID,
+		RefPrice:   candle.Close,
+	}
 
-			p.assetValues[asset] = append(p.assetValues[asset], AssetValue{
-				Time:  candle.Time,
-				Value: amount * p.lastCandle[pair].Close,
-			})
-		}
+	p.brackets[entryOrder.ExchangeID] = groupID
+	p.orders = append(p.orders, entryOrder, profitOrder, stopOrder)
+	return []model.Order{entryOrder, profitOrder, stopOrder}, nil
+}
 
-		baseCoinInfo := p.assets[p.baseCoin]
-		p.equityValues = append(p.equityValues, AssetValue{
-			Time:  candle.Time,
-			Value: total + baseCoinInfo.Lock + baseCoinInfo.Free,
-		})
+// activateBrackets places the pending OCO bracket of a filled OTOCO entry, locking the position
+func (p *PaperWallet) activateBrackets(entry model.Order, candle model.Candle) {
+	groupID, ok := p.brackets[entry.ExchangeID]
+	if !ok {
+		return
 	}
-}
+	delete(p.brackets, entry.ExchangeID)
 
-func (p *PaperWallet) Account() (model.Account, error) {
-	balances := make([]model.Balance, 0)
-	for pair, info := range p.assets {
-		balances = append(balances, model.Balance{
-			Asset: pair,
-			Free:  info.Free,
-			Lock:  info.Lock,
-		})
+	status := model.OrderStatusTypeNew
+	if err := p.validateFunds(model.SideTypeSell, entry.Pair, entry.Quantity, entry.Price, false); err != nil {
+		log.Errorf("paperwallet/otoco %d: %v", entry.ExchangeID, err)
+		status = model.OrderStatusTypeRejected
 	}
 
-	return model.Account{
-		Balances: balances,
-	}, nil
+	for i, order := range p.orders {
+		if order.GroupID != nil && *order.GroupID == groupID && order.Status == model.OrderStatusTypePendingNew {
+			p.orders[i].Status = status
+			p.orders[i].UpdatedAt = candle.Time
+		}
+	}
 }
 
-func (p *PaperWallet) Position(pair string) (asset, quote float64, err error) {
-	p.Lock()
-	defer p.Unlock()
-
-	assetTick, quoteTick := SplitAssetQuote(pair)
-	acc, err := p.Account()
-	if err != nil {
-		return 0, 0, err
+// cancelBrackets cancels the pending OCO bracket of a canceled OTOCO entry
+func (p *PaperWallet) cancelBrackets(entry model.Order) {
+	groupID, ok := p.brackets[entry.ExchangeID]
+	if !ok {
+		return
 	}
+	delete(p.brackets, entry.ExchangeID)
 
-	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
-
-	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+	for i, order := range p.orders {
+		if order.GroupID != nil && *order.GroupID == groupID && order.Status == model.OrderStatusTypePendingNew {
+			p.orders[i].Status = model.OrderStatusTypeCanceled
+		}
+	}
 }
 
-func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
+func (p *PaperWallet) createOrderOCO(side model.SideType, pair string,
 	size, price, stop, stopLimit float64) ([]model.Order, error) {
-	p.Lock()
-	defer p.Unlock()
 
 	if size == 0 {
 		return nil, ErrInvalidQuantity
@@ -556,6 +2300,19 @@ func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
 func (p *PaperWallet) CreateOrderLimit(side model.SideType, pair string,
 	size float64, limit float64) (model.Order, error) {
 
+	order, err := p.createOrderLimit(side, pair, size, limit)
+	if err == nil {
+		p.shadowOrder(order, func(ideal *PaperWallet) (model.Order, error) {
+			return ideal.CreateOrderLimit(side, pair, size, limit)
+		})
+	}
+	return order, err
+}
+
+// createOrderLimit is CreateOrderLimit without the ideal shadow
+func (p *PaperWallet) createOrderLimit(side model.SideType, pair string,
+	size float64, limit float64) (model.Order, error) {
+
 	p.Lock()
 	defer p.Unlock()
 
@@ -582,14 +2339,109 @@ func (p *PaperWallet) CreateOrderLimit(side model.SideType, pair string,
 	return order, nil
 }
 
-func (p *PaperWallet) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+// CreateOrderLimitTIF emulates the time in force against the current candle. IOC and FOK orders
+// are filled at the candle close when the limit crosses it, the candle volume limits the filled
+// quantity: IOC fills the available quantity and cancels the rest, FOK is canceled if not fully fillable.
+func (p *PaperWallet) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	order, err := p.createOrderLimitTIF(side, pair, size, limit, timeInForce)
+	if err == nil {
+		p.shadowOrder(order, func(ideal *PaperWallet) (model.Order, error) {
+			return ideal.CreateOrderLimitTIF(side, pair, size, limit, timeInForce)
+		})
+	}
+	return order, err
+}
+
+// createOrderLimitTIF is CreateOrderLimitTIF without the ideal shadow
+func (p *PaperWallet) createOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	if timeInForce == model.TimeInForceGTC || timeInForce == "" {
+		return p.createOrderLimit(side, pair, size, limit)
+	}
+
+	if timeInForce != model.TimeInForceIOC && timeInForce != model.TimeInForceFOK {
+		return model.Order{}, fmt.Errorf("invalid time in force: %s", timeInForce)
+	}
+
 	p.Lock()
 	defer p.Unlock()
 
-	return p.createOrderMarket(side, pair, size)
+	if size == 0 {
+		return model.Order{}, ErrInvalidQuantity
+	}
+
+	candle := p.lastCandle[pair]
+	price := candle.Close
+	if price <= 0 {
+		return model.Order{}, fmt.Errorf("%w: no price available for %s", ErrInvalidAsset, pair)
+	}
+
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       pair,
+		Side:       side,
+		Type:       model.OrderTypeLimit,
+		Status:     model.OrderStatusTypeExpired,
+		Price:      limit,
+		Quantity:   size,
+	}
+
+	fillable := size
+	if candle.Volume > 0 && candle.Volume < size {
+		fillable = candle.Volume
+	}
+
+	crosses := (side == model.SideTypeBuy && limit >= price) || (side == model.SideTypeSell && limit <= price)
+	if !crosses || (timeInForce == model.TimeInForceFOK && fillable < size) {
+		p.orders = append(p.orders, order)
+		return order, nil
+	}
+
+	err := p.validateFunds(side, pair, fillable, price, true)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	p.volume[pair] += price * fillable
+
+	order.Fee = p.chargeFee(pair, price*fillable, false)
+	order.Status = model.OrderStatusTypeFilled
+	order.Price = price
+	order.Quantity = fillable
+	p.orders = append(p.orders, order)
+	return order, nil
+}
+
+func (p *PaperWallet) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	p.Lock()
+	order, err := p.createOrderMarket(side, pair, size)
+	p.Unlock()
+
+	if err == nil {
+		p.shadowOrder(order, func(ideal *PaperWallet) (model.Order, error) {
+			return ideal.CreateOrderMarket(side, pair, size)
+		})
+	}
+	return order, err
 }
 
 func (p *PaperWallet) CreateOrderStop(pair string, size float64, limit float64) (model.Order, error) {
+	order, err := p.createOrderStop(pair, size, limit)
+	if err == nil {
+		p.shadowOrder(order, func(ideal *PaperWallet) (model.Order, error) {
+			return ideal.CreateOrderStop(pair, size, limit)
+		})
+	}
+	return order, err
+}
+
+// createOrderStop is CreateOrderStop without the ideal shadow
+func (p *PaperWallet) createOrderStop(pair string, size float64, limit float64) (model.Order, error) {
 	p.Lock()
 	defer p.Unlock()
 
@@ -618,21 +2470,184 @@ func (p *PaperWallet) CreateOrderStop(pair string, size float64, limit float64)
 	return order, nil
 }
 
+// spreadPrice returns the ask price for buys and the bid price for sells, with the price as the mid price
+func (p *PaperWallet) spreadPrice(side model.SideType, price float64) float64 {
+	if side == model.SideTypeBuy {
+		return price * (1 + p.spread/2)
+	}
+	return price * (1 - p.spread/2)
+}
+
+// slippagePrice returns the price moved against the order side by a random fraction of the slippage
+func (p *PaperWallet) slippagePrice(side model.SideType, price float64) float64 {
+	if p.slippage <= 0 {
+		return price
+	}
+
+	slippage := price * p.slippage * p.rand.Float64()
+	if side == model.SideTypeBuy {
+		return price + slippage
+	}
+	return price - slippage
+}
+
+// marketFill returns the average price and the filled quantity of a market order, according to the fill model
+func (p *PaperWallet) marketFill(side model.SideType, pair string, size, price float64) (float64, float64, error) {
+	depth, ok := p.depths[pair]
+	if p.fillModel != FillModelOrderBook || !ok {
+		return p.slippagePrice(side, p.spreadPrice(side, price)), size, nil
+	}
+
+	levels := depth.Asks
+	if side == model.SideTypeSell {
+		levels = depth.Bids
+	}
+
+	cost, filled := 0.0, 0.0
+	for _, level := range levels {
+		if filled >= size {
+			break
+		}
+		quantity := math.Min(level.Quantity, size-filled)
+		cost += quantity * level.Price
+		filled += quantity
+	}
+
+	if filled <= 0 {
+		return 0, 0, fmt.Errorf("%w: no liquidity in the order book of %s", ErrInvalidQuantity, pair)
+	}
+
+	return cost / filled, filled, nil
+}
+
+// consumeDepth removes the filled quantity from the depth snapshot, so the next orders walk deeper levels
+func (p *PaperWallet) consumeDepth(side model.SideType, pair string, quantity float64) {
+	depth, ok := p.depths[pair]
+	if p.fillModel != FillModelOrderBook || !ok {
+		return
+	}
+
+	levels := &depth.Asks
+	if side == model.SideTypeSell {
+		levels = &depth.Bids
+	}
+
+	for len(*levels) > 0 && quantity > 0 {
+		level := &(*levels)[0]
+		taken := math.Min(level.Quantity, quantity)
+		level.Quantity -= taken
+		quantity -= taken
+		if level.Quantity <= 0 {
+			*levels = (*levels)[1:]
+		}
+	}
+}
+
+func (p *PaperWallet) synthesizeDepth(candle model.Candle) *model.Depth {
+	depth := &model.Depth{
+		Pair: candle.Pair,
+		Time: candle.Time,
+		Bids: make([]model.PriceLevel, 0, p.synthetic.levels),
+		Asks: make([]model.PriceLevel, 0, p.synthetic.levels),
+	}
+
+	quantity := candle.Volume * p.synthetic.liquidity / float64(p.synthetic.levels)
+	for i := 0; i < p.synthetic.levels; i++ {
+		spread := candle.Close * p.synthetic.step * float64(i)
+		depth.Bids = append(depth.Bids, model.PriceLevel{Price: candle.Close - spread, Quantity: quantity})
+		depth.Asks = append(depth.Asks, model.PriceLevel{Price: candle.Close + spread, Quantity: quantity})
+	}
+
+	return depth
+}
+
+// OnDepth updates the order book snapshot of the pair used by FillModelOrderBook. Pairs with a depth
+// feed don't use the synthesized depth
+func (p *PaperWallet) OnDepth(depth model.Depth) {
+	p.Lock()
+	defer p.Unlock()
+
+	snapshot := &model.Depth{
+		Pair: depth.Pair,
+		Time: depth.Time,
+		Bids: append([]model.PriceLevel(nil), depth.Bids...),
+		Asks: append([]model.PriceLevel(nil), depth.Asks...),
+	}
+	p.depths[depth.Pair] = snapshot
+	p.depthFeed[depth.Pair] = true
+}
+
+// Depth returns the last order book snapshot of the pair, from the depth feed or synthesized from the candles,
+// with up to limit levels on each side
+func (p *PaperWallet) Depth(pair string, limit int) (model.Depth, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	depth, ok := p.depths[pair]
+	if !ok {
+		return model.Depth{}, fmt.Errorf("no order book of %s", pair)
+	}
+
+	bids, asks := depth.Bids, depth.Asks
+	if len(bids) > limit {
+		bids = bids[:limit]
+	}
+	if len(asks) > limit {
+		asks = asks[:limit]
+	}
+
+	return model.Depth{
+		Pair: depth.Pair,
+		Time: depth.Time,
+		Bids: append([]model.PriceLevel(nil), bids...),
+		Asks: append([]model.PriceLevel(nil), asks...),
+	}, nil
+}
+
 func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
 	if size == 0 {
 		return model.Order{}, ErrInvalidQuantity
 	}
 
-	err := p.validateFunds(side, pair, size, p.lastCandle[pair].Close, true)
+	if p.executionDelay > 0 || p.executionDelayDuration > 0 {
+		order := model.Order{
+			ExchangeID: p.ID(),
+			CreatedAt:  p.lastCandle[pair].Time,
+			UpdatedAt:  p.lastCandle[pair].Time,
+			Pair:       pair,
+			Side:       side,
+			Type:       model.OrderTypeMarket,
+			Status:     model.OrderStatusTypeNew,
+			Price:      p.lastCandle[pair].Close,
+			Quantity:   size,
+			RefPrice:   p.lastCandle[pair].Close,
+		}
+
+		if p.executionDelay > 0 {
+			p.delayedOrders[order.ExchangeID] = p.candleCount[pair] + p.executionDelay
+		}
+
+		p.orders = append(p.orders, order)
+		return order, nil
+	}
+
+	price, filled, err := p.marketFill(side, pair, size, p.lastCandle[pair].Close)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	err = p.validateFunds(side, pair, filled, price, true)
 	if err != nil {
 		return model.Order{}, err
 	}
 
+	p.consumeDepth(side, pair, filled)
 	if _, ok := p.volume[pair]; !ok {
 		p.volume[pair] = 0
 	}
 
-	p.volume[pair] += p.lastCandle[pair].Close * size
+	p.volume[pair] += price * filled
+	p.chargeSlippage(side, pair, filled, price, p.lastCandle[pair].Close)
 
 	order := model.Order{
 		ExchangeID: p.ID(),
@@ -641,9 +2656,12 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 		Pair:       pair,
 		Side:       side,
 		Type:       model.OrderTypeMarket,
-		Status:     model.OrderStatusTypeFilled,
-		Price:      p.lastCandle[pair].Close,
+		Status:     fillStatus(size, filled),
+		Price:      price,
 		Quantity:   size,
+		Fee:        p.chargeFee(pair, price*filled, false),
+
+		ExecutedQuantity: filled,
 	}
 
 	p.orders = append(p.orders, order)
@@ -653,27 +2671,174 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 
 func (p *PaperWallet) CreateOrderMarketQuote(side model.SideType, pair string,
 	quoteQuantity float64) (model.Order, error) {
+
+	order, err := p.createOrderMarketQuote(side, pair, quoteQuantity)
+	if err == nil {
+		p.shadowOrder(order, func(ideal *PaperWallet) (model.Order, error) {
+			return ideal.CreateOrderMarketQuote(side, pair, quoteQuantity)
+		})
+	}
+	return order, err
+}
+
+func (p *PaperWallet) createOrderMarketQuote(side model.SideType, pair string,
+	quoteQuantity float64) (model.Order, error) {
 	p.Lock()
 	defer p.Unlock()
 
+	if p.lastCandle[pair].Close <= 0 {
+		return model.Order{}, fmt.Errorf("%w: no price available for %s", ErrInvalidAsset, pair)
+	}
+
 	info := p.AssetsInfo(pair)
 	quantity := common.AmountToLotSize(info.StepSize, info.BaseAssetPrecision, quoteQuantity/p.lastCandle[pair].Close)
 	return p.createOrderMarket(side, pair, quantity)
 }
 
 func (p *PaperWallet) Cancel(order model.Order) error {
+	if shadow, ok := p.idealOrder(order); ok {
+		log.CheckErr(log.WarnLevel, p.ideal.Cancel(shadow))
+	}
+
 	p.Lock()
 	defer p.Unlock()
 
 	for i, o := range p.orders {
 		if o.ExchangeID == order.ExchangeID {
 			p.orders[i].Status = model.OrderStatusTypeCanceled
+			delete(p.trailingOCO, o.ExchangeID)
+			delete(p.trailingRates, o.ExchangeID)
+			if o.Status == model.OrderStatusTypeNew || o.Status == model.OrderStatusTypePartiallyFilled {
+				p.release(o)
+				p.cancelBrackets(o)
+			}
 		}
 	}
 	return nil
 }
 
+// OrderReplace updates the price and quantity of a resting limit order in place, keeping its ID, and moves the
+// reserved funds to the new values. The order is not changed if the funds are insufficient
+func (p *PaperWallet) OrderReplace(order model.Order, price, quantity float64) (model.Order, error) {
+	replaced, err := p.orderReplace(order, price, quantity)
+	if err == nil {
+		if shadow, ok := p.idealOrder(order); ok {
+			_, err := p.ideal.OrderReplace(shadow, price, quantity)
+			log.CheckErr(log.WarnLevel, err)
+		}
+	}
+	return replaced, err
+}
+
+// orderReplace is OrderReplace without the ideal shadow
+func (p *PaperWallet) orderReplace(order model.Order, price, quantity float64) (model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if quantity <= 0 {
+		return model.Order{}, ErrInvalidQuantity
+	}
+
+	for i, o := range p.orders {
+		if o.ExchangeID != order.ExchangeID {
+			continue
+		}
+
+		if o.Status != model.OrderStatusTypeNew {
+			return model.Order{}, fmt.Errorf("replace order %d: order is %s", o.ExchangeID, o.Status)
+		}
+
+		if (o.Type != model.OrderTypeLimit && o.Type != model.OrderTypeLimitMaker) || o.GroupID != nil {
+			return model.Order{}, fmt.Errorf("replace order %d: unsupported order type %s", o.ExchangeID, o.Type)
+		}
+
+		p.release(o)
+		if err := p.validateFunds(o.Side, o.Pair, quantity, price, false); err != nil {
+			// restore the reservation of the original order
+			log.CheckErr(log.WarnLevel, p.validateFunds(o.Side, o.Pair, o.Quantity, o.Price, false))
+			return model.Order{}, err
+		}
+
+		p.orders[i].Price = price
+		p.orders[i].Quantity = quantity
+		p.orders[i].UpdatedAt = p.lastCandle[o.Pair].Time
+		return p.orders[i], nil
+	}
+
+	return model.Order{}, fmt.Errorf("replace order %d: order not found", order.ExchangeID)
+}
+
+// release unlocks the funds reserved by a resting order when it is canceled. The legs of an OCO group share
+// the reserved funds, which are released with the last open leg. Trailing stop orders reserve no funds
+func (p *PaperWallet) release(order model.Order) {
+	if order.Type == model.OrderTypeMarket || order.Type == model.OrderTypeTrailingStopMarket {
+		return
+	}
+
+	if order.GroupID != nil {
+		for _, other := range p.orders {
+			if other.GroupID != nil && *other.GroupID == *order.GroupID && other.ExchangeID != order.ExchangeID &&
+				other.Status == model.OrderStatusTypeNew {
+				return
+			}
+		}
+	}
+
+	// the filled part of a partially filled order has already used its locked funds
+	remaining := order.Quantity - order.ExecutedQuantity
+	asset, quote := SplitAssetQuote(order.Pair)
+	if order.Side == model.SideTypeBuy {
+		p.assets[quote].Lock -= order.Price * remaining
+		p.assets[quote].Free += order.Price * remaining
+		return
+	}
+
+	// sell orders lock the asset first and the quote for the short part
+	lockedAsset := math.Min(math.Max(p.assets[asset].Lock, 0), remaining)
+	lockedQuote := (remaining - lockedAsset) * order.Price
+	p.assets[asset].Lock -= lockedAsset
+	p.assets[asset].Free += lockedAsset
+	p.assets[quote].Lock -= lockedQuote
+	p.assets[quote].Free += lockedQuote
+}
+
+// CancelAll cancels all pending orders of the given pair and returns the canceled orders
+func (p *PaperWallet) CancelAll(pair string) ([]model.Order, error) {
+	if p.ideal != nil {
+		_, err := p.ideal.CancelAll(pair)
+		log.CheckErr(log.WarnLevel, err)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	orders := make([]model.Order, 0)
+	for i, order := range p.orders {
+		if order.Pair != pair {
+			continue
+		}
+
+		switch order.Status {
+		case model.OrderStatusTypeNew, model.OrderStatusTypePartiallyFilled:
+			p.release(order)
+			delete(p.brackets, order.ExchangeID)
+		case model.OrderStatusTypePendingNew:
+			// brackets of OTOCO orders, without locked funds
+		default:
+			continue
+		}
+
+		p.orders[i].Status = model.OrderStatusTypeCanceled
+		delete(p.trailingOCO, order.ExchangeID)
+		orders = append(orders, p.orders[i])
+	}
+	return orders, nil
+}
+
 func (p *PaperWallet) Order(_ string, id int64) (model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
 	for _, order := range p.orders {
 		if order.ExchangeID == id {
 			return order, nil
@@ -682,6 +2847,21 @@ func (p *PaperWallet) Order(_ string, id int64) (model.Order, error) {
 	return model.Order{}, errors.New("order not found")
 }
 
+// OpenOrders returns the pending orders of the given pair
+func (p *PaperWallet) OpenOrders(pair string) ([]model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	orders := make([]model.Order, 0)
+	for _, order := range p.orders {
+		if order.Pair == pair && (order.Status == model.OrderStatusTypeNew ||
+			order.Status == model.OrderStatusTypePartiallyFilled) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
 func (p *PaperWallet) CandlesByPeriod(ctx context.Context, pair, period string,
 	start, end time.Time) ([]model.Candle, error) {
 	return p.feeder.CandlesByPeriod(ctx, pair, period, start, end)
@@ -694,3 +2874,7 @@ func (p *PaperWallet) CandlesByLimit(ctx context.Context, pair, period string, l
 func (p *PaperWallet) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error) {
 	return p.feeder.CandlesSubscription(ctx, pair, timeframe)
 }
+
+func (p *PaperWallet) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	return p.feeder.TradesSubscription(ctx, pair)
+}
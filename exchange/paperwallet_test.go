@@ -1,7 +1,9 @@
 package exchange
 
 import (
+	"bytes"
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -191,6 +193,70 @@ func TestPaperWallet_OrderLimit(t *testing.T) {
 	})
 }
 
+func TestPaperWallet_OrderLimitTIF(t *testing.T) {
+	newWallet := func() *PaperWallet {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100, Volume: 5})
+		return wallet
+	}
+
+	t.Run("IOC filled", func(t *testing.T) {
+		wallet := newWallet()
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 2, 110, model.TimeInForceIOC)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 100.0, order.Price)
+		require.Equal(t, 2.0, order.Quantity)
+		require.Equal(t, 800.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 2.0, wallet.assets["BTC"].Free)
+	})
+
+	t.Run("IOC partially filled", func(t *testing.T) {
+		wallet := newWallet()
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 8, 100, model.TimeInForceIOC)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 5.0, order.Quantity)
+		require.Equal(t, 500.0, wallet.assets["USDT"].Free)
+	})
+
+	t.Run("IOC not crossing", func(t *testing.T) {
+		wallet := newWallet()
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 90, model.TimeInForceIOC)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeExpired, order.Status)
+		require.Equal(t, 1000.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 0.0, wallet.assets["USDT"].Lock)
+
+		// expired orders are not filled by next candles
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 80, Low: 80, High: 80, Volume: 5})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeExpired, order.Status)
+	})
+
+	t.Run("FOK", func(t *testing.T) {
+		wallet := newWallet()
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 8, 100, model.TimeInForceFOK)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeExpired, order.Status)
+		require.Equal(t, 1000.0, wallet.assets["USDT"].Free)
+
+		order, err = wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 5, 100, model.TimeInForceFOK)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 5.0, order.Quantity)
+	})
+
+	t.Run("GTC", func(t *testing.T) {
+		wallet := newWallet()
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 90, model.TimeInForceGTC)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, 90.0, wallet.assets["USDT"].Lock)
+	})
+}
+
 func TestPaperWallet_OrderMarket(t *testing.T) {
 	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
 	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50})
@@ -229,6 +295,35 @@ func TestPaperWallet_OrderMarket(t *testing.T) {
 	require.Equal(t, 50.0, wallet.avgLongPrice["BTCUSDT"])
 }
 
+func TestPaperWallet_OrderMarketQuote(t *testing.T) {
+	t.Run("buy and sell", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50})
+		order, err := wallet.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 25)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 0.5, order.Quantity)
+		require.Equal(t, 50.0, order.Price)
+		require.Equal(t, 75.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 0.5, wallet.assets["BTC"].Free)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		order, err = wallet.CreateOrderMarketQuote(model.SideTypeSell, "BTCUSDT", 50)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, order.Quantity)
+		require.Equal(t, 125.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 0.0, wallet.assets["BTC"].Free)
+	})
+
+	t.Run("without price", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+		order, err := wallet.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 25)
+		require.ErrorIs(t, err, ErrInvalidAsset)
+		require.Empty(t, order)
+		require.Empty(t, wallet.orders)
+	})
+}
+
 func TestPaperWallet_OrderOCO(t *testing.T) {
 	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 50))
 	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50})
@@ -268,6 +363,196 @@ func TestPaperWallet_OrderOCO(t *testing.T) {
 	require.Equal(t, wallet.orders[2].Status, model.OrderStatusTypeFilled)
 }
 
+func TestPaperWallet_OrderOTOCO(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 60, High: 60, Low: 60})
+
+	orders, err := wallet.CreateOrderOTOCO(model.SideTypeBuy, "BTCUSDT", 1, 50, 70, 40, 39)
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+	require.Equal(t, model.OrderStatusTypeNew, orders[0].Status)
+	require.Equal(t, model.OrderStatusTypePendingNew, orders[1].Status)
+	require.Equal(t, model.OrderStatusTypePendingNew, orders[2].Status)
+	require.Equal(t, model.SideTypeSell, orders[1].Side)
+	require.Equal(t, 50.0, wallet.assets["USDT"].Lock)
+
+	// brackets are not triggered before the entry
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 75, High: 75, Low: 30})
+	require.Equal(t, model.OrderStatusTypeNew, wallet.orders[0].Status)
+	require.Equal(t, model.OrderStatusTypePendingNew, wallet.orders[1].Status)
+	require.Equal(t, model.OrderStatusTypePendingNew, wallet.orders[2].Status)
+
+	// entry filled, the brackets are placed after the candle
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50, High: 80, Low: 50})
+	require.Equal(t, model.OrderStatusTypeFilled, wallet.orders[0].Status)
+	require.Equal(t, model.OrderStatusTypeNew, wallet.orders[1].Status)
+	require.Equal(t, model.OrderStatusTypeNew, wallet.orders[2].Status)
+	require.Equal(t, 1.0, wallet.assets["BTC"].Lock)
+
+	// take profit filled and stop canceled
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 72, High: 72, Low: 55})
+	require.Equal(t, model.OrderStatusTypeFilled, wallet.orders[1].Status)
+	require.Equal(t, model.OrderStatusTypeCanceled, wallet.orders[2].Status)
+	require.Equal(t, 120.0, wallet.assets["USDT"].Free)
+	require.Zero(t, wallet.assets["BTC"].Lock)
+
+	t.Run("cancel entry", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 60})
+
+		orders, err := wallet.CreateOrderOTOCO(model.SideTypeBuy, "BTCUSDT", 1, 50, 70, 40, 39)
+		require.NoError(t, err)
+		require.NoError(t, wallet.Cancel(orders[0]))
+		require.Equal(t, model.OrderStatusTypeCanceled, wallet.orders[1].Status)
+		require.Equal(t, model.OrderStatusTypeCanceled, wallet.orders[2].Status)
+		require.Equal(t, 100.0, wallet.assets["USDT"].Free)
+		require.Zero(t, wallet.assets["USDT"].Lock)
+	})
+
+	t.Run("sell entry", func(t *testing.T) {
+		_, err := wallet.CreateOrderOTOCO(model.SideTypeSell, "BTCUSDT", 1, 80, 60, 90, 91)
+		require.Error(t, err)
+	})
+}
+
+func TestPaperWallet_IntrabarPath(t *testing.T) {
+	// both the target (110) and the stop (90) are reached in the candle
+	fill := func(path IntrabarPath, close float64) float64 {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithIntrabarPath(path))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		_, err = wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 89)
+		require.NoError(t, err)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, High: 115, Low: 85, Close: close})
+		require.Equal(t, 0.0, wallet.assets["BTC"].Lock)
+
+		var filled []model.Order
+		for _, order := range wallet.orders[1:] {
+			if order.Status == model.OrderStatusTypeFilled {
+				filled = append(filled, order)
+			}
+		}
+		require.Len(t, filled, 1)
+		return wallet.assets["USDT"].Free
+	}
+
+	require.Equal(t, 90.0, fill(IntrabarPathDirectional, 105))
+	require.Equal(t, 110.0, fill(IntrabarPathDirectional, 95))
+	require.Equal(t, 110.0, fill(IntrabarPathOHLC, 105))
+	require.Equal(t, 90.0, fill(IntrabarPathOLHC, 95))
+
+	t.Run("path hit", func(t *testing.T) {
+		path := []float64{100, 85, 115, 105}
+		hit, ok := pathHit(path, 110, true)
+		require.True(t, ok)
+		require.Equal(t, 40.0, hit)
+
+		hit, ok = pathHit(path, 90, false)
+		require.True(t, ok)
+		require.Equal(t, 10.0, hit)
+
+		_, ok = pathHit(path, 120, true)
+		require.False(t, ok)
+	})
+}
+
+func TestPaperWallet_OrderOCOTrailing(t *testing.T) {
+	setup := func(t *testing.T, options ...PaperWalletOption) (*PaperWallet, []model.Order) {
+		wallet := NewPaperWallet(context.Background(), "USDT",
+			append([]PaperWalletOption{WithPaperAsset("USDT", 100)}, options...)...)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 100})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		orders, err := wallet.CreateOrderOCOTrailing("BTCUSDT", 1, 110, 0.1, 90, 89)
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, model.OrderTypeTakeProfit, orders[0].Type)
+		require.Equal(t, model.OrderTypeStopLoss, orders[1].Type)
+		return wallet, orders
+	}
+
+	t.Run("trailing profit", func(t *testing.T) {
+		wallet, orders := setup(t)
+
+		// activation and ratchet, the stop never moves down
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 105, Close: 115, High: 120, Low: 105})
+		order, err := wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, 108.0, *order.Stop)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 115, Close: 135, High: 140, Low: 112})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 135, Close: 130, High: 135, Low: 127})
+		order, err = wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, 126.0, *order.Stop)
+
+		// trailing stop reached, the loss leg is canceled
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 130, Close: 120, High: 130, Low: 118})
+		order, err = wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 126.0, order.Price)
+
+		order, err = wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+
+		require.Equal(t, 126.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 0.0, wallet.assets["BTC"].Lock)
+	})
+
+	t.Run("fixed loss", func(t *testing.T) {
+		wallet, orders := setup(t)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 85, High: 105, Low: 85})
+		order, err := wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		require.Nil(t, order.Stop)
+
+		order, err = wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 90.0, wallet.assets["USDT"].Free)
+	})
+
+	t.Run("gap through both stops", func(t *testing.T) {
+		wallet, orders := setup(t, WithIntrabarPath(IntrabarPathOLHC))
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 105, Close: 115, High: 120, Low: 105})
+		order, err := wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, 108.0, *order.Stop)
+
+		// the open is below the trailing stop, reached before the fixed stop along the path
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 85, High: 112, Low: 80})
+		order, err = wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 100.0, order.Price)
+		require.NotContains(t, wallet.trailingOCO, order.ExchangeID)
+
+		order, err = wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+
+		require.Equal(t, 100.0, wallet.assets["USDT"].Free)
+		require.Zero(t, wallet.assets["BTC"].Lock)
+		require.Zero(t, wallet.assets["BTC"].Free)
+	})
+
+	t.Run("invalid trail", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+		_, err := wallet.CreateOrderOCOTrailing("BTCUSDT", 1, 110, 0, 90, 89)
+		require.Error(t, err)
+	})
+}
+
 func TestPaperWallet_Order(t *testing.T) {
 	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
 	expectOrder, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
@@ -279,6 +564,59 @@ func TestPaperWallet_Order(t *testing.T) {
 	require.Equal(t, expectOrder, order)
 }
 
+func TestPaperWallet_OpenOrders(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	orders, err := wallet.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.NotNil(t, orders)
+	require.Empty(t, orders)
+
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	limit, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderLimit(model.SideTypeBuy, "ETHUSDT", 1, 10)
+	require.NoError(t, err)
+
+	orders, err = wallet.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, []model.Order{limit}, orders)
+
+	require.NoError(t, wallet.Cancel(limit))
+	orders, err = wallet.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.Empty(t, orders)
+}
+
+func TestPaperWallet_CancelAll(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	first, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+	require.NoError(t, err)
+	second, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 80)
+	require.NoError(t, err)
+	eth, err := wallet.CreateOrderLimit(model.SideTypeBuy, "ETHUSDT", 1, 10)
+	require.NoError(t, err)
+
+	orders, err := wallet.CancelAll("BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	require.Equal(t, first.ExchangeID, orders[0].ExchangeID)
+	require.Equal(t, second.ExchangeID, orders[1].ExchangeID)
+	require.Equal(t, model.OrderStatusTypeCanceled, orders[0].Status)
+
+	orders, err = wallet.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.Empty(t, orders)
+
+	orders, err = wallet.OpenOrders("ETHUSDT")
+	require.NoError(t, err)
+	require.Equal(t, []model.Order{eth}, orders)
+}
+
 func TestPaperWallet_MaxDrawndown(t *testing.T) {
 	tt := []struct {
 		name   string
@@ -552,3 +890,940 @@ func TestUpdateAveragePrice(t *testing.T) {
 	})
 
 }
+
+func TestPaperWallet_Concurrency(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 10, Complete: true})
+	first, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(4)
+		go func(i int) {
+			defer wg.Done()
+			wallet.OnCandle(model.Candle{
+				Pair:     "BTCUSDT",
+				Time:     time.Unix(int64(i), 0),
+				Close:    10,
+				High:     10,
+				Low:      10,
+				Complete: true,
+			})
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+			require.NoError(t, err)
+		}()
+
+		go func() {
+			defer wg.Done()
+			_, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 10)
+			require.NoError(t, err)
+		}()
+
+		go func() {
+			defer wg.Done()
+			_, err := wallet.Account()
+			require.NoError(t, err)
+			_, _, err = wallet.Position("BTCUSDT")
+			require.NoError(t, err)
+			_, err = wallet.Order("BTCUSDT", first.ExchangeID)
+			require.NoError(t, err)
+			wallet.EquityValues()
+			wallet.AssetValues("BTC")
+			wallet.MaxDrawdown()
+		}()
+	}
+	wg.Wait()
+
+	// fill remaining limit orders
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 10, Complete: true})
+
+	asset, quote, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 21.0, asset)
+	require.Equal(t, 9790.0, quote)
+	require.Len(t, wallet.orders, 21)
+}
+
+func TestPaperWallet_TrailingStop(t *testing.T) {
+	t.Run("long percent", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperTrailingStop(0.1))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 100, Complete: true})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// stop starts from entry price
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 95, Complete: true})
+		require.Equal(t, 90.0, wallet.trailingStops["BTCUSDT"])
+
+		// ratchet with highs
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 115, High: 120, Low: 100, Complete: true})
+		require.Equal(t, 108.0, wallet.trailingStops["BTCUSDT"])
+
+		// never moves down
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 115, Close: 112, High: 115, Low: 110, Complete: true})
+		require.Equal(t, 108.0, wallet.trailingStops["BTCUSDT"])
+
+		// trigger exit at stop price
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 112, Close: 105, High: 112, Low: 104, Complete: true})
+		require.NotContains(t, wallet.trailingStops, "BTCUSDT")
+		require.Equal(t, 0.0, wallet.assets["BTC"].Free)
+		require.Equal(t, 108.0, wallet.assets["USDT"].Free)
+
+		order := wallet.orders[len(wallet.orders)-1]
+		require.Equal(t, model.OrderTypeStopLoss, order.Type)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.SideTypeSell, order.Side)
+		require.Equal(t, 108.0, order.Price)
+		require.Equal(t, 1.0, order.Quantity)
+
+		// the exit is reported once to the order controller
+		require.Equal(t, []model.Order{order}, wallet.ForcedOrders())
+		require.Empty(t, wallet.ForcedOrders())
+	})
+
+	t.Run("long with a resting take profit", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperTrailingStop(0.05))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 100, Complete: true})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		takeProfit, err := wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 150)
+		require.NoError(t, err)
+
+		// the locked asset is still protected by the stop
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 100, Complete: true})
+		require.Equal(t, 95.0, wallet.trailingStops["BTCUSDT"])
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 120, High: 120, Low: 100, Complete: true})
+		require.Equal(t, 114.0, wallet.trailingStops["BTCUSDT"])
+
+		// the crash closes the whole position at the stop and cancels the take profit
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 115, Close: 62, High: 115, Low: 60, Complete: true})
+		require.NotContains(t, wallet.trailingStops, "BTCUSDT")
+		require.Zero(t, wallet.assets["BTC"].Free)
+		require.Zero(t, wallet.assets["BTC"].Lock)
+		require.Equal(t, 114.0, wallet.assets["USDT"].Free)
+
+		takeProfit, err = wallet.Order("BTCUSDT", takeProfit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, takeProfit.Status)
+
+		// the take profit is not filled after the exit
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 62, Close: 155, High: 155, Low: 62, Complete: true})
+		require.Zero(t, wallet.assets["BTC"].Free)
+		require.Equal(t, 114.0, wallet.assets["USDT"].Free)
+	})
+
+	t.Run("short percent", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperTrailingStop(0.1))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 100, Complete: true})
+		_, err := wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 100, Low: 100, Complete: true})
+		require.Equal(t, 110.0, wallet.trailingStops["BTCUSDT"])
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 85, High: 100, Low: 80, Complete: true})
+		require.Equal(t, 88.0, wallet.trailingStops["BTCUSDT"])
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 85, Close: 90, High: 90, Low: 85, Complete: true})
+		require.NotContains(t, wallet.trailingStops, "BTCUSDT")
+		require.Equal(t, 0.0, wallet.assets["BTC"].Free)
+		require.Equal(t, 112.0, wallet.assets["USDT"].Free)
+	})
+
+	t.Run("long atr", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperTrailingStopATR(2, 2))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 102, Low: 98, Complete: true})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// not enough data to calculate ATR
+		require.NotContains(t, wallet.trailingStops, "BTCUSDT")
+
+		// ATR = (4 + 4) / 2 = 4, distance = 8
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, High: 102, Low: 98, Complete: true})
+		require.Equal(t, 92.0, wallet.trailingStops["BTCUSDT"])
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 90, Close: 91, High: 95, Low: 90, Complete: true})
+		require.Equal(t, 0.0, wallet.assets["BTC"].Free)
+		require.Equal(t, 90.0, wallet.assets["USDT"].Free)
+	})
+}
+
+func TestPaperWallet_ExecutionDelay(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("candles", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 200),
+			WithExecutionDelay(2))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Open: 90, Close: 100, Complete: true})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, 200.0, wallet.assets["USDT"].Free)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(day), Open: 105, Close: 110, Complete: true})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(2 * day), Open: 120, Close: 130, Complete: true})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 120.0, order.Price)
+		require.Equal(t, start.Add(2*day), order.UpdatedAt)
+		require.Equal(t, 80.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 200),
+			WithExecutionDelayDuration(time.Hour))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Open: 90, Close: 100, Complete: true})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(30 * time.Minute), Open: 95, Close: 100})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Open: 110, Close: 120})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 110.0, order.Price)
+		require.Equal(t, 90.0, wallet.assets["USDT"].Free)
+	})
+
+	t.Run("insufficient funds", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithExecutionDelay(1))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Open: 100, Close: 100, Complete: true})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(day), Open: 150, Close: 150, Complete: true})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeRejected, order.Status)
+		require.Equal(t, 100.0, wallet.assets["USDT"].Free)
+		require.Equal(t, 0.0, wallet.assets["BTC"].Free)
+	})
+}
+
+func TestPaperWallet_Slippage(t *testing.T) {
+	prices := func(options ...PaperWalletOption) []float64 {
+		options = append(options, WithPaperAsset("USDT", 10000), WithSlippage(0.01))
+		wallet := NewPaperWallet(context.Background(), "USDT", options...)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		result := make([]float64, 0)
+		for i := 0; i < 5; i++ {
+			order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, order.Price, 100.0)
+			require.LessOrEqual(t, order.Price, 101.0)
+			result = append(result, order.Price)
+		}
+		return result
+	}
+
+	t.Run("default seed", func(t *testing.T) {
+		require.Equal(t, prices(), prices())
+	})
+
+	t.Run("custom seed", func(t *testing.T) {
+		require.Equal(t, prices(WithRandSeed(42)), prices(WithRandSeed(42)))
+		require.NotEqual(t, prices(WithRandSeed(42)), prices(WithRandSeed(7)))
+	})
+
+	t.Run("sell", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithSlippage(0.01))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Less(t, order.Price, 100.0)
+		require.GreaterOrEqual(t, order.Price, 99.0)
+	})
+}
+
+func TestPaperWallet_IdealComparison(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000),
+		WithPaperFee(0.001, 0.001), WithSpread(20), WithIdealComparison())
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, Complete: true})
+	order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10)
+	require.NoError(t, err)
+	require.InDelta(t, 100.1, order.Price, 1e-9)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 110, Complete: true})
+	_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 10)
+	require.NoError(t, err)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(2 * time.Hour), Close: 110, Complete: true})
+
+	// slippage 1 + 1.1 and fees 1.001 + 1.0989
+	stats := wallet.Stats()
+	require.InDelta(t, 2.1, stats.Slippage["BTCUSDT"], 1e-9)
+	require.InDelta(t, 10095.8001, stats.FinalValue, 1e-9)
+	require.NotNil(t, stats.Ideal)
+	require.InDelta(t, 10100, stats.Ideal.FinalValue, 1e-9)
+	require.InDelta(t, 0.01, stats.Ideal.Return, 1e-9)
+	require.InDelta(t, 4.1999, stats.Ideal.ExecutionDrag, 1e-9)
+
+	ideal := wallet.IdealEquityValues()
+	require.Len(t, ideal, 3)
+	require.InDelta(t, 10100, ideal[2].Value, 1e-9)
+	require.InDelta(t, wallet.EquityValues()[2].Value+4.1999, ideal[2].Value, 1e-9)
+
+	var summary bytes.Buffer
+	wallet.SummaryTo(&summary)
+	require.Contains(t, summary.String(), "-- IDEAL RETURNS --")
+	require.Contains(t, summary.String(), "EXECUTION DRAG      = 4.20 USDT")
+
+	t.Run("execution delay", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000),
+			WithExecutionDelay(1), WithIdealComparison())
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, Complete: true})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10)
+		require.NoError(t, err)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Open: 105, Close: 110,
+			Complete: true})
+
+		// the shadow is filled at the close of the order candle, without the delay
+		stats := wallet.Stats()
+		require.NotNil(t, stats.Ideal)
+		require.InDelta(t, 10100, stats.Ideal.FinalValue, 1e-9)
+		require.InDelta(t, stats.Ideal.FinalValue-stats.FinalValue, stats.Ideal.ExecutionDrag, 1e-9)
+		require.Greater(t, stats.Ideal.ExecutionDrag, 0.0)
+	})
+
+	t.Run("canceled orders", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000),
+			WithIdealComparison())
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, Complete: true})
+		order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 10, 90)
+		require.NoError(t, err)
+		shadow, ok := wallet.idealOrder(order)
+		require.True(t, ok)
+		require.NoError(t, wallet.Cancel(order))
+
+		shadow, err = wallet.ideal.Order("BTCUSDT", shadow.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, shadow.Status)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Low: 80, Close: 100,
+			Complete: true})
+		require.InDelta(t, 10000, wallet.Stats().Ideal.FinalValue, 1e-9)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, Complete: true})
+		require.Nil(t, wallet.Stats().Ideal)
+		require.Empty(t, wallet.IdealEquityValues())
+	})
+}
+
+func TestPaperWallet_Benchmark(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func(options ...PaperWalletOption) WalletStats {
+		wallet := NewPaperWallet(context.Background(), "USDT", append(options, WithPaperAsset("USDT", 10000))...)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, Complete: true})
+		wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Time: start, Close: 10, Complete: true})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10)
+		require.NoError(t, err)
+
+		// BTC +10% and ETH -20%
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 110, Complete: true})
+		wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Time: start.Add(time.Hour), Close: 8, Complete: true})
+		return wallet.Stats()
+	}
+
+	stats := run()
+	require.InDelta(t, 0.01, stats.Return, 1e-9)
+	require.NotNil(t, stats.Benchmark)
+	require.InDelta(t, 0.1, stats.Benchmark.Pairs["BTCUSDT"], 1e-9)
+	require.InDelta(t, -0.2, stats.Benchmark.Pairs["ETHUSDT"], 1e-9)
+	require.Equal(t, map[string]float64{"BTCUSDT": 0.5, "ETHUSDT": 0.5}, stats.Benchmark.Weights)
+	require.InDelta(t, -0.05, stats.Benchmark.Return, 1e-9)
+	require.InDelta(t, stats.MarketChange, stats.Benchmark.Return, 1e-9)
+	require.InDelta(t, 0.06, stats.Benchmark.Alpha, 1e-9)
+
+	t.Run("weights", func(t *testing.T) {
+		stats := run(WithBenchmarkWeights(map[string]float64{"BTCUSDT": 3, "ETHUSDT": 1}))
+		require.InDelta(t, 0.75, stats.Benchmark.Weights["BTCUSDT"], 1e-9)
+		require.InDelta(t, 0.025, stats.Benchmark.Return, 1e-9)
+		require.InDelta(t, -0.015, stats.Benchmark.Alpha, 1e-9)
+
+		stats = run(WithBenchmarkWeights(map[string]float64{"BTCUSDT": 1}))
+		require.Equal(t, 0.0, stats.Benchmark.Weights["ETHUSDT"])
+		require.InDelta(t, 0.1, stats.Benchmark.Return, 1e-9)
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, Complete: true})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 120, Complete: true})
+
+		var summary bytes.Buffer
+		wallet.SummaryTo(&summary)
+		require.Contains(t, summary.String(), "BENCHMARK RETURN    = 20.00%")
+		require.Contains(t, summary.String(), "ALPHA               = -20.00%")
+	})
+
+	t.Run("without candles", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000))
+		require.Nil(t, wallet.Stats().Benchmark)
+	})
+}
+
+func TestPaperWallet_Spread(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000), WithSpread(20),
+		WithPaperFee(0, 0.001))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	require.InDelta(t, 100.1, order.Price, 1e-9)
+
+	order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+	require.InDelta(t, 99.9, order.Price, 1e-9)
+
+	// the spread is paid on top of the taker fees
+	require.InDelta(t, 1000-0.2-0.2, wallet.assets["USDT"].Free, 1e-9)
+}
+
+func TestPaperWallet_FillModelOrderBook(t *testing.T) {
+	depth := model.Depth{
+		Pair: "BTCUSDT",
+		Bids: []model.PriceLevel{{Price: 99, Quantity: 1}, {Price: 98, Quantity: 1}},
+		Asks: []model.PriceLevel{{Price: 101, Quantity: 1}, {Price: 102, Quantity: 2}},
+	}
+
+	t.Run("walk the book", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithFillModel(FillModelOrderBook))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		wallet.OnDepth(depth)
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 2.0, order.Quantity)
+		require.Equal(t, 101.5, order.Price)
+
+		// the remaining liquidity is used by the next order
+		order, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 3)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.Equal(t, 3.0, order.Quantity)
+		require.Equal(t, 1.0, order.ExecutedQuantity)
+		require.Equal(t, 102.0, order.Price)
+		require.Equal(t, 3.0, wallet.assets["BTC"].Free)
+
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrInvalidQuantity)
+
+		// the rest of the partial fill expires with the next candle
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeExpired, order.Status)
+		require.Equal(t, 1.0, order.ExecutedQuantity)
+		wallet.OnDepth(depth)
+
+		order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1.5)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 1.5, order.Quantity)
+		require.InDelta(t, (99+98*0.5)/1.5, order.Price, 1e-9)
+	})
+
+	t.Run("synthesized depth", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithFillModel(FillModelOrderBook), WithSynthesizedDepth(2, 0.01, 0.5))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100, Volume: 4})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 3)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.Equal(t, 2.0, order.ExecutedQuantity)
+		require.Equal(t, 100.5, order.Price)
+	})
+
+	t.Run("without depth", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithFillModel(FillModelOrderBook))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, order.Quantity)
+		require.Equal(t, 100.0, order.Price)
+	})
+}
+
+func TestPaperWallet_Fees(t *testing.T) {
+	t.Run("taker fee", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperFee(0.001, 0.002))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.InDelta(t, 0.2, order.Fee, 1e-9)
+		require.InDelta(t, 899.8, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0.2, wallet.Fees("BTCUSDT"), 1e-9)
+	})
+
+	t.Run("fee in the funds check", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+			WithPaperFee(0.001, 0.002))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+		require.Equal(t, 100.0, wallet.assets["USDT"].Free)
+
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.99)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, wallet.assets["USDT"].Free, 0.0)
+
+		// the fee of the exit is paid with the proceeds
+		_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.99)
+		require.NoError(t, err)
+	})
+
+	t.Run("maker rebate", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperFee(-0.0001, 0.001))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 89, High: 95, Low: 85})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, -0.009, order.Fee, 1e-9)
+		require.InDelta(t, 910.009, wallet.assets["USDT"].Free, 1e-9)
+
+		order, err = wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 110)
+		require.NoError(t, err)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 105, High: 112, Low: 100})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, -0.011, order.Fee, 1e-9)
+		require.InDelta(t, 1020.02, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, -0.02, wallet.Fees("BTCUSDT"), 1e-9)
+	})
+	t.Run("fee schedule", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperFee(0.001, 0.002), WithPaperFeeSchedule(model.FeeSchedule{"ETHUSDT": {Maker: 0, Taker: 0.0005}}))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 10})
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 10)
+		require.NoError(t, err)
+		require.InDelta(t, 0.05, order.Fee, 1e-9)
+
+		order, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.InDelta(t, 0.2, order.Fee, 1e-9)
+		require.InDelta(t, 799.75, wallet.assets["USDT"].Free, 1e-9)
+	})
+}
+
+func TestPaperWallet_Funding(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000),
+		WithPaperFunding(8*time.Hour, func(pair string, t time.Time) float64 {
+			return 0.001
+		}))
+
+	_, _, err := wallet.FundingRate("BTCUSDT")
+	require.ErrorIs(t, err, ErrInvalidAsset)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Open: 100, Close: 100})
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// no funding time between the candles
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(4 * time.Hour), Open: 100, Close: 100})
+	require.Zero(t, wallet.Funding("BTCUSDT"))
+	require.InDelta(t, 9900, wallet.assets["USDT"].Free, 1e-9)
+
+	// long position pays the funding
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(8 * time.Hour), Open: 100, Close: 100})
+	require.InDelta(t, 0.1, wallet.Funding("BTCUSDT"), 1e-9)
+	require.InDelta(t, 9899.9, wallet.assets["USDT"].Free, 1e-9)
+
+	_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// short position receives the funding
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(16 * time.Hour), Open: 200, Close: 200})
+	require.InDelta(t, -0.1, wallet.Funding("BTCUSDT"), 1e-9)
+
+	rate, next, err := wallet.FundingRate("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 0.001, rate)
+	require.Equal(t, start.Add(24*time.Hour), next)
+}
+
+func TestPaperWallet_Yield(t *testing.T) {
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 10000),
+		WithPaperYield("eth", 0.05))
+
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Time: start, Open: 100, Close: 100})
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 10)
+	require.NoError(t, err)
+
+	// same day, no yield
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Time: start.Add(6 * time.Hour), Open: 100, Close: 100})
+	require.Zero(t, wallet.Yield("ETH"))
+
+	// one year of daily compounding, 5% APY
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Time: start.AddDate(0, 0, 365), Open: 100, Close: 100})
+	require.InDelta(t, 0.5, wallet.Yield("ETH"), 1e-9)
+	require.InDelta(t, 10.5, wallet.assets["ETH"].Free, 1e-9)
+	require.InDelta(t, 0.5, wallet.Stats().Yield["ETH"], 1e-9)
+
+	// the quote asset without yield is not credited
+	require.InDelta(t, 9000, wallet.assets["USDT"].Free, 1e-9)
+}
+
+func TestPaperWallet_LastPrice(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+
+	_, err := wallet.LastPrice("BTCUSDT")
+	require.ErrorIs(t, err, ErrInvalidAsset)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(0, 0), Close: 50})
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(60, 0), Close: 55})
+
+	price, err := wallet.LastPrice("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 55.0, price)
+}
+
+func TestPaperWallet_Trades(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000), WithPaperFee(0.001, 0.002))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(0, 0), Close: 100})
+
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 110)
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 200)
+	require.NoError(t, err)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(60, 0), High: 120, Close: 115})
+
+	trades, err := wallet.Trades("BTCUSDT", 0)
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	require.Equal(t, model.SideTypeBuy, trades[0].Side)
+	require.False(t, trades[0].IsMaker)
+	require.InDelta(t, 0.4, trades[0].Commission, 1e-9)
+	require.Equal(t, "USDT", trades[0].CommissionAsset)
+	require.Equal(t, model.SideTypeSell, trades[1].Side)
+	require.True(t, trades[1].IsMaker)
+	require.InDelta(t, 0.11, trades[1].Commission, 1e-9)
+	require.Equal(t, time.Unix(60, 0), trades[1].Time)
+
+	trades, err = wallet.Trades("BTCUSDT", 1)
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	require.Equal(t, model.SideTypeSell, trades[0].Side)
+}
+
+func TestPaperWallet_Leverage(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, open, high, low, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hours) * time.Hour), Open: open,
+			High: high, Low: low, Close: close, Complete: true}
+	}
+
+	t.Run("long liquidation", func(t *testing.T) {
+		var notified []Liquidation
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperLeverage(10, 0.005), WithPaperFee(0, 0.001),
+			WithPaperLiquidationHandler(func(liquidation Liquidation) {
+				notified = append(notified, liquidation)
+			}))
+		wallet.OnCandle(candle(0, 100, 100, 100, 100))
+
+		// 5000 of notional requires 500 of margin
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 50)
+		require.NoError(t, err)
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 60)
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+
+		price, ok := wallet.LiquidationPrice("BTCUSDT")
+		require.True(t, ok)
+		require.InDelta(t, 100*0.9/0.995, price, 1e-9)
+
+		_, err = wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 50, 120)
+		require.NoError(t, err)
+
+		wallet.OnCandle(candle(1, 95, 96, 91, 92))
+		require.Empty(t, wallet.Liquidations())
+
+		wallet.OnCandle(candle(2, 92, 93, 89, 90))
+		liquidations := wallet.Liquidations()
+		require.Len(t, liquidations, 1)
+		require.Equal(t, notified, liquidations)
+		require.Equal(t, model.SideTypeSell, liquidations[0].Side)
+		require.Equal(t, 50.0, liquidations[0].Quantity)
+		require.InDelta(t, price, liquidations[0].Price, 1e-9)
+		require.InDelta(t, (100-price)*50, liquidations[0].Loss, 1e-9)
+		require.InDelta(t, price*50*0.001, liquidations[0].Fee, 1e-9)
+
+		forced := wallet.ForcedOrders()
+		require.Len(t, forced, 1)
+		require.Equal(t, model.SideTypeSell, forced[0].Side)
+		require.Equal(t, 50.0, forced[0].Quantity)
+
+		// the position is closed and the open orders are canceled
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+		_, ok = wallet.LiquidationPrice("BTCUSDT")
+		require.False(t, ok)
+		require.InDelta(t, 1000-5-(100-price)*50-price*50*0.001, wallet.Equity(), 1e-9)
+	})
+
+	t.Run("short liquidation with gap", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperLeverage(10, 0.005))
+		wallet.OnCandle(candle(0, 100, 100, 100, 100))
+
+		_, err := wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 50)
+		require.NoError(t, err)
+
+		price, ok := wallet.LiquidationPrice("BTCUSDT")
+		require.True(t, ok)
+		require.InDelta(t, 100*1.1/1.005, price, 1e-9)
+
+		// the candle opens above the liquidation price
+		wallet.OnCandle(candle(1, 112, 115, 111, 113))
+		liquidations := wallet.Liquidations()
+		require.Len(t, liquidations, 1)
+		require.Equal(t, model.SideTypeBuy, liquidations[0].Side)
+		require.Equal(t, 112.0, liquidations[0].Price)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+		require.InDelta(t, 1000-12*50, wallet.Equity(), 1e-9)
+	})
+}
+
+func TestPaperWallet_BalanceReservation(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 700, Low: 700, High: 700})
+
+	// the quote of a resting buy is locked until the order is filled or canceled
+	first, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 600)
+	require.NoError(t, err)
+	require.Equal(t, 400.0, wallet.assets["USDT"].Free)
+	require.Equal(t, 600.0, wallet.assets["USDT"].Lock)
+
+	_, err = wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 500)
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	require.NoError(t, wallet.Cancel(first))
+	require.Equal(t, 1000.0, wallet.assets["USDT"].Free)
+	require.Zero(t, wallet.assets["USDT"].Lock)
+
+	// canceling again doesn't release twice
+	require.NoError(t, wallet.Cancel(first))
+	require.Equal(t, 1000.0, wallet.assets["USDT"].Free)
+
+	_, err = wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 500)
+	require.NoError(t, err)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 450, Low: 450, High: 450})
+	require.Equal(t, 500.0, wallet.assets["USDT"].Free)
+	require.Zero(t, wallet.assets["USDT"].Lock)
+	require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+
+	// the legs of an OCO share the locked asset
+	_, err = wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 700, 300, 300)
+	require.NoError(t, err)
+	require.Zero(t, wallet.assets["BTC"].Free)
+	require.Equal(t, 1.0, wallet.assets["BTC"].Lock)
+
+	canceled, err := wallet.CancelAll("BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, canceled, 2)
+	require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+	require.Zero(t, wallet.assets["BTC"].Lock)
+	require.Equal(t, 500.0, wallet.assets["USDT"].Free)
+	require.Zero(t, wallet.assets["USDT"].Lock)
+
+	// only the unfilled part of a partially filled order is released
+	order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 400)
+	require.NoError(t, err)
+	require.Equal(t, 400.0, wallet.assets["USDT"].Lock)
+
+	for i := range wallet.orders {
+		if wallet.orders[i].ExchangeID == order.ExchangeID {
+			wallet.orders[i].Status = model.OrderStatusTypePartiallyFilled
+			wallet.orders[i].ExecutedQuantity = 0.25
+		}
+	}
+	wallet.assets["USDT"].Lock -= 100
+	wallet.assets["BTC"].Free += 0.25
+
+	require.NoError(t, wallet.Cancel(order))
+	require.Equal(t, 400.0, wallet.assets["USDT"].Free)
+	require.Zero(t, wallet.assets["USDT"].Lock)
+}
+
+func TestPaperWallet_TrailingStopOrder(t *testing.T) {
+	t.Run("sell with activation", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, Low: 100, High: 100})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		order, err := wallet.CreateOrderTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 110, 0.05)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTrailingStopMarket, order.Type)
+		require.Equal(t, 110.0, order.Price)
+		require.Nil(t, order.Stop)
+
+		// no funds are reserved by the conditional order
+		require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+
+		// not activated below the activation price
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 90, Low: 90, High: 105})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Nil(t, order.Stop)
+
+		// activated, trailing the highest price
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 105, Close: 118, Low: 105, High: 120})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.InDelta(t, 114.0, *order.Stop, 1e-9)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 118, Close: 112, Low: 110, High: 119})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 114.0, order.Price, 1e-9)
+		require.Zero(t, wallet.assets["BTC"].Free)
+		require.InDelta(t, 1014.0, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("buy without activation", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, Low: 100, High: 100})
+
+		order, err := wallet.CreateOrderTrailingStop(model.SideTypeBuy, "BTCUSDT", 1, 0, 0.1)
+		require.NoError(t, err)
+		require.InDelta(t, 110.0, *order.Stop, 1e-9)
+
+		// trailing the lowest price, a gap fills at the open price
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 95, Close: 85, Low: 80, High: 95})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 92, Close: 93, Low: 91, High: 95})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 92.0, order.Price, 1e-9)
+		require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+	})
+
+	t.Run("cancel and invalid rate", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, Close: 100, Low: 100, High: 100})
+
+		_, err := wallet.CreateOrderTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 0, 1.5)
+		require.Error(t, err)
+
+		order, err := wallet.CreateOrderTrailingStop(model.SideTypeBuy, "BTCUSDT", 1, 0, 0.1)
+		require.NoError(t, err)
+		require.NoError(t, wallet.Cancel(order))
+		require.Equal(t, 1000.0, wallet.assets["USDT"].Free)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 150, Close: 150, Low: 150, High: 150})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+}
+
+func TestPaperWallet_OrderReplace(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 700, Low: 700, High: 700})
+
+	order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 600)
+	require.NoError(t, err)
+
+	// the reserved funds follow the new price and quantity
+	replaced, err := wallet.OrderReplace(order, 500, 1.5)
+	require.NoError(t, err)
+	require.Equal(t, order.ExchangeID, replaced.ExchangeID)
+	require.Equal(t, 500.0, replaced.Price)
+	require.Equal(t, 1.5, replaced.Quantity)
+	require.Equal(t, 250.0, wallet.assets["USDT"].Free)
+	require.Equal(t, 750.0, wallet.assets["USDT"].Lock)
+
+	// the order is kept without funds for the new values
+	_, err = wallet.OrderReplace(order, 500, 3)
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+	require.Equal(t, 250.0, wallet.assets["USDT"].Free)
+	require.Equal(t, 750.0, wallet.assets["USDT"].Lock)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 450, Low: 450, High: 450})
+	order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 1.5, wallet.assets["BTC"].Free)
+	require.Zero(t, wallet.assets["USDT"].Lock)
+
+	// filled and market orders can't be replaced
+	_, err = wallet.OrderReplace(order, 400, 1)
+	require.Error(t, err)
+
+	market, err := wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+	require.NoError(t, err)
+	_, err = wallet.OrderReplace(market, 400, 1)
+	require.Error(t, err)
+}
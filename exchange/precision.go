@@ -0,0 +1,48 @@
+package exchange
+
+import (
+	"math"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// precisionOverrides are the decimal places of quantities and prices set by the user per pair, replacing
+// the precision reported by the exchange
+type precisionOverrides struct {
+	quantity map[string]int
+	price    map[string]int
+}
+
+func (p *precisionOverrides) setQuantity(pair string, decimals int) {
+	if p.quantity == nil {
+		p.quantity = make(map[string]int)
+	}
+	p.quantity[pair] = decimals
+}
+
+func (p *precisionOverrides) setPrice(pair string, decimals int) {
+	if p.price == nil {
+		p.price = make(map[string]int)
+	}
+	p.price[pair] = decimals
+}
+
+// apply replaces the precision of the pair info with the overrides. A step or tick size finer than the
+// overridden precision is raised to it, so the rounded values are truncated instead of rounded up
+func (p precisionOverrides) apply(pair string, info model.AssetInfo) model.AssetInfo {
+	if decimals, ok := p.quantity[pair]; ok {
+		info.BaseAssetPrecision = decimals
+		if step := math.Pow10(-decimals); info.StepSize < step {
+			info.StepSize = step
+		}
+	}
+
+	if decimals, ok := p.price[pair]; ok {
+		info.QuotePrecision = decimals
+		if tick := math.Pow10(-decimals); info.TickSize < tick {
+			info.TickSize = tick
+		}
+	}
+
+	return info
+}
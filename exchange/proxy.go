@@ -0,0 +1,61 @@
+package exchange
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+// ProxyRoundTripper is implemented by custom transports of the HTTP client options that wrap another transport,
+// e.g. a middleware that signs or logs the requests, to route the requests of the wrapped transport through the
+// proxy of the exchange options
+type ProxyRoundTripper interface {
+	http.RoundTripper
+	// WithProxy returns a copy of the transport with the requests routed through the proxy
+	WithProxy(proxy *url.URL) http.RoundTripper
+}
+
+// proxyClient returns a copy of the HTTP client with the requests routed through the proxy, keeping the
+// settings of the client transport (e.g. TLS config) and the custom transports that wrap it
+func proxyClient(client *http.Client, proxy *url.URL) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	result := *client
+	result.Transport = proxyTransport(client.Transport, proxy)
+	return &result
+}
+
+// proxyTransport returns a copy of the transport with the requests routed through the proxy. A custom transport
+// that is not a ProxyRoundTripper can't be changed, it is kept without the proxy
+func proxyTransport(roundTripper http.RoundTripper, proxy *url.URL) http.RoundTripper {
+	switch transport := roundTripper.(type) {
+	case nil:
+		return proxyTransport(http.DefaultTransport, proxy)
+	case *http.Transport:
+		transport = transport.Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		return transport
+	case ProxyRoundTripper:
+		return transport.WithProxy(proxy)
+	default:
+		log.Warnf("[EXCHANGE] proxy not applied to the custom transport %T, see exchange.ProxyRoundTripper",
+			roundTripper)
+		return roundTripper
+	}
+}
+
+// proxyDialer returns a copy of the websocket dialer with the connections routed through the proxy
+func proxyDialer(dialer *websocket.Dialer, proxy *url.URL) *websocket.Dialer {
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+
+	result := *dialer
+	result.Proxy = http.ProxyURL(proxy)
+	return &result
+}
@@ -0,0 +1,71 @@
+package exchange
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	proxy, err := url.Parse("http://proxy.local:8080")
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodGet, "https://api.bybit.com", nil)
+	require.NoError(t, err)
+
+	t.Run("client", func(t *testing.T) {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		client := &http.Client{Timeout: time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+		result := proxyClient(client, proxy)
+		require.Equal(t, time.Second, result.Timeout)
+
+		transport := result.Transport.(*http.Transport)
+		require.Equal(t, tlsConfig, transport.TLSClientConfig)
+		proxyURL, err := transport.Proxy(request)
+		require.NoError(t, err)
+		require.Equal(t, proxy, proxyURL)
+
+		// the original client is not changed
+		require.Nil(t, client.Transport.(*http.Transport).Proxy)
+	})
+
+	t.Run("wrapped transport", func(t *testing.T) {
+		client := debugClient(&http.Client{Transport: &http.Transport{}})
+
+		transport := proxyClient(client, proxy).Transport.(*debugTransport)
+		proxyURL, err := transport.next.(*http.Transport).Proxy(request)
+		require.NoError(t, err)
+		require.Equal(t, proxy, proxyURL)
+	})
+
+	t.Run("custom transport", func(t *testing.T) {
+		custom := roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+		client := &http.Client{Transport: custom}
+
+		// a transport that can't be changed is kept
+		require.NotNil(t, proxyClient(client, proxy).Transport.(roundTripperFunc))
+	})
+
+	t.Run("dialer", func(t *testing.T) {
+		dialer := &websocket.Dialer{HandshakeTimeout: time.Second}
+
+		result := proxyDialer(dialer, proxy)
+		require.Equal(t, time.Second, result.HandshakeTimeout)
+		proxyURL, err := result.Proxy(request)
+		require.NoError(t, err)
+		require.Equal(t, proxy, proxyURL)
+		require.Nil(t, dialer.Proxy)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
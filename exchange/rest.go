@@ -0,0 +1,741 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+var ErrEndpointNotConfigured = errors.New("endpoint not configured")
+
+type RESTAuthType string
+
+const (
+	// RESTAuthNone sends requests without credentials
+	RESTAuthNone RESTAuthType = "none"
+	// RESTAuthHeader sends the API key in the configured header
+	RESTAuthHeader RESTAuthType = "header"
+	// RESTAuthHMAC sends the API key in the configured header and signs signed endpoints with
+	// HMAC-SHA256(secret, query + body), appending timestamp and signature to the query string
+	RESTAuthHMAC RESTAuthType = "hmac-sha256"
+)
+
+type RESTAuth struct {
+	Type           RESTAuthType
+	Key            string
+	Secret         string
+	KeyHeader      string // default: X-API-KEY
+	TimestampParam string // default: timestamp
+	SignatureParam string // default: signature
+}
+
+// RESTEndpoint declares how to call an exchange endpoint and how to read its response.
+// Path and Body are Go templates executed with the request parameters:
+// .Pair, .Asset, .Quote, .Timeframe, .Limit, .Start, .End (unix ms), .Side, .Type,
+// .Quantity, .Price, .Stop (formatted with the asset precision), .TimeInForce and .ID (exchange order ID).
+// Root is the JSON path to the data in the response, and Fields maps each ninjabot field
+// to a JSON path relative to the data. Paths are dot separated keys or array indexes, eg: "data.0.price".
+//
+// Fields by endpoint:
+//   - Candles: time, open, close, high, low, volume (root must be a list)
+//   - LastQuote: price
+//   - Account: asset, free, locked (root must be a list)
+//   - Order, CreateOrder: id, status, price, quantity, created_at, updated_at
+//   - OpenOrders: same fields of Order (root must be a list)
+type RESTEndpoint struct {
+	Method string
+	Path   string
+	Body   string
+	Signed bool
+	Root   string
+	Fields map[string]string
+}
+
+type RESTConfig struct {
+	BaseURL      string
+	Auth         RESTAuth
+	Client       *http.Client
+	PollInterval time.Duration
+
+	// Assets defines the trading limits of each pair, used to validate and format orders
+	Assets map[string]model.AssetInfo
+	// StatusMap translates exchange order status to ninjabot status, eg: {"open": "NEW"}
+	StatusMap map[string]model.OrderStatusType
+
+	Candles     RESTEndpoint
+	LastQuote   RESTEndpoint
+	Account     RESTEndpoint
+	Order       RESTEndpoint
+	OpenOrders  RESTEndpoint
+	CreateOrder RESTEndpoint
+	Cancel      RESTEndpoint
+}
+
+type restParams struct {
+	Pair        string
+	Asset       string
+	Quote       string
+	Timeframe   string
+	Limit       int
+	Start       int64
+	End         int64
+	Side        model.SideType
+	Type        model.OrderType
+	Quantity    string
+	Price       string
+	Stop        string
+	TimeInForce model.TimeInForce
+	ID          int64
+}
+
+// REST is a generic exchange adapter for custom or self-hosted exchanges, requests and
+// response mappings are declared in RESTConfig
+type REST struct {
+	ctx    context.Context
+	config RESTConfig
+	client *http.Client
+}
+
+// NewREST creates a generic REST exchange from the given config
+func NewREST(ctx context.Context, config RESTConfig) (*REST, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("rest: base url is required")
+	}
+
+	if config.Auth.Type == "" {
+		config.Auth.Type = RESTAuthNone
+	}
+
+	if config.Auth.KeyHeader == "" {
+		config.Auth.KeyHeader = "X-API-KEY"
+	}
+
+	if config.Auth.TimestampParam == "" {
+		config.Auth.TimestampParam = "timestamp"
+	}
+
+	if config.Auth.SignatureParam == "" {
+		config.Auth.SignatureParam = "signature"
+	}
+
+	if config.PollInterval == 0 {
+		config.PollInterval = 5 * time.Second
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	log.Infof("[SETUP] Using REST exchange: %s", config.BaseURL)
+
+	return &REST{ctx: ctx, config: config, client: client}, nil
+}
+
+func (r *REST) request(ctx context.Context, name string, endpoint RESTEndpoint,
+	params restParams) (interface{}, error) {
+
+	if endpoint.Path == "" {
+		return nil, fmt.Errorf("rest: %s: %w", name, ErrEndpointNotConfigured)
+	}
+
+	path, err := executeTemplate(endpoint.Path, params)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %s: invalid path template: %w", name, err)
+	}
+
+	body, err := executeTemplate(endpoint.Body, params)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %s: invalid body template: %w", name, err)
+	}
+
+	requestURL, err := url.Parse(strings.TrimRight(r.config.BaseURL, "/") + path)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %s: %w", name, err)
+	}
+
+	if endpoint.Signed && r.config.Auth.Type == RESTAuthHMAC {
+		query := requestURL.Query()
+		query.Set(r.config.Auth.TimestampParam, strconv.FormatInt(time.Now().UnixMilli(), 10))
+		requestURL.RawQuery = query.Encode()
+
+		mac := hmac.New(sha256.New, []byte(r.config.Auth.Secret))
+		mac.Write([]byte(requestURL.RawQuery + body))
+		requestURL.RawQuery += "&" + r.config.Auth.SignatureParam + "=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	method := endpoint.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("rest: %s: %w", name, err)
+	}
+
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if r.config.Auth.Type == RESTAuthHeader || r.config.Auth.Type == RESTAuthHMAC {
+		req.Header.Set(r.config.Auth.KeyHeader, r.config.Auth.Key)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %s: %w", name, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("rest: %s: status %d: %s", name, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("rest: %s: invalid response: %w", name, err)
+	}
+
+	return jsonPath(data, endpoint.Root), nil
+}
+
+func executeTemplate(text string, params restParams) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buffer, params); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// jsonPath returns the value in a dot separated path of keys or array indexes
+func jsonPath(data interface{}, path string) interface{} {
+	if path == "" {
+		return data
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch value := data.(type) {
+		case map[string]interface{}:
+			data = value[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil
+			}
+			data = value[index]
+		default:
+			return nil
+		}
+	}
+
+	return data
+}
+
+func (e RESTEndpoint) field(data interface{}, name string) interface{} {
+	path, ok := e.Fields[name]
+	if !ok {
+		path = name
+	}
+	return jsonPath(data, path)
+}
+
+func (e RESTEndpoint) floatField(data interface{}, name string) (float64, error) {
+	switch value := e.field(data, name).(type) {
+	case json.Number:
+		return value.Float64()
+	case string:
+		return strconv.ParseFloat(value, 64)
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("invalid number in field %s: %v", name, value)
+	}
+}
+
+func (e RESTEndpoint) stringField(data interface{}, name string) string {
+	switch value := e.field(data, name).(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// timeField reads numbers as unix milliseconds and strings as RFC3339 or unix milliseconds
+func (e RESTEndpoint) timeField(data interface{}, name string) (time.Time, error) {
+	switch value := e.field(data, name).(type) {
+	case json.Number:
+		ms, err := value.Int64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(ms), nil
+	case string:
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.UnixMilli(ms), nil
+		}
+		return time.Parse(time.RFC3339, value)
+	case nil:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid time in field %s: %v", name, value)
+	}
+}
+
+func (r *REST) params(pair string) restParams {
+	asset, quote := SplitAssetQuote(pair)
+	return restParams{Pair: pair, Asset: asset, Quote: quote}
+}
+
+func (r *REST) AssetsInfo(pair string) model.AssetInfo {
+	if info, ok := r.config.Assets[pair]; ok {
+		return info
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	return model.AssetInfo{
+		BaseAsset:          asset,
+		QuoteAsset:         quote,
+		MaxPrice:           math.MaxFloat64,
+		MaxQuantity:        math.MaxFloat64,
+		StepSize:           0.00000001,
+		TickSize:           0.00000001,
+		QuotePrecision:     8,
+		BaseAssetPrecision: 8,
+	}
+}
+
+func (r *REST) LastQuote(ctx context.Context, pair string) (float64, error) {
+	if r.config.LastQuote.Path == "" {
+		candles, err := r.candles(ctx, pair, "1m", restParams{Limit: 1})
+		if err != nil || len(candles) < 1 {
+			return 0, err
+		}
+		return candles[len(candles)-1].Close, nil
+	}
+
+	data, err := r.request(ctx, "last quote", r.config.LastQuote, r.params(pair))
+	if err != nil {
+		return 0, err
+	}
+
+	return r.config.LastQuote.floatField(data, "price")
+}
+
+// LastPrice returns the last price of the pair from the LastQuote endpoint, or the last candle without it
+func (r *REST) LastPrice(pair string) (float64, error) {
+	return r.LastQuote(r.ctx, pair)
+}
+
+func (r *REST) candles(ctx context.Context, pair, timeframe string, params restParams) ([]model.Candle, error) {
+	duration, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, fmt.Errorf("rest: invalid timeframe %s: %w", timeframe, err)
+	}
+
+	base := r.params(pair)
+	params.Pair, params.Asset, params.Quote, params.Timeframe = base.Pair, base.Asset, base.Quote, timeframe
+	data, err := r.request(ctx, "candles", r.config.Candles, params)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rest: candles: expected a list, got %T", data)
+	}
+
+	now := time.Now()
+	endpoint := r.config.Candles
+	candles := make([]model.Candle, 0, len(items))
+	for _, item := range items {
+		candle := model.Candle{Pair: pair, Metadata: make(map[string]float64)}
+		if candle.Time, err = endpoint.timeField(item, "time"); err != nil {
+			return nil, fmt.Errorf("rest: candles: %w", err)
+		}
+
+		for field, value := range map[string]*float64{
+			"open":   &candle.Open,
+			"close":  &candle.Close,
+			"high":   &candle.High,
+			"low":    &candle.Low,
+			"volume": &candle.Volume,
+		} {
+			if *value, err = endpoint.floatField(item, field); err != nil {
+				return nil, fmt.Errorf("rest: candles: %w", err)
+			}
+		}
+
+		candle.UpdatedAt = candle.Time
+		candle.Complete = !candle.Time.Add(duration).After(now)
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+func (r *REST) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	candles, err := r.candles(ctx, pair, period, restParams{Limit: limit + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	// discard incomplete candles
+	complete := make([]model.Candle, 0, len(candles))
+	for _, candle := range candles {
+		if candle.Complete {
+			complete = append(complete, candle)
+		}
+	}
+
+	if len(complete) > limit {
+		complete = complete[len(complete)-limit:]
+	}
+
+	return complete, nil
+}
+
+func (r *REST) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	return r.candles(ctx, pair, period, restParams{Start: start.UnixMilli(), End: end.UnixMilli()})
+}
+
+// CandlesSubscription polls the candles endpoint and emits each new complete candle
+func (r *REST) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+
+	go func() {
+		ticker := time.NewTicker(r.config.PollInterval)
+		defer ticker.Stop()
+
+		var last time.Time
+		for {
+			candles, err := r.CandlesByLimit(ctx, pair, period, 2)
+			if err != nil {
+				cerr <- err
+			}
+
+			for _, candle := range candles {
+				if candle.Time.After(last) {
+					last = candle.Time
+					ccandle <- candle
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				close(cerr)
+				close(ccandle)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// TradesSubscription polls the 1m candles endpoint and emits synthesized trades of each new candle,
+// since trade streams are not supported by the generic adapter
+func (r *REST) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ctrade := make(chan model.Trade)
+	ccandle, cerr := r.CandlesSubscription(ctx, pair, "1m")
+
+	go func() {
+		for candle := range ccandle {
+			for _, trade := range candle.ToTrades(time.Minute) {
+				ctrade <- trade
+			}
+		}
+		close(ctrade)
+	}()
+
+	return ctrade, cerr
+}
+
+func (r *REST) Account() (model.Account, error) {
+	data, err := r.request(r.ctx, "account", r.config.Account, restParams{})
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	items, ok := data.([]interface{})
+	if !ok {
+		return model.Account{}, fmt.Errorf("rest: account: expected a list, got %T", data)
+	}
+
+	endpoint := r.config.Account
+	balances := make([]model.Balance, 0, len(items))
+	for _, item := range items {
+		free, err := endpoint.floatField(item, "free")
+		if err != nil {
+			return model.Account{}, fmt.Errorf("rest: account: %w", err)
+		}
+
+		locked, err := endpoint.floatField(item, "locked")
+		if err != nil {
+			return model.Account{}, fmt.Errorf("rest: account: %w", err)
+		}
+
+		balances = append(balances, model.Balance{
+			Asset: endpoint.stringField(item, "asset"),
+			Free:  free,
+			Lock:  locked,
+		})
+	}
+
+	return model.Account{Balances: balances}, nil
+}
+
+func (r *REST) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := r.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+func (r *REST) newOrder(endpoint RESTEndpoint, data interface{}, params restParams) (model.Order, error) {
+	order := model.Order{
+		Pair: params.Pair,
+		Side: params.Side,
+		Type: params.Type,
+	}
+
+	var err error
+	id := endpoint.stringField(data, "id")
+	if order.ExchangeID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return model.Order{}, fmt.Errorf("rest: invalid order id %s: %w", id, err)
+	}
+
+	status := endpoint.stringField(data, "status")
+	if mapped, ok := r.config.StatusMap[status]; ok {
+		order.Status = mapped
+	} else {
+		order.Status = model.OrderStatusType(strings.ToUpper(status))
+	}
+
+	if order.Price, err = endpoint.floatField(data, "price"); err != nil {
+		return model.Order{}, fmt.Errorf("rest: %w", err)
+	}
+
+	if order.Quantity, err = endpoint.floatField(data, "quantity"); err != nil {
+		return model.Order{}, fmt.Errorf("rest: %w", err)
+	}
+
+	if order.CreatedAt, err = endpoint.timeField(data, "created_at"); err != nil {
+		return model.Order{}, fmt.Errorf("rest: %w", err)
+	}
+
+	if order.UpdatedAt, err = endpoint.timeField(data, "updated_at"); err != nil {
+		return model.Order{}, fmt.Errorf("rest: %w", err)
+	}
+
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+
+	if order.UpdatedAt.IsZero() {
+		order.UpdatedAt = order.CreatedAt
+	}
+
+	return order, nil
+}
+
+func (r *REST) Order(pair string, id int64) (model.Order, error) {
+	params := r.params(pair)
+	params.ID = id
+	data, err := r.request(r.ctx, "order", r.config.Order, params)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return r.newOrder(r.config.Order, data, params)
+}
+
+// OpenOrders returns the open orders of the given pair
+func (r *REST) OpenOrders(pair string) ([]model.Order, error) {
+	params := r.params(pair)
+	data, err := r.request(r.ctx, "open orders", r.config.OpenOrders, params)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := data.([]interface{})
+	if !ok && data != nil {
+		return nil, fmt.Errorf("rest: open orders: expected a list, got %T", data)
+	}
+
+	orders := make([]model.Order, 0, len(items))
+	for _, item := range items {
+		order, err := r.newOrder(r.config.OpenOrders, item, params)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func (r *REST) createOrder(side model.SideType, orderType model.OrderType, pair string,
+	quantity, price, stop float64, timeInForce model.TimeInForce) (model.Order, error) {
+
+	info := r.AssetsInfo(pair)
+	if quantity <= 0 || quantity < info.MinQuantity || quantity > info.MaxQuantity {
+		return model.Order{}, &OrderError{
+			Err:      ErrInvalidQuantity,
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	quantity = RoundQuantity(info, quantity)
+	params := r.params(pair)
+	params.Side = side
+	params.Type = orderType
+	params.TimeInForce = timeInForce
+	params.Quantity = strconv.FormatFloat(quantity, 'f', -1, 64)
+	if price > 0 {
+		price = RoundPrice(info, price)
+		params.Price = strconv.FormatFloat(price, 'f', -1, 64)
+	}
+	if stop > 0 {
+		stop = RoundPrice(info, stop)
+		params.Stop = strconv.FormatFloat(stop, 'f', -1, 64)
+	}
+
+	data, err := r.request(r.ctx, "create order", r.config.CreateOrder, params)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := r.newOrder(r.config.CreateOrder, data, params)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if order.Quantity == 0 {
+		order.Quantity = quantity
+	}
+
+	if order.Price == 0 {
+		order.Price = price
+	}
+
+	if stop > 0 {
+		order.Stop = &stop
+	}
+
+	return order, nil
+}
+
+func (r *REST) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, errors.New("rest: OCO orders are not supported")
+}
+
+func (r *REST) CreateOrderLimit(side model.SideType, pair string, size float64, limit float64) (model.Order, error) {
+	return r.createOrder(side, model.OrderTypeLimit, pair, size, limit, 0, model.TimeInForceGTC)
+}
+
+func (r *REST) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	return r.createOrder(side, model.OrderTypeLimit, pair, size, limit, 0, timeInForce)
+}
+
+func (r *REST) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	return r.createOrder(side, model.OrderTypeMarket, pair, size, 0, 0, "")
+}
+
+func (r *REST) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	price, err := r.LastQuote(r.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if price <= 0 {
+		return model.Order{}, fmt.Errorf("rest: invalid price for %s: %w", pair, ErrInvalidAsset)
+	}
+
+	return r.CreateOrderMarket(side, pair, quote/price)
+}
+
+func (r *REST) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return r.createOrder(model.SideTypeSell, model.OrderTypeStopLoss, pair, quantity, limit, limit, model.TimeInForceGTC)
+}
+
+func (r *REST) Cancel(order model.Order) error {
+	params := r.params(order.Pair)
+	params.ID = order.ExchangeID
+	params.Side = order.Side
+	params.Type = order.Type
+	_, err := r.request(r.ctx, "cancel", r.config.Cancel, params)
+	return err
+}
+
+// CancelAll cancels the open orders of the given pair one by one and returns the canceled orders
+func (r *REST) CancelAll(pair string) ([]model.Order, error) {
+	orders, err := r.OpenOrders(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	canceled := make([]model.Order, 0, len(orders))
+	for _, order := range orders {
+		if err := r.Cancel(order); err != nil {
+			return canceled, err
+		}
+		order.Status = model.OrderStatusTypeCanceled
+		canceled = append(canceled, order)
+	}
+	return canceled, nil
+}
@@ -0,0 +1,211 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestREST(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Hour)
+	closedTime := now.Add(-2 * time.Hour).UnixMilli()
+	lastTime := now.Add(-time.Hour).UnixMilli()
+	openTime := now.UnixMilli()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/klines":
+			if r.URL.Query().Get("symbol") != "BTCUSDT" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `[[%d,"1","4","0.5","2","10"],[%d,"2","5","1","3","20"],[%d,"3","6","2","4","30"]]`,
+				closedTime, lastTime, openTime)
+		case "/balances":
+			require.Equal(t, "key", r.Header.Get("X-API-KEY"))
+			fmt.Fprint(w, `{"data":[{"currency":"BTC","available":1.5,"hold":"0.5"},{"currency":"USDT","available":100}]}`)
+		case "/orders":
+			require.Equal(t, "key", r.Header.Get("X-API-KEY"))
+			signature := r.URL.Query().Get("signature")
+			require.NotEmpty(t, r.URL.Query().Get("timestamp"))
+
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			query := strings.TrimSuffix(r.URL.RawQuery, "&signature="+signature)
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(query + string(body)))
+			require.Equal(t, hex.EncodeToString(mac.Sum(nil)), signature)
+
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			require.Equal(t, http.MethodPost, r.Method)
+			require.JSONEq(t, `{"symbol":"BTCUSDT","side":"BUY","type":"LIMIT","qty":"0.123","price":"100.5"}`,
+				string(body))
+			fmt.Fprint(w, `{"order":{"id":"42","state":"open","created":"2022-01-01T00:00:00Z"}}`)
+		case "/orders/42":
+			fmt.Fprint(w, `{"order":{"id":42,"state":"done","avg_price":"100.5","filled":"0.123"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not found"}`)
+		}
+	}))
+	defer server.Close()
+
+	orderEndpoint := RESTEndpoint{
+		Root: "order",
+		Fields: map[string]string{
+			"status":     "state",
+			"price":      "avg_price",
+			"quantity":   "filled",
+			"created_at": "created",
+		},
+	}
+	createOrder := orderEndpoint
+	createOrder.Method = http.MethodPost
+	createOrder.Path = "/orders"
+	createOrder.Signed = true
+	createOrder.Body = `{"symbol":"{{.Pair}}","side":"{{.Side}}","type":"{{.Type}}","qty":"{{.Quantity}}",` +
+		`"price":"{{.Price}}"}`
+	getOrder := orderEndpoint
+	getOrder.Path = "/orders/{{.ID}}"
+
+	rest, err := NewREST(ctx, RESTConfig{
+		BaseURL: server.URL,
+		Auth: RESTAuth{
+			Type:   RESTAuthHMAC,
+			Key:    "key",
+			Secret: "secret",
+		},
+		Assets: map[string]model.AssetInfo{
+			"BTCUSDT": {
+				BaseAsset:          "BTC",
+				QuoteAsset:         "USDT",
+				MaxQuantity:        100,
+				StepSize:           0.001,
+				TickSize:           0.5,
+				BaseAssetPrecision: 3,
+				QuotePrecision:     1,
+			},
+		},
+		StatusMap: map[string]model.OrderStatusType{
+			"open": model.OrderStatusTypeNew,
+			"done": model.OrderStatusTypeFilled,
+		},
+		Candles: RESTEndpoint{
+			Path: "/klines?symbol={{.Pair}}&interval={{.Timeframe}}&limit={{.Limit}}",
+			Fields: map[string]string{
+				"time":   "0",
+				"open":   "1",
+				"high":   "2",
+				"low":    "3",
+				"close":  "4",
+				"volume": "5",
+			},
+		},
+		Account: RESTEndpoint{
+			Path: "/balances",
+			Root: "data",
+			Fields: map[string]string{
+				"asset":  "currency",
+				"free":   "available",
+				"locked": "hold",
+			},
+		},
+		Order:       getOrder,
+		CreateOrder: createOrder,
+		Cancel:      RESTEndpoint{Method: http.MethodDelete, Path: "/orders?id={{.ID}}", Signed: true},
+	})
+	require.NoError(t, err)
+
+	t.Run("candles", func(t *testing.T) {
+		candles, err := rest.CandlesByLimit(ctx, "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, closedTime, candles[0].Time.UnixMilli())
+		require.Equal(t, 1.0, candles[0].Open)
+		require.Equal(t, 4.0, candles[0].High)
+		require.Equal(t, 0.5, candles[0].Low)
+		require.Equal(t, 2.0, candles[0].Close)
+		require.Equal(t, 10.0, candles[0].Volume)
+		require.True(t, candles[1].Complete)
+
+		candles, err = rest.CandlesByPeriod(ctx, "BTCUSDT", "1h", time.Unix(0, 0), now)
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+		require.False(t, candles[2].Complete)
+	})
+
+	t.Run("last quote from candles", func(t *testing.T) {
+		price, err := rest.LastQuote(ctx, "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 4.0, price)
+
+		_, err = rest.LastQuote(ctx, "ETHUSDT")
+		require.Error(t, err)
+	})
+
+	t.Run("last price", func(t *testing.T) {
+		price, err := rest.LastPrice("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 4.0, price)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		asset, quote, err := rest.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 2.0, asset)
+		require.Equal(t, 100.0, quote)
+	})
+
+	t.Run("create order", func(t *testing.T) {
+		order, err := rest.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.1234, 100.6)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), order.ExchangeID)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+		require.Equal(t, 0.123, order.Quantity)
+		require.Equal(t, 100.5, order.Price)
+		require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), order.CreatedAt.UTC())
+
+		order, err = rest.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 100.5, order.Price)
+		require.Equal(t, 0.123, order.Quantity)
+
+		require.NoError(t, rest.Cancel(order))
+	})
+
+	t.Run("invalid quantity", func(t *testing.T) {
+		_, err := rest.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1000)
+		var orderErr *OrderError
+		require.ErrorAs(t, err, &orderErr)
+		require.Equal(t, ErrInvalidQuantity, orderErr.Err)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		_, err := rest.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 1, 1, 1)
+		require.Error(t, err)
+
+		rest.config.Candles.Path = ""
+		_, err = rest.CandlesByLimit(ctx, "BTCUSDT", "1h", 1)
+		require.True(t, errors.Is(err, ErrEndpointNotConfigured))
+	})
+}
@@ -0,0 +1,154 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// RoundMode defines the direction used to align a value to an exchange filter
+type RoundMode int
+
+const (
+	RoundDown RoundMode = iota
+	RoundUp
+	RoundNearest
+)
+
+// roundEpsilon absorbs float errors in value/step (e.g. 0.3/0.1 = 2.9999999999999996)
+const roundEpsilon = 1e-9
+
+// Round aligns value to a multiple of step using the given mode and truncates the result to precision
+// decimal places. A zero step only applies the precision.
+func Round(value, step float64, precision int, mode RoundMode) float64 {
+	if step > 0 {
+		units := value / step
+		switch mode {
+		case RoundUp:
+			units = math.Ceil(units - roundEpsilon)
+		case RoundNearest:
+			units = math.Round(units)
+		default:
+			units = math.Floor(units + roundEpsilon)
+		}
+		value = units * step
+	}
+
+	if precision < 0 {
+		return value
+	}
+
+	pow := math.Pow10(precision)
+	return math.Round(value*pow) / pow
+}
+
+// formatDecimal aligns a value down to a multiple of step, truncated to precision decimal places, and formats it
+// in plain decimal notation for the exchange requests: the decimals of the step, without exponent and trailing
+// zeros. The float errors of tiny steps are absorbed, e.g. 0.00000029 with a 0.00000001 tick is kept as
+// 0.00000029 instead of 0.00000028. A negative precision without step keeps the value
+func formatDecimal(value, step float64, precision int) string {
+	if precision >= 0 {
+		if minStep := math.Pow10(-precision); step < minStep {
+			step = minStep
+		}
+	}
+
+	if step <= 0 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	value = Round(value, step, -1, RoundDown)
+	result := strconv.FormatFloat(value, 'f', int(model.NumDecPlaces(step)), 64)
+	if strings.Contains(result, ".") {
+		result = strings.TrimRight(strings.TrimRight(result, "0"), ".")
+	}
+	return result
+}
+
+// RoundPrice aligns a price to the pair tick size, rounding to the nearest valid price
+func RoundPrice(info model.AssetInfo, price float64) float64 {
+	return Round(price, info.TickSize, info.QuotePrecision, RoundNearest)
+}
+
+// RoundQuantity aligns a quantity to the pair step size, rounding down to avoid exceeding the available balance
+func RoundQuantity(info model.AssetInfo, quantity float64) float64 {
+	return Round(quantity, info.StepSize, info.BaseAssetPrecision, RoundDown)
+}
+
+// PriceReference is the price used as base to place a limit order
+type PriceReference string
+
+const (
+	PriceReferenceClose PriceReference = "close"
+	PriceReferenceBid   PriceReference = "bid"
+	PriceReferenceAsk   PriceReference = "ask"
+	PriceReferenceMid   PriceReference = "mid"
+)
+
+// ReferencePrice returns the reference price from the order book. Without an order book or with an empty side,
+// the close price of the last candle is used for every reference
+func ReferencePrice(df *model.Dataframe, depth *model.Depth, reference PriceReference) (float64, error) {
+	switch reference {
+	case PriceReferenceClose, PriceReferenceBid, PriceReferenceAsk, PriceReferenceMid:
+	default:
+		return 0, fmt.Errorf("invalid price reference: %s", reference)
+	}
+
+	if depth != nil {
+		var bid, ask float64
+		if len(depth.Bids) > 0 {
+			bid = depth.Bids[0].Price
+		}
+		if len(depth.Asks) > 0 {
+			ask = depth.Asks[0].Price
+		}
+
+		switch {
+		case reference == PriceReferenceBid && bid > 0:
+			return bid, nil
+		case reference == PriceReferenceAsk && ask > 0:
+			return ask, nil
+		case reference == PriceReferenceMid && bid > 0 && ask > 0:
+			return (bid + ask) / 2, nil
+		}
+	}
+
+	if df == nil || len(df.Close) == 0 {
+		return 0, fmt.Errorf("no price available for reference: %s", reference)
+	}
+	return df.Close.Last(0), nil
+}
+
+// OffsetPrice moves a price by the given number of ticks and aligns it to the pair tick size.
+// Positive ticks improve the price towards the other side of the book (higher for buys, lower for sells),
+// zero joins the reference and negative ticks place the order behind it. Buy prices are rounded down and
+// sell prices up, so the rounding never makes the order more aggressive, and the result is limited to the
+// pair price filter. Without tick size, the quote precision defines the tick
+func OffsetPrice(info model.AssetInfo, side model.SideType, price float64, ticks int) float64 {
+	tick := info.TickSize
+	if tick <= 0 && info.QuotePrecision > 0 {
+		tick = math.Pow10(-info.QuotePrecision)
+	}
+
+	precision := info.QuotePrecision
+	if precision <= 0 {
+		precision = -1
+	}
+
+	if side == model.SideTypeSell {
+		price = Round(price-float64(ticks)*tick, tick, precision, RoundUp)
+	} else {
+		price = Round(price+float64(ticks)*tick, tick, precision, RoundDown)
+	}
+
+	if info.MinPrice > 0 && price < info.MinPrice {
+		price = info.MinPrice
+	}
+	if info.MaxPrice > 0 && price > info.MaxPrice {
+		price = info.MaxPrice
+	}
+	return price
+}
@@ -0,0 +1,120 @@
+package exchange
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestRound(t *testing.T) {
+	tt := []struct {
+		value     float64
+		step      float64
+		precision int
+		mode      RoundMode
+		expected  float64
+	}{
+		{1.23456, 0.01, 2, RoundDown, 1.23},
+		{1.23456, 0.01, 2, RoundUp, 1.24},
+		{1.23456, 0.01, 2, RoundNearest, 1.23},
+		{1.235, 0.01, 2, RoundNearest, 1.24},
+		{0.3, 0.1, 1, RoundDown, 0.3},
+		{0.3, 0.1, 1, RoundUp, 0.3},
+		{105, 10, 0, RoundDown, 100},
+		{105, 10, 0, RoundUp, 110},
+		{1.23456, 0, 3, RoundDown, 1.235},
+		{1.23456, 0.5, -1, RoundNearest, 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprintf("given %f step %f mode %d", tc.value, tc.step, tc.mode), func(t *testing.T) {
+			require.Equal(t, tc.expected, Round(tc.value, tc.step, tc.precision, tc.mode))
+		})
+	}
+}
+
+func TestRoundPriceQuantity(t *testing.T) {
+	info := model.AssetInfo{
+		StepSize:           0.001,
+		TickSize:           0.05,
+		BaseAssetPrecision: 3,
+		QuotePrecision:     2,
+	}
+
+	require.Equal(t, 100.05, RoundPrice(info, 100.04))
+	require.Equal(t, 100.0, RoundPrice(info, 100.02))
+	require.Equal(t, 1.999, RoundQuantity(info, 1.9999))
+	require.Equal(t, 0.0, RoundQuantity(info, 0.0009))
+}
+
+func TestReferencePrice(t *testing.T) {
+	df := &model.Dataframe{Pair: "BTCUSDT", Close: model.Series[float64]{99, 100}}
+	depth := &model.Depth{
+		Bids: []model.PriceLevel{{Price: 100.1, Quantity: 1}, {Price: 100, Quantity: 2}},
+		Asks: []model.PriceLevel{{Price: 100.3, Quantity: 1}},
+	}
+
+	tt := []struct {
+		reference PriceReference
+		depth     *model.Depth
+		expected  float64
+	}{
+		{PriceReferenceClose, depth, 100},
+		{PriceReferenceBid, depth, 100.1},
+		{PriceReferenceAsk, depth, 100.3},
+		{PriceReferenceMid, depth, 100.2},
+		{PriceReferenceBid, nil, 100},
+		{PriceReferenceMid, &model.Depth{Bids: depth.Bids}, 100},
+	}
+
+	for _, tc := range tt {
+		t.Run(string(tc.reference), func(t *testing.T) {
+			price, err := ReferencePrice(df, tc.depth, tc.reference)
+			require.NoError(t, err)
+			require.InDelta(t, tc.expected, price, 1e-9)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ReferencePrice(df, depth, "last")
+		require.Error(t, err)
+
+		_, err = ReferencePrice(&model.Dataframe{}, nil, PriceReferenceBid)
+		require.Error(t, err)
+	})
+}
+
+func TestOffsetPrice(t *testing.T) {
+	info := model.AssetInfo{TickSize: 0.05, QuotePrecision: 2, MinPrice: 0.05, MaxPrice: 1000}
+
+	tt := []struct {
+		name     string
+		side     model.SideType
+		price    float64
+		ticks    int
+		expected float64
+	}{
+		{"buy join", model.SideTypeBuy, 100.1, 0, 100.1},
+		{"buy improve", model.SideTypeBuy, 100.1, 2, 100.2},
+		{"buy behind", model.SideTypeBuy, 100.1, -1, 100.05},
+		{"buy mid rounds down", model.SideTypeBuy, 100.12, 0, 100.1},
+		{"sell join", model.SideTypeSell, 100.3, 0, 100.3},
+		{"sell improve", model.SideTypeSell, 100.3, 1, 100.25},
+		{"sell mid rounds up", model.SideTypeSell, 100.12, 0, 100.15},
+		{"min price", model.SideTypeSell, 0.05, 3, 0.05},
+		{"max price", model.SideTypeBuy, 1000, 1, 1000},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, OffsetPrice(info, tc.side, tc.price, tc.ticks))
+		})
+	}
+
+	t.Run("quote precision as tick", func(t *testing.T) {
+		require.Equal(t, 1.24, OffsetPrice(model.AssetInfo{QuotePrecision: 2}, model.SideTypeBuy, 1.23, 1))
+	})
+}
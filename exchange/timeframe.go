@@ -0,0 +1,88 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+var ErrInvalidTimeframe = errors.New("invalid timeframe")
+
+var (
+	// BinanceTimeframes are the candle intervals supported by Binance spot and futures
+	BinanceTimeframes = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "3d",
+		"1w", "1M"}
+	// BybitTimeframes are the kline intervals supported by Bybit
+	BybitTimeframes = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "12h", "1d", "1w", "1M"}
+	// KucoinTimeframes are the kline types supported by KuCoin
+	KucoinTimeframes = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "1w",
+		"1M"}
+	// ResampleTimeframes are the target timeframes supported by the CSV feed resampler
+	ResampleTimeframes = []string{"1m", "5m", "10m", "15m", "30m", "1h", "2h", "4h", "6h", "8h", "12h", "1d", "3d",
+		"1w", "1M"}
+)
+
+// TimeframeSupporter is implemented by feeders that support a fixed set of timeframes
+type TimeframeSupporter interface {
+	Timeframes() []string
+}
+
+// Resampler is implemented by feeders that create the candles of additional timeframes from the loaded candles,
+// e.g. the CSV feed of backtests with multi timeframe strategies
+type Resampler interface {
+	Resample(timeframes ...string) error
+}
+
+// CandleTimeModeSetter is implemented by feeders that deliver the candles with the timestamp convention of
+// the bot, the open time of the interval by default, see model.CandleTimeMode
+type CandleTimeModeSetter interface {
+	SetCandleTimeMode(mode model.CandleTimeMode) error
+}
+
+// candleTimestamp converts the open time of a candle to the timestamp of the mode. The update time is not
+// changed, and timeframes without a fixed duration (e.g. 1M) keep the open time
+func candleTimestamp(mode model.CandleTimeMode, timeframe string, candle model.Candle) model.Candle {
+	if mode != model.CandleTimeClose {
+		return candle
+	}
+
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return candle
+	}
+
+	candle.Time = mode.Timestamp(candle.Time, interval)
+	return candle
+}
+
+// candleTimestamps converts the open time of the candles to the timestamp of the mode, in place
+func candleTimestamps(mode model.CandleTimeMode, timeframe string, candles []model.Candle) []model.Candle {
+	for i := range candles {
+		candles[i] = candleTimestamp(mode, timeframe, candles[i])
+	}
+	return candles
+}
+
+// candleOpenTime converts a timestamp of the mode to the open time of the candle, e.g. the period of a request
+func candleOpenTime(mode model.CandleTimeMode, timeframe string, t time.Time) time.Time {
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return t
+	}
+	return mode.OpenTime(t, interval)
+}
+
+// ValidateTimeframe returns an error listing the valid values if the timeframe is not supported
+func ValidateTimeframe(timeframe string, supported []string) error {
+	for _, value := range supported {
+		if value == timeframe {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q, valid values: %s", ErrInvalidTimeframe, timeframe, strings.Join(supported, ", "))
+}
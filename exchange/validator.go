@@ -0,0 +1,138 @@
+package exchange
+
+import (
+	"math"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+type CandleRule string
+
+const (
+	// CandleRuleMonotonicTime rejects candles older than the last one and duplicated closed candles
+	CandleRuleMonotonicTime CandleRule = "monotonic_time"
+	// CandleRuleHighLow rejects candles with high below low, or open/close outside the high-low range
+	CandleRuleHighLow CandleRule = "high_low"
+	// CandleRuleVolume rejects candles with negative volume
+	CandleRuleVolume CandleRule = "volume"
+)
+
+// CandleValidator detects anomalous candles of a single feed (pair and timeframe)
+// and drops or repairs them before they reach the strategy
+type CandleValidator struct {
+	rules        map[CandleRule]bool
+	maxDeviation float64
+	repair       bool
+	last         *model.Candle
+}
+
+type CandleValidatorOption func(*CandleValidator)
+
+// WithCandleRules sets the enabled validation rules, by default all rules are enabled
+func WithCandleRules(rules ...CandleRule) CandleValidatorOption {
+	return func(v *CandleValidator) {
+		v.rules = make(map[CandleRule]bool)
+		for _, rule := range rules {
+			v.rules[rule] = true
+		}
+	}
+}
+
+// WithMaxPriceDeviation rejects candles with prices greater than N times, or lower than 1/N
+// of the previous close. e.g. 2 accepts prices between 50% and 200% of the last close
+func WithMaxPriceDeviation(n float64) CandleValidatorOption {
+	return func(v *CandleValidator) {
+		v.maxDeviation = n
+	}
+}
+
+// WithCandleRepair repairs candles with invalid high/low, negative volume or outlier wicks
+// instead of dropping them. Candles with invalid time or outlier open/close are always dropped
+func WithCandleRepair() CandleValidatorOption {
+	return func(v *CandleValidator) {
+		v.repair = true
+	}
+}
+
+func NewCandleValidator(options ...CandleValidatorOption) *CandleValidator {
+	validator := &CandleValidator{
+		rules: map[CandleRule]bool{
+			CandleRuleMonotonicTime: true,
+			CandleRuleHighLow:       true,
+			CandleRuleVolume:        true,
+		},
+	}
+
+	for _, option := range options {
+		option(validator)
+	}
+
+	return validator
+}
+
+func (v *CandleValidator) reject(candle model.Candle, reason string) (model.Candle, bool) {
+	log.Warnf("[VALIDATION] %s %s: %s, candle dropped", candle.Pair, candle.Time, reason)
+	return candle, false
+}
+
+func (v *CandleValidator) fix(candle model.Candle, reason string) (model.Candle, bool) {
+	if !v.repair {
+		return v.reject(candle, reason)
+	}
+	log.Warnf("[VALIDATION] %s %s: %s, candle repaired", candle.Pair, candle.Time, reason)
+	return candle, true
+}
+
+// Validate checks the candle against the enabled rules. It returns the candle, repaired if needed,
+// and false when the candle must be dropped
+func (v *CandleValidator) Validate(candle model.Candle) (model.Candle, bool) {
+	if v.rules[CandleRuleMonotonicTime] && v.last != nil {
+		if candle.Time.Before(v.last.Time) {
+			return v.reject(candle, "out of order timestamp")
+		}
+
+		if candle.Time.Equal(v.last.Time) && v.last.Complete {
+			return v.reject(candle, "duplicated timestamp")
+		}
+	}
+
+	var ok bool
+	if v.rules[CandleRuleHighLow] {
+		bodyHigh := math.Max(candle.Open, candle.Close)
+		bodyLow := math.Min(candle.Open, candle.Close)
+		if candle.High < candle.Low || candle.High < bodyHigh || candle.Low > bodyLow {
+			candle.High = math.Max(candle.High, math.Max(candle.Low, bodyHigh))
+			candle.Low = math.Min(candle.Low, bodyLow)
+			if candle, ok = v.fix(candle, "invalid high/low range"); !ok {
+				return candle, false
+			}
+		}
+	}
+
+	if v.rules[CandleRuleVolume] && candle.Volume < 0 {
+		candle.Volume = 0
+		if candle, ok = v.fix(candle, "negative volume"); !ok {
+			return candle, false
+		}
+	}
+
+	if v.maxDeviation > 0 && v.last != nil && v.last.Close > 0 {
+		upper := v.last.Close * v.maxDeviation
+		lower := v.last.Close / v.maxDeviation
+		if candle.Open > upper || candle.Open < lower || candle.Close > upper || candle.Close < lower {
+			return v.reject(candle, "price out of allowed deviation")
+		}
+
+		if candle.High > upper || candle.Low < lower {
+			candle.High = math.Min(candle.High, upper)
+			candle.Low = math.Max(candle.Low, lower)
+			if candle, ok = v.fix(candle, "wick out of allowed deviation"); !ok {
+				return candle, false
+			}
+		}
+	}
+
+	v.last = &candle
+	return candle, true
+}
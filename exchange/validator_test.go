@@ -0,0 +1,99 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestCandleValidator(t *testing.T) {
+	newCandle := func(minute int, open, close, low, high, volume float64) model.Candle {
+		return model.Candle{
+			Pair:     "BTCUSDT",
+			Time:     time.Date(2022, 1, 1, 0, minute, 0, 0, time.UTC),
+			Open:     open,
+			Close:    close,
+			Low:      low,
+			High:     high,
+			Volume:   volume,
+			Complete: true,
+		}
+	}
+
+	t.Run("monotonic time", func(t *testing.T) {
+		validator := NewCandleValidator()
+		_, ok := validator.Validate(newCandle(1, 10, 11, 9, 12, 1))
+		require.True(t, ok)
+
+		_, ok = validator.Validate(newCandle(0, 10, 11, 9, 12, 1))
+		require.False(t, ok)
+
+		_, ok = validator.Validate(newCandle(1, 10, 11, 9, 12, 1))
+		require.False(t, ok)
+
+		_, ok = validator.Validate(newCandle(2, 10, 11, 9, 12, 1))
+		require.True(t, ok)
+	})
+
+	t.Run("partial candles with same time", func(t *testing.T) {
+		validator := NewCandleValidator()
+		partial := newCandle(1, 10, 11, 9, 12, 1)
+		partial.Complete = false
+		_, ok := validator.Validate(partial)
+		require.True(t, ok)
+
+		_, ok = validator.Validate(newCandle(1, 10, 11, 9, 12, 1))
+		require.True(t, ok)
+	})
+
+	t.Run("drop invalid range and volume", func(t *testing.T) {
+		validator := NewCandleValidator()
+		_, ok := validator.Validate(newCandle(1, 10, 11, 12, 9, 1))
+		require.False(t, ok)
+
+		_, ok = validator.Validate(newCandle(2, 10, 11, 9, 12, -1))
+		require.False(t, ok)
+	})
+
+	t.Run("repair invalid range and volume", func(t *testing.T) {
+		validator := NewCandleValidator(WithCandleRepair())
+		candle, ok := validator.Validate(newCandle(1, 10, 11, 10.5, 10.8, -1))
+		require.True(t, ok)
+		require.Equal(t, 11.0, candle.High)
+		require.Equal(t, 10.0, candle.Low)
+		require.Equal(t, 0.0, candle.Volume)
+	})
+
+	t.Run("price deviation", func(t *testing.T) {
+		validator := NewCandleValidator(WithMaxPriceDeviation(2))
+		_, ok := validator.Validate(newCandle(1, 10, 10, 9, 11, 1))
+		require.True(t, ok)
+
+		_, ok = validator.Validate(newCandle(2, 10, 30, 9, 31, 1))
+		require.False(t, ok)
+
+		_, ok = validator.Validate(newCandle(3, 10, 11, 1, 100, 0))
+		require.False(t, ok)
+
+		validator = NewCandleValidator(WithMaxPriceDeviation(2), WithCandleRepair())
+		_, ok = validator.Validate(newCandle(1, 10, 10, 9, 11, 1))
+		require.True(t, ok)
+
+		candle, ok := validator.Validate(newCandle(2, 10, 11, 1, 100, 0))
+		require.True(t, ok)
+		require.Equal(t, 20.0, candle.High)
+		require.Equal(t, 5.0, candle.Low)
+	})
+
+	t.Run("custom rules", func(t *testing.T) {
+		validator := NewCandleValidator(WithCandleRules(CandleRuleVolume))
+		_, ok := validator.Validate(newCandle(1, 10, 11, 12, 9, 1))
+		require.True(t, ok)
+
+		_, ok = validator.Validate(newCandle(0, 10, 11, 9, 12, -1))
+		require.False(t, ok)
+	})
+}
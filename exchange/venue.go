@@ -0,0 +1,414 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+// venueSeparator separates the pair and the venue of a qualified pair, see VenuePair
+const venueSeparator = "@"
+
+// ErrUnknownVenue is returned for the pairs qualified with a venue that is not part of the MultiVenue
+var ErrUnknownVenue = errors.New("unknown venue")
+
+// VenuePair returns the pair qualified with a venue of a MultiVenue, e.g. "BTCUSDT@futures". The orders and the
+// market data of a qualified pair are routed to its venue, so the same pair can be traded in multiple venues by
+// a single strategy, e.g. BTCUSDT in spot and futures for basis strategies
+func VenuePair(pair, venue string) string {
+	return pair + venueSeparator + venue
+}
+
+// SplitVenuePair returns the pair and the venue of a qualified pair, or the pair and an empty venue
+func SplitVenuePair(pair string) (symbol, venue string) {
+	if i := strings.LastIndex(pair, venueSeparator); i >= 0 {
+		return pair[:i], pair[i+1:]
+	}
+	return pair, ""
+}
+
+// Venue is an exchange account of a MultiVenue, e.g. Binance spot or Binance futures
+type Venue struct {
+	// Name identifies the venue in the account breakdown and in the qualified pairs, e.g. "spot"
+	Name     string
+	Exchange service.Exchange
+	// Pairs are the pairs routed to the venue without qualification, the pairs of no venue are traded in the
+	// first one. A pair of multiple venues is routed to the first of them, see VenuePair for the others
+	Pairs []string
+}
+
+// VenueAccount is the account of a venue, see MultiVenue.VenueAccounts
+type VenueAccount struct {
+	Name    string
+	Account model.Account
+}
+
+// MultiVenue is an exchange that combines multiple exchange accounts, e.g. spot and futures for basis
+// strategies. The orders and the market data of a pair are routed by venue: the pairs qualified with a venue
+// (e.g. "BTCUSDT@futures", see VenuePair) go to that venue, and the results keep the qualified pair, so the same
+// pair can be traded in multiple venues. The other pairs are routed with Venue.Pairs. The account is the sum of
+// the balances of all venues, with the breakdown by venue in VenueAccounts. Only the methods of service.Exchange
+// are routed, the optional features of the exchanges (e.g. trailing stops) are available in the exchange of each
+// venue
+type MultiVenue struct {
+	venues []Venue
+	names  map[string]int
+	routes map[string]int
+}
+
+// NewMultiVenue creates an exchange with the venues, the first one is the default venue of the pairs
+func NewMultiVenue(venues ...Venue) (*MultiVenue, error) {
+	if len(venues) == 0 {
+		return nil, errors.New("multi venue: no venues")
+	}
+
+	names := make(map[string]int)
+	routes := make(map[string]int)
+	for i, venue := range venues {
+		if venue.Name == "" || venue.Exchange == nil {
+			return nil, fmt.Errorf("multi venue: venue %d without name or exchange", i)
+		}
+		if strings.Contains(venue.Name, venueSeparator) {
+			return nil, fmt.Errorf("multi venue: invalid venue name %s", venue.Name)
+		}
+
+		if _, ok := names[venue.Name]; ok {
+			return nil, fmt.Errorf("multi venue: duplicated venue %s", venue.Name)
+		}
+		names[venue.Name] = i
+
+		for _, pair := range venue.Pairs {
+			if _, ok := routes[pair]; !ok {
+				routes[pair] = i
+			}
+		}
+	}
+
+	return &MultiVenue{
+		venues: venues,
+		names:  names,
+		routes: routes,
+	}, nil
+}
+
+// Venue returns the exchange of a venue by name, e.g. to use the optional features of the exchange
+func (m *MultiVenue) Venue(name string) (service.Exchange, bool) {
+	i, ok := m.names[name]
+	if !ok {
+		return nil, false
+	}
+	return m.venues[i].Exchange, true
+}
+
+// VenueOf returns the name of the venue of a pair, or an empty name for an unknown venue
+func (m *MultiVenue) VenueOf(pair string) string {
+	route, err := m.route(pair)
+	if err != nil {
+		return ""
+	}
+	return m.venues[route.index].Name
+}
+
+// venueRoute is the venue of a pair, see MultiVenue.route
+type venueRoute struct {
+	index    int
+	exchange service.Exchange
+	// pair is the pair in the exchange of the venue, without the venue
+	pair string
+	// venue is the venue of a qualified pair, set in the pairs of the results
+	venue string
+}
+
+// route returns the venue of a pair, by the venue of a qualified pair or by Venue.Pairs
+func (m *MultiVenue) route(pair string) (venueRoute, error) {
+	symbol, venue := SplitVenuePair(pair)
+	if venue == "" {
+		i := m.routes[pair]
+		return venueRoute{index: i, exchange: m.venues[i].Exchange, pair: pair}, nil
+	}
+
+	i, ok := m.names[venue]
+	if !ok {
+		return venueRoute{}, fmt.Errorf("multi venue: %w: %s", ErrUnknownVenue, pair)
+	}
+	return venueRoute{index: i, exchange: m.venues[i].Exchange, pair: symbol, venue: venue}, nil
+}
+
+// qualify returns the pair of a result, qualified with the venue of qualified pairs
+func (r venueRoute) qualify(pair string) string {
+	if r.venue == "" {
+		return pair
+	}
+	return VenuePair(pair, r.venue)
+}
+
+func (r venueRoute) order(order model.Order) model.Order {
+	order.Pair = r.qualify(order.Pair)
+	return order
+}
+
+func (r venueRoute) orders(orders []model.Order) []model.Order {
+	for i := range orders {
+		orders[i].Pair = r.qualify(orders[i].Pair)
+	}
+	return orders
+}
+
+func (r venueRoute) candles(candles []model.Candle) []model.Candle {
+	for i := range candles {
+		candles[i].Pair = r.qualify(candles[i].Pair)
+	}
+	return candles
+}
+
+// VenueAccounts returns the account of each venue, in the order of the venues
+func (m *MultiVenue) VenueAccounts() ([]VenueAccount, error) {
+	accounts := make([]VenueAccount, 0, len(m.venues))
+	for _, venue := range m.venues {
+		account, err := venue.Exchange.Account()
+		if err != nil {
+			return nil, fmt.Errorf("venue %s: %w", venue.Name, err)
+		}
+		accounts = append(accounts, VenueAccount{Name: venue.Name, Account: account})
+	}
+	return accounts, nil
+}
+
+// Account returns the combined account of all venues, with the balances of the same asset summed
+func (m *MultiVenue) Account() (model.Account, error) {
+	accounts, err := m.VenueAccounts()
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	var combined model.Account
+	index := make(map[string]int)
+	for _, account := range accounts {
+		for _, balance := range account.Account.Balances {
+			i, ok := index[balance.Asset]
+			if !ok {
+				index[balance.Asset] = len(combined.Balances)
+				combined.Balances = append(combined.Balances, balance)
+				continue
+			}
+
+			current := &combined.Balances[i]
+			current.Free += balance.Free
+			current.Lock += balance.Lock
+			current.Borrowed += balance.Borrowed
+			current.Interest += balance.Interest
+			if balance.Leverage > current.Leverage {
+				current.Leverage = balance.Leverage
+			}
+		}
+	}
+
+	return combined, nil
+}
+
+func (m *MultiVenue) AssetsInfo(pair string) model.AssetInfo {
+	route, err := m.route(pair)
+	if err != nil {
+		return model.AssetInfo{}
+	}
+	return route.exchange.AssetsInfo(route.pair)
+}
+
+func (m *MultiVenue) LastQuote(ctx context.Context, pair string) (float64, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return 0, err
+	}
+	return route.exchange.LastQuote(ctx, route.pair)
+}
+
+func (m *MultiVenue) LastPrice(pair string) (float64, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return 0, err
+	}
+	return route.exchange.LastPrice(route.pair)
+}
+
+func (m *MultiVenue) CandlesByPeriod(ctx context.Context, pair, period string, start,
+	end time.Time) ([]model.Candle, error) {
+
+	route, err := m.route(pair)
+	if err != nil {
+		return nil, err
+	}
+	candles, err := route.exchange.CandlesByPeriod(ctx, route.pair, period, start, end)
+	return route.candles(candles), err
+}
+
+func (m *MultiVenue) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return nil, err
+	}
+	candles, err := route.exchange.CandlesByLimit(ctx, route.pair, period, limit)
+	return route.candles(candles), err
+}
+
+func (m *MultiVenue) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle,
+	chan error) {
+
+	route, err := m.route(pair)
+	if err != nil {
+		ccandle, cerr := make(chan model.Candle), make(chan error, 1)
+		cerr <- err
+		close(ccandle)
+		close(cerr)
+		return ccandle, cerr
+	}
+
+	candles, errs := route.exchange.CandlesSubscription(ctx, route.pair, timeframe)
+	if route.venue == "" {
+		return candles, errs
+	}
+
+	ccandle := make(chan model.Candle)
+	go func() {
+		defer close(ccandle)
+		for candle := range candles {
+			candle.Pair = pair
+			ccandle <- candle
+		}
+	}()
+	return ccandle, errs
+}
+
+func (m *MultiVenue) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	route, err := m.route(pair)
+	if err != nil {
+		ctrade, cerr := make(chan model.Trade), make(chan error, 1)
+		cerr <- err
+		close(ctrade)
+		close(cerr)
+		return ctrade, cerr
+	}
+
+	trades, errs := route.exchange.TradesSubscription(ctx, route.pair)
+	if route.venue == "" {
+		return trades, errs
+	}
+
+	ctrade := make(chan model.Trade)
+	go func() {
+		defer close(ctrade)
+		for trade := range trades {
+			trade.Pair = pair
+			ctrade <- trade
+		}
+	}()
+	return ctrade, errs
+}
+
+func (m *MultiVenue) Position(pair string) (asset, quote float64, err error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return 0, 0, err
+	}
+	return route.exchange.Position(route.pair)
+}
+
+func (m *MultiVenue) Order(pair string, id int64) (model.Order, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order, err := route.exchange.Order(route.pair, id)
+	return route.order(order), err
+}
+
+func (m *MultiVenue) OpenOrders(pair string) ([]model.Order, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := route.exchange.OpenOrders(route.pair)
+	return route.orders(orders), err
+}
+
+func (m *MultiVenue) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	route, err := m.route(pair)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := route.exchange.CreateOrderOCO(side, route.pair, size, price, stop, stopLimit)
+	return route.orders(orders), err
+}
+
+func (m *MultiVenue) CreateOrderLimit(side model.SideType, pair string, size float64,
+	limit float64) (model.Order, error) {
+
+	route, err := m.route(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order, err := route.exchange.CreateOrderLimit(side, route.pair, size, limit)
+	return route.order(order), err
+}
+
+func (m *MultiVenue) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	route, err := m.route(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order, err := route.exchange.CreateOrderLimitTIF(side, route.pair, size, limit, timeInForce)
+	return route.order(order), err
+}
+
+func (m *MultiVenue) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order, err := route.exchange.CreateOrderMarket(side, route.pair, size)
+	return route.order(order), err
+}
+
+func (m *MultiVenue) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order, err := route.exchange.CreateOrderMarketQuote(side, route.pair, quote)
+	return route.order(order), err
+}
+
+func (m *MultiVenue) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order, err := route.exchange.CreateOrderStop(route.pair, quantity, limit)
+	return route.order(order), err
+}
+
+func (m *MultiVenue) Cancel(order model.Order) error {
+	route, err := m.route(order.Pair)
+	if err != nil {
+		return err
+	}
+	order.Pair = route.pair
+	return route.exchange.Cancel(order)
+}
+
+func (m *MultiVenue) CancelAll(pair string) ([]model.Order, error) {
+	route, err := m.route(pair)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := route.exchange.CancelAll(route.pair)
+	return route.orders(orders), err
+}
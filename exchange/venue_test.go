@@ -0,0 +1,134 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestMultiVenue(t *testing.T) {
+	ctx := context.Background()
+	spot := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000))
+	futures := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 500), WithPaperAsset("BNB", 1))
+	spot.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	futures.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 10})
+
+	venues, err := NewMultiVenue(
+		Venue{Name: "spot", Exchange: spot},
+		Venue{Name: "futures", Exchange: futures, Pairs: []string{"ETHUSDT"}},
+	)
+	require.NoError(t, err)
+
+	t.Run("routing", func(t *testing.T) {
+		require.Equal(t, "spot", venues.VenueOf("BTCUSDT"))
+		require.Equal(t, "futures", venues.VenueOf("ETHUSDT"))
+
+		_, err := venues.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		_, err = venues.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 10)
+		require.NoError(t, err)
+
+		asset, _, err := spot.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+
+		asset, _, err = futures.Position("ETHUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 10.0, asset)
+
+		exchange, ok := venues.Venue("futures")
+		require.True(t, ok)
+		require.Equal(t, futures, exchange)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		account, err := venues.Account()
+		require.NoError(t, err)
+
+		_, usdt := account.Balance("", "USDT")
+		require.Equal(t, 1300.0, usdt.Free+usdt.Lock)
+		btc, bnb := account.Balance("BTC", "BNB")
+		require.Equal(t, 1.0, btc.Free)
+		require.Equal(t, 1.0, bnb.Free)
+
+		accounts, err := venues.VenueAccounts()
+		require.NoError(t, err)
+		require.Len(t, accounts, 2)
+		require.Equal(t, "spot", accounts[0].Name)
+		_, usdt = accounts[1].Account.Balance("", "USDT")
+		require.Equal(t, 400.0, usdt.Free)
+	})
+
+	t.Run("invalid venues", func(t *testing.T) {
+		_, err := NewMultiVenue()
+		require.Error(t, err)
+
+		_, err = NewMultiVenue(Venue{Name: "spot", Exchange: spot}, Venue{Name: "spot", Exchange: futures})
+		require.Error(t, err)
+
+		_, err = NewMultiVenue(Venue{Name: "spot@binance", Exchange: spot})
+		require.Error(t, err)
+	})
+}
+
+func TestMultiVenue_VenuePair(t *testing.T) {
+	ctx := context.Background()
+	spot := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000))
+	futures := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000))
+	spot.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	futures.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 101})
+
+	// the same pair in both venues, the unqualified pair is routed to the first one
+	venues, err := NewMultiVenue(
+		Venue{Name: "spot", Exchange: spot, Pairs: []string{"BTCUSDT"}},
+		Venue{Name: "futures", Exchange: futures, Pairs: []string{"BTCUSDT"}},
+	)
+	require.NoError(t, err)
+
+	pair := VenuePair("BTCUSDT", "futures")
+	require.Equal(t, "BTCUSDT@futures", pair)
+	symbol, venue := SplitVenuePair(pair)
+	require.Equal(t, "BTCUSDT", symbol)
+	require.Equal(t, "futures", venue)
+	require.Equal(t, "futures", venues.VenueOf(pair))
+	require.Equal(t, "spot", venues.VenueOf("BTCUSDT"))
+
+	asset, quote := SplitAssetQuote(pair)
+	require.Equal(t, "BTC", asset)
+	require.Equal(t, "USDT", quote)
+
+	order, err := venues.CreateOrderMarket(model.SideTypeBuy, pair, 1)
+	require.NoError(t, err)
+	require.Equal(t, pair, order.Pair)
+	require.Equal(t, 101.0, order.Price)
+
+	order, err = venues.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", order.Pair)
+
+	futuresAsset, _, err := futures.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, futuresAsset)
+	spotOrders, err := spot.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, spotOrders, 1)
+
+	order, err = venues.CreateOrderLimit(model.SideTypeSell, pair, 1, 120)
+	require.NoError(t, err)
+	orders, err := venues.OpenOrders(pair)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, pair, orders[0].Pair)
+	require.NoError(t, venues.Cancel(order))
+
+	price, err := venues.LastPrice(pair)
+	require.NoError(t, err)
+	require.Equal(t, 101.0, price)
+
+	_, err = venues.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT@margin", 1)
+	require.ErrorIs(t, err, ErrUnknownVenue)
+	require.Empty(t, venues.VenueOf("BTCUSDT@margin"))
+}
@@ -0,0 +1,165 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultWebsocketPingInterval is the interval between the pings of the Binance websockets. The connection is
+// closed and reconnected when the pong of a ping is not received until the next ping
+const DefaultWebsocketPingInterval = 60 * time.Second
+
+// binanceDialer is the default dialer of the Binance websockets, with the settings of the Binance client library
+func binanceDialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+	}
+}
+
+// ErrStreamStalled is returned when a websocket receives no message during the read timeout
+var ErrStreamStalled = errors.New("websocket stalled")
+
+// watchStream waits until the websocket is done or the context is canceled, returning true on cancel. A message
+// received by the websocket is signaled in alive, and with a read timeout the websocket is stopped when no
+// message is received during the timeout, e.g. a connection that died silently. A zero timeout disables it
+func watchStream(ctx context.Context, done <-chan struct{}, stop chan<- struct{}, alive <-chan struct{},
+	timeout time.Duration) (bool, error) {
+
+	var expired <-chan time.Time
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// wait the websocket to stop before closing the channels
+			close(stop)
+			<-done
+			return true, nil
+		case <-done:
+			return false, nil
+		case <-alive:
+			if timer == nil {
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(timeout)
+		case <-expired:
+			close(stop)
+			<-done
+			return false, fmt.Errorf("%w: no message in %s", ErrStreamStalled, timeout)
+		}
+	}
+}
+
+// signalAlive signals a message received by a websocket without blocking
+func signalAlive(alive chan<- struct{}) {
+	select {
+	case alive <- struct{}{}:
+	default:
+	}
+}
+
+// serveStream connects to a websocket stream with the dialer and calls the handler with each message, in place of
+// the websockets of the Binance client library, which can't be dialed through a proxy. The connection is closed
+// when stop is closed or when the pong of a ping is not received until the next ping, and done is closed after
+// the last message. A zero ping interval disables the pings
+func serveStream(dialer *websocket.Dialer, endpoint string, pingInterval time.Duration, handler func(message []byte),
+	errHandler func(err error)) (done, stop chan struct{}, err error) {
+
+	conn, _, err := dialer.Dial(endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetReadLimit(655350)
+
+	done = make(chan struct{})
+	stop = make(chan struct{})
+	go func() {
+		defer close(done)
+
+		if pingInterval > 0 {
+			keepAlive(conn, pingInterval, done)
+		}
+
+		// the read is blocking, the connection is closed to stop it
+		silent := make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+				close(silent)
+			case <-done:
+			}
+			conn.Close()
+		}()
+
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				select {
+				case <-silent:
+				default:
+					errHandler(err)
+				}
+				return
+			}
+			handler(message)
+		}
+	}()
+	return done, stop, nil
+}
+
+// keepAlive pings the server each interval until done, closing the connection when the pong of the last ping
+// was not received
+func keepAlive(conn *websocket.Conn, interval time.Duration, done <-chan struct{}) {
+	pong := make(chan struct{}, 1)
+	conn.SetPongHandler(func(string) error {
+		signalAlive(pong)
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		received := true
+		for {
+			if !received {
+				conn.Close()
+				return
+			}
+
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			select {
+			case <-pong:
+				received = true
+			default:
+				received = false
+			}
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchStream(t *testing.T) {
+	// fakeStream closes done when stop is closed, as the websockets of the Binance client
+	fakeStream := func() (chan struct{}, chan struct{}) {
+		done, stop := make(chan struct{}), make(chan struct{})
+		go func() {
+			<-stop
+			close(done)
+		}()
+		return done, stop
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		done, stop := make(chan struct{}), make(chan struct{})
+		close(done)
+		canceled, err := watchStream(context.Background(), done, stop, make(chan struct{}), 0)
+		require.NoError(t, err)
+		require.False(t, canceled)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		done, stop := fakeStream()
+		canceled, err := watchStream(ctx, done, stop, make(chan struct{}), time.Minute)
+		require.NoError(t, err)
+		require.True(t, canceled)
+	})
+
+	t.Run("stalled", func(t *testing.T) {
+		done, stop := fakeStream()
+		start := time.Now()
+		canceled, err := watchStream(context.Background(), done, stop, make(chan struct{}), 20*time.Millisecond)
+		require.True(t, errors.Is(err, ErrStreamStalled))
+		require.False(t, canceled)
+		require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("alive", func(t *testing.T) {
+		done, stop := fakeStream()
+		alive := make(chan struct{}, 1)
+		go func() {
+			for i := 0; i < 5; i++ {
+				time.Sleep(10 * time.Millisecond)
+				signalAlive(alive)
+			}
+		}()
+
+		start := time.Now()
+		_, err := watchStream(context.Background(), done, stop, alive, 30*time.Millisecond)
+		require.True(t, errors.Is(err, ErrStreamStalled))
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+}
+
+// connectProxy is an HTTP proxy of CONNECT tunnels, counting the tunnels opened
+func connectProxy(t *testing.T, tunnels *int32) *url.URL {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodConnect, r.Method)
+		target, err := net.Dial("tcp", r.Host)
+		require.NoError(t, err)
+		atomic.AddInt32(tunnels, 1)
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(target, conn)
+			target.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(conn, target)
+			conn.Close()
+		}()
+	}))
+	t.Cleanup(server.Close)
+
+	proxy, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return proxy
+}
+
+func TestServeStream(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.Equal(t, "/ws/btcusdt@kline_1m", r.URL.Path)
+		err = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"kline","s":"BTCUSDT","k":{"t":1640995200000,`+
+			`"T":1640995259999,"s":"BTCUSDT","i":"1m","o":"1","c":"2","h":"3","l":"0.5","v":"10","x":true}}`))
+		require.NoError(t, err)
+
+		// keep the connection open until the client closes it
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	t.Run("through the proxy", func(t *testing.T) {
+		var tunnels int32
+		proxy := connectProxy(t, &tunnels)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		b := &Binance{dialer: proxyDialer(binanceDialer(), proxy),
+			streamURL: "ws://" + strings.TrimPrefix(server.URL, "http://") + "/ws"}
+
+		candles, _ := b.CandlesSubscription(ctx, "BTCUSDT", "1m")
+		select {
+		case candle := <-candles:
+			require.Equal(t, 2.0, candle.Close)
+			require.True(t, candle.Complete)
+		case <-time.After(time.Second):
+			t.Fatal("candle not received")
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&tunnels))
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		endpoint := "ws://" + strings.TrimPrefix(server.URL, "http://") + "/ws/btcusdt@kline_1m"
+		messages := make(chan []byte, 1)
+		done, stop, err := serveStream(binanceDialer(), endpoint, time.Minute, func(message []byte) {
+			messages <- message
+		}, func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		})
+		require.NoError(t, err)
+		require.Contains(t, string(<-messages), "kline")
+
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stream not stopped")
+		}
+	})
+}
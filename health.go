@@ -0,0 +1,206 @@
+package ninjabot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/tools/log"
+)
+
+const (
+	healthStateKey    = "health"
+	healthPingTimeout = 5 * time.Second
+)
+
+type health struct {
+	mtx        sync.RWMutex
+	address    string
+	maxDelay   time.Duration
+	warmup     bool
+	lastCandle time.Time
+	panicToken string
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// WithHealthServer starts an HTTP server in the given address (e.g. ":8080") with the liveness (/healthz)
+// and readiness (/readyz) probes. The liveness probe checks only the candle stream, which is considered stale
+// when no candle is received during maxDelay, it should be greater than the update interval of the data feed.
+// The readiness probe checks the warmup, the storage and the exchange connection
+func WithHealthServer(address string, maxDelay time.Duration) Option {
+	return func(bot *NinjaBot) {
+		bot.health = &health{address: address, maxDelay: maxDelay}
+	}
+}
+
+// WithPanicEndpoint adds the POST /panic endpoint to the health server, which calls FlattenAll to cancel the open
+// orders and close the positions of the bot. The requests must have the header "Authorization: Bearer <token>".
+// It requires WithHealthServer
+func WithPanicEndpoint(token string) Option {
+	return func(bot *NinjaBot) {
+		bot.panicToken = token
+	}
+}
+
+func (h *health) onCandle() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.lastCandle = time.Now()
+}
+
+func (h *health) onWarmup() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.warmup = true
+}
+
+// ready returns true when the warmup candles are loaded and the first candle of the data feed is received
+func (h *health) ready() bool {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.warmup && !h.lastCandle.IsZero()
+}
+
+func (h *health) checkCandles() error {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	// the stream is not checked while the bot is starting, readiness covers it
+	if h.lastCandle.IsZero() {
+		return nil
+	}
+
+	if delay := time.Since(h.lastCandle); delay > h.maxDelay {
+		return fmt.Errorf("no candles received in %s", delay.Truncate(time.Second))
+	}
+	return nil
+}
+
+// livenessChecks are the checks of /healthz, local to the process so that a failure of the exchange or of the
+// storage doesn't restart the bot
+func (n *NinjaBot) livenessChecks() map[string]func() error {
+	return map[string]func() error{
+		"candles": n.health.checkCandles,
+	}
+}
+
+// readinessChecks are the checks of /readyz, with the dependencies of the bot
+func (n *NinjaBot) readinessChecks(ctx context.Context) map[string]func() error {
+	return map[string]func() error{
+		"storage": func() error {
+			return n.storage.SetState(healthStateKey, []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+		},
+		"exchange": func() error {
+			pinger, ok := n.exchange.(exchange.Pinger)
+			if !ok {
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+			defer cancel()
+			return pinger.Ping(ctx)
+		},
+	}
+}
+
+func runHealthChecks(checks map[string]func() error) (map[string]string, bool) {
+	healthy := true
+	result := make(map[string]string, len(checks))
+	for name, check := range checks {
+		if err := check(); err != nil {
+			healthy = false
+			result[name] = err.Error()
+			continue
+		}
+		result[name] = "ok"
+	}
+
+	return result, healthy
+}
+
+func (n *NinjaBot) healthHandler() http.Handler {
+	write := func(w http.ResponseWriter, checks map[string]string, healthy bool) {
+		response := healthResponse{Status: "ok", Checks: checks}
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			response.Status = "unavailable"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Errorf("health: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		checks, healthy := runHealthChecks(n.livenessChecks())
+		write(w, checks, healthy)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks, healthy := runHealthChecks(n.readinessChecks(r.Context()))
+		checks["ready"] = "ok"
+		if !n.health.ready() {
+			checks["ready"] = "waiting for warmup candles and data feed"
+			healthy = false
+		}
+		write(w, checks, healthy)
+	})
+
+	if n.health.panicToken != "" {
+		mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			token := []byte("Bearer " + n.health.panicToken)
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), token) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			log.Warn("[PANIC] flatten requested by the panic endpoint")
+			checks := map[string]string{"flatten": "ok"}
+			err := n.FlattenAll()
+			if err != nil {
+				checks["flatten"] = err.Error()
+			}
+			write(w, checks, err == nil)
+		})
+	}
+
+	return mux
+}
+
+func (n *NinjaBot) startHealthServer(ctx context.Context) {
+	server := &http.Server{
+		Addr:              n.health.address,
+		Handler:           n.healthHandler(),
+		ReadHeaderTimeout: healthPingTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Errorf("health: %v", err)
+		}
+	}()
+
+	go func() {
+		log.Infof("[SETUP] Health server listening on %s", n.health.address)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("health: %v", err)
+		}
+	}()
+}
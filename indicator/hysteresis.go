@@ -0,0 +1,45 @@
+package indicator
+
+// CrossWithHysteresis returns the confirmed trend of a crossover between two series: 1 when the series is
+// above the reference, -1 when it is below and 0 before the first confirmation. A cross is confirmed when
+// the series exceeds the reference by the threshold (e.g. 0.01 for 1%) or stays on the same side for
+// the given number of candles, otherwise the previous trend is kept. A new trend starts where the result
+// changes, e.g. result[i] == 1 && result[i-1] != 1 is a confirmed crossover
+func CrossWithHysteresis(series, reference []float64, threshold float64, confirmation int) []float64 {
+	result := make([]float64, len(series))
+	trend, side, count := 0.0, 0.0, 0
+
+	for i := 0; i < len(series) && i < len(reference); i++ {
+		// ignore warmup values of the indicators
+		if series[i] == 0 || reference[i] == 0 || series[i] != series[i] || reference[i] != reference[i] {
+			result[i] = trend
+			continue
+		}
+
+		current := 0.0
+		switch {
+		case series[i] > reference[i]:
+			current = 1
+		case series[i] < reference[i]:
+			current = -1
+		}
+
+		if current != 0 && current == side {
+			count++
+		} else {
+			side, count = current, 1
+		}
+
+		if current != 0 {
+			exceeded := threshold > 0 && (series[i]-reference[i])/reference[i]*current > threshold
+			confirmed := confirmation > 0 && count >= confirmation
+			if exceeded || confirmed {
+				trend = current
+			}
+		}
+
+		result[i] = trend
+	}
+
+	return result
+}
@@ -0,0 +1,30 @@
+package indicator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrossWithHysteresis(t *testing.T) {
+	reference := []float64{0, 100, 100, 100, 100, 100, 100, 100, 100}
+
+	t.Run("threshold", func(t *testing.T) {
+		series := []float64{0, 99, 100.5, 102, 100.5, 99.5, 98, 99, 100.5}
+		result := CrossWithHysteresis(series, reference, 0.01, 0)
+		require.Equal(t, []float64{0, 0, 0, 1, 1, 1, -1, -1, -1}, result)
+	})
+
+	t.Run("confirmation candles", func(t *testing.T) {
+		series := []float64{0, 101, 99, 101, 101, 101, 99, 99, 101}
+		result := CrossWithHysteresis(series, reference, 0, 3)
+		require.Equal(t, []float64{0, 0, 0, 0, 0, 1, 1, 1, 1}, result)
+	})
+
+	t.Run("threshold or confirmation", func(t *testing.T) {
+		series := []float64{math.NaN(), 101, 99, 99, 97, 101, 101, 101, 101}
+		result := CrossWithHysteresis(series, reference, 0.02, 2)
+		require.Equal(t, []float64{0, 0, 0, -1, -1, -1, 1, 1, 1}, result)
+	})
+}
@@ -0,0 +1,96 @@
+package indicator
+
+import "github.com/rodrigo-brito/ninjabot/model"
+
+// PivotMethod is the formula used to calculate the support and resistance levels of the pivot points
+type PivotMethod string
+
+const (
+	// PivotClassic calculates the levels with the range of the candle from the pivot (floor pivots)
+	PivotClassic PivotMethod = "classic"
+	// PivotFibonacci calculates the levels with the Fibonacci ratios (38.2%, 61.8% and 100%) of the candle range
+	PivotFibonacci PivotMethod = "fibonacci"
+)
+
+// Pivots are the pivot point and the resistance (R1-R3) and support (S1-S3) levels
+type Pivots struct {
+	Pivot float64
+	R1    float64
+	R2    float64
+	R3    float64
+	S1    float64
+	S2    float64
+	S3    float64
+}
+
+// PivotPoints returns the pivot points of the next period from the candle of the previous period, e.g. the
+// daily candle of yesterday for the intraday levels of today. Unknown methods use PivotClassic
+func PivotPoints(prev model.Candle, method PivotMethod) Pivots {
+	pivot := (prev.High + prev.Low + prev.Close) / 3
+	size := prev.High - prev.Low
+
+	if method == PivotFibonacci {
+		return Pivots{
+			Pivot: pivot,
+			R1:    pivot + 0.382*size,
+			R2:    pivot + 0.618*size,
+			R3:    pivot + size,
+			S1:    pivot - 0.382*size,
+			S2:    pivot - 0.618*size,
+			S3:    pivot - size,
+		}
+	}
+
+	return Pivots{
+		Pivot: pivot,
+		R1:    2*pivot - prev.Low,
+		R2:    pivot + size,
+		R3:    prev.High + 2*(pivot-prev.Low),
+		S1:    2*pivot - prev.High,
+		S2:    pivot - size,
+		S3:    prev.Low - 2*(prev.High-pivot),
+	}
+}
+
+// SwingLevels returns the resistance and support of each candle, which are the last swing high and swing low
+// confirmed until the candle. A swing high is a candle with the highest high of the `window` candles before
+// and after it (swing lows use the lowest low), so it is confirmed `window` candles later and the levels don't
+// look ahead. The levels are zero before the first confirmed swing
+func SwingLevels(candles []model.Candle, window int) (resistance, support []float64) {
+	resistance = make([]float64, len(candles))
+	support = make([]float64, len(candles))
+	if window <= 0 {
+		return resistance, support
+	}
+
+	var lastHigh, lastLow float64
+	for i := range candles {
+		// the candle in the middle of the window is confirmed by the current candle
+		if pivot := i - window; pivot >= window {
+			high, low := true, true
+			for j := pivot - window; j <= i; j++ {
+				if j == pivot {
+					continue
+				}
+				if candles[j].High > candles[pivot].High {
+					high = false
+				}
+				if candles[j].Low < candles[pivot].Low {
+					low = false
+				}
+			}
+
+			if high {
+				lastHigh = candles[pivot].High
+			}
+			if low {
+				lastLow = candles[pivot].Low
+			}
+		}
+
+		resistance[i] = lastHigh
+		support[i] = lastLow
+	}
+
+	return resistance, support
+}
@@ -0,0 +1,52 @@
+package indicator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestPivotPoints(t *testing.T) {
+	prev := model.Candle{High: 120, Low: 95, Close: 115}
+
+	t.Run("classic", func(t *testing.T) {
+		pivots := PivotPoints(prev, PivotClassic)
+		require.InDelta(t, 110, pivots.Pivot, 1e-9)
+		require.InDelta(t, 125, pivots.R1, 1e-9)
+		require.InDelta(t, 135, pivots.R2, 1e-9)
+		require.InDelta(t, 150, pivots.R3, 1e-9)
+		require.InDelta(t, 100, pivots.S1, 1e-9)
+		require.InDelta(t, 85, pivots.S2, 1e-9)
+		require.InDelta(t, 75, pivots.S3, 1e-9)
+	})
+
+	t.Run("fibonacci", func(t *testing.T) {
+		pivots := PivotPoints(prev, PivotFibonacci)
+		require.InDelta(t, 110, pivots.Pivot, 1e-9)
+		require.InDelta(t, 119.55, pivots.R1, 1e-9)
+		require.InDelta(t, 125.45, pivots.R2, 1e-9)
+		require.InDelta(t, 135, pivots.R3, 1e-9)
+		require.InDelta(t, 100.45, pivots.S1, 1e-9)
+		require.InDelta(t, 94.55, pivots.S2, 1e-9)
+		require.InDelta(t, 85, pivots.S3, 1e-9)
+	})
+}
+
+func TestSwingLevels(t *testing.T) {
+	highs := []float64{3, 5, 4, 6, 8, 7, 6, 9, 8}
+	lows := []float64{2, 4, 3, 5, 7, 6, 4, 8, 7}
+	candles := make([]model.Candle, len(highs))
+	for i := range highs {
+		candles[i] = model.Candle{High: highs[i], Low: lows[i]}
+	}
+
+	resistance, support := SwingLevels(candles, 1)
+	require.Equal(t, []float64{0, 0, 5, 5, 5, 8, 8, 8, 9}, resistance)
+	require.Equal(t, []float64{0, 0, 0, 3, 3, 3, 3, 4, 4}, support)
+
+	resistance, support = SwingLevels(candles, 0)
+	require.Equal(t, make([]float64, len(candles)), resistance)
+	require.Equal(t, make([]float64, len(candles)), support)
+}
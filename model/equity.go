@@ -0,0 +1,96 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// EquitySnapshot is the total value of the account at a given time, in the base currency
+type EquitySnapshot struct {
+	ID     int64     `db:"id" json:"id" gorm:"primaryKey,autoIncrement"`
+	Time   time.Time `db:"time" json:"time" gorm:"index"`
+	Equity float64   `db:"equity" json:"equity"`
+}
+
+// EquityCurve is a series of equity snapshots sorted by time
+type EquityCurve []EquitySnapshot
+
+// Returns returns the percentage change between consecutive snapshots, e.g. 0.01 for 1%
+func (e EquityCurve) Returns() []float64 {
+	returns := make([]float64, 0, len(e))
+	for i := 1; i < len(e); i++ {
+		if e[i-1].Equity == 0 {
+			continue
+		}
+		returns = append(returns, (e[i].Equity-e[i-1].Equity)/e[i-1].Equity)
+	}
+	return returns
+}
+
+// MaxDrawdown returns the largest decline from a peak of the equity as a negative percentage
+// (e.g. -0.2 for 20%), with the time of the peak and of the bottom
+func (e EquityCurve) MaxDrawdown() (float64, time.Time, time.Time) {
+	if len(e) == 0 {
+		return 0, time.Time{}, time.Time{}
+	}
+
+	var maxDrawdown float64
+	var start, end time.Time
+	peak := e[0]
+	for _, snapshot := range e {
+		if snapshot.Equity > peak.Equity {
+			peak = snapshot
+			continue
+		}
+
+		if peak.Equity <= 0 {
+			continue
+		}
+
+		drawdown := (snapshot.Equity - peak.Equity) / peak.Equity
+		if drawdown < maxDrawdown {
+			maxDrawdown, start, end = drawdown, peak.Time, snapshot.Time
+		}
+	}
+
+	return maxDrawdown, start, end
+}
+
+// PeriodsPerYear returns the number of snapshots per year, given the average interval between them
+func (e EquityCurve) PeriodsPerYear() float64 {
+	if len(e) < 2 {
+		return 0
+	}
+
+	interval := e[len(e)-1].Time.Sub(e[0].Time) / time.Duration(len(e)-1)
+	if interval <= 0 {
+		return 0
+	}
+	return float64(365*24*time.Hour) / float64(interval)
+}
+
+// SharpeRatio returns the annualized Sharpe ratio of the returns between snapshots, with a zero
+// risk-free rate. The periods per year depends on the snapshot interval, e.g. 365 for daily snapshots
+func (e EquityCurve) SharpeRatio(periodsPerYear float64) float64 {
+	returns := e.Returns()
+	if len(returns) < 2 {
+		return 0
+	}
+
+	var mean float64
+	for _, value := range returns {
+		mean += value
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, value := range returns {
+		variance += (value - mean) * (value - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(returns)-1))
+	if stdDev == 0 {
+		return 0
+	}
+
+	return mean / stdDev * math.Sqrt(periodsPerYear)
+}
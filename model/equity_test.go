@@ -0,0 +1,57 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEquityCurve(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	curve := EquityCurve{
+		{Time: start, Equity: 100},
+		{Time: start.Add(time.Hour), Equity: 120},
+		{Time: start.Add(2 * time.Hour), Equity: 90},
+		{Time: start.Add(3 * time.Hour), Equity: 110},
+		{Time: start.Add(4 * time.Hour), Equity: 99},
+	}
+
+	t.Run("returns", func(t *testing.T) {
+		returns := curve.Returns()
+		require.Len(t, returns, 4)
+		require.InDelta(t, 0.2, returns[0], 1e-9)
+		require.InDelta(t, -0.25, returns[1], 1e-9)
+	})
+
+	t.Run("max drawdown", func(t *testing.T) {
+		value, peak, bottom := curve.MaxDrawdown()
+		require.InDelta(t, -0.25, value, 1e-9)
+		require.Equal(t, start.Add(time.Hour), peak)
+		require.Equal(t, start.Add(2*time.Hour), bottom)
+
+		value, _, _ = EquityCurve{}.MaxDrawdown()
+		require.Zero(t, value)
+	})
+
+	t.Run("periods per year", func(t *testing.T) {
+		require.Equal(t, 365*24.0, curve.PeriodsPerYear())
+		require.Zero(t, curve[:1].PeriodsPerYear())
+	})
+
+	t.Run("sharpe ratio", func(t *testing.T) {
+		flat := EquityCurve{{Equity: 100}, {Equity: 100}, {Equity: 100}}
+		require.Zero(t, flat.SharpeRatio(365))
+
+		growth := EquityCurve{{Equity: 100}, {Equity: 101}, {Equity: 103}, {Equity: 104}}
+		returns := growth.Returns()
+		mean := (returns[0] + returns[1] + returns[2]) / 3
+		variance := 0.0
+		for _, value := range returns {
+			variance += (value - mean) * (value - mean)
+		}
+		expected := mean / math.Sqrt(variance/2) * math.Sqrt(365)
+		require.InDelta(t, expected, growth.SharpeRatio(365), 1e-9)
+	})
+}
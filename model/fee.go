@@ -0,0 +1,19 @@
+package model
+
+// Fee is the maker and taker fee rates of a pair, e.g. 0.001 for 0.1%. A negative rate is a rebate
+type Fee struct {
+	Maker float64
+	Taker float64
+}
+
+// FeeSchedule overrides the account fee rates by pair, e.g. for pairs with promotional fees or VIP tiers
+type FeeSchedule map[string]Fee
+
+// Rates returns the maker and taker rates of the pair, or the given default rates when the pair is not
+// in the schedule
+func (f FeeSchedule) Rates(pair string, maker, taker float64) (float64, float64) {
+	if fee, ok := f[pair]; ok {
+		return fee.Maker, fee.Taker
+	}
+	return maker, taker
+}
@@ -7,15 +7,67 @@ import (
 	"time"
 )
 
+// TelegramRole is the permission of a Telegram user, each role includes the commands of the previous ones
+type TelegramRole string
+
+const (
+	// TelegramRoleViewer checks the bot: /status, /balance, /profit, /chart and /help
+	TelegramRoleViewer TelegramRole = "viewer"
+	// TelegramRoleTrader also creates orders: /buy and /sell
+	TelegramRoleTrader TelegramRole = "trader"
+	// TelegramRoleAdmin also starts and stops the bot and closes all positions: /start, /stop and /panic
+	TelegramRoleAdmin TelegramRole = "admin"
+)
+
+var telegramRoleLevels = map[TelegramRole]int{
+	TelegramRoleViewer: 1,
+	TelegramRoleTrader: 2,
+	TelegramRoleAdmin:  3,
+}
+
+// Valid returns true for the known roles
+func (r TelegramRole) Valid() bool {
+	_, ok := telegramRoleLevels[r]
+	return ok
+}
+
+// Allows returns true if the role includes the commands of the required role
+func (r TelegramRole) Allows(required TelegramRole) bool {
+	return r.Valid() && telegramRoleLevels[r] >= telegramRoleLevels[required]
+}
+
 type TelegramSettings struct {
 	Enabled bool
 	Token   string
 	Users   []int
+	// Roles maps the users to their roles, the users without a role are admins. Only the users of Users are
+	// accepted and notified, the roles of other users are ignored
+	Roles map[int]TelegramRole
+}
+
+// Role returns the role of a user, see Roles
+func (t TelegramSettings) Role(user int) TelegramRole {
+	if role, ok := t.Roles[user]; ok {
+		return role
+	}
+	return TelegramRoleAdmin
+}
+
+// SlackSettings configures the Slack notifier, messages are sent with the incoming
+// webhook URL or, when a bot token is set, with the chat.postMessage API
+type SlackSettings struct {
+	Enabled    bool
+	WebhookURL string
+	Token      string
+	Channel    string
 }
 
 type Settings struct {
 	Pairs    []string
 	Telegram TelegramSettings
+	Slack    SlackSettings
+	// Parameters are passed to strategies that implement strategy.ConfigurableStrategy
+	Parameters Parameters
 }
 
 type Balance struct {
@@ -23,6 +75,8 @@ type Balance struct {
 	Free     float64
 	Lock     float64
 	Leverage float64
+	Borrowed float64
+	Interest float64
 }
 
 type AssetInfo struct {
@@ -35,6 +89,7 @@ type AssetInfo struct {
 	MaxQuantity float64
 	StepSize    float64
 	TickSize    float64
+	MinNotional float64
 
 	QuotePrecision     int
 	BaseAssetPrecision int
@@ -54,6 +109,9 @@ type Dataframe struct {
 
 	// Custom user metadata
 	Metadata map[string]Series[float64]
+
+	// Dataframes of the additional timeframes of a multi timeframe strategy
+	Timeframes map[string]*Dataframe
 }
 
 func (df Dataframe) Sample(positions int) Dataframe {
@@ -73,6 +131,7 @@ func (df Dataframe) Sample(positions int) Dataframe {
 		Time:       df.Time[start:],
 		LastUpdate: df.LastUpdate,
 		Metadata:   make(map[string]Series[float64]),
+		Timeframes: df.Timeframes,
 	}
 
 	for key := range df.Metadata {
@@ -82,6 +141,52 @@ func (df Dataframe) Sample(positions int) Dataframe {
 	return sample
 }
 
+// Trim drops the oldest positions of the dataframe and its metadata, keeping the last size positions. The
+// memory of the dropped positions is released when the series grow again
+func (df *Dataframe) Trim(size int) {
+	start := len(df.Time) - size
+	if size <= 0 || start <= 0 {
+		return
+	}
+
+	df.Close = df.Close[start:]
+	df.Open = df.Open[start:]
+	df.High = df.High[start:]
+	df.Low = df.Low[start:]
+	df.Volume = df.Volume[start:]
+	df.Time = df.Time[start:]
+	for key, values := range df.Metadata {
+		if drop := len(values) - size; drop > 0 {
+			df.Metadata[key] = values[drop:]
+		}
+	}
+}
+
+// CandleTimeMode is the timestamp convention of candles in external data. Ninjabot and Binance use the
+// open time of the interval (default), some data providers export candles with the close time instead
+type CandleTimeMode string
+
+const (
+	CandleTimeOpen  CandleTimeMode = "open"
+	CandleTimeClose CandleTimeMode = "close"
+)
+
+// OpenTime converts a timestamp in the given mode to the open time of the candle
+func (m CandleTimeMode) OpenTime(t time.Time, interval time.Duration) time.Time {
+	if m == CandleTimeClose {
+		return t.Add(-interval)
+	}
+	return t
+}
+
+// Timestamp converts the open time of a candle to a timestamp in the given mode
+func (m CandleTimeMode) Timestamp(openTime time.Time, interval time.Duration) time.Time {
+	if m == CandleTimeClose {
+		return openTime.Add(interval)
+	}
+	return openTime
+}
+
 type Candle struct {
 	Pair      string
 	Time      time.Time
@@ -93,10 +198,18 @@ type Candle struct {
 	Volume    float64
 	Complete  bool
 
-	// Aditional collums from CSV inputs
+	// Aditional collums from CSV inputs and exchange data, e.g. MetadataOpenInterest
 	Metadata map[string]float64
 }
 
+// Metadata keys of the derivatives data of the candles, e.g. from the CSV columns with the same names
+const (
+	// MetadataOpenInterest is the open interest of a futures pair at the candle close, in contracts
+	MetadataOpenInterest = "open_interest"
+	// MetadataFundingRate is the last funding rate of a perpetual futures pair
+	MetadataFundingRate = "funding_rate"
+)
+
 func (c Candle) Empty() bool {
 	return c.Pair == "" && c.Close == 0 && c.Open == 0 && c.Volume == 0
 }
@@ -156,6 +269,63 @@ func (c Candle) Less(j Item) bool {
 	return c.Pair < j.(Candle).Pair
 }
 
+type Trade struct {
+	Pair         string
+	ID           int64
+	Price        float64
+	Quantity     float64
+	Time         time.Time
+	IsBuyerMaker bool
+
+	// fields of the account trades, see exchange.TradeHistoryFetcher
+	OrderID         int64
+	Side            SideType
+	IsMaker         bool
+	Commission      float64
+	CommissionAsset string
+}
+
+type PriceLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// Depth is an order book snapshot, with bids sorted by descending price and asks by ascending price
+type Depth struct {
+	Pair string
+	Time time.Time
+	Bids []PriceLevel
+	Asks []PriceLevel
+}
+
+// ToTrades synthesizes the ticks of a candle with the given duration, following the path
+// open -> low -> high -> close for bullish candles and open -> high -> low -> close for bearish ones.
+// The volume is split equally between the ticks.
+func (c Candle) ToTrades(duration time.Duration) []Trade {
+	path := []float64{c.Open, c.Low, c.High, c.Close}
+	if c.Close < c.Open {
+		path = []float64{c.Open, c.High, c.Low, c.Close}
+	}
+
+	trades := make([]Trade, 0, len(path))
+	for i, price := range path {
+		previous := c.Open
+		if i > 0 {
+			previous = path[i-1]
+		}
+
+		trades = append(trades, Trade{
+			Pair:         c.Pair,
+			Price:        price,
+			Quantity:     c.Volume / float64(len(path)),
+			Time:         c.Time.Add(duration * time.Duration(i) / time.Duration(len(path))),
+			IsBuyerMaker: price < previous,
+		})
+	}
+
+	return trades
+}
+
 type Account struct {
 	Balances []Balance
 }
@@ -23,6 +23,30 @@ func TestCandle_ToSlice(t *testing.T) {
 	require.Equal(t, expectedOutput, candle.ToSlice(2))
 }
 
+func TestCandle_ToTrades(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("bearish", func(t *testing.T) {
+		candle := Candle{Pair: "BTCUSDT", Time: start, Open: 10, Close: 8, Low: 7, High: 12, Volume: 4}
+		trades := candle.ToTrades(time.Hour)
+		require.Equal(t, []Trade{
+			{Pair: "BTCUSDT", Price: 10, Quantity: 1, Time: start},
+			{Pair: "BTCUSDT", Price: 12, Quantity: 1, Time: start.Add(15 * time.Minute)},
+			{Pair: "BTCUSDT", Price: 7, Quantity: 1, Time: start.Add(30 * time.Minute), IsBuyerMaker: true},
+			{Pair: "BTCUSDT", Price: 8, Quantity: 1, Time: start.Add(45 * time.Minute)},
+		}, trades)
+	})
+
+	t.Run("bullish", func(t *testing.T) {
+		candle := Candle{Pair: "BTCUSDT", Time: start, Open: 8, Close: 10, Low: 7, High: 12, Volume: 4}
+		trades := candle.ToTrades(time.Hour)
+		require.Equal(t, 7.0, trades[1].Price)
+		require.True(t, trades[1].IsBuyerMaker)
+		require.Equal(t, 12.0, trades[2].Price)
+		require.True(t, trades[3].IsBuyerMaker)
+	})
+}
+
 func TestCandle_Less(t *testing.T) {
 	now := time.Now()
 
@@ -47,6 +71,31 @@ func TestAccount_Balance(t *testing.T) {
 	require.Equal(t, Balance{Asset: "B", Free: 1.1, Lock: 1.3}, quoteBalance)
 }
 
+func TestTelegramSettings_Role(t *testing.T) {
+	settings := TelegramSettings{
+		Users: []int{1, 2, 3},
+		Roles: map[int]TelegramRole{1: TelegramRoleViewer, 2: TelegramRoleTrader, 4: "owner"},
+	}
+
+	viewer := settings.Role(1)
+	require.True(t, viewer.Allows(TelegramRoleViewer))
+	require.False(t, viewer.Allows(TelegramRoleTrader))
+	require.False(t, viewer.Allows(TelegramRoleAdmin))
+
+	trader := settings.Role(2)
+	require.True(t, trader.Allows(TelegramRoleViewer))
+	require.True(t, trader.Allows(TelegramRoleTrader))
+	require.False(t, trader.Allows(TelegramRoleAdmin))
+
+	// users without a role are admins
+	require.Equal(t, TelegramRoleAdmin, settings.Role(3))
+	require.True(t, settings.Role(3).Allows(TelegramRoleAdmin))
+
+	// unknown roles allow nothing
+	require.False(t, settings.Role(4).Valid())
+	require.False(t, settings.Role(4).Allows(TelegramRoleViewer))
+}
+
 func TestHeikinAshi_CalculateHeikinAshi(t *testing.T) {
 	ha := NewHeikinAshi()
 
@@ -139,3 +188,30 @@ func TestDataframe_Sample(t *testing.T) {
 	sample.Metadata["test"] = []float64{10, 11, 12, 13, 14}
 	require.Equal(t, df.Metadata["test"], Series[float64]([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9}))
 }
+
+func TestDataframe_Trim(t *testing.T) {
+	now := time.Now()
+	df := Dataframe{
+		Close:  []float64{1, 2, 3, 4, 5},
+		Open:   []float64{1, 2, 3, 4, 5},
+		High:   []float64{1, 2, 3, 4, 5},
+		Low:    []float64{1, 2, 3, 4, 5},
+		Volume: []float64{1, 2, 3, 4, 5},
+		Time:   []time.Time{now, now, now, now, now.Add(time.Minute)},
+		Metadata: map[string]Series[float64]{
+			"full":  []float64{1, 2, 3, 4, 5},
+			"short": []float64{4, 5},
+		},
+	}
+
+	df.Trim(10)
+	require.Len(t, df.Time, 5)
+
+	df.Trim(3)
+	require.Equal(t, Series[float64]([]float64{3, 4, 5}), df.Close)
+	require.Equal(t, Series[float64]([]float64{3, 4, 5}), df.Volume)
+	require.Len(t, df.Time, 3)
+	require.Equal(t, now.Add(time.Minute), df.Time[2])
+	require.Equal(t, Series[float64]([]float64{3, 4, 5}), df.Metadata["full"])
+	require.Equal(t, Series[float64]([]float64{4, 5}), df.Metadata["short"])
+}
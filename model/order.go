@@ -8,6 +8,8 @@ import (
 type SideType string
 type OrderType string
 type OrderStatusType string
+type TimeInForce string
+type SideEffectType string
 
 var (
 	SideTypeBuy  SideType = "BUY"
@@ -20,6 +22,9 @@ var (
 	OrderTypeStopLossLimit   OrderType = "STOP_LOSS_LIMIT"
 	OrderTypeTakeProfit      OrderType = "TAKE_PROFIT"
 	OrderTypeTakeProfitLimit OrderType = "TAKE_PROFIT_LIMIT"
+	// OrderTypeTrailingStopMarket is a market order triggered when the price retraces from its best price
+	// by the callback rate, after reaching the activation price
+	OrderTypeTrailingStopMarket OrderType = "TRAILING_STOP_MARKET"
 
 	OrderStatusTypeNew             OrderStatusType = "NEW"
 	OrderStatusTypePartiallyFilled OrderStatusType = "PARTIALLY_FILLED"
@@ -28,6 +33,23 @@ var (
 	OrderStatusTypePendingCancel   OrderStatusType = "PENDING_CANCEL"
 	OrderStatusTypeRejected        OrderStatusType = "REJECTED"
 	OrderStatusTypeExpired         OrderStatusType = "EXPIRED"
+	// OrderStatusTypePendingNew is an order of a list waiting for a trigger, e.g. the bracket orders of an OTOCO
+	// order before the entry is filled
+	OrderStatusTypePendingNew OrderStatusType = "PENDING_NEW"
+
+	// TimeInForceGTC (good till canceled) keeps the order open until it is filled or canceled
+	TimeInForceGTC TimeInForce = "GTC"
+	// TimeInForceIOC (immediate or cancel) fills what is possible immediately and cancels the rest
+	TimeInForceIOC TimeInForce = "IOC"
+	// TimeInForceFOK (fill or kill) fills the whole order immediately or cancels it entirely
+	TimeInForceFOK TimeInForce = "FOK"
+
+	// SideEffectTypeNoSideEffect places a margin order using only the available balance
+	SideEffectTypeNoSideEffect SideEffectType = "NO_SIDE_EFFECT"
+	// SideEffectTypeMarginBuy borrows the missing amount to place the margin order
+	SideEffectTypeMarginBuy SideEffectType = "MARGIN_BUY"
+	// SideEffectTypeAutoRepay repays the borrowed amount with the result of the margin order
+	SideEffectTypeAutoRepay SideEffectType = "AUTO_REPAY"
 )
 
 type Order struct {
@@ -39,6 +61,14 @@ type Order struct {
 	Status     OrderStatusType `db:"status" json:"status"`
 	Price      float64         `db:"price" json:"price"`
 	Quantity   float64         `db:"quantity" json:"quantity"`
+	Fee        float64         `db:"fee" json:"fee"`
+
+	// ExecutedQuantity is the quantity filled so far, lower than the quantity for partially filled orders
+	ExecutedQuantity float64 `db:"executed_quantity" json:"executed_quantity"`
+
+	// ClientOrderID is the ID of the order set by the client, with exchange.ClientOrderIDPrefix for the orders
+	// created by the bot in the exchanges that support it
+	ClientOrderID string `db:"client_order_id" json:"client_order_id,omitempty"`
 
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+var ErrMissingParameter = errors.New("missing parameter")
+
+// Parameters are the strategy parameters of the settings, e.g. loaded from the config file, to tune a strategy
+// without rebuilding it. Values are read with the typed accessors, which return the default value when the
+// parameter is not defined
+type Parameters map[string]interface{}
+
+// Require returns an error with the first missing parameter
+func (p Parameters) Require(keys ...string) error {
+	for _, key := range keys {
+		if _, ok := p[key]; !ok {
+			return fmt.Errorf("%w: %s", ErrMissingParameter, key)
+		}
+	}
+	return nil
+}
+
+// Float returns a numeric parameter, numbers written as strings are parsed
+func (p Parameters) Float(key string, defaultValue float64) (float64, error) {
+	value, ok := p[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %s: invalid number %q", key, v)
+		}
+		return number, nil
+	}
+
+	return 0, fmt.Errorf("parameter %s: invalid number %v", key, value)
+}
+
+// Int returns an integer parameter, numbers with decimals are invalid
+func (p Parameters) Int(key string, defaultValue int) (int, error) {
+	if _, ok := p[key]; !ok {
+		return defaultValue, nil
+	}
+
+	number, err := p.Float(key, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if number != float64(int(number)) {
+		return 0, fmt.Errorf("parameter %s: invalid integer %v", key, number)
+	}
+	return int(number), nil
+}
+
+// String returns a text parameter, other values are formatted as text
+func (p Parameters) String(key string, defaultValue string) string {
+	value, ok := p[key]
+	if !ok {
+		return defaultValue
+	}
+
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// Bool returns a boolean parameter, e.g. true, false, "true" or "1"
+func (p Parameters) Bool(key string, defaultValue bool) (bool, error) {
+	value, ok := p[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		result, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("parameter %s: invalid boolean %q", key, v)
+		}
+		return result, nil
+	}
+
+	return false, fmt.Errorf("parameter %s: invalid boolean %v", key, value)
+}
+
+// Duration returns a duration parameter, e.g. "4h", "30m" or "1d"
+func (p Parameters) Duration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, ok := p[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("parameter %s: invalid duration %v", key, value)
+	}
+
+	duration, err := str2duration.ParseDuration(strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: invalid duration %q", key, text)
+	}
+	return duration, nil
+}
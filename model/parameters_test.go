@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameters(t *testing.T) {
+	params := Parameters{
+		"period":    14,
+		"threshold": 0.5,
+		"text":      "1.5",
+		"enabled":   "true",
+		"interval":  "4h",
+		"name":      "ema",
+	}
+
+	t.Run("require", func(t *testing.T) {
+		require.NoError(t, params.Require("period", "threshold"))
+		err := params.Require("period", "missing")
+		require.ErrorIs(t, err, ErrMissingParameter)
+		require.Contains(t, err.Error(), "missing")
+	})
+
+	t.Run("float", func(t *testing.T) {
+		value, err := params.Float("threshold", 0)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, value)
+
+		value, err = params.Float("period", 0)
+		require.NoError(t, err)
+		require.Equal(t, 14.0, value)
+
+		value, err = params.Float("text", 0)
+		require.NoError(t, err)
+		require.Equal(t, 1.5, value)
+
+		value, err = params.Float("missing", 2)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, value)
+
+		_, err = params.Float("name", 0)
+		require.Error(t, err)
+	})
+
+	t.Run("int", func(t *testing.T) {
+		value, err := params.Int("period", 0)
+		require.NoError(t, err)
+		require.Equal(t, 14, value)
+
+		value, err = params.Int("missing", 9)
+		require.NoError(t, err)
+		require.Equal(t, 9, value)
+
+		_, err = params.Int("threshold", 0)
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "ema", params.String("name", ""))
+		require.Equal(t, "14", params.String("period", ""))
+		require.Equal(t, "sma", params.String("missing", "sma"))
+	})
+
+	t.Run("bool", func(t *testing.T) {
+		value, err := params.Bool("enabled", false)
+		require.NoError(t, err)
+		require.True(t, value)
+
+		_, err = params.Bool("name", false)
+		require.Error(t, err)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		value, err := params.Duration("interval", 0)
+		require.NoError(t, err)
+		require.Equal(t, 4*time.Hour, value)
+
+		value, err = params.Duration("missing", time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, value)
+
+		_, err = params.Duration("period", 0)
+		require.Error(t, err)
+	})
+}
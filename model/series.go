@@ -49,7 +49,8 @@ func (s Series[T]) Cross(ref Series[T]) bool {
 	return s.Crossover(ref) || s.Crossunder(ref)
 }
 
-// NumDecPlaces returns the number of decimal places of a float64
+// NumDecPlaces returns the number of decimal places of the shortest decimal representation of a float64, without
+// exponent, e.g. 8 for 0.00000001
 func NumDecPlaces(v float64) int64 {
 	s := strconv.FormatFloat(v, 'f', -1, 64)
 	i := strings.IndexByte(s, '.')
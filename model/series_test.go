@@ -53,6 +53,9 @@ func TestNumDecPlaces(t *testing.T) {
 		{1000, 0},
 		{-1000, 0},
 		{-1.1, 1},
+		{0.00000001, 8},
+		{1e-10, 10},
+		{1e21, 0},
 	}
 
 	for _, tc := range tt {
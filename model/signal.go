@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type SignalStatus string
+
+var (
+	// SignalStatusExecuted is a signal sent to the exchange as an order
+	SignalStatusExecuted SignalStatus = "executed"
+	// SignalStatusBlocked is a signal with an order rejected by the bot or the exchange, e.g. by the
+	// debounce, the exposure limits, a validator or insufficient funds
+	SignalStatusBlocked SignalStatus = "blocked"
+	// SignalStatusSkipped is a signal suppressed by the strategy, without an order
+	SignalStatusSkipped SignalStatus = "skipped"
+)
+
+// Signal is a trade signal of the strategy with its outcome, recorded in the signal log
+type Signal struct {
+	ID     int64        `db:"id" json:"id" gorm:"primaryKey,autoIncrement"`
+	Time   time.Time    `db:"time" json:"time" gorm:"index"`
+	Pair   string       `db:"pair" json:"pair"`
+	Side   SideType     `db:"side" json:"side"`
+	Type   OrderType    `db:"type" json:"type"`
+	Status SignalStatus `db:"status" json:"status"`
+	// Note is the annotation of the strategy, e.g. "ema cross"
+	Note string `db:"note" json:"note"`
+	// Reason is the error of a blocked signal or the reason of a skipped signal
+	Reason string `db:"reason" json:"reason"`
+	// OrderID is the ID of the order of an executed signal
+	OrderID int64 `db:"order_id" json:"order_id"`
+}
@@ -3,11 +3,21 @@ package ninjabot
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aybabtme/uniplot/histogram"
+	"github.com/xhit/go-str2duration/v2"
 
 	"github.com/rodrigo-brito/ninjabot/exchange"
 	"github.com/rodrigo-brito/ninjabot/model"
@@ -44,21 +54,105 @@ type NinjaBot struct {
 	settings model.Settings
 	exchange service.Exchange
 	strategy strategy.Strategy
-	notifier service.Notifier
+	notifier *notification.Multi
 	telegram service.Telegram
 
+	telegramOptions []notification.Option
+
 	orderController       *order.Controller
 	priorityQueueCandle   *model.PriorityQueue
 	strategiesControllers map[string]*strategy.Controller
 	orderFeed             *order.Feed
 	dataFeed              *exchange.DataFeedSubscription
 	paperWallet           *exchange.PaperWallet
+	depthSource           exchange.DepthFetcher
+	depthLimit            int
+	converter             *exchange.Converter
+	health                *health
+	candleExport          *candleExport
+	candleSubscribers     []CandleSubscriber
+	orderSubscribers      []OrderSubscriber
+
+	// guards the pairs and the strategy controllers, which can be changed at runtime
+	mtx     sync.RWMutex
+	running bool
+	paused  bool
+
+	backtest         bool
+	shadow           bool
+	warmupCandles    int
+	storageWarmup    bool
+	noStorage        bool
+	tradeExcursions  bool
+	persistCandles   *bool
+	candleRetention  int
+	candleTimeMode   model.CandleTimeMode
+	maxOpenPositions int
+	maxOpenOrders    int
+	makerFee         float64
+	takerFee         float64
+	feeSchedule      model.FeeSchedule
+	shrinkToFit      bool
+	signalDebounce   time.Duration
+	signalConfirm    int
+	minTradeInterval time.Duration
+	dailyLossLimit   float64
+	maxTradeLoss     float64
+	orderValidators  []order.Validator
+	orderRateLimit   int
+	orderRatePeriod  time.Duration
+	closeOnOpposite  bool
+	reverseOpposite  bool
+	signalLog        bool
+	maxSlippage      float64
+	minProfitExit    float64
+	minProfitStop    float64
+	lookback         int
+	reconcile        bool
+	reconcileNotify  bool
+	panicToken       string
+
+	equitySnapshots    bool
+	equityInterval     time.Duration
+	lastEquitySnapshot time.Time
 
-	backtest bool
+	// guards the first and last close of the pairs and the start equity, used by the benchmark of the summary
+	benchmarkMtx     sync.Mutex
+	benchmarkWeights map[string]float64
+	benchmarkFirst   map[string]float64
+	benchmarkLast    map[string]float64
+	startEquity      float64
+
+	// guards the candle count of the metrics warm up, used by the order controller
+	metricsMtx     sync.Mutex
+	metricsStart   time.Time
+	metricsWarmup  int
+	metricsCandles map[string]int
+	metricsPairs   map[string]time.Time
 }
 
 type Option func(*NinjaBot)
 
+// resampleTimeframes resamples the timeframes not loaded by the feed yet
+func resampleTimeframes(exch service.Exchange, resampler exchange.Resampler, timeframes []string) error {
+	var loaded []string
+	if supporter, ok := exch.(exchange.TimeframeSupporter); ok {
+		loaded = supporter.Timeframes()
+	}
+
+	var missing []string
+	for _, timeframe := range timeframes {
+		if exchange.ValidateTimeframe(timeframe, loaded) != nil {
+			missing = append(missing, timeframe)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return resampler.Resample(missing...)
+}
+
 func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange, str strategy.Strategy,
 	options ...Option) (*NinjaBot, error) {
 
@@ -79,11 +173,80 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		}
 	}
 
+	// parameters may change the strategy timeframes, so they are configured before the validation
+	if configurable, ok := str.(strategy.ConfigurableStrategy); ok {
+		if err := configurable.Configure(settings.Parameters); err != nil {
+			return nil, fmt.Errorf("strategy parameters: %w", err)
+		}
+	}
+
+	timeframes := []string{str.Timeframe()}
+	if multi, ok := str.(strategy.MultiTimeframeStrategy); ok {
+		timeframes = append(timeframes, multi.Timeframes()...)
+		for _, timeframe := range timeframes {
+			if _, err := str2duration.ParseDuration(timeframe); err != nil {
+				return nil, fmt.Errorf("strategy: %w: %q", exchange.ErrInvalidTimeframe, timeframe)
+			}
+		}
+	}
+
+	// the candles of the additional timeframes are created from the CSV files in backtests
+	if resampler, ok := exch.(exchange.Resampler); ok && len(timeframes) > 1 {
+		if err := resampleTimeframes(exch, resampler, timeframes); err != nil {
+			return nil, fmt.Errorf("strategy: %w", err)
+		}
+	}
+
+	if supporter, ok := exch.(exchange.TimeframeSupporter); ok && len(supporter.Timeframes()) > 0 {
+		for _, timeframe := range timeframes {
+			err := exchange.ValidateTimeframe(timeframe, supporter.Timeframes())
+			if err != nil {
+				return nil, fmt.Errorf("strategy: %w", err)
+			}
+		}
+	}
+
 	for _, option := range options {
 		option(bot)
 	}
 
+	if bot.panicToken != "" {
+		if bot.health == nil {
+			log.Warn("[SETUP] panic endpoint ignored, health server not enabled")
+		} else {
+			bot.health.panicToken = bot.panicToken
+		}
+	}
+
+	switch bot.candleTimeMode {
+	case "", model.CandleTimeOpen:
+	case model.CandleTimeClose:
+		setter, ok := exch.(exchange.CandleTimeModeSetter)
+		if !ok {
+			return nil, fmt.Errorf("candle time mode %q not supported by the exchange", bot.candleTimeMode)
+		}
+		if err := setter.SetCandleTimeMode(bot.candleTimeMode); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid candle time mode: %q", bot.candleTimeMode)
+	}
+
 	var err error
+	if bot.noStorage {
+		if !bot.backtest {
+			log.Warn("[SETUP] Running without storage, the strategy state and history are not persisted")
+		}
+		if bot.storageWarmup {
+			log.Warn("[SETUP] Storage warmup without storage, the warmup candles are loaded from the exchange")
+		}
+
+		bot.storage, err = storage.NoOp()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if bot.storage == nil {
 		bot.storage, err = storage.FromFile(defaultDatabase)
 		if err != nil {
@@ -91,10 +254,48 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		}
 	}
 
-	bot.orderController = order.NewController(ctx, exch, bot.storage, bot.orderFeed)
+	if bot.equitySnapshots && bot.converter == nil && bot.paperWallet == nil {
+		return nil, errors.New("equity snapshots: base currency not defined, see WithBaseCurrency")
+	}
+
+	// in shadow mode, the orders are executed in the paper wallet and the exchange is used only for market data
+	var broker service.Exchange = exch
+	if bot.shadow {
+		exchange.WithDataFeed(exch)(bot.paperWallet)
+		broker = bot.paperWallet
+	}
+
+	bot.orderController = order.NewController(ctx, broker, bot.storage, bot.orderFeed)
+	bot.orderController.SetMaxOpenPositions(bot.maxOpenPositions)
+	bot.orderController.SetMaxOpenOrders(bot.maxOpenOrders)
+	bot.orderController.SetFees(bot.makerFee, bot.takerFee)
+	bot.orderController.SetFeeSchedule(bot.feeSchedule)
+	bot.orderController.SetShrinkToFit(bot.shrinkToFit)
+	bot.orderController.SetSignalDebounce(bot.signalDebounce)
+	bot.orderController.SetMinTradeInterval(bot.minTradeInterval)
+	bot.orderController.SetLossLimits(bot.dailyLossLimit, bot.maxTradeLoss)
+	bot.orderController.SetSignalLog(bot.signalLog)
+	bot.orderController.SetMaxMarketSlippage(bot.maxSlippage)
+	bot.orderController.SetMinProfitExit(bot.minProfitExit)
+	bot.orderController.SetMinProfitStopLoss(bot.minProfitStop)
+	bot.orderController.SetSignalConfirmation(bot.signalConfirm)
+	bot.orderController.SetConverter(bot.converter)
+	bot.orderController.AddValidators(bot.orderValidators...)
+	bot.orderController.SetCloseOnOppositeSignal(bot.closeOnOpposite, bot.reverseOpposite)
+	if !bot.metricsStart.IsZero() || bot.metricsWarmup > 0 {
+		bot.metricsCandles = make(map[string]int)
+		bot.metricsPairs = make(map[string]time.Time)
+		bot.orderController.SetMetricsFilter(bot.inMetrics)
+	}
+	if !bot.backtest {
+		bot.orderController.SetOrderRate(bot.orderRateLimit, bot.orderRatePeriod)
+	}
 
 	if settings.Telegram.Enabled {
-		bot.telegram, err = notification.NewTelegram(bot.orderController, settings)
+		// the notification queue of telegram stops with the bot context, and /stop and /start pause the bot
+		options := append([]notification.Option{notification.WithContext(ctx), notification.WithPauser(bot)},
+			bot.telegramOptions...)
+		bot.telegram, err = notification.NewTelegram(bot.orderController, settings, options...)
 		if err != nil {
 			return nil, err
 		}
@@ -102,6 +303,14 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		WithNotifier(bot.telegram)(bot)
 	}
 
+	if settings.Slack.Enabled {
+		slack, err := notification.NewSlack(settings.Slack)
+		if err != nil {
+			return nil, err
+		}
+		WithNotifier(slack)(bot)
+	}
+
 	return bot, nil
 }
 
@@ -115,13 +324,320 @@ func WithBacktest(wallet *exchange.PaperWallet) Option {
 	}
 }
 
-// WithStorage sets the storage for the bot, by default it uses a local file called ninjabot.db
+// WithStorage sets the storage of the orders, strategy state and history of the bot, by default it uses a local
+// file called ninjabot.db. See WithoutStorage to run without a database
 func WithStorage(storage storage.Storage) Option {
 	return func(bot *NinjaBot) {
 		bot.storage = storage
 	}
 }
 
+// WithoutStorage runs the bot without a database, with storage.NoOp. The orders are kept in memory during the
+// execution, and the strategy state and the history are not persisted. The no-op storage is opt-in: without
+// WithStorage or WithoutStorage, the bot keeps persisting in the ninjabot.db file, as in previous versions
+func WithoutStorage() Option {
+	return func(bot *NinjaBot) {
+		bot.noStorage = true
+	}
+}
+
+// WithWarmupCandles sets the number of historical candles loaded per pair before the bot starts.
+// By default, it uses the strategy warmup period
+func WithWarmupCandles(n int) Option {
+	return func(bot *NinjaBot) {
+		bot.warmupCandles = n
+	}
+}
+
+// WithStorageWarmup loads the warmup candles from the storage, fetching from the exchange only the candles
+// after the last stored one. The complete candles received by the bot are saved in the storage, so the next
+// start reuses them. It reduces the API usage to start bots with many pairs or long warmup periods
+func WithStorageWarmup() Option {
+	return func(bot *NinjaBot) {
+		bot.storageWarmup = true
+	}
+}
+
+// WithTradeExcursions saves the complete candles of the strategy timeframe in the storage, also in backtests,
+// to calculate the maximum adverse and favorable excursions (MAE / MFE) of the exported trades
+func WithTradeExcursions() Option {
+	return func(bot *NinjaBot) {
+		bot.tradeExcursions = true
+	}
+}
+
+// WithPersistCandles enables or disables saving the complete candles in the storage. By default, the candles
+// are saved only for WithStorageWarmup (live only) and WithTradeExcursions. Without candles, the storage warmup
+// loads the candles from the exchange and the trades are exported without excursions
+func WithPersistCandles(enabled bool) Option {
+	return func(bot *NinjaBot) {
+		bot.persistCandles = &enabled
+	}
+}
+
+// WithCandleRetention keeps only the last n candles of each pair and timeframe in the storage, older candles
+// are removed when new ones are saved. It limits the storage growth of bots with many pairs or short timeframes
+func WithCandleRetention(n int) Option {
+	return func(bot *NinjaBot) {
+		bot.candleRetention = n
+	}
+}
+
+// WithCandleTimeMode sets the timestamp convention of the candles received by the strategy and persisted in the
+// storage: model.CandleTimeOpen, the open time of the interval used by Binance (default), or model.CandleTimeClose,
+// the close time used by some data providers. It is applied to the candles of the exchange (Binance spot and
+// futures) and of the CSV feed of backtests, the feeders of WithCandleFeed must use the same mode. The stored
+// candles of the storage warmup must be removed when the mode is changed
+func WithCandleTimeMode(mode model.CandleTimeMode) Option {
+	return func(bot *NinjaBot) {
+		bot.candleTimeMode = mode
+	}
+}
+
+// WithMaxOpenPositions limits the number of pairs with open positions, new entry orders
+// are blocked and reported to the notifier once the limit is reached
+func WithMaxOpenPositions(n int) Option {
+	return func(bot *NinjaBot) {
+		bot.maxOpenPositions = n
+	}
+}
+
+// WithMaxOpenOrders limits the number of pending orders, new entry orders are blocked
+// and reported to the notifier once the limit is reached
+func WithMaxOpenOrders(n int) Option {
+	return func(bot *NinjaBot) {
+		bot.maxOpenOrders = n
+	}
+}
+
+// WithOrderValidator registers a validator executed before any order is sent to the exchange, e.g. to block
+// orders outside trading hours or above a max value. An error blocks the order and is reported to the notifier.
+// Multiple validators are executed in the registration order
+func WithOrderValidator(validator order.Validator) Option {
+	return func(bot *NinjaBot) {
+		bot.orderValidators = append(bot.orderValidators, validator)
+	}
+}
+
+// WithOrderRate spaces the orders sent to the exchange to at most limit orders per period, e.g.
+// WithOrderRate(5, time.Second), to avoid rate limits when a strategy sends bursts of orders (e.g. a grid).
+// The orders keep the submission order and the strategy calls wait for their turn. Ignored in backtests
+func WithOrderRate(limit int, period time.Duration) Option {
+	return func(bot *NinjaBot) {
+		bot.orderRateLimit = limit
+		bot.orderRatePeriod = period
+	}
+}
+
+// WithCloseOnOppositeSignal closes the whole position when the strategy sends a market order in the opposite
+// side, e.g. a sell order with a long position, regardless of the order size
+func WithCloseOnOppositeSignal() Option {
+	return func(bot *NinjaBot) {
+		bot.closeOnOpposite = true
+	}
+}
+
+// WithReverseOnOppositeSignal closes the whole position when the strategy sends a market order in the opposite
+// side, and then opens the new side with the order size
+func WithReverseOnOppositeSignal() Option {
+	return func(bot *NinjaBot) {
+		bot.closeOnOpposite = true
+		bot.reverseOpposite = true
+	}
+}
+
+// WithFees sets the maker and taker fee rates of the exchange, e.g. WithFees(0.001, 0.001) for 0.1%.
+// They are used to calculate the breakeven price of the positions
+func WithFees(maker, taker float64) Option {
+	return func(bot *NinjaBot) {
+		bot.makerFee = maker
+		bot.takerFee = taker
+	}
+}
+
+// WithFeeSchedule overrides the fee rates of WithFees for the pairs in the schedule, e.g.
+// WithFeeSchedule(model.FeeSchedule{"BTCUSDT": {Maker: 0, Taker: 0.0004}})
+func WithFeeSchedule(schedule model.FeeSchedule) Option {
+	return func(bot *NinjaBot) {
+		bot.feeSchedule = schedule
+	}
+}
+
+// WithShrinkToFit reduces orders rejected due to insufficient funds (e.g. fee rounding) to the
+// maximum affordable quantity, instead of failing
+func WithShrinkToFit() Option {
+	return func(bot *NinjaBot) {
+		bot.shrinkToFit = true
+	}
+}
+
+// WithBaseCurrency sets the currency used to report the profit and equity of portfolios with multiple
+// quote assets, e.g. WithBaseCurrency("USDT"). Other assets are converted with the exchange prices
+func WithBaseCurrency(currency string, options ...exchange.ConverterOption) Option {
+	return func(bot *NinjaBot) {
+		bot.converter = exchange.NewConverter(bot.exchange, currency, options...)
+	}
+}
+
+// WithEquitySnapshots records the equity of the account in the storage at every complete candle, at most
+// once per interval (e.g. WithEquitySnapshots(time.Hour), or zero for every candle). The equity is given by
+// the paper wallet or by the base currency conversion in live trading, see WithBaseCurrency
+func WithEquitySnapshots(interval time.Duration) Option {
+	return func(bot *NinjaBot) {
+		bot.equitySnapshots = true
+		bot.equityInterval = interval
+	}
+}
+
+// WithBenchmarkWeights sets the weights of the pairs in the buy and hold benchmark of the summary, e.g. 0.6
+// BTCUSDT and 0.4 ETHUSDT. The pairs are equally weighted by default. See exchange.WithBenchmarkWeights for the
+// benchmark of the paper wallet stats
+func WithBenchmarkWeights(weights map[string]float64) Option {
+	return func(bot *NinjaBot) {
+		bot.benchmarkWeights = weights
+	}
+}
+
+// WithSignalDebounce suppresses repeated entry orders of a pair within the given window, unless the
+// position changed. Strategies can place intentional scale-ins with Controller().AllowScaleIn(pair)
+func WithSignalDebounce(window time.Duration) Option {
+	return func(bot *NinjaBot) {
+		bot.signalDebounce = window
+	}
+}
+
+// WithSignalConfirmation executes an entry of the strategy only when it requests the same direction in n
+// consecutive candles of the pair, filtering out the signals that do not persist. The requests of the previous
+// candles are blocked with order.ErrSignalUnconfirmed, see order.Controller.SetSignalConfirmation
+func WithSignalConfirmation(n int) Option {
+	return func(bot *NinjaBot) {
+		bot.signalConfirm = n
+	}
+}
+
+// WithMinTradeInterval rejects entry orders of a pair within the given interval since its last trade,
+// regardless of the strategy signals. Exits are not affected
+func WithMinTradeInterval(interval time.Duration) Option {
+	return func(bot *NinjaBot) {
+		bot.minTradeInterval = interval
+	}
+}
+
+// WithDailyLossLimit blocks new entry orders until the next UTC day when the realized profit of the day drops
+// to the given loss, in the quote currency (e.g. 100 for -100 USDT). Each quote currency has its own daily
+// profit. The breach is sent to the notifier and exits are not affected
+func WithDailyLossLimit(amount float64) Option {
+	return func(bot *NinjaBot) {
+		bot.dailyLossLimit = amount
+	}
+}
+
+// WithMaxTradeLoss blocks new entry orders until the next UTC day when a single trade loses the given amount,
+// in the quote currency. The breach is sent to the notifier and exits are not affected
+func WithMaxTradeLoss(amount float64) Option {
+	return func(bot *NinjaBot) {
+		bot.maxTradeLoss = amount
+	}
+}
+
+// WithMaxMarketSlippage aborts the market entries of the strategy with an estimated slippage above the given
+// basis points (e.g. 50 for 0.5%), from the order book of the exchange. Exits are never aborted, and the check is
+// skipped without order book. The aborted orders return order.ErrMaxSlippage
+func WithMaxMarketSlippage(bps float64) Option {
+	return func(bot *NinjaBot) {
+		bot.maxSlippage = bps
+	}
+}
+
+// WithMinProfitExit blocks the market and limit exits of the strategy below the breakeven price of the position
+// (see order.Controller.BreakevenPrice) plus the given basis points, e.g. 10 for 0.1%. Stop loss orders are
+// not blocked. The blocked orders return order.ErrMinProfitExit
+func WithMinProfitExit(bps float64) Option {
+	return func(bot *NinjaBot) {
+		bot.minProfitExit = bps
+	}
+}
+
+// WithMinProfitStopLoss allows the exits blocked by WithMinProfitExit once the price moves against the position
+// by the given basis points from the average entry price, e.g. 300 for 3%, so the signal exits still work as a
+// hard stop
+func WithMinProfitStopLoss(bps float64) Option {
+	return func(bot *NinjaBot) {
+		bot.minProfitStop = bps
+	}
+}
+
+// WithLookback limits the candles kept in memory for the strategy dataframes to the last n candles of each pair
+// and timeframe, see strategy.Controller.SetLookback. Default: the largest of strategy.DefaultLookback and 10
+// times the warmup period of the strategy
+func WithLookback(n int) Option {
+	return func(bot *NinjaBot) {
+		bot.lookback = n
+	}
+}
+
+// WithStartupReconciliation syncs the order controller with the exchange before the bot starts, e.g. after a
+// crash: the positions are restored from the orders of the storage, the pending orders changed while offline are
+// updated, the open orders missing in the storage created by the bot (by client order ID) are adopted and the
+// positions changed outside the bot are reported (see order.Controller.Reconcile). The discrepancies are logged
+// and, with notify, sent to the notifiers. Ignored in backtests
+func WithStartupReconciliation(notify bool) Option {
+	return func(bot *NinjaBot) {
+		bot.reconcile = true
+		bot.reconcileNotify = notify
+	}
+}
+
+// WithSignalLog records the signals of the strategy in the storage with their outcome: the market, limit and
+// OCO orders executed or blocked (e.g. by the debounce, the limits or the exchange, with the error), and the
+// signals skipped by the strategy. Strategies annotate the signals with strategy.SignalLogger, and the log is
+// queried with Signals
+func WithSignalLog() Option {
+	return func(bot *NinjaBot) {
+		bot.signalLog = true
+	}
+}
+
+// WithMetricsStart excludes from the trade metrics of the summary the trades of positions opened before the
+// given time, e.g. the initial period where the indicators are not fully formed
+func WithMetricsStart(start time.Time) Option {
+	return func(bot *NinjaBot) {
+		bot.metricsStart = start
+	}
+}
+
+// WithMetricsWarmup excludes from the trade metrics of the summary the trades of positions opened during the
+// first n candles of each pair, to measure the steady-state performance of the strategy
+func WithMetricsWarmup(candles int) Option {
+	return func(bot *NinjaBot) {
+		bot.metricsWarmup = candles
+	}
+}
+
+// WithCandleValidation validates the candles between the data feed and the strategy, dropping or
+// repairing anomalous candles. e.g. WithCandleValidation(exchange.WithMaxPriceDeviation(2))
+func WithCandleValidation(options ...exchange.CandleValidatorOption) Option {
+	return func(bot *NinjaBot) {
+		bot.dataFeed.WithValidation(options...)
+	}
+}
+
+// WithGapReconciliation fetches the candles missed by the data feed during a disconnection with CandlesByPeriod,
+// and replays them to the strategy in order before the live candles. Repeated candles are dropped
+func WithGapReconciliation() Option {
+	return func(bot *NinjaBot) {
+		bot.dataFeed.WithGapReconciliation()
+	}
+}
+
+// WithCandleFeed receives the candles of the strategy from the feeder instead of the exchange, e.g. a
+// FailoverFeed with the exchange as the primary source. The warmup candles are loaded from the exchange
+func WithCandleFeed(feeder service.Feeder) Option {
+	return func(bot *NinjaBot) {
+		bot.dataFeed.WithFeeder(feeder)
+	}
+}
+
 // WithLogLevel sets the log level. eg: log.DebugLevel, log.InfoLevel, log.WarnLevel, log.ErrorLevel, log.FatalLevel
 func WithLogLevel(level log.Level) Option {
 	return func(bot *NinjaBot) {
@@ -129,15 +645,27 @@ func WithLogLevel(level log.Level) Option {
 	}
 }
 
-// WithNotifier registers a notifier to the bot, currently only email and telegram are supported
+// WithNotifier registers a notifier to the bot, currently email, telegram and slack are supported.
+// Multiple notifiers can be registered, all of them receive the messages, orders and errors.
 func WithNotifier(notifier service.Notifier) Option {
 	return func(bot *NinjaBot) {
-		bot.notifier = notifier
-		bot.orderController.SetNotifier(notifier)
+		if bot.notifier == nil {
+			bot.notifier = notification.NewMulti()
+		}
+		bot.notifier.Add(notifier)
+		bot.orderController.SetNotifier(bot.notifier)
 		bot.SubscribeOrder(notifier)
 	}
 }
 
+// WithTelegramOptions sets the options of the Telegram controller, enabled in the settings.
+// e.g. notification.WithChart(chart) enables the `/chart` command
+func WithTelegramOptions(options ...notification.Option) Option {
+	return func(bot *NinjaBot) {
+		bot.telegramOptions = append(bot.telegramOptions, options...)
+	}
+}
+
 // WithCandleSubscription subscribes a given struct to the candle feed
 func WithCandleSubscription(subscriber CandleSubscriber) Option {
 	return func(bot *NinjaBot) {
@@ -152,7 +680,27 @@ func WithPaperWallet(wallet *exchange.PaperWallet) Option {
 	}
 }
 
+// WithShadowExecution runs the strategy with the market data of the live exchange, but routes all orders
+// to the given paper wallet. It is useful for forward tests without capital at risk
+func WithShadowExecution(wallet *exchange.PaperWallet) Option {
+	return func(bot *NinjaBot) {
+		bot.shadow = true
+		WithPaperWallet(wallet)(bot)
+	}
+}
+
+// WithPaperDepthFeed feeds the paper wallet with the order book of the source, e.g. the live exchange, with up
+// to limit levels by side, before each complete candle. It is the depth of exchange.FillModelOrderBook in paper
+// trading and shadow execution, the candles of backtests may be used with exchange.WithSynthesizedDepth
+func WithPaperDepthFeed(source exchange.DepthFetcher, limit int) Option {
+	return func(bot *NinjaBot) {
+		bot.depthSource = source
+		bot.depthLimit = limit
+	}
+}
+
 func (n *NinjaBot) SubscribeCandle(subscriptions ...CandleSubscriber) {
+	n.candleSubscribers = append(n.candleSubscribers, subscriptions...)
 	for _, pair := range n.settings.Pairs {
 		for _, subscription := range subscriptions {
 			n.dataFeed.Subscribe(pair, n.strategy.Timeframe(), subscription.OnCandle, false)
@@ -167,6 +715,7 @@ func WithOrderSubscription(subscriber OrderSubscriber) Option {
 }
 
 func (n *NinjaBot) SubscribeOrder(subscriptions ...OrderSubscriber) {
+	n.orderSubscribers = append(n.orderSubscribers, subscriptions...)
 	for _, pair := range n.settings.Pairs {
 		for _, subscription := range subscriptions {
 			n.orderFeed.Subscribe(pair, subscription.OnOrder, false)
@@ -178,122 +727,811 @@ func (n *NinjaBot) Controller() *order.Controller {
 	return n.orderController
 }
 
-// Summary function displays all trades, accuracy and some bot metrics in stdout
-// To access the raw data, you may access `bot.Controller().Results`
-func (n *NinjaBot) Summary() {
-	var (
-		total  float64
-		wins   int
-		loses  int
-		volume float64
-		sqn    float64
-	)
-
-	buffer := bytes.NewBuffer(nil)
-	table := tablewriter.NewWriter(buffer)
-	table.SetHeader([]string{"Pair", "Trades", "Win", "Loss", "% Win", "Payoff", "SQN", "Profit", "Volume"})
-	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
-	avgPayoff := 0.0
-
-	returns := make([]float64, 0)
-	for _, summary := range n.orderController.Results {
-		avgPayoff += summary.Payoff() * float64(len(summary.Win())+len(summary.Lose()))
-		table.Append([]string{
-			summary.Pair,
-			strconv.Itoa(len(summary.Win()) + len(summary.Lose())),
-			strconv.Itoa(len(summary.Win())),
-			strconv.Itoa(len(summary.Lose())),
-			fmt.Sprintf("%.1f %%", float64(len(summary.Win()))/float64(len(summary.Win())+len(summary.Lose()))*100),
-			fmt.Sprintf("%.3f", summary.Payoff()),
-			fmt.Sprintf("%.1f", summary.SQN()),
-			fmt.Sprintf("%.2f", summary.Profit()),
-			fmt.Sprintf("%.2f", summary.Volume),
-		})
-		total += summary.Profit()
-		sqn += summary.SQN()
-		wins += len(summary.Win())
-		loses += len(summary.Lose())
-		volume += summary.Volume
-
-		returns = append(returns, summary.WinPercent()...)
-		returns = append(returns, summary.LosePercent()...)
-	}
-
-	table.SetFooter([]string{
-		"TOTAL",
-		strconv.Itoa(wins + loses),
-		strconv.Itoa(wins),
-		strconv.Itoa(loses),
-		fmt.Sprintf("%.1f %%", float64(wins)/float64(wins+loses)*100),
-		fmt.Sprintf("%.3f", avgPayoff/float64(wins+loses)),
-		fmt.Sprintf("%.1f", sqn/float64(len(n.orderController.Results))),
-		fmt.Sprintf("%.2f", total),
-		fmt.Sprintf("%.2f", volume),
-	})
-	table.Render()
+// Pause stops calling the strategy and blocks new entry orders, e.g. for maintenance. The bot keeps receiving
+// candles, updating the dataframes and the pending orders, and orders that reduce a position are accepted
+func (n *NinjaBot) Pause() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
 
-	fmt.Println(buffer.String())
-	fmt.Println("------ RETURN -------")
-	totalReturn := 0.0
-	returnsPercent := make([]float64, len(returns))
-	for _, p := range returns {
-		returnsPercent = append(returnsPercent, p*100)
-		totalReturn += p
+	n.paused = true
+	n.orderController.Pause()
+	for _, controller := range n.strategiesControllers {
+		controller.Pause()
 	}
-	fmt.Printf("AVG Return: %.2f%%\n", totalReturn/float64(len(returns))*100)
-	hist := histogram.Hist(20, returnsPercent)
-	histogram.Fprint(os.Stdout, hist, histogram.Linear(10))
-	fmt.Println()
+	log.Info("[BOT] paused")
+}
 
-	if n.paperWallet != nil {
-		n.paperWallet.Summary()
+// Resume calls the strategy from the next candle and accepts new entry orders again, see Pause
+func (n *NinjaBot) Resume() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.paused = false
+	for _, controller := range n.strategiesControllers {
+		controller.Resume()
 	}
+	n.orderController.Resume()
+	log.Info("[BOT] resumed")
+}
 
+// Paused returns true if the bot is paused, see Pause
+func (n *NinjaBot) Paused() bool {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	return n.paused
 }
 
-func (n *NinjaBot) onCandle(candle model.Candle) {
-	n.priorityQueueCandle.Push(candle)
+// FlattenAll cancels the open orders and closes the positions of all pairs with market orders, e.g. as an
+// emergency exit, see order.Controller.FlattenAll. It is also available in Telegram (/panic) and in the health
+// server (see WithPanicEndpoint). The strategy keeps running, call Pause before to avoid new entries
+func (n *NinjaBot) FlattenAll() error {
+	return n.orderController.FlattenAll(n.Pairs()...)
 }
 
-func (n *NinjaBot) processCandle(candle model.Candle) {
-	if n.paperWallet != nil {
-		n.paperWallet.OnCandle(candle)
-	}
+// PairSummary are the metrics of the closed trades of a pair, or of all pairs in the summary total
+type PairSummary struct {
+	Pair   string `json:"pair"`
+	Trades int    `json:"trades"`
+	Win    int    `json:"win"`
+	Loss   int    `json:"loss"`
+	// WinRate is the fraction of profitable trades, e.g. 0.6 for 60%
+	WinRate float64 `json:"win_rate"`
+	Payoff  Metric  `json:"payoff"`
+	SQN     Metric  `json:"sqn"`
+	Profit  float64 `json:"profit"`
+	Volume  float64 `json:"volume"`
+}
 
-	n.strategiesControllers[candle.Pair].OnPartialCandle(candle)
-	if candle.Complete {
-		n.strategiesControllers[candle.Pair].OnCandle(candle)
-		n.orderController.OnCandle(candle)
-	}
+// BenchmarkSummary compares the strategy with buying and holding the pairs from the first to the last candle
+// processed by the bot, see WithBenchmarkWeights
+type BenchmarkSummary struct {
+	// Pairs are the buy and hold returns of each pair, e.g. 0.1 for 10%
+	Pairs map[string]float64 `json:"pairs"`
+	// Weights are the normalized weights of the pairs in the basket
+	Weights map[string]float64 `json:"weights"`
+	// Return is the weighted average of the pairs returns
+	Return float64 `json:"return"`
+	// StrategyReturn is the return of the paper wallet or, in live trading with WithBaseCurrency, the return of
+	// the equity since the start of the bot. It is undefined otherwise
+	StrategyReturn Metric `json:"strategy_return"`
+	// Alpha is the strategy return minus the benchmark return, positive when the strategy beat the benchmark
+	Alpha Metric `json:"alpha"`
+}
+
+// EquitySummary are the metrics of the equity snapshots, see WithEquitySnapshots
+type EquitySummary struct {
+	Snapshots int `json:"snapshots"`
+	// MaxDrawdown is the largest decline of the equity, as a negative percentage (e.g. -0.2 for 20%)
+	MaxDrawdown Metric `json:"max_drawdown"`
+	Sharpe      Metric `json:"sharpe"`
+}
+
+// Summary are the bot metrics of the summary, the same data in all formats of SummaryTo
+type Summary struct {
+	Pairs []PairSummary `json:"pairs"`
+	Total PairSummary   `json:"total"`
+	// Returns are the returns of the closed trades, e.g. 0.1 for 10%
+	Returns   []float64 `json:"returns"`
+	AvgReturn float64   `json:"avg_return"`
+	// BaseCurrency, Profit and Equity are defined with WithBaseCurrency, in the base currency. They are undefined
+	// when an asset can not be converted, see Errors
+	BaseCurrency string `json:"base_currency,omitempty"`
+	Profit       Metric `json:"profit,omitempty"`
+	Equity       Metric `json:"equity,omitempty"`
+	// EquityCurve is defined with WithEquitySnapshots
+	EquityCurve *EquitySummary `json:"equity_curve,omitempty"`
+	// Wallet is defined in backtests and paper trading
+	Wallet *exchange.WalletStats `json:"wallet,omitempty"`
+	// Benchmark is the buy and hold of the pairs in the same period, nil without candles
+	Benchmark *BenchmarkSummary `json:"benchmark,omitempty"`
+	// Venues is the account breakdown of exchanges with multiple venues, e.g. exchange.MultiVenue
+	Venues []VenueSummary `json:"venues,omitempty"`
+	// Errors are the failures of the metrics above, e.g. the equity without the price of an asset
+	Errors []string `json:"errors,omitempty"`
+}
+
+// VenueSummary is the account of a venue, the equity is defined with WithBaseCurrency
+type VenueSummary struct {
+	Name     string          `json:"name"`
+	Equity   Metric          `json:"equity,omitempty"`
+	Balances []model.Balance `json:"balances"`
 }
 
-// Process pending candles in buffer
-func (n *NinjaBot) processCandles() {
-	for item := range n.priorityQueueCandle.PopLock() {
-		n.processCandle(item.(model.Candle))
+// Summary function displays all trades, accuracy and some bot metrics in stdout
+// To access the raw data, you may access `bot.Controller().Results` or `bot.SummaryData()`
+func (n *NinjaBot) Summary() {
+	if err := n.SummaryTo(os.Stdout, ExportFormatTable); err != nil {
+		log.Warnf("summary: %v", err)
 	}
 }
 
-// Start the backtest process and create a progress bar
-// backtestCandles will process candles from a prirority queue in chronological order
-func (n *NinjaBot) backtestCandles() {
-	log.Info("[SETUP] Starting backtesting")
+// SummaryData returns the metrics of the summary, the closed trades by pair and the bot performance
+func (n *NinjaBot) SummaryData() Summary {
+	var (
+		summary     Summary
+		avgPayoff   float64
+		sqn         float64
+		tradedPairs int
+	)
 
-	progressBar := progressbar.Default(int64(n.priorityQueueCandle.Len()))
-	for n.priorityQueueCandle.Len() > 0 {
-		item := n.priorityQueueCandle.Pop()
+	pairs := make([]string, 0, len(n.orderController.Results))
+	for pair := range n.orderController.Results {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
 
-		candle := item.(model.Candle)
-		if n.paperWallet != nil {
-			n.paperWallet.OnCandle(candle)
+	summary.Total.Pair = "TOTAL"
+	summary.Returns = make([]float64, 0)
+	for _, pair := range pairs {
+		result := n.orderController.Results[pair]
+		pairSummary := PairSummary{
+			Pair:   result.Pair,
+			Win:    len(result.Win()),
+			Loss:   len(result.Lose()),
+			Payoff: payoff(result.Win(), result.Lose(), result.Payoff()),
+			SQN:    Metric(result.SQN()),
+			Profit: result.Profit(),
+			Volume: result.Volume,
 		}
+		pairSummary.Trades = pairSummary.Win + pairSummary.Loss
+		pairSummary.WinRate = ratio(float64(pairSummary.Win), float64(pairSummary.Trades))
+		summary.Pairs = append(summary.Pairs, pairSummary)
 
-		n.strategiesControllers[candle.Pair].OnPartialCandle(candle)
-		if candle.Complete {
-			n.strategiesControllers[candle.Pair].OnCandle(candle)
+		if pairSummary.Trades > 0 {
+			tradedPairs++
+			avgPayoff += float64(pairSummary.Payoff) * float64(pairSummary.Trades)
+			sqn += float64(pairSummary.SQN)
 		}
+		summary.Total.Trades += pairSummary.Trades
+		summary.Total.Win += pairSummary.Win
+		summary.Total.Loss += pairSummary.Loss
+		summary.Total.Profit += pairSummary.Profit
+		summary.Total.Volume += pairSummary.Volume
 
-		if err := progressBar.Add(1); err != nil {
+		summary.Returns = append(summary.Returns, result.WinPercent()...)
+		summary.Returns = append(summary.Returns, result.LosePercent()...)
+
+		if n.converter != nil {
+			_, quote := exchange.SplitAssetQuote(result.Pair)
+			profit, err := n.converter.Convert(context.Background(), quote, result.Profit())
+			if err != nil {
+				summary.fail(fmt.Errorf("profit: %w", err))
+				profit = math.NaN()
+			}
+			summary.Profit += Metric(profit)
+		}
+	}
+
+	summary.Total.WinRate = ratio(float64(summary.Total.Win), float64(summary.Total.Trades))
+	summary.Total.Payoff = Metric(avgPayoff / float64(summary.Total.Trades))
+	summary.Total.SQN = Metric(sqn / float64(tradedPairs))
+
+	var totalReturn float64
+	for _, value := range summary.Returns {
+		totalReturn += value
+	}
+	summary.AvgReturn = ratio(totalReturn, float64(len(summary.Returns)))
+
+	if n.converter != nil {
+		summary.BaseCurrency = n.converter.Base()
+		equity, err := n.Equity(context.Background())
+		if err != nil {
+			summary.fail(fmt.Errorf("equity: %w", err))
+			equity = math.NaN()
+		}
+		summary.Equity = Metric(equity)
+	}
+
+	if n.equitySnapshots {
+		curve, err := n.EquityCurve(time.Time{}, time.Time{})
+		if err != nil {
+			summary.fail(fmt.Errorf("equity curve: %w", err))
+		} else {
+			maxDrawdown, _, _ := curve.MaxDrawdown()
+			summary.EquityCurve = &EquitySummary{
+				Snapshots:   len(curve),
+				MaxDrawdown: Metric(maxDrawdown),
+				Sharpe:      Metric(curve.SharpeRatio(curve.PeriodsPerYear())),
+			}
+		}
+	}
+
+	if n.paperWallet != nil {
+		stats := n.paperWallet.Stats()
+		summary.Wallet = &stats
+	}
+	summary.Benchmark = n.benchmarkSummary(summary)
+
+	if fetcher, ok := n.exchange.(exchange.VenueAccountsFetcher); ok {
+		accounts, err := fetcher.VenueAccounts()
+		if err != nil {
+			summary.fail(fmt.Errorf("venues: %w", err))
+		}
+
+		for _, account := range accounts {
+			venue := VenueSummary{Name: account.Name, Balances: account.Account.Balances}
+			if n.converter != nil {
+				equity, err := n.converter.Equity(context.Background(), account.Account)
+				if err != nil {
+					summary.fail(fmt.Errorf("%s equity: %w", account.Name, err))
+					equity = math.NaN()
+				}
+				venue.Equity = Metric(equity)
+			}
+			summary.Venues = append(summary.Venues, venue)
+		}
+	}
+
+	return summary
+}
+
+// SummaryTo writes the summary in the given format: the table of Summary, a JSON object with all metrics or
+// the CSV records of the pairs and the total, e.g. to compare runs in other tools
+func (n *NinjaBot) SummaryTo(w io.Writer, format ExportFormat) error {
+	summary := n.SummaryData()
+
+	switch format {
+	case ExportFormatTable:
+		return n.writeSummaryTable(w, summary)
+	case ExportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summary)
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"pair", "trades", "win", "loss", "win_rate", "payoff", "sqn", "profit",
+			"volume", "benchmark", "alpha"})
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range append(summary.Pairs, summary.Total) {
+			benchmark, alpha := summary.benchmarkRecord(pair.Pair)
+			err := writer.Write([]string{
+				pair.Pair,
+				strconv.Itoa(pair.Trades),
+				strconv.Itoa(pair.Win),
+				strconv.Itoa(pair.Loss),
+				strconv.FormatFloat(pair.WinRate, 'f', -1, 64),
+				pair.Payoff.Format(-1),
+				pair.SQN.Format(-1),
+				strconv.FormatFloat(pair.Profit, 'f', -1, 64),
+				strconv.FormatFloat(pair.Volume, 'f', -1, 64),
+				benchmark,
+				alpha,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("invalid summary format: %s", format)
+	}
+}
+
+func (n *NinjaBot) writeSummaryTable(w io.Writer, summary Summary) error {
+	row := func(pair PairSummary) []string {
+		return []string{
+			pair.Pair,
+			strconv.Itoa(pair.Trades),
+			strconv.Itoa(pair.Win),
+			strconv.Itoa(pair.Loss),
+			fmt.Sprintf("%.1f %%", pair.WinRate*100),
+			pair.Payoff.Format(3),
+			pair.SQN.Format(1),
+			fmt.Sprintf("%.2f", pair.Profit),
+			fmt.Sprintf("%.2f", pair.Volume),
+		}
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	table.SetHeader([]string{"Pair", "Trades", "Win", "Loss", "% Win", "Payoff", "SQN", "Profit", "Volume"})
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	for _, pair := range summary.Pairs {
+		table.Append(row(pair))
+	}
+	table.SetFooter(row(summary.Total))
+	table.Render()
+
+	fmt.Fprintln(w, buffer.String())
+	if summary.BaseCurrency != "" {
+		fmt.Fprintf(w, "PROFIT = %s %s\n", summary.Profit.Format(2), summary.BaseCurrency)
+		fmt.Fprintf(w, "EQUITY = %s %s\n", summary.Equity.Format(2), summary.BaseCurrency)
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "------ RETURN -------")
+	returnsPercent := make([]float64, 0, len(summary.Returns))
+	for _, p := range summary.Returns {
+		returnsPercent = append(returnsPercent, p*100)
+	}
+	fmt.Fprintf(w, "AVG Return: %.2f%%\n", summary.AvgReturn*100)
+	hist := histogram.Hist(20, returnsPercent)
+	if err := histogram.Fprint(w, hist, histogram.Linear(10)); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+
+	if summary.EquityCurve != nil {
+		fmt.Fprintln(w, "--- EQUITY CURVE ----")
+		fmt.Fprintf(w, "SNAPSHOTS    = %d\n", summary.EquityCurve.Snapshots)
+		fmt.Fprintf(w, "MAX DRAWDOWN = %s %%\n", (summary.EquityCurve.MaxDrawdown * 100).Format(2))
+		fmt.Fprintf(w, "SHARPE RATIO = %s\n", summary.EquityCurve.Sharpe.Format(2))
+		fmt.Fprintln(w)
+	}
+
+	// the paper wallet summary has its own benchmark
+	if summary.Benchmark != nil && n.paperWallet == nil {
+		fmt.Fprintln(w, "----- BENCHMARK -----")
+		pairs := make([]string, 0, len(summary.Benchmark.Pairs))
+		for pair := range summary.Benchmark.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Strings(pairs)
+		for _, pair := range pairs {
+			fmt.Fprintf(w, "%s (B&H) = %.2f %% (weight %.2f)\n", pair, summary.Benchmark.Pairs[pair]*100,
+				summary.Benchmark.Weights[pair])
+		}
+		fmt.Fprintf(w, "BENCHMARK RETURN = %.2f %%\n", summary.Benchmark.Return*100)
+		fmt.Fprintf(w, "STRATEGY RETURN  = %s %%\n", (summary.Benchmark.StrategyReturn * 100).Format(2))
+		fmt.Fprintf(w, "ALPHA            = %s %%\n", (summary.Benchmark.Alpha * 100).Format(2))
+		fmt.Fprintln(w)
+	}
+
+	if len(summary.Venues) > 0 {
+		fmt.Fprintln(w, "------ VENUES -------")
+		for _, venue := range summary.Venues {
+			if summary.BaseCurrency != "" {
+				fmt.Fprintf(w, "%s EQUITY = %s %s\n", strings.ToUpper(venue.Name), venue.Equity.Format(2),
+					summary.BaseCurrency)
+			} else {
+				fmt.Fprintf(w, "%s\n", strings.ToUpper(venue.Name))
+			}
+			for _, balance := range venue.Balances {
+				if balance.Free+balance.Lock == 0 {
+					continue
+				}
+				fmt.Fprintf(w, "  %s = %.4f\n", balance.Asset, balance.Free+balance.Lock)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(summary.Errors) > 0 {
+		fmt.Fprintln(w, "------ ERRORS -------")
+		for _, err := range summary.Errors {
+			fmt.Fprintln(w, err)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if n.paperWallet != nil {
+		n.paperWallet.SummaryTo(w)
+	}
+	return nil
+}
+
+// ratio returns the division of the values, or zero without a divisor
+func ratio(value, divisor float64) float64 {
+	if divisor == 0 {
+		return 0
+	}
+	return value / divisor
+}
+
+// benchmarkRecord returns the buy and hold return and the alpha of the CSV record of a pair, or of the basket
+// for the total. The fields are empty without the benchmark, and the alpha is only defined for the total
+func (s Summary) benchmarkRecord(pair string) (string, string) {
+	if s.Benchmark == nil {
+		return "", ""
+	}
+
+	if pair == s.Total.Pair {
+		return strconv.FormatFloat(s.Benchmark.Return, 'f', -1, 64), s.Benchmark.Alpha.Format(-1)
+	}
+
+	change, ok := s.Benchmark.Pairs[pair]
+	if !ok {
+		return "", ""
+	}
+	return strconv.FormatFloat(change, 'f', -1, 64), ""
+}
+
+// fail records the error of a metric in the summary
+func (s *Summary) fail(err error) {
+	log.Warnf("summary: %v", err)
+	s.Errors = append(s.Errors, err.Error())
+}
+
+// Metric is a value of the summary that may be undefined, e.g. the SQN without trades, or infinite, e.g. the
+// payoff without losing trades. The undefined values are written as "n/a" and the infinite as "inf"
+type Metric float64
+
+// Format returns the metric with the given decimal places, or -1 for the shortest representation
+func (m Metric) Format(precision int) string {
+	switch {
+	case math.IsNaN(float64(m)):
+		return "n/a"
+	case math.IsInf(float64(m), 1):
+		return "inf"
+	case math.IsInf(float64(m), -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(float64(m), 'f', precision, 64)
+}
+
+// MarshalJSON encodes the defined metrics as numbers, and the others as the strings of Format
+func (m Metric) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(m)) || math.IsInf(float64(m), 0) {
+		return json.Marshal(m.Format(-1))
+	}
+	return json.Marshal(float64(m))
+}
+
+// UnmarshalJSON decodes the metrics of MarshalJSON
+func (m *Metric) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return json.Unmarshal(data, (*float64)(m))
+	}
+
+	switch value {
+	case "n/a":
+		*m = Metric(math.NaN())
+	case "inf":
+		*m = Metric(math.Inf(1))
+	case "-inf":
+		*m = Metric(math.Inf(-1))
+	default:
+		return fmt.Errorf("invalid metric: %q", value)
+	}
+	return nil
+}
+
+// payoff returns the payoff of the trades, infinite without losing trades and undefined without trades
+func payoff(win, lose []float64, value float64) Metric {
+	switch {
+	case len(win)+len(lose) == 0:
+		return Metric(math.NaN())
+	case len(lose) == 0:
+		return Metric(math.Inf(1))
+	}
+	return Metric(value)
+}
+
+// countMetricsCandle counts the candles of the metrics warm up, the trades are included from the first candle
+// after the warm up of the pair, see WithMetricsWarmup
+func (n *NinjaBot) countMetricsCandle(candle model.Candle) {
+	if n.metricsWarmup == 0 {
+		return
+	}
+
+	n.metricsMtx.Lock()
+	defer n.metricsMtx.Unlock()
+
+	n.metricsCandles[candle.Pair]++
+	if n.metricsCandles[candle.Pair] == n.metricsWarmup+1 {
+		n.metricsPairs[candle.Pair] = candle.Time
+	}
+}
+
+// inMetrics returns true if a trade of the pair at the given time is included in the metrics
+func (n *NinjaBot) inMetrics(pair string, t time.Time) bool {
+	if t.Before(n.metricsStart) {
+		return false
+	}
+
+	if n.metricsWarmup == 0 {
+		return true
+	}
+
+	n.metricsMtx.Lock()
+	defer n.metricsMtx.Unlock()
+
+	start, ok := n.metricsPairs[pair]
+	return ok && !t.Before(start)
+}
+
+// Equity returns the total value of the account in the base currency, see WithBaseCurrency
+func (n *NinjaBot) Equity(ctx context.Context) (float64, error) {
+	if n.converter == nil {
+		return 0, errors.New("base currency not defined")
+	}
+
+	account, err := n.orderController.Account()
+	if err != nil {
+		return 0, err
+	}
+	return n.converter.Equity(ctx, account)
+}
+
+// trackBenchmark records the first and last close of the pair for the benchmark of the summary
+func (n *NinjaBot) trackBenchmark(candle model.Candle) {
+	if candle.Close <= 0 {
+		return
+	}
+
+	n.benchmarkMtx.Lock()
+	defer n.benchmarkMtx.Unlock()
+
+	if n.benchmarkFirst == nil {
+		n.benchmarkFirst = make(map[string]float64)
+		n.benchmarkLast = make(map[string]float64)
+	}
+	if _, ok := n.benchmarkFirst[candle.Pair]; !ok {
+		n.benchmarkFirst[candle.Pair] = candle.Close
+	}
+	n.benchmarkLast[candle.Pair] = candle.Close
+}
+
+// recordStartEquity records the equity at the start of a live run, the base of the strategy return in the
+// benchmark of the summary. The paper wallet has its own return
+func (n *NinjaBot) recordStartEquity(ctx context.Context) {
+	if n.converter == nil || n.paperWallet != nil {
+		return
+	}
+
+	equity, err := n.Equity(ctx)
+	if err != nil {
+		log.Warnf("start equity: %v", err)
+		return
+	}
+
+	n.benchmarkMtx.Lock()
+	n.startEquity = equity
+	n.benchmarkMtx.Unlock()
+}
+
+// benchmarkSummary returns the buy and hold of the pairs processed by the bot and the alpha of the strategy
+func (n *NinjaBot) benchmarkSummary(summary Summary) *BenchmarkSummary {
+	n.benchmarkMtx.Lock()
+	changes := make(map[string]float64, len(n.benchmarkFirst))
+	for pair, first := range n.benchmarkFirst {
+		changes[pair] = (n.benchmarkLast[pair] - first) / first
+	}
+	startEquity := n.startEquity
+	n.benchmarkMtx.Unlock()
+
+	strategyReturn := math.NaN()
+	switch {
+	case summary.Wallet != nil:
+		strategyReturn = summary.Wallet.Return
+	case summary.BaseCurrency != "" && startEquity > 0:
+		strategyReturn = (float64(summary.Equity) - startEquity) / startEquity
+	}
+
+	stats := exchange.NewBenchmarkStats(changes, n.benchmarkWeights, strategyReturn)
+	if stats == nil {
+		return nil
+	}
+
+	return &BenchmarkSummary{
+		Pairs:          stats.Pairs,
+		Weights:        stats.Weights,
+		Return:         stats.Return,
+		StrategyReturn: Metric(strategyReturn),
+		Alpha:          Metric(stats.Alpha),
+	}
+}
+
+// EquityCurve returns the equity snapshots recorded between start and end, see WithEquitySnapshots
+func (n *NinjaBot) EquityCurve(start, end time.Time) (model.EquityCurve, error) {
+	return n.storage.EquitySnapshots(start, end)
+}
+
+// recordEquity saves a snapshot of the equity, at most once per snapshot interval
+func (n *NinjaBot) recordEquity(t time.Time) {
+	if !n.equitySnapshots || !t.After(n.lastEquitySnapshot) || t.Before(n.lastEquitySnapshot.Add(n.equityInterval)) {
+		return
+	}
+
+	var equity float64
+	if n.paperWallet != nil {
+		equity = n.paperWallet.Equity()
+	} else {
+		var err error
+		equity, err = n.Equity(context.Background())
+		if err != nil {
+			log.Warnf("equity snapshot: %v", err)
+			return
+		}
+	}
+
+	err := n.storage.CreateEquitySnapshot(&model.EquitySnapshot{Time: t, Equity: equity})
+	if err != nil {
+		log.Warnf("equity snapshot: %v", err)
+		return
+	}
+	n.lastEquitySnapshot = t
+}
+
+type ExportFormat string
+
+const (
+	ExportFormatCSV  ExportFormat = "csv"
+	ExportFormatJSON ExportFormat = "json"
+	// ExportFormatTable is the human readable table of Summary, only supported by SummaryTo
+	ExportFormatTable ExportFormat = "table"
+)
+
+// Signals returns the signals of the signal log between start and end (inclusive) sorted by time, zero values
+// of start or end are not limited, see WithSignalLog
+func (n *NinjaBot) Signals(start, end time.Time) ([]model.Signal, error) {
+	return n.storage.Signals(start, end)
+}
+
+// Trades returns the closed trades found in the storage, entries are paired with exits in FIFO order and
+// partial closes are split proportionally. The MAE and MFE are calculated with WithTradeExcursions
+func (n *NinjaBot) Trades() ([]order.Trade, error) {
+	orders, err := n.storage.Orders(storage.WithStatus(model.OrderStatusTypeFilled))
+	if err != nil {
+		return nil, err
+	}
+
+	trades := order.Trades(orders)
+	if !n.tradeExcursions {
+		return trades, nil
+	}
+
+	for i := range trades {
+		candles, err := n.storage.Candles(trades[i].Pair, n.strategy.Timeframe(), trades[i].EntryTime,
+			trades[i].ExitTime)
+		if err != nil {
+			return nil, err
+		}
+		trades[i].SetExcursions(candles)
+	}
+
+	return trades, nil
+}
+
+// ExportTrades writes every closed trade found in the storage as CSV or JSON records, see Trades
+func (n *NinjaBot) ExportTrades(w io.Writer, format ExportFormat) error {
+	trades, err := n.Trades()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(trades)
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		err := writer.Write([]string{"pair", "side", "entry_time", "exit_time", "entry_price", "exit_price",
+			"quantity", "fee", "profit", "profit_percent", "mae", "mfe"})
+		if err != nil {
+			return err
+		}
+
+		for _, trade := range trades {
+			err := writer.Write([]string{
+				trade.Pair,
+				string(trade.Side),
+				trade.EntryTime.UTC().Format(time.RFC3339),
+				trade.ExitTime.UTC().Format(time.RFC3339),
+				strconv.FormatFloat(trade.EntryPrice, 'f', -1, 64),
+				strconv.FormatFloat(trade.ExitPrice, 'f', -1, 64),
+				strconv.FormatFloat(trade.Quantity, 'f', -1, 64),
+				strconv.FormatFloat(trade.Fee, 'f', -1, 64),
+				strconv.FormatFloat(trade.Profit, 'f', -1, 64),
+				strconv.FormatFloat(trade.ProfitPercent, 'f', -1, 64),
+				strconv.FormatFloat(trade.MAE, 'f', -1, 64),
+				strconv.FormatFloat(trade.MFE, 'f', -1, 64),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("invalid export format: %s", format)
+	}
+}
+
+func (n *NinjaBot) onCandle(candle model.Candle) {
+	if n.health != nil {
+		n.health.onCandle()
+	}
+	n.storeCandle(n.strategy.Timeframe(), candle)
+	n.priorityQueueCandle.Push(candle)
+}
+
+// strategyController returns the strategy controller of a pair, or false if the pair is not subscribed
+func (n *NinjaBot) strategyController(pair string) (*strategy.Controller, bool) {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+
+	controller, ok := n.strategiesControllers[pair]
+	return controller, ok
+}
+
+func (n *NinjaBot) processCandle(candle model.Candle) {
+	if n.paperWallet != nil {
+		if candle.Complete {
+			n.feedDepth(candle.Pair)
+		}
+		n.paperWallet.OnCandle(candle)
+	}
+
+	// candles of removed pairs may still be in the queue
+	controller, ok := n.strategyController(candle.Pair)
+	if !ok {
+		return
+	}
+
+	controller.OnPartialCandle(candle)
+	if candle.Complete {
+		n.countMetricsCandle(candle)
+		n.trackBenchmark(candle)
+		n.exportCandle(candle)
+		controller.OnCandle(candle)
+		n.orderController.OnCandle(candle)
+		n.recordEquity(candle.Time)
+	}
+}
+
+// feedDepth updates the order book of the paper wallet with the depth source, see WithPaperDepthFeed
+func (n *NinjaBot) feedDepth(pair string) {
+	if n.depthSource == nil {
+		return
+	}
+
+	depth, err := n.depthSource.Depth(pair, n.depthLimit)
+	if err != nil {
+		log.Warnf("depth feed %s: %v", pair, err)
+		return
+	}
+	n.paperWallet.OnDepth(depth)
+}
+
+// processCandles processes the candles of the live data feed until the context is canceled
+func (n *NinjaBot) processCandles(ctx context.Context) {
+	candles := n.priorityQueueCandle.PopLock()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-candles:
+			n.processCandle(item.(model.Candle))
+		}
+	}
+}
+
+// Start the backtest process and create a progress bar
+// backtestCandles will process candles from a prirority queue in chronological order
+func (n *NinjaBot) backtestCandles() {
+	log.Info("[SETUP] Starting backtesting")
+
+	progressBar := progressbar.Default(int64(n.priorityQueueCandle.Len()))
+	for n.priorityQueueCandle.Len() > 0 {
+		item := n.priorityQueueCandle.Pop()
+
+		candle := item.(model.Candle)
+		if n.paperWallet != nil {
+			n.paperWallet.OnCandle(candle)
+		}
+
+		if controller, ok := n.strategyController(candle.Pair); ok {
+			controller.OnPartialCandle(candle)
+			if candle.Complete {
+				n.countMetricsCandle(candle)
+				n.trackBenchmark(candle)
+				n.exportCandle(candle)
+				controller.OnCandle(candle)
+				n.orderController.OnCandle(candle)
+				n.recordEquity(candle.Time)
+			}
+		}
+
+		if err := progressBar.Add(1); err != nil {
 			log.Warnf("update progressbar fail: %v", err)
 		}
 	}
@@ -306,7 +1544,33 @@ func (n *NinjaBot) preload(ctx context.Context, pair string) error {
 		return nil
 	}
 
-	candles, err := n.exchange.CandlesByLimit(ctx, pair, n.strategy.Timeframe(), n.strategy.WarmupPeriod())
+	controller, ok := n.strategyController(pair)
+	if !ok {
+		return fmt.Errorf("pair not subscribed: %s", pair)
+	}
+
+	limit := n.strategy.WarmupPeriod()
+	if n.warmupCandles > 0 {
+		limit = n.warmupCandles
+	}
+
+	// additional timeframes are loaded first, to be aligned with the candles of the strategy timeframe
+	if str, ok := n.strategy.(strategy.MultiTimeframeStrategy); ok {
+		for _, timeframe := range str.Timeframes() {
+			candles, err := n.warmup(ctx, pair, timeframe, limit)
+			if err != nil {
+				return err
+			}
+
+			for _, candle := range candles {
+				controller.OnTimeframeCandle(timeframe, candle)
+			}
+
+			n.dataFeed.Preload(pair, timeframe, candles)
+		}
+	}
+
+	candles, err := n.warmup(ctx, pair, n.strategy.Timeframe(), limit)
 	if err != nil {
 		return err
 	}
@@ -320,27 +1584,293 @@ func (n *NinjaBot) preload(ctx context.Context, pair string) error {
 	return nil
 }
 
-// Run will initialize the strategy controller, order controller, preload data and start the bot
+// warmup returns the last complete candles of a pair and timeframe. With storage warmup, the stored candles are
+// completed with the recent candles from the exchange, which are persisted for the next start. The exchange
+// is used for the whole period when the stored candles are not enough or are not contiguous
+func (n *NinjaBot) warmup(ctx context.Context, pair, timeframe string, limit int) ([]model.Candle, error) {
+	if !n.storageWarmup {
+		return n.exchange.CandlesByLimit(ctx, pair, timeframe, limit)
+	}
+
+	// timeframes without a fixed duration (e.g. 1M) are always loaded from the exchange
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return n.exchange.CandlesByLimit(ctx, pair, timeframe, limit)
+	}
+
+	now := time.Now()
+	stored, err := n.storage.Candles(pair, timeframe, now.Add(-time.Duration(limit+1)*interval), time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("storage warmup: %w", err)
+	}
+
+	// only the most recent contiguous candles are used, a gap is filled with the exchange candles
+	for i := len(stored) - 1; i > 0; i-- {
+		if stored[i].Time.Sub(stored[i-1].Time) != interval {
+			stored = stored[i:]
+			break
+		}
+	}
+
+	// the candle after the last stored one is complete when the next one opens
+	missing := limit
+	if len(stored) > 0 {
+		last := n.candleTimeMode.OpenTime(stored[len(stored)-1].Time, interval)
+		missing = int(now.Sub(last)/interval) - 1
+	}
+
+	candles := stored
+	if len(stored) == 0 || missing < 0 || len(stored)+missing < limit {
+		log.Infof("[SETUP] %s %s: %d candles in storage, loading %d from exchange", pair, timeframe,
+			len(stored), limit)
+		candles, err = n.exchange.CandlesByLimit(ctx, pair, timeframe, limit)
+		if err != nil {
+			return nil, err
+		}
+		n.storeCandle(timeframe, candles...)
+	} else if missing > 0 {
+		tail, err := n.exchange.CandlesByLimit(ctx, pair, timeframe, missing)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tail) > 0 && tail[0].Time.Sub(stored[len(stored)-1].Time) > interval {
+			log.Warnf("[SETUP] %s %s: gap between stored and exchange candles, loading %d from exchange",
+				pair, timeframe, limit)
+			return n.exchange.CandlesByLimit(ctx, pair, timeframe, limit)
+		}
+
+		candles = make([]model.Candle, 0, len(stored)+len(tail))
+		for _, candle := range stored {
+			if len(tail) == 0 || candle.Time.Before(tail[0].Time) {
+				candles = append(candles, candle)
+			}
+		}
+		candles = append(candles, tail...)
+		n.storeCandle(timeframe, tail...)
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles, nil
+}
+
+// storeCandle persists the complete candles, see WithPersistCandles
+func (n *NinjaBot) storeCandle(timeframe string, candles ...model.Candle) {
+	enabled := n.tradeExcursions || (n.storageWarmup && !n.backtest)
+	if n.persistCandles != nil {
+		enabled = *n.persistCandles
+	}
+
+	if !enabled {
+		return
+	}
+
+	complete := make([]model.Candle, 0, len(candles))
+	for _, candle := range candles {
+		if candle.Complete {
+			complete = append(complete, candle)
+		}
+	}
+
+	if len(complete) == 0 {
+		return
+	}
+
+	if err := n.storage.CreateCandles(timeframe, complete...); err != nil {
+		log.Errorf("[STORAGE] save %s candles: %v", timeframe, err)
+		return
+	}
+
+	if n.candleRetention <= 0 {
+		return
+	}
+
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return
+	}
+
+	last := make(map[string]time.Time)
+	for _, candle := range complete {
+		if candle.Time.After(last[candle.Pair]) {
+			last[candle.Pair] = candle.Time
+		}
+	}
+
+	for pair, t := range last {
+		before := t.Add(-time.Duration(n.candleRetention-1) * interval)
+		if err := n.storage.DeleteCandles(pair, timeframe, before); err != nil {
+			log.Errorf("[STORAGE] remove %s %s candles: %v", pair, timeframe, err)
+		}
+	}
+}
+
+// setupPair creates the strategy controller of a pair, preloads the warmup candles and subscribes it
+// to the data feed
+func (n *NinjaBot) setupPair(ctx context.Context, pair string) error {
+	// setup and subscribe strategy to data feed (candles)
+	controller := strategy.NewStrategyController(pair, n.strategy, n.orderController.StrategyBroker())
+	controller.SetLookback(n.lookback)
+	controller.SetCandleTimeMode(n.candleTimeMode)
+	n.mtx.Lock()
+	if n.paused {
+		controller.Pause()
+	}
+	n.strategiesControllers[pair] = controller
+	n.mtx.Unlock()
+
+	// preload candles for warmup period
+	err := n.preload(ctx, pair)
+	if err != nil {
+		n.mtx.Lock()
+		delete(n.strategiesControllers, pair)
+		n.mtx.Unlock()
+		return err
+	}
+
+	// link to ninja bot controller
+	n.dataFeed.Subscribe(pair, n.strategy.Timeframe(), n.onCandle, false)
+
+	// additional timeframes are sent directly to the strategy controller, where they wait for
+	// the candle of the strategy timeframe with the same close time
+	if str, ok := n.strategy.(strategy.MultiTimeframeStrategy); ok {
+		for _, timeframe := range str.Timeframes() {
+			timeframe := timeframe
+			n.dataFeed.Subscribe(pair, timeframe, func(candle model.Candle) {
+				n.storeCandle(timeframe, candle)
+				controller.OnTimeframeCandle(timeframe, candle)
+			}, true)
+		}
+	}
+
+	// start strategy controller
+	controller.Start()
+	return nil
+}
+
+// Pairs returns the pairs currently traded by the bot
+func (n *NinjaBot) Pairs() []string {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+
+	return append([]string(nil), n.settings.Pairs...)
+}
+
+// Subscribe adds a pair to the bot at runtime, e.g. for strategies that rotate the traded universe. The candles
+// of the warmup period are preloaded, the strategy starts to receive the candles of the pair and the candle
+// and order subscribers are registered. Pairs can't be added to a running backtest
+func (n *NinjaBot) Subscribe(ctx context.Context, pair string) error {
+	asset, quote := exchange.SplitAssetQuote(pair)
+	if asset == "" || quote == "" {
+		return fmt.Errorf("invalid pair: %s", pair)
+	}
+
+	n.mtx.Lock()
+	for _, current := range n.settings.Pairs {
+		if current == pair {
+			n.mtx.Unlock()
+			return nil
+		}
+	}
+
+	if n.running && n.backtest {
+		n.mtx.Unlock()
+		return errors.New("pairs can't be added to a running backtest")
+	}
+
+	n.settings.Pairs = append(n.settings.Pairs, pair)
+	running := n.running
+	n.mtx.Unlock()
+
+	for _, subscriber := range n.orderSubscribers {
+		n.orderFeed.Subscribe(pair, subscriber.OnOrder, false)
+	}
+
+	for _, subscriber := range n.candleSubscribers {
+		n.dataFeed.Subscribe(pair, n.strategy.Timeframe(), subscriber.OnCandle, false)
+	}
+
+	// pairs added before the bot starts are set up by Run
+	if !running {
+		return nil
+	}
+
+	err := n.setupPair(ctx, pair)
+	if err != nil {
+		n.Unsubscribe(pair)
+		return err
+	}
+
+	log.Infof("[PAIRS] %s subscribed", pair)
+	return nil
+}
+
+// Unsubscribe removes a pair from the bot at runtime, closing its candle feeds. The strategy stops receiving
+// the candles of the pair, open orders and positions are kept and must be closed by the strategy
+func (n *NinjaBot) Unsubscribe(pair string) {
+	n.mtx.Lock()
+	for i, current := range n.settings.Pairs {
+		if current == pair {
+			n.settings.Pairs = append(n.settings.Pairs[:i:i], n.settings.Pairs[i+1:]...)
+			break
+		}
+	}
+	delete(n.strategiesControllers, pair)
+	n.mtx.Unlock()
+
+	n.dataFeed.Unsubscribe(pair)
+	log.Infof("[PAIRS] %s unsubscribed", pair)
+}
+
+// Run will initialize the strategy controller, order controller, preload data and start the bot. In live mode,
+// the bot runs until the context is canceled
 func (n *NinjaBot) Run(ctx context.Context) error {
-	for _, pair := range n.settings.Pairs {
-		// setup and subscribe strategy to data feed (candles)
-		n.strategiesControllers[pair] = strategy.NewStrategyController(pair, n.strategy, n.orderController)
+	// restore the strategy state from storage
+	if str, ok := n.strategy.(strategy.StatefulStrategy); ok {
+		str.SetState(strategy.NewState(n.storage))
+	}
+
+	if lifecycle, ok := n.strategy.(strategy.LifecycleStrategy); ok {
+		if err := lifecycle.OnStart(ctx, n.orderController.StrategyBroker()); err != nil {
+			return fmt.Errorf("strategy start: %w", err)
+		}
+		defer lifecycle.OnStop()
+	}
+
+	if n.health != nil {
+		n.startHealthServer(ctx)
+	}
+
+	if n.candleExport != nil {
+		defer n.candleExport.close()
+	}
+
+	n.mtx.Lock()
+	n.running = true
+	pairs := append([]string(nil), n.settings.Pairs...)
+	n.mtx.Unlock()
 
-		// preload candles for warmup period
-		err := n.preload(ctx, pair)
+	for _, pair := range pairs {
+		err := n.setupPair(ctx, pair)
 		if err != nil {
 			return err
 		}
+	}
 
-		// link to ninja bot controller
-		n.dataFeed.Subscribe(pair, n.strategy.Timeframe(), n.onCandle, false)
-
-		// start strategy controller
-		n.strategiesControllers[pair].Start()
+	if n.health != nil {
+		n.health.onWarmup()
 	}
 
 	// start order feed and controller
 	n.orderFeed.Start()
+	if n.reconcile && !n.backtest {
+		if _, err := n.orderController.Reconcile(n.reconcileNotify, pairs...); err != nil {
+			return err
+		}
+	}
+	n.recordStartEquity(ctx)
 	n.orderController.Start()
 	defer n.orderController.Stop()
 	if n.telegram != nil {
@@ -354,7 +1884,7 @@ func (n *NinjaBot) Run(ctx context.Context) error {
 	if n.backtest {
 		n.backtestCandles()
 	} else {
-		n.processCandles()
+		n.processCandles(ctx)
 	}
 
 	return nil
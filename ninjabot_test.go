@@ -1,18 +1,33 @@
 package ninjabot
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/rodrigo-brito/ninjabot/strategy"
 
 	"github.com/markcheno/go-talib"
 	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/order"
 	"github.com/rodrigo-brito/ninjabot/service"
 	"github.com/rodrigo-brito/ninjabot/storage"
+	"github.com/rodrigo-brito/ninjabot/testdata/mocks"
 )
 
 type fakeStrategy struct{}
@@ -114,3 +129,1178 @@ func TestMarketOrder(t *testing.T) {
 
 	bot.Summary()
 }
+
+func TestNinjaBot_preload(t *testing.T) {
+	ctx := context.Background()
+	candles := []model.Candle{
+		{Pair: "BTCUSDT", Time: time.Unix(0, 0), Close: 1, Complete: true},
+		{Pair: "BTCUSDT", Time: time.Unix(1, 0), Close: 2, Complete: true},
+	}
+
+	t.Run("strategy warmup", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		exc := mocks.NewExchange(t)
+		exc.EXPECT().CandlesByLimit(ctx, "BTCUSDT", "1d", 10).Return(candles, nil)
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, exc, new(fakeStrategy), WithStorage(db))
+		require.NoError(t, err)
+
+		bot.strategiesControllers["BTCUSDT"] = strategy.NewStrategyController("BTCUSDT", bot.strategy, bot.orderController)
+		require.NoError(t, bot.preload(ctx, "BTCUSDT"))
+	})
+
+	t.Run("custom warmup", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		exc := mocks.NewExchange(t)
+		exc.EXPECT().CandlesByLimit(ctx, "BTCUSDT", "1d", 30).Return(candles, nil)
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, exc, new(fakeStrategy),
+			WithStorage(db), WithWarmupCandles(30))
+		require.NoError(t, err)
+
+		bot.strategiesControllers["BTCUSDT"] = strategy.NewStrategyController("BTCUSDT", bot.strategy, bot.orderController)
+		require.NoError(t, bot.preload(ctx, "BTCUSDT"))
+	})
+}
+
+func TestNinjaBot_StorageWarmup(t *testing.T) {
+	ctx := context.Background()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	daily := func(days ...int) []model.Candle {
+		candles := make([]model.Candle, 0, len(days))
+		for _, day := range days {
+			candles = append(candles, model.Candle{
+				Pair:     "BTCUSDT",
+				Time:     today.AddDate(0, 0, -day),
+				Close:    float64(day),
+				Complete: true,
+			})
+		}
+		return candles
+	}
+
+	t.Run("stored candles", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		require.NoError(t, db.CreateCandles("1d", daily(12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1)...))
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+			WithStorage(db), WithStorageWarmup())
+		require.NoError(t, err)
+
+		candles, err := bot.warmup(ctx, "BTCUSDT", "1d", 10)
+		require.NoError(t, err)
+		require.Len(t, candles, 10)
+		require.Equal(t, 10.0, candles[0].Close)
+		require.Equal(t, 1.0, candles[9].Close)
+	})
+
+	t.Run("missing tail", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		require.NoError(t, db.CreateCandles("1d", daily(10, 9, 8, 7, 6, 5, 4, 3)...))
+
+		exc := mocks.NewExchange(t)
+		exc.EXPECT().CandlesByLimit(ctx, "BTCUSDT", "1d", 2).Return(daily(2, 1), nil)
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, exc, new(fakeStrategy),
+			WithStorage(db), WithStorageWarmup())
+		require.NoError(t, err)
+
+		candles, err := bot.warmup(ctx, "BTCUSDT", "1d", 10)
+		require.NoError(t, err)
+		require.Len(t, candles, 10)
+		require.Equal(t, 1.0, candles[9].Close)
+
+		stored, err := db.Candles("BTCUSDT", "1d", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, stored, 10)
+	})
+
+	t.Run("gap in storage", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		require.NoError(t, db.CreateCandles("1d", daily(10, 9, 8, 7, 5, 4, 3, 2, 1)...))
+
+		exc := mocks.NewExchange(t)
+		exc.EXPECT().CandlesByLimit(ctx, "BTCUSDT", "1d", 10).Return(daily(10, 9, 8, 7, 6, 5, 4, 3, 2, 1), nil)
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, exc, new(fakeStrategy),
+			WithStorage(db), WithStorageWarmup())
+		require.NoError(t, err)
+
+		candles, err := bot.warmup(ctx, "BTCUSDT", "1d", 10)
+		require.NoError(t, err)
+		require.Len(t, candles, 10)
+
+		stored, err := db.Candles("BTCUSDT", "1d", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, stored, 10)
+	})
+}
+
+func TestNinjaBot_PersistCandles(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("disabled", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+			WithStorage(db), WithTradeExcursions(), WithPersistCandles(false))
+		require.NoError(t, err)
+
+		bot.onCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 1, Complete: true})
+		candles, err := db.Candles("BTCUSDT", "1d", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Empty(t, candles)
+	})
+
+	t.Run("rolling window", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+			WithStorage(db), WithPersistCandles(true), WithCandleRetention(2))
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			bot.onCandle(model.Candle{Pair: "BTCUSDT", Time: start.AddDate(0, 0, i), Close: float64(i),
+				Complete: true})
+		}
+		bot.onCandle(model.Candle{Pair: "BTCUSDT", Time: start.AddDate(0, 0, 3), Close: 3})
+
+		candles, err := db.Candles("BTCUSDT", "1d", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 1.0, candles[0].Close)
+		require.Equal(t, 2.0, candles[1].Close)
+	})
+}
+
+func TestNinjaBot_ExportTrades(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	for _, o := range []*model.Order{
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Status: model.OrderStatusTypeFilled, Price: 100, Quantity: 1,
+			UpdatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Pair: "BTCUSDT", Side: model.SideTypeSell, Status: model.OrderStatusTypeFilled, Price: 110, Quantity: 1,
+			UpdatedAt: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		require.NoError(t, db.CreateOrder(o))
+	}
+
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+		WithStorage(db))
+	require.NoError(t, err)
+
+	t.Run("csv", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.ExportTrades(buffer, ExportFormatCSV))
+		require.Equal(t, "pair,side,entry_time,exit_time,entry_price,exit_price,quantity,fee,profit,profit_percent,"+
+			"mae,mfe\nBTCUSDT,BUY,2022-01-01T00:00:00Z,2022-01-02T00:00:00Z,100,110,1,0,10,0.1,0,0\n",
+			buffer.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.ExportTrades(buffer, ExportFormatJSON))
+
+		var trades []order.Trade
+		require.NoError(t, json.Unmarshal(buffer.Bytes(), &trades))
+		require.Len(t, trades, 1)
+		require.Equal(t, 10.0, trades[0].Profit)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		require.Error(t, bot.ExportTrades(bytes.NewBuffer(nil), "xml"))
+	})
+
+	t.Run("excursions", func(t *testing.T) {
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+			WithStorage(db), WithTradeExcursions())
+		require.NoError(t, err)
+
+		bot.onCandle(model.Candle{Pair: "BTCUSDT", Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			Low: 95, High: 105, Complete: true})
+		bot.onCandle(model.Candle{Pair: "BTCUSDT", Time: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+			Low: 104, High: 120, Complete: true})
+
+		trades, err := bot.Trades()
+		require.NoError(t, err)
+		require.Len(t, trades, 1)
+		require.InDelta(t, -0.05, trades[0].MAE, 1e-9)
+		require.InDelta(t, 0.2, trades[0].MFE, 1e-9)
+	})
+}
+
+func TestNinjaBot_SummaryTo(t *testing.T) {
+	ctx := context.Background()
+	strategy := new(fakeStrategy)
+	csvFeed, err := exchange.NewCSVFeed(strategy.Timeframe(), exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      "testdata/btc-1h.csv",
+		Timeframe: "1h",
+	})
+	require.NoError(t, err)
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithDataFeed(csvFeed))
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, strategy, WithBacktest(wallet),
+		WithoutStorage(), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+	require.NoError(t, bot.Run(ctx))
+
+	t.Run("json", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.SummaryTo(buffer, ExportFormatJSON))
+
+		var summary Summary
+		require.NoError(t, json.Unmarshal(buffer.Bytes(), &summary))
+		results := bot.orderController.Results["BTCUSDT"]
+		trades := len(results.Win()) + len(results.Lose())
+		require.Len(t, summary.Pairs, 1)
+		require.Equal(t, trades, summary.Total.Trades)
+		require.Equal(t, len(results.Win()), summary.Total.Win)
+		require.InDelta(t, float64(len(results.Win()))/float64(trades), summary.Total.WinRate, 1e-9)
+		require.InDelta(t, results.Profit(), summary.Total.Profit, 1e-9)
+		require.Len(t, summary.Returns, trades)
+		require.NotNil(t, summary.Wallet)
+		require.Equal(t, "USDT", summary.Wallet.BaseCoin)
+		require.InDelta(t, 10000.0, summary.Wallet.StartValue, 1e-9)
+		require.NotNil(t, summary.Benchmark)
+		require.Greater(t, summary.Benchmark.Return, 1.0)
+		require.InDelta(t, summary.Wallet.Return, float64(summary.Benchmark.StrategyReturn), 1e-9)
+		require.InDelta(t, summary.Wallet.Return-summary.Benchmark.Return, float64(summary.Benchmark.Alpha), 1e-9)
+		require.Equal(t, bot.SummaryData(), summary)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.SummaryTo(buffer, ExportFormatCSV))
+
+		records, err := csv.NewReader(buffer).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, []string{"pair", "trades", "win", "loss", "win_rate", "payoff", "sqn", "profit", "volume",
+			"benchmark", "alpha"}, records[0])
+		require.Equal(t, "BTCUSDT", records[1][0])
+		require.Equal(t, "TOTAL", records[2][0])
+
+		benchmark := bot.SummaryData().Benchmark
+		require.Equal(t, strconv.FormatFloat(benchmark.Pairs["BTCUSDT"], 'f', -1, 64), records[1][9])
+		require.Empty(t, records[1][10])
+		require.Equal(t, strconv.FormatFloat(benchmark.Return, 'f', -1, 64), records[2][9])
+		require.Equal(t, benchmark.Alpha.Format(-1), records[2][10])
+	})
+
+	t.Run("table", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.SummaryTo(buffer, ExportFormatTable))
+		require.Contains(t, buffer.String(), "BTCUSDT")
+		require.Contains(t, buffer.String(), "FINAL PORTFOLIO")
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		require.Error(t, bot.SummaryTo(bytes.NewBuffer(nil), "xml"))
+	})
+}
+
+func TestNinjaBot_SummaryErrors(t *testing.T) {
+	ctx := context.Background()
+	strategy := new(fakeStrategy)
+	csvFeed, err := exchange.NewCSVFeed(strategy.Timeframe(), exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      "testdata/btc-1h.csv",
+		Timeframe: "1h",
+	})
+	require.NoError(t, err)
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+		exchange.WithPaperAsset("ETH", 1), exchange.WithDataFeed(csvFeed))
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, strategy,
+		WithPaperWallet(wallet), WithoutStorage(), WithBaseCurrency("USDT"), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+
+	// the ETH price is unknown, the equity is undefined instead of zero
+	summary := bot.SummaryData()
+	require.True(t, math.IsNaN(float64(summary.Equity)))
+	require.Len(t, summary.Errors, 1)
+	require.Contains(t, summary.Errors[0], "equity")
+
+	buffer := bytes.NewBuffer(nil)
+	require.NoError(t, bot.SummaryTo(buffer, ExportFormatTable))
+	require.Contains(t, buffer.String(), "EQUITY = n/a USDT")
+	require.Contains(t, buffer.String(), "ERRORS")
+
+	buffer.Reset()
+	require.NoError(t, bot.SummaryTo(buffer, ExportFormatJSON))
+	require.Contains(t, buffer.String(), `"equity": "n/a"`)
+}
+
+func TestNinjaBot_SummaryBenchmark(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("live", func(t *testing.T) {
+		// the paper wallet is the exchange of a live bot, without WithPaperWallet
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+			exchange.WithPaperFee(0.01, 0.01))
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT", "ETHUSDT"}}, wallet, new(fakeStrategy),
+			WithoutStorage(), WithBaseCurrency("USDT"), WithLogLevel(log.ErrorLevel),
+			WithBenchmarkWeights(map[string]float64{"BTCUSDT": 3, "ETHUSDT": 1}))
+		require.NoError(t, err)
+
+		// without candles there is no benchmark
+		require.Nil(t, bot.SummaryData().Benchmark)
+
+		bot.recordStartEquity(ctx)
+		wallet.OnCandle(model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, High: 100, Low: 100})
+		bot.trackBenchmark(model.Candle{Time: start, Pair: "BTCUSDT", Close: 100})
+		bot.trackBenchmark(model.Candle{Time: start, Pair: "ETHUSDT", Close: 10})
+
+		// the fees of a round trip are the strategy loss
+		_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		bot.trackBenchmark(model.Candle{Time: start.Add(time.Hour), Pair: "BTCUSDT", Close: 120})
+		bot.trackBenchmark(model.Candle{Time: start.Add(time.Hour), Pair: "ETHUSDT", Close: 8})
+
+		equity, err := bot.Equity(ctx)
+		require.NoError(t, err)
+		strategyReturn := (equity - 1000) / 1000
+		require.Less(t, strategyReturn, 0.0)
+
+		summary := bot.SummaryData()
+		require.NotNil(t, summary.Benchmark)
+		require.InDelta(t, 0.2, summary.Benchmark.Pairs["BTCUSDT"], 1e-9)
+		require.InDelta(t, -0.2, summary.Benchmark.Pairs["ETHUSDT"], 1e-9)
+		require.InDelta(t, 0.75, summary.Benchmark.Weights["BTCUSDT"], 1e-9)
+		require.InDelta(t, 0.1, summary.Benchmark.Return, 1e-9)
+		require.InDelta(t, strategyReturn, float64(summary.Benchmark.StrategyReturn), 1e-9)
+		require.InDelta(t, strategyReturn-0.1, float64(summary.Benchmark.Alpha), 1e-9)
+
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.SummaryTo(buffer, ExportFormatTable))
+		require.Contains(t, buffer.String(), "BENCHMARK RETURN = 10.00 %")
+		require.Contains(t, buffer.String(), "ALPHA")
+	})
+
+	t.Run("backtest", func(t *testing.T) {
+		strategy := new(fakeStrategy)
+		csvFeed, err := exchange.NewCSVFeed(strategy.Timeframe(), exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		}, exchange.PairFeed{
+			Pair:      "ETHUSDT",
+			File:      "testdata/eth-1h.csv",
+			Timeframe: "1h",
+		})
+		require.NoError(t, err)
+
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(csvFeed))
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT", "ETHUSDT"}}, wallet, strategy,
+			WithBacktest(wallet), WithoutStorage(), WithLogLevel(log.ErrorLevel),
+			WithBenchmarkWeights(map[string]float64{"BTCUSDT": 1}))
+		require.NoError(t, err)
+		require.NoError(t, bot.Run(ctx))
+
+		// the benchmark of the complete daily candles, with the weights of the bot
+		summary := bot.SummaryData()
+		require.NotNil(t, summary.Benchmark)
+		require.Len(t, summary.Benchmark.Pairs, 2)
+		require.Greater(t, summary.Benchmark.Pairs["BTCUSDT"], 1.0)
+		require.Equal(t, map[string]float64{"BTCUSDT": 1, "ETHUSDT": 0}, summary.Benchmark.Weights)
+		require.InDelta(t, summary.Benchmark.Pairs["BTCUSDT"], summary.Benchmark.Return, 1e-9)
+		require.InDelta(t, summary.Wallet.Return-summary.Benchmark.Return, float64(summary.Benchmark.Alpha), 1e-9)
+	})
+
+	t.Run("without strategy return", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(fakeStrategy),
+			WithoutStorage(), WithLogLevel(log.ErrorLevel))
+		require.NoError(t, err)
+
+		bot.trackBenchmark(model.Candle{Time: start, Pair: "BTCUSDT", Close: 100})
+		bot.trackBenchmark(model.Candle{Time: start.Add(time.Hour), Pair: "BTCUSDT", Close: 110})
+
+		// the benchmark is known, the alpha is undefined without the equity
+		summary := bot.SummaryData()
+		require.InDelta(t, 0.1, summary.Benchmark.Return, 1e-9)
+		require.True(t, math.IsNaN(float64(summary.Benchmark.Alpha)))
+
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, bot.SummaryTo(buffer, ExportFormatJSON))
+		require.Contains(t, buffer.String(), `"alpha": "n/a"`)
+	})
+
+	t.Run("paper wallet", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(fakeStrategy),
+			WithPaperWallet(wallet), WithoutStorage(), WithLogLevel(log.ErrorLevel))
+		require.NoError(t, err)
+
+		for i, price := range []float64{100, 110} {
+			candle := model.Candle{Time: start.Add(time.Duration(i) * time.Hour), Pair: "BTCUSDT", Close: price,
+				High: price, Low: price}
+			wallet.OnCandle(candle)
+			bot.trackBenchmark(candle)
+			if i == 0 {
+				_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 5)
+				require.NoError(t, err)
+			}
+		}
+
+		summary := bot.SummaryData()
+		require.NotNil(t, summary.Benchmark)
+		require.InDelta(t, 0.1, summary.Benchmark.Return, 1e-9)
+		require.InDelta(t, summary.Wallet.Return, float64(summary.Benchmark.StrategyReturn), 1e-9)
+		require.InDelta(t, summary.Wallet.Return-0.1, float64(summary.Benchmark.Alpha), 1e-9)
+	})
+}
+
+func TestMetric(t *testing.T) {
+	tt := []struct {
+		metric Metric
+		text   string
+		json   string
+	}{
+		{metric: 1.5, text: "1.500", json: "1.5"},
+		{metric: Metric(math.Inf(1)), text: "inf", json: `"inf"`},
+		{metric: Metric(math.Inf(-1)), text: "-inf", json: `"-inf"`},
+		{metric: Metric(math.NaN()), text: "n/a", json: `"n/a"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.text, func(t *testing.T) {
+			require.Equal(t, tc.text, tc.metric.Format(3))
+
+			data, err := json.Marshal(tc.metric)
+			require.NoError(t, err)
+			require.Equal(t, tc.json, string(data))
+
+			var metric Metric
+			require.NoError(t, json.Unmarshal(data, &metric))
+			require.Equal(t, tc.metric.Format(-1), metric.Format(-1))
+		})
+	}
+
+	t.Run("payoff", func(t *testing.T) {
+		require.Equal(t, "n/a", payoff(nil, nil, 0).Format(3))
+		require.Equal(t, "inf", payoff([]float64{10}, nil, 0).Format(3))
+		require.Equal(t, "2.000", payoff([]float64{10}, []float64{-5}, 2).Format(3))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var metric Metric
+		require.Error(t, json.Unmarshal([]byte(`"x"`), &metric))
+	})
+}
+
+func TestNinjaBot_MetricsWarmup(t *testing.T) {
+	ctx := context.Background()
+	run := func(t *testing.T, options ...Option) Summary {
+		strategy := new(fakeStrategy)
+		csvFeed, err := exchange.NewCSVFeed(strategy.Timeframe(), exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		})
+		require.NoError(t, err)
+
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(csvFeed))
+		options = append(options, WithBacktest(wallet), WithoutStorage(), WithLogLevel(log.ErrorLevel))
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, strategy, options...)
+		require.NoError(t, err)
+		require.NoError(t, bot.Run(ctx))
+		return bot.SummaryData()
+	}
+
+	all := run(t)
+	require.Greater(t, all.Total.Trades, 2)
+
+	t.Run("candles", func(t *testing.T) {
+		summary := run(t, WithMetricsWarmup(60))
+		require.Greater(t, summary.Total.Trades, 0)
+		require.Less(t, summary.Total.Trades, all.Total.Trades)
+		require.Less(t, summary.Total.Volume, all.Total.Volume)
+
+		// without trades after the warm up
+		summary = run(t, WithMetricsWarmup(1000))
+		require.Zero(t, summary.Total.Trades)
+		require.Zero(t, summary.Total.Volume)
+	})
+
+	t.Run("start", func(t *testing.T) {
+		summary := run(t, WithMetricsStart(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)))
+		require.Greater(t, summary.Total.Trades, 0)
+		require.Less(t, summary.Total.Trades, all.Total.Trades)
+
+		summary = run(t, WithMetricsStart(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+		require.Zero(t, summary.Total.Trades)
+	})
+}
+
+func TestNinjaBot_CandleExport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	strategy := new(fakeStrategy)
+	csvFeed, err := exchange.NewCSVFeed(strategy.Timeframe(), exchange.PairFeed{
+		Pair:       "BTCUSDT",
+		File:       "testdata/btc-1h.csv",
+		Timeframe:  "1h",
+		HeikinAshi: true,
+	})
+	require.NoError(t, err)
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithDataFeed(csvFeed))
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, strategy, WithBacktest(wallet),
+		WithoutStorage(), WithCandleExport(dir), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+	require.NoError(t, bot.Run(ctx))
+
+	// the exported file is loaded as the candles seen by the strategy
+	exported, err := exchange.NewCSVFeed("1d", exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      filepath.Join(dir, "BTCUSDT-1d.csv"),
+		Timeframe: "1d",
+	})
+	require.NoError(t, err)
+
+	var expected []model.Candle
+	for _, candle := range csvFeed.CandlePairTimeFrame["BTCUSDT--1d"] {
+		if candle.Complete {
+			expected = append(expected, candle)
+		}
+	}
+	candles := exported.CandlePairTimeFrame["BTCUSDT--1d"]
+	require.Len(t, candles, len(expected))
+	for i := range candles {
+		require.True(t, expected[i].Time.Equal(candles[i].Time))
+		require.Equal(t, expected[i].Open, candles[i].Open)
+		require.Equal(t, expected[i].Close, candles[i].Close)
+		require.Equal(t, expected[i].High, candles[i].High)
+		require.Equal(t, expected[i].Low, candles[i].Low)
+	}
+}
+
+func TestNinjaBot_ShadowExecution(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	// orders are not expected in the live exchange
+	exc := mocks.NewExchange(t)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, exc, new(fakeStrategy),
+		WithStorage(db), WithShadowExecution(wallet))
+	require.NoError(t, err)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(0, 0), Close: 100, Complete: true})
+	_, err = bot.Controller().CreateOrderMarket(SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	asset, quote, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, asset)
+	require.Equal(t, 900.0, quote)
+
+	exc.EXPECT().LastQuote(ctx, "BTCUSDT").Return(110, nil)
+	price, err := wallet.LastQuote(ctx, "BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 110.0, price)
+}
+
+type depthSource struct {
+	depth model.Depth
+}
+
+func (d depthSource) Depth(_ string, _ int) (model.Depth, error) {
+	return d.depth, nil
+}
+
+func TestNinjaBot_PaperDepthFeed(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+		exchange.WithFillModel(exchange.FillModelOrderBook))
+	source := depthSource{depth: model.Depth{Pair: "BTCUSDT", Asks: []model.PriceLevel{{Price: 101, Quantity: 1}}}}
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(fakeStrategy),
+		WithStorage(db), WithPaperWallet(wallet), WithPaperDepthFeed(source, 5))
+	require.NoError(t, err)
+
+	bot.processCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(0, 0), Close: 100, Complete: true})
+	order, err := bot.Controller().CreateOrderMarket(SideTypeBuy, "BTCUSDT", 2)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+	require.Equal(t, 1.0, order.ExecutedQuantity)
+	require.Equal(t, 101.0, order.Price)
+}
+
+func TestNinjaBot_Health(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+		WithStorage(db), WithHealthServer(":0", time.Minute))
+	require.NoError(t, err)
+
+	probe := func(path string) (int, healthResponse) {
+		recorder := httptest.NewRecorder()
+		bot.healthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var response healthResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return recorder.Code, response
+	}
+
+	code, response := probe("/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]string{"candles": "ok"}, response.Checks)
+
+	code, response = probe("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.NotEqual(t, "ok", response.Checks["ready"])
+
+	bot.health.onWarmup()
+	bot.onCandle(model.Candle{Pair: "BTCUSDT", Time: time.Unix(0, 0), Close: 100})
+	code, response = probe("/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", response.Status)
+	require.Equal(t, "ok", response.Checks["storage"])
+
+	// stale candle stream
+	bot.health.lastCandle = time.Now().Add(-2 * time.Minute)
+	code, response = probe("/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, response.Checks["candles"], "no candles received")
+
+	// the dependencies are checked only by the readiness probe
+	code, response = probe("/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", response.Checks["exchange"])
+	require.NotContains(t, response.Checks, "candles")
+}
+
+func TestNinjaBot_PanicEndpoint(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(fakeStrategy),
+		WithStorage(db), WithHealthServer(":0", time.Minute), WithPanicEndpoint("secret"))
+	require.NoError(t, err)
+
+	_, err = bot.orderController.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	request := func(method, token string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/panic", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		bot.healthHandler().ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	require.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "secret"))
+	require.Equal(t, http.StatusUnauthorized, request(http.MethodPost, ""))
+	require.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "wrong"))
+
+	asset, _, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, asset)
+
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "secret"))
+	asset, _, err = wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Zero(t, asset)
+
+	t.Run("options in any order", func(t *testing.T) {
+		bot, err = NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(fakeStrategy),
+			WithStorage(db), WithPanicEndpoint("secret"), WithHealthServer(":0", time.Minute))
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusUnauthorized, request(http.MethodPost, ""))
+		require.Equal(t, http.StatusOK, request(http.MethodPost, "secret"))
+	})
+}
+
+type multiTimeframeStrategy struct {
+	candles      int
+	dailyCandles int
+	timeMode     model.CandleTimeMode
+	first        time.Time
+}
+
+func (s multiTimeframeStrategy) Timeframe() string {
+	return "1h"
+}
+
+func (s multiTimeframeStrategy) Timeframes() []string {
+	return []string{"1d"}
+}
+
+func (s multiTimeframeStrategy) WarmupPeriod() int {
+	return 1
+}
+
+func (s multiTimeframeStrategy) Indicators(_ *Dataframe) []strategy.ChartIndicator {
+	return nil
+}
+
+func (s *multiTimeframeStrategy) OnCandle(df *Dataframe, _ service.Broker) {
+	s.candles++
+	if s.first.IsZero() {
+		s.first = df.Time[0]
+	}
+	daily := df.Timeframes["1d"]
+	if len(daily.Time) == 0 {
+		return
+	}
+
+	// the daily candle is available only after its close
+	lastDaily := s.timeMode.OpenTime(daily.Time[len(daily.Time)-1], 24*time.Hour)
+	last := s.timeMode.OpenTime(df.Time[len(df.Time)-1], time.Hour)
+	if lastDaily.Add(24 * time.Hour).After(last.Add(time.Hour)) {
+		panic("daily candle received before its close")
+	}
+	s.dailyCandles = len(daily.Time)
+}
+
+func TestNinjaBot_MultiTimeframe(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	csvFeed, err := exchange.NewCSVFeed("1h", exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      "testdata/btc-1h.csv",
+		Timeframe: "1h",
+	})
+	require.NoError(t, err)
+
+	paperWallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithDataFeed(csvFeed))
+
+	// the daily candles are resampled from the hourly CSV file
+	str := new(multiTimeframeStrategy)
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, paperWallet, str, WithStorage(db),
+		WithBacktest(paperWallet), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+	require.NoError(t, bot.Run(ctx))
+
+	candles, err := csvFeed.CandlesByPeriod(ctx, "BTCUSDT", "1d", time.Time{}, time.Now())
+	require.NoError(t, err)
+
+	daily := 0
+	for _, candle := range candles {
+		if candle.Complete {
+			daily++
+		}
+	}
+	require.Greater(t, str.candles, 0)
+	require.Equal(t, daily, str.dailyCandles)
+	require.Contains(t, csvFeed.Timeframes(), "1d")
+}
+
+func TestNinjaBot_CandleTimeMode(t *testing.T) {
+	ctx := context.Background()
+
+	newFeed := func(t *testing.T) *exchange.CSVFeed {
+		csvFeed, err := exchange.NewCSVFeed("1h", exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		})
+		require.NoError(t, err)
+		return csvFeed
+	}
+
+	t.Run("close time", func(t *testing.T) {
+		csvFeed := newFeed(t)
+		first := csvFeed.CandlePairTimeFrame["BTCUSDT--1h"][0].Time
+
+		paperWallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(csvFeed))
+		str := &multiTimeframeStrategy{timeMode: model.CandleTimeClose}
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, paperWallet, str,
+			WithBacktest(paperWallet), WithoutStorage(),
+			WithCandleTimeMode(model.CandleTimeClose), WithLogLevel(log.ErrorLevel))
+		require.NoError(t, err)
+		require.NoError(t, bot.Run(ctx))
+
+		// the candles are received with the close time and the daily candles are still aligned by the close
+		require.Equal(t, first.Add(time.Hour), str.first)
+		require.Greater(t, str.dailyCandles, 0)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		paperWallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		_, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, paperWallet, new(multiTimeframeStrategy),
+			WithBacktest(paperWallet), WithoutStorage(),
+			WithCandleTimeMode(model.CandleTimeClose), WithLogLevel(log.ErrorLevel))
+		require.ErrorContains(t, err, "not supported")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		paperWallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(newFeed(t)))
+		_, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, paperWallet, new(multiTimeframeStrategy),
+			WithBacktest(paperWallet), WithoutStorage(),
+			WithCandleTimeMode("middle"), WithLogLevel(log.ErrorLevel))
+		require.ErrorContains(t, err, "invalid candle time mode")
+	})
+}
+
+func TestNinjaBot_EquitySnapshots(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("base currency required", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		_, err = NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(fakeStrategy),
+			WithStorage(db), WithEquitySnapshots(0))
+		require.Error(t, err)
+	})
+
+	t.Run("backtest", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		csvFeed, err := exchange.NewCSVFeed("1d", exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		})
+		require.NoError(t, err)
+
+		paperWallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(csvFeed))
+
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, paperWallet, new(fakeStrategy),
+			WithStorage(db), WithBacktest(paperWallet), WithEquitySnapshots(7*24*time.Hour),
+			WithLogLevel(log.ErrorLevel))
+		require.NoError(t, err)
+		require.NoError(t, bot.Run(ctx))
+
+		curve, err := bot.EquityCurve(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Greater(t, len(curve), 1)
+		for i := 1; i < len(curve); i++ {
+			require.GreaterOrEqual(t, curve[i].Time.Sub(curve[i-1].Time), 7*24*time.Hour)
+		}
+		require.Equal(t, paperWallet.Equity(), curve[len(curve)-1].Equity)
+
+		maxDrawdown, _, _ := curve.MaxDrawdown()
+		require.Less(t, maxDrawdown, 0.0)
+	})
+}
+
+func TestNinjaBot_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	exc := mocks.NewExchange(t)
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, exc, new(fakeStrategy), WithStorage(db))
+	require.NoError(t, err)
+
+	t.Run("before run", func(t *testing.T) {
+		require.NoError(t, bot.Subscribe(ctx, "ETHUSDT"))
+		require.NoError(t, bot.Subscribe(ctx, "ETHUSDT"))
+		require.Equal(t, []string{"BTCUSDT", "ETHUSDT"}, bot.Pairs())
+		require.Error(t, bot.Subscribe(ctx, "INVALID"))
+
+		bot.Unsubscribe("ETHUSDT")
+		require.Equal(t, []string{"BTCUSDT"}, bot.Pairs())
+	})
+
+	t.Run("at runtime", func(t *testing.T) {
+		bot.running = true
+		bot.dataFeed.Start(false)
+
+		var feedCtx context.Context
+		ccandle, cerr := make(chan model.Candle), make(chan error)
+		exc.EXPECT().CandlesByLimit(ctx, "ETHUSDT", "1d", 10).Return(nil, nil)
+		exc.EXPECT().CandlesSubscription(mock.Anything, "ETHUSDT", "1d").
+			Run(func(ctx context.Context, _, _ string) {
+				feedCtx = ctx
+			}).Return(ccandle, cerr)
+
+		require.NoError(t, bot.Subscribe(ctx, "ETHUSDT"))
+		require.Equal(t, []string{"BTCUSDT", "ETHUSDT"}, bot.Pairs())
+		_, ok := bot.strategyController("ETHUSDT")
+		require.True(t, ok)
+
+		ccandle <- model.Candle{Pair: "ETHUSDT", Time: time.Unix(0, 0), Close: 10, Complete: true}
+		require.Eventually(t, func() bool {
+			return bot.priorityQueueCandle.Len() == 1
+		}, time.Second, 10*time.Millisecond)
+
+		bot.Unsubscribe("ETHUSDT")
+		require.Equal(t, []string{"BTCUSDT"}, bot.Pairs())
+		require.ErrorIs(t, feedCtx.Err(), context.Canceled)
+		_, ok = bot.strategyController("ETHUSDT")
+		require.False(t, ok)
+
+		// candles of the removed pair are ignored
+		bot.processCandle(model.Candle{Pair: "ETHUSDT", Time: time.Unix(1, 0), Close: 10, Complete: true})
+		close(ccandle)
+	})
+}
+
+func TestCompareBacktests(t *testing.T) {
+	ctx := context.Background()
+	csvFeed, err := exchange.NewCSVFeed("1d", exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      "testdata/btc-1h.csv",
+		Timeframe: "1h",
+	})
+	require.NoError(t, err)
+
+	wallet := func() *exchange.PaperWallet {
+		return exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(csvFeed))
+	}
+
+	results, err := CompareBacktests(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet,
+		Backtest{Name: "ema", Strategy: new(fakeStrategy), Options: []Option{WithLogLevel(log.ErrorLevel)}},
+		Backtest{Name: "ema rerun", Strategy: new(fakeStrategy)},
+	)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	for _, result := range results {
+		require.NotEmpty(t, result.Equity)
+		require.Greater(t, result.Trades, 0)
+		require.InDelta(t, result.Equity[len(result.Equity)-1].Equity/10000-1, result.Return, 1e-9)
+		require.LessOrEqual(t, result.MaxDrawdown, 0.0)
+		require.GreaterOrEqual(t, result.WinRate, 0.0)
+		require.LessOrEqual(t, result.WinRate, 1.0)
+	}
+	require.Equal(t, results[0].Return, results[1].Return)
+	require.Contains(t, results.String(), "ema rerun")
+}
+
+type countStrategy struct {
+	calls int
+	last  time.Time
+}
+
+func (s countStrategy) Timeframe() string {
+	return "1d"
+}
+
+func (s countStrategy) WarmupPeriod() int {
+	return 1
+}
+
+func (s countStrategy) Indicators(_ *Dataframe) []strategy.ChartIndicator {
+	return nil
+}
+
+func (s *countStrategy) OnCandle(df *Dataframe, _ service.Broker) {
+	s.calls++
+	s.last = df.Time[len(df.Time)-1]
+}
+
+func TestNinjaBot_Pause(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	str := new(countStrategy)
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, str, WithStorage(db),
+		WithPaperWallet(wallet), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+
+	controller := strategy.NewStrategyController("BTCUSDT", str, bot.orderController)
+	controller.Start()
+	bot.strategiesControllers["BTCUSDT"] = controller
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(day int) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.AddDate(0, 0, day), Close: 100, Complete: true}
+	}
+
+	bot.processCandle(candle(0))
+	require.Equal(t, 1, str.calls)
+	_, err = bot.Controller().CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	bot.Pause()
+	require.True(t, bot.Paused())
+	bot.processCandle(candle(1))
+	bot.processCandle(candle(2))
+	require.Equal(t, 1, str.calls)
+
+	// entries are blocked, exits are accepted
+	_, err = bot.Controller().CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, order.ErrPaused)
+	_, err = bot.Controller().CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	bot.Resume()
+	require.False(t, bot.Paused())
+	bot.processCandle(candle(3))
+	require.Equal(t, 2, str.calls)
+	require.Equal(t, start.AddDate(0, 0, 3), str.last)
+
+	_, err = bot.Controller().CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+}
+
+func TestNinjaBot_WithoutStorage(t *testing.T) {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() {
+		require.NoError(t, os.Chdir(dir))
+	}()
+
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(countStrategy),
+		WithPaperWallet(wallet), WithoutStorage(), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+
+	// the orders are kept in memory, without a database file
+	_, err = bot.Controller().CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	orders, err := bot.storage.Orders()
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+
+	files, err := os.ReadDir(".")
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestNinjaBot_DefaultStorage(t *testing.T) {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() {
+		require.NoError(t, os.Chdir(dir))
+	}()
+
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	_, err = NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, new(countStrategy),
+		WithPaperWallet(wallet), WithLogLevel(log.ErrorLevel))
+	require.NoError(t, err)
+	require.FileExists(t, defaultDatabase)
+}
+
+type lifecycleStrategy struct {
+	countStrategy
+	err         error
+	startCalls  int
+	stopCalls   int
+	callsAtStop int
+}
+
+func (s *lifecycleStrategy) OnStart(_ context.Context, broker service.Broker) error {
+	if broker == nil {
+		return errors.New("missing broker")
+	}
+	s.startCalls++
+	return s.err
+}
+
+func (s *lifecycleStrategy) OnStop() {
+	s.stopCalls++
+	s.callsAtStop = s.calls
+}
+
+func TestNinjaBot_StrategyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	backtest := func(str *lifecycleStrategy) error {
+		csvFeed, err := exchange.NewCSVFeed("1d", exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		})
+		require.NoError(t, err)
+
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithDataFeed(csvFeed))
+		bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, str, WithStorage(db),
+			WithBacktest(wallet), WithLogLevel(log.ErrorLevel))
+		require.NoError(t, err)
+		return bot.Run(ctx)
+	}
+
+	t.Run("start and stop once", func(t *testing.T) {
+		str := new(lifecycleStrategy)
+		require.NoError(t, backtest(str))
+		require.Equal(t, 1, str.startCalls)
+		require.Equal(t, 1, str.stopCalls)
+		require.Greater(t, str.callsAtStop, 0)
+		require.Equal(t, str.calls, str.callsAtStop)
+	})
+
+	t.Run("start error", func(t *testing.T) {
+		str := &lifecycleStrategy{err: errors.New("model not found")}
+		require.ErrorContains(t, backtest(str), "model not found")
+		require.Zero(t, str.calls)
+		require.Zero(t, str.stopCalls)
+	})
+}
+
+type configurableStrategy struct {
+	fakeStrategy
+	period int
+}
+
+func (s *configurableStrategy) Configure(parameters model.Parameters) error {
+	if err := parameters.Require("period"); err != nil {
+		return err
+	}
+
+	var err error
+	s.period, err = parameters.Int("period", 0)
+	return err
+}
+
+func TestNinjaBot_StrategyParameters(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	str := new(configurableStrategy)
+	_, err = NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}, Parameters: model.Parameters{"period": 21}},
+		mocks.NewExchange(t), str, WithStorage(db))
+	require.NoError(t, err)
+	require.Equal(t, 21, str.period)
+
+	_, err = NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, mocks.NewExchange(t), new(configurableStrategy),
+		WithStorage(db))
+	require.ErrorIs(t, err, model.ErrMissingParameter)
+}
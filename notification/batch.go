@@ -0,0 +1,193 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// telegramMessageLimit is the maximum length of a Telegram message
+	telegramMessageLimit = 4096
+	// defaultChatInterval is the minimum interval between messages of a chat, Telegram allows about one per second
+	defaultChatInterval = time.Second
+	batchQueueSize      = 100
+)
+
+// batcher aggregates the messages received in a window into a single digest, and delivers the messages
+// through a queue that waits the minimum interval between messages of the same chat. Urgent messages skip
+// the window and the pending messages of the queue. The queue stops when the context is done
+type batcher struct {
+	ctx      context.Context
+	mtx      sync.Mutex
+	window   time.Duration
+	interval time.Duration
+	users    []int64
+	send     func(user int64, text string)
+	pending  []string
+	last     map[int64]time.Time
+	queue    chan string
+	urgent   chan string
+	done     chan struct{}
+}
+
+func newBatcher(ctx context.Context, window, interval time.Duration, users []int64,
+	send func(user int64, text string)) *batcher {
+
+	b := &batcher{
+		ctx:      ctx,
+		window:   window,
+		interval: interval,
+		users:    users,
+		send:     send,
+		last:     make(map[int64]time.Time),
+		queue:    make(chan string, batchQueueSize),
+		urgent:   make(chan string, batchQueueSize),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add appends the message to the digest of the current window, or enqueues it without a window
+func (b *batcher) Add(text string) {
+	if b.window <= 0 {
+		b.enqueue(b.queue, text)
+		return
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.pending = append(b.pending, text)
+	if len(b.pending) == 1 {
+		time.AfterFunc(b.window, b.Flush)
+	}
+}
+
+// Urgent enqueues the message with priority over the other messages, e.g. critical errors
+func (b *batcher) Urgent(text string) {
+	b.enqueue(b.urgent, text)
+}
+
+// Flush enqueues the digest of the pending messages
+func (b *batcher) Flush() {
+	b.mtx.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mtx.Unlock()
+
+	for _, message := range digest(pending) {
+		b.enqueue(b.queue, message)
+	}
+}
+
+func (b *batcher) enqueue(queue chan string, text string) {
+	select {
+	case queue <- text:
+	default:
+		log.Warn("notification queue is full, message discarded: ", text)
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	for {
+		select {
+		case text := <-b.urgent:
+			b.deliver(text)
+			continue
+		default:
+		}
+
+		select {
+		case text := <-b.urgent:
+			b.deliver(text)
+		case text := <-b.queue:
+			b.deliver(text)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends the message to each user, waiting the interval since the last message of the chat.
+// Messages longer than the Telegram limit are sent in parts
+func (b *batcher) deliver(text string) {
+	for _, part := range splitMessage(text, telegramMessageLimit) {
+		for _, user := range b.users {
+			if wait := time.Until(b.last[user].Add(b.interval)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-b.ctx.Done():
+					return
+				}
+			}
+			b.send(user, part)
+			b.last[user] = time.Now()
+		}
+	}
+}
+
+// splitMessage splits the text in parts up to the limit of characters, at the last line break of each part
+// when possible
+func splitMessage(text string, limit int) []string {
+	runes := []rune(text)
+	var parts []string
+	for len(runes) > limit {
+		cut := limit
+		for i := limit - 1; i > 0; i-- {
+			if runes[i] == '\n' {
+				cut = i
+				break
+			}
+		}
+
+		parts = append(parts, string(runes[:cut]))
+		runes = runes[cut:]
+		if runes[0] == '\n' {
+			runes = runes[1:]
+		}
+	}
+	return append(parts, string(runes))
+}
+
+// digest joins the messages in a single message, split in multiple messages when the length exceeds
+// the Telegram limit
+func digest(messages []string) []string {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if len(messages) == 1 {
+		return messages
+	}
+
+	const separator = "\n\n"
+	header := fmt.Sprintf("📦 %d NOTIFICATIONS\n-----\n", len(messages))
+
+	var result []string
+	var builder strings.Builder
+	builder.WriteString(header)
+	size := 0
+	for _, message := range messages {
+		if size > 0 && builder.Len()+len(separator)+len(message) > telegramMessageLimit {
+			result = append(result, builder.String())
+			builder.Reset()
+			size = 0
+		}
+
+		if size > 0 {
+			builder.WriteString(separator)
+		}
+		builder.WriteString(message)
+		size++
+	}
+
+	return append(result, builder.String())
+}
@@ -0,0 +1,134 @@
+package notification
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+type delivery struct {
+	user int64
+	text string
+	time time.Time
+}
+
+func newTestBatcher(ctx context.Context, window, interval time.Duration) (*batcher, chan delivery) {
+	deliveries := make(chan delivery, 100)
+	b := newBatcher(ctx, window, interval, []int64{1}, func(user int64, text string) {
+		deliveries <- delivery{user: user, text: text, time: time.Now()}
+	})
+	return b, deliveries
+}
+
+func receive(t *testing.T, deliveries chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+		return delivery{}
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	t.Run("digest of the window", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		b, deliveries := newTestBatcher(ctx, 50*time.Millisecond, time.Millisecond)
+
+		b.Add("first")
+		b.Add("second")
+		b.Add("third")
+
+		d := receive(t, deliveries)
+		require.Equal(t, int64(1), d.user)
+		require.Contains(t, d.text, "3 NOTIFICATIONS")
+		require.Contains(t, d.text, "first\n\nsecond\n\nthird")
+		require.Empty(t, deliveries)
+	})
+
+	t.Run("urgent skips the window", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		b, deliveries := newTestBatcher(ctx, time.Hour, time.Millisecond)
+
+		b.Add("batched")
+		b.Urgent("error")
+		require.Equal(t, "error", receive(t, deliveries).text)
+		require.Empty(t, deliveries)
+	})
+
+	t.Run("chat interval", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		b, deliveries := newTestBatcher(ctx, 0, 50*time.Millisecond)
+
+		b.Add("first")
+		b.Add("second")
+		first, second := receive(t, deliveries), receive(t, deliveries)
+		require.Equal(t, "first", first.text)
+		require.Equal(t, "second", second.text)
+		require.GreaterOrEqual(t, second.time.Sub(first.time), 50*time.Millisecond)
+	})
+
+	t.Run("long message in parts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		b, deliveries := newTestBatcher(ctx, 0, time.Millisecond)
+
+		b.Add(strings.Repeat("a", telegramMessageLimit+10))
+		require.Len(t, receive(t, deliveries).text, telegramMessageLimit)
+		require.Len(t, receive(t, deliveries).text, 10)
+	})
+
+	t.Run("stop with the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		b, deliveries := newTestBatcher(ctx, 0, time.Hour)
+
+		b.Add("first")
+		receive(t, deliveries)
+		b.Add("waiting the interval")
+		cancel()
+
+		select {
+		case <-b.done:
+		case <-time.After(time.Second):
+			t.Fatal("batcher not stopped")
+		}
+		require.Empty(t, deliveries)
+	})
+}
+
+func TestDigest(t *testing.T) {
+	require.Nil(t, digest(nil))
+	require.Equal(t, []string{"single"}, digest([]string{"single"}))
+
+	messages := []string{strings.Repeat("a", 3000), strings.Repeat("b", 3000), "c"}
+	result := digest(messages)
+	require.Len(t, result, 2)
+	require.True(t, strings.HasPrefix(result[0], "📦 3 NOTIFICATIONS"))
+	require.True(t, strings.HasSuffix(result[0], "a"))
+	require.Equal(t, strings.Repeat("b", 3000)+"\n\nc", result[1])
+}
+
+func TestSplitMessage(t *testing.T) {
+	require.Equal(t, []string{"short"}, splitMessage("short", 10))
+
+	// at the last line break of the part
+	require.Equal(t, []string{"line 1", "line 2", "line 3"}, splitMessage("line 1\nline 2\nline 3", 10))
+
+	// without line breaks, at the limit
+	require.Equal(t, []string{"abcd", "efgh", "ij"}, splitMessage("abcdefghij", 4))
+
+	// the limit is in characters, not bytes
+	parts := splitMessage(strings.Repeat("é", 5), 2)
+	require.Equal(t, []string{"éé", "éé", "é"}, parts)
+	for _, part := range parts {
+		require.True(t, utf8.ValidString(part))
+	}
+}
@@ -0,0 +1,39 @@
+package notification
+
+import (
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+// Multi fans out every notification to a list of notifiers, e.g. Telegram and Slack at the same time
+type Multi struct {
+	notifiers []service.Notifier
+}
+
+// NewMulti creates a notifier that forwards messages, orders and errors to all given notifiers
+func NewMulti(notifiers ...service.Notifier) *Multi {
+	return &Multi{notifiers: notifiers}
+}
+
+// Add registers a new notifier in the fan-out list
+func (m *Multi) Add(notifier service.Notifier) {
+	m.notifiers = append(m.notifiers, notifier)
+}
+
+func (m *Multi) Notify(text string) {
+	for _, notifier := range m.notifiers {
+		notifier.Notify(text)
+	}
+}
+
+func (m *Multi) OnOrder(order model.Order) {
+	for _, notifier := range m.notifiers {
+		notifier.OnOrder(order)
+	}
+}
+
+func (m *Multi) OnError(err error) {
+	for _, notifier := range m.notifiers {
+		notifier.OnError(err)
+	}
+}
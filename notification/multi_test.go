@@ -0,0 +1,37 @@
+package notification
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+type recorder struct {
+	messages []string
+	orders   []model.Order
+	errors   []error
+}
+
+func (r *recorder) Notify(text string)        { r.messages = append(r.messages, text) }
+func (r *recorder) OnOrder(order model.Order) { r.orders = append(r.orders, order) }
+func (r *recorder) OnError(err error)         { r.errors = append(r.errors, err) }
+
+func TestMulti(t *testing.T) {
+	telegram, slack := &recorder{}, &recorder{}
+	multi := NewMulti(telegram)
+	multi.Add(slack)
+
+	multi.Notify("hello")
+	multi.OnOrder(model.Order{Pair: "BTCUSDT"})
+	multi.OnError(errors.New("fail"))
+
+	for _, notifier := range []*recorder{telegram, slack} {
+		require.Equal(t, []string{"hello"}, notifier.messages)
+		require.Len(t, notifier.orders, 1)
+		require.Equal(t, "BTCUSDT", notifier.orders[0].Pair)
+		require.Len(t, notifier.errors, 1)
+	}
+}
@@ -0,0 +1,179 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+const (
+	slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+	slackErrorColor     = "#d00000"
+)
+
+var ErrSlackInvalidSettings = errors.New("slack: webhook url or token with channel is required")
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Blocks      []slackBlock      `json:"blocks,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+// Slack posts notifications to a Slack channel using Block Kit messages. Messages are sent
+// with an incoming webhook, or with the chat.postMessage API when a bot token is provided
+type Slack struct {
+	settings model.SlackSettings
+	client   *http.Client
+}
+
+func NewSlack(settings model.SlackSettings) (*Slack, error) {
+	if settings.WebhookURL == "" && (settings.Token == "" || settings.Channel == "") {
+		return nil, ErrSlackInvalidSettings
+	}
+
+	return &Slack{
+		settings: settings,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func markdown(text string) *slackText {
+	return &slackText{Type: "mrkdwn", Text: text}
+}
+
+func (s Slack) send(message slackMessage) error {
+	message.Channel = s.settings.Channel
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	url := s.settings.WebhookURL
+	if s.settings.Token != "" {
+		url = slackPostMessageURL
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.settings.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.settings.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack: unexpected status %s", resp.Status)
+	}
+
+	// webhooks reply with a plain "ok", the web API reply with {"ok": bool, "error": string}
+	if s.settings.Token != "" {
+		var result struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return err
+		}
+		if !result.OK {
+			return fmt.Errorf("slack: %s", result.Error)
+		}
+	}
+
+	return nil
+}
+
+func (s Slack) Notify(text string) {
+	err := s.send(slackMessage{
+		Text:   text,
+		Blocks: []slackBlock{{Type: "section", Text: markdown(text)}},
+	})
+	if err != nil {
+		log.WithError(err).Error("notification/slack: couldnt send message")
+	}
+}
+
+func (s Slack) OnOrder(order model.Order) {
+	title := ""
+	switch order.Status {
+	case model.OrderStatusTypeFilled:
+		title = fmt.Sprintf("✅ ORDER FILLED - %s", order.Pair)
+	case model.OrderStatusTypeNew:
+		title = fmt.Sprintf("🆕 NEW ORDER - %s", order.Pair)
+	case model.OrderStatusTypeCanceled, model.OrderStatusTypeRejected:
+		title = fmt.Sprintf("❌ ORDER CANCELED / REJECTED - %s", order.Pair)
+	default:
+		title = fmt.Sprintf("%s ORDER - %s", order.Status, order.Pair)
+	}
+
+	err := s.send(slackMessage{
+		Text: title,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: title}},
+			{Type: "section", Fields: []slackText{
+				*markdown(fmt.Sprintf("*Pair*\n%s", order.Pair)),
+				*markdown(fmt.Sprintf("*Side*\n%s %s", order.Side, order.Type)),
+				*markdown(fmt.Sprintf("*Price*\n%f", order.Price)),
+				*markdown(fmt.Sprintf("*Quantity*\n%f", order.Quantity)),
+			}},
+		},
+	})
+	if err != nil {
+		log.WithError(err).Error("notification/slack: couldnt send order")
+	}
+}
+
+func (s Slack) OnError(err error) {
+	block := slackBlock{Type: "section", Text: markdown(fmt.Sprintf("*🛑 ERROR*\n%s", err))}
+
+	var orderError *exchange.OrderError
+	if errors.As(err, &orderError) {
+		block = slackBlock{
+			Type: "section",
+			Text: markdown(fmt.Sprintf("*🛑 ERROR*\n%s", orderError.Err)),
+			Fields: []slackText{
+				*markdown(fmt.Sprintf("*Pair*\n%s", orderError.Pair)),
+				*markdown(fmt.Sprintf("*Quantity*\n%.4f", orderError.Quantity)),
+			},
+		}
+	}
+
+	sendErr := s.send(slackMessage{
+		Text:        fmt.Sprintf("🛑 ERROR: %s", err),
+		Attachments: []slackAttachment{{Color: slackErrorColor, Blocks: []slackBlock{block}}},
+	})
+	if sendErr != nil {
+		log.WithError(sendErr).Error("notification/slack: couldnt send error")
+	}
+}
@@ -1,11 +1,15 @@
 package notification
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,20 +22,142 @@ import (
 )
 
 var (
-	buyRegexp  = regexp.MustCompile(`/buy\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
-	sellRegexp = regexp.MustCompile(`/sell\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
+	buyRegexp   = regexp.MustCompile(`/buy\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
+	sellRegexp  = regexp.MustCompile(`/sell\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
+	chartRegexp = regexp.MustCompile(`/chart\s+(?P<pair>\w+)`)
 )
 
+const (
+	defaultChartCandles   = 60
+	defaultChartRateLimit = 30 * time.Second
+)
+
+// ChartRenderer renders a candlestick image of a pair, e.g. plot.Chart
+type ChartRenderer interface {
+	RenderPNG(w io.Writer, pair string, limit int) error
+}
+
 type telegram struct {
 	settings        model.Settings
 	orderController *order.Controller
 	defaultMenu     *tb.ReplyMarkup
 	client          *tb.Bot
+	chart           ChartRenderer
+	chartCandles    int
+	chartLimiter    *rateLimiter
+	batchWindow     time.Duration
+	chatInterval    time.Duration
+	batch           *batcher
+	ctx             context.Context
+	pauser          Pauser
+	commands        []tb.Command
+}
+
+// commandRoles are the roles required by the commands, see model.TelegramRole
+var commandRoles = map[string]model.TelegramRole{
+	"/help":    model.TelegramRoleViewer,
+	"/status":  model.TelegramRoleViewer,
+	"/balance": model.TelegramRoleViewer,
+	"/profit":  model.TelegramRoleViewer,
+	"/chart":   model.TelegramRoleViewer,
+	"/buy":     model.TelegramRoleTrader,
+	"/sell":    model.TelegramRoleTrader,
+	"/start":   model.TelegramRoleAdmin,
+	"/stop":    model.TelegramRoleAdmin,
+	"/panic":   model.TelegramRoleAdmin,
 }
 
 type Option func(telegram *telegram)
 
+// Pauser pauses the signal processing of the bot, e.g. ninjabot.NinjaBot. The strategy is not called and the new
+// entry orders are blocked while paused, the candles and the pending orders are still processed
+type Pauser interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// WithPauser sets the bot paused and resumed by the `/stop` and `/start` commands, set by the bot to itself.
+// Default: the order controller, which only blocks the new entry orders
+func WithPauser(pauser Pauser) Option {
+	return func(telegram *telegram) {
+		telegram.pauser = pauser
+	}
+}
+
+// WithChart enables the `/chart SYMBOL` command, that sends an image of the last candles of the pair
+// with the filled orders. The chart must be subscribed to the bot candles and orders, e.g.
+// ninjabot.WithCandleSubscription(chart) and ninjabot.WithOrderSubscription(chart)
+func WithChart(chart ChartRenderer) Option {
+	return func(telegram *telegram) {
+		telegram.chart = chart
+	}
+}
+
+// WithChartCandles sets the number of candles of the `/chart` image. Default: 60
+func WithChartCandles(candles int) Option {
+	return func(telegram *telegram) {
+		telegram.chartCandles = candles
+	}
+}
+
+// WithChartRateLimit sets the minimum interval between `/chart` requests of a user. Default: 30s
+func WithChartRateLimit(interval time.Duration) Option {
+	return func(telegram *telegram) {
+		telegram.chartLimiter.interval = interval
+	}
+}
+
+// WithBatchWindow aggregates the notifications received in the window into a single digest message,
+// to avoid a burst of messages in volatile periods. Errors are not batched and are sent immediately
+func WithBatchWindow(window time.Duration) Option {
+	return func(telegram *telegram) {
+		telegram.batchWindow = window
+	}
+}
+
+// WithContext sets the context of the notification queue, the queued messages are discarded when it is done.
+// The bot uses its own context. Default: context.Background()
+func WithContext(ctx context.Context) Option {
+	return func(telegram *telegram) {
+		telegram.ctx = ctx
+	}
+}
+
+// WithChatRateLimit sets the minimum interval between messages of a chat, the messages are queued
+// to respect the limit. Default: 1s, when WithBatchWindow is enabled
+func WithChatRateLimit(interval time.Duration) Option {
+	return func(telegram *telegram) {
+		telegram.chatInterval = interval
+	}
+}
+
+// rateLimiter allows one request by user in the interval
+type rateLimiter struct {
+	mtx      sync.Mutex
+	interval time.Duration
+	last     map[int64]time.Time
+}
+
+func (r *rateLimiter) Allow(user int64, now time.Time) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if last, ok := r.last[user]; ok && now.Sub(last) < r.interval {
+		return false
+	}
+
+	r.last[user] = now
+	return true
+}
+
 func NewTelegram(controller *order.Controller, settings model.Settings, options ...Option) (service.Telegram, error) {
+	for user, role := range settings.Telegram.Roles {
+		if !role.Valid() {
+			return nil, fmt.Errorf("telegram: invalid role %q of user %d", role, user)
+		}
+	}
+
 	menu := &tb.ReplyMarkup{ResizeReplyKeyboard: true}
 	poller := &tb.LongPoller{Timeout: 10 * time.Second}
 
@@ -70,45 +196,80 @@ func NewTelegram(controller *order.Controller, settings model.Settings, options
 		sellBtn    = menu.Text("/sell")
 	)
 
-	err = client.SetCommands([]tb.Command{
+	bot := &telegram{
+		orderController: controller,
+		client:          client,
+		settings:        settings,
+		defaultMenu:     menu,
+		chartCandles:    defaultChartCandles,
+		ctx:             context.Background(),
+		chartLimiter: &rateLimiter{
+			interval: defaultChartRateLimit,
+			last:     make(map[int64]time.Time),
+		},
+	}
+
+	for _, option := range options {
+		option(bot)
+	}
+
+	if bot.pauser == nil {
+		bot.pauser = controller
+	}
+
+	if bot.batchWindow > 0 || bot.chatInterval > 0 {
+		if bot.chatInterval <= 0 {
+			bot.chatInterval = defaultChatInterval
+		}
+
+		users := make([]int64, 0, len(settings.Telegram.Users))
+		for _, user := range settings.Telegram.Users {
+			users = append(users, int64(user))
+		}
+		bot.batch = newBatcher(bot.ctx, bot.batchWindow, bot.chatInterval, users, bot.send)
+	}
+
+	commands := []tb.Command{
 		{Text: "/help", Description: "Display help instructions"},
-		{Text: "/stop", Description: "Stop buy and sell coins"},
-		{Text: "/start", Description: "Start buy and sell coins"},
+		{Text: "/stop", Description: "Pause the strategy and the new entries"},
+		{Text: "/start", Description: "Resume the strategy and the new entries"},
 		{Text: "/status", Description: "Check bot status"},
 		{Text: "/balance", Description: "Wallet balance"},
 		{Text: "/profit", Description: "Summary of last trade results"},
 		{Text: "/buy", Description: "open a buy order"},
 		{Text: "/sell", Description: "open a sell order"},
-	})
+		{Text: "/panic", Description: "Cancel all orders and close all positions"},
+	}
+
+	if bot.chart != nil {
+		commands = append(commands, tb.Command{Text: "/chart", Description: "Chart of the last candles of a pair"})
+	}
+
+	err = client.SetCommands(commands)
 	if err != nil {
 		return nil, err
 	}
+	bot.commands = commands
 
 	menu.Reply(
 		menu.Row(statusBtn, balanceBtn, profitBtn),
 		menu.Row(startBtn, stopBtn, buyBtn, sellBtn),
 	)
 
-	bot := &telegram{
-		orderController: controller,
-		client:          client,
-		settings:        settings,
-		defaultMenu:     menu,
-	}
+	client.Handle("/help", bot.restrict("/help", bot.HelpHandle))
+	client.Handle("/start", bot.restrict("/start", bot.StartHandle))
+	client.Handle("/stop", bot.restrict("/stop", bot.StopHandle))
+	client.Handle("/status", bot.restrict("/status", bot.StatusHandle))
+	client.Handle("/balance", bot.restrict("/balance", bot.BalanceHandle))
+	client.Handle("/profit", bot.restrict("/profit", bot.ProfitHandle))
+	client.Handle("/buy", bot.restrict("/buy", bot.BuyHandle))
+	client.Handle("/sell", bot.restrict("/sell", bot.SellHandle))
+	client.Handle("/panic", bot.restrict("/panic", bot.PanicHandle))
 
-	for _, option := range options {
-		option(bot)
+	if bot.chart != nil {
+		client.Handle("/chart", bot.restrict("/chart", bot.ChartHandle))
 	}
 
-	client.Handle("/help", bot.HelpHandle)
-	client.Handle("/start", bot.StartHandle)
-	client.Handle("/stop", bot.StopHandle)
-	client.Handle("/status", bot.StatusHandle)
-	client.Handle("/balance", bot.BalanceHandle)
-	client.Handle("/profit", bot.ProfitHandle)
-	client.Handle("/buy", bot.BuyHandle)
-	client.Handle("/sell", bot.SellHandle)
-
 	return bot, nil
 }
 
@@ -122,11 +283,37 @@ func (t telegram) Start() {
 	}
 }
 
+func (t telegram) send(user int64, text string) {
+	_, err := t.client.Send(&tb.User{ID: user}, text)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
 func (t telegram) Notify(text string) {
-	for _, user := range t.settings.Telegram.Users {
-		_, err := t.client.Send(&tb.User{ID: int64(user)}, text)
-		if err != nil {
-			log.Error(err)
+	if t.batch != nil {
+		t.batch.Add(text)
+		return
+	}
+
+	t.sendAll(text)
+}
+
+// notifyUrgent sends the message without batching, e.g. critical errors
+func (t telegram) notifyUrgent(text string) {
+	if t.batch != nil {
+		t.batch.Urgent(text)
+		return
+	}
+
+	t.sendAll(text)
+}
+
+// sendAll sends the message to all users, in parts when it is longer than the Telegram limit
+func (t telegram) sendAll(text string) {
+	for _, part := range splitMessage(text, telegramMessageLimit) {
+		for _, user := range t.settings.Telegram.Users {
+			t.send(int64(user), part)
 		}
 	}
 }
@@ -176,20 +363,18 @@ func (t telegram) BalanceHandle(m *tb.Message) {
 	}
 }
 
+// HelpHandle lists the commands allowed to the role of the user
 func (t telegram) HelpHandle(m *tb.Message) {
-	commands, err := t.client.GetCommands()
-	if err != nil {
-		log.Error(err)
-		t.OnError(err)
-		return
-	}
-
-	lines := make([]string, 0, len(commands))
-	for _, command := range commands {
-		lines = append(lines, fmt.Sprintf("/%s - %s", command.Text, command.Description))
+	role := t.settings.Telegram.Role(int(m.Sender.ID))
+	lines := make([]string, 0, len(t.commands))
+	for _, command := range t.commands {
+		if !role.Allows(commandRoles[command.Text]) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", command.Text, command.Description))
 	}
 
-	_, err = t.client.Send(m.Sender, strings.Join(lines, "\n"))
+	_, err := t.client.Send(m.Sender, strings.Join(lines, "\n"))
 	if err != nil {
 		log.Error(err)
 	}
@@ -314,16 +499,111 @@ func (t telegram) SellHandle(m *tb.Message) {
 	log.Info("[TELEGRAM]: SELL ORDER CREATED: ", order)
 }
 
+func (t telegram) PanicHandle(m *tb.Message) {
+	message := "🚨 All orders canceled and positions closed."
+	if err := t.orderController.FlattenAll(t.settings.Pairs...); err != nil {
+		log.Error(err)
+		message = fmt.Sprintf("🚨 Failed to close all positions:\n%s", err)
+	}
+
+	_, err := t.client.Send(m.Sender, message, t.defaultMenu)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (t telegram) ChartHandle(m *tb.Message) {
+	match := chartRegexp.FindStringSubmatch(m.Text)
+	if len(match) == 0 {
+		_, err := t.client.Send(m.Sender, "Invalid command.\nExample of usage:\n`/chart BTCUSDT`")
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	if !t.chartLimiter.Allow(m.Sender.ID, time.Now()) {
+		_, err := t.client.Send(m.Sender, fmt.Sprintf("Too many requests, wait %s between charts.",
+			t.chartLimiter.interval))
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	pair := strings.ToUpper(match[chartRegexp.SubexpIndex("pair")])
+	var buffer bytes.Buffer
+	err := t.chart.RenderPNG(&buffer, pair, t.chartCandles)
+	if err != nil {
+		_, err := t.client.Send(m.Sender, fmt.Sprintf("Chart not available for `%s`.", pair))
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	photo := &tb.Photo{File: tb.FromReader(&buffer), Caption: fmt.Sprintf("*%s*", pair)}
+	_, err = t.client.Send(m.Sender, photo)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// authorized returns true if the user is in the settings, the updates of other users are
+// also discarded by the poller
+func (t telegram) authorized(user *tb.User) bool {
+	if user == nil {
+		return false
+	}
+
+	for _, id := range t.settings.Telegram.Users {
+		if int64(id) == user.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// restrict wraps the handler of a command with the role check of commandRoles, the users without the required
+// role are refused and the attempt is logged
+func (t telegram) restrict(command string, handler func(m *tb.Message)) func(m *tb.Message) {
+	required := commandRoles[command]
+	return func(m *tb.Message) {
+		if !t.authorized(m.Sender) {
+			log.Error("invalid user, ", m)
+			return
+		}
+
+		role := t.settings.Telegram.Role(int(m.Sender.ID))
+		if !role.Allows(required) {
+			log.Warnf("[TELEGRAM] user %d (%s) with role %s not allowed to use %s", m.Sender.ID,
+				m.Sender.Username, role, command)
+			_, err := t.client.Send(m.Sender, fmt.Sprintf("Sorry, the `%s` command requires the %s role.",
+				command, required), t.defaultMenu)
+			if err != nil {
+				log.Error(err)
+			}
+			return
+		}
+
+		handler(m)
+	}
+}
+
 func (t telegram) StatusHandle(m *tb.Message) {
 	status := t.orderController.Status()
+	if t.pauser.Paused() {
+		status = order.StatusPaused
+	}
 	_, err := t.client.Send(m.Sender, fmt.Sprintf("Status: `%s`", status))
 	if err != nil {
 		log.Error(err)
 	}
 }
 
+// StartHandle resumes the bot paused by StopHandle
 func (t telegram) StartHandle(m *tb.Message) {
-	if t.orderController.Status() == order.StatusRunning {
+	if !t.pauser.Paused() {
 		_, err := t.client.Send(m.Sender, "Bot is already running.", t.defaultMenu)
 		if err != nil {
 			log.Error(err)
@@ -331,24 +611,26 @@ func (t telegram) StartHandle(m *tb.Message) {
 		return
 	}
 
-	t.orderController.Start()
-	_, err := t.client.Send(m.Sender, "Bot started.", t.defaultMenu)
+	t.pauser.Resume()
+	_, err := t.client.Send(m.Sender, "Bot resumed.", t.defaultMenu)
 	if err != nil {
 		log.Error(err)
 	}
 }
 
+// StopHandle pauses the bot, the strategy is not called and the new entries are blocked, while the pending
+// orders and the positions are still managed
 func (t telegram) StopHandle(m *tb.Message) {
-	if t.orderController.Status() == order.StatusStopped {
-		_, err := t.client.Send(m.Sender, "Bot is already stopped.", t.defaultMenu)
+	if t.pauser.Paused() {
+		_, err := t.client.Send(m.Sender, "Bot is already paused.", t.defaultMenu)
 		if err != nil {
 			log.Error(err)
 		}
 		return
 	}
 
-	t.orderController.Stop()
-	_, err := t.client.Send(m.Sender, "Bot stopped.", t.defaultMenu)
+	t.pauser.Pause()
+	_, err := t.client.Send(m.Sender, "Bot paused.", t.defaultMenu)
 	if err != nil {
 		log.Error(err)
 	}
@@ -379,9 +661,9 @@ func (t telegram) OnError(err error) {
 		Quantity: %.4f
 		-----
 		%s`, title, orderError.Pair, orderError.Quantity, orderError.Err)
-		t.Notify(message)
+		t.notifyUrgent(message)
 		return
 	}
 
-	t.Notify(fmt.Sprintf("%s\n-----\n%s", title, err))
+	t.notifyUrgent(fmt.Sprintf("%s\n-----\n%s", title, err))
 }
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/tucnak/telebot.v2"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// telegramServer records the text of the messages sent by the bot
+type telegramServer struct {
+	mtx      sync.Mutex
+	messages []string
+}
+
+func (s *telegramServer) Messages() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func newTestTelegram(t *testing.T, settings model.Settings) (*telegram, *telegramServer) {
+	recorder := new(telegramServer)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		recorder.mtx.Lock()
+		recorder.messages = append(recorder.messages, payload["text"].(string))
+		recorder.mtx.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := tb.NewBot(tb.Settings{URL: server.URL, Token: "token", Offline: true})
+	require.NoError(t, err)
+
+	return &telegram{client: client, settings: settings, defaultMenu: &tb.ReplyMarkup{}}, recorder
+}
+
+type pauser struct {
+	paused bool
+}
+
+func (p *pauser) Pause()       { p.paused = true }
+func (p *pauser) Resume()      { p.paused = false }
+func (p *pauser) Paused() bool { return p.paused }
+
+func TestTelegram_Pause(t *testing.T) {
+	bot, server := newTestTelegram(t, model.Settings{})
+	bot.pauser = new(pauser)
+	message := &tb.Message{Sender: &tb.User{ID: 1}}
+
+	bot.StopHandle(message)
+	require.True(t, bot.pauser.Paused())
+	bot.StopHandle(message)
+	require.True(t, bot.pauser.Paused())
+
+	bot.StartHandle(message)
+	require.False(t, bot.pauser.Paused())
+	bot.StartHandle(message)
+
+	require.Equal(t, []string{"Bot paused.", "Bot is already paused.", "Bot resumed.", "Bot is already running."},
+		server.Messages())
+}
+
+func TestTelegram_Restrict(t *testing.T) {
+	bot, server := newTestTelegram(t, model.Settings{Telegram: model.TelegramSettings{
+		Users: []int{1, 2, 3},
+		Roles: map[int]model.TelegramRole{1: model.TelegramRoleViewer, 2: model.TelegramRoleTrader},
+	}})
+
+	var calls []int64
+	handler := bot.restrict("/buy", func(m *tb.Message) {
+		calls = append(calls, m.Sender.ID)
+	})
+
+	handler(&tb.Message{Sender: &tb.User{ID: 1}})
+	handler(&tb.Message{Sender: &tb.User{ID: 2}})
+	handler(&tb.Message{Sender: &tb.User{ID: 3}})
+	handler(&tb.Message{Sender: &tb.User{ID: 4}})
+
+	// the viewer is refused, the trader and the admin (without role) are allowed, unknown users are ignored
+	require.Equal(t, []int64{2, 3}, calls)
+	require.Equal(t, []string{"Sorry, the `/buy` command requires the trader role."}, server.Messages())
+}
+
+func TestTelegram_Help(t *testing.T) {
+	bot, server := newTestTelegram(t, model.Settings{Telegram: model.TelegramSettings{
+		Users: []int{1, 2},
+		Roles: map[int]model.TelegramRole{1: model.TelegramRoleViewer},
+	}})
+	bot.commands = []tb.Command{
+		{Text: "/help", Description: "Display help instructions"},
+		{Text: "/stop", Description: "Pause the strategy and the new entries"},
+		{Text: "/status", Description: "Check bot status"},
+		{Text: "/buy", Description: "open a buy order"},
+	}
+
+	bot.HelpHandle(&tb.Message{Sender: &tb.User{ID: 1}})
+	bot.HelpHandle(&tb.Message{Sender: &tb.User{ID: 2}})
+
+	require.Equal(t, []string{
+		"/help - Display help instructions\n/status - Check bot status",
+		"/help - Display help instructions\n/stop - Pause the strategy and the new entries\n" +
+			"/status - Check bot status\n/buy - open a buy order",
+	}, server.Messages())
+}
@@ -2,8 +2,10 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,6 +15,7 @@ import (
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/service"
 	"github.com/rodrigo-brito/ninjabot/storage"
+	"github.com/rodrigo-brito/ninjabot/strategy"
 
 	"github.com/olekukonko/tablewriter"
 	log "github.com/sirupsen/logrus"
@@ -29,6 +32,7 @@ type summary struct {
 	LoseShort        []float64
 	LoseShortPercent []float64
 	Volume           float64
+	Fee              float64
 }
 
 func (s summary) Win() []float64 {
@@ -106,6 +110,7 @@ func (s summary) String() string {
 		{"Payoff", fmt.Sprintf("%.1f", s.Payoff()*100)},
 		{"Profit", fmt.Sprintf("%.4f %s", s.Profit(), quote)},
 		{"Volume", fmt.Sprintf("%.4f %s", s.Volume, quote)},
+		{"Fees (net)", fmt.Sprintf("%.4f %s", s.Fee, quote)},
 	}
 	table.AppendBulk(data)
 	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
@@ -113,12 +118,28 @@ func (s summary) String() string {
 	return tableString.String()
 }
 
+var (
+	ErrMaxOpenPositions  = errors.New("max open positions reached")
+	ErrMaxOpenOrders     = errors.New("max open orders reached")
+	ErrNoPosition        = errors.New("no open position")
+	ErrSignalDebounced   = errors.New("signal debounced")
+	ErrPaused            = errors.New("trading paused")
+	ErrTradeInterval     = errors.New("min trade interval")
+	ErrDailyLossLimit    = errors.New("daily loss limit reached")
+	ErrMaxTradeLoss      = errors.New("max trade loss reached")
+	ErrMaxSlippage       = errors.New("max market slippage exceeded")
+	ErrMinProfitExit     = errors.New("exit below min profit")
+	ErrSignalUnconfirmed = errors.New("signal not confirmed")
+)
+
 type Status string
 
 const (
 	StatusRunning Status = "running"
 	StatusStopped Status = "stopped"
 	StatusError   Status = "error"
+	// StatusPaused is the status of a running bot without new entries, see Pause
+	StatusPaused Status = "paused"
 )
 
 type Result struct {
@@ -134,6 +155,7 @@ type Position struct {
 	Side      model.SideType
 	AvgPrice  float64
 	Quantity  float64
+	Fee       float64
 	CreatedAt time.Time
 }
 
@@ -191,6 +213,68 @@ type Controller struct {
 	status         Status
 
 	position map[string]*Position
+
+	maxOpenPositions int
+	maxOpenOrders    int
+	makerFee         float64
+	takerFee         float64
+	feeSchedule      model.FeeSchedule
+	shrinkToFit      bool
+	debounce         time.Duration
+	signals          map[string]signal
+	lastCandleTime   time.Time
+	validators       []Validator
+	pacer            *pacer
+
+	closeOnOpposite   bool
+	reverseOnOpposite bool
+	paused            bool
+	minTradeInterval  time.Duration
+	lastTrade         map[string]time.Time
+	clock             func() time.Time
+	metricsFilter     MetricsFilter
+
+	dailyLossLimit float64
+	maxTradeLoss   float64
+	lossDay        time.Time
+	dailyProfit    map[string]float64
+	lossHalt       error
+
+	signalLog   bool
+	signalNotes map[string]string
+
+	maxSlippage float64
+	converter   *exchange.Converter
+
+	minProfitExit float64
+	minProfitStop float64
+
+	signalConfirmation int
+	confirmations      map[string]*confirmation
+}
+
+// MetricsFilter returns false for the trades excluded from the Results, by the pair and the time of the order or
+// the entry of the position, e.g. the trades of the warm up period of the strategy
+type MetricsFilter func(pair string, t time.Time) bool
+
+// Validator checks an order before it is sent to the exchange, returning an error blocks the order.
+// The order is not created yet, only the pair, side, type, quantity, price and time are set.
+type Validator func(order model.Order) error
+
+// confirmation is the streak of consecutive candles with entry requests of the same side, see
+// SetSignalConfirmation
+type confirmation struct {
+	side    model.SideType
+	candles int
+	// requested is true when the side was requested in the current candle
+	requested bool
+}
+
+// signal is the last order of a pair and the position quantity after it
+type signal struct {
+	side     model.SideType
+	time     time.Time
+	quantity float64
 }
 
 func NewController(ctx context.Context, exchange service.Exchange, storage storage.Storage,
@@ -206,297 +290,1722 @@ func NewController(ctx context.Context, exchange service.Exchange, storage stora
 		tickerInterval: time.Second,
 		finish:         make(chan bool),
 		position:       make(map[string]*Position),
+		signals:        make(map[string]signal),
+		lastTrade:      make(map[string]time.Time),
+		signalNotes:    make(map[string]string),
+		confirmations:  make(map[string]*confirmation),
+		clock:          time.Now,
 	}
 }
 
-func (c *Controller) SetNotifier(notifier service.Notifier) {
-	c.notifier = notifier
-}
-
-func (c *Controller) OnCandle(candle model.Candle) {
-	c.lastPrice[candle.Pair] = candle.Close
-}
-
-func (c *Controller) updatePosition(o *model.Order) {
-	// get filled orders before the current order
-	position, ok := c.position[o.Pair]
-	if !ok {
-		c.position[o.Pair] = &Position{
-			AvgPrice:  o.Price,
-			Quantity:  o.Quantity,
-			CreatedAt: o.CreatedAt,
-			Side:      o.Side,
-		}
+// SetOrderRate limits the order submissions and cancellations sent to the exchange to the given number per
+// period, e.g. SetOrderRate(10, time.Second). Bursts of orders are spaced in the submission order, and the
+// waiting orders fail with the context error when the controller context is canceled. The slot is reserved before
+// the order checks, so orders blocked by the checks also use it. Zero disables the limit
+func (c *Controller) SetOrderRate(limit int, period time.Duration) {
+	if limit <= 0 || period <= 0 {
+		c.pacer = nil
 		return
 	}
+	c.pacer = newPacer(limit, period)
+}
 
-	result, closed := position.Update(o)
-	if closed {
-		delete(c.position, o.Pair)
+// pace waits for the order rate limit, see SetOrderRate. It is called before the controller lock is taken, so
+// the waiting orders do not block the order updates and the other calls of the controller
+func (c *Controller) pace() error {
+	if c.pacer == nil {
+		return nil
 	}
+	return c.pacer.wait(c.ctx)
+}
 
-	if result != nil {
-		// TODO: replace by a slice of Result
-		if result.ProfitPercent > 0 {
-			if result.Side == model.SideTypeBuy {
-				c.Results[o.Pair].WinLong = append(c.Results[o.Pair].WinLong, result.ProfitValue)
-				c.Results[o.Pair].WinLongPercent = append(c.Results[o.Pair].WinLongPercent, result.ProfitPercent)
-			} else {
-				c.Results[o.Pair].WinShort = append(c.Results[o.Pair].WinShort, result.ProfitValue)
-				c.Results[o.Pair].WinShortPercent = append(c.Results[o.Pair].WinShortPercent, result.ProfitPercent)
-			}
-		} else {
-			if result.Side == model.SideTypeBuy {
-				c.Results[o.Pair].LoseLong = append(c.Results[o.Pair].LoseLong, result.ProfitValue)
-				c.Results[o.Pair].LoseLongPercent = append(c.Results[o.Pair].LoseLongPercent, result.ProfitPercent)
-			} else {
-				c.Results[o.Pair].LoseShort = append(c.Results[o.Pair].LoseShort, result.ProfitValue)
-				c.Results[o.Pair].LoseShortPercent = append(c.Results[o.Pair].LoseShortPercent, result.ProfitPercent)
-			}
-		}
-
-		_, quote := exchange.SplitAssetQuote(o.Pair)
-		c.notify(fmt.Sprintf(
-			"[PROFIT] %f %s (%f %%)\n`%s`",
-			result.ProfitValue,
-			quote,
-			result.ProfitPercent*100,
-			c.Results[o.Pair].String(),
-		))
+// paceLocked waits for the order rate limit of an additional exchange call of an operation that holds the
+// controller lock, e.g. the retry of shrink to fit, releasing the lock while it waits
+func (c *Controller) paceLocked() error {
+	if c.pacer == nil {
+		return nil
 	}
+
+	c.mtx.Unlock()
+	defer c.mtx.Lock()
+	return c.pacer.wait(c.ctx)
 }
 
-func (c *Controller) notify(message string) {
-	log.Info(message)
-	if c.notifier != nil {
-		c.notifier.Notify(message)
-	}
+// SetMaxOpenPositions limits the number of pairs with open positions, new entries
+// in other pairs are blocked once the limit is reached. Zero disables the limit
+func (c *Controller) SetMaxOpenPositions(n int) {
+	c.maxOpenPositions = n
 }
 
-func (c *Controller) notifyError(err error) {
-	log.Error(err)
-	if c.notifier != nil {
-		c.notifier.OnError(err)
-	}
+// SetMaxOpenOrders limits the number of pending orders across all pairs, new entry
+// orders are blocked once the limit is reached. Zero disables the limit
+func (c *Controller) SetMaxOpenOrders(n int) {
+	c.maxOpenOrders = n
 }
 
-func (c *Controller) processTrade(order *model.Order) {
-	if order.Status != model.OrderStatusTypeFilled {
-		return
+// checkLimits validates the exposure limits for orders that open or increase a position,
+// orders that reduce a position are always allowed
+func (c *Controller) checkLimits(side model.SideType, pair string) error {
+	position, ok := c.position[pair]
+	if ok && position.Side != side {
+		return nil
 	}
 
-	// initializer results map if needed
-	if _, ok := c.Results[order.Pair]; !ok {
-		c.Results[order.Pair] = &summary{Pair: order.Pair}
+	if c.paused {
+		return fmt.Errorf("%w: %s %s blocked", ErrPaused, side, pair)
 	}
 
-	// register order volume
-	c.Results[order.Pair].Volume += order.Price * order.Quantity
-
-	// update position size / avg price
-	c.updatePosition(order)
-}
-
-func (c *Controller) updateOrders() {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+	if err := c.checkLossLimits(); err != nil {
+		return fmt.Errorf("%w, %s %s blocked", err, side, pair)
+	}
 
-	//pending orders
-	orders, err := c.storage.Orders(storage.WithStatusIn(
-		model.OrderStatusTypeNew,
-		model.OrderStatusTypePartiallyFilled,
-		model.OrderStatusTypePendingCancel,
-	))
-	if err != nil {
-		c.notifyError(err)
-		c.mtx.Unlock()
-		return
+	if c.maxOpenPositions > 0 && !ok && len(c.position) >= c.maxOpenPositions {
+		return fmt.Errorf("%w: %d positions, %s %s blocked", ErrMaxOpenPositions, len(c.position), side, pair)
 	}
 
-	// For each pending order, check for updates
-	var updatedOrders []model.Order
-	for _, order := range orders {
-		excOrder, err := c.exchange.Order(order.Pair, order.ExchangeID)
+	if c.maxOpenOrders > 0 {
+		orders, err := c.storage.Orders(storage.WithStatusIn(
+			model.OrderStatusTypeNew,
+			model.OrderStatusTypePartiallyFilled,
+		))
 		if err != nil {
-			log.WithField("id", order.ExchangeID).Error("orderControler/get: ", err)
-			continue
+			return err
 		}
 
-		// no status change
-		if excOrder.Status == order.Status {
-			continue
+		if len(orders) >= c.maxOpenOrders {
+			return fmt.Errorf("%w: %d orders, %s %s blocked", ErrMaxOpenOrders, len(orders), side, pair)
 		}
+	}
 
-		excOrder.ID = order.ID
-		err = c.storage.UpdateOrder(&excOrder)
-		if err != nil {
-			c.notifyError(err)
-			continue
-		}
+	return nil
+}
 
-		log.Infof("[ORDER %s] %s", excOrder.Status, excOrder)
-		updatedOrders = append(updatedOrders, excOrder)
-	}
+// SetFees sets the maker and taker fee rates, e.g. 0.001 for 0.1%. They are used to estimate
+// the fee of orders without the fee reported by the exchange
+func (c *Controller) SetFees(maker, taker float64) {
+	c.makerFee = maker
+	c.takerFee = taker
+}
 
-	for _, processOrder := range updatedOrders {
-		c.processTrade(&processOrder)
-		c.orderFeed.Publish(processOrder, false)
-	}
+// SetFeeSchedule overrides the fee rates of SetFees for the pairs in the schedule
+func (c *Controller) SetFeeSchedule(schedule model.FeeSchedule) {
+	c.feeSchedule = schedule
 }
 
-func (c *Controller) Status() Status {
-	return c.status
+// fees returns the maker and taker rates of a pair
+func (c *Controller) fees(pair string) (float64, float64) {
+	return c.feeSchedule.Rates(pair, c.makerFee, c.takerFee)
 }
 
-func (c *Controller) Start() {
-	if c.status != StatusRunning {
-		c.status = StatusRunning
-		go func() {
-			ticker := time.NewTicker(c.tickerInterval)
-			for {
-				select {
-				case <-ticker.C:
-					c.updateOrders()
-				case <-c.finish:
-					ticker.Stop()
-					return
-				}
-			}
-		}()
-		log.Info("Bot started.")
+// estimateFee returns the fee paid by the order in quote, limit orders are charged with the maker
+// rate and other order types with the taker rate. Negative fees are rebates
+func (c *Controller) estimateFee(order *model.Order) float64 {
+	if order.Fee != 0 {
+		return order.Fee
+	}
+
+	maker, rate := c.fees(order.Pair)
+	if order.Type == model.OrderTypeLimit || order.Type == model.OrderTypeLimitMaker {
+		rate = maker
 	}
+	return order.Price * order.Quantity * rate
 }
 
-func (c *Controller) Stop() {
-	if c.status == StatusRunning {
-		c.status = StatusStopped
-		c.updateOrders()
-		c.finish <- true
-		log.Info("Bot stopped.")
+// BreakevenPrice returns the exit price of the current position that covers the entry fees and
+// the expected exit fee, calculated with the taker rate. For long positions the breakeven is above
+// the average entry price, and for short positions it is below
+func (c *Controller) BreakevenPrice(pair string) (float64, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	position, ok := c.position[pair]
+	if !ok || position.Quantity == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNoPosition, pair)
 	}
+
+	return c.breakevenPrice(pair, position), nil
 }
 
-func (c *Controller) Account() (model.Account, error) {
-	return c.exchange.Account()
+// breakevenPrice returns the breakeven price of the position, see BreakevenPrice
+func (c *Controller) breakevenPrice(pair string, position *Position) float64 {
+	_, taker := c.fees(pair)
+	cost := position.AvgPrice * position.Quantity
+	if position.Side == model.SideTypeBuy {
+		return (cost + position.Fee) / (position.Quantity * (1 - taker))
+	}
+	return (cost - position.Fee) / (position.Quantity * (1 + taker))
 }
 
-func (c *Controller) Position(pair string) (asset, quote float64, err error) {
-	return c.exchange.Position(pair)
+// SetMinProfitExit blocks the market and limit orders that reduce a position at a price below the breakeven
+// price plus the given basis points (e.g. 20 for 0.2%), so the signal exits never realize a loss after the fees.
+// Stop orders, OCO orders, trailing stops and FlattenAll are not blocked, so the stop loss of the position is
+// always honored. Zero disables the check
+func (c *Controller) SetMinProfitExit(bps float64) {
+	c.minProfitExit = bps
 }
 
-func (c *Controller) LastQuote(pair string) (float64, error) {
-	return c.exchange.LastQuote(c.ctx, pair)
+// SetMinProfitStopLoss overrides SetMinProfitExit for the exits with a loss beyond the given basis points from the
+// average entry price (e.g. 300 for 3%), so a signal exit is never blocked when the position is in a deep loss.
+// Zero disables the override
+func (c *Controller) SetMinProfitStopLoss(bps float64) {
+	c.minProfitStop = bps
 }
 
-func (c *Controller) PositionValue(pair string) (float64, error) {
-	asset, _, err := c.exchange.Position(pair)
-	if err != nil {
-		return 0, err
+// checkMinProfit validates the exit price of an order that reduces a position, see SetMinProfitExit. Market
+// orders without a price are checked with the last price of the pair
+func (c *Controller) checkMinProfit(side model.SideType, pair string, price float64) error {
+	position, ok := c.position[pair]
+	if c.minProfitExit <= 0 || !ok || position.Side == side || position.Quantity == 0 {
+		return nil
 	}
-	return asset * c.lastPrice[pair], nil
-}
 
-func (c *Controller) Order(pair string, id int64) (model.Order, error) {
-	return c.exchange.Order(pair, id)
+	if price == 0 {
+		price = c.lastPrice[pair]
+	}
+	if price == 0 {
+		var err error
+		if price, err = c.exchange.LastPrice(pair); err != nil {
+			return err
+		}
+	}
+
+	target := c.breakevenPrice(pair, position)
+	stop := c.minProfitStop / 10000
+	if position.Side == model.SideTypeBuy {
+		target *= 1 + c.minProfitExit/10000
+		if price >= target || (stop > 0 && price <= position.AvgPrice*(1-stop)) {
+			return nil
+		}
+	} else {
+		target *= 1 - c.minProfitExit/10000
+		if price <= target || (stop > 0 && price >= position.AvgPrice*(1+stop)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s %s at %f, min exit price %f", ErrMinProfitExit, side, pair, price, target)
 }
 
-func (c *Controller) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
-	stopLimit float64) ([]model.Order, error) {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+// SetShrinkToFit retries market and limit orders rejected due to insufficient funds with the
+// maximum quantity affordable by the current balance, rounded to the lot size
+func (c *Controller) SetShrinkToFit(enabled bool) {
+	c.shrinkToFit = enabled
+}
 
-	log.Infof("[ORDER] Creating OCO order for %s", pair)
-	orders, err := c.exchange.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+// affordableQuantity returns the maximum quantity lower than the requested size that the current
+// balance can afford, including the fee. It returns false if there is no valid quantity
+func (c *Controller) affordableQuantity(side model.SideType, pair string, size, price, fee float64) (float64, bool) {
+	asset, quote, err := c.exchange.Position(pair)
 	if err != nil {
-		c.notifyError(err)
-		return nil, err
+		log.Error(err)
+		return 0, false
 	}
 
-	for i := range orders {
-		err := c.storage.CreateOrder(&orders[i])
-		if err != nil {
-			c.notifyError(err)
-			return nil, err
+	available := asset
+	if side == model.SideTypeBuy {
+		if price == 0 {
+			price = c.lastPrice[pair]
 		}
-		go c.orderFeed.Publish(orders[i], true)
+		if price == 0 {
+			price, err = c.exchange.LastQuote(c.ctx, pair)
+			if err != nil {
+				log.Error(err)
+				return 0, false
+			}
+		}
+		available = quote / (price * (1 + fee))
 	}
 
-	return orders, nil
+	info := c.exchange.AssetsInfo(pair)
+	quantity := exchange.RoundQuantity(info, math.Min(available, size))
+	if quantity <= 0 || quantity >= size || quantity < info.MinQuantity {
+		return 0, false
+	}
+	return quantity, true
 }
 
-func (c *Controller) CreateOrderLimit(side model.SideType, pair string, size, limit float64) (model.Order, error) {
+// SetSignalDebounce suppresses entry orders with the same side of the last order of the pair, within the
+// given window, when the position did not change since then. Use AllowScaleIn to place repeated entries
+func (c *Controller) SetSignalDebounce(window time.Duration) {
+	c.debounce = window
+}
+
+// AllowScaleIn allows the next entry order of the pair, even if it is a repeated signal
+func (c *Controller) AllowScaleIn(pair string) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
+	delete(c.signals, pair)
+}
 
-	log.Infof("[ORDER] Creating LIMIT %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderLimit(side, pair, size, limit)
-	if err != nil {
-		c.notifyError(err)
-		return model.Order{}, err
-	}
+// Pause blocks new entry orders until Resume is called. Orders that reduce or close a position are
+// still accepted, and the pending orders keep being updated
+func (c *Controller) Pause() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.paused = true
+}
 
-	err = c.storage.CreateOrder(&order)
-	if err != nil {
-		c.notifyError(err)
-		return model.Order{}, err
-	}
-	go c.orderFeed.Publish(order, true)
-	log.Infof("[ORDER CREATED] %s", order)
-	return order, nil
+// Resume accepts new entry orders again, see Pause
+func (c *Controller) Resume() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.paused = false
 }
 
-func (c *Controller) CreateOrderMarketQuote(side model.SideType, pair string, amount float64) (model.Order, error) {
+// Paused returns true if new entry orders are blocked, see Pause
+func (c *Controller) Paused() bool {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
+	return c.paused
+}
 
-	log.Infof("[ORDER] Creating MARKET %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderMarketQuote(side, pair, amount)
-	if err != nil {
-		c.notifyError(err)
-		return model.Order{}, err
+// SetMinTradeInterval rejects entry orders of a pair within the given interval since its last filled order,
+// to avoid overtrading. Orders that reduce or close a position are not affected. Zero disables the limit
+func (c *Controller) SetMinTradeInterval(interval time.Duration) {
+	c.minTradeInterval = interval
+}
+
+// SetLossLimits blocks new entry orders until the next UTC day when the realized profit of the day reaches
+// the daily loss limit, or when a single trade loses the max trade loss, both in the quote currency (e.g. 100
+// for 100 USDT). The realized profit of the day is tracked per quote currency, so the trades of pairs quoted in
+// different currencies are never summed. Orders that reduce or close a position are still accepted. Zero disables
+// a limit
+func (c *Controller) SetLossLimits(dailyLoss, tradeLoss float64) {
+	c.dailyLossLimit = dailyLoss
+	c.maxTradeLoss = tradeLoss
+}
+
+// resetLossDay clears the realized profit of the day and unblocks the entries at UTC midnight
+func (c *Controller) resetLossDay() {
+	day := c.now().UTC().Truncate(24 * time.Hour)
+	if day.Equal(c.lossDay) {
+		return
 	}
 
-	err = c.storage.CreateOrder(&order)
-	if err != nil {
-		c.notifyError(err)
-		return model.Order{}, err
+	if c.lossHalt != nil {
+		log.Infof("[RISK] new day %s, entry orders unblocked", day.Format("2006-01-02"))
 	}
+	c.lossDay = day
+	c.dailyProfit = make(map[string]float64)
+	c.lossHalt = nil
+}
 
-	// calculate profit
-	c.processTrade(&order)
-	go c.orderFeed.Publish(order, true)
-	log.Infof("[ORDER CREATED] %s", order)
-	return order, err
+// checkLossLimits returns the breached loss limit of the day, see SetLossLimits
+func (c *Controller) checkLossLimits() error {
+	if c.dailyLossLimit <= 0 && c.maxTradeLoss <= 0 {
+		return nil
+	}
+
+	c.resetLossDay()
+	return c.lossHalt
 }
 
-func (c *Controller) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+// trackLoss adds the result of a trade to the realized profit of the day, and blocks the entries when a loss
+// limit is breached, see SetLossLimits
+func (c *Controller) trackLoss(result *Result) {
+	if c.dailyLossLimit <= 0 && c.maxTradeLoss <= 0 {
+		return
+	}
 
-	log.Infof("[ORDER] Creating MARKET %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderMarket(side, pair, size)
-	if err != nil {
-		c.notifyError(err)
-		return model.Order{}, err
+	_, quote := exchange.SplitAssetQuote(result.Pair)
+	c.resetLossDay()
+	c.dailyProfit[quote] += result.ProfitValue
+	if c.lossHalt != nil {
+		return
 	}
 
-	err = c.storage.CreateOrder(&order)
-	if err != nil {
-		c.notifyError(err)
-		return model.Order{}, err
+	switch {
+	case c.maxTradeLoss > 0 && -result.ProfitValue >= c.maxTradeLoss:
+		c.lossHalt = fmt.Errorf("%w: %s trade lost %.4f %s, max %.4f", ErrMaxTradeLoss, result.Pair,
+			-result.ProfitValue, quote, c.maxTradeLoss)
+	case c.dailyLossLimit > 0 && -c.dailyProfit[quote] >= c.dailyLossLimit:
+		c.lossHalt = fmt.Errorf("%w: %.4f %s lost today, limit %.4f", ErrDailyLossLimit, -c.dailyProfit[quote],
+			quote, c.dailyLossLimit)
+	default:
+		return
 	}
 
-	// calculate profit
-	c.processTrade(&order)
-	go c.orderFeed.Publish(order, true)
+	c.notify(fmt.Sprintf("[RISK] %s, new entries blocked until %s", c.lossHalt,
+		c.lossDay.Add(24*time.Hour).Format("2006-01-02 15:04 MST")))
+}
+
+// SetMetricsFilter excludes trades from the Results: the volume and fees of the orders and the results of the
+// positions are ignored when the filter returns false for the order time and the position entry time. Nil
+// includes all trades
+func (c *Controller) SetMetricsFilter(filter MetricsFilter) {
+	c.metricsFilter = filter
+}
+
+// inMetrics returns true if the trade at the given time is included in the Results, see SetMetricsFilter
+func (c *Controller) inMetrics(pair string, t time.Time) bool {
+	return c.metricsFilter == nil || c.metricsFilter(pair, t)
+}
+
+// slippageDepthLimit is the number of order book levels used to estimate the slippage of market orders
+const slippageDepthLimit = 100
+
+// SetMaxMarketSlippage aborts the market orders that open or increase a position with an estimated slippage above
+// the given basis points (e.g. 50 for 0.5%), before they are sent to the exchange. The slippage is estimated by
+// walking the order book of exchanges that implement exchange.DepthFetcher, and orders larger than the order book
+// depth are aborted. Without an order book, the check is skipped. Orders that reduce or close a position are never
+// aborted. Zero disables the check
+func (c *Controller) SetMaxMarketSlippage(bps float64) {
+	c.maxSlippage = bps
+}
+
+// checkSlippage rejects a market order that opens or increases a position with the estimated slippage above the
+// max slippage
+func (c *Controller) checkSlippage(side model.SideType, pair string, size float64) error {
+	if c.maxSlippage <= 0 {
+		return nil
+	}
+
+	if position, ok := c.position[pair]; ok && position.Side != side {
+		return nil
+	}
+
+	slippage, ok, err := c.estimateSlippage(side, pair, size)
+	if err != nil {
+		return fmt.Errorf("%w: %s %s: %v", ErrMaxSlippage, side, pair, err)
+	}
+
+	if !ok {
+		log.Debugf("[ORDER] no order book of %s, slippage not checked", pair)
+		return nil
+	}
+
+	if bps := slippage * 10000; bps > c.maxSlippage {
+		return fmt.Errorf("%w: %s %s estimated %.1f bps, max %.1f bps", ErrMaxSlippage, side, pair, bps,
+			c.maxSlippage)
+	}
+	return nil
+}
+
+// estimateSlippage returns the difference between the average price of the order in the order book and the best
+// price, as a percentage of the best price. It returns false without order book, e.g. in the paper wallet without
+// depth snapshots
+func (c *Controller) estimateSlippage(side model.SideType, pair string, size float64) (float64, bool, error) {
+	fetcher, ok := c.exchange.(exchange.DepthFetcher)
+	if !ok {
+		return 0, false, nil
+	}
+
+	depth, err := fetcher.Depth(pair, slippageDepthLimit)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	levels := depth.Asks
+	if side == model.SideTypeSell {
+		levels = depth.Bids
+	}
+
+	if len(levels) == 0 {
+		return 0, false, nil
+	}
+
+	cost, filled := 0.0, 0.0
+	for _, level := range levels {
+		quantity := math.Min(level.Quantity, size-filled)
+		cost += quantity * level.Price
+		filled += quantity
+		if filled >= size {
+			break
+		}
+	}
+
+	if filled < size {
+		return 0, true, fmt.Errorf("order size %f above the order book depth %f", size, filled)
+	}
+	return math.Abs(cost/filled-levels[0].Price) / levels[0].Price, true, nil
+}
+
+// SetSignalLog records the signals of the strategy in the storage: every market, limit and OCO order with its
+// outcome (executed or blocked, with the error), and the signals skipped by the strategy, see SkipSignal
+func (c *Controller) SetSignalLog(enabled bool) {
+	c.signalLog = enabled
+}
+
+// AnnotateSignal sets the note of the next order of the pair in the signal log, e.g. the rule of the strategy
+// that created the order
+func (c *Controller) AnnotateSignal(pair, note string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.signalNotes[pair] = note
+}
+
+// SkipSignal records in the signal log a signal suppressed by the strategy, without an order, with the reason
+func (c *Controller) SkipSignal(pair string, side model.SideType, reason string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.signalLog {
+		return
+	}
+
+	c.saveSignal(&model.Signal{
+		Pair:   pair,
+		Side:   side,
+		Status: model.SignalStatusSkipped,
+		Reason: reason,
+	})
+}
+
+// logSignal records an order of the strategy in the signal log with its outcome, see SetSignalLog
+func (c *Controller) logSignal(side model.SideType, pair string, orderType model.OrderType, orderID int64,
+	err error) {
+
+	if !c.signalLog {
+		return
+	}
+
+	signal := &model.Signal{
+		Pair:    pair,
+		Side:    side,
+		Type:    orderType,
+		Status:  model.SignalStatusExecuted,
+		OrderID: orderID,
+	}
+	if err != nil {
+		signal.Status = model.SignalStatusBlocked
+		signal.Reason = err.Error()
+	}
+	c.saveSignal(signal)
+}
+
+// saveSignal saves a signal with the pending note of the pair
+func (c *Controller) saveSignal(signal *model.Signal) {
+	signal.Time = c.now()
+	signal.Note = c.signalNotes[signal.Pair]
+	delete(c.signalNotes, signal.Pair)
+
+	if err := c.storage.CreateSignal(signal); err != nil {
+		log.Errorf("[SIGNAL] %s: %v", signal.Pair, err)
+	}
+}
+
+// SetClock sets the time source used without candles, e.g. in tests. Default: time.Now
+func (c *Controller) SetClock(clock func() time.Time) {
+	c.clock = clock
+}
+
+// checkTradeInterval rejects entry orders within the min trade interval since the last trade of the pair
+func (c *Controller) checkTradeInterval(side model.SideType, pair string) error {
+	if c.minTradeInterval == 0 {
+		return nil
+	}
+
+	if position, ok := c.position[pair]; ok && position.Side != side {
+		return nil
+	}
+
+	last, ok := c.lastTrade[pair]
+	elapsed := c.now().Sub(last)
+	if !ok || elapsed >= c.minTradeInterval {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s %s %s after the last trade, min %s", ErrTradeInterval, side, pair, elapsed,
+		c.minTradeInterval)
+}
+
+func (c *Controller) now() time.Time {
+	if c.lastCandleTime.IsZero() {
+		return c.clock()
+	}
+	return c.lastCandleTime
+}
+
+// positionQuantity returns the net quantity of the position, negative for short positions
+func (c *Controller) positionQuantity(pair string) float64 {
+	position, ok := c.position[pair]
+	if !ok {
+		return 0
+	}
+	if position.Side == model.SideTypeSell {
+		return -position.Quantity
+	}
+	return position.Quantity
+}
+
+func (c *Controller) registerSignal(side model.SideType, pair string) {
+	// an executed order restarts the confirmation of the next entry
+	delete(c.confirmations, pair)
+
+	if c.debounce == 0 {
+		return
+	}
+
+	c.signals[pair] = signal{
+		side:     side,
+		time:     c.now(),
+		quantity: c.positionQuantity(pair),
+	}
+}
+
+// checkDebounce rejects entry orders that repeat the last signal of the pair within the debounce window
+func (c *Controller) checkDebounce(side model.SideType, pair string) error {
+	if c.debounce == 0 {
+		return nil
+	}
+
+	if position, ok := c.position[pair]; ok && position.Side != side {
+		return nil
+	}
+
+	last, ok := c.signals[pair]
+	if !ok || last.side != side || c.now().Sub(last.time) >= c.debounce ||
+		last.quantity != c.positionQuantity(pair) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s %s repeated within %s", ErrSignalDebounced, side, pair, c.debounce)
+}
+
+// SetSignalConfirmation executes the entry orders only when the strategy requests the same side in n consecutive
+// candles of the pair, the requests of the previous candles are blocked with ErrSignalUnconfirmed. The repeated
+// requests of a candle count once, and the streak restarts after an executed order. Orders that reduce a position
+// are not confirmed. Only the orders of the StrategyBroker are confirmed, the orders sent to the controller
+// directly, e.g. the manual orders of Telegram, are executed immediately. Values below 2 disable the confirmation
+func (c *Controller) SetSignalConfirmation(n int) {
+	c.signalConfirmation = n
+}
+
+// checkConfirmation registers the entry request of the current candle and rejects it until the side is requested
+// in the number of candles of SetSignalConfirmation
+func (c *Controller) checkConfirmation(side model.SideType, pair string) error {
+	if c.signalConfirmation < 2 {
+		return nil
+	}
+
+	if position, ok := c.position[pair]; ok && position.Side != side {
+		return nil
+	}
+
+	streak, ok := c.confirmations[pair]
+	switch {
+	case !ok || streak.side != side:
+		streak = &confirmation{side: side, candles: 1, requested: true}
+		c.confirmations[pair] = streak
+	case !streak.requested:
+		streak.candles++
+		streak.requested = true
+	}
+
+	if streak.candles < c.signalConfirmation {
+		return fmt.Errorf("%w: %s %s requested in %d of %d candles", ErrSignalUnconfirmed, side, pair,
+			streak.candles, c.signalConfirmation)
+	}
+	return nil
+}
+
+// closeConfirmation ends the candle of the confirmation streak of a pair, a candle without request breaks it
+func (c *Controller) closeConfirmation(pair string) {
+	streak, ok := c.confirmations[pair]
+	if !ok {
+		return
+	}
+
+	if !streak.requested {
+		delete(c.confirmations, pair)
+		return
+	}
+	streak.requested = false
+}
+
+// StrategyBroker is the broker of the strategies, it sends the orders to the controller with the entries confirmed
+// by SetSignalConfirmation. The other methods are the methods of the controller
+type StrategyBroker struct {
+	*Controller
+}
+
+// StrategyBroker returns the broker of the strategies, see StrategyBroker
+func (c *Controller) StrategyBroker() *StrategyBroker {
+	return &StrategyBroker{Controller: c}
+}
+
+// VolatilitySize returns the quantity that risks the amount with a stop at multiplier times the ATR of the period,
+// rounded to the lot size of the pair, see strategy.VolatilitySize
+func (b *StrategyBroker) VolatilitySize(df *model.Dataframe, risk float64, period int,
+	multiplier float64) (quantity, distance float64, err error) {
+
+	return strategy.VolatilitySize(b, df, risk, period, multiplier)
+}
+
+func (b *StrategyBroker) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	return b.createOrderOCO(side, pair, size, price, stop, stopLimit, true)
+}
+
+func (b *StrategyBroker) CreateOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	return b.createOrderOTOCO(side, pair, size, entry, takeProfit, stop, stopLimit, true)
+}
+
+func (b *StrategyBroker) CreateOrderLimit(side model.SideType, pair string, size, limit float64) (model.Order,
+	error) {
+
+	return b.createOrderLimit(side, pair, size, limit, true)
+}
+
+func (b *StrategyBroker) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	return b.createOrderLimitTIF(side, pair, size, limit, timeInForce, true)
+}
+
+func (b *StrategyBroker) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	return b.createOrderMarket(side, pair, size, true)
+}
+
+func (b *StrategyBroker) CreateOrderMarketQuote(side model.SideType, pair string, amount float64) (model.Order,
+	error) {
+
+	return b.createOrderMarketQuote(side, pair, amount, true)
+}
+
+// AddValidators registers validators executed in order before any order is sent to the exchange,
+// the first error blocks the order
+func (c *Controller) AddValidators(validators ...Validator) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.validators = append(c.validators, validators...)
+}
+
+// validate runs the validators with the order to be created. Market orders use the last price of the pair
+// and, for orders by quote amount, the quantity is estimated with it
+func (c *Controller) validate(side model.SideType, orderType model.OrderType, pair string, quantity,
+	price float64) error {
+
+	if len(c.validators) == 0 {
+		return nil
+	}
+
+	if price == 0 {
+		price = c.lastPrice[pair]
+	}
+
+	order := model.Order{
+		Pair:      pair,
+		Side:      side,
+		Type:      orderType,
+		Quantity:  quantity,
+		Price:     price,
+		CreatedAt: c.now(),
+	}
+
+	for _, validator := range c.validators {
+		if err := validator(order); err != nil {
+			return fmt.Errorf("order blocked: %s %s %s: %w", orderType, side, pair, err)
+		}
+	}
+	return nil
+}
+
+// preflight runs the checks of a new order before it is sent to the exchange: the debounce, the confirmation,
+// the trade interval and the exposure limits of entries, the min profit of limit and market exits, the validators
+// and the slippage of market orders. The first error blocks the order
+func (c *Controller) preflight(side model.SideType, orderType model.OrderType, pair string, size,
+	price float64, confirm bool) error {
+
+	if err := c.checkDebounce(side, pair); err != nil {
+		log.Warn(err)
+		return err
+	}
+
+	if confirm {
+		if err := c.checkConfirmation(side, pair); err != nil {
+			log.Info(err)
+			return err
+		}
+	}
+
+	if err := c.checkTradeInterval(side, pair); err != nil {
+		log.Warn(err)
+		return err
+	}
+
+	if err := c.checkLimits(side, pair); err != nil {
+		c.notifyError(err)
+		return err
+	}
+
+	if orderType == model.OrderTypeLimit || orderType == model.OrderTypeMarket {
+		if err := c.checkMinProfit(side, pair, price); err != nil {
+			log.Warn(err)
+			return err
+		}
+	}
+
+	if err := c.validate(side, orderType, pair, size, price); err != nil {
+		c.notifyError(err)
+		return err
+	}
+
+	if orderType == model.OrderTypeMarket {
+		if err := c.checkSlippage(side, pair, size); err != nil {
+			c.notifyError(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) SetNotifier(notifier service.Notifier) {
+	c.notifier = notifier
+}
+
+func (c *Controller) OnCandle(candle model.Candle) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lastPrice[candle.Pair] = candle.Close
+	if candle.UpdatedAt.After(c.lastCandleTime) {
+		c.lastCandleTime = candle.UpdatedAt
+	}
+	c.closeConfirmation(candle.Pair)
+}
+
+// applyPosition updates the position of the pair with a filled order, returning the result of the reduced
+// position and the entry time of the position
+func (c *Controller) applyPosition(o *model.Order) (*Result, time.Time) {
+	fee := c.estimateFee(o)
+	position, ok := c.position[o.Pair]
+	if !ok {
+		c.position[o.Pair] = &Position{
+			AvgPrice:  o.Price,
+			Quantity:  o.Quantity,
+			Fee:       fee,
+			CreatedAt: o.CreatedAt,
+			Side:      o.Side,
+		}
+		return nil, o.CreatedAt
+	}
+
+	quantity, side, entry := position.Quantity, position.Side, position.CreatedAt
+	result, closed := position.Update(o)
+	if closed {
+		delete(c.position, o.Pair)
+	}
+
+	// keep the entry fees proportional to the position size
+	switch {
+	case o.Side == side:
+		position.Fee += fee
+	case position.Side == side:
+		position.Fee *= position.Quantity / quantity
+	default:
+		position.Fee = fee * position.Quantity / o.Quantity
+	}
+
+	return result, entry
+}
+
+func (c *Controller) updatePosition(o *model.Order) {
+	result, entry := c.applyPosition(o)
+	if result != nil {
+		c.trackLoss(result)
+	}
+
+	if result != nil && c.inMetrics(o.Pair, entry) {
+		// TODO: replace by a slice of Result
+		if result.ProfitPercent > 0 {
+			if result.Side == model.SideTypeBuy {
+				c.Results[o.Pair].WinLong = append(c.Results[o.Pair].WinLong, result.ProfitValue)
+				c.Results[o.Pair].WinLongPercent = append(c.Results[o.Pair].WinLongPercent, result.ProfitPercent)
+			} else {
+				c.Results[o.Pair].WinShort = append(c.Results[o.Pair].WinShort, result.ProfitValue)
+				c.Results[o.Pair].WinShortPercent = append(c.Results[o.Pair].WinShortPercent, result.ProfitPercent)
+			}
+		} else {
+			if result.Side == model.SideTypeBuy {
+				c.Results[o.Pair].LoseLong = append(c.Results[o.Pair].LoseLong, result.ProfitValue)
+				c.Results[o.Pair].LoseLongPercent = append(c.Results[o.Pair].LoseLongPercent, result.ProfitPercent)
+			} else {
+				c.Results[o.Pair].LoseShort = append(c.Results[o.Pair].LoseShort, result.ProfitValue)
+				c.Results[o.Pair].LoseShortPercent = append(c.Results[o.Pair].LoseShortPercent, result.ProfitPercent)
+			}
+		}
+
+		_, quote := exchange.SplitAssetQuote(o.Pair)
+		c.notify(fmt.Sprintf(
+			"[PROFIT] %f %s (%f %%)\n`%s`",
+			result.ProfitValue,
+			quote,
+			result.ProfitPercent*100,
+			c.Results[o.Pair].String(),
+		))
+	}
+}
+
+func (c *Controller) notify(message string) {
+	log.Info(message)
+	if c.notifier != nil {
+		c.notifier.Notify(message)
+	}
+}
+
+func (c *Controller) notifyError(err error) {
+	log.Error(err)
+	if c.notifier != nil {
+		c.notifier.OnError(err)
+	}
+}
+
+func (c *Controller) processTrade(order *model.Order) {
+	if order.Status == model.OrderStatusTypePartiallyFilled {
+		c.processPartialFill(order)
+		return
+	}
+
+	if order.Status != model.OrderStatusTypeFilled {
+		return
+	}
+
+	c.lastTrade[order.Pair] = c.now()
+
+	// initializer results map if needed
+	if _, ok := c.Results[order.Pair]; !ok {
+		c.Results[order.Pair] = &summary{Pair: order.Pair}
+	}
+
+	// register order volume and net fees, including rebates
+	if c.inMetrics(order.Pair, order.CreatedAt) {
+		c.Results[order.Pair].Volume += order.Price * order.Quantity
+		c.Results[order.Pair].Fee += c.estimateFee(order)
+	}
+
+	// update position size / avg price
+	c.updatePosition(order)
+}
+
+// processPartialFill processes the executed quantity of a partially filled market order, the rest of the
+// order is never filled, it expires
+func (c *Controller) processPartialFill(order *model.Order) {
+	if order.Type != model.OrderTypeMarket || order.ExecutedQuantity <= 0 {
+		return
+	}
+
+	executed := *order
+	executed.Status = model.OrderStatusTypeFilled
+	executed.Quantity = order.ExecutedQuantity
+	c.processTrade(&executed)
+	order.Profit, order.ProfitValue = executed.Profit, executed.ProfitValue
+}
+
+func (c *Controller) updateOrders() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	//pending orders
+	orders, err := c.storage.Orders(storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+		model.OrderStatusTypePendingCancel,
+		model.OrderStatusTypePendingNew,
+	))
+	if err != nil {
+		c.notifyError(err)
+		c.mtx.Unlock()
+		return
+	}
+
+	// For each pending order, check for updates
+	var updatedOrders []model.Order
+	for _, order := range orders {
+		excOrder, err := c.exchange.Order(order.Pair, order.ExchangeID)
+		if err != nil {
+			log.WithField("id", order.ExchangeID).Error("orderControler/get: ", err)
+			continue
+		}
+
+		// no status change
+		if excOrder.Status == order.Status {
+			continue
+		}
+
+		// the partial fill of a market order may be reported only with the expired order
+		if excOrder.Status == model.OrderStatusTypeExpired && order.Status != model.OrderStatusTypePartiallyFilled {
+			c.processPartialFill(&excOrder)
+		}
+
+		excOrder.ID = order.ID
+		err = c.storage.UpdateOrder(&excOrder)
+		if err != nil {
+			c.notifyError(err)
+			continue
+		}
+
+		log.Infof("[ORDER %s] %s", excOrder.Status, excOrder)
+		updatedOrders = append(updatedOrders, excOrder)
+	}
+
+	// orders filled by the exchange on its own, e.g. liquidations
+	if fetcher, ok := c.exchange.(exchange.ForcedOrdersFetcher); ok {
+		for _, forced := range fetcher.ForcedOrders() {
+			forced := forced
+			if err := c.storage.CreateOrder(&forced); err != nil {
+				c.notifyError(err)
+				continue
+			}
+
+			log.Infof("[ORDER %s] %s", forced.Status, forced)
+			updatedOrders = append(updatedOrders, forced)
+		}
+	}
+
+	for _, processOrder := range updatedOrders {
+		c.processTrade(&processOrder)
+		c.orderFeed.Publish(processOrder, false)
+	}
+}
+
+func (c *Controller) Status() Status {
+	return c.status
+}
+
+func (c *Controller) Start() {
+	if c.status != StatusRunning {
+		c.status = StatusRunning
+		go func() {
+			ticker := time.NewTicker(c.tickerInterval)
+			for {
+				select {
+				case <-ticker.C:
+					c.updateOrders()
+				case <-c.finish:
+					ticker.Stop()
+					return
+				}
+			}
+		}()
+		log.Info("Bot started.")
+	}
+}
+
+func (c *Controller) Stop() {
+	if c.status == StatusRunning {
+		c.status = StatusStopped
+		c.updateOrders()
+		c.finish <- true
+		log.Info("Bot stopped.")
+	}
+}
+
+func (c *Controller) Account() (model.Account, error) {
+	return c.exchange.Account()
+}
+
+func (c *Controller) AssetsInfo(pair string) model.AssetInfo {
+	return c.exchange.AssetsInfo(pair)
+}
+
+func (c *Controller) Position(pair string) (asset, quote float64, err error) {
+	return c.exchange.Position(pair)
+}
+
+// Balance returns the balance of an asset in the account, zero when the account has no balance of the asset
+func (c *Controller) Balance(asset string) (model.Balance, error) {
+	account, err := c.exchange.Account()
+	if err != nil {
+		return model.Balance{}, err
+	}
+
+	balance, _ := account.Balance(asset, "")
+	balance.Asset = asset
+	return balance, nil
+}
+
+// SetConverter sets the converter of the account equity to the base currency, see Equity
+func (c *Controller) SetConverter(converter *exchange.Converter) {
+	c.converter = converter
+}
+
+// Equity returns the total value of the account: the equity of the paper wallet in its base coin, or the
+// balances converted to the base currency of the converter, see SetConverter
+func (c *Controller) Equity() (float64, error) {
+	if wallet, ok := c.exchange.(*exchange.PaperWallet); ok {
+		return wallet.Equity(), nil
+	}
+
+	if c.converter == nil {
+		return 0, errors.New("equity: base currency not defined")
+	}
+
+	account, err := c.exchange.Account()
+	if err != nil {
+		return 0, err
+	}
+	return c.converter.Equity(c.ctx, account)
+}
+
+func (c *Controller) LastQuote(pair string) (float64, error) {
+	return c.exchange.LastQuote(c.ctx, pair)
+}
+
+func (c *Controller) LastPrice(pair string) (float64, error) {
+	return c.exchange.LastPrice(pair)
+}
+
+func (c *Controller) PositionValue(pair string) (float64, error) {
+	asset, _, err := c.exchange.Position(pair)
+	if err != nil {
+		return 0, err
+	}
+	return asset * c.lastPrice[pair], nil
+}
+
+func (c *Controller) Order(pair string, id int64) (model.Order, error) {
+	return c.exchange.Order(pair, id)
+}
+
+func (c *Controller) OpenOrders(pair string) ([]model.Order, error) {
+	return c.exchange.OpenOrders(pair)
+}
+
+func (c *Controller) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	return c.createOrderOCO(side, pair, size, price, stop, stopLimit, false)
+}
+
+func (c *Controller) createOrderOCO(side model.SideType, pair string, size, price, stop, stopLimit float64,
+	confirm bool) (orders []model.Order, err error) {
+
+	if err := c.pace(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	defer func() {
+		var id int64
+		if len(orders) > 0 {
+			id = orders[0].ID
+		}
+		c.logSignal(side, pair, model.OrderTypeLimitMaker, id, err)
+	}()
+
+	if err := c.preflight(side, model.OrderTypeLimitMaker, pair, size, price, confirm); err != nil {
+		return nil, err
+	}
+
+	if err := c.validate(side, model.OrderTypeStopLoss, pair, size, stopLimit); err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	log.Infof("[ORDER] Creating OCO order for %s", pair)
+	orders, err = c.exchange.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	if err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	for i := range orders {
+		err := c.storage.CreateOrder(&orders[i])
+		if err != nil {
+			c.notifyError(err)
+			return nil, err
+		}
+		go c.orderFeed.Publish(orders[i], true)
+	}
+
+	c.registerSignal(side, pair)
+	return orders, nil
+}
+
+// CreateOrderOTOCO creates a limit entry order with an OCO bracket of take profit and stop loss, placed by the
+// exchange only when the entry is filled, so the position is never unprotected. The entry is checked as a limit
+// order and the brackets as an OCO order. It is supported by exchanges that implement exchange.OTOCOCreator,
+// e.g. Binance spot and the paper wallet
+func (c *Controller) CreateOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	return c.createOrderOTOCO(side, pair, size, entry, takeProfit, stop, stopLimit, false)
+}
+
+func (c *Controller) createOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop,
+	stopLimit float64, confirm bool) (orders []model.Order, err error) {
+
+	creator, ok := c.exchange.(exchange.OTOCOCreator)
+	if !ok {
+		return nil, errors.New("OTOCO orders are not supported by the exchange")
+	}
+
+	if err := c.pace(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	defer func() {
+		var id int64
+		if len(orders) > 0 {
+			id = orders[0].ID
+		}
+		c.logSignal(side, pair, model.OrderTypeLimit, id, err)
+	}()
+
+	if err := c.preflight(side, model.OrderTypeLimit, pair, size, entry, confirm); err != nil {
+		return nil, err
+	}
+
+	bracketSide := model.SideTypeSell
+	if side == model.SideTypeSell {
+		bracketSide = model.SideTypeBuy
+	}
+
+	if err := c.validate(bracketSide, model.OrderTypeLimitMaker, pair, size, takeProfit); err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	if err := c.validate(bracketSide, model.OrderTypeStopLoss, pair, size, stopLimit); err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	log.Infof("[ORDER] Creating OTOCO %s order for %s", side, pair)
+	orders, err = creator.CreateOrderOTOCO(side, pair, size, entry, takeProfit, stop, stopLimit)
+	if err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	for i := range orders {
+		err := c.storage.CreateOrder(&orders[i])
+		if err != nil {
+			c.notifyError(err)
+			return nil, err
+		}
+		go c.orderFeed.Publish(orders[i], true)
+	}
+
+	c.registerSignal(side, pair)
+	return orders, nil
+}
+
+// FundingRate returns the funding rate of a perpetual contract and the time of the next funding, e.g. to avoid
+// holding a position into an adverse funding. It is supported by exchanges that implement
+// exchange.FundingRateFetcher, e.g. Binance futures and the paper wallet with funding
+func (c *Controller) FundingRate(pair string) (float64, time.Time, error) {
+	fetcher, ok := c.exchange.(exchange.FundingRateFetcher)
+	if !ok {
+		return 0, time.Time{}, errors.New("funding rates are not supported by the exchange")
+	}
+	return fetcher.FundingRate(pair)
+}
+
+// AccountTrades returns the last trades of the account in the pair, up to the limit, with the commission of each
+// fill, e.g. to reconcile the fees. It is supported by exchanges that implement exchange.TradeHistoryFetcher,
+// e.g. Binance spot and the paper wallet
+func (c *Controller) AccountTrades(pair string, limit int) ([]model.Trade, error) {
+	fetcher, ok := c.exchange.(exchange.TradeHistoryFetcher)
+	if !ok {
+		return nil, errors.New("trade history is not supported by the exchange")
+	}
+	return fetcher.Trades(pair, limit)
+}
+
+// CreateOrderOCOTrailing creates an OCO sell order with a trailing profit leg, activated at the activation
+// price and trailing the highest price at the trail distance (e.g. 0.02 for 2%), while the loss leg is fixed.
+// It is supported by exchanges that implement exchange.TrailingOCOCreator, e.g. the paper wallet
+func (c *Controller) CreateOrderOCOTrailing(pair string, size, activation, trail, stop,
+	stopLimit float64) ([]model.Order, error) {
+
+	creator, ok := c.exchange.(exchange.TrailingOCOCreator)
+	if !ok {
+		return nil, errors.New("trailing OCO orders are not supported by the exchange")
+	}
+
+	if err := c.pace(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.validate(model.SideTypeSell, model.OrderTypeTakeProfit, pair, size, activation); err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	if err := c.validate(model.SideTypeSell, model.OrderTypeStopLoss, pair, size, stopLimit); err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	log.Infof("[ORDER] Creating trailing OCO order for %s", pair)
+	orders, err := creator.CreateOrderOCOTrailing(pair, size, activation, trail, stop, stopLimit)
+	if err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	for i := range orders {
+		err := c.storage.CreateOrder(&orders[i])
+		if err != nil {
+			c.notifyError(err)
+			return nil, err
+		}
+		go c.orderFeed.Publish(orders[i], true)
+	}
+
+	return orders, nil
+}
+
+// CreateOrderTrailingStop creates a trailing stop market order, activated at the activation price (or
+// immediately when it is zero) and triggered when the price retraces from its best price by the callback rate
+// (e.g. 0.01 for 1%). It is supported by exchanges that implement exchange.TrailingStopCreator, natively by
+// Binance Futures and emulated by the paper wallet
+func (c *Controller) CreateOrderTrailingStop(side model.SideType, pair string, size, activation,
+	callbackRate float64) (model.Order, error) {
+
+	creator, ok := c.exchange.(exchange.TrailingStopCreator)
+	if !ok {
+		return model.Order{}, errors.New("trailing stop orders are not supported by the exchange")
+	}
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.validate(side, model.OrderTypeTrailingStopMarket, pair, size, activation); err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating trailing stop %s order for %s", side, pair)
+	order, err := creator.CreateOrderTrailingStop(side, pair, size, activation, callbackRate)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+	go c.orderFeed.Publish(order, true)
+	return order, nil
+}
+
+// CreateOrderMarketMargin creates a market order in the margin account of exchanges that implement
+// exchange.MarginTrader, borrowing or repaying with the side effect. The order is processed as the market orders
+func (c *Controller) CreateOrderMarketMargin(side model.SideType, pair string, size float64,
+	sideEffect model.SideEffectType) (model.Order, error) {
+
+	trader, ok := c.exchange.(exchange.MarginTrader)
+	if !ok {
+		return model.Order{}, errors.New("margin orders are not supported by the exchange")
+	}
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.preflight(side, model.OrderTypeMarket, pair, size, 0, false); err != nil {
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating MARKET %s margin order for %s (%s)", side, pair, sideEffect)
+	order, err := trader.CreateOrderMarketMargin(side, pair, size, sideEffect)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	c.processTrade(&order)
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+// CreateOrderLimitMargin creates a limit order in the margin account of exchanges that implement
+// exchange.MarginTrader, borrowing or repaying with the side effect
+func (c *Controller) CreateOrderLimitMargin(side model.SideType, pair string, size, limit float64,
+	sideEffect model.SideEffectType) (model.Order, error) {
+
+	trader, ok := c.exchange.(exchange.MarginTrader)
+	if !ok {
+		return model.Order{}, errors.New("margin orders are not supported by the exchange")
+	}
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.preflight(side, model.OrderTypeLimit, pair, size, limit, false); err != nil {
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating LIMIT %s margin order for %s (%s)", side, pair, sideEffect)
+	order, err := trader.CreateOrderLimitMargin(side, pair, size, limit, sideEffect)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+// MarginAccount returns the margin balances of the pair in exchanges that implement exchange.MarginTrader
+func (c *Controller) MarginAccount(pair string) (model.Account, error) {
+	trader, ok := c.exchange.(exchange.MarginTrader)
+	if !ok {
+		return model.Account{}, errors.New("margin accounts are not supported by the exchange")
+	}
+	return trader.MarginAccount(pair)
+}
+
+func (c *Controller) CreateOrderLimit(side model.SideType, pair string, size, limit float64) (model.Order, error) {
+	return c.createOrderLimit(side, pair, size, limit, false)
+}
+
+func (c *Controller) createOrderLimit(side model.SideType, pair string, size, limit float64,
+	confirm bool) (order model.Order, err error) {
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	defer func() { c.logSignal(side, pair, model.OrderTypeLimit, order.ID, err) }()
+
+	if quantity, ok := c.oppositePosition(side, pair); ok {
+		return c.closeOnOppositeSignal(side, model.OrderTypeLimit, pair, quantity, limit)
+	}
+
+	if err := c.preflight(side, model.OrderTypeLimit, pair, size, limit, confirm); err != nil {
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating LIMIT %s order for %s", side, pair)
+	order, err = c.exchange.CreateOrderLimit(side, pair, size, limit)
+	if c.shrinkToFit && exchange.IsInsufficientFunds(err) {
+		maker, _ := c.fees(pair)
+		if err := c.paceLocked(); err != nil {
+			return model.Order{}, err
+		}
+		if quantity, ok := c.affordableQuantity(side, pair, size, limit, maker); ok {
+			log.Warnf("[ORDER] Insufficient funds, shrinking LIMIT %s order for %s from %f to %f",
+				side, pair, size, quantity)
+			order, err = c.exchange.CreateOrderLimit(side, pair, quantity, limit)
+		}
+	}
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+// CreateOrderLimitTIF creates a limit order with the given time in force. IOC and FOK orders
+// are resolved by the exchange immediately, so filled orders are processed as trades
+func (c *Controller) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce) (model.Order, error) {
+
+	return c.createOrderLimitTIF(side, pair, size, limit, timeInForce, false)
+}
+
+func (c *Controller) createOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForce, confirm bool) (order model.Order, err error) {
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	defer func() { c.logSignal(side, pair, model.OrderTypeLimit, order.ID, err) }()
+
+	if err := c.preflight(side, model.OrderTypeLimit, pair, size, limit, confirm); err != nil {
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating LIMIT %s %s order for %s", timeInForce, side, pair)
+	order, err = c.exchange.CreateOrderLimitTIF(side, pair, size, limit, timeInForce)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	// calculate profit of immediately filled orders
+	c.processTrade(&order)
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+func (c *Controller) CreateOrderMarketQuote(side model.SideType, pair string, amount float64) (model.Order, error) {
+	return c.createOrderMarketQuote(side, pair, amount, false)
+}
+
+func (c *Controller) createOrderMarketQuote(side model.SideType, pair string, amount float64,
+	confirm bool) (order model.Order, err error) {
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	defer func() { c.logSignal(side, pair, model.OrderTypeMarket, order.ID, err) }()
+
+	if quantity, ok := c.oppositePosition(side, pair); ok {
+		order, err = c.closeOnOppositeSignal(side, model.OrderTypeMarket, pair, quantity, 0)
+		if err != nil || !c.reverseOnOpposite {
+			return order, err
+		}
+
+		if err := c.prepareReverse(pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	var quantity float64
+	if price := c.lastPrice[pair]; price > 0 {
+		quantity = amount / price
+	}
+
+	if err := c.preflight(side, model.OrderTypeMarket, pair, quantity, 0, confirm); err != nil {
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating MARKET %s order for %s", side, pair)
+	order, err = c.exchange.CreateOrderMarketQuote(side, pair, amount)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	// calculate profit
+	c.processTrade(&order)
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, err
+}
+
+// SetCloseOnOppositeSignal closes the current position when a market or limit order in the opposite side is
+// requested, instead of reducing it by the order size. The close order has the position quantity rounded down to
+// the lot size, so it never exceeds the position, and it is reduce only on exchanges that implement
+// exchange.ReduceOnlyCreator. It is not blocked by the min profit exit and the slippage checks, only by the
+// validators. With reverse, a market order opens the new side with the requested size after the position is
+// closed, and its order is returned. Limit orders only close the position, at the limit price, since the new side
+// can only be opened after the close is filled. Partial closes are not possible while enabled
+func (c *Controller) SetCloseOnOppositeSignal(enabled, reverse bool) {
+	c.closeOnOpposite = enabled
+	c.reverseOnOpposite = enabled && reverse
+}
+
+func (c *Controller) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	return c.createOrderMarket(side, pair, size, false)
+}
+
+func (c *Controller) createOrderMarket(side model.SideType, pair string, size float64,
+	confirm bool) (order model.Order, err error) {
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	defer func() { c.logSignal(side, pair, model.OrderTypeMarket, order.ID, err) }()
+
+	if quantity, ok := c.oppositePosition(side, pair); ok {
+		order, err = c.closeOnOppositeSignal(side, model.OrderTypeMarket, pair, quantity, 0)
+		if err != nil || !c.reverseOnOpposite {
+			return order, err
+		}
+
+		if err := c.prepareReverse(pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return c.submitOrderMarket(side, pair, size, confirm)
+}
+
+// oppositePosition returns the quantity of the position of the pair to close on an opposite signal, rounded down
+// to the lot size, see SetCloseOnOppositeSignal
+func (c *Controller) oppositePosition(side model.SideType, pair string) (float64, bool) {
+	position, ok := c.position[pair]
+	if !ok || !c.closeOnOpposite || position.Side == side || position.Quantity == 0 {
+		return 0, false
+	}
+	return exchange.RoundQuantity(c.exchange.AssetsInfo(pair), position.Quantity), true
+}
+
+// closeOnOppositeSignal closes the position with a market or limit order, reduce only on the exchanges that
+// support it. The order skips the preflight checks of the signals, except the validators
+func (c *Controller) closeOnOppositeSignal(side model.SideType, orderType model.OrderType, pair string, quantity,
+	limit float64) (model.Order, error) {
+
+	if err := c.validate(side, orderType, pair, quantity, limit); err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Opposite %s signal for %s, closing position of %f", side, pair, quantity)
+	creator, reduceOnly := c.exchange.(exchange.ReduceOnlyCreator)
+
+	var order model.Order
+	var err error
+	switch {
+	case orderType == model.OrderTypeLimit && reduceOnly:
+		order, err = creator.CreateOrderLimitReduceOnly(side, pair, quantity, limit)
+	case orderType == model.OrderTypeLimit:
+		order, err = c.exchange.CreateOrderLimit(side, pair, quantity, limit)
+	case reduceOnly:
+		order, err = creator.CreateOrderMarketReduceOnly(side, pair, quantity)
+	default:
+		order, err = c.exchange.CreateOrderMarket(side, pair, quantity)
+	}
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	// calculate profit of filled market orders
+	c.processTrade(&order)
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+// prepareReverse waits for the order rate of the order that opens the new side after the close, see
+// SetCloseOnOppositeSignal
+func (c *Controller) prepareReverse(pair string) error {
+	if err := c.paceLocked(); err != nil {
+		return err
+	}
+
+	// the new side is not a repeated signal of the close order
+	delete(c.signals, pair)
+	return nil
+}
+
+// submitOrderMarket checks and places a market order, confirm enables the signal confirmation of strategy entries
+func (c *Controller) submitOrderMarket(side model.SideType, pair string, size float64, confirm bool) (model.Order,
+	error) {
+
+	if err := c.preflight(side, model.OrderTypeMarket, pair, size, 0, confirm); err != nil {
+		return model.Order{}, err
+	}
+
+	return c.placeOrderMarket(side, pair, size)
+}
+
+// placeOrderMarket places the market order, without the preflight checks. The caller waits for the order rate
+// limit
+func (c *Controller) placeOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	log.Infof("[ORDER] Creating MARKET %s order for %s", side, pair)
+	order, err := c.exchange.CreateOrderMarket(side, pair, size)
+	if c.shrinkToFit && exchange.IsInsufficientFunds(err) {
+		_, taker := c.fees(pair)
+		if err := c.paceLocked(); err != nil {
+			return model.Order{}, err
+		}
+		if quantity, ok := c.affordableQuantity(side, pair, size, 0, taker); ok {
+			log.Warnf("[ORDER] Insufficient funds, shrinking MARKET %s order for %s from %f to %f",
+				side, pair, size, quantity)
+			order, err = c.exchange.CreateOrderMarket(side, pair, quantity)
+		}
+	}
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	err = c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	// calculate profit
+	c.processTrade(&order)
+	c.registerSignal(side, pair)
+	go c.orderFeed.Publish(order, true)
 	log.Infof("[ORDER CREATED] %s", order)
 	return order, err
 }
 
 func (c *Controller) CreateOrderStop(pair string, size float64, limit float64) (model.Order, error) {
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.validate(model.SideTypeSell, model.OrderTypeStopLoss, pair, size, limit); err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
 	log.Infof("[ORDER] Creating STOP order for %s", pair)
 	order, err := c.exchange.CreateOrderStop(pair, size, limit)
 	if err != nil {
@@ -514,7 +2023,218 @@ func (c *Controller) CreateOrderStop(pair string, size float64, limit float64) (
 	return order, nil
 }
 
+// CreateOrderReverse places a single market order to move the net position of the pair to the target
+// quantity, positive for long and negative for short. e.g. with a long position of 1, a target of -1
+// sells 2 units, closing the long and opening the short in the same order. The quantity is rounded
+// down to the lot size, so an order that reduces the position never exceeds it
+func (c *Controller) CreateOrderReverse(pair string, target float64) (order model.Order, err error) {
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	current := c.positionQuantity(pair)
+
+	side := model.SideTypeBuy
+	if target < current {
+		side = model.SideTypeSell
+	}
+
+	quantity := exchange.RoundQuantity(c.exchange.AssetsInfo(pair), math.Abs(target-current))
+	if quantity == 0 {
+		log.Infof("[ORDER] %s position already at target %f", pair, target)
+		return model.Order{}, nil
+	}
+
+	// the order already sets the target position, without the opposite signal behavior
+	log.Infof("[ORDER] Moving %s position from %f to %f", pair, current, target)
+	order, err = c.submitOrderMarket(side, pair, quantity, false)
+	c.logSignal(side, pair, model.OrderTypeMarket, order.ID, err)
+	return order, err
+}
+
+// CancelAll cancels all open orders of the given pair in a single call and returns the canceled orders
+func (c *Controller) CancelAll(pair string) ([]model.Order, error) {
+	if err := c.pace(); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.cancelAll(pair)
+}
+
+func (c *Controller) cancelAll(pair string) ([]model.Order, error) {
+	log.Infof("[ORDER] Cancelling all orders for %s", pair)
+	canceled, err := c.exchange.CancelAll(pair)
+	if err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	pending, err := c.storage.Orders(
+		storage.WithPair(pair),
+		storage.WithStatusIn(
+			model.OrderStatusTypeNew,
+			model.OrderStatusTypePartiallyFilled,
+		),
+	)
+	if err != nil {
+		c.notifyError(err)
+		return nil, err
+	}
+
+	stored := make(map[int64]*model.Order, len(pending))
+	for _, order := range pending {
+		stored[order.ExchangeID] = order
+	}
+
+	for i := range canceled {
+		order, ok := stored[canceled[i].ExchangeID]
+		if !ok {
+			continue
+		}
+
+		order.Status = model.OrderStatusTypePendingCancel
+		err = c.storage.UpdateOrder(order)
+		if err != nil {
+			c.notifyError(err)
+			return nil, err
+		}
+		canceled[i].ID = order.ID
+	}
+
+	log.Infof("[ORDERS CANCELED] %d orders of %s", len(canceled), pair)
+	return canceled, nil
+}
+
+// FlattenAll is an emergency exit: it cancels the open orders of the given pairs and of the pairs with positions,
+// and closes the positions of the controller with market orders, selling the long positions and buying back the
+// short ones. Only the quantity of the controller positions is closed, so the assets held outside the bot in a
+// spot account are kept. The orders skip the preflight checks, the validators and the order rate, so they are
+// placed even when the controller is paused. The remaining pairs are processed when a pair fails, and the errors
+// are returned together
+func (c *Controller) FlattenAll(pairs ...string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	unique := make(map[string]bool, len(pairs)+len(c.position))
+	for _, pair := range pairs {
+		unique[pair] = true
+	}
+	for pair := range c.position {
+		unique[pair] = true
+	}
+
+	sorted := make([]string, 0, len(unique))
+	for pair := range unique {
+		sorted = append(sorted, pair)
+	}
+	sort.Strings(sorted)
+
+	log.Warnf("[ORDER] Flattening all positions of %s", strings.Join(sorted, ", "))
+	var failures []string
+	for _, pair := range sorted {
+		if err := c.flatten(pair); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", pair, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("flatten positions: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (c *Controller) flatten(pair string) error {
+	if _, err := c.cancelAll(pair); err != nil {
+		return err
+	}
+
+	var quantity float64
+	side := model.SideTypeBuy
+	if position, ok := c.position[pair]; ok {
+		quantity = position.Quantity
+		if position.Side == model.SideTypeBuy {
+			side = model.SideTypeSell
+		}
+	}
+
+	// the fees paid in the base asset reduce the balance of long positions
+	if side == model.SideTypeSell {
+		asset, _, err := c.exchange.Position(pair)
+		if err != nil {
+			return err
+		}
+		quantity = math.Min(quantity, asset)
+	}
+
+	info := c.exchange.AssetsInfo(pair)
+	quantity = exchange.RoundQuantity(info, quantity)
+	if quantity <= 0 || quantity < info.MinQuantity {
+		log.Infof("[ORDER] %s has no position to close", pair)
+		return nil
+	}
+
+	_, err := c.placeOrderMarket(side, pair, quantity)
+	return err
+}
+
+// OrderReplace changes the price and quantity of a resting limit order without a window with no order in the
+// book, e.g. to chase the price. It is supported by exchanges that implement exchange.OrderReplacer: Binance
+// replaces the order with a new one, in a single request, and the paper wallet updates the order in place
+func (c *Controller) OrderReplace(order model.Order, price, quantity float64) (model.Order, error) {
+	replacer, ok := c.exchange.(exchange.OrderReplacer)
+	if !ok {
+		return model.Order{}, errors.New("order replace is not supported by the exchange")
+	}
+
+	if err := c.pace(); err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.validate(order.Side, order.Type, order.Pair, quantity, price); err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Replacing order %d for %s", order.ExchangeID, order.Pair)
+	replaced, err := replacer.OrderReplace(order, price, quantity)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	// the order is updated in place when the exchange keeps its ID
+	if replaced.ExchangeID == order.ExchangeID {
+		replaced.ID = order.ID
+		err = c.storage.UpdateOrder(&replaced)
+	} else {
+		order.Status = model.OrderStatusTypePendingCancel
+		if err = c.storage.UpdateOrder(&order); err == nil {
+			err = c.storage.CreateOrder(&replaced)
+		}
+	}
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	go c.orderFeed.Publish(replaced, true)
+	log.Infof("[ORDER REPLACED] %s", replaced)
+	return replaced, nil
+}
+
 func (c *Controller) Cancel(order model.Order) error {
+	if err := c.pace(); err != nil {
+		return err
+	}
+
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
@@ -2,15 +2,20 @@ package order
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/rodrigo-brito/ninjabot/exchange"
 	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
 	"github.com/rodrigo-brito/ninjabot/storage"
+	"github.com/rodrigo-brito/ninjabot/strategy"
+	"github.com/rodrigo-brito/ninjabot/testdata/mocks"
 )
 
 func TestController_updatePosition(t *testing.T) {
@@ -89,6 +94,85 @@ func TestController_updatePosition(t *testing.T) {
 		require.Equal(t, 1.0, controller.Results["BTCUSDT"].WinLongPercent[0])
 	})
 
+	t.Run("partial market fill", func(t *testing.T) {
+		storage, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000),
+			exchange.WithFillModel(exchange.FillModelOrderBook))
+		controller := NewController(ctx, wallet, storage, NewOrderFeed())
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+		wallet.OnDepth(model.Depth{Pair: "BTCUSDT", Asks: []model.PriceLevel{{Price: 1000, Quantity: 1}}})
+
+		order, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+
+		// the expired rest doesn't change the position
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+		controller.updateOrders()
+		require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+
+		orders, err := storage.Orders()
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeExpired, orders[0].Status)
+	})
+
+	t.Run("liquidation", func(t *testing.T) {
+		storage, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000),
+			exchange.WithPaperLeverage(10, 0.005))
+		controller := NewController(ctx, wallet, storage, NewOrderFeed())
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 1000, High: 1000, Low: 1000, Close: 1000})
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// the wallet closes the position at the liquidation price
+		price, _ := wallet.LiquidationPrice("BTCUSDT")
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 950, High: 950, Low: 850, Close: 850})
+		controller.updateOrders()
+
+		require.Nil(t, controller.position["BTCUSDT"])
+		require.Len(t, controller.Results["BTCUSDT"].LoseLong, 1)
+		require.InDelta(t, price-1000, controller.Results["BTCUSDT"].LoseLong[0], 1e-9)
+
+		orders, err := storage.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, model.SideTypeSell, orders[1].Side)
+	})
+
+	t.Run("trailing stop exit", func(t *testing.T) {
+		storage, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000),
+			exchange.WithPaperTrailingStop(0.1))
+		controller := NewController(ctx, wallet, storage, NewOrderFeed())
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 1000, High: 1000, Low: 1000, Close: 1000})
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// the wallet closes the position with the trailing stop at 900
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 1000, High: 1000, Low: 950, Close: 950})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 950, High: 950, Low: 850, Close: 850})
+		controller.updateOrders()
+
+		require.Nil(t, controller.position["BTCUSDT"])
+		require.Len(t, controller.Results["BTCUSDT"].LoseLong, 1)
+		require.Equal(t, -100.0, controller.Results["BTCUSDT"].LoseLong[0])
+
+		orders, err := storage.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, model.OrderTypeStopLoss, orders[1].Type)
+	})
+
 	t.Run("oco order limit maker", func(t *testing.T) {
 		storage, err := storage.FromMemory()
 		require.NoError(t, err)
@@ -222,3 +306,1098 @@ func TestController_Position(t *testing.T) {
 	assert.Equal(t, 1.0, asset)
 	assert.Equal(t, 1500.0, quote)
 }
+
+func TestController_limits(t *testing.T) {
+	t.Run("max open positions", func(t *testing.T) {
+		storage, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+		controller := NewController(ctx, wallet, storage, NewOrderFeed())
+		controller.SetMaxOpenPositions(1)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+		wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 100})
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// new pair is blocked, but the current position can be increased
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1)
+		require.ErrorIs(t, err, ErrMaxOpenPositions)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// closing the position releases the slot
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("max open orders", func(t *testing.T) {
+		storage, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+		controller := NewController(ctx, wallet, storage, NewOrderFeed())
+		controller.SetMaxOpenOrders(2)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+		_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+		require.NoError(t, err)
+		order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 800)
+		require.NoError(t, err)
+
+		_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 700)
+		require.ErrorIs(t, err, ErrMaxOpenOrders)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.1)
+		require.ErrorIs(t, err, ErrMaxOpenOrders)
+
+		require.NoError(t, controller.Cancel(order))
+		_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 700)
+		require.NoError(t, err)
+	})
+}
+
+func TestController_BreakevenPrice(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	controller.SetFees(0.001, 0.002)
+
+	_, err = controller.BreakevenPrice("BTCUSDT")
+	require.ErrorIs(t, err, ErrNoPosition)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// entry cost 1000 + 2 (taker), exit with 0.2% fee
+	price, err := controller.BreakevenPrice("BTCUSDT")
+	require.NoError(t, err)
+	require.InDelta(t, 1002/0.998, price, 1e-9)
+
+	// half of the entry fee is released with the partial exit
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+	require.NoError(t, err)
+	price, err = controller.BreakevenPrice("BTCUSDT")
+	require.NoError(t, err)
+	require.InDelta(t, 501/(0.5*0.998), price, 1e-9)
+
+	// net fees of the summary: 2 (entry) + 1 (partial exit)
+	require.InDelta(t, 3, controller.Results["BTCUSDT"].Fee, 1e-9)
+}
+
+func TestController_MinProfitExit(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetFees(0.001, 0.002)
+	controller.SetMinProfitExit(50)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// breakeven 1004.008 + 0.5%
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1005})
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+	require.ErrorIs(t, err, ErrMinProfitExit)
+
+	_, err = controller.CreateOrderMarketQuote(model.SideTypeSell, "BTCUSDT", 500)
+	require.ErrorIs(t, err, ErrMinProfitExit)
+
+	_, err = controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 1005)
+	require.ErrorIs(t, err, ErrMinProfitExit)
+
+	_, err = controller.CreateOrderOTOCO(model.SideTypeSell, "BTCUSDT", 0.5, 1005, 900, 1100, 1101)
+	require.ErrorIs(t, err, ErrMinProfitExit)
+
+	// entries and stop losses are not blocked
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.1)
+	require.NoError(t, err)
+
+	_, err = controller.CreateOrderStop("BTCUSDT", 0.5, 900)
+	require.NoError(t, err)
+
+	_, err = controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 1015)
+	require.NoError(t, err)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1015})
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.1)
+	require.NoError(t, err)
+
+	// hard stop at 5% below the average entry price
+	controller.SetMinProfitStopLoss(500)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 960})
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.1)
+	require.ErrorIs(t, err, ErrMinProfitExit)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 940})
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.1)
+	require.NoError(t, err)
+}
+
+func TestController_FeeSchedule(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetFees(0.001, 0.002)
+	controller.SetFeeSchedule(model.FeeSchedule{"BTCUSDT": {Maker: 0, Taker: 0.0005}})
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 100})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1)
+	require.NoError(t, err)
+
+	// entry cost 1000 + 0.5 with the scheduled taker fee
+	price, err := controller.BreakevenPrice("BTCUSDT")
+	require.NoError(t, err)
+	require.InDelta(t, 1000.5/0.9995, price, 1e-9)
+
+	// pairs out of the schedule use the default fees
+	price, err = controller.BreakevenPrice("ETHUSDT")
+	require.NoError(t, err)
+	require.InDelta(t, 100.2/0.998, price, 1e-9)
+}
+
+func TestController_Rebate(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000),
+		exchange.WithPaperFee(-0.0001, 0.001))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetFees(-0.0001, 0.001)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+	require.NoError(t, err)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 890, High: 950, Low: 880})
+	controller.updateOrders()
+	require.InDelta(t, -0.09, controller.Results["BTCUSDT"].Fee, 1e-9)
+}
+
+func TestController_CreateOrderReverse(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	order, err := controller.CreateOrderReverse("BTCUSDT", 1)
+	require.NoError(t, err)
+	require.Equal(t, model.SideTypeBuy, order.Side)
+	require.Equal(t, 1.0, order.Quantity)
+
+	// flip from long to short in a single order
+	order, err = controller.CreateOrderReverse("BTCUSDT", -1)
+	require.NoError(t, err)
+	require.Equal(t, model.SideTypeSell, order.Side)
+	require.Equal(t, 2.0, order.Quantity)
+	require.Equal(t, model.SideTypeSell, controller.position["BTCUSDT"].Side)
+	require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+
+	// already at target
+	order, err = controller.CreateOrderReverse("BTCUSDT", -1)
+	require.NoError(t, err)
+	require.Zero(t, order.ID)
+
+	// close the short position
+	order, err = controller.CreateOrderReverse("BTCUSDT", 0)
+	require.NoError(t, err)
+	require.Equal(t, model.SideTypeBuy, order.Side)
+	require.Equal(t, 1.0, order.Quantity)
+	require.Nil(t, controller.position["BTCUSDT"])
+}
+
+func TestController_ShrinkToFit(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10.5)
+	require.ErrorIs(t, err, exchange.ErrInsufficientFunds)
+
+	controller.SetShrinkToFit(true)
+	order, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10.5)
+	require.NoError(t, err)
+	require.Equal(t, 10.0, order.Quantity)
+
+	order, err = controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 11, 200)
+	require.NoError(t, err)
+	require.Equal(t, 10.0, order.Quantity)
+}
+
+func TestController_CancelAll(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	first, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+	require.NoError(t, err)
+	second, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 800)
+	require.NoError(t, err)
+
+	orders, err := controller.CancelAll("BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	require.Equal(t, first.ID, orders[0].ID)
+	require.Equal(t, second.ID, orders[1].ID)
+
+	pending, err := db.Orders(storage.WithStatus(model.OrderStatusTypePendingCancel))
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+}
+
+func TestController_SignalDebounce(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetSignalDebounce(time.Hour)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(at time.Time) {
+		c := model.Candle{Pair: "BTCUSDT", Close: 1000, UpdatedAt: at, Complete: true}
+		wallet.OnCandle(c)
+		controller.OnCandle(c)
+	}
+
+	candle(start)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// same signal in the next candle
+	candle(start.Add(15 * time.Minute))
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, ErrSignalDebounced)
+
+	// explicit scale-in
+	controller.AllowScaleIn("BTCUSDT")
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// exits are never suppressed and the position change allows a new entry
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2)
+	require.NoError(t, err)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	// after the window
+	candle(start.Add(2 * time.Hour))
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+}
+
+func TestController_MinTradeInterval(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetMinTradeInterval(time.Hour)
+	controller.SetClock(func() time.Time {
+		return now
+	})
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, ErrTradeInterval)
+
+	// exits are not affected, other pairs are not affected
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 100})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1)
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, ErrTradeInterval)
+
+	now = now.Add(30 * time.Minute)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+}
+
+func TestController_LossLimits(t *testing.T) {
+	newController := func(dailyLoss, tradeLoss float64) (*Controller, *exchange.PaperWallet, *time.Time) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000),
+			exchange.WithPaperAsset("BUSD", 10000))
+
+		now := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.SetLossLimits(dailyLoss, tradeLoss)
+		controller.SetClock(func() time.Time {
+			return now
+		})
+		return controller, wallet, &now
+	}
+
+	// trade buys 1 BTC at 1000 and sells it at the given price
+	trade := func(controller *Controller, wallet *exchange.PaperWallet, price float64) error {
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		if err != nil {
+			return err
+		}
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: price})
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		return err
+	}
+
+	t.Run("max trade loss", func(t *testing.T) {
+		controller, wallet, now := newController(0, 50)
+		require.NoError(t, trade(controller, wallet, 960))
+		require.NoError(t, trade(controller, wallet, 940))
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrMaxTradeLoss)
+
+		// unblocked at UTC midnight
+		*now = now.Add(14 * time.Hour)
+		require.NoError(t, trade(controller, wallet, 1000))
+	})
+
+	t.Run("daily loss limit", func(t *testing.T) {
+		controller, wallet, now := newController(100, 0)
+		require.NoError(t, trade(controller, wallet, 960))
+		require.NoError(t, trade(controller, wallet, 1050))
+		require.NoError(t, trade(controller, wallet, 900))
+
+		// the realized profit of the day is -90, the partial exit reaches the limit
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 990})
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, ErrDailyLossLimit)
+
+		// exits are not affected
+		*now = now.Add(time.Hour)
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		*now = now.Add(13 * time.Hour)
+		require.NoError(t, trade(controller, wallet, 950))
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("daily loss per quote currency", func(t *testing.T) {
+		controller, wallet, _ := newController(100, 0)
+		require.NoError(t, trade(controller, wallet, 940))
+
+		// the loss of 60 BUSD is not added to the loss of 60 USDT
+		wallet.OnCandle(model.Candle{Pair: "BTCBUSD", Close: 1000})
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCBUSD", 1)
+		require.NoError(t, err)
+		wallet.OnCandle(model.Candle{Pair: "BTCBUSD", Close: 940})
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCBUSD", 1)
+		require.NoError(t, err)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+	})
+}
+
+func TestController_SignalLog(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetSignalLog(true)
+	controller.SetMaxOpenPositions(1)
+	controller.SetClock(func() time.Time {
+		return now
+	})
+
+	controller.AnnotateSignal("BTCUSDT", "ema cross")
+	order, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 100})
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "ETHUSDT", 1, 90)
+	require.ErrorIs(t, err, ErrMaxOpenPositions)
+
+	controller.SkipSignal("ETHUSDT", model.SideTypeSell, "trend filter")
+
+	signals, err := db.Signals(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, signals, 3)
+
+	require.Equal(t, model.SignalStatusExecuted, signals[0].Status)
+	require.Equal(t, model.OrderTypeMarket, signals[0].Type)
+	require.Equal(t, "ema cross", signals[0].Note)
+	require.Equal(t, order.ID, signals[0].OrderID)
+	require.True(t, signals[0].Time.Equal(now))
+
+	require.Equal(t, model.SignalStatusBlocked, signals[1].Status)
+	require.Equal(t, "ETHUSDT", signals[1].Pair)
+	require.Contains(t, signals[1].Reason, ErrMaxOpenPositions.Error())
+	require.Empty(t, signals[1].Note)
+
+	require.Equal(t, model.SignalStatusSkipped, signals[2].Status)
+	require.Equal(t, "trend filter", signals[2].Reason)
+
+	t.Run("disabled", func(t *testing.T) {
+		controller.SetSignalLog(false)
+		_, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		signals, err := db.Signals(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, signals, 3)
+	})
+}
+
+func TestController_MaxMarketSlippage(t *testing.T) {
+	newController := func(t *testing.T) (*Controller, *exchange.PaperWallet) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 100000))
+		candle := model.Candle{Pair: "BTCUSDT", Close: 1000, High: 1010, Low: 990}
+		wallet.OnCandle(candle)
+
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.OnCandle(candle)
+		return controller, wallet
+	}
+
+	t.Run("without order book", func(t *testing.T) {
+		controller, _ := newController(t)
+		controller.SetMaxMarketSlippage(1)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 1000)
+		require.NoError(t, err)
+	})
+
+	t.Run("order book", func(t *testing.T) {
+		controller, wallet := newController(t)
+		controller.SetMaxMarketSlippage(50)
+		wallet.OnDepth(model.Depth{
+			Pair: "BTCUSDT",
+			Bids: []model.PriceLevel{{Price: 999, Quantity: 5}},
+			Asks: []model.PriceLevel{{Price: 1000, Quantity: 1}, {Price: 1010, Quantity: 1}, {Price: 1020, Quantity: 1}},
+		})
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		// average price of 1010, 100 bps above the best ask
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 3)
+		require.ErrorIs(t, err, ErrMaxSlippage)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10)
+		require.ErrorIs(t, err, ErrMaxSlippage)
+
+		// exits are not aborted, even above the order book depth
+		controller.SetMaxMarketSlippage(1)
+		wallet.OnDepth(model.Depth{
+			Pair: "BTCUSDT",
+			Bids: []model.PriceLevel{{Price: 999, Quantity: 0.1}},
+			Asks: []model.PriceLevel{{Price: 1000, Quantity: 1}},
+		})
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+	})
+}
+
+func TestController_AccountState(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000, Complete: true})
+
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+	require.NoError(t, err)
+
+	balance, err := controller.Balance("BTC")
+	require.NoError(t, err)
+	require.Equal(t, "BTC", balance.Asset)
+	require.Equal(t, 2.0, balance.Free)
+
+	balance, err = controller.Balance("ETH")
+	require.NoError(t, err)
+	require.Equal(t, "ETH", balance.Asset)
+	require.Zero(t, balance.Free)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1100, Complete: true})
+	equity, err := controller.Equity()
+	require.NoError(t, err)
+	require.Equal(t, 10200.0, equity)
+
+	t.Run("converter", func(t *testing.T) {
+		feeder := mocks.NewFeeder(t)
+		feeder.On("CandlesByLimit", mock.Anything, "BTCUSDT", "1m", 1).
+			Return([]model.Candle{{Pair: "BTCUSDT", Close: 1000}}, nil)
+
+		broker := mocks.NewExchange(t)
+		broker.On("Account").Return(model.Account{Balances: []model.Balance{
+			{Asset: "BTC", Free: 1},
+			{Asset: "USDT", Free: 500, Lock: 500},
+		}}, nil)
+
+		controller := NewController(ctx, broker, db, NewOrderFeed())
+		_, err := controller.Equity()
+		require.Error(t, err)
+
+		controller.SetConverter(exchange.NewConverter(feeder, "USDT"))
+		equity, err := controller.Equity()
+		require.NoError(t, err)
+		require.Equal(t, 2000.0, equity)
+	})
+}
+
+func TestController_FlattenAll(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT",
+		exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithPaperAsset("ETH", 2),
+	)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 100})
+
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+	require.NoError(t, err)
+
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "ETHUSDT", 1, 90)
+	require.NoError(t, err)
+
+	// the pause, the validators and the order rate don't block the flatten orders
+	controller.Pause()
+	controller.AddValidators(func(order model.Order) error {
+		return errors.New("blocked")
+	})
+	controller.SetOrderRate(1, time.Hour)
+	require.NoError(t, controller.FlattenAll("ETHUSDT"))
+
+	for _, pair := range []string{"BTCUSDT", "ETHUSDT"} {
+		orders, err := controller.OpenOrders(pair)
+		require.NoError(t, err)
+		require.Empty(t, orders)
+	}
+
+	asset, _, err := controller.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Zero(t, asset)
+
+	// the assets held outside the controller positions are kept
+	asset, _, err = controller.Position("ETHUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, asset)
+}
+
+func TestController_OrderReplace(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 700})
+
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 600)
+	require.NoError(t, err)
+
+	replaced, err := controller.OrderReplace(order, 650, 1.2)
+	require.NoError(t, err)
+	require.Equal(t, order.ID, replaced.ID)
+	require.Equal(t, order.ExchangeID, replaced.ExchangeID)
+
+	// the paper wallet updates the stored order in place
+	orders, err := db.Orders(storage.WithPair("BTCUSDT"))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, 650.0, orders[0].Price)
+	require.Equal(t, 1.2, orders[0].Quantity)
+
+	_, err = controller.OrderReplace(replaced, 650, 2)
+	require.ErrorIs(t, err, exchange.ErrInsufficientFunds)
+}
+
+func TestController_OrderRate(t *testing.T) {
+	t.Run("spaced orders", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.SetOrderRate(1, 50*time.Millisecond)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+			require.NoError(t, err)
+		}
+		require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.SetOrderRate(1, time.Hour)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		cancel()
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("waiting without the lock", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.SetOrderRate(1, time.Hour)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		done := make(chan error)
+		go func() { done <- controller.Cancel(model.Order{Pair: "BTCUSDT"}) }()
+
+		// the controller is not locked while the cancel waits for the next slot
+		paused := make(chan bool)
+		go func() { paused <- controller.Paused() }()
+		select {
+		case <-paused:
+		case <-time.After(time.Second):
+			require.Fail(t, "controller locked by the pacer")
+		}
+
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestController_CloseOnOppositeSignal(t *testing.T) {
+	newController := func(t *testing.T, reverse bool) (*Controller, *exchange.PaperWallet) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.SetCloseOnOppositeSignal(true, reverse)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		return controller, wallet
+	}
+
+	t.Run("close", func(t *testing.T) {
+		controller, wallet := newController(t, false)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+
+		order, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, order.Quantity)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		controller, wallet := newController(t, true)
+		controller.SetSignalDebounce(time.Hour)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		order, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, order.Quantity)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+	})
+
+	t.Run("same side", func(t *testing.T) {
+		controller, wallet := newController(t, true)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 2.0, asset)
+	})
+
+	t.Run("close below min profit", func(t *testing.T) {
+		controller, wallet := newController(t, false)
+		controller.SetMinProfitExit(50)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		controller.SetMaxMarketSlippage(1)
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		require.NoError(t, err)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("limit close", func(t *testing.T) {
+		controller, _ := newController(t, true)
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+		require.NoError(t, err)
+
+		order, err := controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 110)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, order.Quantity)
+		require.Equal(t, 110.0, order.Price)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+	})
+
+	t.Run("reduce only", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		ctx := context.Background()
+		wallet := &reduceOnlyWallet{PaperWallet: exchange.NewPaperWallet(ctx, "USDT",
+			exchange.WithPaperAsset("USDT", 10000))}
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		controller.SetCloseOnOppositeSignal(true, true)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		require.Zero(t, wallet.reduceOnly)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5)
+		require.NoError(t, err)
+		require.Equal(t, 1, wallet.reduceOnly)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+	})
+}
+
+// reduceOnlyWallet counts the reduce only orders of a paper wallet
+type reduceOnlyWallet struct {
+	*exchange.PaperWallet
+	reduceOnly int
+}
+
+func (w *reduceOnlyWallet) CreateOrderMarketReduceOnly(side model.SideType, pair string,
+	size float64) (model.Order, error) {
+
+	w.reduceOnly++
+	return w.CreateOrderMarket(side, pair, size)
+}
+
+func (w *reduceOnlyWallet) CreateOrderLimitReduceOnly(side model.SideType, pair string, size,
+	limit float64) (model.Order, error) {
+
+	w.reduceOnly++
+	return w.CreateOrderLimit(side, pair, size, limit)
+}
+
+// marginWallet records the side effects of the margin orders of a paper wallet
+type marginWallet struct {
+	*exchange.PaperWallet
+	sideEffects []model.SideEffectType
+}
+
+func (w *marginWallet) CreateOrderMarketMargin(side model.SideType, pair string, quantity float64,
+	sideEffect model.SideEffectType) (model.Order, error) {
+
+	w.sideEffects = append(w.sideEffects, sideEffect)
+	return w.CreateOrderMarket(side, pair, quantity)
+}
+
+func (w *marginWallet) CreateOrderLimitMargin(side model.SideType, pair string, quantity, limit float64,
+	sideEffect model.SideEffectType) (model.Order, error) {
+
+	w.sideEffects = append(w.sideEffects, sideEffect)
+	return w.CreateOrderLimit(side, pair, quantity, limit)
+}
+
+func (w *marginWallet) MarginAccount(_ string) (model.Account, error) {
+	return w.Account()
+}
+
+func TestController_Margin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("margin orders", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := &marginWallet{PaperWallet: exchange.NewPaperWallet(ctx, "USDT",
+			exchange.WithPaperAsset("USDT", 10000))}
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err = controller.CreateOrderMarketMargin(model.SideTypeBuy, "BTCUSDT", 1, model.SideEffectTypeMarginBuy)
+		require.NoError(t, err)
+		require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+
+		order, err := controller.CreateOrderLimitMargin(model.SideTypeSell, "BTCUSDT", 1, 110,
+			model.SideEffectTypeAutoRepay)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, []model.SideEffectType{model.SideEffectTypeMarginBuy, model.SideEffectTypeAutoRepay},
+			wallet.sideEffects)
+
+		orders, err := db.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+
+		_, err = controller.MarginAccount("BTCUSDT")
+		require.NoError(t, err)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		db, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, db, NewOrderFeed())
+
+		_, err = controller.CreateOrderMarketMargin(model.SideTypeBuy, "BTCUSDT", 1, model.SideEffectTypeMarginBuy)
+		require.Error(t, err)
+		_, err = controller.MarginAccount("BTCUSDT")
+		require.Error(t, err)
+	})
+}
+
+func TestController_Validators(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+
+	errMaxValue := errors.New("max order value")
+	errTradingHours := errors.New("outside trading hours")
+	controller.AddValidators(
+		func(order model.Order) error {
+			if order.Quantity*order.Price > 2000 {
+				return errMaxValue
+			}
+			return nil
+		},
+		func(order model.Order) error {
+			if order.CreatedAt.Hour() >= 22 {
+				return errTradingHours
+			}
+			return nil
+		},
+	)
+
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	candle := model.Candle{Pair: "BTCUSDT", Close: 1000, UpdatedAt: start, Complete: true}
+	wallet.OnCandle(candle)
+	controller.OnCandle(candle)
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 3)
+	require.ErrorIs(t, err, errMaxValue)
+	_, err = controller.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 2500)
+	require.ErrorIs(t, err, errMaxValue)
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 3, 900)
+	require.ErrorIs(t, err, errMaxValue)
+
+	candle.UpdatedAt = start.Add(10 * time.Hour)
+	controller.OnCandle(candle)
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.ErrorIs(t, err, errTradingHours)
+
+	// blocked orders are not sent to the exchange
+	asset, _, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, asset)
+}
+
+func TestController_CreateOrderOCOTrailing(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 100))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100, High: 100, Low: 100})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+
+	orders, err := controller.CreateOrderOCOTrailing("BTCUSDT", 1, 110, 0.1, 90, 89)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+
+	stored, err := db.Orders(storage.WithStatus(model.OrderStatusTypeNew))
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+}
+
+func TestController_CreateOrderOTOCO(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 100))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 60, High: 60, Low: 60})
+	orders, err := controller.CreateOrderOTOCO(model.SideTypeBuy, "BTCUSDT", 1, 50, 70, 40, 39)
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+
+	pending, err := db.Orders(storage.WithStatus(model.OrderStatusTypePendingNew))
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	// entry filled and brackets placed
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50, High: 55, Low: 50})
+	controller.updateOrders()
+	require.Contains(t, controller.position, "BTCUSDT")
+	require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+
+	open, err := db.Orders(storage.WithStatus(model.OrderStatusTypeNew))
+	require.NoError(t, err)
+	require.Len(t, open, 2)
+
+	// stop loss closes the position
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 35, High: 50, Low: 35})
+	controller.updateOrders()
+	require.Empty(t, controller.position)
+	require.Len(t, controller.Results["BTCUSDT"].Lose(), 1)
+
+	t.Run("unsupported exchange", func(t *testing.T) {
+		controller := NewController(ctx, mocks.NewExchange(t), db, NewOrderFeed())
+		_, err := controller.CreateOrderOTOCO(model.SideTypeBuy, "BTCUSDT", 1, 50, 70, 40, 39)
+		require.Error(t, err)
+	})
+}
+
+func TestController_VolatilitySize(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+
+	df := &model.Dataframe{Pair: "BTCUSDT"}
+	for i := 0; i < 5; i++ {
+		df.High = append(df.High, 101)
+		df.Low = append(df.Low, 99)
+		df.Close = append(df.Close, 100)
+	}
+
+	var broker service.Broker = controller.StrategyBroker()
+	sizer, ok := broker.(strategy.VolatilitySizer)
+	require.True(t, ok)
+
+	quantity, distance, err := sizer.VolatilitySize(df, 100, 3, 2)
+	require.NoError(t, err)
+	require.InDelta(t, 4.0, distance, 1e-9)
+	require.InDelta(t, 25.0, quantity, 1e-9)
+}
+
+func TestController_SignalConfirmation(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	controller.SetSignalConfirmation(3)
+	broker := controller.StrategyBroker()
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	closeCandle := func(i int) {
+		candle := model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(i) * time.Hour), Close: 1000,
+			High: 1000, Low: 1000, Complete: true}
+		candle.UpdatedAt = candle.Time.Add(time.Hour)
+		wallet.OnCandle(candle)
+		controller.OnCandle(candle)
+	}
+	closeCandle(0)
+
+	// a candle without request breaks the streak
+	_, err = broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, ErrSignalUnconfirmed)
+	closeCandle(1)
+	closeCandle(2)
+
+	_, err = broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, ErrSignalUnconfirmed)
+	// repeated requests of a candle count once
+	_, err = broker.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 1000)
+	require.ErrorIs(t, err, ErrSignalUnconfirmed)
+	closeCandle(3)
+
+	_, err = broker.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+	require.ErrorIs(t, err, ErrSignalUnconfirmed)
+	closeCandle(4)
+
+	_, err = broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+	closeCandle(5)
+
+	// the streak restarts after the entry, and the exits are not confirmed
+	_, err = broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.ErrorIs(t, err, ErrSignalUnconfirmed)
+	_, err = broker.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	require.NoError(t, err)
+	require.NotContains(t, controller.position, "BTCUSDT")
+
+	// the orders sent to the controller directly are not confirmed
+	closeCandle(6)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	require.NoError(t, err)
+}
@@ -1,6 +1,8 @@
 package order
 
 import (
+	"sync"
+
 	"github.com/rodrigo-brito/ninjabot/model"
 )
 
@@ -14,6 +16,9 @@ type FeedConsumer func(order model.Order)
 type Feed struct {
 	OrderFeeds            map[string]*DataFeed
 	SubscriptionsBySymbol map[string][]Subscription
+
+	mtx     sync.RWMutex
+	started bool
 }
 
 type Subscription struct {
@@ -28,12 +33,21 @@ func NewOrderFeed() *Feed {
 	}
 }
 
+// Subscribe registers a consumer of the orders of a pair. After the feed is started,
+// the feeds of new pairs are started immediately
 func (d *Feed) Subscribe(pair string, consumer FeedConsumer, onlyNewOrder bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
 	if _, ok := d.OrderFeeds[pair]; !ok {
 		d.OrderFeeds[pair] = &DataFeed{
 			Data: make(chan model.Order),
 			Err:  make(chan error),
 		}
+
+		if d.started {
+			d.start(pair, d.OrderFeeds[pair])
+		}
 	}
 
 	d.SubscriptionsBySymbol[pair] = append(d.SubscriptionsBySymbol[pair], Subscription{
@@ -43,19 +57,40 @@ func (d *Feed) Subscribe(pair string, consumer FeedConsumer, onlyNewOrder bool)
 }
 
 func (d *Feed) Publish(order model.Order, _ bool) {
-	if _, ok := d.OrderFeeds[order.Pair]; ok {
-		d.OrderFeeds[order.Pair].Data <- order
+	d.mtx.RLock()
+	feed, ok := d.OrderFeeds[order.Pair]
+	d.mtx.RUnlock()
+
+	if ok {
+		feed.Data <- order
 	}
 }
 
-func (d *Feed) Start() {
-	for pair := range d.OrderFeeds {
-		go func(pair string, feed *DataFeed) {
-			for order := range feed.Data {
-				for _, subscription := range d.SubscriptionsBySymbol[pair] {
-					subscription.consumer(order)
-				}
+func (d *Feed) subscriptions(pair string) []Subscription {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	subscriptions := make([]Subscription, len(d.SubscriptionsBySymbol[pair]))
+	copy(subscriptions, d.SubscriptionsBySymbol[pair])
+	return subscriptions
+}
+
+func (d *Feed) start(pair string, feed *DataFeed) {
+	go func() {
+		for order := range feed.Data {
+			for _, subscription := range d.subscriptions(pair) {
+				subscription.consumer(order)
 			}
-		}(pair, d.OrderFeeds[pair])
+		}
+	}()
+}
+
+func (d *Feed) Start() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.started = true
+	for pair, feed := range d.OrderFeeds {
+		d.start(pair, feed)
 	}
 }
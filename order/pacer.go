@@ -0,0 +1,45 @@
+package order
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pacer spaces the order submissions to a maximum rate. Each submission reserves the next free slot, so the
+// submissions are sent in the call order, and waiting submissions are released when the context is done
+type pacer struct {
+	mtx      sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(limit int, period time.Duration) *pacer {
+	return &pacer{interval: period / time.Duration(limit)}
+}
+
+// wait blocks until the reserved slot of the submission, or returns the context error
+func (p *pacer) wait(ctx context.Context) error {
+	p.mtx.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	delay := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	p.mtx.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
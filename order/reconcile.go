@@ -0,0 +1,188 @@
+package order
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/storage"
+)
+
+// Reconciliation is the result of Controller.Reconcile
+type Reconciliation struct {
+	// Adopted are the open orders of the exchange missing in the storage, e.g. created by a crashed run before
+	// the order was saved. They are saved and tracked as the orders of the bot
+	Adopted []model.Order
+	// Ignored are the open orders of the exchange missing in the storage without the client order ID of the bot,
+	// e.g. created manually in the exchange. They are not tracked
+	Ignored []model.Order
+	// Updated are the pending orders of the storage changed in the exchange while the bot was offline
+	Updated []model.Order
+	// Positions are the positions of the exchange different from the positions restored from the storage
+	Positions []PositionDiscrepancy
+}
+
+// PositionDiscrepancy is a position changed outside the bot, e.g. opened while the bot was offline
+type PositionDiscrepancy struct {
+	Pair string
+	// Local is the net quantity of the position restored from the filled orders, negative for short positions
+	Local float64
+	// Exchange is the asset quantity of the exchange account
+	Exchange float64
+}
+
+// Discrepancies returns a message for each adopted order, ignored order, updated order and position discrepancy
+func (r Reconciliation) Discrepancies() []string {
+	messages := make([]string, 0, len(r.Adopted)+len(r.Ignored)+len(r.Updated)+len(r.Positions))
+	for _, order := range r.Adopted {
+		messages = append(messages, fmt.Sprintf("open order adopted: %s", order))
+	}
+	for _, order := range r.Ignored {
+		messages = append(messages, fmt.Sprintf("open order created outside the bot ignored: %s", order))
+	}
+	for _, order := range r.Updated {
+		messages = append(messages, fmt.Sprintf("order %s while offline: %s", order.Status, order))
+	}
+	for _, position := range r.Positions {
+		messages = append(messages, fmt.Sprintf("%s position changed outside the bot: local %f, exchange %f",
+			position.Pair, position.Local, position.Exchange))
+	}
+	return messages
+}
+
+// Reconcile syncs the state of the controller with the exchange on startup, e.g. after a crash. The positions
+// of the pairs are restored from the filled orders of the storage, the pending orders of the storage are updated
+// with the exchange status, and the open orders of the exchange missing in the storage are adopted when their
+// client order ID has exchange.ClientOrderIDPrefix, the other ones are reported as ignored. Exchanges without
+// client order IDs adopt no orders. The positions of the exchange account different from the restored positions
+// are reported, they are not changed. In spot, the position is the whole base asset balance of the account, so
+// the assets held outside the bot, e.g. a manual buy, are also reported as a discrepancy.
+// The discrepancies are logged and, with notify, sent to the notifier. It must be called before Start
+func (c *Controller) Reconcile(notify bool, pairs ...string) (Reconciliation, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var result Reconciliation
+	for _, pair := range pairs {
+		if err := c.reconcilePair(pair, &result); err != nil {
+			return result, fmt.Errorf("reconcile %s: %w", pair, err)
+		}
+	}
+
+	messages := result.Discrepancies()
+	for _, message := range messages {
+		log.Warnf("[RECONCILE] %s", message)
+	}
+
+	if notify && len(messages) > 0 && c.notifier != nil {
+		text := "[RECONCILE] Startup discrepancies:"
+		for _, message := range messages {
+			text += "\n- " + message
+		}
+		c.notifier.Notify(text)
+	}
+
+	return result, nil
+}
+
+func (c *Controller) reconcilePair(pair string, result *Reconciliation) error {
+	orders, err := c.storage.Orders(storage.WithPair(pair))
+	if err != nil {
+		return err
+	}
+
+	// restore the position from the orders filled before the restart
+	filled := make([]model.Order, 0, len(orders))
+	pending := make([]model.Order, 0)
+	known := make(map[int64]bool, len(orders))
+	for _, order := range orders {
+		known[order.ExchangeID] = true
+		switch order.Status {
+		case model.OrderStatusTypeFilled:
+			filled = append(filled, *order)
+		case model.OrderStatusTypeNew, model.OrderStatusTypePartiallyFilled, model.OrderStatusTypePendingCancel,
+			model.OrderStatusTypePendingNew:
+			pending = append(pending, *order)
+		}
+	}
+
+	sort.SliceStable(filled, func(i, j int) bool {
+		return filled[i].UpdatedAt.Before(filled[j].UpdatedAt)
+	})
+	delete(c.position, pair)
+	for i := range filled {
+		c.applyPosition(&filled[i])
+	}
+
+	// the pending orders changed while offline, e.g. filled or canceled
+	var updated []model.Order
+	for _, order := range pending {
+		excOrder, err := c.exchange.Order(pair, order.ExchangeID)
+		if err != nil {
+			log.WithField("id", order.ExchangeID).Error("orderControler/reconcile: ", err)
+			continue
+		}
+
+		if excOrder.Status == order.Status {
+			continue
+		}
+
+		excOrder.ID = order.ID
+		if err := c.storage.UpdateOrder(&excOrder); err != nil {
+			return err
+		}
+		updated = append(updated, excOrder)
+	}
+
+	for i := range updated {
+		c.processTrade(&updated[i])
+		c.orderFeed.Publish(updated[i], false)
+	}
+	result.Updated = append(result.Updated, updated...)
+
+	// the open orders created by the bot without being saved
+	openOrders, err := c.exchange.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range openOrders {
+		if known[order.ExchangeID] {
+			continue
+		}
+
+		order := order
+		if !strings.HasPrefix(order.ClientOrderID, exchange.ClientOrderIDPrefix) {
+			result.Ignored = append(result.Ignored, order)
+			continue
+		}
+
+		if err := c.storage.CreateOrder(&order); err != nil {
+			return err
+		}
+		result.Adopted = append(result.Adopted, order)
+	}
+
+	// the positions opened or closed outside the bot
+	asset, _, err := c.exchange.Position(pair)
+	if err != nil {
+		return err
+	}
+
+	local := c.positionQuantity(pair)
+	tolerance := math.Max(c.exchange.AssetsInfo(pair).StepSize, 1e-8)
+	if math.Abs(asset-local) >= tolerance {
+		result.Positions = append(result.Positions, PositionDiscrepancy{
+			Pair:     pair,
+			Local:    local,
+			Exchange: asset,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/storage"
+)
+
+// clientIDWallet sets the client order IDs of the open orders, the paper wallet does not set them
+type clientIDWallet struct {
+	*exchange.PaperWallet
+	bot map[int64]bool
+}
+
+func (w clientIDWallet) OpenOrders(pair string) ([]model.Order, error) {
+	orders, err := w.PaperWallet.OpenOrders(pair)
+	for i := range orders {
+		orders[i].ClientOrderID = fmt.Sprintf("web_%d", orders[i].ExchangeID)
+		if w.bot[orders[i].ExchangeID] {
+			orders[i].ClientOrderID = exchange.NewClientOrderID()
+		}
+	}
+	return orders, err
+}
+
+func TestController_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := clientIDWallet{
+		PaperWallet: exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000)),
+		bot:         make(map[int64]bool),
+	}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// first run: a filled position and a pending limit order
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Time: start, Pair: "BTCUSDT", Close: 1000, High: 1000, Low: 1000})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2)
+	require.NoError(t, err)
+	limit, err := controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 1200)
+	require.NoError(t, err)
+
+	// while offline: the limit order is filled, an order is created by the bot without being saved and
+	// another one is created manually in the exchange
+	wallet.OnCandle(model.Candle{Time: start.Add(time.Hour), Pair: "BTCUSDT", Close: 1200, High: 1200, Low: 1100})
+	orphan, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.5, 900)
+	require.NoError(t, err)
+	wallet.bot[orphan.ExchangeID] = true
+	manual, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.1, 800)
+	require.NoError(t, err)
+
+	restarted := NewController(ctx, wallet, db, NewOrderFeed())
+	result, err := restarted.Reconcile(false, "BTCUSDT")
+	require.NoError(t, err)
+
+	require.Len(t, result.Updated, 1)
+	require.Equal(t, limit.ExchangeID, result.Updated[0].ExchangeID)
+	require.Equal(t, model.OrderStatusTypeFilled, result.Updated[0].Status)
+
+	require.Len(t, result.Adopted, 1)
+	require.Equal(t, orphan.ExchangeID, result.Adopted[0].ExchangeID)
+	require.Len(t, result.Ignored, 1)
+	require.Equal(t, manual.ExchangeID, result.Ignored[0].ExchangeID)
+	require.Empty(t, result.Positions)
+	require.Len(t, result.Discrepancies(), 3)
+
+	// the position is restored from the storage, with the fill while offline
+	require.Equal(t, 1.0, restarted.position["BTCUSDT"].Quantity)
+	require.Equal(t, 1000.0, restarted.position["BTCUSDT"].AvgPrice)
+
+	// the adopted order is tracked by the controller
+	orders, err := db.Orders(storage.WithStatus(model.OrderStatusTypeNew))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, orphan.ExchangeID, orders[0].ExchangeID)
+
+	t.Run("position opened outside the bot", func(t *testing.T) {
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.25)
+		require.NoError(t, err)
+
+		result, err := NewController(ctx, wallet, db, NewOrderFeed()).Reconcile(false, "BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, result.Updated)
+		require.Empty(t, result.Adopted)
+		require.Equal(t, []PositionDiscrepancy{{Pair: "BTCUSDT", Local: 1, Exchange: 1.25}}, result.Positions)
+	})
+}
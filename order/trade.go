@@ -0,0 +1,137 @@
+package order
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// Trade is a closed position, or a slice of it when the position was closed in parts
+type Trade struct {
+	Pair          string         `json:"pair"`
+	Side          model.SideType `json:"side"`
+	EntryTime     time.Time      `json:"entry_time"`
+	ExitTime      time.Time      `json:"exit_time"`
+	EntryPrice    float64        `json:"entry_price"`
+	ExitPrice     float64        `json:"exit_price"`
+	Quantity      float64        `json:"quantity"`
+	Fee           float64        `json:"fee"`
+	Profit        float64        `json:"profit"`
+	ProfitPercent float64        `json:"profit_percent"`
+	// MAE is the maximum adverse excursion, the largest move against the position as a negative
+	// percentage of the entry price (e.g. -0.03 for 3%)
+	MAE float64 `json:"mae"`
+	// MFE is the maximum favorable excursion, the largest move in favor of the position as a
+	// percentage of the entry price
+	MFE float64 `json:"mfe"`
+}
+
+// SetExcursions calculates the MAE and MFE of the trade with the candles of the pair opened between the
+// entry and the exit, and with the entry and exit prices
+func (t *Trade) SetExcursions(candles []model.Candle) {
+	low, high := math.Min(t.EntryPrice, t.ExitPrice), math.Max(t.EntryPrice, t.ExitPrice)
+	for _, candle := range candles {
+		if candle.Pair != t.Pair || candle.Time.Before(t.EntryTime) || candle.Time.After(t.ExitTime) {
+			continue
+		}
+		low = math.Min(low, candle.Low)
+		high = math.Max(high, candle.High)
+	}
+
+	if t.EntryPrice == 0 {
+		return
+	}
+
+	if t.Side == model.SideTypeSell {
+		t.MAE = (t.EntryPrice - high) / t.EntryPrice
+		t.MFE = (t.EntryPrice - low) / t.EntryPrice
+		return
+	}
+
+	t.MAE = (low - t.EntryPrice) / t.EntryPrice
+	t.MFE = (high - t.EntryPrice) / t.EntryPrice
+}
+
+type lot struct {
+	order    *model.Order
+	price    float64
+	quantity float64
+}
+
+// quantityEpsilon avoids leftover lots caused by float errors in partial closes
+const quantityEpsilon = 1e-12
+
+func fillPrice(order *model.Order) float64 {
+	if (order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit) && order.Stop != nil {
+		return *order.Stop
+	}
+	return order.Price
+}
+
+// Trades pairs filled entries with their exits, in FIFO order, and returns the closed trades.
+// When an exit closes only part of an entry (or an entry is closed by several exits), the trade is
+// split and the fees are shared proportionally to the quantity. Open positions are not included.
+func Trades(orders []*model.Order) []Trade {
+	filled := make([]*model.Order, 0, len(orders))
+	for _, order := range orders {
+		if order.Status == model.OrderStatusTypeFilled && order.Quantity > 0 {
+			filled = append(filled, order)
+		}
+	}
+
+	sort.SliceStable(filled, func(i, j int) bool {
+		if filled[i].UpdatedAt.Equal(filled[j].UpdatedAt) {
+			return filled[i].ID < filled[j].ID
+		}
+		return filled[i].UpdatedAt.Before(filled[j].UpdatedAt)
+	})
+
+	trades := make([]Trade, 0)
+	lots := make(map[string][]*lot)
+	for _, order := range filled {
+		price := fillPrice(order)
+		remaining := order.Quantity
+		open := lots[order.Pair]
+
+		for len(open) > 0 && open[0].order.Side != order.Side && remaining > quantityEpsilon {
+			entry := open[0]
+			quantity := math.Min(entry.quantity, remaining)
+
+			profit := (price - entry.price) * quantity
+			if entry.order.Side == model.SideTypeSell {
+				profit = -profit
+			}
+
+			fee := entry.order.Fee*quantity/entry.order.Quantity + order.Fee*quantity/order.Quantity
+			profit -= fee
+			trades = append(trades, Trade{
+				Pair:          order.Pair,
+				Side:          entry.order.Side,
+				EntryTime:     entry.order.UpdatedAt,
+				ExitTime:      order.UpdatedAt,
+				EntryPrice:    entry.price,
+				ExitPrice:     price,
+				Quantity:      quantity,
+				Fee:           fee,
+				Profit:        profit,
+				ProfitPercent: profit / (entry.price * quantity),
+			})
+
+			entry.quantity -= quantity
+			remaining -= quantity
+			if entry.quantity <= quantityEpsilon {
+				open = open[1:]
+			}
+		}
+
+		// remaining quantity opens (or reverses) a position
+		if remaining > quantityEpsilon {
+			open = append(open, &lot{order: order, price: price, quantity: remaining})
+		}
+		lots[order.Pair] = open
+	}
+
+	return trades
+}
@@ -0,0 +1,108 @@
+package order
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestTrades(t *testing.T) {
+	newOrder := func(id int64, side model.SideType, price, quantity, fee float64) *model.Order {
+		return &model.Order{
+			ID:        id,
+			Pair:      "BTCUSDT",
+			Side:      side,
+			Type:      model.OrderTypeMarket,
+			Status:    model.OrderStatusTypeFilled,
+			Price:     price,
+			Quantity:  quantity,
+			Fee:       fee,
+			UpdatedAt: time.Unix(id, 0),
+		}
+	}
+
+	t.Run("partial close", func(t *testing.T) {
+		trades := Trades([]*model.Order{
+			newOrder(1, model.SideTypeBuy, 100, 2, 2),
+			newOrder(2, model.SideTypeSell, 150, 1, 1),
+			newOrder(3, model.SideTypeSell, 50, 1, 1),
+		})
+
+		require.Len(t, trades, 2)
+		require.Equal(t, model.SideTypeBuy, trades[0].Side)
+		require.Equal(t, time.Unix(1, 0), trades[0].EntryTime)
+		require.Equal(t, time.Unix(2, 0), trades[0].ExitTime)
+		require.Equal(t, 1.0, trades[0].Quantity)
+		require.Equal(t, 2.0, trades[0].Fee)
+		require.Equal(t, 48.0, trades[0].Profit)
+		require.Equal(t, 0.48, trades[0].ProfitPercent)
+
+		require.Equal(t, 100.0, trades[1].EntryPrice)
+		require.Equal(t, 50.0, trades[1].ExitPrice)
+		require.Equal(t, -52.0, trades[1].Profit)
+	})
+
+	t.Run("multiple entries and reversal", func(t *testing.T) {
+		trades := Trades([]*model.Order{
+			newOrder(1, model.SideTypeBuy, 100, 1, 0),
+			newOrder(2, model.SideTypeBuy, 200, 1, 0),
+			newOrder(3, model.SideTypeSell, 150, 3, 0),
+			newOrder(4, model.SideTypeBuy, 100, 1, 0),
+		})
+
+		require.Len(t, trades, 3)
+		require.Equal(t, 50.0, trades[0].Profit)
+		require.Equal(t, -50.0, trades[1].Profit)
+
+		// remaining quantity of the sell order opened a short position
+		require.Equal(t, model.SideTypeSell, trades[2].Side)
+		require.Equal(t, 1.0, trades[2].Quantity)
+		require.Equal(t, 50.0, trades[2].Profit)
+	})
+
+	t.Run("ignore open positions and not filled orders", func(t *testing.T) {
+		canceled := newOrder(2, model.SideTypeSell, 150, 1, 0)
+		canceled.Status = model.OrderStatusTypeCanceled
+		trades := Trades([]*model.Order{
+			newOrder(1, model.SideTypeBuy, 100, 1, 0),
+			canceled,
+		})
+		require.Empty(t, trades)
+	})
+}
+
+func TestTrade_SetExcursions(t *testing.T) {
+	candles := []model.Candle{
+		{Pair: "BTCUSDT", Time: time.Unix(0, 0), Low: 50, High: 200},
+		{Pair: "BTCUSDT", Time: time.Unix(1, 0), Low: 90, High: 105},
+		{Pair: "BTCUSDT", Time: time.Unix(2, 0), Low: 95, High: 120},
+		{Pair: "ETHUSDT", Time: time.Unix(2, 0), Low: 1, High: 1000},
+		{Pair: "BTCUSDT", Time: time.Unix(4, 0), Low: 10, High: 300},
+	}
+
+	t.Run("long", func(t *testing.T) {
+		trade := Trade{Pair: "BTCUSDT", Side: model.SideTypeBuy, EntryTime: time.Unix(1, 0),
+			ExitTime: time.Unix(3, 0), EntryPrice: 100, ExitPrice: 110}
+		trade.SetExcursions(candles)
+		require.InDelta(t, -0.1, trade.MAE, 1e-9)
+		require.InDelta(t, 0.2, trade.MFE, 1e-9)
+	})
+
+	t.Run("short", func(t *testing.T) {
+		trade := Trade{Pair: "BTCUSDT", Side: model.SideTypeSell, EntryTime: time.Unix(1, 0),
+			ExitTime: time.Unix(3, 0), EntryPrice: 100, ExitPrice: 110}
+		trade.SetExcursions(candles)
+		require.InDelta(t, -0.2, trade.MAE, 1e-9)
+		require.InDelta(t, 0.1, trade.MFE, 1e-9)
+	})
+
+	t.Run("without candles", func(t *testing.T) {
+		trade := Trade{Pair: "BTCUSDT", Side: model.SideTypeBuy, EntryPrice: 100, ExitPrice: 110}
+		trade.SetExcursions(nil)
+		require.Zero(t, trade.MAE)
+		require.InDelta(t, 0.1, trade.MFE, 1e-9)
+	})
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/rodrigo-brito/ninjabot/exchange"
 	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/storage"
 	"github.com/rodrigo-brito/ninjabot/strategy"
 
 	"github.com/StudioSol/set"
@@ -37,6 +38,7 @@ type Chart struct {
 	orderByID       map[int64]model.Order
 	indicators      []Indicator
 	paperWallet     *exchange.PaperWallet
+	equityStorage   storage.Storage
 	scriptContent   string
 	indexHTML       *template.Template
 	strategy        strategy.Strategy
@@ -164,17 +166,39 @@ func (c *Chart) equityValuesByPair(pair string) (asset []assetValue, quote []ass
 			})
 		}
 
-		for _, value := range c.paperWallet.EquityValues() {
-			equityValues = append(equityValues, assetValue{
-				Time:  value.Time,
-				Value: value.Value,
-			})
+		if c.equityStorage == nil {
+			for _, value := range c.paperWallet.EquityValues() {
+				equityValues = append(equityValues, assetValue{
+					Time:  value.Time,
+					Value: value.Value,
+				})
+			}
 		}
 	}
 
+	for _, snapshot := range c.equityCurve() {
+		equityValues = append(equityValues, assetValue{
+			Time:  snapshot.Time,
+			Value: snapshot.Equity,
+		})
+	}
+
 	return assetValues, equityValues
 }
 
+// equityCurve returns the equity snapshots of the storage, if defined
+func (c *Chart) equityCurve() model.EquityCurve {
+	if c.equityStorage == nil {
+		return nil
+	}
+
+	curve, err := c.equityStorage.EquitySnapshots(time.Time{}, time.Time{})
+	if err != nil {
+		log.Error(err)
+	}
+	return curve
+}
+
 func (c *Chart) indicatorsByPair(pair string) []plotIndicator {
 	indicators := make([]plotIndicator, 0)
 	for _, i := range c.indicators {
@@ -352,7 +376,14 @@ func (c *Chart) handleData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-type", "text/json")
 
 	var maxDrawdown *drawdown
-	if c.paperWallet != nil {
+	if c.equityStorage != nil {
+		value, start, end := c.equityCurve().MaxDrawdown()
+		maxDrawdown = &drawdown{
+			Start: start,
+			End:   end,
+			Value: fmt.Sprintf("%.1f", value*100),
+		}
+	} else if c.paperWallet != nil {
 		value, start, end := c.paperWallet.MaxDrawdown()
 		maxDrawdown = &drawdown{
 			Start: start,
@@ -457,6 +488,14 @@ func WithPaperWallet(paperWallet *exchange.PaperWallet) Option {
 	}
 }
 
+// WithEquitySnapshots plots the equity curve and the max drawdown from the equity snapshots of the storage,
+// recorded by the bot with ninjabot.WithEquitySnapshots
+func WithEquitySnapshots(storage storage.Storage) Option {
+	return func(chart *Chart) {
+		chart.equityStorage = storage
+	}
+}
+
 // WithDebug starts chart without compress
 func WithDebug() Option {
 	return func(chart *Chart) {
@@ -1,6 +1,10 @@
 package plot
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
 	"testing"
 	"time"
 
@@ -233,3 +237,74 @@ func TestChart_OrderStringByPair(t *testing.T) {
 	ordersPair2 := c.orderStringByPair(pair2)
 	require.Equal(t, expectPair2, ordersPair2)
 }
+
+func TestChart_RenderPNG(t *testing.T) {
+	c, err := NewChart()
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	require.Error(t, c.RenderPNG(&buffer, "BTCUSDT", 10))
+
+	start := time.Date(2021, 9, 26, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		price := 100 + float64(i%5)
+		c.OnCandle(model.Candle{
+			Pair:     "BTCUSDT",
+			Time:     start.Add(time.Duration(i) * time.Hour),
+			Open:     price,
+			Close:    price + 1,
+			Low:      price - 1,
+			High:     price + 2,
+			Complete: true,
+		})
+	}
+
+	c.OnOrder(model.Order{
+		ID:        1,
+		Pair:      "BTCUSDT",
+		Side:      model.SideTypeBuy,
+		Status:    model.OrderStatusTypeFilled,
+		Price:     101,
+		UpdatedAt: start.Add(19 * time.Hour),
+	})
+
+	require.NoError(t, c.RenderPNG(&buffer, "BTCUSDT", 10))
+	img, err := png.Decode(&buffer)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, imageWidth, imageHeight), img.Bounds())
+
+	// buy marker below the last candle
+	candles := c.candlesByPair("BTCUSDT")
+	require.Len(t, candles[len(candles)-1].Orders, 1)
+	spacing := float64(imageWidth-2*imagePadding) / 10
+	center := imagePadding + int(spacing*9+spacing/2)
+	marker := false
+	for y := 0; y < imageHeight; y++ {
+		if img.At(center, y) == color.Color(imageBuyOrder) {
+			marker = true
+			break
+		}
+	}
+	require.True(t, marker)
+}
+
+func TestRenderEquityPNG(t *testing.T) {
+	var buffer bytes.Buffer
+	require.Error(t, RenderEquityPNG(&buffer))
+
+	start := time.Date(2021, 9, 26, 0, 0, 0, 0, time.UTC)
+	growth := EquitySeries{Name: "growth", Curve: model.EquityCurve{
+		{Time: start, Equity: 100}, {Time: start.Add(time.Hour), Equity: 120},
+	}}
+	flat := EquitySeries{Name: "flat", Curve: model.EquityCurve{
+		{Time: start, Equity: 100}, {Time: start.Add(time.Hour), Equity: 100},
+	}}
+
+	require.NoError(t, RenderEquityPNG(&buffer, growth, flat))
+	img, err := png.Decode(&buffer)
+	require.NoError(t, err)
+
+	// the growth curve ends at the top right and the flat curve at the bottom right
+	require.Equal(t, color.Color(EquityPalette[0]), img.At(imageWidth-imagePadding, imagePadding))
+	require.Equal(t, color.Color(EquityPalette[1]), img.At(imageWidth-imagePadding, imageHeight-imagePadding))
+}
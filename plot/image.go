@@ -0,0 +1,211 @@
+package plot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+const (
+	imageWidth   = 800
+	imageHeight  = 400
+	imagePadding = 16
+	markerSize   = 6
+)
+
+var (
+	imageBackground = color.RGBA{R: 19, G: 23, B: 34, A: 255}
+	imageBullish    = color.RGBA{R: 38, G: 166, B: 154, A: 255}
+	imageBearish    = color.RGBA{R: 239, G: 83, B: 80, A: 255}
+	imageBuyOrder   = color.RGBA{R: 41, G: 98, B: 255, A: 255}
+	imageSellOrder  = color.RGBA{R: 255, G: 152, B: 0, A: 255}
+
+	// EquityPalette are the colors of the equity curves of RenderEquityPNG, in order
+	EquityPalette = []color.RGBA{
+		{R: 41, G: 98, B: 255, A: 255},
+		{R: 255, G: 152, B: 0, A: 255},
+		{R: 38, G: 166, B: 154, A: 255},
+		{R: 239, G: 83, B: 80, A: 255},
+		{R: 171, G: 71, B: 188, A: 255},
+		{R: 255, G: 235, B: 59, A: 255},
+	}
+)
+
+// EquitySeries is a named equity curve, e.g. the result of a backtest
+type EquitySeries struct {
+	Name  string
+	Curve model.EquityCurve
+}
+
+// RenderEquityPNG writes an image with the equity curves overlaid in the same time and value scale, each one
+// with a color of EquityPalette in the given order. It is useful to compare backtests side by side
+func RenderEquityPNG(w io.Writer, series ...EquitySeries) error {
+	var start, end time.Time
+	low, high := math.MaxFloat64, -math.MaxFloat64
+	for _, s := range series {
+		for _, snapshot := range s.Curve {
+			if start.IsZero() || snapshot.Time.Before(start) {
+				start = snapshot.Time
+			}
+			if snapshot.Time.After(end) {
+				end = snapshot.Time
+			}
+			low = math.Min(low, snapshot.Equity)
+			high = math.Max(high, snapshot.Equity)
+		}
+	}
+
+	if start.IsZero() {
+		return errors.New("no equity values")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(imageBackground), image.Point{}, draw.Src)
+
+	x := func(t time.Time) int {
+		if !end.After(start) {
+			return imageWidth / 2
+		}
+		return imagePadding + int(math.Round(float64(t.Sub(start))/float64(end.Sub(start))*
+			float64(imageWidth-2*imagePadding)))
+	}
+	y := func(value float64) int {
+		if high == low {
+			return imageHeight / 2
+		}
+		return imagePadding + int(math.Round((high-value)/(high-low)*float64(imageHeight-2*imagePadding)))
+	}
+
+	for i, s := range series {
+		lineColor := EquityPalette[i%len(EquityPalette)]
+		for j := 1; j < len(s.Curve); j++ {
+			drawLine(img, x(s.Curve[j-1].Time), y(s.Curve[j-1].Equity), x(s.Curve[j].Time), y(s.Curve[j].Equity),
+				lineColor)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// RenderPNG writes a candlestick image of the last candles of the pair, limited to the given number of
+// candles, with markers of the filled orders: buy orders below the candle and sell orders above it
+func (c *Chart) RenderPNG(w io.Writer, pair string, limit int) error {
+	c.Lock()
+	if len(c.candles[pair]) == 0 {
+		c.Unlock()
+		return fmt.Errorf("no candles for %s", pair)
+	}
+	candles := c.candlesByPair(pair)
+	c.Unlock()
+
+	if limit > 0 && len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	return png.Encode(w, renderCandles(candles))
+}
+
+func renderCandles(candles []Candle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(imageBackground), image.Point{}, draw.Src)
+
+	low, high := math.MaxFloat64, -math.MaxFloat64
+	for _, candle := range candles {
+		low = math.Min(low, candle.Low)
+		high = math.Max(high, candle.High)
+	}
+
+	// reserves space for the order markers below and above the candles
+	top, bottom := imagePadding+2*markerSize, imageHeight-imagePadding-2*markerSize
+	y := func(price float64) int {
+		if high == low {
+			return (top + bottom) / 2
+		}
+		return top + int(math.Round((high-price)/(high-low)*float64(bottom-top)))
+	}
+
+	spacing := float64(imageWidth-2*imagePadding) / float64(len(candles))
+	bodyWidth := int(math.Max(1, spacing*0.6))
+	for i, candle := range candles {
+		center := imagePadding + int(spacing*float64(i)+spacing/2)
+		candleColor := imageBullish
+		if candle.Close < candle.Open {
+			candleColor = imageBearish
+		}
+
+		fillRect(img, center, y(candle.High), center+1, y(candle.Low)+1, candleColor)
+
+		bodyTop, bodyBottom := y(math.Max(candle.Open, candle.Close)), y(math.Min(candle.Open, candle.Close))
+		fillRect(img, center-bodyWidth/2, bodyTop, center-bodyWidth/2+bodyWidth, bodyBottom+1, candleColor)
+
+		for _, order := range candle.Orders {
+			if order.Status != model.OrderStatusTypeFilled {
+				continue
+			}
+
+			if order.Side == model.SideTypeBuy {
+				fillTriangle(img, center, y(candle.Low)+2, 1, imageBuyOrder)
+			} else {
+				fillTriangle(img, center, y(candle.High)-2, -1, imageSellOrder)
+			}
+		}
+	}
+
+	return img
+}
+
+// drawLine draws a line between two points with the Bresenham algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	diff := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		if 2*diff >= dy {
+			diff += dy
+			x0 += sx
+		}
+		if 2*diff <= dx {
+			diff += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// fillTriangle draws a triangle with the tip at (x, y), pointing up for direction 1 and down for -1
+func fillTriangle(img *image.RGBA, x, y, direction int, c color.Color) {
+	for row := 0; row < markerSize; row++ {
+		line := y + direction*row
+		fillRect(img, x-row, line, x+row+1, line+1, c)
+	}
+}
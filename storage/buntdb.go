@@ -2,14 +2,33 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/tidwall/buntdb"
 )
 
+// orderPrefix separates the orders, which are stored by ID and indexed by the update time
+const orderPrefix = "order:"
+
+// statePrefix separates the state keys from the orders
+const statePrefix = "state:"
+
+// equityPrefix separates the equity snapshots, which are stored by time to keep them sorted
+const equityPrefix = "equity:"
+
+// candlePrefix separates the candles, which are stored by pair, timeframe and time to keep them sorted
+const candlePrefix = "candle:"
+
+// signalPrefix separates the signals, which are stored by time to keep them sorted
+const signalPrefix = "signal:"
+
 type Bunt struct {
 	lastID int64
 	db     *buntdb.DB
@@ -29,7 +48,13 @@ func newBunt(sourceFile string) (Storage, error) {
 		return nil, err
 	}
 
-	err = db.CreateIndex("update_index", "*", buntdb.IndexJSON("updated_at"))
+	err = migrateOrderKeys(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the orders are indexed, the candles, equity snapshots, signals and states are read by the key prefix
+	err = db.CreateIndex("update_index", orderPrefix+"*", buntdb.IndexJSON("updated_at"))
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +64,33 @@ func newBunt(sourceFile string) (Storage, error) {
 	}, nil
 }
 
+// migrateOrderKeys moves the orders of files created by previous versions, stored by ID without prefix, to the
+// order keys
+func migrateOrderKeys(db *buntdb.DB) error {
+	return db.Update(func(tx *buntdb.Tx) error {
+		legacy := make(map[string]string)
+		err := tx.AscendKeys("*", func(key, value string) bool {
+			if _, err := strconv.ParseInt(key, 10, 64); err == nil {
+				legacy[key] = value
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for key, value := range legacy {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+			if _, _, err := tx.Set(orderPrefix+key, value, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (b *Bunt) getID() int64 {
 	return atomic.AddInt64(&b.lastID, 1)
 }
@@ -51,14 +103,14 @@ func (b *Bunt) CreateOrder(order *model.Order) error {
 			return err
 		}
 
-		_, _, err = tx.Set(strconv.FormatInt(order.ID, 10), string(content), nil)
+		_, _, err = tx.Set(orderPrefix+strconv.FormatInt(order.ID, 10), string(content), nil)
 		return err
 	})
 }
 
 func (b Bunt) UpdateOrder(order *model.Order) error {
 	return b.db.Update(func(tx *buntdb.Tx) error {
-		id := strconv.FormatInt(order.ID, 10)
+		id := orderPrefix + strconv.FormatInt(order.ID, 10)
 
 		content, err := json.Marshal(order)
 		if err != nil {
@@ -73,7 +125,7 @@ func (b Bunt) UpdateOrder(order *model.Order) error {
 func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 	orders := make([]*model.Order, 0)
 	err := b.db.View(func(tx *buntdb.Tx) error {
-		err := tx.Ascend("update_index", func(key, value string) bool {
+		err := tx.Ascend("update_index", func(_, value string) bool {
 			var order model.Order
 			err := json.Unmarshal([]byte(value), &order)
 			if err != nil {
@@ -98,3 +150,185 @@ func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 	}
 	return orders, nil
 }
+
+func (b Bunt) SetState(key string, value []byte) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(statePrefix+key, string(value), nil)
+		return err
+	})
+}
+
+func (b Bunt) State(key string) ([]byte, error) {
+	var value string
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		value, err = tx.Get(statePrefix + key)
+		return err
+	})
+	if errors.Is(err, buntdb.ErrNotFound) {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+func (b *Bunt) CreateEquitySnapshot(snapshot *model.EquitySnapshot) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		snapshot.ID = b.getID()
+		content, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("%s%020d:%d", equityPrefix, snapshot.Time.UnixNano(), snapshot.ID)
+		_, _, err = tx.Set(key, string(content), nil)
+		return err
+	})
+}
+
+func (b Bunt) EquitySnapshots(start, end time.Time) (model.EquityCurve, error) {
+	snapshots := make(model.EquityCurve, 0)
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendKeys(equityPrefix+"*", func(_, value string) bool {
+			var snapshot model.EquitySnapshot
+			err = json.Unmarshal([]byte(value), &snapshot)
+			if err != nil {
+				return false
+			}
+
+			if inPeriod(snapshot.Time, start, end) {
+				snapshots = append(snapshots, snapshot)
+			}
+			return end.IsZero() || !snapshot.Time.After(end)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (b Bunt) CreateCandles(timeframe string, candles ...model.Candle) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		for _, candle := range candles {
+			candle.Metadata = nil
+			content, err := json.Marshal(candle)
+			if err != nil {
+				return err
+			}
+
+			key := fmt.Sprintf("%s%s:%s:%020d", candlePrefix, candle.Pair, timeframe, candle.Time.UnixNano())
+			if _, _, err = tx.Set(key, string(content), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b Bunt) Candles(pair, timeframe string, start, end time.Time) ([]model.Candle, error) {
+	candles := make([]model.Candle, 0)
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendKeys(fmt.Sprintf("%s%s:%s:*", candlePrefix, pair, timeframe), func(_, value string) bool {
+			var candle model.Candle
+			err = json.Unmarshal([]byte(value), &candle)
+			if err != nil {
+				return false
+			}
+
+			if inPeriod(candle.Time, start, end) {
+				candles = append(candles, candle)
+			}
+			return end.IsZero() || !candle.Time.After(end)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candles, nil
+}
+
+func (b Bunt) DeleteCandles(pair, timeframe string, before time.Time) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		keys := make([]string, 0)
+		err := tx.AscendKeys(fmt.Sprintf("%s%s:%s:*", candlePrefix, pair, timeframe), func(key, value string) bool {
+			var candle model.Candle
+			if err := json.Unmarshal([]byte(value), &candle); err != nil || !candle.Time.Before(before) {
+				return false
+			}
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bunt) CreateSignal(signal *model.Signal) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		signal.ID = b.getID()
+		content, err := json.Marshal(signal)
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("%s%020d:%020d", signalPrefix, signal.Time.UnixNano(), signal.ID)
+		_, _, err = tx.Set(key, string(content), nil)
+		return err
+	})
+}
+
+func (b Bunt) Signals(start, end time.Time) ([]model.Signal, error) {
+	signals := make([]model.Signal, 0)
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		// the signal keys are sorted by time, the iteration starts at the first key of the period
+		pivot := signalPrefix
+		if !start.IsZero() {
+			pivot = fmt.Sprintf("%s%020d", signalPrefix, start.UnixNano())
+		}
+
+		var err error
+		iterErr := tx.AscendGreaterOrEqual("", pivot, func(key, value string) bool {
+			if !strings.HasPrefix(key, signalPrefix) {
+				return false
+			}
+
+			var signal model.Signal
+			err = json.Unmarshal([]byte(value), &signal)
+			if err != nil {
+				return false
+			}
+
+			if !end.IsZero() && signal.Time.After(end) {
+				return false
+			}
+
+			if inPeriod(signal.Time, start, end) {
+				signals = append(signals, signal)
+			}
+			return true
+		})
+		if iterErr != nil {
+			return iterErr
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return signals, nil
+}
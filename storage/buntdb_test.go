@@ -3,8 +3,12 @@ package storage
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/buntdb"
+
+	"github.com/rodrigo-brito/ninjabot/model"
 )
 
 func TestFromFile(t *testing.T) {
@@ -24,3 +28,34 @@ func TestNewBunt(t *testing.T) {
 
 	storageUseCase(repo, t)
 }
+
+func TestBunt_LegacyOrderKeys(t *testing.T) {
+	file, err := os.CreateTemp(os.TempDir(), "*.db")
+	require.NoError(t, err)
+	defer os.RemoveAll(file.Name())
+
+	// orders stored by ID without prefix, as in the previous versions
+	db, err := buntdb.Open(file.Name())
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("7", `{"id":7,"pair":"BTCUSDT","status":"NEW","updated_at":"2022-01-01T00:00:00Z"}`, nil)
+		return err
+	}))
+	require.NoError(t, db.Close())
+
+	repo, err := FromFile(file.Name())
+	require.NoError(t, err)
+	require.NoError(t, repo.SetState("grid", []byte(`{"updated_at":"2022-01-01T00:00:00Z"}`)))
+	require.NoError(t, repo.CreateSignal(&model.Signal{Pair: "BTCUSDT", Time: time.Now()}))
+
+	orders, err := repo.Orders()
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, int64(7), orders[0].ID)
+
+	orders[0].Status = model.OrderStatusTypeFilled
+	require.NoError(t, repo.UpdateOrder(orders[0]))
+	orders, err = repo.Orders(WithStatus(model.OrderStatusTypeFilled))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+// noOp is a storage without persistence, see NoOp
+type noOp struct {
+	// orders of the execution, required to manage the open orders and the positions
+	orders Storage
+}
+
+// NoOp returns a storage that persists nothing, for minimal deployments without a database. The orders are kept
+// in memory during the execution, as the bot requires them to manage the open orders and the positions, and the
+// other records are discarded: the strategy state is not restored, and there is no equity curve, stored candles
+// or signal log
+func NoOp() (Storage, error) {
+	orders, err := FromMemory()
+	if err != nil {
+		return nil, err
+	}
+	return &noOp{orders: orders}, nil
+}
+
+func (n *noOp) CreateOrder(order *model.Order) error {
+	return n.orders.CreateOrder(order)
+}
+
+func (n *noOp) UpdateOrder(order *model.Order) error {
+	return n.orders.UpdateOrder(order)
+}
+
+func (n *noOp) Orders(filters ...OrderFilter) ([]*model.Order, error) {
+	return n.orders.Orders(filters...)
+}
+
+func (n *noOp) SetState(_ string, _ []byte) error {
+	return nil
+}
+
+func (n *noOp) State(_ string) ([]byte, error) {
+	return nil, ErrStateNotFound
+}
+
+func (n *noOp) CreateEquitySnapshot(_ *model.EquitySnapshot) error {
+	return nil
+}
+
+func (n *noOp) EquitySnapshots(_, _ time.Time) (model.EquityCurve, error) {
+	return model.EquityCurve{}, nil
+}
+
+func (n *noOp) CreateCandles(_ string, _ ...model.Candle) error {
+	return nil
+}
+
+func (n *noOp) Candles(_, _ string, _, _ time.Time) ([]model.Candle, error) {
+	return []model.Candle{}, nil
+}
+
+func (n *noOp) DeleteCandles(_, _ string, _ time.Time) error {
+	return nil
+}
+
+func (n *noOp) CreateSignal(_ *model.Signal) error {
+	return nil
+}
+
+func (n *noOp) Signals(_, _ time.Time) ([]model.Signal, error) {
+	return []model.Signal{}, nil
+}
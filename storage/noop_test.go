@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/model"
+)
+
+func TestNoOp(t *testing.T) {
+	repo, err := NoOp()
+	require.NoError(t, err)
+
+	t.Run("orders", func(t *testing.T) {
+		order := &model.Order{ExchangeID: 1, Pair: "BTCUSDT", Status: model.OrderStatusTypeNew}
+		require.NoError(t, repo.CreateOrder(order))
+
+		order.Status = model.OrderStatusTypeFilled
+		require.NoError(t, repo.UpdateOrder(order))
+
+		orders, err := repo.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, model.OrderStatusTypeFilled, orders[0].Status)
+	})
+
+	t.Run("discarded records", func(t *testing.T) {
+		now := time.Now()
+		require.NoError(t, repo.SetState("grid", []byte(`{"level":1}`)))
+		_, err := repo.State("grid")
+		require.ErrorIs(t, err, ErrStateNotFound)
+
+		require.NoError(t, repo.CreateEquitySnapshot(&model.EquitySnapshot{Time: now, Equity: 100}))
+		snapshots, err := repo.EquitySnapshots(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Empty(t, snapshots)
+
+		require.NoError(t, repo.CreateCandles("1h", model.Candle{Pair: "BTCUSDT", Time: now}))
+		candles, err := repo.Candles("BTCUSDT", "1h", time.Time{}, now)
+		require.NoError(t, err)
+		require.Empty(t, candles)
+		require.NoError(t, repo.DeleteCandles("BTCUSDT", "1h", now))
+
+		require.NoError(t, repo.CreateSignal(&model.Signal{Pair: "BTCUSDT", Time: now}))
+		signals, err := repo.Signals(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Empty(t, signals)
+	})
+}
@@ -1,14 +1,44 @@
 package storage
 
 import (
+	"errors"
 	"time"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 )
 
+type state struct {
+	Key       string `gorm:"primaryKey"`
+	Value     []byte
+	UpdatedAt time.Time
+}
+
+func (state) TableName() string {
+	return "state"
+}
+
+// candle is a row of the candles table, identified by pair, timeframe and time
+type candle struct {
+	Pair      string    `gorm:"primaryKey"`
+	Timeframe string    `gorm:"primaryKey"`
+	Time      time.Time `gorm:"primaryKey"`
+	UpdatedAt time.Time
+	Open      float64
+	Close     float64
+	Low       float64
+	High      float64
+	Volume    float64
+	Complete  bool
+}
+
+func (candle) TableName() string {
+	return "candles"
+}
+
 type SQL struct {
 	db *gorm.DB
 }
@@ -35,7 +65,7 @@ func FromSQL(dialect gorm.Dialector, opts ...gorm.Option) (Storage, error) {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	err = db.AutoMigrate(&model.Order{})
+	err = db.AutoMigrate(&model.Order{}, &state{}, &model.EquitySnapshot{}, &candle{}, &model.Signal{})
 	if err != nil {
 		return nil, err
 	}
@@ -78,3 +108,135 @@ func (s *SQL) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 		return true
 	}), nil
 }
+
+// SetState saves a value in the state table, replacing the previous value
+func (s *SQL) SetState(key string, value []byte) error {
+	result := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&state{Key: key, Value: value})
+	return result.Error
+}
+
+// State returns the value of a given key from the state table
+func (s *SQL) State(key string) ([]byte, error) {
+	var st state
+	result := s.db.Where(&state{Key: key}).First(&st)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrStateNotFound
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return st.Value, nil
+}
+
+// CreateEquitySnapshot saves a snapshot of the account equity in the equity_snapshots table
+func (s *SQL) CreateEquitySnapshot(snapshot *model.EquitySnapshot) error {
+	result := s.db.Create(snapshot)
+	return result.Error
+}
+
+// EquitySnapshots returns the snapshots between start and end sorted by time
+func (s *SQL) EquitySnapshots(start, end time.Time) (model.EquityCurve, error) {
+	snapshots := make(model.EquityCurve, 0)
+
+	query := s.db.Order("time, id")
+	if !start.IsZero() {
+		query = query.Where("time >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("time <= ?", end)
+	}
+
+	result := query.Find(&snapshots)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return snapshots, nil
+}
+
+// CreateCandles saves the candles in the candles table, replacing the previous values
+func (s *SQL) CreateCandles(timeframe string, candles ...model.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+
+	rows := lo.Map(candles, func(c model.Candle, _ int) candle {
+		return candle{
+			Pair:      c.Pair,
+			Timeframe: timeframe,
+			Time:      c.Time,
+			UpdatedAt: c.UpdatedAt,
+			Open:      c.Open,
+			Close:     c.Close,
+			Low:       c.Low,
+			High:      c.High,
+			Volume:    c.Volume,
+			Complete:  c.Complete,
+		}
+	})
+
+	result := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&rows)
+	return result.Error
+}
+
+// Candles returns the candles of a pair and timeframe between start and end sorted by time
+func (s *SQL) Candles(pair, timeframe string, start, end time.Time) ([]model.Candle, error) {
+	rows := make([]candle, 0)
+
+	query := s.db.Where(&candle{Pair: pair, Timeframe: timeframe}).Order("time")
+	if !start.IsZero() {
+		query = query.Where("time >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("time <= ?", end)
+	}
+
+	result := query.Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return lo.Map(rows, func(c candle, _ int) model.Candle {
+		return model.Candle{
+			Pair:      c.Pair,
+			Time:      c.Time,
+			UpdatedAt: c.UpdatedAt,
+			Open:      c.Open,
+			Close:     c.Close,
+			Low:       c.Low,
+			High:      c.High,
+			Volume:    c.Volume,
+			Complete:  c.Complete,
+		}
+	}), nil
+}
+
+// DeleteCandles removes the candles of a pair and timeframe opened before the given time
+func (s *SQL) DeleteCandles(pair, timeframe string, before time.Time) error {
+	result := s.db.Where(&candle{Pair: pair, Timeframe: timeframe}).Where("time < ?", before).Delete(&candle{})
+	return result.Error
+}
+
+// CreateSignal saves a strategy signal in the signals table
+func (s *SQL) CreateSignal(signal *model.Signal) error {
+	result := s.db.Create(signal)
+	return result.Error
+}
+
+// Signals returns the signals between start and end sorted by time
+func (s *SQL) Signals(start, end time.Time) ([]model.Signal, error) {
+	signals := make([]model.Signal, 0)
+
+	query := s.db.Order("time, id")
+	if !start.IsZero() {
+		query = query.Where("time >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("time <= ?", end)
+	}
+
+	result := query.Find(&signals)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return signals, nil
+}
@@ -1,17 +1,50 @@
 package storage
 
 import (
+	"errors"
 	"time"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 )
 
+var ErrStateNotFound = errors.New("state not found")
+
 type OrderFilter func(model.Order) bool
 
 type Storage interface {
 	CreateOrder(order *model.Order) error
 	UpdateOrder(order *model.Order) error
 	Orders(filters ...OrderFilter) ([]*model.Order, error)
+
+	// SetState saves a value in the key-value state store, replacing the previous value
+	SetState(key string, value []byte) error
+	// State returns the value of a given key, or ErrStateNotFound if it does not exist
+	State(key string) ([]byte, error)
+
+	// CreateEquitySnapshot saves a snapshot of the account equity
+	CreateEquitySnapshot(snapshot *model.EquitySnapshot) error
+	// EquitySnapshots returns the snapshots between start and end (inclusive) sorted by time,
+	// zero values of start or end are not limited
+	EquitySnapshots(start, end time.Time) (model.EquityCurve, error)
+
+	// CreateCandles saves the candles of a timeframe, replacing the candles with the same pair and time.
+	// The candle metadata is not persisted
+	CreateCandles(timeframe string, candles ...model.Candle) error
+	// Candles returns the candles of a pair and timeframe between start and end (inclusive) sorted by time,
+	// zero values of start or end are not limited
+	Candles(pair, timeframe string, start, end time.Time) ([]model.Candle, error)
+	// DeleteCandles removes the candles of a pair and timeframe opened before the given time
+	DeleteCandles(pair, timeframe string, before time.Time) error
+
+	// CreateSignal saves a strategy signal of the signal log
+	CreateSignal(signal *model.Signal) error
+	// Signals returns the signals between start and end (inclusive) sorted by time,
+	// zero values of start or end are not limited
+	Signals(start, end time.Time) ([]model.Signal, error)
+}
+
+func inPeriod(t, start, end time.Time) bool {
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
 }
 
 func WithStatusIn(status ...model.OrderStatusType) OrderFilter {
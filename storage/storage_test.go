@@ -40,6 +40,121 @@ func storageUseCase(repo Storage, t *testing.T) {
 	err = repo.CreateOrder(secondOrder)
 	require.NoError(t, err)
 
+	t.Run("state", func(t *testing.T) {
+		_, err := repo.State("grid")
+		require.ErrorIs(t, err, ErrStateNotFound)
+
+		require.NoError(t, repo.SetState("grid", []byte(`{"level":1}`)))
+		require.NoError(t, repo.SetState("grid", []byte(`{"level":2}`)))
+
+		value, err := repo.State("grid")
+		require.NoError(t, err)
+		require.Equal(t, `{"level":2}`, string(value))
+	})
+
+	t.Run("equity snapshots", func(t *testing.T) {
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, equity := range []float64{100, 90, 110} {
+			snapshot := &model.EquitySnapshot{Time: start.Add(time.Duration(2-i) * time.Hour), Equity: equity}
+			require.NoError(t, repo.CreateEquitySnapshot(snapshot))
+			require.NotZero(t, snapshot.ID)
+		}
+
+		snapshots, err := repo.EquitySnapshots(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, snapshots, 3)
+		require.Equal(t, []float64{110, 90, 100},
+			[]float64{snapshots[0].Equity, snapshots[1].Equity, snapshots[2].Equity})
+		require.True(t, snapshots[0].Time.Equal(start))
+
+		snapshots, err = repo.EquitySnapshots(start.Add(time.Hour), start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, snapshots, 1)
+		require.Equal(t, 90.0, snapshots[0].Equity)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles := make([]model.Candle, 0)
+		for i := 0; i < 3; i++ {
+			candles = append(candles, model.Candle{
+				Pair:     "BTCUSDT",
+				Time:     start.Add(time.Duration(i) * time.Hour),
+				Close:    float64(i),
+				Complete: true,
+			})
+		}
+
+		require.NoError(t, repo.CreateCandles("1h", candles[2], candles[0], candles[1]))
+		require.NoError(t, repo.CreateCandles("1h", model.Candle{Pair: "BTCUSDT", Time: start, Close: 10}))
+		require.NoError(t, repo.CreateCandles("1d", model.Candle{Pair: "BTCUSDT", Time: start, Close: 20}))
+		require.NoError(t, repo.CreateCandles("1h", model.Candle{Pair: "ETHUSDT", Time: start, Close: 30}))
+
+		result, err := repo.Candles("BTCUSDT", "1h", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, result, 3)
+		require.Equal(t, []float64{10, 1, 2}, []float64{result[0].Close, result[1].Close, result[2].Close})
+		require.True(t, result[0].Time.Equal(start))
+
+		result, err = repo.Candles("BTCUSDT", "1h", start.Add(time.Hour), time.Time{})
+		require.NoError(t, err)
+		require.Len(t, result, 2)
+		require.True(t, result[1].Complete)
+
+		result, err = repo.Candles("BTCUSDT", "1d", time.Time{}, start)
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+		require.Equal(t, 20.0, result[0].Close)
+
+		require.NoError(t, repo.DeleteCandles("BTCUSDT", "1h", start.Add(2*time.Hour)))
+		result, err = repo.Candles("BTCUSDT", "1h", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+		require.Equal(t, 2.0, result[0].Close)
+
+		result, err = repo.Candles("ETHUSDT", "1h", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+	})
+
+	t.Run("signals", func(t *testing.T) {
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, status := range []model.SignalStatus{model.SignalStatusExecuted, model.SignalStatusBlocked,
+			model.SignalStatusSkipped} {
+			signal := &model.Signal{
+				Time:   start.Add(time.Duration(2-i) * time.Hour),
+				Pair:   "BTCUSDT",
+				Side:   model.SideTypeBuy,
+				Status: status,
+				Reason: string(status),
+			}
+			require.NoError(t, repo.CreateSignal(signal))
+			require.NotZero(t, signal.ID)
+		}
+
+		signals, err := repo.Signals(time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, signals, 3)
+		require.Equal(t, model.SignalStatusSkipped, signals[0].Status)
+		require.Equal(t, "executed", signals[2].Reason)
+		require.True(t, signals[0].Time.Equal(start))
+
+		signals, err = repo.Signals(start.Add(time.Hour), time.Time{})
+		require.NoError(t, err)
+		require.Len(t, signals, 2)
+		require.Equal(t, model.SignalStatusBlocked, signals[0].Status)
+
+		signals, err = repo.Signals(start.Add(time.Hour), start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, signals, 1)
+		require.Equal(t, model.SignalStatusBlocked, signals[0].Status)
+
+		// the signals are not orders
+		orders, err := repo.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+	})
+
 	t.Run("filter with date restriction", func(t *testing.T) {
 		orders, err := repo.Orders(WithUpdateAtBeforeOrEqual(now))
 		require.NoError(t, err)
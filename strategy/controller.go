@@ -1,7 +1,11 @@
 package strategy
 
 import (
+	"sync"
+	"time"
+
 	log "github.com/sirupsen/logrus"
+	"github.com/xhit/go-str2duration/v2"
 
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/service"
@@ -12,6 +16,23 @@ type Controller struct {
 	dataframe *model.Dataframe
 	broker    service.Broker
 	started   bool
+	paused    bool
+
+	mtx        sync.Mutex
+	duration   time.Duration
+	timeframes map[string]*timeframe
+	lookback   int
+	timeMode   model.CandleTimeMode
+}
+
+// DefaultLookback is the minimum number of candles kept in the dataframe of a strategy, see SetLookback
+const DefaultLookback = 1000
+
+// timeframe keeps the candles of an additional timeframe until the close of the main candle
+type timeframe struct {
+	duration  time.Duration
+	dataframe *model.Dataframe
+	pending   []model.Candle
 }
 
 func NewStrategyController(pair string, strategy Strategy, broker service.Broker) *Controller {
@@ -20,49 +41,155 @@ func NewStrategyController(pair string, strategy Strategy, broker service.Broker
 		Metadata: make(map[string]model.Series[float64]),
 	}
 
-	return &Controller{
-		dataframe: dataframe,
-		strategy:  strategy,
-		broker:    broker,
+	controller := &Controller{
+		dataframe:  dataframe,
+		strategy:   strategy,
+		broker:     broker,
+		timeframes: make(map[string]*timeframe),
+	}
+	controller.SetLookback(0)
+
+	if str, ok := strategy.(MultiTimeframeStrategy); ok {
+		// timeframes are validated by the bot, before creating the controller
+		controller.duration, _ = str2duration.ParseDuration(strategy.Timeframe())
+		dataframe.Timeframes = make(map[string]*model.Dataframe)
+		for _, tf := range str.Timeframes() {
+			duration, _ := str2duration.ParseDuration(tf)
+			controller.timeframes[tf] = &timeframe{
+				duration: duration,
+				dataframe: &model.Dataframe{
+					Pair:     pair,
+					Metadata: make(map[string]model.Series[float64]),
+				},
+			}
+			dataframe.Timeframes[tf] = controller.timeframes[tf].dataframe
+		}
+	}
+
+	return controller
+}
+
+// SetLookback limits the candles kept in the dataframes of the strategy to the last n candles of each
+// timeframe, dropping the oldest ones to bound the memory of long-running bots. The indicators are calculated
+// with the warmup period, so n lower than it is raised to the warmup. Zero uses the default, the largest of
+// DefaultLookback and 10 times the warmup period
+func (s *Controller) SetLookback(n int) {
+	warmup := s.strategy.WarmupPeriod()
+	if n <= 0 {
+		n = DefaultLookback
+		if 10*warmup > n {
+			n = 10 * warmup
+		}
 	}
+	if n < warmup {
+		n = warmup
+	}
+	s.lookback = n
+}
+
+// SetCandleTimeMode sets the timestamp convention of the received candles, used to align the candles of the
+// additional timeframes by the close time. Default: model.CandleTimeOpen
+func (s *Controller) SetCandleTimeMode(mode model.CandleTimeMode) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.timeMode = mode
 }
 
 func (s *Controller) Start() {
 	s.started = true
 }
 
+// Pause stops calling the strategy OnCandle and OnPartialCandle, the candles are still included in the
+// dataframe and the indicators are updated, so the strategy resumes with the current state
+func (s *Controller) Pause() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.paused = true
+}
+
+// Resume calls the strategy again from the next candle, see Pause
+func (s *Controller) Resume() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.paused = false
+}
+
+func (s *Controller) isPaused() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.paused
+}
+
 func (s *Controller) OnPartialCandle(candle model.Candle) {
 	if !candle.Complete && len(s.dataframe.Close) >= s.strategy.WarmupPeriod() {
 		if str, ok := s.strategy.(HighFrequencyStrategy); ok {
-			s.updateDataFrame(candle)
+			updateDataFrame(s.dataframe, candle)
 			str.Indicators(s.dataframe)
-			str.OnPartialCandle(s.dataframe, s.broker)
+			if !s.isPaused() {
+				str.OnPartialCandle(s.dataframe, s.broker)
+			}
 		}
 	}
 }
 
-func (s *Controller) updateDataFrame(candle model.Candle) {
-	if len(s.dataframe.Time) > 0 && candle.Time.Equal(s.dataframe.Time[len(s.dataframe.Time)-1]) {
-		last := len(s.dataframe.Time) - 1
-		s.dataframe.Close[last] = candle.Close
-		s.dataframe.Open[last] = candle.Open
-		s.dataframe.High[last] = candle.High
-		s.dataframe.Low[last] = candle.Low
-		s.dataframe.Volume[last] = candle.Volume
-		s.dataframe.Time[last] = candle.Time
+// OnTimeframeCandle receives a closed candle of an additional timeframe, it is included in the dataframe
+// when a candle of the strategy timeframe closes at the same time or later
+func (s *Controller) OnTimeframeCandle(tf string, candle model.Candle) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if data, ok := s.timeframes[tf]; ok && candle.Complete {
+		data.pending = append(data.pending, candle)
+	}
+}
+
+func (s *Controller) alignTimeframes(candle model.Candle) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	closeTime := s.closeTime(candle, s.duration)
+	for _, data := range s.timeframes {
+		i := 0
+		for ; i < len(data.pending) && !s.closeTime(data.pending[i], data.duration).After(closeTime); i++ {
+			df := data.dataframe
+			if len(df.Time) > 0 && data.pending[i].Time.Before(df.Time[len(df.Time)-1]) {
+				log.Errorf("late candle received: %#v", data.pending[i])
+				continue
+			}
+			updateDataFrame(df, data.pending[i])
+			df.Trim(s.lookback)
+		}
+		data.pending = data.pending[i:]
+	}
+}
+
+// closeTime returns the close time of a candle of the given duration
+func (s *Controller) closeTime(candle model.Candle, duration time.Duration) time.Time {
+	return s.timeMode.OpenTime(candle.Time, duration).Add(duration)
+}
+
+func updateDataFrame(df *model.Dataframe, candle model.Candle) {
+	if len(df.Time) > 0 && candle.Time.Equal(df.Time[len(df.Time)-1]) {
+		last := len(df.Time) - 1
+		df.Close[last] = candle.Close
+		df.Open[last] = candle.Open
+		df.High[last] = candle.High
+		df.Low[last] = candle.Low
+		df.Volume[last] = candle.Volume
+		df.Time[last] = candle.Time
 		for k, v := range candle.Metadata {
-			s.dataframe.Metadata[k][last] = v
+			df.Metadata[k][last] = v
 		}
 	} else {
-		s.dataframe.Close = append(s.dataframe.Close, candle.Close)
-		s.dataframe.Open = append(s.dataframe.Open, candle.Open)
-		s.dataframe.High = append(s.dataframe.High, candle.High)
-		s.dataframe.Low = append(s.dataframe.Low, candle.Low)
-		s.dataframe.Volume = append(s.dataframe.Volume, candle.Volume)
-		s.dataframe.Time = append(s.dataframe.Time, candle.Time)
-		s.dataframe.LastUpdate = candle.Time
+		df.Close = append(df.Close, candle.Close)
+		df.Open = append(df.Open, candle.Open)
+		df.High = append(df.High, candle.High)
+		df.Low = append(df.Low, candle.Low)
+		df.Volume = append(df.Volume, candle.Volume)
+		df.Time = append(df.Time, candle.Time)
+		df.LastUpdate = candle.Time
 		for k, v := range candle.Metadata {
-			s.dataframe.Metadata[k] = append(s.dataframe.Metadata[k], v)
+			df.Metadata[k] = append(df.Metadata[k], v)
 		}
 	}
 }
@@ -73,12 +200,16 @@ func (s *Controller) OnCandle(candle model.Candle) {
 		return
 	}
 
-	s.updateDataFrame(candle)
+	updateDataFrame(s.dataframe, candle)
+	s.dataframe.Trim(s.lookback)
+	if len(s.timeframes) > 0 {
+		s.alignTimeframes(candle)
+	}
 
 	if len(s.dataframe.Close) >= s.strategy.WarmupPeriod() {
 		sample := s.dataframe.Sample(s.strategy.WarmupPeriod())
 		s.strategy.Indicators(&sample)
-		if s.started {
+		if s.started && !s.isPaused() {
 			s.strategy.OnCandle(&sample, s.broker)
 		}
 	}
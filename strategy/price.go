@@ -0,0 +1,29 @@
+package strategy
+
+import (
+	"fmt"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+// LimitPrice returns a valid limit price for the dataframe pair, offset by the given ticks from the reference
+// price of the order book, or from the last close when the depth is nil. Positive ticks improve the reference
+// (e.g. buy one tick above the best bid), zero joins it and negative ticks place the order behind it.
+//
+//	price, err := strategy.LimitPrice(broker, df, nil, model.SideTypeBuy, exchange.PriceReferenceBid, 1)
+func LimitPrice(broker service.Broker, df *model.Dataframe, depth *model.Depth, side model.SideType,
+	reference exchange.PriceReference, ticks int) (float64, error) {
+
+	price, err := exchange.ReferencePrice(df, depth, reference)
+	if err != nil {
+		return 0, err
+	}
+
+	price = exchange.OffsetPrice(broker.AssetsInfo(df.Pair), side, price, ticks)
+	if price <= 0 {
+		return 0, fmt.Errorf("invalid limit price %f for %s", price, df.Pair)
+	}
+	return price, nil
+}
@@ -0,0 +1,49 @@
+package strategy
+
+import (
+	"fmt"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/indicator"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+// VolatilitySize returns the quantity that loses the risk amount (in the quote asset) when the price moves against
+// the position by the stop distance, which is multiplier times the ATR of the given period. The quantity scales
+// inversely with the volatility, so every trade risks the same amount, and it is rounded down to the lot size of
+// the pair. The stop distance is returned to place the stop order, e.g. risk 100 USDT with a 2 x ATR(14) stop:
+//
+//	quantity, distance, err := strategy.VolatilitySize(broker, df, 100, 14, 2)
+//	stop := df.Close.Last(0) - distance
+func VolatilitySize(broker service.Broker, df *model.Dataframe, risk float64, period int,
+	multiplier float64) (quantity, distance float64, err error) {
+
+	if risk <= 0 || period <= 0 || multiplier <= 0 {
+		return 0, 0, fmt.Errorf("invalid volatility size: risk %f, period %d, multiplier %f", risk, period,
+			multiplier)
+	}
+
+	if len(df.Close) <= period {
+		return 0, 0, fmt.Errorf("%w: ATR(%d) of %s with %d candles", exchange.ErrInsufficientData, period,
+			df.Pair, len(df.Close))
+	}
+
+	atr := indicator.ATR(df.High, df.Low, df.Close, period)
+	distance = atr[len(atr)-1] * multiplier
+	if distance <= 0 {
+		return 0, 0, fmt.Errorf("invalid ATR stop distance %f for %s", distance, df.Pair)
+	}
+
+	info := broker.AssetsInfo(df.Pair)
+	quantity = exchange.RoundQuantity(info, risk/distance)
+	if quantity <= 0 || quantity < info.MinQuantity {
+		return 0, 0, fmt.Errorf("%w: %f below the minimum of %s", exchange.ErrInvalidQuantity, quantity, df.Pair)
+	}
+
+	if info.MaxQuantity > 0 && quantity > info.MaxQuantity {
+		quantity = exchange.RoundQuantity(info, info.MaxQuantity)
+	}
+
+	return quantity, distance, nil
+}
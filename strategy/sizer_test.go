@@ -0,0 +1,82 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+type sizerBroker struct {
+	service.Broker
+	info model.AssetInfo
+}
+
+func (b sizerBroker) AssetsInfo(_ string) model.AssetInfo {
+	return b.info
+}
+
+func TestVolatilitySize(t *testing.T) {
+	// candles with a constant true range, the ATR is the spread
+	dataframe := func(candles int, spread float64) *model.Dataframe {
+		df := &model.Dataframe{Pair: "BTCUSDT"}
+		for i := 0; i < candles; i++ {
+			df.High = append(df.High, 100+spread/2)
+			df.Low = append(df.Low, 100-spread/2)
+			df.Close = append(df.Close, 100)
+		}
+		return df
+	}
+	info := model.AssetInfo{StepSize: 0.001, BaseAssetPrecision: 3}
+
+	tests := []struct {
+		name       string
+		df         *model.Dataframe
+		info       model.AssetInfo
+		risk       float64
+		period     int
+		multiplier float64
+		quantity   float64
+		distance   float64
+		err        error
+	}{
+		{name: "risk over distance", df: dataframe(5, 2), info: info, risk: 100, period: 3, multiplier: 2,
+			quantity: 25, distance: 4},
+		{name: "rounded down to the step", df: dataframe(5, 2), info: info, risk: 10, period: 3, multiplier: 3,
+			quantity: 1.666, distance: 6},
+		{name: "higher volatility, lower size", df: dataframe(5, 4), info: info, risk: 100, period: 3,
+			multiplier: 2, quantity: 12.5, distance: 8},
+		{name: "limited to the max quantity", df: dataframe(5, 2),
+			info: model.AssetInfo{StepSize: 0.001, BaseAssetPrecision: 3, MaxQuantity: 10}, risk: 100, period: 3,
+			multiplier: 2, quantity: 10, distance: 4},
+		{name: "below the min quantity", df: dataframe(5, 2),
+			info: model.AssetInfo{StepSize: 0.001, BaseAssetPrecision: 3, MinQuantity: 1}, risk: 1, period: 3,
+			multiplier: 2, err: exchange.ErrInvalidQuantity},
+		{name: "insufficient candles", df: dataframe(3, 2), info: info, risk: 100, period: 3, multiplier: 2,
+			err: exchange.ErrInsufficientData},
+		{name: "without volatility", df: dataframe(5, 0), info: info, risk: 100, period: 3, multiplier: 2},
+		{name: "invalid risk", df: dataframe(5, 2), info: info, risk: 0, period: 3, multiplier: 2},
+		{name: "invalid multiplier", df: dataframe(5, 2), info: info, risk: 100, period: 3, multiplier: -1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			quantity, distance, err := VolatilitySize(sizerBroker{info: tc.info}, tc.df, tc.risk, tc.period,
+				tc.multiplier)
+			if tc.quantity == 0 {
+				require.Error(t, err)
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.InDelta(t, tc.quantity, quantity, 1e-9)
+			require.InDelta(t, tc.distance, distance, 1e-9)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package strategy
+
+import (
+	"encoding/json"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/rodrigo-brito/ninjabot/storage"
+)
+
+// State is a key-value store backed by the bot storage, values are encoded as JSON
+// and kept across restarts. e.g. grid levels, last signal or trailing values
+type State struct {
+	storage storage.Storage
+}
+
+func NewState(storage storage.Storage) *State {
+	return &State{storage: storage}
+}
+
+// Set saves the value of a given key, replacing the previous value
+func (s *State) Set(key string, value any) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.storage.SetState(key, content)
+}
+
+// Get loads the value of a given key into target. It returns false if the key does not exist
+func (s *State) Get(key string, target any) (bool, error) {
+	content, err := s.storage.State(key)
+	if errors.Is(err, storage.ErrStateNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(content, target)
+}
+
+func getOrDefault[T any](s *State, key string, defaultValue T) T {
+	value := defaultValue
+	if _, err := s.Get(key, &value); err != nil {
+		log.Errorf("[STATE] invalid value for %s: %v", key, err)
+		return defaultValue
+	}
+	return value
+}
+
+// Float returns the value of a given key, or the default value if it does not exist
+func (s *State) Float(key string, defaultValue float64) float64 {
+	return getOrDefault(s, key, defaultValue)
+}
+
+// Int returns the value of a given key, or the default value if it does not exist
+func (s *State) Int(key string, defaultValue int) int {
+	return getOrDefault(s, key, defaultValue)
+}
+
+// String returns the value of a given key, or the default value if it does not exist
+func (s *State) String(key string, defaultValue string) string {
+	return getOrDefault(s, key, defaultValue)
+}
+
+// Bool returns the value of a given key, or the default value if it does not exist
+func (s *State) Bool(key string, defaultValue bool) bool {
+	return getOrDefault(s, key, defaultValue)
+}
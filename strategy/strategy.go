@@ -1,6 +1,8 @@
 package strategy
 
 import (
+	"context"
+
 	"github.com/rodrigo-brito/ninjabot/model"
 	"github.com/rodrigo-brito/ninjabot/service"
 )
@@ -14,13 +16,86 @@ type Strategy interface {
 	// Indicators will be executed for each new candle, in order to fill indicators before `OnCandle` function is called.
 	Indicators(df *model.Dataframe) []ChartIndicator
 	// OnCandle will be executed for each new candle, after indicators are filled, here you can do your trading logic.
-	// OnCandle is executed after the candle close.
+	// OnCandle is executed after the candle close. The broker of the bot implements AccountState.
 	OnCandle(df *model.Dataframe, broker service.Broker)
 }
 
+type StatefulStrategy interface {
+	Strategy
+
+	// SetState is executed once before the bot starts with the state store of the bot storage,
+	// here you can restore the state saved in a previous execution.
+	SetState(state *State)
+}
+
+type MultiTimeframeStrategy interface {
+	Strategy
+
+	// Timeframes are the additional time intervals used by the strategy, eg: 1d for a trend filter in a 1h strategy.
+	// The closed candles of each timeframe are available in `OnCandle` with `df.Timeframes["1d"]`, aligned to
+	// the current candle: a candle is included only after its close time.
+	Timeframes() []string
+}
+
 type HighFrequencyStrategy interface {
 	Strategy
 
 	// OnPartialCandle will be executed for each new partial candle, after indicators are filled.
 	OnPartialCandle(df *model.Dataframe, broker service.Broker)
 }
+
+type ConfigurableStrategy interface {
+	Strategy
+
+	// Configure is executed once when the bot is created, with the parameters of the settings (e.g. loaded from
+	// the config file). Returning an error, e.g. for a missing required parameter, fails the bot creation.
+	Configure(parameters model.Parameters) error
+}
+
+type LifecycleStrategy interface {
+	Strategy
+
+	// OnStart is executed once when the bot starts, before the warmup candles, here you can set up the resources
+	// of the strategy, e.g. load a model or open a connection. Returning an error stops the bot.
+	OnStart(ctx context.Context, broker service.Broker) error
+	// OnStop is executed once when the bot stops, after the last candle, here you can release the resources.
+	// In backtests, it is executed after the last candle of the data feed.
+	OnStop()
+}
+
+// AccountState is implemented by the broker of the bot, with the account state of the active exchange (live or
+// paper wallet), e.g. `if account, ok := broker.(strategy.AccountState); ok { equity, err := account.Equity() }`
+type AccountState interface {
+	// Balance returns the balance of an asset, e.g. "USDT".
+	Balance(asset string) (model.Balance, error)
+	// Position returns the asset and quote balances of a pair, e.g. "BTCUSDT".
+	Position(pair string) (asset, quote float64, err error)
+	// Equity returns the total value of the account, in the base coin of the paper wallet, or in the base
+	// currency set with ninjabot.WithBaseCurrency in live trading.
+	Equity() (float64, error)
+}
+
+// BracketBroker is implemented by the broker of the bot, with the entry orders protected by a take profit and a
+// stop loss placed only when the entry is filled. It returns an error if the exchange does not support OTOCO orders
+type BracketBroker interface {
+	// CreateOrderOTOCO creates a limit entry order with an OCO bracket, returning the entry and the brackets.
+	CreateOrderOTOCO(side model.SideType, pair string, size, entry, takeProfit, stop, stopLimit float64) ([]model.Order,
+		error)
+}
+
+// SignalLogger is implemented by the broker when the signal log is enabled, see ninjabot.WithSignalLog.
+// e.g. `if logger, ok := broker.(strategy.SignalLogger); ok { logger.AnnotateSignal(df.Pair, "ema cross") }`
+type SignalLogger interface {
+	// AnnotateSignal sets the note of the next order of the pair, recorded with the outcome of the order.
+	AnnotateSignal(pair, note string)
+	// SkipSignal records a signal suppressed by the strategy, without an order, e.g. by a trend filter.
+	SkipSignal(pair string, side model.SideType, reason string)
+}
+
+// VolatilitySizer is implemented by the broker of the bot, with the position size that risks a constant amount
+// with an ATR stop, e.g. `if sizer, ok := broker.(strategy.VolatilitySizer); ok { ... }`, see VolatilitySize
+type VolatilitySizer interface {
+	// VolatilitySize returns the quantity and the stop distance of the dataframe pair, see VolatilitySize.
+	VolatilitySize(df *model.Dataframe, risk float64, period int, multiplier float64) (quantity, distance float64,
+		err error)
+}
@@ -63,6 +63,43 @@ func (_c *Broker_Account_Call) Return(_a0 model.Account, _a1 error) *Broker_Acco
 	return _c
 }
 
+// AssetsInfo provides a mock function with given fields: pair
+func (_m *Broker) AssetsInfo(pair string) model.AssetInfo {
+	ret := _m.Called(pair)
+
+	var r0 model.AssetInfo
+	if rf, ok := ret.Get(0).(func(string) model.AssetInfo); ok {
+		r0 = rf(pair)
+	} else {
+		r0 = ret.Get(0).(model.AssetInfo)
+	}
+
+	return r0
+}
+
+// Broker_AssetsInfo_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AssetsInfo'
+type Broker_AssetsInfo_Call struct {
+	*mock.Call
+}
+
+// AssetsInfo is a helper method to define mock.On call
+//   - pair string
+func (_e *Broker_Expecter) AssetsInfo(pair interface{}) *Broker_AssetsInfo_Call {
+	return &Broker_AssetsInfo_Call{Call: _e.mock.On("AssetsInfo", pair)}
+}
+
+func (_c *Broker_AssetsInfo_Call) Run(run func(pair string)) *Broker_AssetsInfo_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Broker_AssetsInfo_Call) Return(_a0 model.AssetInfo) *Broker_AssetsInfo_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
 // Cancel provides a mock function with given fields: _a0
 func (_m *Broker) Cancel(_a0 model.Order) error {
 	ret := _m.Called(_a0)
@@ -100,6 +137,52 @@ func (_c *Broker_Cancel_Call) Return(_a0 error) *Broker_Cancel_Call {
 	return _c
 }
 
+// CancelAll provides a mock function with given fields: pair
+func (_m *Broker) CancelAll(pair string) ([]model.Order, error) {
+	ret := _m.Called(pair)
+
+	var r0 []model.Order
+	if rf, ok := ret.Get(0).(func(string) []model.Order); ok {
+		r0 = rf(pair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Broker_CancelAll_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CancelAll'
+type Broker_CancelAll_Call struct {
+	*mock.Call
+}
+
+// CancelAll is a helper method to define mock.On call
+//   - pair string
+func (_e *Broker_Expecter) CancelAll(pair interface{}) *Broker_CancelAll_Call {
+	return &Broker_CancelAll_Call{Call: _e.mock.On("CancelAll", pair)}
+}
+
+func (_c *Broker_CancelAll_Call) Run(run func(pair string)) *Broker_CancelAll_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Broker_CancelAll_Call) Return(_a0 []model.Order, _a1 error) *Broker_CancelAll_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // CreateOrderLimit provides a mock function with given fields: side, pair, size, limit
 func (_m *Broker) CreateOrderLimit(side model.SideType, pair string, size float64, limit float64) (model.Order, error) {
 	ret := _m.Called(side, pair, size, limit)
@@ -147,6 +230,54 @@ func (_c *Broker_CreateOrderLimit_Call) Return(_a0 model.Order, _a1 error) *Brok
 	return _c
 }
 
+// CreateOrderLimitTIF provides a mock function with given fields: side, pair, size, limit, timeInForce
+func (_m *Broker) CreateOrderLimitTIF(side model.SideType, pair string, size float64, limit float64, timeInForce model.TimeInForce) (model.Order, error) {
+	ret := _m.Called(side, pair, size, limit, timeInForce)
+
+	var r0 model.Order
+	if rf, ok := ret.Get(0).(func(model.SideType, string, float64, float64, model.TimeInForce) model.Order); ok {
+		r0 = rf(side, pair, size, limit, timeInForce)
+	} else {
+		r0 = ret.Get(0).(model.Order)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.SideType, string, float64, float64, model.TimeInForce) error); ok {
+		r1 = rf(side, pair, size, limit, timeInForce)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Broker_CreateOrderLimitTIF_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateOrderLimitTIF'
+type Broker_CreateOrderLimitTIF_Call struct {
+	*mock.Call
+}
+
+// CreateOrderLimitTIF is a helper method to define mock.On call
+//   - side model.SideType
+//   - pair string
+//   - size float64
+//   - limit float64
+//   - timeInForce model.TimeInForce
+func (_e *Broker_Expecter) CreateOrderLimitTIF(side interface{}, pair interface{}, size interface{}, limit interface{}, timeInForce interface{}) *Broker_CreateOrderLimitTIF_Call {
+	return &Broker_CreateOrderLimitTIF_Call{Call: _e.mock.On("CreateOrderLimitTIF", side, pair, size, limit, timeInForce)}
+}
+
+func (_c *Broker_CreateOrderLimitTIF_Call) Run(run func(side model.SideType, pair string, size float64, limit float64, timeInForce model.TimeInForce)) *Broker_CreateOrderLimitTIF_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(model.SideType), args[1].(string), args[2].(float64), args[3].(float64), args[4].(model.TimeInForce))
+	})
+	return _c
+}
+
+func (_c *Broker_CreateOrderLimitTIF_Call) Return(_a0 model.Order, _a1 error) *Broker_CreateOrderLimitTIF_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // CreateOrderMarket provides a mock function with given fields: side, pair, size
 func (_m *Broker) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
 	ret := _m.Called(side, pair, size)
@@ -336,6 +467,52 @@ func (_c *Broker_CreateOrderStop_Call) Return(_a0 model.Order, _a1 error) *Broke
 	return _c
 }
 
+// OpenOrders provides a mock function with given fields: pair
+func (_m *Broker) OpenOrders(pair string) ([]model.Order, error) {
+	ret := _m.Called(pair)
+
+	var r0 []model.Order
+	if rf, ok := ret.Get(0).(func(string) []model.Order); ok {
+		r0 = rf(pair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Broker_OpenOrders_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'OpenOrders'
+type Broker_OpenOrders_Call struct {
+	*mock.Call
+}
+
+// OpenOrders is a helper method to define mock.On call
+//   - pair string
+func (_e *Broker_Expecter) OpenOrders(pair interface{}) *Broker_OpenOrders_Call {
+	return &Broker_OpenOrders_Call{Call: _e.mock.On("OpenOrders", pair)}
+}
+
+func (_c *Broker_OpenOrders_Call) Run(run func(pair string)) *Broker_OpenOrders_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Broker_OpenOrders_Call) Return(_a0 []model.Order, _a1 error) *Broker_OpenOrders_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Order provides a mock function with given fields: pair, id
 func (_m *Broker) Order(pair string, id int64) (model.Order, error) {
 	ret := _m.Called(pair, id)
@@ -141,6 +141,52 @@ func (_c *Exchange_Cancel_Call) Return(_a0 error) *Exchange_Cancel_Call {
 	return _c
 }
 
+// CancelAll provides a mock function with given fields: pair
+func (_m *Exchange) CancelAll(pair string) ([]model.Order, error) {
+	ret := _m.Called(pair)
+
+	var r0 []model.Order
+	if rf, ok := ret.Get(0).(func(string) []model.Order); ok {
+		r0 = rf(pair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exchange_CancelAll_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CancelAll'
+type Exchange_CancelAll_Call struct {
+	*mock.Call
+}
+
+// CancelAll is a helper method to define mock.On call
+//   - pair string
+func (_e *Exchange_Expecter) CancelAll(pair interface{}) *Exchange_CancelAll_Call {
+	return &Exchange_CancelAll_Call{Call: _e.mock.On("CancelAll", pair)}
+}
+
+func (_c *Exchange_CancelAll_Call) Run(run func(pair string)) *Exchange_CancelAll_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Exchange_CancelAll_Call) Return(_a0 []model.Order, _a1 error) *Exchange_CancelAll_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // CandlesByLimit provides a mock function with given fields: ctx, pair, period, limit
 func (_m *Exchange) CandlesByLimit(ctx context.Context, pair string, period string, limit int) ([]model.Candle, error) {
 	ret := _m.Called(ctx, pair, period, limit)
@@ -337,6 +383,54 @@ func (_c *Exchange_CreateOrderLimit_Call) Return(_a0 model.Order, _a1 error) *Ex
 	return _c
 }
 
+// CreateOrderLimitTIF provides a mock function with given fields: side, pair, size, limit, timeInForce
+func (_m *Exchange) CreateOrderLimitTIF(side model.SideType, pair string, size float64, limit float64, timeInForce model.TimeInForce) (model.Order, error) {
+	ret := _m.Called(side, pair, size, limit, timeInForce)
+
+	var r0 model.Order
+	if rf, ok := ret.Get(0).(func(model.SideType, string, float64, float64, model.TimeInForce) model.Order); ok {
+		r0 = rf(side, pair, size, limit, timeInForce)
+	} else {
+		r0 = ret.Get(0).(model.Order)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.SideType, string, float64, float64, model.TimeInForce) error); ok {
+		r1 = rf(side, pair, size, limit, timeInForce)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exchange_CreateOrderLimitTIF_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateOrderLimitTIF'
+type Exchange_CreateOrderLimitTIF_Call struct {
+	*mock.Call
+}
+
+// CreateOrderLimitTIF is a helper method to define mock.On call
+//   - side model.SideType
+//   - pair string
+//   - size float64
+//   - limit float64
+//   - timeInForce model.TimeInForce
+func (_e *Exchange_Expecter) CreateOrderLimitTIF(side interface{}, pair interface{}, size interface{}, limit interface{}, timeInForce interface{}) *Exchange_CreateOrderLimitTIF_Call {
+	return &Exchange_CreateOrderLimitTIF_Call{Call: _e.mock.On("CreateOrderLimitTIF", side, pair, size, limit, timeInForce)}
+}
+
+func (_c *Exchange_CreateOrderLimitTIF_Call) Run(run func(side model.SideType, pair string, size float64, limit float64, timeInForce model.TimeInForce)) *Exchange_CreateOrderLimitTIF_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(model.SideType), args[1].(string), args[2].(float64), args[3].(float64), args[4].(model.TimeInForce))
+	})
+	return _c
+}
+
+func (_c *Exchange_CreateOrderLimitTIF_Call) Return(_a0 model.Order, _a1 error) *Exchange_CreateOrderLimitTIF_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // CreateOrderMarket provides a mock function with given fields: side, pair, size
 func (_m *Exchange) CreateOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
 	ret := _m.Called(side, pair, size)
@@ -526,6 +620,50 @@ func (_c *Exchange_CreateOrderStop_Call) Return(_a0 model.Order, _a1 error) *Exc
 	return _c
 }
 
+// LastPrice provides a mock function with given fields: pair
+func (_m *Exchange) LastPrice(pair string) (float64, error) {
+	ret := _m.Called(pair)
+
+	var r0 float64
+	if rf, ok := ret.Get(0).(func(string) float64); ok {
+		r0 = rf(pair)
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exchange_LastPrice_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'LastPrice'
+type Exchange_LastPrice_Call struct {
+	*mock.Call
+}
+
+// LastPrice is a helper method to define mock.On call
+//   - pair string
+func (_e *Exchange_Expecter) LastPrice(pair interface{}) *Exchange_LastPrice_Call {
+	return &Exchange_LastPrice_Call{Call: _e.mock.On("LastPrice", pair)}
+}
+
+func (_c *Exchange_LastPrice_Call) Run(run func(pair string)) *Exchange_LastPrice_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Exchange_LastPrice_Call) Return(_a0 float64, _a1 error) *Exchange_LastPrice_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // LastQuote provides a mock function with given fields: ctx, pair
 func (_m *Exchange) LastQuote(ctx context.Context, pair string) (float64, error) {
 	ret := _m.Called(ctx, pair)
@@ -571,6 +709,52 @@ func (_c *Exchange_LastQuote_Call) Return(_a0 float64, _a1 error) *Exchange_Last
 	return _c
 }
 
+// OpenOrders provides a mock function with given fields: pair
+func (_m *Exchange) OpenOrders(pair string) ([]model.Order, error) {
+	ret := _m.Called(pair)
+
+	var r0 []model.Order
+	if rf, ok := ret.Get(0).(func(string) []model.Order); ok {
+		r0 = rf(pair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Order)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exchange_OpenOrders_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'OpenOrders'
+type Exchange_OpenOrders_Call struct {
+	*mock.Call
+}
+
+// OpenOrders is a helper method to define mock.On call
+//   - pair string
+func (_e *Exchange_Expecter) OpenOrders(pair interface{}) *Exchange_OpenOrders_Call {
+	return &Exchange_OpenOrders_Call{Call: _e.mock.On("OpenOrders", pair)}
+}
+
+func (_c *Exchange_OpenOrders_Call) Run(run func(pair string)) *Exchange_OpenOrders_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Exchange_OpenOrders_Call) Return(_a0 []model.Order, _a1 error) *Exchange_OpenOrders_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Order provides a mock function with given fields: pair, id
 func (_m *Exchange) Order(pair string, id int64) (model.Order, error) {
 	ret := _m.Called(pair, id)
@@ -667,6 +851,55 @@ func (_c *Exchange_Position_Call) Return(asset float64, quote float64, err error
 	return _c
 }
 
+// TradesSubscription provides a mock function with given fields: ctx, pair
+func (_m *Exchange) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ret := _m.Called(ctx, pair)
+
+	var r0 chan model.Trade
+	if rf, ok := ret.Get(0).(func(context.Context, string) chan model.Trade); ok {
+		r0 = rf(ctx, pair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(chan model.Trade)
+		}
+	}
+
+	var r1 chan error
+	if rf, ok := ret.Get(1).(func(context.Context, string) chan error); ok {
+		r1 = rf(ctx, pair)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(chan error)
+		}
+	}
+
+	return r0, r1
+}
+
+// Exchange_TradesSubscription_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TradesSubscription'
+type Exchange_TradesSubscription_Call struct {
+	*mock.Call
+}
+
+// TradesSubscription is a helper method to define mock.On call
+//   - ctx context.Context
+//   - pair string
+func (_e *Exchange_Expecter) TradesSubscription(ctx interface{}, pair interface{}) *Exchange_TradesSubscription_Call {
+	return &Exchange_TradesSubscription_Call{Call: _e.mock.On("TradesSubscription", ctx, pair)}
+}
+
+func (_c *Exchange_TradesSubscription_Call) Run(run func(ctx context.Context, pair string)) *Exchange_TradesSubscription_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Exchange_TradesSubscription_Call) Return(_a0 chan model.Trade, _a1 chan error) *Exchange_TradesSubscription_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 type mockConstructorTestingTNewExchange interface {
 	mock.TestingT
 	Cleanup(func())
@@ -210,6 +210,50 @@ func (_c *Feeder_CandlesSubscription_Call) Return(_a0 chan model.Candle, _a1 cha
 	return _c
 }
 
+// LastPrice provides a mock function with given fields: pair
+func (_m *Feeder) LastPrice(pair string) (float64, error) {
+	ret := _m.Called(pair)
+
+	var r0 float64
+	if rf, ok := ret.Get(0).(func(string) float64); ok {
+		r0 = rf(pair)
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Feeder_LastPrice_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'LastPrice'
+type Feeder_LastPrice_Call struct {
+	*mock.Call
+}
+
+// LastPrice is a helper method to define mock.On call
+//   - pair string
+func (_e *Feeder_Expecter) LastPrice(pair interface{}) *Feeder_LastPrice_Call {
+	return &Feeder_LastPrice_Call{Call: _e.mock.On("LastPrice", pair)}
+}
+
+func (_c *Feeder_LastPrice_Call) Run(run func(pair string)) *Feeder_LastPrice_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Feeder_LastPrice_Call) Return(_a0 float64, _a1 error) *Feeder_LastPrice_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // LastQuote provides a mock function with given fields: ctx, pair
 func (_m *Feeder) LastQuote(ctx context.Context, pair string) (float64, error) {
 	ret := _m.Called(ctx, pair)
@@ -255,6 +299,55 @@ func (_c *Feeder_LastQuote_Call) Return(_a0 float64, _a1 error) *Feeder_LastQuot
 	return _c
 }
 
+// TradesSubscription provides a mock function with given fields: ctx, pair
+func (_m *Feeder) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	ret := _m.Called(ctx, pair)
+
+	var r0 chan model.Trade
+	if rf, ok := ret.Get(0).(func(context.Context, string) chan model.Trade); ok {
+		r0 = rf(ctx, pair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(chan model.Trade)
+		}
+	}
+
+	var r1 chan error
+	if rf, ok := ret.Get(1).(func(context.Context, string) chan error); ok {
+		r1 = rf(ctx, pair)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(chan error)
+		}
+	}
+
+	return r0, r1
+}
+
+// Feeder_TradesSubscription_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TradesSubscription'
+type Feeder_TradesSubscription_Call struct {
+	*mock.Call
+}
+
+// TradesSubscription is a helper method to define mock.On call
+//   - ctx context.Context
+//   - pair string
+func (_e *Feeder_Expecter) TradesSubscription(ctx interface{}, pair interface{}) *Feeder_TradesSubscription_Call {
+	return &Feeder_TradesSubscription_Call{Call: _e.mock.On("TradesSubscription", ctx, pair)}
+}
+
+func (_c *Feeder_TradesSubscription_Call) Run(run func(ctx context.Context, pair string)) *Feeder_TradesSubscription_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Feeder_TradesSubscription_Call) Return(_a0 chan model.Trade, _a1 chan error) *Feeder_TradesSubscription_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 type mockConstructorTestingTNewFeeder interface {
 	mock.TestingT
 	Cleanup(func())
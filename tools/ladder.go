@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+)
+
+// TakeProfitLevel is a step of a take-profit ladder
+type TakeProfitLevel struct {
+	// Profit is the distance from the entry price, e.g. 0.02 for +2%
+	Profit float64
+	// Fraction is the fraction of the entry quantity closed in the level, e.g. 0.5 for 50%
+	Fraction float64
+}
+
+// TakeProfitLadder exits a position in stages, with a limit order by level on the opposite side of the
+// entry, and a stop that closes the remaining quantity with a market order. After the first level is
+// filled, the stop moves to the entry price (breakeven).
+//
+// The ladder must receive the order updates (OnOrder) to detect fills, and the candles (OnCandle) to
+// trigger the stop. It can be registered with ninjabot.WithOrderSubscription and
+// ninjabot.WithCandleSubscription, or called from the strategy.
+type TakeProfitLadder struct {
+	broker    service.Broker
+	levels    []TakeProfitLevel
+	breakeven bool
+
+	mtx       sync.Mutex
+	active    bool
+	pair      string
+	side      model.SideType
+	entry     float64
+	stop      float64
+	remaining float64
+	orders    map[int64]model.Order
+}
+
+type TakeProfitLadderOption func(*TakeProfitLadder)
+
+// WithLadderBreakeven enables or disables moving the stop to the entry price after the first fill.
+// Default: enabled
+func WithLadderBreakeven(enabled bool) TakeProfitLadderOption {
+	return func(l *TakeProfitLadder) {
+		l.breakeven = enabled
+	}
+}
+
+// NewTakeProfitLadder creates a ladder with the given levels, e.g. 50% at +2%, 30% at +4% and 20% at +6%:
+//
+//	tools.NewTakeProfitLadder(broker, []tools.TakeProfitLevel{{0.02, 0.5}, {0.04, 0.3}, {0.06, 0.2}})
+func NewTakeProfitLadder(broker service.Broker, levels []TakeProfitLevel,
+	options ...TakeProfitLadderOption) *TakeProfitLadder {
+
+	ladder := &TakeProfitLadder{
+		broker:    broker,
+		levels:    levels,
+		breakeven: true,
+		orders:    make(map[int64]model.Order),
+	}
+
+	for _, option := range options {
+		option(ladder)
+	}
+
+	return ladder
+}
+
+// Start places the take-profit orders of a filled entry order. The quantity of each level is rounded down
+// to the pair step size, and the last level closes the remaining quantity. A zero stop disables the stop.
+// The orders only close the entry quantity, so the ladder never opens a position in the opposite side.
+func (l *TakeProfitLadder) Start(entry model.Order, stop float64) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.active {
+		return errors.New("take-profit ladder already active")
+	}
+
+	if len(l.levels) == 0 {
+		return errors.New("take-profit ladder without levels")
+	}
+
+	total := 0.0
+	for _, level := range l.levels {
+		if level.Profit <= 0 || level.Fraction <= 0 {
+			return fmt.Errorf("invalid take-profit level: %+v", level)
+		}
+		total += level.Fraction
+	}
+
+	if total > 1+1e-9 {
+		return fmt.Errorf("take-profit levels close %.2f%% of the entry", total*100)
+	}
+
+	l.pair = entry.Pair
+	l.side = entry.Side
+	l.entry = entry.Price
+	l.stop = stop
+	l.remaining = entry.Quantity
+	l.orders = make(map[int64]model.Order)
+
+	info := l.broker.AssetsInfo(entry.Pair)
+	side, direction := model.SideTypeSell, 1.0
+	if entry.Side == model.SideTypeSell {
+		side, direction = model.SideTypeBuy, -1.0
+	}
+
+	placed := 0.0
+	for i, level := range l.levels {
+		quantity := exchange.RoundQuantity(info, entry.Quantity*level.Fraction)
+		if i == len(l.levels)-1 && total > 1-1e-9 {
+			// the entry and the placed quantities are aligned to the step size, rounding to the nearest
+			// step only removes the float error of the difference
+			quantity = exchange.Round(entry.Quantity-placed, info.StepSize, info.BaseAssetPrecision,
+				exchange.RoundNearest)
+		}
+
+		if quantity <= 0 || quantity < info.MinQuantity {
+			log.Warnf("[LADDER] %s level %.2f%% skipped, quantity %f below the minimum", entry.Pair,
+				level.Profit*100, quantity)
+			continue
+		}
+
+		price := exchange.RoundPrice(info, entry.Price*(1+direction*level.Profit))
+		order, err := l.broker.CreateOrderLimit(side, entry.Pair, quantity, price)
+		if err != nil {
+			l.cancel()
+			return err
+		}
+
+		l.orders[order.ExchangeID] = order
+		placed += quantity
+	}
+
+	l.active = true
+	return nil
+}
+
+// OnOrder updates the ladder with an order update, moving the stop to breakeven after the first fill.
+// The ladder is finished after all levels are filled
+func (l *TakeProfitLadder) OnOrder(order model.Order) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	current, ok := l.orders[order.ExchangeID]
+	if !l.active || !ok || order.Pair != l.pair || current.Status == model.OrderStatusTypeFilled {
+		return
+	}
+
+	l.orders[order.ExchangeID] = order
+	switch order.Status {
+	case model.OrderStatusTypeFilled:
+		l.remaining -= current.Quantity
+		if l.breakeven && l.stop > 0 {
+			l.stop = l.entry
+		}
+	case model.OrderStatusTypeCanceled, model.OrderStatusTypeRejected, model.OrderStatusTypeExpired:
+		// a level canceled after a partial fill has closed its executed quantity
+		l.remaining -= order.ExecutedQuantity
+		delete(l.orders, order.ExchangeID)
+	}
+
+	for _, order := range l.orders {
+		if order.Status != model.OrderStatusTypeFilled {
+			return
+		}
+	}
+
+	log.Infof("[LADDER] %s take-profit ladder completed", l.pair)
+	l.active = false
+}
+
+// OnCandle checks the stop with the close price. When it is reached, the open take-profit orders are
+// canceled and the remaining quantity is closed with a market order
+func (l *TakeProfitLadder) OnCandle(candle model.Candle) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.active || candle.Pair != l.pair || l.stop <= 0 {
+		return
+	}
+
+	if (l.side == model.SideTypeBuy && candle.Close > l.stop) ||
+		(l.side == model.SideTypeSell && candle.Close < l.stop) {
+		return
+	}
+
+	l.cancel()
+	l.active = false
+
+	side := model.SideTypeSell
+	if l.side == model.SideTypeSell {
+		side = model.SideTypeBuy
+	}
+
+	quantity := exchange.RoundQuantity(l.broker.AssetsInfo(l.pair), l.remaining)
+	if quantity <= 0 {
+		return
+	}
+
+	log.Infof("[LADDER] %s stop %f reached, closing %f", l.pair, l.stop, quantity)
+	if _, err := l.broker.CreateOrderMarket(side, l.pair, quantity); err != nil {
+		log.Errorf("[LADDER] %s stop order: %v", l.pair, err)
+	}
+}
+
+// Stop cancels the open take-profit orders and disables the ladder, keeping the remaining position
+func (l *TakeProfitLadder) Stop() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.cancel()
+	l.active = false
+}
+
+// Active returns true while the ladder has take-profit orders to be filled
+func (l *TakeProfitLadder) Active() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.active
+}
+
+// StopPrice returns the current stop price, zero when the stop is disabled
+func (l *TakeProfitLadder) StopPrice() float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.stop
+}
+
+// Remaining returns the entry quantity not closed by the filled levels
+func (l *TakeProfitLadder) Remaining() float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.remaining
+}
+
+func (l *TakeProfitLadder) cancel() {
+	for id, order := range l.orders {
+		if order.Status == model.OrderStatusTypeFilled {
+			continue
+		}
+
+		if err := l.broker.Cancel(order); err != nil {
+			log.Errorf("[LADDER] %s cancel order %d: %v", l.pair, order.ExchangeID, err)
+			continue
+		}
+		l.remaining -= order.ExecutedQuantity
+		delete(l.orders, id)
+	}
+}
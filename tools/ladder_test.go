@@ -0,0 +1,136 @@
+package tools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools"
+)
+
+func TestTakeProfitLadder(t *testing.T) {
+	levels := []tools.TakeProfitLevel{{Profit: 0.02, Fraction: 0.5}, {Profit: 0.04, Fraction: 0.3},
+		{Profit: 0.06, Fraction: 0.2}}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	setup := func(t *testing.T) (*exchange.PaperWallet, model.Order) {
+		wallet := exchange.NewPaperWallet(context.Background(), "USDT", exchange.WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 100, High: 100, Low: 100, Complete: true})
+
+		entry, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		require.NoError(t, err)
+		return wallet, entry
+	}
+
+	update := func(ladder *tools.TakeProfitLadder, wallet *exchange.PaperWallet, candle model.Candle) {
+		wallet.OnCandle(candle)
+		// publishes the order updates, as the order feed of the bot
+		for id := int64(1); id <= 10; id++ {
+			if order, err := wallet.Order("BTCUSDT", id); err == nil {
+				ladder.OnOrder(order)
+			}
+		}
+		ladder.OnCandle(candle)
+	}
+
+	t.Run("place levels", func(t *testing.T) {
+		wallet, entry := setup(t)
+		ladder := tools.NewTakeProfitLadder(wallet, levels)
+		require.NoError(t, ladder.Start(entry, 95))
+		require.True(t, ladder.Active())
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 3)
+		for i, expected := range []struct{ price, quantity float64 }{{102, 0.5}, {104, 0.3}, {106, 0.2}} {
+			require.Equal(t, model.SideTypeSell, orders[i].Side)
+			require.Equal(t, expected.price, orders[i].Price)
+			require.Equal(t, expected.quantity, orders[i].Quantity)
+		}
+
+		require.Error(t, ladder.Start(entry, 95))
+	})
+
+	t.Run("breakeven after first fill", func(t *testing.T) {
+		wallet, entry := setup(t)
+		ladder := tools.NewTakeProfitLadder(wallet, levels)
+		require.NoError(t, ladder.Start(entry, 95))
+
+		update(ladder, wallet, model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 101, High: 102.5,
+			Low: 100, Complete: true})
+		require.Equal(t, 100.0, ladder.StopPrice())
+		require.Equal(t, 0.5, ladder.Remaining())
+
+		// stop reached, the remaining levels are canceled and the position is closed
+		update(ladder, wallet, model.Candle{Pair: "BTCUSDT", Time: start.Add(2 * time.Hour), Close: 99.5,
+			High: 101, Low: 99, Complete: true})
+		require.False(t, ladder.Active())
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("all levels filled", func(t *testing.T) {
+		wallet, entry := setup(t)
+		ladder := tools.NewTakeProfitLadder(wallet, levels, tools.WithLadderBreakeven(false))
+		require.NoError(t, ladder.Start(entry, 95))
+
+		update(ladder, wallet, model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 105, High: 104,
+			Low: 100, Complete: true})
+		require.Equal(t, 95.0, ladder.StopPrice())
+		require.InDelta(t, 0.2, ladder.Remaining(), 1e-9)
+		require.True(t, ladder.Active())
+
+		update(ladder, wallet, model.Candle{Pair: "BTCUSDT", Time: start.Add(2 * time.Hour), Close: 106, High: 107,
+			Low: 104, Complete: true})
+		require.False(t, ladder.Active())
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("partial fill then cancel", func(t *testing.T) {
+		wallet, entry := setup(t)
+		ladder := tools.NewTakeProfitLadder(wallet, levels)
+		require.NoError(t, ladder.Start(entry, 95))
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+
+		first := orders[0]
+		first.Status = model.OrderStatusTypePartiallyFilled
+		first.ExecutedQuantity = 0.2
+		ladder.OnOrder(first)
+		require.Equal(t, 1.0, ladder.Remaining())
+
+		first.Status = model.OrderStatusTypeCanceled
+		ladder.OnOrder(first)
+		require.InDelta(t, 0.8, ladder.Remaining(), 1e-9)
+
+		// the ladder cancels a partially filled level
+		second := orders[1]
+		second.Status = model.OrderStatusTypePartiallyFilled
+		second.ExecutedQuantity = 0.1
+		ladder.OnOrder(second)
+		ladder.Stop()
+		require.InDelta(t, 0.7, ladder.Remaining(), 1e-9)
+	})
+
+	t.Run("invalid levels", func(t *testing.T) {
+		wallet, entry := setup(t)
+		ladder := tools.NewTakeProfitLadder(wallet, []tools.TakeProfitLevel{{Profit: 0.02, Fraction: 0.8},
+			{Profit: 0.04, Fraction: 0.5}})
+		require.Error(t, ladder.Start(entry, 0))
+		require.False(t, ladder.Active())
+	})
+}
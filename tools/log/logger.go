@@ -92,3 +92,7 @@ func Debug(messages ...interface{}) {
 func Debugf(format string, messages ...interface{}) {
 	logrus.Debugf(format, messages...)
 }
+
+func IsLevelEnabled(level logrus.Level) bool {
+	return logrus.IsLevelEnabled(level)
+}
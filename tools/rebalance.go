@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rodrigo-brito/ninjabot"
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/service"
+	log "github.com/sirupsen/logrus"
+)
+
+type RebalanceOrder struct {
+	Pair     string
+	Side     ninjabot.SideType
+	Quantity float64
+	Value    float64
+}
+
+// Rebalancer keeps the portfolio close to target weights by asset, the weight not
+// allocated to assets is kept in the quote currency. e.g. {"BTC": 0.5, "ETH": 0.3} keeps 20% in quote
+type Rebalancer struct {
+	quote     string
+	weights   map[string]float64
+	tolerance float64
+	interval  time.Duration
+	lastRun   time.Time
+	prices    map[string]float64
+}
+
+type RebalancerOption func(*Rebalancer)
+
+// WithRebalanceTolerance sets the tolerance band, as a fraction of the portfolio value,
+// before an asset is rebalanced. Default: 0.05 (5%)
+func WithRebalanceTolerance(tolerance float64) RebalancerOption {
+	return func(r *Rebalancer) {
+		r.tolerance = tolerance
+	}
+}
+
+// WithRebalanceInterval sets the minimum time between rebalances. Default: 24h
+func WithRebalanceInterval(interval time.Duration) RebalancerOption {
+	return func(r *Rebalancer) {
+		r.interval = interval
+	}
+}
+
+func NewRebalancer(quote string, weights map[string]float64, options ...RebalancerOption) *Rebalancer {
+	rebalancer := &Rebalancer{
+		quote:     quote,
+		weights:   weights,
+		tolerance: 0.05,
+		interval:  24 * time.Hour,
+		prices:    make(map[string]float64),
+	}
+
+	for _, option := range options {
+		option(rebalancer)
+	}
+
+	return rebalancer
+}
+
+// Orders calculates the market orders needed to restore the target weights, given the account
+// balances and the last price of each asset. Quantities are rounded to the pair step size and orders
+// below the minimum quantity or notional are skipped. Sell orders are returned first to release funds.
+func (r *Rebalancer) Orders(account model.Account, prices map[string]float64,
+	assetsInfo func(pair string) model.AssetInfo) []RebalanceOrder {
+
+	values := make(map[string]float64)
+	equity := 0.0
+	for _, balance := range account.Balances {
+		total := balance.Free + balance.Lock
+		if balance.Asset == r.quote {
+			equity += total
+			continue
+		}
+
+		if _, ok := r.weights[balance.Asset]; ok {
+			values[balance.Asset] = total * prices[balance.Asset]
+			equity += values[balance.Asset]
+		}
+	}
+
+	if equity <= 0 {
+		return nil
+	}
+
+	orders := make([]RebalanceOrder, 0)
+	for asset, weight := range r.weights {
+		price := prices[asset]
+		if price <= 0 {
+			log.Warnf("[REBALANCE] price not available for %s", asset)
+			continue
+		}
+
+		diff := weight*equity - values[asset]
+		if math.Abs(diff)/equity <= r.tolerance {
+			continue
+		}
+
+		pair := asset + r.quote
+		info := assetsInfo(pair)
+		quantity := exchange.RoundQuantity(info, math.Abs(diff)/price)
+		if quantity <= 0 || quantity < info.MinQuantity || quantity*price < info.MinNotional {
+			continue
+		}
+
+		side := ninjabot.SideTypeBuy
+		if diff < 0 {
+			side = ninjabot.SideTypeSell
+		}
+
+		orders = append(orders, RebalanceOrder{
+			Pair:     pair,
+			Side:     side,
+			Quantity: quantity,
+			Value:    quantity * price,
+		})
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].Side != orders[j].Side {
+			return orders[i].Side == ninjabot.SideTypeSell
+		}
+		return orders[i].Pair < orders[j].Pair
+	})
+
+	return orders
+}
+
+// Rebalance places the market orders needed to restore the target weights
+func (r *Rebalancer) Rebalance(broker service.Broker, prices map[string]float64) ([]model.Order, error) {
+	account, err := broker.Account()
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0)
+	for _, rebalance := range r.Orders(account, prices, broker.AssetsInfo) {
+		log.Infof("[REBALANCE] %s %f %s (~%.2f %s)", rebalance.Side, rebalance.Quantity, rebalance.Pair,
+			rebalance.Value, r.quote)
+		order, err := broker.CreateOrderMarket(rebalance.Side, rebalance.Pair, rebalance.Quantity)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// Update registers the last price of the dataframe pair and rebalances the portfolio when
+// the interval is reached and the prices of all assets are known. It should be called in
+// the strategy OnCandle for every pair
+func (r *Rebalancer) Update(df *ninjabot.Dataframe, broker service.Broker) {
+	asset, _ := exchange.SplitAssetQuote(df.Pair)
+	r.prices[asset] = df.Close.Last(0)
+
+	for asset := range r.weights {
+		if r.prices[asset] <= 0 {
+			return
+		}
+	}
+
+	if !r.lastRun.IsZero() && df.LastUpdate.Sub(r.lastRun) < r.interval {
+		return
+	}
+
+	r.lastRun = df.LastUpdate
+	if _, err := r.Rebalance(broker, r.prices); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,104 @@
+package tools_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rodrigo-brito/ninjabot"
+	"github.com/rodrigo-brito/ninjabot/exchange"
+	"github.com/rodrigo-brito/ninjabot/model"
+	"github.com/rodrigo-brito/ninjabot/tools"
+)
+
+func TestRebalancer_Orders(t *testing.T) {
+	rebalancer := tools.NewRebalancer("USDT", map[string]float64{"BTC": 0.5, "ETH": 0.25},
+		tools.WithRebalanceTolerance(0.05))
+
+	info := func(pair string) model.AssetInfo {
+		return model.AssetInfo{StepSize: 0.01, BaseAssetPrecision: 2, MinNotional: 10}
+	}
+
+	t.Run("rebalance weights", func(t *testing.T) {
+		account := model.Account{Balances: []model.Balance{
+			{Asset: "USDT", Free: 200},
+			{Asset: "BTC", Free: 0.7},
+			{Asset: "ETH", Free: 1},
+			{Asset: "BNB", Free: 10},
+		}}
+
+		// equity = 200 + 700 + 100 = 1000 (BNB is ignored)
+		orders := rebalancer.Orders(account, map[string]float64{"BTC": 1000, "ETH": 100}, info)
+		require.Equal(t, []tools.RebalanceOrder{
+			{Pair: "BTCUSDT", Side: ninjabot.SideTypeSell, Quantity: 0.2, Value: 200},
+			{Pair: "ETHUSDT", Side: ninjabot.SideTypeBuy, Quantity: 1.5, Value: 150},
+		}, orders)
+	})
+
+	t.Run("within tolerance", func(t *testing.T) {
+		account := model.Account{Balances: []model.Balance{
+			{Asset: "USDT", Free: 260},
+			{Asset: "BTC", Free: 0.49},
+			{Asset: "ETH", Free: 2.5},
+		}}
+
+		orders := rebalancer.Orders(account, map[string]float64{"BTC": 1000, "ETH": 100}, info)
+		require.Empty(t, orders)
+	})
+
+	t.Run("min notional", func(t *testing.T) {
+		rebalancer := tools.NewRebalancer("USDT", map[string]float64{"BTC": 0.5}, tools.WithRebalanceTolerance(0))
+		account := model.Account{Balances: []model.Balance{{Asset: "USDT", Free: 10}}}
+
+		orders := rebalancer.Orders(account, map[string]float64{"BTC": 1}, info)
+		require.Empty(t, orders)
+	})
+}
+
+func TestRebalancer_Update(t *testing.T) {
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	rebalancer := tools.NewRebalancer("USDT", map[string]float64{"BTC": 0.5, "ETH": 0.5},
+		tools.WithRebalanceInterval(time.Hour))
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	update := func(pair string, price float64, at time.Time) {
+		wallet.OnCandle(model.Candle{Pair: pair, Time: at, Close: price, Complete: true})
+		rebalancer.Update(&ninjabot.Dataframe{
+			Pair:       pair,
+			Close:      model.Series[float64]{price},
+			LastUpdate: at,
+		}, wallet)
+	}
+
+	// waits for all prices before rebalancing
+	update("BTCUSDT", 100, start)
+	asset, _, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Zero(t, asset)
+
+	update("ETHUSDT", 10, start)
+	asset, _, err = wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 5.0, asset)
+	asset, _, err = wallet.Position("ETHUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 50.0, asset)
+
+	// BTC doubles, but the interval is not reached
+	update("BTCUSDT", 200, start.Add(30*time.Minute))
+	asset, _, err = wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 5.0, asset)
+
+	// equity = 1000 + 500, target = 750 each
+	update("BTCUSDT", 200, start.Add(time.Hour))
+	asset, _, err = wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 3.75, asset)
+	asset, _, err = wallet.Position("ETHUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 75.0, asset)
+}
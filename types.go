@@ -7,6 +7,8 @@ import (
 type (
 	Settings         = model.Settings
 	TelegramSettings = model.TelegramSettings
+	TelegramRole     = model.TelegramRole
+	SlackSettings    = model.SlackSettings
 	Dataframe        = model.Dataframe
 	Series           = model.Series[float64]
 	SideType         = model.SideType
@@ -31,4 +33,7 @@ var (
 	OrderStatusTypePendingCancel   = model.OrderStatusTypePendingCancel
 	OrderStatusTypeRejected        = model.OrderStatusTypeRejected
 	OrderStatusTypeExpired         = model.OrderStatusTypeExpired
+	TelegramRoleViewer             = model.TelegramRoleViewer
+	TelegramRoleTrader             = model.TelegramRoleTrader
+	TelegramRoleAdmin              = model.TelegramRoleAdmin
 )